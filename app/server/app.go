@@ -9,14 +9,16 @@ import (
 
 	"github.com/facebookgo/inject"
 	"github.com/org39/webapp-tutorial-backend/pkg/db"
+	"github.com/org39/webapp-tutorial-backend/pkg/mail"
 )
 
 var DepencencyInjector inject.Graph
 
 type App struct {
 	// infra
-	Config *Config `inject:""`
-	DB     *db.DB  `inject:""`
+	Config *Config     `inject:""`
+	DB     *db.DB      `inject:""`
+	Mailer mail.Mailer `inject:""`
 
 	// application usecase
 	AuthUsecase auth.Usecase `inject:""`
@@ -1,18 +1,49 @@
 package app
 
 import (
+	"github.com/org39/webapp-tutorial-backend/repo"
 	"github.com/org39/webapp-tutorial-backend/usecase/auth"
 
 	"github.com/facebookgo/inject"
 )
 
 func newAuthUsecase() error {
+	r, err := repo.NewRefreshTokenRepository()
+	if err != nil {
+		return err
+	}
+
+	s, err := repo.NewSessionRepository()
+	if err != nil {
+		return err
+	}
+
+	g, err := repo.NewTokenGenerationRepository()
+	if err != nil {
+		return err
+	}
+
+	p, err := repo.NewPersonalAccessTokenRepository()
+	if err != nil {
+		return err
+	}
+
+	a, err := repo.NewAccountRepository()
+	if err != nil {
+		return err
+	}
+
 	u, err := auth.NewService()
 	if err != nil {
 		return err
 	}
 
 	err = DepencencyInjector.Provide(
+		&inject.Object{Value: r},
+		&inject.Object{Value: s},
+		&inject.Object{Value: g},
+		&inject.Object{Value: p},
+		&inject.Object{Value: a},
 		&inject.Object{Value: u},
 	)
 	if err != nil {
@@ -16,20 +16,78 @@ type Config struct {
 	DatabasePass string `required:"true" envconfig:"DATABASE_PASS"`
 	DatabaseName string `required:"true" envconfig:"DATABASE_NAME"`
 
+	// mail
+	MailDriver   string `default:"log" envconfig:"MAIL_DRIVER"`
+	MailFilePath string `envconfig:"MAIL_FILE_PATH"`
+
+	// blob storage, for uploaded files
+	BlobDriver string `default:"local" envconfig:"BLOB_DRIVER"`
+	BlobPath   string `default:"./blobs" envconfig:"BLOB_PATH"`
+
 	// User usecase
-	UserTable        string `required:"true" envconfig:"USER_TABLE"`
-	UserPasswordSalt string `required:"true" envconfig:"USER_PASSWORD_SALT"`
+	UserTable                      string            `required:"true" envconfig:"USER_TABLE"`
+	UserTokenTable                 string            `required:"true" envconfig:"USER_TOKEN_TABLE"`
+	UserPasswordPepper             string            `required:"true" envconfig:"USER_PASSWORD_PEPPER"`
+	UserPasswordHashAlgorithm      string            `default:"argon2id" envconfig:"USER_PASSWORD_HASH_ALGORITHM"`
+	UserPasswordArgon2Time         uint32            `default:"3" envconfig:"USER_PASSWORD_ARGON2_TIME"`
+	UserPasswordArgon2Memory       uint32            `default:"65536" envconfig:"USER_PASSWORD_ARGON2_MEMORY"`
+	UserPasswordArgon2Threads      uint8             `default:"4" envconfig:"USER_PASSWORD_ARGON2_THREADS"`
+	UserPasswordBcryptCost         int               `default:"12" envconfig:"USER_PASSWORD_BCRYPT_COST"`
+	UserPasswordSalt               string            `envconfig:"USER_PASSWORD_SALT"`
+	UserPasswordMinLength          int               `default:"8" envconfig:"USER_PASSWORD_MIN_LENGTH"`
+	UserPasswordMinScore           int               `default:"2" envconfig:"USER_PASSWORD_MIN_SCORE"`
+	UserPasswordBreachedDir        string            `envconfig:"USER_PASSWORD_BREACHED_DIR"`
+	UserPasswordResetURL           string            `default:"http://localhost:8080/user/password/reset" envconfig:"USER_PASSWORD_RESET_URL"`
+	UserPasswordResetTokenDuration time.Duration     `default:"1h" envconfig:"USER_PASSWORD_RESET_TOKEN_DURATION"`
+	UserVerificationURL            string            `default:"http://localhost:8080/user/verify" envconfig:"USER_VERIFICATION_URL"`
+	UserVerificationTokenDuration  time.Duration     `default:"24h" envconfig:"USER_VERIFICATION_TOKEN_DURATION"`
+	UserMagicLinkURL               string            `default:"http://localhost:8080/user/magic-link/consume" envconfig:"USER_MAGIC_LINK_URL"`
+	UserMagicLinkTokenDuration     time.Duration     `default:"15m" envconfig:"USER_MAGIC_LINK_TOKEN_DURATION"`
+	UserMFATable                   string            `required:"true" envconfig:"USER_MFA_TABLE"`
+	UserMFAIssuer                  string            `default:"webapp-tutorial" envconfig:"USER_MFA_ISSUER"`
+	UserLoginFreeAttempts          int               `default:"3" envconfig:"USER_LOGIN_FREE_ATTEMPTS"`
+	UserLoginLockoutAttempts       int               `default:"10" envconfig:"USER_LOGIN_LOCKOUT_ATTEMPTS"`
+	UserLoginIPFreeAttempts        int               `default:"20" envconfig:"USER_LOGIN_IP_FREE_ATTEMPTS"`
+	UserLoginIPLockoutAttempts     int               `default:"100" envconfig:"USER_LOGIN_IP_LOCKOUT_ATTEMPTS"`
+	UserLoginDelay                 time.Duration     `default:"1s" envconfig:"USER_LOGIN_DELAY"`
+	UserLoginMaxDelay              time.Duration     `default:"1m" envconfig:"USER_LOGIN_MAX_DELAY"`
+	UserLoginLockoutDuration       time.Duration     `default:"15m" envconfig:"USER_LOGIN_LOCKOUT_DURATION"`
+	UserIdentityTable              string            `required:"true" envconfig:"USER_IDENTITY_TABLE"`
+	UserProfileTable               string            `required:"true" envconfig:"USER_PROFILE_TABLE"`
+	UserOAuthIssuers               map[string]string `envconfig:"USER_OAUTH_ISSUERS"`
+	UserOAuthClientIDs             map[string]string `envconfig:"USER_OAUTH_CLIENT_IDS"`
+	UserOAuthClientSecrets         map[string]string `envconfig:"USER_OAUTH_CLIENT_SECRETS"`
+	UserOAuthCallbackURL           string            `default:"http://localhost:8080/user/oauth/{provider}/callback" envconfig:"USER_OAUTH_CALLBACK_URL"`
 
 	// Auth usecase
-	AuthSecret               string        `required:"true" envconfig:"AUTH_SECRET"`
-	AuthAccessTokenDuration  time.Duration `default:"6h" envconfig:"AUTH_ACCESS_TOKEN_DURATION"`
-	AuthRefreshTokenDuration time.Duration `default:"720h" envconfig:"AUTH_REFRESH_TOKEN_DURATION"`
+	AuthSecret                   string            `envconfig:"AUTH_SECRET"`
+	AuthSigningAlgorithm         string            `default:"HS256" envconfig:"AUTH_SIGNING_ALGORITHM"`
+	AuthSigningKeyID             string            `envconfig:"AUTH_SIGNING_KEY_ID"`
+	AuthSigningKeyFile           string            `envconfig:"AUTH_SIGNING_KEY_FILE"`
+	AuthVerificationKeyFiles     map[string]string `envconfig:"AUTH_VERIFICATION_KEY_FILES"`
+	AuthAccessTokenDuration      time.Duration     `default:"6h" envconfig:"AUTH_ACCESS_TOKEN_DURATION"`
+	AuthRefreshTokenDuration     time.Duration     `default:"720h" envconfig:"AUTH_REFRESH_TOKEN_DURATION"`
+	AuthMFATokenDuration         time.Duration     `default:"5m" envconfig:"AUTH_MFA_TOKEN_DURATION"`
+	AuthRefreshTokenTable        string            `required:"true" envconfig:"AUTH_REFRESH_TOKEN_TABLE"`
+	AuthSessionTable             string            `required:"true" envconfig:"AUTH_SESSION_TABLE"`
+	AuthTokenGenerationTable     string            `required:"true" envconfig:"AUTH_TOKEN_GENERATION_TABLE"`
+	AuthPersonalAccessTokenTable string            `required:"true" envconfig:"AUTH_PERSONAL_ACCESS_TOKEN_TABLE"`
+	AuthIntrospectionClients     map[string]string `envconfig:"AUTH_INTROSPECTION_CLIENTS"`
 
 	// Todo usecase
-	TodoTable string `required:"true" envconfig:"TODO_TABLE"`
+	TodoTable        string `required:"true" envconfig:"TODO_TABLE"`
+	TagTable         string `required:"true" envconfig:"TAG_TABLE"`
+	TodoTagTable     string `required:"true" envconfig:"TODO_TAG_TABLE"`
+	TodoSearchDriver string `default:"mysql" envconfig:"TODO_SEARCH_DRIVER"`
 
 	// Rest Presenter
-	RestAuthSecureRefreshToken bool `required:"true" envconfig:"REST_AUTH_SECURE_REFRESH_TOKEN"`
+	RestAuthSecureRefreshToken     bool   `required:"true" envconfig:"REST_AUTH_SECURE_REFRESH_TOKEN"`
+	RestAuthRequireVerifiedEmail   bool   `default:"false" envconfig:"REST_AUTH_REQUIRE_VERIFIED_EMAIL"`
+	RestRefreshTokenCookieSameSite string `default:"strict" envconfig:"REST_REFRESH_TOKEN_COOKIE_SAME_SITE"`
+	RestRefreshTokenCookieDomain   string `envconfig:"REST_REFRESH_TOKEN_COOKIE_DOMAIN"`
+	RestRefreshTokenCookiePath     string `default:"/user" envconfig:"REST_REFRESH_TOKEN_COOKIE_PATH"`
+	RestTrustProxyHeaders          bool   `default:"false" envconfig:"REST_TRUST_PROXY_HEADERS"`
+	RestOAuthRedirectURL           string `default:"http://localhost:3000/oauth/callback" envconfig:"REST_OAUTH_REDIRECT_URL"`
 }
 
 func NewConfig() (*Config, error) {
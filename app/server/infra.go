@@ -2,9 +2,19 @@ package app
 
 import (
 	"database/sql/driver"
+	"fmt"
+	"strings"
 
+	"github.com/org39/webapp-tutorial-backend/entity"
+	"github.com/org39/webapp-tutorial-backend/pkg/blob"
+	"github.com/org39/webapp-tutorial-backend/pkg/breach"
+	"github.com/org39/webapp-tutorial-backend/pkg/cookie"
+	"github.com/org39/webapp-tutorial-backend/pkg/crypt"
 	"github.com/org39/webapp-tutorial-backend/pkg/db"
 	"github.com/org39/webapp-tutorial-backend/pkg/log"
+	"github.com/org39/webapp-tutorial-backend/pkg/mail"
+	"github.com/org39/webapp-tutorial-backend/repo"
+	"github.com/org39/webapp-tutorial-backend/usecase/todo"
 
 	"github.com/facebookgo/inject"
 )
@@ -29,17 +39,122 @@ func newInfra(dbConnectorFn func(*Config) (driver.Connector, error)) error {
 		return err
 	}
 
+	// mailer
+	mailer, err := mail.New(conf.MailDriver, conf.MailFilePath)
+	if err != nil {
+		return err
+	}
+
+	// uploaded files
+	blobStore, err := blob.New(conf.BlobDriver, conf.BlobPath)
+	if err != nil {
+		return err
+	}
+
+	// where todos are searched
+	todoSearchIndex, err := newTodoSearchIndex(conf)
+	if err != nil {
+		return err
+	}
+
+	// token signing keys
+	keySet, err := newKeySet(conf)
+	if err != nil {
+		return err
+	}
+
+	// login brute-force protection
+	accountLoginThrottle, ipLoginThrottle, err := newLoginThrottles(conf)
+	if err != nil {
+		return err
+	}
+
+	// password hashing
+	passwordHasher, err := newPasswordHasher(conf)
+	if err != nil {
+		return err
+	}
+
+	// which new passwords are accepted
+	passwordPolicy, breachedPasswords, err := newPasswordPolicy(conf)
+	if err != nil {
+		return err
+	}
+
+	// login with external providers
+	oauthProviders, err := newOAuthProviders(conf)
+	if err != nil {
+		return err
+	}
+
+	// services allowed to introspect tokens
+	introspectionClients, err := newIntrospectionClients(conf)
+	if err != nil {
+		return err
+	}
+
+	// cookies of the rest presenter
+	refreshTokenCookie, csrfCookie, err := newCookiePolicies(conf)
+	if err != nil {
+		return err
+	}
+
 	// build depency graph
 	err = DepencencyInjector.Provide(
 		&inject.Object{Value: conf},
 		&inject.Object{Value: database},
+		&inject.Object{Value: keySet},
+		&inject.Object{Value: mailer},
+		&inject.Object{Value: blobStore},
+		&inject.Object{Value: todoSearchIndex},
+		&inject.Object{Value: passwordHasher},
+		&inject.Object{Value: breachedPasswords},
 		&inject.Object{Name: "repo.user.table", Value: conf.UserTable},
+		&inject.Object{Name: "repo.user.owned_tables", Value: []string{
+			conf.TodoTable,
+			conf.TagTable,
+			conf.TodoTagTable,
+			conf.UserTokenTable,
+			conf.UserMFATable,
+			conf.UserIdentityTable,
+			conf.UserProfileTable,
+			conf.AuthRefreshTokenTable,
+			conf.AuthSessionTable,
+			conf.AuthTokenGenerationTable,
+			conf.AuthPersonalAccessTokenTable,
+		}},
+		&inject.Object{Name: "repo.user_token.table", Value: conf.UserTokenTable},
+		&inject.Object{Name: "repo.user_mfa.table", Value: conf.UserMFATable},
+		&inject.Object{Name: "repo.identity.table", Value: conf.UserIdentityTable},
+		&inject.Object{Name: "repo.user_profile.table", Value: conf.UserProfileTable},
 		&inject.Object{Name: "repo.todo.table", Value: conf.TodoTable},
-		&inject.Object{Name: "usecase.user.password_salt", Value: conf.UserPasswordSalt},
+		&inject.Object{Name: "repo.tag.table", Value: conf.TagTable},
+		&inject.Object{Name: "repo.todo_tag.table", Value: conf.TodoTagTable},
+		&inject.Object{Name: "repo.refresh_token.table", Value: conf.AuthRefreshTokenTable},
+		&inject.Object{Name: "repo.session.table", Value: conf.AuthSessionTable},
+		&inject.Object{Name: "repo.token_generation.table", Value: conf.AuthTokenGenerationTable},
+		&inject.Object{Name: "repo.personal_access_token.table", Value: conf.AuthPersonalAccessTokenTable},
+		&inject.Object{Name: "usecase.user.password_reset_url", Value: conf.UserPasswordResetURL},
+		&inject.Object{Name: "usecase.user.password_reset_token_duration", Value: conf.UserPasswordResetTokenDuration},
+		&inject.Object{Name: "usecase.user.verification_url", Value: conf.UserVerificationURL},
+		&inject.Object{Name: "usecase.user.verification_token_duration", Value: conf.UserVerificationTokenDuration},
+		&inject.Object{Name: "usecase.user.magic_link_url", Value: conf.UserMagicLinkURL},
+		&inject.Object{Name: "usecase.user.magic_link_token_duration", Value: conf.UserMagicLinkTokenDuration},
+		&inject.Object{Name: "usecase.user.mfa_issuer", Value: conf.UserMFAIssuer},
+		&inject.Object{Name: "usecase.user.account_login_throttle", Value: accountLoginThrottle},
+		&inject.Object{Name: "usecase.user.ip_login_throttle", Value: ipLoginThrottle},
+		&inject.Object{Name: "usecase.user.oauth_providers", Value: oauthProviders},
+		&inject.Object{Name: "usecase.user.password_policy", Value: passwordPolicy},
 		&inject.Object{Name: "usecase.auth.secret", Value: conf.AuthSecret},
 		&inject.Object{Name: "usecase.auth.access_token_duration", Value: conf.AuthAccessTokenDuration},
 		&inject.Object{Name: "usecase.auth.refresh_token_duration", Value: conf.AuthRefreshTokenDuration},
-		&inject.Object{Name: "rest.auth.secure_refresh_token", Value: conf.RestAuthSecureRefreshToken},
+		&inject.Object{Name: "usecase.auth.mfa_token_duration", Value: conf.AuthMFATokenDuration},
+		&inject.Object{Name: "usecase.auth.introspection_clients", Value: introspectionClients},
+		&inject.Object{Name: "rest.auth.refresh_token_cookie", Value: refreshTokenCookie},
+		&inject.Object{Name: "rest.auth.csrf_cookie", Value: csrfCookie},
+		&inject.Object{Name: "rest.auth.require_verified_email", Value: conf.RestAuthRequireVerifiedEmail},
+		&inject.Object{Name: "rest.trust_proxy_headers", Value: conf.RestTrustProxyHeaders},
+		&inject.Object{Name: "rest.oauth.redirect_url", Value: conf.RestOAuthRedirectURL},
 	)
 	if err != nil {
 		return err
@@ -47,3 +162,112 @@ func newInfra(dbConnectorFn func(*Config) (driver.Connector, error)) error {
 
 	return nil
 }
+
+// newTodoSearchIndex returns the index of the driver, the memory one only finds todos written since the start.
+func newTodoSearchIndex(conf *Config) (todo.SearchIndex, error) {
+	switch conf.TodoSearchDriver {
+	case repo.TodoSearchDriverMySQL:
+		return repo.NewTodoSearchIndex()
+	case repo.TodoSearchDriverMemory:
+		return repo.NewMemoryTodoSearchIndex()
+	}
+
+	return nil, fmt.Errorf("unknown todo search driver %q", conf.TodoSearchDriver)
+}
+
+func newPasswordHasher(conf *Config) (*crypt.PasswordHasher, error) {
+	hasher, err := crypt.NewPasswordHasher([]byte(conf.UserPasswordPepper),
+		crypt.WithAlgorithm(conf.UserPasswordHashAlgorithm),
+		crypt.WithArgon2Params(crypt.Argon2Params{
+			Time:    conf.UserPasswordArgon2Time,
+			Memory:  conf.UserPasswordArgon2Memory,
+			Threads: conf.UserPasswordArgon2Threads,
+		}),
+		crypt.WithBcryptCost(conf.UserPasswordBcryptCost),
+		crypt.WithLegacySalt(conf.UserPasswordSalt),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid password hashing: %w", err)
+	}
+
+	return hasher, nil
+}
+
+// newPasswordPolicy returns the policy of new passwords and the list of breached passwords they are checked against.
+func newPasswordPolicy(conf *Config) (*entity.PasswordPolicy, breach.Checker, error) {
+	policy := entity.NewFactory().NewPasswordPolicy(conf.UserPasswordMinLength, conf.UserPasswordMinScore)
+	if err := policy.Valid(); err != nil {
+		return nil, nil, fmt.Errorf("invalid password policy: %w", err)
+	}
+
+	breached, err := breach.New(conf.UserPasswordBreachedDir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid breached passwords: %w", err)
+	}
+
+	return policy, breached, nil
+}
+
+// newCookiePolicies returns the policies of the refresh token cookie and of the csrf cookie issued with it.
+func newCookiePolicies(conf *Config) (*cookie.Policy, *cookie.Policy, error) {
+	refreshToken, err := cookie.New(
+		cookie.WithSecure(conf.RestAuthSecureRefreshToken),
+		cookie.WithSameSite(conf.RestRefreshTokenCookieSameSite),
+		cookie.WithDomain(conf.RestRefreshTokenCookieDomain),
+		cookie.WithPath(conf.RestRefreshTokenCookiePath),
+		cookie.WithMaxAge(conf.AuthRefreshTokenDuration),
+	)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid refresh token cookie: %w", err)
+	}
+
+	// the frontend reads the csrf token from any page, to send it back in a header
+	csrf, err := cookie.New(
+		cookie.WithSecure(conf.RestAuthSecureRefreshToken),
+		cookie.WithHttpOnly(false),
+		cookie.WithSameSite(conf.RestRefreshTokenCookieSameSite),
+		cookie.WithDomain(conf.RestRefreshTokenCookieDomain),
+		cookie.WithPath("/"),
+		cookie.WithMaxAge(conf.AuthRefreshTokenDuration),
+	)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid csrf cookie: %w", err)
+	}
+
+	return refreshToken, csrf, nil
+}
+
+func newLoginThrottles(conf *Config) (*entity.LoginThrottle, *entity.LoginThrottle, error) {
+	account := entity.NewFactory().NewLoginThrottle(
+		conf.UserLoginFreeAttempts, conf.UserLoginDelay, conf.UserLoginMaxDelay,
+		conf.UserLoginLockoutAttempts, conf.UserLoginLockoutDuration,
+	)
+	if err := account.Valid(); err != nil {
+		return nil, nil, fmt.Errorf("invalid login throttle: %w", err)
+	}
+
+	// addresses are shared behind NAT, they get more room than a single account
+	ip := entity.NewFactory().NewLoginThrottle(
+		conf.UserLoginIPFreeAttempts, conf.UserLoginDelay, conf.UserLoginMaxDelay,
+		conf.UserLoginIPLockoutAttempts, conf.UserLoginLockoutDuration,
+	)
+	if err := ip.Valid(); err != nil {
+		return nil, nil, fmt.Errorf("invalid login throttle: %w", err)
+	}
+
+	return account, ip, nil
+}
+
+// newIntrospectionClients reads client ids and the SHA-256 digests of their secrets, the secrets themselves are not configured.
+func newIntrospectionClients(conf *Config) (map[string]*entity.IntrospectionClient, error) {
+	clients := map[string]*entity.IntrospectionClient{}
+	for id, secretHash := range conf.AuthIntrospectionClients {
+		c := entity.NewFactory().NewIntrospectionClient(id, strings.ToLower(secretHash))
+		if err := c.Valid(); err != nil {
+			return nil, fmt.Errorf("AUTH_INTROSPECTION_CLIENTS: invalid client %q: %w", id, err)
+		}
+		clients[id] = c
+	}
+
+	return clients, nil
+}
@@ -0,0 +1,47 @@
+package app
+
+import (
+	"fmt"
+
+	"github.com/org39/webapp-tutorial-backend/pkg/jwk"
+)
+
+const (
+	signingAlgorithmHMAC = "HS256"
+)
+
+func newKeySet(conf *Config) (*jwk.KeySet, error) {
+	// keys retired from signing, still accepted until issued tokens expire
+	verification := []*jwk.Key{}
+	for kid, path := range conf.AuthVerificationKeyFiles {
+		k, err := jwk.LoadPublicKey(kid, path)
+		if err != nil {
+			return nil, err
+		}
+		verification = append(verification, k)
+	}
+
+	switch conf.AuthSigningAlgorithm {
+	case signingAlgorithmHMAC:
+		if conf.AuthSecret == "" {
+			return nil, fmt.Errorf("AUTH_SECRET is required with %s signing", signingAlgorithmHMAC)
+		}
+		return jwk.NewKeySet(nil, verification...), nil
+
+	case jwk.AlgorithmRS256, jwk.AlgorithmEdDSA:
+		if conf.AuthSigningKeyID == "" || conf.AuthSigningKeyFile == "" {
+			return nil, fmt.Errorf("AUTH_SIGNING_KEY_ID and AUTH_SIGNING_KEY_FILE are required with %s signing", conf.AuthSigningAlgorithm)
+		}
+
+		signing, err := jwk.LoadPrivateKey(conf.AuthSigningKeyID, conf.AuthSigningKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		if signing.Algorithm != conf.AuthSigningAlgorithm {
+			return nil, fmt.Errorf("AUTH_SIGNING_KEY_FILE is a %s key, but AUTH_SIGNING_ALGORITHM is %s", signing.Algorithm, conf.AuthSigningAlgorithm)
+		}
+		return jwk.NewKeySet(signing, verification...), nil
+	}
+
+	return nil, fmt.Errorf("unsupported AUTH_SIGNING_ALGORITHM %s", conf.AuthSigningAlgorithm)
+}
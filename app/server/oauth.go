@@ -0,0 +1,39 @@
+package app
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/org39/webapp-tutorial-backend/pkg/oidc"
+	"github.com/org39/webapp-tutorial-backend/usecase/user"
+)
+
+var (
+	// provider names are path segments of the login routes
+	oauthProviderName = regexp.MustCompile(`^[a-z0-9-]{1,32}$`)
+)
+
+func newOAuthProviders(conf *Config) (map[string]user.OAuthProvider, error) {
+	providers := map[string]user.OAuthProvider{}
+	for name, issuer := range conf.UserOAuthIssuers {
+		if !oauthProviderName.MatchString(name) {
+			return nil, fmt.Errorf("USER_OAUTH_ISSUERS: invalid provider name %q", name)
+		}
+
+		clientID, ok := conf.UserOAuthClientIDs[name]
+		if !ok {
+			return nil, fmt.Errorf("USER_OAUTH_CLIENT_IDS: no client id for provider %s", name)
+		}
+
+		// public clients have no secret, PKCE protects the code
+		redirectURL := strings.ReplaceAll(conf.UserOAuthCallbackURL, "{provider}", name)
+		p, err := oidc.NewProvider(issuer, clientID, conf.UserOAuthClientSecrets[name], redirectURL)
+		if err != nil {
+			return nil, fmt.Errorf("oauth provider %s: %w", name, err)
+		}
+		providers[name] = p
+	}
+
+	return providers, nil
+}
@@ -13,6 +13,11 @@ func newTodoUsecase() error {
 		return err
 	}
 
+	tr, err := repo.NewTagRepository()
+	if err != nil {
+		return err
+	}
+
 	u, err := todo.NewService()
 	if err != nil {
 		return err
@@ -20,6 +25,7 @@ func newTodoUsecase() error {
 
 	err = DepencencyInjector.Provide(
 		&inject.Object{Value: r},
+		&inject.Object{Value: tr},
 		&inject.Object{Value: u},
 	)
 	if err != nil {
@@ -13,6 +13,32 @@ func newUserUsecase() error {
 		return err
 	}
 
+	t, err := repo.NewUserTokenRepository()
+	if err != nil {
+		return err
+	}
+
+	m, err := repo.NewUserMFARepository()
+	if err != nil {
+		return err
+	}
+
+	// failed logins are counted in memory, per instance
+	a, err := repo.NewLoginAttemptRepository()
+	if err != nil {
+		return err
+	}
+
+	i, err := repo.NewIdentityRepository()
+	if err != nil {
+		return err
+	}
+
+	p, err := repo.NewUserProfileRepository()
+	if err != nil {
+		return err
+	}
+
 	u, err := user.NewService()
 	if err != nil {
 		return err
@@ -20,6 +46,11 @@ func newUserUsecase() error {
 
 	err = DepencencyInjector.Provide(
 		&inject.Object{Value: r},
+		&inject.Object{Value: t},
+		&inject.Object{Value: m},
+		&inject.Object{Value: a},
+		&inject.Object{Value: i},
+		&inject.Object{Value: p},
 		&inject.Object{Value: u},
 	)
 	if err != nil {
@@ -0,0 +1,28 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// Account is what tokens need to know about their user, the roles they carry and whether they may be issued at all.
+type Account struct {
+	UserID     string   `validate:"required,uuid4"`
+	Roles      []string `validate:"dive,oneof=admin"`
+	DisabledAt *time.Time
+}
+
+func (a *Account) Valid() error {
+	err := validator.New().Struct(a)
+	if err != nil {
+		return err.(validator.ValidationErrors)
+	}
+
+	return nil
+}
+
+// Disabled reports whether an admin disabled the account, no token is issued to it.
+func (a *Account) Disabled() bool {
+	return a.DisabledAt != nil
+}
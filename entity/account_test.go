@@ -0,0 +1,44 @@
+package entity
+
+import (
+	"testing"
+	"time"
+
+	"github.com/org39/webapp-tutorial-backend/entity/dto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type EntityAccountTestSuite struct {
+	suite.Suite
+}
+
+func (s *EntityAccountTestSuite) TestFromDTOValid() {
+	userID := "2192fc7b-bd9b-446d-a50e-5ce0ba02cee6"
+
+	account, err := NewFactory().FromAccountDTO(dto.NewFactory().NewAccount(userID, []string{RoleAdmin}, nil))
+	assert.NoError(s.T(), err)
+	assert.NoError(s.T(), account.Valid())
+	assert.False(s.T(), account.Disabled())
+}
+
+func (s *EntityAccountTestSuite) TestDisabled() {
+	userID := "2192fc7b-bd9b-446d-a50e-5ce0ba02cee6"
+	disabledAt := time.Now()
+
+	account, err := NewFactory().FromAccountDTO(dto.NewFactory().NewAccount(userID, nil, &disabledAt))
+	assert.NoError(s.T(), err)
+	assert.True(s.T(), account.Disabled())
+}
+
+func (s *EntityAccountTestSuite) TestUnknownRoleInvalid() {
+	userID := "2192fc7b-bd9b-446d-a50e-5ce0ba02cee6"
+
+	account, err := NewFactory().FromAccountDTO(dto.NewFactory().NewAccount(userID, []string{"superuser"}, nil))
+	assert.NoError(s.T(), err)
+	assert.Error(s.T(), account.Valid())
+}
+
+func TestEntityAccount(t *testing.T) {
+	suite.Run(t, new(EntityAccountTestSuite))
+}
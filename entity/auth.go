@@ -1,6 +1,8 @@
 package entity
 
 import (
+	"time"
+
 	"github.com/go-playground/validator/v10"
 )
 
@@ -17,3 +19,48 @@ func (u *AuthTokenPair) Valid() error {
 
 	return nil
 }
+
+// AuthClaims is what a verified token grants to its bearer.
+type AuthClaims struct {
+	UserID string `validate:"required,uuid4"`
+	// empty for tokens which do not belong to a session, e.g. personal access tokens
+	SessionID string
+	// roles of the user when the token was issued, personal access tokens carry none
+	Roles  []string
+	Scopes []string
+	// nil for tokens which never expire
+	ExpiresAt *time.Time
+}
+
+func (c *AuthClaims) Valid() error {
+	err := validator.New().Struct(c)
+	if err != nil {
+		return err.(validator.ValidationErrors)
+	}
+
+	return nil
+}
+
+// HasRole reports whether the token was issued to a user with the role.
+func (c *AuthClaims) HasRole(role string) bool {
+	return hasRole(c.Roles, role)
+}
+
+// HasScopes reports whether every given scope was granted.
+func (c *AuthClaims) HasScopes(scopes ...string) bool {
+	for _, required := range scopes {
+		granted := false
+		for _, s := range c.Scopes {
+			if s == required {
+				granted = true
+				break
+			}
+		}
+
+		if !granted {
+			return false
+		}
+	}
+
+	return true
+}
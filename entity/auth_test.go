@@ -17,6 +17,32 @@ func (t *EntityAuthTestSuite) TestCreationValid() {
 	assert.NoError(t.T(), err)
 }
 
+func (t *EntityAuthTestSuite) TestClaimsHasScopes() {
+	userID := "2192fc7b-bd9b-446d-a50e-5ce0ba02cee6"
+
+	claims := NewFactory().NewAuthClaims(userID, "", nil, []string{ScopeTodosRead, ScopeUserRead}, nil)
+	assert.NoError(t.T(), claims.Valid())
+	assert.True(t.T(), claims.HasScopes())
+	assert.True(t.T(), claims.HasScopes(ScopeTodosRead))
+	assert.True(t.T(), claims.HasScopes(ScopeTodosRead, ScopeUserRead))
+	assert.False(t.T(), claims.HasScopes(ScopeTodosWrite))
+	assert.False(t.T(), claims.HasScopes(ScopeTodosRead, ScopeTodosWrite))
+
+	// no scope grants nothing
+	none := NewFactory().NewAuthClaims(userID, "", nil, nil, nil)
+	assert.False(t.T(), none.HasScopes(ScopeTodosRead))
+}
+
+func (t *EntityAuthTestSuite) TestClaimsHasRole() {
+	userID := "2192fc7b-bd9b-446d-a50e-5ce0ba02cee6"
+
+	admin := NewFactory().NewAuthClaims(userID, "", []string{RoleAdmin}, AllScopes(), nil)
+	assert.True(t.T(), admin.HasRole(RoleAdmin))
+
+	user := NewFactory().NewAuthClaims(userID, "", nil, AllScopes(), nil)
+	assert.False(t.T(), user.HasRole(RoleAdmin))
+}
+
 func TestEntityAuth(t *testing.T) {
 	suite.Run(t, new(EntityAuthTestSuite))
 }
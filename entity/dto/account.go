@@ -0,0 +1,11 @@
+package dto
+
+import (
+	"time"
+)
+
+type Account struct {
+	UserID     string
+	Roles      []string
+	DisabledAt *time.Time
+}
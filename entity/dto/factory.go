@@ -8,16 +8,27 @@ func NewFactory() *Factory {
 	return &Factory{}
 }
 
-func (f *Factory) NewUser(id string, email string, password string, createdAt time.Time) *User {
+func (f *Factory) NewUser(id string, email string, password string, roles []string, verifiedAt *time.Time, disabledAt *time.Time, createdAt time.Time) *User {
 	return &User{
-		ID:        id,
-		Email:     email,
-		Password:  password,
-		CreatedAt: createdAt,
+		ID:         id,
+		Email:      email,
+		Password:   password,
+		Roles:      roles,
+		VerifiedAt: verifiedAt,
+		DisabledAt: disabledAt,
+		CreatedAt:  createdAt,
+	}
+}
+
+func (f *Factory) NewAccount(userID string, roles []string, disabledAt *time.Time) *Account {
+	return &Account{
+		UserID:     userID,
+		Roles:      roles,
+		DisabledAt: disabledAt,
 	}
 }
 
-func (f *Factory) NewTodo(id string, userID string, content string, completed bool, createdAt time.Time, updatedAt time.Time, deleted bool) *Todo {
+func (f *Factory) NewTodo(id string, userID string, content string, completed bool, createdAt time.Time, updatedAt time.Time, deleted bool, dueAt *time.Time, priority int, position int) *Todo {
 	return &Todo{
 		ID:        id,
 		UserID:    userID,
@@ -26,5 +37,153 @@ func (f *Factory) NewTodo(id string, userID string, content string, completed bo
 		CreatedAt: createdAt,
 		UpdatedAt: updatedAt,
 		Deleted:   deleted,
+		DueAt:     dueAt,
+		Priority:  priority,
+		Position:  position,
+	}
+}
+
+func (f *Factory) NewTodoFilter(completed *bool, deleted *bool, createdAfter *time.Time, createdBefore *time.Time, updatedAfter *time.Time, updatedBefore *time.Time, content string, tagIDs []string, allTags bool) *TodoFilter {
+	return &TodoFilter{
+		Completed:     completed,
+		Deleted:       deleted,
+		CreatedAfter:  createdAfter,
+		CreatedBefore: createdBefore,
+		UpdatedAfter:  updatedAfter,
+		UpdatedBefore: updatedBefore,
+		Content:       content,
+		TagIDs:        tagIDs,
+		AllTags:       allTags,
+	}
+}
+
+func (f *Factory) NewTag(id string, userID string, name string, color string, createdAt time.Time, updatedAt time.Time) *Tag {
+	return &Tag{
+		ID:        id,
+		UserID:    userID,
+		Name:      name,
+		Color:     color,
+		CreatedAt: createdAt,
+		UpdatedAt: updatedAt,
+	}
+}
+
+func (f *Factory) NewTodoSort(column string, descending bool) *TodoSort {
+	return &TodoSort{
+		Column:     column,
+		Descending: descending,
+	}
+}
+
+func (f *Factory) NewTodoCursor(value interface{}, id string) *TodoCursor {
+	return &TodoCursor{
+		Value: value,
+		ID:    id,
+	}
+}
+
+func (f *Factory) NewTodoSearch(terms []string, limit uint64) *TodoSearch {
+	return &TodoSearch{
+		Terms: terms,
+		Limit: limit,
+	}
+}
+
+func (f *Factory) NewTodoSearchHit(todo *Todo, score float64) *TodoSearchHit {
+	return &TodoSearchHit{
+		Todo:  todo,
+		Score: score,
+	}
+}
+
+func (f *Factory) NewRefreshToken(id string, familyID string, userID string, rotated bool, revoked bool, expiresAt time.Time, createdAt time.Time) *RefreshToken {
+	return &RefreshToken{
+		ID:        id,
+		FamilyID:  familyID,
+		UserID:    userID,
+		Rotated:   rotated,
+		Revoked:   revoked,
+		ExpiresAt: expiresAt,
+		CreatedAt: createdAt,
+	}
+}
+
+func (f *Factory) NewUserToken(id string, userID string, purpose string, tokenHash string, used bool, expiresAt time.Time, createdAt time.Time) *UserToken {
+	return &UserToken{
+		ID:        id,
+		UserID:    userID,
+		Purpose:   purpose,
+		TokenHash: tokenHash,
+		Used:      used,
+		ExpiresAt: expiresAt,
+		CreatedAt: createdAt,
+	}
+}
+
+func (f *Factory) NewUserMFA(userID string, secret string, enabled bool, lastUsedStep int64, createdAt time.Time) *UserMFA {
+	return &UserMFA{
+		UserID:       userID,
+		Secret:       secret,
+		Enabled:      enabled,
+		LastUsedStep: lastUsedStep,
+		CreatedAt:    createdAt,
+	}
+}
+
+func (f *Factory) NewUserProfile(userID string, displayName string, timeZone string, locale string, avatarID string, preferences map[string]interface{}, updatedAt time.Time) *UserProfile {
+	return &UserProfile{
+		UserID:      userID,
+		DisplayName: displayName,
+		TimeZone:    timeZone,
+		Locale:      locale,
+		AvatarID:    avatarID,
+		Preferences: preferences,
+		UpdatedAt:   updatedAt,
+	}
+}
+
+func (f *Factory) NewPersonalAccessToken(id string, userID string, name string, scopes []string, tokenHash string, lastUsedAt *time.Time, expiresAt *time.Time, createdAt time.Time) *PersonalAccessToken {
+	return &PersonalAccessToken{
+		ID:         id,
+		UserID:     userID,
+		Name:       name,
+		Scopes:     scopes,
+		TokenHash:  tokenHash,
+		LastUsedAt: lastUsedAt,
+		ExpiresAt:  expiresAt,
+		CreatedAt:  createdAt,
+	}
+}
+
+func (f *Factory) NewIdentity(id string, userID string, provider string, subject string, email string, createdAt time.Time) *Identity {
+	return &Identity{
+		ID:        id,
+		UserID:    userID,
+		Provider:  provider,
+		Subject:   subject,
+		Email:     email,
+		CreatedAt: createdAt,
+	}
+}
+
+func (f *Factory) NewSession(id string, userID string, label string, userAgent string, ip string, revoked bool, lastSeenAt time.Time, expiresAt time.Time, createdAt time.Time) *Session {
+	return &Session{
+		ID:         id,
+		UserID:     userID,
+		Label:      label,
+		UserAgent:  userAgent,
+		IP:         ip,
+		Revoked:    revoked,
+		LastSeenAt: lastSeenAt,
+		ExpiresAt:  expiresAt,
+		CreatedAt:  createdAt,
+	}
+}
+
+func (f *Factory) NewLoginAttempts(key string, failures int, lastFailureAt time.Time) *LoginAttempts {
+	return &LoginAttempts{
+		Key:           key,
+		Failures:      failures,
+		LastFailureAt: lastFailureAt,
 	}
 }
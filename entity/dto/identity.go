@@ -0,0 +1,14 @@
+package dto
+
+import (
+	"time"
+)
+
+type Identity struct {
+	ID        string
+	UserID    string
+	Provider  string
+	Subject   string
+	Email     string
+	CreatedAt time.Time
+}
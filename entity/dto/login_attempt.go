@@ -0,0 +1,11 @@
+package dto
+
+import (
+	"time"
+)
+
+type LoginAttempts struct {
+	Key           string
+	Failures      int
+	LastFailureAt time.Time
+}
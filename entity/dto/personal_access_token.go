@@ -0,0 +1,16 @@
+package dto
+
+import (
+	"time"
+)
+
+type PersonalAccessToken struct {
+	ID         string
+	UserID     string
+	Name       string
+	Scopes     []string
+	TokenHash  string
+	LastUsedAt *time.Time
+	ExpiresAt  *time.Time
+	CreatedAt  time.Time
+}
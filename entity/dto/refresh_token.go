@@ -0,0 +1,15 @@
+package dto
+
+import (
+	"time"
+)
+
+type RefreshToken struct {
+	ID        string
+	FamilyID  string
+	UserID    string
+	Rotated   bool
+	Revoked   bool
+	ExpiresAt time.Time
+	CreatedAt time.Time
+}
@@ -0,0 +1,17 @@
+package dto
+
+import (
+	"time"
+)
+
+type Session struct {
+	ID         string
+	UserID     string
+	Label      string
+	UserAgent  string
+	IP         string
+	Revoked    bool
+	LastSeenAt time.Time
+	ExpiresAt  time.Time
+	CreatedAt  time.Time
+}
@@ -0,0 +1,14 @@
+package dto
+
+import (
+	"time"
+)
+
+type Tag struct {
+	ID        string
+	UserID    string
+	Name      string
+	Color     string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
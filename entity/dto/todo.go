@@ -12,4 +12,46 @@ type Todo struct {
 	CreatedAt time.Time
 	UpdatedAt time.Time
 	Deleted   bool
+	// nil when the todo has no due date
+	DueAt    *time.Time
+	Priority int
+	Position int
+}
+
+// TodoFilter selects todos, nil fields and an empty content do not filter.
+type TodoFilter struct {
+	Completed     *bool
+	Deleted       *bool
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	UpdatedAfter  *time.Time
+	UpdatedBefore *time.Time
+	Content       string
+	// ids of tags, AllTags selects todos having every tag rather than any
+	TagIDs  []string
+	AllTags bool
+}
+
+// TodoSort is the order of a listing, Column is one of the sortable columns of the repository.
+type TodoSort struct {
+	Column     string
+	Descending bool
+}
+
+// TodoCursor is the position of the last todo of a page, Value is its sort column, nil for NULL.
+type TodoCursor struct {
+	Value interface{}
+	ID    string
+}
+
+// TodoSearch finds todos by words, Terms are the normalized words of the query.
+type TodoSearch struct {
+	Terms []string
+	Limit uint64
+}
+
+// TodoSearchHit is a todo found by a search, a higher score is more relevant.
+type TodoSearchHit struct {
+	Todo  *Todo
+	Score float64
 }
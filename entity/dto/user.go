@@ -5,8 +5,11 @@ import (
 )
 
 type User struct {
-	ID        string
-	Email     string
-	Password  string
-	CreatedAt time.Time
+	ID         string
+	Email      string
+	Password   string
+	Roles      []string
+	VerifiedAt *time.Time
+	DisabledAt *time.Time
+	CreatedAt  time.Time
 }
@@ -0,0 +1,13 @@
+package dto
+
+import (
+	"time"
+)
+
+type UserMFA struct {
+	UserID       string
+	Secret       string
+	Enabled      bool
+	LastUsedStep int64
+	CreatedAt    time.Time
+}
@@ -0,0 +1,15 @@
+package dto
+
+import (
+	"time"
+)
+
+type UserProfile struct {
+	UserID      string
+	DisplayName string
+	TimeZone    string
+	Locale      string
+	AvatarID    string
+	Preferences map[string]interface{}
+	UpdatedAt   time.Time
+}
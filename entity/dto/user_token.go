@@ -0,0 +1,15 @@
+package dto
+
+import (
+	"time"
+)
+
+type UserToken struct {
+	ID        string
+	UserID    string
+	Purpose   string
+	TokenHash string
+	Used      bool
+	ExpiresAt time.Time
+	CreatedAt time.Time
+}
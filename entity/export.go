@@ -0,0 +1,14 @@
+package entity
+
+import (
+	"time"
+)
+
+// UserExport is every data kept about a user, handed over on request of the user.
+type UserExport struct {
+	User       *User
+	Profile    *UserProfile
+	Todos      []*Todo
+	Tags       []*Tag
+	ExportedAt time.Time
+}
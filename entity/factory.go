@@ -1,11 +1,16 @@
 package entity
 
 import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
 	"time"
 
 	"github.com/org39/webapp-tutorial-backend/entity/dto"
 
 	"github.com/org39/webapp-tutorial-backend/pkg/crypt"
+	"github.com/org39/webapp-tutorial-backend/pkg/search"
+	"github.com/org39/webapp-tutorial-backend/pkg/totp"
 	"github.com/org39/webapp-tutorial-backend/pkg/uuid"
 )
 
@@ -15,35 +20,67 @@ func NewFactory() *Factory {
 	return &Factory{}
 }
 
-func (f *Factory) NewUser(email string, plainPassword string) (*User, error) {
+func (f *Factory) NewUser(email string, plainPassword string, hasher *crypt.PasswordHasher) (*User, error) {
 	uuid, err := uuid.New()
 	if err != nil {
 		return nil, err
 	}
 
-	hashedPassword, err := crypt.Hash([]byte(plainPassword))
+	hashedPassword, err := hasher.Hash([]byte(plainPassword))
 	if err != nil {
 		return nil, err
 	}
 
 	return &User{
-		ID:        uuid,
-		Email:     email,
-		Password:  hashedPassword,
-		CreatedAt: time.Now(),
+		ID:         uuid,
+		Email:      email,
+		Password:   hashedPassword,
+		Roles:      []string{},
+		VerifiedAt: nil,
+		DisabledAt: nil,
+		CreatedAt:  time.Now(),
+	}, nil
+}
+
+// NewPasswordlessUser returns a user who logs in with magic links until setting a password.
+func (f *Factory) NewPasswordlessUser(email string) (*User, error) {
+	uuid, err := uuid.New()
+	if err != nil {
+		return nil, err
+	}
+
+	return &User{
+		ID:         uuid,
+		Email:      email,
+		Password:   "",
+		Roles:      []string{},
+		VerifiedAt: nil,
+		DisabledAt: nil,
+		CreatedAt:  time.Now(),
 	}, nil
 }
 
 func (f *Factory) FromUserDTO(u *dto.User) (*User, error) {
 	return &User{
-		ID:        u.ID,
-		Email:     u.Email,
-		Password:  u.Password,
-		CreatedAt: u.CreatedAt,
+		ID:         u.ID,
+		Email:      u.Email,
+		Password:   u.Password,
+		Roles:      u.Roles,
+		VerifiedAt: u.VerifiedAt,
+		DisabledAt: u.DisabledAt,
+		CreatedAt:  u.CreatedAt,
+	}, nil
+}
+
+func (f *Factory) FromAccountDTO(d *dto.Account) (*Account, error) {
+	return &Account{
+		UserID:     d.UserID,
+		Roles:      d.Roles,
+		DisabledAt: d.DisabledAt,
 	}, nil
 }
 
-func (f *Factory) NewTodo(user *User, content string) (*Todo, error) {
+func (f *Factory) NewTodo(user *User, content string, dueAt *time.Time, priority int, position int) (*Todo, error) {
 	uuid, err := uuid.New()
 	if err != nil {
 		return nil, err
@@ -58,6 +95,45 @@ func (f *Factory) NewTodo(user *User, content string) (*Todo, error) {
 		CreatedAt: now,
 		UpdatedAt: now,
 		Deleted:   false,
+		DueAt:     dueAt,
+		Priority:  priority,
+		Position:  position,
+		Tags:      []*Tag{},
+	}, nil
+}
+
+func (f *Factory) NewTag(user *User, name string, color string) (*Tag, error) {
+	uuid, err := uuid.New()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+
+	return &Tag{
+		ID:        uuid,
+		UserID:    user.ID,
+		Name:      normalizeTagName(name),
+		Color:     normalizeTagColor(color),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}, nil
+}
+
+func (f *Factory) NewTagUpdate(name *string, color *string) *TagUpdate {
+	return &TagUpdate{
+		Name:  name,
+		Color: color,
+	}
+}
+
+func (f *Factory) FromTagDTO(d *dto.Tag) (*Tag, error) {
+	return &Tag{
+		ID:        d.ID,
+		UserID:    d.UserID,
+		Name:      d.Name,
+		Color:     d.Color,
+		CreatedAt: d.CreatedAt,
+		UpdatedAt: d.UpdatedAt,
 	}, nil
 }
 
@@ -70,12 +146,424 @@ func (f *Factory) FromTodoDTO(d *dto.Todo) (*Todo, error) {
 		CreatedAt: d.CreatedAt,
 		UpdatedAt: d.UpdatedAt,
 		Deleted:   d.Deleted,
+		DueAt:     d.DueAt,
+		Priority:  d.Priority,
+		Position:  d.Position,
 	}, nil
 }
 
+func (f *Factory) NewTodoFilter(status string, deleted string, createdAfter *time.Time, createdBefore *time.Time, updatedAfter *time.Time, updatedBefore *time.Time, content string, tags []string, tagMatch string) *TodoFilter {
+	return &TodoFilter{
+		Status:        status,
+		Deleted:       deleted,
+		CreatedAfter:  createdAfter,
+		CreatedBefore: createdBefore,
+		UpdatedAfter:  updatedAfter,
+		UpdatedBefore: updatedBefore,
+		Content:       content,
+		Tags:          tags,
+		TagMatch:      tagMatch,
+	}
+}
+
+func (f *Factory) NewTodoSort(key string, order string) *TodoSort {
+	return &TodoSort{
+		Key:   key,
+		Order: order,
+	}
+}
+
+func (f *Factory) NewTodoCursor(sort *TodoSort, value interface{}, id string) *TodoCursor {
+	return &TodoCursor{
+		Sort:  *sort,
+		Value: value,
+		ID:    id,
+	}
+}
+
+// NewTodoCursorFromString decodes a cursor given to a client by TodoCursor.Encode.
+func (f *Factory) NewTodoCursorFromString(s string) (*TodoCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", err, ErrInvalidTodoCursor)
+	}
+
+	var c todoCursorJSON
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, fmt.Errorf("%s: %w", err, ErrInvalidTodoCursor)
+	}
+
+	value, err := decodeTodoSortValue(c.Key, c.Value)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", err, ErrInvalidTodoCursor)
+	}
+
+	cursor := f.NewTodoCursor(f.NewTodoSort(c.Key, c.Order), value, c.ID)
+	if err := cursor.Valid(); err != nil {
+		return nil, fmt.Errorf("%s: %w", err, ErrInvalidTodoCursor)
+	}
+
+	return cursor, nil
+}
+
+func (f *Factory) NewTodoPage(todos []*Todo, next *TodoCursor) *TodoPage {
+	return &TodoPage{
+		Todos: todos,
+		Next:  next,
+	}
+}
+
+func (f *Factory) NewTodoSearch(query string, limit uint64) *TodoSearch {
+	return &TodoSearch{
+		Query: query,
+		Limit: limit,
+	}
+}
+
+// NewTodoSearchResult cuts the snippet of the todo around the terms.
+func (f *Factory) NewTodoSearchResult(todo *Todo, score float64, terms []string) *TodoSearchResult {
+	return &TodoSearchResult{
+		Todo:    todo,
+		Score:   score,
+		Snippet: search.Snippet(todo.Content, terms, TodoSnippetLength),
+	}
+}
+
 func (f *Factory) NewAuthTokenPair(token string, refreshToken string) *AuthTokenPair {
 	return &AuthTokenPair{
 		AccessToken:  token,
 		RefreshToken: refreshToken,
 	}
 }
+
+func (f *Factory) NewAuthClaims(userID string, sessionID string, roles []string, scopes []string, expiresAt *time.Time) *AuthClaims {
+	return &AuthClaims{
+		UserID:    userID,
+		SessionID: sessionID,
+		Roles:     roles,
+		Scopes:    scopes,
+		ExpiresAt: expiresAt,
+	}
+}
+
+func (f *Factory) NewIntrospectionClient(id string, secretHash string) *IntrospectionClient {
+	return &IntrospectionClient{
+		ID:         id,
+		SecretHash: secretHash,
+	}
+}
+
+func (f *Factory) NewTokenIntrospection(claims *AuthClaims) *TokenIntrospection {
+	return &TokenIntrospection{
+		Active: true,
+		Claims: claims,
+	}
+}
+
+// NewInactiveTokenIntrospection tells nothing about the token, not even why it is inactive.
+func (f *Factory) NewInactiveTokenIntrospection() *TokenIntrospection {
+	return &TokenIntrospection{
+		Active: false,
+	}
+}
+
+func (f *Factory) NewRefreshToken(userID string, familyID string, duration time.Duration) (*RefreshToken, error) {
+	uuid, err := uuid.New()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+
+	return &RefreshToken{
+		ID:        uuid,
+		FamilyID:  familyID,
+		UserID:    userID,
+		Rotated:   false,
+		Revoked:   false,
+		ExpiresAt: now.Add(duration),
+		CreatedAt: now,
+	}, nil
+}
+
+// NewSession records the login which started the refresh token family.
+func (f *Factory) NewSession(userID string, familyID string, label string, userAgent string, ip string, expiresAt time.Time) (*Session, error) {
+	now := time.Now()
+
+	return &Session{
+		ID:         familyID,
+		UserID:     userID,
+		Label:      label,
+		UserAgent:  truncateUserAgent(userAgent),
+		IP:         ip,
+		Revoked:    false,
+		LastSeenAt: now,
+		ExpiresAt:  expiresAt,
+		CreatedAt:  now,
+	}, nil
+}
+
+func (f *Factory) FromSessionDTO(d *dto.Session) (*Session, error) {
+	return &Session{
+		ID:         d.ID,
+		UserID:     d.UserID,
+		Label:      d.Label,
+		UserAgent:  d.UserAgent,
+		IP:         d.IP,
+		Revoked:    d.Revoked,
+		LastSeenAt: d.LastSeenAt,
+		ExpiresAt:  d.ExpiresAt,
+		CreatedAt:  d.CreatedAt,
+	}, nil
+}
+
+func (f *Factory) FromRefreshTokenDTO(d *dto.RefreshToken) (*RefreshToken, error) {
+	return &RefreshToken{
+		ID:        d.ID,
+		FamilyID:  d.FamilyID,
+		UserID:    d.UserID,
+		Rotated:   d.Rotated,
+		Revoked:   d.Revoked,
+		ExpiresAt: d.ExpiresAt,
+		CreatedAt: d.CreatedAt,
+	}, nil
+}
+
+func (f *Factory) NewUserToken(userID string, purpose string, token string, duration time.Duration) (*UserToken, error) {
+	uuid, err := uuid.New()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+
+	return &UserToken{
+		ID:        uuid,
+		UserID:    userID,
+		Purpose:   purpose,
+		TokenHash: crypt.HashToken(token),
+		Used:      false,
+		ExpiresAt: now.Add(duration),
+		CreatedAt: now,
+	}, nil
+}
+
+func (f *Factory) FromUserTokenDTO(d *dto.UserToken) (*UserToken, error) {
+	return &UserToken{
+		ID:        d.ID,
+		UserID:    d.UserID,
+		Purpose:   d.Purpose,
+		TokenHash: d.TokenHash,
+		Used:      d.Used,
+		ExpiresAt: d.ExpiresAt,
+		CreatedAt: d.CreatedAt,
+	}, nil
+}
+
+func (f *Factory) NewUserMFA(userID string) (*UserMFA, error) {
+	secret, err := totp.NewSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	return &UserMFA{
+		UserID:       userID,
+		Secret:       secret,
+		Enabled:      false,
+		LastUsedStep: 0,
+		CreatedAt:    time.Now(),
+	}, nil
+}
+
+func (f *Factory) FromUserMFADTO(d *dto.UserMFA) (*UserMFA, error) {
+	return &UserMFA{
+		UserID:       d.UserID,
+		Secret:       d.Secret,
+		Enabled:      d.Enabled,
+		LastUsedStep: d.LastUsedStep,
+		CreatedAt:    d.CreatedAt,
+	}, nil
+}
+
+// NewUserProfile returns the profile of a user who did not set one.
+func (f *Factory) NewUserProfile(userID string) *UserProfile {
+	return &UserProfile{
+		UserID:      userID,
+		Preferences: map[string]interface{}{},
+		UpdatedAt:   time.Now(),
+	}
+}
+
+func (f *Factory) FromUserProfileDTO(d *dto.UserProfile) (*UserProfile, error) {
+	preferences := d.Preferences
+	if preferences == nil {
+		preferences = map[string]interface{}{}
+	}
+
+	return &UserProfile{
+		UserID:      d.UserID,
+		DisplayName: d.DisplayName,
+		TimeZone:    d.TimeZone,
+		Locale:      d.Locale,
+		AvatarID:    d.AvatarID,
+		Preferences: preferences,
+		UpdatedAt:   d.UpdatedAt,
+	}, nil
+}
+
+func (f *Factory) NewUserProfileUpdate(displayName *string, timeZone *string, locale *string, preferences map[string]interface{}) *UserProfileUpdate {
+	return &UserProfileUpdate{
+		DisplayName: displayName,
+		TimeZone:    timeZone,
+		Locale:      locale,
+		Preferences: preferences,
+	}
+}
+
+func (f *Factory) NewMFAEnrollment(secret string, uri string) *MFAEnrollment {
+	return &MFAEnrollment{
+		Secret: secret,
+		URI:    uri,
+	}
+}
+
+func (f *Factory) NewMFAChallenge(token string) *MFAChallenge {
+	return &MFAChallenge{
+		Token: token,
+	}
+}
+
+func (f *Factory) NewUserExport(user *User, profile *UserProfile, todos []*Todo, tags []*Tag, exportedAt time.Time) *UserExport {
+	return &UserExport{
+		User:       user,
+		Profile:    profile,
+		Todos:      todos,
+		Tags:       tags,
+		ExportedAt: exportedAt,
+	}
+}
+
+// NewPersonalAccessToken creates a token record, a zero duration means the token never expires.
+func (f *Factory) NewPersonalAccessToken(userID string, name string, scopes []string, token string, duration time.Duration) (*PersonalAccessToken, error) {
+	uuid, err := uuid.New()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+
+	var expiresAt *time.Time
+	if duration > 0 {
+		t := now.Add(duration)
+		expiresAt = &t
+	}
+
+	return &PersonalAccessToken{
+		ID:         uuid,
+		UserID:     userID,
+		Name:       name,
+		Scopes:     scopes,
+		TokenHash:  crypt.HashToken(token),
+		LastUsedAt: nil,
+		ExpiresAt:  expiresAt,
+		CreatedAt:  now,
+	}, nil
+}
+
+func (f *Factory) FromPersonalAccessTokenDTO(d *dto.PersonalAccessToken) (*PersonalAccessToken, error) {
+	return &PersonalAccessToken{
+		ID:         d.ID,
+		UserID:     d.UserID,
+		Name:       d.Name,
+		Scopes:     d.Scopes,
+		TokenHash:  d.TokenHash,
+		LastUsedAt: d.LastUsedAt,
+		ExpiresAt:  d.ExpiresAt,
+		CreatedAt:  d.CreatedAt,
+	}, nil
+}
+
+func (f *Factory) NewIssuedPersonalAccessToken(t *PersonalAccessToken, token string) *IssuedPersonalAccessToken {
+	return &IssuedPersonalAccessToken{
+		PersonalAccessToken: t,
+		Token:               token,
+	}
+}
+
+func (f *Factory) NewIdentity(userID string, provider string, subject string, email string) (*Identity, error) {
+	uuid, err := uuid.New()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Identity{
+		ID:        uuid,
+		UserID:    userID,
+		Provider:  provider,
+		Subject:   subject,
+		Email:     email,
+		CreatedAt: time.Now(),
+	}, nil
+}
+
+func (f *Factory) FromIdentityDTO(d *dto.Identity) (*Identity, error) {
+	return &Identity{
+		ID:        d.ID,
+		UserID:    d.UserID,
+		Provider:  d.Provider,
+		Subject:   d.Subject,
+		Email:     d.Email,
+		CreatedAt: d.CreatedAt,
+	}, nil
+}
+
+// NewOAuthFlow starts a login with the provider, with a random state, nonce and PKCE code verifier.
+func (f *Factory) NewOAuthFlow(provider string) (*OAuthFlow, error) {
+	secrets := make([]string, 3)
+	for i := range secrets {
+		s, err := crypt.NewToken()
+		if err != nil {
+			return nil, err
+		}
+		secrets[i] = s
+	}
+
+	return &OAuthFlow{
+		Provider:     provider,
+		State:        secrets[0],
+		Nonce:        secrets[1],
+		CodeVerifier: secrets[2],
+	}, nil
+}
+
+// ResumeOAuthFlow rebuilds a flow kept by the user agent.
+func (f *Factory) ResumeOAuthFlow(provider string, state string, nonce string, codeVerifier string) *OAuthFlow {
+	return &OAuthFlow{
+		Provider:     provider,
+		State:        state,
+		Nonce:        nonce,
+		CodeVerifier: codeVerifier,
+	}
+}
+
+func (f *Factory) FromLoginAttemptsDTO(d *dto.LoginAttempts) (*LoginAttempts, error) {
+	return &LoginAttempts{
+		Key:           d.Key,
+		Failures:      d.Failures,
+		LastFailureAt: d.LastFailureAt,
+	}, nil
+}
+
+func (f *Factory) NewPasswordPolicy(minLength int, minScore int) *PasswordPolicy {
+	return &PasswordPolicy{
+		MinLength: minLength,
+		MinScore:  minScore,
+	}
+}
+
+func (f *Factory) NewLoginThrottle(freeAttempts int, delay time.Duration, maxDelay time.Duration, lockoutAttempts int, lockoutDuration time.Duration) *LoginThrottle {
+	return &LoginThrottle{
+		FreeAttempts:    freeAttempts,
+		Delay:           delay,
+		MaxDelay:        maxDelay,
+		LockoutAttempts: lockoutAttempts,
+		LockoutDuration: lockoutDuration,
+	}
+}
@@ -25,7 +25,7 @@ func (s *EntityFactoryTestSuite) TestCreateValidUser() {
 	}
 
 	for _, c := range cases {
-		good, err := s.Factory.NewUser(c.email, c.password)
+		good, err := s.Factory.NewUser(c.email, c.password, newTestPasswordHasher(s.T()))
 		assert.NoError(s.T(), err)
 
 		v := good.Valid()
@@ -34,7 +34,7 @@ func (s *EntityFactoryTestSuite) TestCreateValidUser() {
 }
 
 func (s *EntityFactoryTestSuite) TestCreateValidTodo() {
-	u, err := NewFactory().NewUser("hatsune@miku", "PASSWORD")
+	u, err := NewFactory().NewUser("hatsune@miku", "PASSWORD", newTestPasswordHasher(s.T()))
 	assert.NoError(s.T(), err)
 
 	cases := []struct {
@@ -45,7 +45,7 @@ func (s *EntityFactoryTestSuite) TestCreateValidTodo() {
 	}
 
 	for _, c := range cases {
-		good, err := s.Factory.NewTodo(c.user, c.content)
+		good, err := s.Factory.NewTodo(c.user, c.content, nil, 0, 0)
 		assert.NoError(s.T(), err)
 
 		v := good.Valid()
@@ -0,0 +1,51 @@
+package entity
+
+import (
+	"crypto/subtle"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// Identity links a user to an account of an external OpenID Connect provider.
+type Identity struct {
+	ID       string `validate:"required,uuid4"`
+	UserID   string `validate:"required,uuid4"`
+	Provider string `validate:"required,max=32"`
+	// stable identifier of the account at the provider
+	Subject   string    `validate:"required,max=255"`
+	Email     string    `validate:"omitempty,email"`
+	CreatedAt time.Time `validate:"required"`
+}
+
+func (i *Identity) Valid() error {
+	err := validator.New().Struct(i)
+	if err != nil {
+		return err.(validator.ValidationErrors)
+	}
+
+	return nil
+}
+
+// OAuthFlow is a login with an external provider in progress,
+// it is kept by the user agent between the redirect to the provider and the callback.
+type OAuthFlow struct {
+	Provider     string `validate:"required"`
+	State        string `validate:"required"`
+	Nonce        string `validate:"required"`
+	CodeVerifier string `validate:"required"`
+}
+
+func (f *OAuthFlow) Valid() error {
+	err := validator.New().Struct(f)
+	if err != nil {
+		return err.(validator.ValidationErrors)
+	}
+
+	return nil
+}
+
+// Matches reports whether the callback belongs to this flow.
+func (f *OAuthFlow) Matches(provider string, state string) bool {
+	return f.Provider == provider && subtle.ConstantTimeCompare([]byte(f.State), []byte(state)) == 1
+}
@@ -0,0 +1,69 @@
+package entity
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type EntityIdentityTestSuite struct {
+	suite.Suite
+}
+
+func (s *EntityIdentityTestSuite) TestCreationValid() {
+	userID := "2192fc7b-bd9b-446d-a50e-5ce0ba02cee6"
+
+	i, err := NewFactory().NewIdentity(userID, "google", "110169484474386276334", "hatsune@miku.com")
+	assert.NoError(s.T(), err)
+	assert.NoError(s.T(), i.Valid())
+
+	// assert, providers may not share an email address
+	i, err = NewFactory().NewIdentity(userID, "google", "110169484474386276334", "")
+	assert.NoError(s.T(), err)
+	assert.NoError(s.T(), i.Valid())
+}
+
+func (s *EntityIdentityTestSuite) TestCreationInvalid() {
+	userID := "2192fc7b-bd9b-446d-a50e-5ce0ba02cee6"
+
+	cases := []struct {
+		provider string
+		subject  string
+		email    string
+	}{
+		{"", "110169484474386276334", "hatsune@miku.com"},
+		{"google", "", "hatsune@miku.com"},
+		{"google", "110169484474386276334", "invalid"},
+	}
+
+	for _, c := range cases {
+		i, err := NewFactory().NewIdentity(userID, c.provider, c.subject, c.email)
+		assert.NoError(s.T(), err)
+		assert.Error(s.T(), i.Valid())
+	}
+}
+
+func (s *EntityIdentityTestSuite) TestOAuthFlow() {
+	f, err := NewFactory().NewOAuthFlow("google")
+	assert.NoError(s.T(), err)
+	assert.NoError(s.T(), f.Valid())
+
+	// assert, every secret is random
+	other, err := NewFactory().NewOAuthFlow("google")
+	assert.NoError(s.T(), err)
+	assert.NotEqual(s.T(), f.State, other.State)
+	assert.NotEqual(s.T(), f.State, f.Nonce)
+	assert.NotEqual(s.T(), f.Nonce, f.CodeVerifier)
+
+	// assert, the callback must carry the state of the flow
+	resumed := NewFactory().ResumeOAuthFlow(f.Provider, f.State, f.Nonce, f.CodeVerifier)
+	assert.True(s.T(), resumed.Matches("google", f.State))
+	assert.False(s.T(), resumed.Matches("google", other.State))
+	assert.False(s.T(), resumed.Matches("github", f.State))
+	assert.False(s.T(), resumed.Matches("google", ""))
+}
+
+func TestEntityIdentity(t *testing.T) {
+	suite.Run(t, new(EntityIdentityTestSuite))
+}
@@ -0,0 +1,37 @@
+package entity
+
+import (
+	"crypto/subtle"
+
+	"github.com/org39/webapp-tutorial-backend/pkg/crypt"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// IntrospectionClient is a service allowed to introspect tokens, only the hash of its secret is kept.
+type IntrospectionClient struct {
+	ID string `validate:"required,max=64,printascii,excludes=:"`
+	// hex encoded SHA-256 digest of the secret, like personal access tokens
+	SecretHash string `validate:"required,len=64,hexadecimal"`
+}
+
+func (c *IntrospectionClient) Valid() error {
+	err := validator.New().Struct(c)
+	if err != nil {
+		return err.(validator.ValidationErrors)
+	}
+
+	return nil
+}
+
+// Authenticate reports whether the secret is the one of the client.
+func (c *IntrospectionClient) Authenticate(secret string) bool {
+	return subtle.ConstantTimeCompare([]byte(crypt.HashToken(secret)), []byte(c.SecretHash)) == 1
+}
+
+// TokenIntrospection tells a client whether a token is active, and what it grants when it is.
+type TokenIntrospection struct {
+	Active bool
+	// nil when the token is inactive
+	Claims *AuthClaims
+}
@@ -0,0 +1,55 @@
+package entity
+
+import (
+	"testing"
+
+	"github.com/org39/webapp-tutorial-backend/pkg/crypt"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type EntityIntrospectionTestSuite struct {
+	suite.Suite
+}
+
+func (s *EntityIntrospectionTestSuite) TestClientValid() {
+	c := NewFactory().NewIntrospectionClient("todo-service", crypt.HashToken("client-secret"))
+	assert.NoError(s.T(), c.Valid())
+}
+
+func (s *EntityIntrospectionTestSuite) TestClientInvalid() {
+	cases := []struct {
+		id         string
+		secretHash string
+	}{
+		{"", crypt.HashToken("client-secret")},
+		{"todo:service", crypt.HashToken("client-secret")},
+		// the secret itself instead of its digest
+		{"todo-service", "client-secret"},
+	}
+
+	for _, c := range cases {
+		client := NewFactory().NewIntrospectionClient(c.id, c.secretHash)
+		assert.Error(s.T(), client.Valid())
+	}
+}
+
+func (s *EntityIntrospectionTestSuite) TestClientAuthenticate() {
+	c := NewFactory().NewIntrospectionClient("todo-service", crypt.HashToken("client-secret"))
+
+	assert.True(s.T(), c.Authenticate("client-secret"))
+	assert.False(s.T(), c.Authenticate("wrong-secret"))
+	assert.False(s.T(), c.Authenticate(""))
+	assert.False(s.T(), c.Authenticate(c.SecretHash))
+}
+
+func (s *EntityIntrospectionTestSuite) TestInactiveIntrospection() {
+	i := NewFactory().NewInactiveTokenIntrospection()
+	assert.False(s.T(), i.Active)
+	assert.Nil(s.T(), i.Claims)
+}
+
+func TestEntityIntrospection(t *testing.T) {
+	suite.Run(t, new(EntityIntrospectionTestSuite))
+}
@@ -0,0 +1,83 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// LoginAttempts counts the failed logins of a key, e.g. an account or a client address.
+type LoginAttempts struct {
+	Key           string `validate:"required"`
+	Failures      int    `validate:"gte=0"`
+	LastFailureAt time.Time
+}
+
+func (a *LoginAttempts) Valid() error {
+	err := validator.New().Struct(a)
+	if err != nil {
+		return err.(validator.ValidationErrors)
+	}
+
+	return nil
+}
+
+// LoginThrottle decides how long a client must wait after failed logins.
+// Failures beyond FreeAttempts are delayed, starting with Delay and doubling up to MaxDelay.
+// Reaching LockoutAttempts locks the key for LockoutDuration, zero disables the lockout.
+// Failures are forgotten LockoutDuration after the last one.
+type LoginThrottle struct {
+	FreeAttempts    int           `validate:"gte=0"`
+	Delay           time.Duration `validate:"gte=0"`
+	MaxDelay        time.Duration `validate:"gtefield=Delay"`
+	LockoutAttempts int           `validate:"gte=0"`
+	LockoutDuration time.Duration `validate:"gtefield=MaxDelay"`
+}
+
+func (t *LoginThrottle) Valid() error {
+	err := validator.New().Struct(t)
+	if err != nil {
+		return err.(validator.ValidationErrors)
+	}
+
+	return nil
+}
+
+// RetryAfter returns how long the key must wait before the next attempt, zero when it may try now.
+func (t *LoginThrottle) RetryAfter(a *LoginAttempts, now time.Time) time.Duration {
+	if a == nil || !now.Before(a.LastFailureAt.Add(t.LockoutDuration)) {
+		return 0
+	}
+
+	var wait time.Duration
+	switch {
+	case t.LockoutAttempts > 0 && a.Failures >= t.LockoutAttempts:
+		wait = t.LockoutDuration
+	case a.Failures > t.FreeAttempts:
+		wait = t.delay(a.Failures - t.FreeAttempts)
+	}
+
+	remaining := a.LastFailureAt.Add(wait).Sub(now)
+	if remaining < 0 {
+		return 0
+	}
+
+	return remaining
+}
+
+// delay doubles for each delayed failure, n starts at 1
+func (t *LoginThrottle) delay(n int) time.Duration {
+	d := t.Delay
+	for i := 1; i < n; i++ {
+		d *= 2
+		if d >= t.MaxDelay {
+			return t.MaxDelay
+		}
+	}
+
+	if d > t.MaxDelay {
+		return t.MaxDelay
+	}
+
+	return d
+}
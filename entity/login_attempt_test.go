@@ -0,0 +1,83 @@
+package entity
+
+import (
+	"testing"
+	"time"
+
+	"github.com/org39/webapp-tutorial-backend/entity/dto"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type EntityLoginAttemptTestSuite struct {
+	suite.Suite
+}
+
+func (s *EntityLoginAttemptTestSuite) newThrottle() *LoginThrottle {
+	return NewFactory().NewLoginThrottle(3, time.Second, 8*time.Second, 10, 15*time.Minute)
+}
+
+func (s *EntityLoginAttemptTestSuite) attempts(failures int, lastFailureAt time.Time) *LoginAttempts {
+	a, err := NewFactory().FromLoginAttemptsDTO(dto.NewFactory().NewLoginAttempts("account:hatsune@miku.com", failures, lastFailureAt))
+	assert.NoError(s.T(), err)
+	assert.NoError(s.T(), a.Valid())
+	return a
+}
+
+func (s *EntityLoginAttemptTestSuite) TestThrottleValid() {
+	assert.NoError(s.T(), s.newThrottle().Valid())
+
+	// lockout must outlast the delays
+	invalid := NewFactory().NewLoginThrottle(3, time.Second, time.Hour, 10, time.Minute)
+	assert.Error(s.T(), invalid.Valid())
+}
+
+func (s *EntityLoginAttemptTestSuite) TestRetryAfterProgressiveDelay() {
+	t := s.newThrottle()
+	now := time.Now()
+
+	cases := []struct {
+		failures int
+		wait     time.Duration
+	}{
+		{0, 0},
+		{3, 0},
+		{4, time.Second},
+		{5, 2 * time.Second},
+		{6, 4 * time.Second},
+		{7, 8 * time.Second},
+		{9, 8 * time.Second},
+		{10, 15 * time.Minute},
+	}
+	for _, c := range cases {
+		assert.Equal(s.T(), c.wait, t.RetryAfter(s.attempts(c.failures, now), now), "failures: %d", c.failures)
+	}
+
+	// no failure at all
+	assert.Zero(s.T(), t.RetryAfter(nil, now))
+}
+
+func (s *EntityLoginAttemptTestSuite) TestRetryAfterElapses() {
+	t := s.newThrottle()
+	now := time.Now()
+
+	// delay already waited
+	assert.Zero(s.T(), t.RetryAfter(s.attempts(4, now.Add(-2*time.Second)), now))
+	assert.Equal(s.T(), 2*time.Second, t.RetryAfter(s.attempts(6, now.Add(-2*time.Second)), now))
+
+	// lockout ends, failures are forgotten
+	assert.Equal(s.T(), time.Minute, t.RetryAfter(s.attempts(10, now.Add(-14*time.Minute)), now))
+	assert.Zero(s.T(), t.RetryAfter(s.attempts(10, now.Add(-15*time.Minute)), now))
+}
+
+func (s *EntityLoginAttemptTestSuite) TestRetryAfterWithoutLockout() {
+	t := NewFactory().NewLoginThrottle(3, time.Second, 8*time.Second, 0, 15*time.Minute)
+	now := time.Now()
+
+	assert.Equal(s.T(), 8*time.Second, t.RetryAfter(s.attempts(100, now), now))
+}
+
+func TestEntityLoginAttempt(t *testing.T) {
+	suite.Run(t, new(EntityLoginAttemptTestSuite))
+}
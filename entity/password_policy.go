@@ -0,0 +1,102 @@
+package entity
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/org39/webapp-tutorial-backend/pkg/strength"
+
+	"github.com/go-playground/validator/v10"
+)
+
+const (
+	// MinPasswordLength is the floor of every policy, shorter passwords are never valid
+	MinPasswordLength = 5
+	// longer passwords cost more to hash and to score than they add
+	MaxPasswordLength = 256
+
+	// reasons a password is rejected, clients show them to users
+	PasswordReasonTooShort      = "too_short"
+	PasswordReasonTooLong       = "too_long"
+	PasswordReasonTooWeak       = "too_weak"
+	PasswordReasonContainsEmail = "contains_email"
+	PasswordReasonBreached      = "breached"
+
+	// parts of the email address shorter than this are not worth rejecting
+	minEmailPartLength = 3
+)
+
+// PasswordPolicy tells which passwords users may choose.
+// MinScore is the lowest strength.Score accepted, from 0 (anything) to strength.MaxScore.
+type PasswordPolicy struct {
+	MinLength int `validate:"gte=5,lte=256"`
+	MinScore  int `validate:"gte=0,lte=4"`
+}
+
+func (p *PasswordPolicy) Valid() error {
+	err := validator.New().Struct(p)
+	if err != nil {
+		return err.(validator.ValidationErrors)
+	}
+
+	return nil
+}
+
+// Check returns why the password is rejected, none when it is acceptable.
+// Breached passwords are not known to the policy, callers check them too.
+func (p *PasswordPolicy) Check(password string, email string) []string {
+	reasons := []string{}
+
+	if len(password) > MaxPasswordLength {
+		return append(reasons, PasswordReasonTooLong)
+	}
+
+	if utf8.RuneCountInString(password) < p.MinLength {
+		reasons = append(reasons, PasswordReasonTooShort)
+	}
+
+	parts := emailParts(email)
+	lower := strings.ToLower(password)
+	for _, part := range parts {
+		if strings.Contains(lower, part) {
+			reasons = append(reasons, PasswordReasonContainsEmail)
+			break
+		}
+	}
+
+	if strength.Score(password, parts...) < p.MinScore {
+		reasons = append(reasons, PasswordReasonTooWeak)
+	}
+
+	return reasons
+}
+
+// emailParts returns the address, its local part and the words of both, e.g. "hatsune" and "miku".
+// The top level domain is left out, "com" is not personal.
+func emailParts(email string) []string {
+	email = strings.ToLower(email)
+	at := strings.LastIndexByte(email, '@')
+	if at < 0 {
+		return nil
+	}
+
+	parts := []string{email, email[:at]}
+	domain := email[at+1:]
+	if dot := strings.LastIndexByte(domain, '.'); dot >= 0 {
+		domain = domain[:dot]
+	}
+
+	words := strings.FieldsFunc(email[:at]+" "+domain, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	parts = append(parts, words...)
+
+	long := parts[:0]
+	for _, p := range parts {
+		if utf8.RuneCountInString(p) >= minEmailPartLength {
+			long = append(long, p)
+		}
+	}
+	return long
+}
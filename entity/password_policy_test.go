@@ -0,0 +1,67 @@
+package entity
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type EntityPasswordPolicyTestSuite struct {
+	suite.Suite
+}
+
+func (s *EntityPasswordPolicyTestSuite) newPolicy() *PasswordPolicy {
+	return NewFactory().NewPasswordPolicy(8, 2)
+}
+
+func (s *EntityPasswordPolicyTestSuite) TestValid() {
+	assert.NoError(s.T(), s.newPolicy().Valid())
+	assert.NoError(s.T(), NewFactory().NewPasswordPolicy(MinPasswordLength, 0).Valid())
+
+	// shorter passwords are never valid
+	assert.Error(s.T(), NewFactory().NewPasswordPolicy(4, 2).Valid())
+	assert.Error(s.T(), NewFactory().NewPasswordPolicy(MaxPasswordLength+1, 2).Valid())
+	assert.Error(s.T(), NewFactory().NewPasswordPolicy(8, 5).Valid())
+}
+
+func (s *EntityPasswordPolicyTestSuite) TestCheck() {
+	p := s.newPolicy()
+	email := "hatsune.miku@vocaloid.com"
+
+	cases := []struct {
+		password string
+		reasons  []string
+	}{
+		{"another-strong-password", []string{}},
+		{"correct horse battery staple", []string{}},
+		{"qwerty", []string{PasswordReasonTooShort, PasswordReasonTooWeak}},
+		{"password1", []string{PasswordReasonTooWeak}},
+		{"p@ssw0rd123", []string{PasswordReasonTooWeak}},
+		{"hatsune-rocks-2021", []string{PasswordReasonContainsEmail}},
+		{"Vocaloid-Fan-Club", []string{PasswordReasonContainsEmail}},
+		{strings.Repeat("x", MaxPasswordLength+1), []string{PasswordReasonTooLong}},
+	}
+	for _, c := range cases {
+		assert.Equal(s.T(), c.reasons, p.Check(c.password, email), c.password)
+	}
+}
+
+func (s *EntityPasswordPolicyTestSuite) TestCheckCountsCharacters() {
+	p := NewFactory().NewPasswordPolicy(8, 0)
+
+	// 7 characters, 21 bytes
+	assert.Equal(s.T(), []string{PasswordReasonTooShort}, p.Check("パスワードです", "hatsune@miku.com"))
+}
+
+func (s *EntityPasswordPolicyTestSuite) TestCheckIgnoresShortEmailParts() {
+	p := NewFactory().NewPasswordPolicy(8, 0)
+
+	// "jo" and "com" are too common to reject
+	assert.Empty(s.T(), p.Check("john-company", "jo@x.com"))
+}
+
+func TestEntityPasswordPolicy(t *testing.T) {
+	suite.Run(t, new(EntityPasswordPolicyTestSuite))
+}
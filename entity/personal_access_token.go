@@ -0,0 +1,45 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/go-playground/validator/v10"
+)
+
+const (
+	// PersonalAccessTokenPrefix tells personal access tokens apart from JWTs
+	PersonalAccessTokenPrefix = "pat_"
+)
+
+// PersonalAccessToken is a long-lived token for scripts, only the hash of the token is kept.
+type PersonalAccessToken struct {
+	ID         string   `validate:"required,uuid4"`
+	UserID     string   `validate:"required,uuid4"`
+	Name       string   `validate:"required,max=64"`
+	Scopes     []string `validate:"min=1,unique,dive,oneof=todos:read todos:write user:read user:write"`
+	TokenHash  string   `validate:"required"`
+	LastUsedAt *time.Time
+	// nil means the token never expires
+	ExpiresAt *time.Time
+	CreatedAt time.Time `validate:"required"`
+}
+
+func (t *PersonalAccessToken) Valid() error {
+	err := validator.New().Struct(t)
+	if err != nil {
+		return err.(validator.ValidationErrors)
+	}
+
+	return nil
+}
+
+// Usable reports whether the token can still authenticate requests.
+func (t *PersonalAccessToken) Usable(now time.Time) bool {
+	return t.ExpiresAt == nil || now.Before(*t.ExpiresAt)
+}
+
+// IssuedPersonalAccessToken is a newly created token, the plain token is shown only once.
+type IssuedPersonalAccessToken struct {
+	*PersonalAccessToken
+	Token string
+}
@@ -0,0 +1,67 @@
+package entity
+
+import (
+	"testing"
+	"time"
+
+	"github.com/org39/webapp-tutorial-backend/pkg/crypt"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type EntityPersonalAccessTokenTestSuite struct {
+	suite.Suite
+}
+
+func (s *EntityPersonalAccessTokenTestSuite) TestCreationValid() {
+	userID := "2192fc7b-bd9b-446d-a50e-5ce0ba02cee6"
+	token := "pat_Dz8v2cQy3kq4d4D9D0ZbO0Xx2JzM0oR6x6bDq9k1lZc"
+
+	t, err := NewFactory().NewPersonalAccessToken(userID, "ci", []string{ScopeTodosRead}, token, 0)
+	assert.NoError(s.T(), err)
+	assert.NoError(s.T(), t.Valid())
+	assert.Nil(s.T(), t.ExpiresAt)
+	assert.True(s.T(), t.Usable(time.Now()))
+
+	// assert, plain token is never kept
+	assert.NotEqual(s.T(), token, t.TokenHash)
+	assert.Equal(s.T(), crypt.HashToken(token), t.TokenHash)
+}
+
+func (s *EntityPersonalAccessTokenTestSuite) TestCreationInvalid() {
+	userID := "2192fc7b-bd9b-446d-a50e-5ce0ba02cee6"
+	token := "pat_Dz8v2cQy3kq4d4D9D0ZbO0Xx2JzM0oR6x6bDq9k1lZc"
+
+	cases := []struct {
+		name   string
+		scopes []string
+	}{
+		{"", []string{ScopeTodosRead}},
+		{"ci", []string{}},
+		{"ci", nil},
+		{"ci", []string{"admin"}},
+		{"ci", []string{ScopeTodosRead, ScopeTodosRead}},
+	}
+	for _, c := range cases {
+		t, err := NewFactory().NewPersonalAccessToken(userID, c.name, c.scopes, token, 0)
+		assert.NoError(s.T(), err)
+		assert.Error(s.T(), t.Valid())
+	}
+}
+
+func (s *EntityPersonalAccessTokenTestSuite) TestExpiration() {
+	userID := "2192fc7b-bd9b-446d-a50e-5ce0ba02cee6"
+	token := "pat_Dz8v2cQy3kq4d4D9D0ZbO0Xx2JzM0oR6x6bDq9k1lZc"
+
+	t, err := NewFactory().NewPersonalAccessToken(userID, "ci", AllScopes(), token, time.Hour)
+	assert.NoError(s.T(), err)
+	assert.NoError(s.T(), t.Valid())
+	assert.NotNil(s.T(), t.ExpiresAt)
+	assert.True(s.T(), t.Usable(time.Now()))
+	assert.False(s.T(), t.Usable(time.Now().Add(2*time.Hour)))
+}
+
+func TestEntityPersonalAccessToken(t *testing.T) {
+	suite.Run(t, new(EntityPersonalAccessTokenTestSuite))
+}
@@ -0,0 +1,32 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/go-playground/validator/v10"
+)
+
+type RefreshToken struct {
+	ID        string `validate:"required,uuid4"`
+	FamilyID  string `validate:"required,uuid4"`
+	UserID    string `validate:"required,uuid4"`
+	Rotated   bool
+	Revoked   bool
+	ExpiresAt time.Time `validate:"required"`
+	CreatedAt time.Time `validate:"required"`
+}
+
+func (t *RefreshToken) Valid() error {
+	err := validator.New().Struct(t)
+	if err != nil {
+		return err.(validator.ValidationErrors)
+	}
+
+	return nil
+}
+
+// Usable reports whether the token can still be exchanged for a new token pair.
+// A rotated token is not usable, presenting it again means the token was reused.
+func (t *RefreshToken) Usable(now time.Time) bool {
+	return !t.Rotated && !t.Revoked && now.Before(t.ExpiresAt)
+}
@@ -0,0 +1,48 @@
+package entity
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type EntityRefreshTokenTestSuite struct {
+	suite.Suite
+}
+
+func (s *EntityRefreshTokenTestSuite) TestCreationValid() {
+	userID := "2192fc7b-bd9b-446d-a50e-5ce0ba02cee6"
+	familyID := "4daaaea8-4721-4644-aaac-7958805b4530"
+
+	t, err := NewFactory().NewRefreshToken(userID, familyID, time.Hour)
+	assert.NoError(s.T(), err)
+	assert.NoError(s.T(), t.Valid())
+	assert.True(s.T(), t.Usable(time.Now()))
+}
+
+func (s *EntityRefreshTokenTestSuite) TestNotUsable() {
+	userID := "2192fc7b-bd9b-446d-a50e-5ce0ba02cee6"
+	familyID := "4daaaea8-4721-4644-aaac-7958805b4530"
+
+	rotated, err := NewFactory().NewRefreshToken(userID, familyID, time.Hour)
+	assert.NoError(s.T(), err)
+	rotated.Rotated = true
+
+	revoked, err := NewFactory().NewRefreshToken(userID, familyID, time.Hour)
+	assert.NoError(s.T(), err)
+	revoked.Revoked = true
+
+	expired, err := NewFactory().NewRefreshToken(userID, familyID, -time.Hour)
+	assert.NoError(s.T(), err)
+
+	cases := []*RefreshToken{rotated, revoked, expired}
+	for _, c := range cases {
+		assert.False(s.T(), c.Usable(time.Now()))
+	}
+}
+
+func TestEntityRefreshToken(t *testing.T) {
+	suite.Run(t, new(EntityRefreshTokenTestSuite))
+}
@@ -0,0 +1,20 @@
+package entity
+
+const (
+	RoleAdmin = "admin"
+)
+
+// AllRoles returns every role a user can be granted.
+func AllRoles() []string {
+	return []string{RoleAdmin}
+}
+
+func hasRole(roles []string, role string) bool {
+	for _, r := range roles {
+		if r == role {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,13 @@
+package entity
+
+const (
+	ScopeTodosRead  = "todos:read"
+	ScopeTodosWrite = "todos:write"
+	ScopeUserRead   = "user:read"
+	ScopeUserWrite  = "user:write"
+)
+
+// AllScopes returns every scope a token can carry.
+func AllScopes() []string {
+	return []string{ScopeTodosRead, ScopeTodosWrite, ScopeUserRead, ScopeUserWrite}
+}
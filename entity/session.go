@@ -0,0 +1,61 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/go-playground/validator/v10"
+)
+
+const (
+	maxSessionUserAgentLength = 255
+
+	// how long after logging in a session confirms changes for users without a password
+	FreshSessionMaxAge = 10 * time.Minute
+)
+
+// Session is a login on a device, it lives as long as its refresh token family.
+// The ID is the family ID of the refresh tokens.
+type Session struct {
+	ID         string `validate:"required,uuid4"`
+	UserID     string `validate:"required,uuid4"`
+	Label      string `validate:"required,max=64"`
+	UserAgent  string `validate:"max=255"`
+	IP         string `validate:"omitempty,ip"`
+	Revoked    bool
+	LastSeenAt time.Time `validate:"required"`
+	ExpiresAt  time.Time `validate:"required"`
+	CreatedAt  time.Time `validate:"required"`
+}
+
+func (s *Session) Valid() error {
+	err := validator.New().Struct(s)
+	if err != nil {
+		return err.(validator.ValidationErrors)
+	}
+
+	return nil
+}
+
+// Active reports whether the session can still be refreshed.
+func (s *Session) Active(now time.Time) bool {
+	return !s.Revoked && now.Before(s.ExpiresAt)
+}
+
+// Fresh reports whether the session was logged in recently enough to stand in for the current password.
+func (s *Session) Fresh(now time.Time) bool {
+	return s.Active(now) && now.Sub(s.CreatedAt) < FreshSessionMaxAge
+}
+
+// truncateUserAgent keeps user agents within the column, they are informational only
+func truncateUserAgent(userAgent string) string {
+	if len(userAgent) <= maxSessionUserAgentLength {
+		return userAgent
+	}
+
+	// do not cut a multi-byte character in half
+	cut := maxSessionUserAgentLength
+	for cut > 0 && userAgent[cut]&0xC0 == 0x80 {
+		cut--
+	}
+	return userAgent[:cut]
+}
@@ -0,0 +1,86 @@
+package entity
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type EntitySessionTestSuite struct {
+	suite.Suite
+}
+
+func (s *EntitySessionTestSuite) TestCreationValid() {
+	userID := "2192fc7b-bd9b-446d-a50e-5ce0ba02cee6"
+	familyID := "4daaaea8-4721-4644-aaac-7958805b4530"
+
+	session, err := NewFactory().NewSession(userID, familyID, "Firefox on Linux", "Mozilla/5.0 (X11; Linux x86_64; rv:88.0) Gecko/20100101 Firefox/88.0", "192.0.2.1", time.Now().Add(time.Hour))
+	assert.NoError(s.T(), err)
+	assert.NoError(s.T(), session.Valid())
+	assert.Equal(s.T(), familyID, session.ID)
+	assert.True(s.T(), session.Active(time.Now()))
+}
+
+func (s *EntitySessionTestSuite) TestUnknownClientValid() {
+	userID := "2192fc7b-bd9b-446d-a50e-5ce0ba02cee6"
+	familyID := "4daaaea8-4721-4644-aaac-7958805b4530"
+
+	session, err := NewFactory().NewSession(userID, familyID, "Unknown device", "", "", time.Now().Add(time.Hour))
+	assert.NoError(s.T(), err)
+	assert.NoError(s.T(), session.Valid())
+}
+
+func (s *EntitySessionTestSuite) TestInvalidIP() {
+	userID := "2192fc7b-bd9b-446d-a50e-5ce0ba02cee6"
+	familyID := "4daaaea8-4721-4644-aaac-7958805b4530"
+
+	session, err := NewFactory().NewSession(userID, familyID, "Unknown device", "", "not-an-address", time.Now().Add(time.Hour))
+	assert.NoError(s.T(), err)
+	assert.Error(s.T(), session.Valid())
+}
+
+func (s *EntitySessionTestSuite) TestLongUserAgentTruncated() {
+	userID := "2192fc7b-bd9b-446d-a50e-5ce0ba02cee6"
+	familyID := "4daaaea8-4721-4644-aaac-7958805b4530"
+
+	session, err := NewFactory().NewSession(userID, familyID, "Unknown device", "a"+strings.Repeat("ミク", 200), "", time.Now().Add(time.Hour))
+	assert.NoError(s.T(), err)
+	assert.NoError(s.T(), session.Valid())
+	assert.LessOrEqual(s.T(), len(session.UserAgent), 255)
+	assert.True(s.T(), utf8.ValidString(session.UserAgent))
+}
+
+func (s *EntitySessionTestSuite) TestNotActive() {
+	userID := "2192fc7b-bd9b-446d-a50e-5ce0ba02cee6"
+	familyID := "4daaaea8-4721-4644-aaac-7958805b4530"
+
+	revoked, err := NewFactory().NewSession(userID, familyID, "Unknown device", "", "", time.Now().Add(time.Hour))
+	assert.NoError(s.T(), err)
+	revoked.Revoked = true
+	assert.False(s.T(), revoked.Active(time.Now()))
+
+	expired, err := NewFactory().NewSession(userID, familyID, "Unknown device", "", "", time.Now().Add(-time.Hour))
+	assert.NoError(s.T(), err)
+	assert.False(s.T(), expired.Active(time.Now()))
+}
+
+func (s *EntitySessionTestSuite) TestFresh() {
+	userID := "2192fc7b-bd9b-446d-a50e-5ce0ba02cee6"
+	familyID := "4daaaea8-4721-4644-aaac-7958805b4530"
+
+	session, err := NewFactory().NewSession(userID, familyID, "Unknown device", "", "", time.Now().Add(time.Hour))
+	assert.NoError(s.T(), err)
+	assert.True(s.T(), session.Fresh(time.Now()))
+	assert.False(s.T(), session.Fresh(time.Now().Add(FreshSessionMaxAge)))
+
+	session.Revoked = true
+	assert.False(s.T(), session.Fresh(time.Now()))
+}
+
+func TestEntitySession(t *testing.T) {
+	suite.Run(t, new(EntitySessionTestSuite))
+}
@@ -0,0 +1,82 @@
+package entity
+
+import (
+	"errors"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/go-playground/validator/v10"
+)
+
+const (
+	MaxTagNameLength = 64
+	// the most tags a user may have
+	MaxTagsPerUser = 100
+
+	// color of tags created without one
+	DefaultTagColor = "#9e9e9e"
+)
+
+var (
+	ErrInvalidTagName = errors.New("invalid tag name")
+)
+
+// Tag labels todos of its user, names are unique per user regardless of case.
+type Tag struct {
+	ID     string `validate:"required,uuid4"`
+	UserID string `validate:"required,uuid4"`
+	Name   string `validate:"required,max=64"`
+	// #rrggbb, lower case
+	Color     string    `validate:"required,len=7,hexcolor"`
+	CreatedAt time.Time `validate:"required"`
+	UpdatedAt time.Time `validate:"required"`
+}
+
+// TagUpdate changes some fields of a tag, nil fields are kept.
+type TagUpdate struct {
+	Name  *string
+	Color *string
+}
+
+func (t *Tag) Valid() error {
+	err := validator.New().Struct(t)
+	if err != nil {
+		return err.(validator.ValidationErrors)
+	}
+
+	for _, r := range t.Name {
+		if unicode.IsControl(r) {
+			return ErrInvalidTagName
+		}
+	}
+
+	return nil
+}
+
+// Apply changes the fields set in the update.
+func (t *Tag) Apply(u *TagUpdate, now time.Time) {
+	if u.Name != nil {
+		t.Name = normalizeTagName(*u.Name)
+	}
+	if u.Color != nil {
+		t.Color = normalizeTagColor(*u.Color)
+	}
+	t.UpdatedAt = now
+}
+
+// SameName tells whether the tag is named name, names differing in case are the same.
+func (t *Tag) SameName(name string) bool {
+	return strings.EqualFold(t.Name, normalizeTagName(name))
+}
+
+func normalizeTagName(name string) string {
+	return strings.TrimSpace(name)
+}
+
+func normalizeTagColor(color string) string {
+	if color == "" {
+		return DefaultTagColor
+	}
+	return strings.ToLower(color)
+}
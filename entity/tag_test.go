@@ -0,0 +1,94 @@
+package entity
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type EntityTagTestSuite struct {
+	suite.Suite
+}
+
+func (s *EntityTagTestSuite) TestCreationValid() {
+	u, err := NewFactory().NewUser("hatsnune@miku.com", "very-strong-password", newTestPasswordHasher(s.T()))
+	assert.NoError(s.T(), err)
+
+	cases := []struct {
+		name  string
+		color string
+		valid bool
+	}{
+		{"home", "#4caf50", true},
+		{" home ", "", true},
+		{"家事", "#4CAF50", true},
+		{strings.Repeat("x", MaxTagNameLength), "#4caf50", true},
+		{"", "#4caf50", false},
+		{"   ", "#4caf50", false},
+		{strings.Repeat("x", MaxTagNameLength+1), "#4caf50", false},
+		{"home\nwork", "#4caf50", false},
+		{"home", "green", false},
+		{"home", "#fff", false},
+		{"home", "#4caf5g", false},
+	}
+
+	for _, c := range cases {
+		t, err := NewFactory().NewTag(u, c.name, c.color)
+		assert.NoError(s.T(), err)
+
+		if c.valid {
+			assert.NoError(s.T(), t.Valid(), "%+v", c)
+		} else {
+			assert.Error(s.T(), t.Valid(), "%+v", c)
+		}
+	}
+}
+
+func (s *EntityTagTestSuite) TestCreationNormalizes() {
+	u, err := NewFactory().NewUser("hatsnune@miku.com", "very-strong-password", newTestPasswordHasher(s.T()))
+	assert.NoError(s.T(), err)
+
+	t, err := NewFactory().NewTag(u, "  home ", "")
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), "home", t.Name)
+	assert.Equal(s.T(), DefaultTagColor, t.Color)
+
+	t, err = NewFactory().NewTag(u, "home", "#4CAF50")
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), "#4caf50", t.Color)
+}
+
+func (s *EntityTagTestSuite) TestApply() {
+	u, err := NewFactory().NewUser("hatsnune@miku.com", "very-strong-password", newTestPasswordHasher(s.T()))
+	assert.NoError(s.T(), err)
+	t, err := NewFactory().NewTag(u, "home", "#4caf50")
+	assert.NoError(s.T(), err)
+	now := time.Now().Add(time.Minute)
+
+	name := " work "
+	t.Apply(NewFactory().NewTagUpdate(&name, nil), now)
+
+	// assert, only the fields set are changed
+	assert.NoError(s.T(), t.Valid())
+	assert.Equal(s.T(), "work", t.Name)
+	assert.Equal(s.T(), "#4caf50", t.Color)
+	assert.Equal(s.T(), now, t.UpdatedAt)
+}
+
+func (s *EntityTagTestSuite) TestSameName() {
+	u, err := NewFactory().NewUser("hatsnune@miku.com", "very-strong-password", newTestPasswordHasher(s.T()))
+	assert.NoError(s.T(), err)
+	t, err := NewFactory().NewTag(u, "Home", "")
+	assert.NoError(s.T(), err)
+
+	assert.True(s.T(), t.SameName("home"))
+	assert.True(s.T(), t.SameName(" HOME "))
+	assert.False(s.T(), t.SameName("homework"))
+}
+
+func TestEntityTag(t *testing.T) {
+	suite.Run(t, new(EntityTagTestSuite))
+}
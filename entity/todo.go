@@ -1,11 +1,58 @@
 package entity
 
 import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"time"
 
+	"github.com/org39/webapp-tutorial-backend/pkg/search"
+
 	"github.com/go-playground/validator/v10"
 )
 
+const (
+	// which todos are listed by completion
+	TodoStatusOpen      = "open"
+	TodoStatusCompleted = "completed"
+	TodoStatusAll       = "all"
+
+	// whether deleted todos are listed
+	TodoDeletedExclude = "false"
+	TodoDeletedInclude = "true"
+	TodoDeletedOnly    = "only"
+
+	// keys todos are listed by
+	TodoSortCreatedAt = "created_at"
+	TodoSortUpdatedAt = "updated_at"
+	TodoSortDueAt     = "due_at"
+	TodoSortPriority  = "priority"
+	TodoSortPosition  = "position"
+
+	TodoOrderAsc  = "asc"
+	TodoOrderDesc = "desc"
+
+	// the most todos listed at once
+	MaxTodoPageLimit = 100
+
+	// priorities go from 0, none, to the highest
+	MaxTodoPriority = 3
+
+	// whether listed todos have any or all of the tags
+	TodoTagMatchAny = "any"
+	TodoTagMatchAll = "all"
+
+	// runes of content shown around the words found by a search
+	TodoSnippetLength = 160
+)
+
+var (
+	ErrInvalidTodoDateRange = errors.New("invalid date range")
+	ErrInvalidTodoCursor    = errors.New("invalid cursor")
+	ErrTodoCursorMismatch   = errors.New("cursor of another order")
+	ErrEmptyTodoSearch      = errors.New("no words to search")
+)
+
 type Todo struct {
 	ID        string `validate:"required,uuid4"`
 	UserID    string `validate:"required,uuid4"`
@@ -14,6 +61,13 @@ type Todo struct {
 	CreatedAt time.Time `validate:"required"`
 	UpdatedAt time.Time `validate:"required"`
 	Deleted   bool
+	// nil when the todo has no due date
+	DueAt    *time.Time
+	Priority int `validate:"gte=0,lte=3"`
+	// place of the todo in the order the user arranged
+	Position int `validate:"gte=0"`
+	// loaded by the usecase, nil when not loaded
+	Tags []*Tag
 }
 
 func (u *Todo) Valid() error {
@@ -24,3 +78,210 @@ func (u *Todo) Valid() error {
 
 	return nil
 }
+
+// TodoFilter selects the todos of a user.
+// Date ranges include their start and exclude their end, a nil bound leaves the range open.
+type TodoFilter struct {
+	Status        string `validate:"oneof=open completed all"`
+	Deleted       string `validate:"oneof=false true only"`
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	UpdatedAfter  *time.Time
+	UpdatedBefore *time.Time
+	// matches todos whose content contains it, empty matches every todo
+	Content string `validate:"max=256"`
+	// ids of tags the todos have, any or all of them by TagMatch, empty matches every todo
+	Tags     []string `validate:"max=20,unique,dive,uuid4"`
+	TagMatch string   `validate:"oneof=any all"`
+}
+
+func (f *TodoFilter) Valid() error {
+	err := validator.New().Struct(f)
+	if err != nil {
+		return err.(validator.ValidationErrors)
+	}
+
+	if !validRange(f.CreatedAfter, f.CreatedBefore) || !validRange(f.UpdatedAfter, f.UpdatedBefore) {
+		return ErrInvalidTodoDateRange
+	}
+
+	return nil
+}
+
+// Completed returns the completion of the listed todos, nil when both are listed.
+func (f *TodoFilter) Completed() *bool {
+	switch f.Status {
+	case TodoStatusOpen:
+		return boolPtr(false)
+	case TodoStatusCompleted:
+		return boolPtr(true)
+	}
+	return nil
+}
+
+// AllTags tells whether the listed todos have every tag of the filter, rather than any.
+func (f *TodoFilter) AllTags() bool {
+	return f.TagMatch == TodoTagMatchAll
+}
+
+// IsDeleted returns whether the listed todos are deleted, nil when both are listed.
+func (f *TodoFilter) IsDeleted() *bool {
+	switch f.Deleted {
+	case TodoDeletedExclude:
+		return boolPtr(false)
+	case TodoDeletedOnly:
+		return boolPtr(true)
+	}
+	return nil
+}
+
+// TodoSort is the order of a listing, todos with the same key are ordered by id in the same direction.
+// Todos without a due date come first by due_at ascending, and last descending.
+type TodoSort struct {
+	Key   string `validate:"oneof=created_at updated_at due_at priority position"`
+	Order string `validate:"oneof=asc desc"`
+}
+
+func (s *TodoSort) Valid() error {
+	err := validator.New().Struct(s)
+	if err != nil {
+		return err.(validator.ValidationErrors)
+	}
+
+	return nil
+}
+
+// Value returns the key of the todo in this order: a time.Time, an int, or nil for a todo without a due date.
+func (s *TodoSort) Value(t *Todo) interface{} {
+	switch s.Key {
+	case TodoSortUpdatedAt:
+		return t.UpdatedAt
+	case TodoSortDueAt:
+		if t.DueAt == nil {
+			return nil
+		}
+		return *t.DueAt
+	case TodoSortPriority:
+		return t.Priority
+	case TodoSortPosition:
+		return t.Position
+	}
+	return t.CreatedAt
+}
+
+// TodoCursor is the position of the last todo of a page, it only continues a listing in the same order.
+type TodoCursor struct {
+	Sort TodoSort
+	// key of the last todo in the order, as returned by TodoSort.Value
+	Value interface{}
+	ID    string `validate:"required,uuid4"`
+}
+
+// todoCursorJSON is the encoded form of a cursor, clients must not rely on it
+type todoCursorJSON struct {
+	Key   string          `json:"k"`
+	Order string          `json:"o"`
+	Value json.RawMessage `json:"v"`
+	ID    string          `json:"i"`
+}
+
+func (c *TodoCursor) Valid() error {
+	err := validator.New().Struct(c)
+	if err != nil {
+		return err.(validator.ValidationErrors)
+	}
+
+	// the value is of the type of the key
+	switch c.Value.(type) {
+	case time.Time:
+		if c.Sort.Key == TodoSortCreatedAt || c.Sort.Key == TodoSortUpdatedAt || c.Sort.Key == TodoSortDueAt {
+			return nil
+		}
+	case int:
+		if c.Sort.Key == TodoSortPriority || c.Sort.Key == TodoSortPosition {
+			return nil
+		}
+	case nil:
+		if c.Sort.Key == TodoSortDueAt {
+			return nil
+		}
+	}
+
+	return ErrInvalidTodoCursor
+}
+
+// Encode returns the opaque form of the cursor given to clients.
+func (c *TodoCursor) Encode() string {
+	// marshaling times, ints and strings does not fail
+	v, _ := json.Marshal(c.Value)
+	b, _ := json.Marshal(&todoCursorJSON{Key: c.Sort.Key, Order: c.Sort.Order, Value: v, ID: c.ID})
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// decodeTodoSortValue reads the value of a cursor in the type of the key, nil for null.
+func decodeTodoSortValue(key string, raw json.RawMessage) (interface{}, error) {
+	if string(raw) == "null" {
+		return nil, nil
+	}
+
+	switch key {
+	case TodoSortPriority, TodoSortPosition:
+		var n int
+		if err := json.Unmarshal(raw, &n); err != nil {
+			return nil, err
+		}
+		return n, nil
+	}
+
+	var t time.Time
+	if err := json.Unmarshal(raw, &t); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// TodoPage is a page of a listing, Next is nil on the last page.
+type TodoPage struct {
+	Todos []*Todo
+	Next  *TodoCursor
+}
+
+// TodoSearch finds the todos of a user by the words of their content, the most relevant first.
+type TodoSearch struct {
+	Query string `validate:"required,max=256"`
+	Limit uint64 `validate:"gte=1,lte=100"`
+}
+
+func (s *TodoSearch) Valid() error {
+	err := validator.New().Struct(s)
+	if err != nil {
+		return err.(validator.ValidationErrors)
+	}
+
+	// short words and stopwords are not indexed
+	if len(s.Terms()) == 0 {
+		return ErrEmptyTodoSearch
+	}
+
+	return nil
+}
+
+// Terms returns the words of the query which are searched.
+func (s *TodoSearch) Terms() []string {
+	return search.Tokenize(s.Query)
+}
+
+// TodoSearchResult is a todo found by a search, Snippet is HTML with the words found in <mark></mark>.
+type TodoSearchResult struct {
+	Todo    *Todo
+	Score   float64
+	Snippet string
+}
+
+func validRange(after *time.Time, before *time.Time) bool {
+	return after == nil || before == nil || after.Before(*before)
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
@@ -1,7 +1,10 @@
 package entity
 
 import (
+	"strings"
 	"testing"
+	"time"
+	"unicode/utf8"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
@@ -12,7 +15,7 @@ type EntityTodoTestSuite struct {
 }
 
 func (s *EntityTodoTestSuite) TestCreationValid() {
-	u, err := NewFactory().NewUser("hatsnune@miku.com", "very-strong-password")
+	u, err := NewFactory().NewUser("hatsnune@miku.com", "very-strong-password", newTestPasswordHasher(s.T()))
 	assert.NoError(s.T(), err)
 
 	cases := []struct {
@@ -23,7 +26,7 @@ func (s *EntityTodoTestSuite) TestCreationValid() {
 	}
 
 	for _, c := range cases {
-		e, err := NewFactory().NewTodo(u, c.content)
+		e, err := NewFactory().NewTodo(u, c.content, nil, 0, 0)
 		assert.NoError(s.T(), err)
 
 		v := e.Valid()
@@ -31,6 +34,159 @@ func (s *EntityTodoTestSuite) TestCreationValid() {
 	}
 }
 
+func (s *EntityTodoTestSuite) TestPriorityAndPositionValid() {
+	u, err := NewFactory().NewUser("hatsnune@miku.com", "very-strong-password", newTestPasswordHasher(s.T()))
+	assert.NoError(s.T(), err)
+
+	due := time.Date(2021, 5, 1, 0, 0, 0, 0, time.UTC)
+	e, err := NewFactory().NewTodo(u, "TODO1", &due, MaxTodoPriority, 7)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), &due, e.DueAt)
+
+	assert.NoError(s.T(), e.Valid())
+
+	e.Priority = MaxTodoPriority + 1
+	assert.Error(s.T(), e.Valid())
+	e.Priority = -1
+	assert.Error(s.T(), e.Valid())
+	e.Priority = 0
+	e.Position = -1
+	assert.Error(s.T(), e.Valid())
+}
+
+func (s *EntityTodoTestSuite) TestFilterValid() {
+	may := time.Date(2021, 5, 1, 0, 0, 0, 0, time.UTC)
+	june := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		filter *TodoFilter
+		valid  bool
+	}{
+		{NewFactory().NewTodoFilter(TodoStatusOpen, TodoDeletedExclude, nil, nil, nil, nil, "", nil, TodoTagMatchAny), true},
+		{NewFactory().NewTodoFilter(TodoStatusAll, TodoDeletedOnly, &may, &june, &may, nil, "milk", nil, TodoTagMatchAny), true},
+		{NewFactory().NewTodoFilter("done", TodoDeletedExclude, nil, nil, nil, nil, "", nil, TodoTagMatchAny), false},
+		{NewFactory().NewTodoFilter(TodoStatusOpen, "", nil, nil, nil, nil, "", nil, TodoTagMatchAny), false},
+		{NewFactory().NewTodoFilter(TodoStatusOpen, TodoDeletedExclude, &june, &may, nil, nil, "", nil, TodoTagMatchAny), false},
+		{NewFactory().NewTodoFilter(TodoStatusOpen, TodoDeletedExclude, nil, nil, &may, &may, "", nil, TodoTagMatchAny), false},
+		{NewFactory().NewTodoFilter(TodoStatusOpen, TodoDeletedExclude, nil, nil, nil, nil, strings.Repeat("x", 257), nil, TodoTagMatchAny), false},
+		{NewFactory().NewTodoFilter(TodoStatusOpen, TodoDeletedExclude, nil, nil, nil, nil, "", []string{"7d3c1a52-96b4-4f0e-8d2b-3a1f6e9c0b47"}, TodoTagMatchAll), true},
+		{NewFactory().NewTodoFilter(TodoStatusOpen, TodoDeletedExclude, nil, nil, nil, nil, "", []string{"home"}, TodoTagMatchAny), false},
+		{NewFactory().NewTodoFilter(TodoStatusOpen, TodoDeletedExclude, nil, nil, nil, nil, "", []string{"7d3c1a52-96b4-4f0e-8d2b-3a1f6e9c0b47", "7d3c1a52-96b4-4f0e-8d2b-3a1f6e9c0b47"}, TodoTagMatchAny), false},
+		{NewFactory().NewTodoFilter(TodoStatusOpen, TodoDeletedExclude, nil, nil, nil, nil, "", nil, "most"), false},
+	}
+
+	for _, c := range cases {
+		if c.valid {
+			assert.NoError(s.T(), c.filter.Valid(), "%+v", c.filter)
+		} else {
+			assert.Error(s.T(), c.filter.Valid(), "%+v", c.filter)
+		}
+	}
+}
+
+func (s *EntityTodoTestSuite) TestFilterFlags() {
+	f := NewFactory().NewTodoFilter(TodoStatusCompleted, TodoDeletedInclude, nil, nil, nil, nil, "", nil, TodoTagMatchAny)
+	assert.Equal(s.T(), true, *f.Completed())
+	assert.Nil(s.T(), f.IsDeleted())
+
+	f = NewFactory().NewTodoFilter(TodoStatusAll, TodoDeletedExclude, nil, nil, nil, nil, "", nil, TodoTagMatchAny)
+	assert.Nil(s.T(), f.Completed())
+	assert.Equal(s.T(), false, *f.IsDeleted())
+}
+
+func (s *EntityTodoTestSuite) TestSortValid() {
+	assert.NoError(s.T(), NewFactory().NewTodoSort(TodoSortCreatedAt, TodoOrderAsc).Valid())
+	assert.NoError(s.T(), NewFactory().NewTodoSort(TodoSortUpdatedAt, TodoOrderDesc).Valid())
+	assert.NoError(s.T(), NewFactory().NewTodoSort(TodoSortDueAt, TodoOrderAsc).Valid())
+	assert.NoError(s.T(), NewFactory().NewTodoSort(TodoSortPriority, TodoOrderDesc).Valid())
+	assert.NoError(s.T(), NewFactory().NewTodoSort(TodoSortPosition, TodoOrderAsc).Valid())
+
+	// only whitelisted keys
+	assert.Error(s.T(), NewFactory().NewTodoSort("content", TodoOrderAsc).Valid())
+	assert.Error(s.T(), NewFactory().NewTodoSort(TodoSortCreatedAt, "random").Valid())
+}
+
+func (s *EntityTodoTestSuite) TestSortValue() {
+	created := time.Date(2021, 5, 1, 0, 0, 0, 0, time.UTC)
+	updated := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	t := &Todo{CreatedAt: created, UpdatedAt: updated, Priority: 2, Position: 5}
+
+	assert.Equal(s.T(), created, NewFactory().NewTodoSort(TodoSortCreatedAt, TodoOrderDesc).Value(t))
+	assert.Equal(s.T(), updated, NewFactory().NewTodoSort(TodoSortUpdatedAt, TodoOrderAsc).Value(t))
+	assert.Equal(s.T(), 2, NewFactory().NewTodoSort(TodoSortPriority, TodoOrderDesc).Value(t))
+	assert.Equal(s.T(), 5, NewFactory().NewTodoSort(TodoSortPosition, TodoOrderAsc).Value(t))
+
+	// todos without a due date have no value
+	assert.Nil(s.T(), NewFactory().NewTodoSort(TodoSortDueAt, TodoOrderAsc).Value(t))
+	t.DueAt = &created
+	assert.Equal(s.T(), created, NewFactory().NewTodoSort(TodoSortDueAt, TodoOrderAsc).Value(t))
+}
+
+func (s *EntityTodoTestSuite) TestCursorEncoding() {
+	sort := NewFactory().NewTodoSort(TodoSortUpdatedAt, TodoOrderDesc)
+	c := NewFactory().NewTodoCursor(sort, time.Date(2021, 5, 1, 12, 30, 0, 0, time.UTC), "4daaaea8-4721-4644-aaac-7958805b4530")
+
+	decoded, err := NewFactory().NewTodoCursorFromString(c.Encode())
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), *sort, decoded.Sort)
+	assert.True(s.T(), c.Value.(time.Time).Equal(decoded.Value.(time.Time)))
+	assert.Equal(s.T(), c.ID, decoded.ID)
+
+	// due dates may be missing, priorities and positions are numbers
+	due := NewFactory().NewTodoCursor(NewFactory().NewTodoSort(TodoSortDueAt, TodoOrderAsc), nil, c.ID)
+	decoded, err = NewFactory().NewTodoCursorFromString(due.Encode())
+	assert.NoError(s.T(), err)
+	assert.Nil(s.T(), decoded.Value)
+
+	priority := NewFactory().NewTodoCursor(NewFactory().NewTodoSort(TodoSortPriority, TodoOrderDesc), 2, c.ID)
+	decoded, err = NewFactory().NewTodoCursorFromString(priority.Encode())
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), 2, decoded.Value)
+
+	// cursors are opaque, anything else is rejected
+	invalid := []string{
+		"",
+		"not-a-cursor!",
+		"e30",
+		NewFactory().NewTodoCursor(sort, time.Now(), "not-an-id").Encode(),
+		NewFactory().NewTodoCursor(NewFactory().NewTodoSort("content", TodoOrderAsc), time.Now(), c.ID).Encode(),
+		NewFactory().NewTodoCursor(sort, nil, c.ID).Encode(),
+		NewFactory().NewTodoCursor(NewFactory().NewTodoSort(TodoSortPriority, TodoOrderAsc), time.Now(), c.ID).Encode(),
+	}
+	for _, v := range invalid {
+		_, err := NewFactory().NewTodoCursorFromString(v)
+		assert.ErrorIs(s.T(), err, ErrInvalidTodoCursor, v)
+	}
+}
+
+func (s *EntityTodoTestSuite) TestSearchValid() {
+	assert.NoError(s.T(), NewFactory().NewTodoSearch("milk", 20).Valid())
+	assert.Equal(s.T(), []string{"buy", "milk", "eggs"}, NewFactory().NewTodoSearch("Buy the MILK & eggs!", 20).Terms())
+
+	// stopwords and short words are not searched
+	assert.ErrorIs(s.T(), NewFactory().NewTodoSearch("to be or is it", 20).Valid(), ErrEmptyTodoSearch)
+
+	assert.Error(s.T(), NewFactory().NewTodoSearch("", 20).Valid())
+	assert.Error(s.T(), NewFactory().NewTodoSearch(strings.Repeat("milk ", 60), 20).Valid())
+	assert.Error(s.T(), NewFactory().NewTodoSearch("milk", 0).Valid())
+	assert.Error(s.T(), NewFactory().NewTodoSearch("milk", MaxTodoPageLimit+1).Valid())
+}
+
+func (s *EntityTodoTestSuite) TestSearchResultSnippet() {
+	t := &Todo{Content: "call <grandma> about the birthday party"}
+
+	r := NewFactory().NewTodoSearchResult(t, 1.5, []string{"grandma", "party"})
+	assert.Equal(s.T(), "call &lt;<mark>grandma</mark>&gt; about the birthday <mark>party</mark>", r.Snippet)
+
+	// long content is cut around the first word found
+	t.Content = strings.Repeat("chores ", 40) + "call grandma " + strings.Repeat("chores ", 40)
+	r = NewFactory().NewTodoSearchResult(t, 1.5, []string{"grandma"})
+	assert.Contains(s.T(), r.Snippet, "call <mark>grandma</mark> chores")
+	assert.True(s.T(), strings.HasPrefix(r.Snippet, "…chores"))
+	assert.True(s.T(), strings.HasSuffix(r.Snippet, "chores…"))
+	assert.LessOrEqual(s.T(), utf8.RuneCountInString(r.Snippet), TodoSnippetLength+len("<mark></mark>")+2)
+}
+
 func TestEntityTodo(t *testing.T) {
 	suite.Run(t, new(EntityTodoTestSuite))
 }
@@ -8,10 +8,13 @@ import (
 )
 
 type User struct {
-	ID        string    `validate:"required,uuid4"`
-	Email     string    `validate:"required,email"`
-	Password  string    `validate:"required"`
-	CreatedAt time.Time `validate:"required"`
+	ID         string `validate:"required,uuid4"`
+	Email      string `validate:"required,email"`
+	Password   string
+	Roles      []string `validate:"dive,oneof=admin"`
+	VerifiedAt *time.Time
+	DisabledAt *time.Time
+	CreatedAt  time.Time `validate:"required"`
 }
 
 func (u *User) Valid() error {
@@ -23,6 +26,59 @@ func (u *User) Valid() error {
 	return nil
 }
 
-func (u *User) ValidPassword(plainPassword string) error {
-	return crypt.Compare(u.Password, []byte(plainPassword))
+// ValidPassword returns crypt.ErrPasswordMismatch unless the password matches,
+// users without a password match none.
+func (u *User) ValidPassword(hasher *crypt.PasswordHasher, plainPassword string) error {
+	if !u.HasPassword() {
+		return crypt.ErrPasswordMismatch
+	}
+	return hasher.Compare(u.Password, []byte(plainPassword))
+}
+
+// HasPassword reports whether the user set a password, users signed up with a magic link have none.
+func (u *User) HasPassword() bool {
+	return u.Password != ""
+}
+
+// SetPassword replaces the password hash.
+func (u *User) SetPassword(hasher *crypt.PasswordHasher, plainPassword string) error {
+	hashedPassword, err := hasher.Hash([]byte(plainPassword))
+	if err != nil {
+		return err
+	}
+
+	u.Password = hashedPassword
+	return nil
+}
+
+// PasswordNeedsRehash reports whether the password hash is outdated,
+// it is replaced on the next successful login.
+func (u *User) PasswordNeedsRehash(hasher *crypt.PasswordHasher) bool {
+	return u.HasPassword() && hasher.NeedsRehash(u.Password)
+}
+
+// Verified reports whether the user confirmed the email address.
+func (u *User) Verified() bool {
+	return u.VerifiedAt != nil
+}
+
+// HasRole reports whether the user was granted the role.
+func (u *User) HasRole(role string) bool {
+	return hasRole(u.Roles, role)
+}
+
+// Disabled reports whether an admin disabled the account, disabled users can not log in.
+func (u *User) Disabled() bool {
+	return u.DisabledAt != nil
+}
+
+// Disable keeps the first time the account was disabled.
+func (u *User) Disable(now time.Time) {
+	if u.DisabledAt == nil {
+		u.DisabledAt = &now
+	}
+}
+
+func (u *User) Enable() {
+	u.DisabledAt = nil
 }
@@ -0,0 +1,53 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/org39/webapp-tutorial-backend/pkg/totp"
+)
+
+const (
+	// accepted clock drift between server and authenticator, in time steps
+	mfaSkew = 1
+)
+
+// UserMFA is the TOTP second factor of a user, enabled once the first code is confirmed.
+type UserMFA struct {
+	UserID       string `validate:"required,uuid4"`
+	Secret       string `validate:"required"`
+	Enabled      bool
+	LastUsedStep int64
+	CreatedAt    time.Time `validate:"required"`
+}
+
+func (m *UserMFA) Valid() error {
+	err := validator.New().Struct(m)
+	if err != nil {
+		return err.(validator.ValidationErrors)
+	}
+
+	return nil
+}
+
+// VerifyCode tests a TOTP code, a code of a step already used is refused.
+// It returns the step of the code, to be recorded as used.
+func (m *UserMFA) VerifyCode(code string, now time.Time) (int64, bool) {
+	step, ok := totp.Validate(m.Secret, code, now, mfaSkew)
+	if !ok || step <= m.LastUsedStep {
+		return 0, false
+	}
+
+	return step, true
+}
+
+// MFAEnrollment is handed to the user to register the secret in an authenticator app.
+type MFAEnrollment struct {
+	Secret string `validate:"required"`
+	URI    string `validate:"required"`
+}
+
+// MFAChallenge is returned by login instead of tokens when a second factor is required.
+type MFAChallenge struct {
+	Token string `validate:"required"`
+}
@@ -0,0 +1,73 @@
+package entity
+
+import (
+	"testing"
+	"time"
+
+	"github.com/org39/webapp-tutorial-backend/pkg/totp"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type EntityUserMFATestSuite struct {
+	suite.Suite
+}
+
+func (s *EntityUserMFATestSuite) TestCreationValid() {
+	userID := "2192fc7b-bd9b-446d-a50e-5ce0ba02cee6"
+
+	m, err := NewFactory().NewUserMFA(userID)
+	assert.NoError(s.T(), err)
+	assert.NoError(s.T(), m.Valid())
+	assert.False(s.T(), m.Enabled)
+	assert.NotEmpty(s.T(), m.Secret)
+}
+
+func (s *EntityUserMFATestSuite) TestVerifyCode() {
+	userID := "2192fc7b-bd9b-446d-a50e-5ce0ba02cee6"
+	now := time.Now()
+
+	m, err := NewFactory().NewUserMFA(userID)
+	assert.NoError(s.T(), err)
+
+	code, err := totp.Code(m.Secret, now)
+	assert.NoError(s.T(), err)
+
+	// assert, current code
+	step, ok := m.VerifyCode(code, now)
+	assert.True(s.T(), ok)
+	assert.Equal(s.T(), totp.Step(now), step)
+
+	// assert, code of the previous step is accepted for clock drift
+	previous, err := totp.Code(m.Secret, now.Add(-totp.Period*time.Second))
+	assert.NoError(s.T(), err)
+	_, ok = m.VerifyCode(previous, now)
+	assert.True(s.T(), ok)
+
+	// assert, wrong and malformed codes
+	for _, c := range []string{"", "12345", "abcdef", "1234567"} {
+		_, ok := m.VerifyCode(c, now)
+		assert.False(s.T(), ok)
+	}
+}
+
+func (s *EntityUserMFATestSuite) TestVerifyCodeRefuseReplay() {
+	userID := "2192fc7b-bd9b-446d-a50e-5ce0ba02cee6"
+	now := time.Now()
+
+	m, err := NewFactory().NewUserMFA(userID)
+	assert.NoError(s.T(), err)
+	m.LastUsedStep = totp.Step(now)
+
+	code, err := totp.Code(m.Secret, now)
+	assert.NoError(s.T(), err)
+
+	// assert
+	_, ok := m.VerifyCode(code, now)
+	assert.False(s.T(), ok)
+}
+
+func TestEntityUserMFA(t *testing.T) {
+	suite.Run(t, new(EntityUserMFATestSuite))
+}
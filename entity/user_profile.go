@@ -0,0 +1,78 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/go-playground/validator/v10"
+)
+
+const (
+	avatarKeyPrefix = "avatars/"
+)
+
+// UserProfile is how a user is shown and what the user prefers, every field is optional.
+type UserProfile struct {
+	UserID      string `validate:"required,uuid4"`
+	DisplayName string
+	TimeZone    string
+	Locale      string
+	// id of the avatar image in the blob store, empty when the user has none
+	AvatarID string
+	// free-form document of the client, e.g. the default sort of todos
+	Preferences map[string]interface{}
+	UpdatedAt   time.Time `validate:"required"`
+}
+
+// UserProfileUpdate changes some fields of a profile, nil fields are kept.
+type UserProfileUpdate struct {
+	DisplayName *string
+	TimeZone    *string
+	Locale      *string
+	// replaces the whole document
+	Preferences map[string]interface{}
+}
+
+func (p *UserProfile) Valid() error {
+	err := validator.New().Struct(p)
+	if err != nil {
+		return err.(validator.ValidationErrors)
+	}
+
+	v := NewValidator()
+	if err := v.ValidateDisplayName(p.DisplayName); err != nil {
+		return err
+	}
+	if err := v.ValidateTimeZone(p.TimeZone); err != nil {
+		return err
+	}
+	if err := v.ValidateLocale(p.Locale); err != nil {
+		return err
+	}
+	return v.ValidatePreferences(p.Preferences)
+}
+
+// Apply changes the fields set in the update.
+func (p *UserProfile) Apply(u *UserProfileUpdate, now time.Time) {
+	if u.DisplayName != nil {
+		p.DisplayName = *u.DisplayName
+	}
+	if u.TimeZone != nil {
+		p.TimeZone = *u.TimeZone
+	}
+	if u.Locale != nil {
+		p.Locale = *u.Locale
+	}
+	if u.Preferences != nil {
+		p.Preferences = u.Preferences
+	}
+	p.UpdatedAt = now
+}
+
+func (p *UserProfile) HasAvatar() bool {
+	return p.AvatarID != ""
+}
+
+// AvatarKey returns the key of the avatar image in the blob store.
+func AvatarKey(avatarID string) string {
+	return avatarKeyPrefix + avatarID
+}
@@ -0,0 +1,58 @@
+package entity
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type EntityUserProfileTestSuite struct {
+	suite.Suite
+}
+
+func (s *EntityUserProfileTestSuite) TestCreationValid() {
+	userID := "2192fc7b-bd9b-446d-a50e-5ce0ba02cee6"
+
+	p := NewFactory().NewUserProfile(userID)
+	assert.NoError(s.T(), p.Valid())
+	assert.False(s.T(), p.HasAvatar())
+	assert.Empty(s.T(), p.Preferences)
+}
+
+func (s *EntityUserProfileTestSuite) TestApply() {
+	userID := "2192fc7b-bd9b-446d-a50e-5ce0ba02cee6"
+	now := time.Now().Add(time.Minute)
+
+	p := NewFactory().NewUserProfile(userID)
+	p.Locale = "ja-JP"
+
+	name := "Miku"
+	tz := "Asia/Tokyo"
+	update := NewFactory().NewUserProfileUpdate(&name, &tz, nil, map[string]interface{}{"show_completed": false})
+	p.Apply(update, now)
+
+	// assert, only the fields set are changed
+	assert.NoError(s.T(), p.Valid())
+	assert.Equal(s.T(), "Miku", p.DisplayName)
+	assert.Equal(s.T(), "Asia/Tokyo", p.TimeZone)
+	assert.Equal(s.T(), "ja-JP", p.Locale)
+	assert.Equal(s.T(), false, p.Preferences["show_completed"])
+	assert.Equal(s.T(), now, p.UpdatedAt)
+}
+
+func (s *EntityUserProfileTestSuite) TestCreationInvalid() {
+	userID := "2192fc7b-bd9b-446d-a50e-5ce0ba02cee6"
+
+	p := NewFactory().NewUserProfile(userID)
+	p.TimeZone = "Mars/Olympus_Mons"
+	assert.ErrorIs(s.T(), p.Valid(), ErrInvalidTimeZone)
+
+	p = NewFactory().NewUserProfile("not-uuid")
+	assert.Error(s.T(), p.Valid())
+}
+
+func TestEntityUserProfile(t *testing.T) {
+	suite.Run(t, new(EntityUserProfileTestSuite))
+}
@@ -2,11 +2,29 @@ package entity
 
 import (
 	"testing"
+	"time"
 
+	"github.com/org39/webapp-tutorial-backend/pkg/crypt"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
+	"golang.org/x/crypto/bcrypt"
 )
 
+// newTestPasswordHasher returns a hasher with cheap parameters, options override them
+func newTestPasswordHasher(t *testing.T, options ...func(*crypt.PasswordHasher) error) *crypt.PasswordHasher {
+	options = append([]func(*crypt.PasswordHasher) error{
+		crypt.WithArgon2Params(crypt.Argon2Params{Time: 1, Memory: 1024, Threads: 1}),
+		crypt.WithBcryptCost(bcrypt.MinCost),
+		crypt.WithLegacySalt("SALT"),
+	}, options...)
+
+	hasher, err := crypt.NewPasswordHasher([]byte("PEPPER"), options...)
+	if err != nil {
+		t.Fatalf("fail to create password hasher: %s", err)
+	}
+	return hasher
+}
+
 type EntityUserTestSuite struct {
 	suite.Suite
 }
@@ -21,7 +39,7 @@ func (s *EntityUserTestSuite) TestUserInvalid() {
 	}
 
 	for _, c := range cases {
-		badass, err := NewFactory().NewUser(c.email, c.password)
+		badass, err := NewFactory().NewUser(c.email, c.password, newTestPasswordHasher(s.T()))
 		assert.NoError(s.T(), err)
 
 		v := badass.Valid()
@@ -29,6 +47,124 @@ func (s *EntityUserTestSuite) TestUserInvalid() {
 	}
 }
 
+func (s *EntityUserTestSuite) TestUserVerified() {
+	u, err := NewFactory().NewUser("hatsune@miku.com", "PASSWORD", newTestPasswordHasher(s.T()))
+	assert.NoError(s.T(), err)
+	assert.False(s.T(), u.Verified())
+
+	now := time.Now()
+	u.VerifiedAt = &now
+	assert.True(s.T(), u.Verified())
+}
+
+func (s *EntityUserTestSuite) TestUserRoles() {
+	u, err := NewFactory().NewUser("hatsune@miku.com", "PASSWORD", newTestPasswordHasher(s.T()))
+	assert.NoError(s.T(), err)
+	assert.False(s.T(), u.HasRole(RoleAdmin))
+
+	u.Roles = []string{RoleAdmin}
+	assert.NoError(s.T(), u.Valid())
+	assert.True(s.T(), u.HasRole(RoleAdmin))
+
+	// unknown roles are rejected
+	u.Roles = []string{"superuser"}
+	assert.Error(s.T(), u.Valid())
+}
+
+func (s *EntityUserTestSuite) TestUserDisabled() {
+	u, err := NewFactory().NewUser("hatsune@miku.com", "PASSWORD", newTestPasswordHasher(s.T()))
+	assert.NoError(s.T(), err)
+	assert.False(s.T(), u.Disabled())
+
+	disabledAt := time.Now()
+	u.Disable(disabledAt)
+	assert.True(s.T(), u.Disabled())
+
+	// disabling again keeps the first time
+	u.Disable(disabledAt.Add(time.Hour))
+	assert.Equal(s.T(), disabledAt, *u.DisabledAt)
+
+	u.Enable()
+	assert.False(s.T(), u.Disabled())
+}
+
+func (s *EntityUserTestSuite) TestUserPassword() {
+	for _, algorithm := range []string{crypt.AlgorithmArgon2id, crypt.AlgorithmBcrypt} {
+		hasher := newTestPasswordHasher(s.T(), crypt.WithAlgorithm(algorithm))
+
+		u, err := NewFactory().NewUser("hatsune@miku.com", "PASSWORD", hasher)
+		assert.NoError(s.T(), err)
+		assert.NoError(s.T(), u.ValidPassword(hasher, "PASSWORD"))
+		assert.ErrorIs(s.T(), u.ValidPassword(hasher, "WRONG-PASSWORD"), crypt.ErrPasswordMismatch)
+		assert.False(s.T(), u.PasswordNeedsRehash(hasher))
+
+		assert.NoError(s.T(), u.SetPassword(hasher, "NEW-PASSWORD"))
+		assert.NoError(s.T(), u.ValidPassword(hasher, "NEW-PASSWORD"))
+		assert.ErrorIs(s.T(), u.ValidPassword(hasher, "PASSWORD"), crypt.ErrPasswordMismatch)
+	}
+}
+
+func (s *EntityUserTestSuite) TestPasswordlessUser() {
+	hasher := newTestPasswordHasher(s.T())
+
+	u, err := NewFactory().NewPasswordlessUser("hatsune@miku.com")
+	assert.NoError(s.T(), err)
+	assert.NoError(s.T(), u.Valid())
+	assert.False(s.T(), u.HasPassword())
+	assert.False(s.T(), u.PasswordNeedsRehash(hasher))
+
+	// no password matches, not even an empty one
+	assert.ErrorIs(s.T(), u.ValidPassword(hasher, ""), crypt.ErrPasswordMismatch)
+
+	assert.NoError(s.T(), u.SetPassword(hasher, "PASSWORD"))
+	assert.True(s.T(), u.HasPassword())
+	assert.NoError(s.T(), u.ValidPassword(hasher, "PASSWORD"))
+}
+
+func (s *EntityUserTestSuite) TestUserPasswordPepper() {
+	u, err := NewFactory().NewUser("hatsune@miku.com", "PASSWORD", newTestPasswordHasher(s.T()))
+	assert.NoError(s.T(), err)
+
+	// the hash is useless without the pepper
+	other, err := crypt.NewPasswordHasher([]byte("ANOTHER-PEPPER"),
+		crypt.WithArgon2Params(crypt.Argon2Params{Time: 1, Memory: 1024, Threads: 1}))
+	assert.NoError(s.T(), err)
+	assert.ErrorIs(s.T(), u.ValidPassword(other, "PASSWORD"), crypt.ErrPasswordMismatch)
+}
+
+func (s *EntityUserTestSuite) TestUserPasswordNeedsRehash() {
+	hasher := newTestPasswordHasher(s.T())
+	u, err := NewFactory().NewUser("hatsune@miku.com", "PASSWORD", hasher)
+	assert.NoError(s.T(), err)
+
+	// stronger parameters
+	stronger := newTestPasswordHasher(s.T(), crypt.WithArgon2Params(crypt.Argon2Params{Time: 2, Memory: 1024, Threads: 1}))
+	assert.NoError(s.T(), u.ValidPassword(stronger, "PASSWORD"))
+	assert.True(s.T(), u.PasswordNeedsRehash(stronger))
+
+	// another algorithm
+	bcryptHasher := newTestPasswordHasher(s.T(), crypt.WithAlgorithm(crypt.AlgorithmBcrypt))
+	assert.NoError(s.T(), u.ValidPassword(bcryptHasher, "PASSWORD"))
+	assert.True(s.T(), u.PasswordNeedsRehash(bcryptHasher))
+
+	assert.NoError(s.T(), u.SetPassword(bcryptHasher, "PASSWORD"))
+	assert.True(s.T(), u.PasswordNeedsRehash(newTestPasswordHasher(s.T(),
+		crypt.WithAlgorithm(crypt.AlgorithmBcrypt), crypt.WithBcryptCost(bcrypt.MinCost+1))))
+}
+
+func (s *EntityUserTestSuite) TestUserLegacyPassword() {
+	hasher := newTestPasswordHasher(s.T())
+
+	// hashes stored before peppering are bcrypt of the password and the salt
+	legacy, err := bcrypt.GenerateFromPassword([]byte("PASSWORDSALT"), bcrypt.MinCost)
+	assert.NoError(s.T(), err)
+
+	u := &User{Password: string(legacy)}
+	assert.NoError(s.T(), u.ValidPassword(hasher, "PASSWORD"))
+	assert.ErrorIs(s.T(), u.ValidPassword(hasher, "WRONG-PASSWORD"), crypt.ErrPasswordMismatch)
+	assert.True(s.T(), u.PasswordNeedsRehash(hasher))
+}
+
 func TestEntityUser(t *testing.T) {
 	suite.Run(t, new(EntityUserTestSuite))
 }
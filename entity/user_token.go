@@ -0,0 +1,39 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/go-playground/validator/v10"
+)
+
+const (
+	UserTokenPurposePasswordReset     = "password_reset"
+	UserTokenPurposeEmailVerification = "email_verification"
+	UserTokenPurposeMFARecovery       = "mfa_recovery"
+	UserTokenPurposeMagicLink         = "magic_link"
+)
+
+// UserToken is a single-use token mailed to a user, only the hash of the token is kept.
+type UserToken struct {
+	ID        string `validate:"required,uuid4"`
+	UserID    string `validate:"required,uuid4"`
+	Purpose   string `validate:"required"`
+	TokenHash string `validate:"required"`
+	Used      bool
+	ExpiresAt time.Time `validate:"required"`
+	CreatedAt time.Time `validate:"required"`
+}
+
+func (t *UserToken) Valid() error {
+	err := validator.New().Struct(t)
+	if err != nil {
+		return err.(validator.ValidationErrors)
+	}
+
+	return nil
+}
+
+// Usable reports whether the token can still be consumed.
+func (t *UserToken) Usable(now time.Time) bool {
+	return !t.Used && now.Before(t.ExpiresAt)
+}
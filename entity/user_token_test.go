@@ -0,0 +1,50 @@
+package entity
+
+import (
+	"testing"
+	"time"
+
+	"github.com/org39/webapp-tutorial-backend/pkg/crypt"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type EntityUserTokenTestSuite struct {
+	suite.Suite
+}
+
+func (s *EntityUserTokenTestSuite) TestCreationValid() {
+	userID := "2192fc7b-bd9b-446d-a50e-5ce0ba02cee6"
+	token := "Dz8v2cQy3kq4d4D9D0ZbO0Xx2JzM0oR6x6bDq9k1lZc"
+
+	t, err := NewFactory().NewUserToken(userID, UserTokenPurposePasswordReset, token, time.Hour)
+	assert.NoError(s.T(), err)
+	assert.NoError(s.T(), t.Valid())
+	assert.True(s.T(), t.Usable(time.Now()))
+
+	// assert, plain token is never kept
+	assert.NotEqual(s.T(), token, t.TokenHash)
+	assert.Equal(s.T(), crypt.HashToken(token), t.TokenHash)
+}
+
+func (s *EntityUserTokenTestSuite) TestNotUsable() {
+	userID := "2192fc7b-bd9b-446d-a50e-5ce0ba02cee6"
+	token := "Dz8v2cQy3kq4d4D9D0ZbO0Xx2JzM0oR6x6bDq9k1lZc"
+
+	used, err := NewFactory().NewUserToken(userID, UserTokenPurposePasswordReset, token, time.Hour)
+	assert.NoError(s.T(), err)
+	used.Used = true
+
+	expired, err := NewFactory().NewUserToken(userID, UserTokenPurposePasswordReset, token, -time.Hour)
+	assert.NoError(s.T(), err)
+
+	cases := []*UserToken{used, expired}
+	for _, c := range cases {
+		assert.False(s.T(), c.Usable(time.Now()))
+	}
+}
+
+func TestEntityUserToken(t *testing.T) {
+	suite.Run(t, new(EntityUserTokenTestSuite))
+}
@@ -1,7 +1,41 @@
 package entity
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+	"unicode"
+
+	// time zones are validated against the embedded database, hosts may lack one
+	_ "time/tzdata"
+
 	"github.com/go-playground/validator/v10"
+	"golang.org/x/text/language"
+)
+
+const (
+	MaxDisplayNameLength = 64
+	MaxPreferencesSize   = 8 * 1024
+	MaxAvatarSize        = 1024 * 1024
+)
+
+var (
+	ErrInvalidDisplayName  = errors.New("invalid display name")
+	ErrInvalidTimeZone     = errors.New("invalid time zone")
+	ErrInvalidLocale       = errors.New("invalid locale")
+	ErrPreferencesTooLarge = errors.New("preferences too large")
+	ErrUnsupportedAvatar   = errors.New("unsupported avatar image")
+	ErrAvatarTooLarge      = errors.New("avatar too large")
+
+	// images browsers show everywhere, sniffed from the data rather than trusted from the client
+	avatarContentTypes = map[string]bool{
+		"image/png":  true,
+		"image/jpeg": true,
+		"image/gif":  true,
+		"image/webp": true,
+	}
 )
 
 type Validator struct{}
@@ -45,3 +79,76 @@ func (f *Validator) ValidateToken(token string) error {
 
 	return nil
 }
+
+// ValidateDisplayName accepts up to MaxDisplayNameLength characters without control characters, empty means unset.
+func (f *Validator) ValidateDisplayName(name string) error {
+	if err := validator.New().Var(name, fmt.Sprintf("max=%d", MaxDisplayNameLength)); err != nil {
+		return ErrInvalidDisplayName
+	}
+
+	for _, r := range name {
+		if unicode.IsControl(r) {
+			return ErrInvalidDisplayName
+		}
+	}
+
+	return nil
+}
+
+// ValidateTimeZone accepts IANA time zone names, e.g. Asia/Tokyo, empty means unset.
+func (f *Validator) ValidateTimeZone(tz string) error {
+	if tz == "" {
+		return nil
+	}
+
+	// Local is the zone of the server, not a name clients can rely on
+	if tz == "Local" {
+		return ErrInvalidTimeZone
+	}
+	if _, err := time.LoadLocation(tz); err != nil {
+		return ErrInvalidTimeZone
+	}
+
+	return nil
+}
+
+// ValidateLocale accepts well-formed BCP 47 language tags, e.g. ja-JP, empty means unset.
+func (f *Validator) ValidateLocale(locale string) error {
+	if locale == "" {
+		return nil
+	}
+
+	if _, err := language.Parse(locale); err != nil {
+		return ErrInvalidLocale
+	}
+
+	return nil
+}
+
+// ValidatePreferences accepts any document up to MaxPreferencesSize bytes of JSON.
+func (f *Validator) ValidatePreferences(preferences map[string]interface{}) error {
+	b, err := json.Marshal(preferences)
+	if err != nil {
+		return err
+	}
+
+	if len(b) > MaxPreferencesSize {
+		return ErrPreferencesTooLarge
+	}
+
+	return nil
+}
+
+// ValidateAvatar returns the content type of the image, or an error unless it is a small PNG, JPEG, GIF or WebP image.
+func (f *Validator) ValidateAvatar(image []byte) (string, error) {
+	if len(image) > MaxAvatarSize {
+		return "", ErrAvatarTooLarge
+	}
+
+	contentType := http.DetectContentType(image)
+	if !avatarContentTypes[contentType] {
+		return "", ErrUnsupportedAvatar
+	}
+
+	return contentType, nil
+}
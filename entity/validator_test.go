@@ -1,6 +1,7 @@
 package entity
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -120,6 +121,125 @@ func (s *EntityValidatorSuite) TestTokenFailure() {
 	}
 }
 
+func (s *EntityValidatorSuite) TestDisplayNameSuccess() {
+	cases := []struct {
+		name string
+	}{
+		{name: ""},
+		{name: "Miku"},
+		{name: "初音ミク"},
+		{name: strings.Repeat("あ", MaxDisplayNameLength)},
+	}
+
+	for _, c := range cases {
+		err := s.Validator.ValidateDisplayName(c.name)
+		assert.NoError(s.T(), err)
+	}
+}
+
+func (s *EntityValidatorSuite) TestDisplayNameFailure() {
+	cases := []struct {
+		name string
+	}{
+		{name: "Mi\nku"},
+		{name: "Mi\x00ku"},
+		{name: strings.Repeat("a", MaxDisplayNameLength+1)},
+	}
+
+	for _, c := range cases {
+		err := s.Validator.ValidateDisplayName(c.name)
+		assert.ErrorIs(s.T(), err, ErrInvalidDisplayName)
+	}
+}
+
+func (s *EntityValidatorSuite) TestTimeZoneSuccess() {
+	cases := []struct {
+		tz string
+	}{
+		{tz: ""},
+		{tz: "UTC"},
+		{tz: "Asia/Tokyo"},
+		{tz: "America/Argentina/Buenos_Aires"},
+	}
+
+	for _, c := range cases {
+		err := s.Validator.ValidateTimeZone(c.tz)
+		assert.NoError(s.T(), err)
+	}
+}
+
+func (s *EntityValidatorSuite) TestTimeZoneFailure() {
+	cases := []struct {
+		tz string
+	}{
+		{tz: "Local"},
+		{tz: "Asia/Nowhere"},
+		{tz: "../../etc/passwd"},
+	}
+
+	for _, c := range cases {
+		err := s.Validator.ValidateTimeZone(c.tz)
+		assert.ErrorIs(s.T(), err, ErrInvalidTimeZone)
+	}
+}
+
+func (s *EntityValidatorSuite) TestLocaleSuccess() {
+	cases := []struct {
+		locale string
+	}{
+		{locale: ""},
+		{locale: "ja"},
+		{locale: "ja-JP"},
+		{locale: "zh-Hant-TW"},
+	}
+
+	for _, c := range cases {
+		err := s.Validator.ValidateLocale(c.locale)
+		assert.NoError(s.T(), err)
+	}
+}
+
+func (s *EntityValidatorSuite) TestLocaleFailure() {
+	cases := []struct {
+		locale string
+	}{
+		{locale: "japanese-language"},
+		{locale: "ja_JP!"},
+	}
+
+	for _, c := range cases {
+		err := s.Validator.ValidateLocale(c.locale)
+		assert.ErrorIs(s.T(), err, ErrInvalidLocale)
+	}
+}
+
+func (s *EntityValidatorSuite) TestPreferences() {
+	// assert, small document
+	err := s.Validator.ValidatePreferences(map[string]interface{}{"default_sort": "created_at", "show_completed": true})
+	assert.NoError(s.T(), err)
+
+	// assert, too large document
+	err = s.Validator.ValidatePreferences(map[string]interface{}{"note": strings.Repeat("a", MaxPreferencesSize)})
+	assert.ErrorIs(s.T(), err, ErrPreferencesTooLarge)
+}
+
+func (s *EntityValidatorSuite) TestAvatar() {
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+	// assert, supported image
+	contentType, err := s.Validator.ValidateAvatar(png)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), "image/png", contentType)
+
+	// assert, not an image
+	_, err = s.Validator.ValidateAvatar([]byte("<svg xmlns=\"http://www.w3.org/2000/svg\"></svg>"))
+	assert.ErrorIs(s.T(), err, ErrUnsupportedAvatar)
+
+	// assert, too large image
+	_, err = s.Validator.ValidateAvatar(append(png, make([]byte, MaxAvatarSize)...))
+	assert.ErrorIs(s.T(), err, ErrAvatarTooLarge)
+}
+
 func TestEntityValidator(t *testing.T) {
 	suite.Run(t, new(EntityValidatorSuite))
 }
@@ -22,5 +22,6 @@ require (
 	github.com/stretchr/testify v1.7.0
 	go.opencensus.io v0.22.6
 	golang.org/x/crypto v0.0.0-20200820211705-5c72a883971a
+	golang.org/x/text v0.3.3
 	golang.org/x/xerrors v0.0.0-20200804184101-5ec99f83aff1 // indirect
 )
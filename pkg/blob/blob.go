@@ -0,0 +1,64 @@
+package blob
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	ErrUnknownDriver = errors.New("unknown blob driver")
+	ErrNotFound      = errors.New("blob not found")
+	ErrInvalidKey    = errors.New("invalid blob key")
+)
+
+const (
+	DriverLocal  = "local"
+	DriverMemory = "memory"
+)
+
+// Store keeps binary objects, e.g. avatars, by key.
+// Keys are slash separated paths of letters, digits, '-', '_' and '.'.
+type Store interface {
+	Put(ctx context.Context, key string, data []byte) error
+	Get(ctx context.Context, key string) ([]byte, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// New returns the Store for the driver, path is only used by the local driver.
+func New(driver string, path string) (Store, error) {
+	switch driver {
+	case DriverLocal:
+		return NewLocalStore(path)
+	case DriverMemory:
+		return NewMemoryStore(), nil
+	}
+
+	return nil, ErrUnknownDriver
+}
+
+func validKey(key string) bool {
+	if key == "" || key[0] == '/' || key[len(key)-1] == '/' {
+		return false
+	}
+
+	prev := rune(0)
+	for _, r := range key {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+		case r == '.':
+			// no "." or ".." path elements
+			if prev == 0 || prev == '/' || prev == '.' {
+				return false
+			}
+		case r == '/':
+			if prev == '/' {
+				return false
+			}
+		default:
+			return false
+		}
+		prev = r
+	}
+
+	return true
+}
@@ -0,0 +1,94 @@
+// Package breach tells whether passwords appear in a list of breached passwords.
+// The list is kept locally, in the k-anonymity range layout of Pwned Passwords,
+// so passwords, and even their hashes, never leave the server.
+package breach
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	ErrNotDirectory = errors.New("breached password path is not a directory")
+)
+
+const (
+	// hex characters of the SHA-1 hash naming the range file
+	prefixLength = 5
+	rangeFileExt = ".txt"
+)
+
+// Checker tells whether a password was seen in a breach.
+type Checker interface {
+	Breached(ctx context.Context, password string) (bool, error)
+}
+
+// New returns the Checker of the range files in dir, or one which knows no breach when dir is empty.
+func New(dir string) (Checker, error) {
+	if dir == "" {
+		return &NopChecker{}, nil
+	}
+
+	return NewRangeDirectory(dir)
+}
+
+// NopChecker knows no breach, for deployments without a list.
+type NopChecker struct{}
+
+func (NopChecker) Breached(ctx context.Context, password string) (bool, error) {
+	return false, nil
+}
+
+// RangeDirectory holds a file per SHA-1 prefix of 5 hex characters, e.g. 21BD1.txt, as written by the
+// Pwned Passwords downloader. Each line is the rest of a hash and how often it was seen, e.g. "2CFB...53F:4".
+type RangeDirectory struct {
+	dir string
+}
+
+func NewRangeDirectory(dir string) (*RangeDirectory, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, ErrNotDirectory
+	}
+
+	return &RangeDirectory{dir: dir}, nil
+}
+
+func (d *RangeDirectory) Breached(ctx context.Context, password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:prefixLength], hash[prefixLength:]
+
+	f, err := os.Open(filepath.Join(d.dir, prefix+rangeFileExt))
+	switch {
+	case os.IsNotExist(err):
+		// no password of the range was breached
+		return false, nil
+	case err != nil:
+		return false, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		i := strings.IndexByte(line, ':')
+		if i < 0 || !strings.EqualFold(line[:i], suffix) {
+			continue
+		}
+
+		// padded ranges list fake hashes seen 0 times
+		return strings.TrimLeft(line[i+1:], "0") != "", nil
+	}
+
+	return false, scanner.Err()
+}
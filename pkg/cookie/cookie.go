@@ -0,0 +1,133 @@
+package cookie
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var (
+	ErrUnknownSameSite = errors.New("unknown same site mode")
+	ErrInsecureNone    = errors.New("same site none requires secure cookies")
+)
+
+// Policy decides the attributes of a cookie, so every place setting or clearing it agrees.
+type Policy struct {
+	Secure   bool
+	HttpOnly bool
+	SameSite http.SameSite
+	Domain   string
+	Path     string
+	MaxAge   time.Duration
+}
+
+// New returns a policy for a host-only, HttpOnly, SameSite=Strict session cookie sent to every path.
+func New(options ...func(*Policy) error) (*Policy, error) {
+	p := &Policy{
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+		Path:     "/",
+	}
+
+	for _, option := range options {
+		if err := option(p); err != nil {
+			return nil, err
+		}
+	}
+
+	// browsers reject SameSite=None cookies without Secure
+	if p.SameSite == http.SameSiteNoneMode && !p.Secure {
+		return nil, ErrInsecureNone
+	}
+
+	return p, nil
+}
+
+func WithSecure(secure bool) func(*Policy) error {
+	return func(p *Policy) error {
+		p.Secure = secure
+		return nil
+	}
+}
+
+// WithHttpOnly false lets scripts of the page read the cookie.
+func WithHttpOnly(httpOnly bool) func(*Policy) error {
+	return func(p *Policy) error {
+		p.HttpOnly = httpOnly
+		return nil
+	}
+}
+
+// WithSameSite takes strict, lax or none.
+func WithSameSite(mode string) func(*Policy) error {
+	return func(p *Policy) error {
+		switch strings.ToLower(mode) {
+		case "strict":
+			p.SameSite = http.SameSiteStrictMode
+		case "lax":
+			p.SameSite = http.SameSiteLaxMode
+		case "none":
+			p.SameSite = http.SameSiteNoneMode
+		default:
+			return fmt.Errorf("%s: %w", mode, ErrUnknownSameSite)
+		}
+		return nil
+	}
+}
+
+// WithDomain shares the cookie with subdomains, empty keeps it to the host which set it.
+func WithDomain(domain string) func(*Policy) error {
+	return func(p *Policy) error {
+		p.Domain = domain
+		return nil
+	}
+}
+
+func WithPath(path string) func(*Policy) error {
+	return func(p *Policy) error {
+		p.Path = path
+		return nil
+	}
+}
+
+// WithMaxAge makes the cookie persistent, zero keeps it until the browser closes.
+func WithMaxAge(maxAge time.Duration) func(*Policy) error {
+	return func(p *Policy) error {
+		p.MaxAge = maxAge
+		return nil
+	}
+}
+
+// Cookie returns the named cookie carrying the value.
+func (p *Policy) Cookie(name string, value string) *http.Cookie {
+	c := p.base(name, value)
+	if p.MaxAge > 0 {
+		c.MaxAge = int(p.MaxAge.Seconds())
+		// for clients which do not know Max-Age
+		c.Expires = time.Now().Add(p.MaxAge).UTC()
+	}
+	return c
+}
+
+// Expired returns the named cookie telling the browser to delete it,
+// it has to match the path and domain the cookie was set with.
+func (p *Policy) Expired(name string) *http.Cookie {
+	c := p.base(name, "")
+	c.MaxAge = -1
+	c.Expires = time.Unix(0, 0).UTC()
+	return c
+}
+
+func (p *Policy) base(name string, value string) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     p.Path,
+		Domain:   p.Domain,
+		Secure:   p.Secure,
+		HttpOnly: p.HttpOnly,
+		SameSite: p.SameSite,
+	}
+}
@@ -1,18 +1,249 @@
 package crypt
 
 import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
 	"golang.org/x/crypto/bcrypt"
 )
 
-func Hash(password []byte) (string, error) {
-	hash, err := bcrypt.GenerateFromPassword(password, bcrypt.DefaultCost)
+const (
+	AlgorithmArgon2id = "argon2id"
+	AlgorithmBcrypt   = "bcrypt"
+
+	argon2SaltBytes = 16
+	argon2KeyBytes  = 32
+
+	// bcrypt hashes of the peppered password carry this prefix,
+	// bare bcrypt hashes are legacy hashes of the password and the salt.
+	bcryptHMACPrefix = "$bcrypt-hmac"
+)
+
+var (
+	ErrPasswordMismatch  = errors.New("password mismatch")
+	ErrUnknownHashFormat = errors.New("unknown password hash format")
+	ErrUnknownAlgorithm  = errors.New("unknown password hash algorithm")
+	ErrEmptyPepper       = errors.New("empty password pepper")
+)
+
+// Argon2Params are the cost parameters of Argon2id, Memory is in KiB.
+type Argon2Params struct {
+	Time    uint32
+	Memory  uint32
+	Threads uint8
+}
+
+// PasswordHasher hashes passwords in a self-describing format, so the algorithm and
+// its parameters can change while hashes made with earlier settings keep verifying.
+//
+//	$argon2id$v=19$m=65536,t=3,p=4$<salt>$<key>
+//	$bcrypt-hmac$2a$12$<salt and hash>
+//
+// Passwords are keyed with HMAC-SHA256 and the pepper before hashing,
+// the pepper is kept out of the database so a leaked table alone can not be cracked.
+type PasswordHasher struct {
+	algorithm  string
+	argon2     Argon2Params
+	bcryptCost int
+	pepper     []byte
+	legacySalt string
+}
+
+// NewPasswordHasher returns a hasher using Argon2id with the parameters recommended by RFC 9106.
+func NewPasswordHasher(pepper []byte, options ...func(*PasswordHasher) error) (*PasswordHasher, error) {
+	if len(pepper) == 0 {
+		return nil, ErrEmptyPepper
+	}
+
+	h := &PasswordHasher{
+		algorithm:  AlgorithmArgon2id,
+		argon2:     Argon2Params{Time: 3, Memory: 64 * 1024, Threads: 4},
+		bcryptCost: 12,
+		pepper:     pepper,
+	}
+
+	for _, option := range options {
+		if err := option(h); err != nil {
+			return nil, err
+		}
+	}
+
+	return h, nil
+}
+
+func WithAlgorithm(algorithm string) func(*PasswordHasher) error {
+	return func(h *PasswordHasher) error {
+		switch algorithm {
+		case AlgorithmArgon2id, AlgorithmBcrypt:
+			h.algorithm = algorithm
+			return nil
+		default:
+			return fmt.Errorf("%s: %w", algorithm, ErrUnknownAlgorithm)
+		}
+	}
+}
+
+func WithArgon2Params(p Argon2Params) func(*PasswordHasher) error {
+	return func(h *PasswordHasher) error {
+		if p.Time < 1 || p.Threads < 1 || p.Memory < 8*uint32(p.Threads) {
+			return fmt.Errorf("invalid argon2 parameters m=%d,t=%d,p=%d", p.Memory, p.Time, p.Threads)
+		}
+		h.argon2 = p
+		return nil
+	}
+}
+
+func WithBcryptCost(cost int) func(*PasswordHasher) error {
+	return func(h *PasswordHasher) error {
+		if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+			return fmt.Errorf("invalid bcrypt cost %d", cost)
+		}
+		h.bcryptCost = cost
+		return nil
+	}
+}
+
+// WithLegacySalt sets the salt appended to the password by legacy bare bcrypt hashes.
+func WithLegacySalt(salt string) func(*PasswordHasher) error {
+	return func(h *PasswordHasher) error {
+		h.legacySalt = salt
+		return nil
+	}
+}
+
+// Hash hashes the password with the configured algorithm and parameters.
+func (h *PasswordHasher) Hash(password []byte) (string, error) {
+	switch h.algorithm {
+	case AlgorithmArgon2id:
+		salt := make([]byte, argon2SaltBytes)
+		if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+			return "", err
+		}
+
+		key := argon2.IDKey(h.mac(password), salt, h.argon2.Time, h.argon2.Memory, h.argon2.Threads, argon2KeyBytes)
+		return fmt.Sprintf("$%s$v=%d$m=%d,t=%d,p=%d$%s$%s", AlgorithmArgon2id, argon2.Version,
+			h.argon2.Memory, h.argon2.Time, h.argon2.Threads,
+			base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key),
+		), nil
+	case AlgorithmBcrypt:
+		// the encoded digest stays below the 72 bytes bcrypt reads and has no NUL bytes
+		hash, err := bcrypt.GenerateFromPassword([]byte(base64.StdEncoding.EncodeToString(h.mac(password))), h.bcryptCost)
+		if err != nil {
+			return "", err
+		}
+		return bcryptHMACPrefix + string(hash), nil
+	default:
+		return "", fmt.Errorf("%s: %w", h.algorithm, ErrUnknownAlgorithm)
+	}
+}
+
+// Compare returns ErrPasswordMismatch unless the password matches the hash,
+// whatever algorithm and parameters the hash was made with.
+func (h *PasswordHasher) Compare(hashed string, password []byte) error {
+	switch {
+	case strings.HasPrefix(hashed, "$"+AlgorithmArgon2id+"$"):
+		p, version, salt, key, err := parseArgon2Hash(hashed)
+		if err != nil {
+			return err
+		}
+		if version != argon2.Version {
+			return fmt.Errorf("argon2 version %d: %w", version, ErrUnknownHashFormat)
+		}
+
+		other := argon2.IDKey(h.mac(password), salt, p.Time, p.Memory, p.Threads, uint32(len(key)))
+		if subtle.ConstantTimeCompare(key, other) != 1 {
+			return ErrPasswordMismatch
+		}
+		return nil
+	case strings.HasPrefix(hashed, bcryptHMACPrefix+"$"):
+		return compareBcrypt(strings.TrimPrefix(hashed, bcryptHMACPrefix), []byte(base64.StdEncoding.EncodeToString(h.mac(password))))
+	case isBcryptHash(hashed):
+		return compareBcrypt(hashed, []byte(string(password)+h.legacySalt))
+	default:
+		return ErrUnknownHashFormat
+	}
+}
+
+// NeedsRehash reports whether the hash was made with another algorithm or other parameters
+// than the configured ones, it should be replaced once the password is known to match.
+func (h *PasswordHasher) NeedsRehash(hashed string) bool {
+	switch {
+	case strings.HasPrefix(hashed, "$"+AlgorithmArgon2id+"$"):
+		if h.algorithm != AlgorithmArgon2id {
+			return true
+		}
+		p, version, _, key, err := parseArgon2Hash(hashed)
+		return err != nil || version != argon2.Version || p != h.argon2 || len(key) != argon2KeyBytes
+	case strings.HasPrefix(hashed, bcryptHMACPrefix+"$"):
+		if h.algorithm != AlgorithmBcrypt {
+			return true
+		}
+		cost, err := bcrypt.Cost([]byte(strings.TrimPrefix(hashed, bcryptHMACPrefix)))
+		return err != nil || cost != h.bcryptCost
+	default:
+		// legacy hashes are not peppered
+		return true
+	}
+}
+
+func (h *PasswordHasher) mac(password []byte) []byte {
+	m := hmac.New(sha256.New, h.pepper)
+	m.Write(password)
+	return m.Sum(nil)
+}
+
+func parseArgon2Hash(hashed string) (Argon2Params, int, []byte, []byte, error) {
+	var p Argon2Params
+	var version int
+
+	// "", "argon2id", "v=19", "m=65536,t=3,p=4", salt, key
+	parts := strings.Split(hashed, "$")
+	if len(parts) != 6 {
+		return p, 0, nil, nil, ErrUnknownHashFormat
+	}
+
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return p, 0, nil, nil, fmt.Errorf("%s: %w", err, ErrUnknownHashFormat)
+	}
+
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Time, &p.Threads); err != nil {
+		return p, 0, nil, nil, fmt.Errorf("%s: %w", err, ErrUnknownHashFormat)
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
 	if err != nil {
-		return "", err
+		return p, 0, nil, nil, fmt.Errorf("%s: %w", err, ErrUnknownHashFormat)
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return p, 0, nil, nil, fmt.Errorf("invalid key: %w", ErrUnknownHashFormat)
 	}
 
-	return string(hash), nil
+	return p, version, salt, key, nil
 }
 
-func Compare(hashed string, plain []byte) error {
-	return bcrypt.CompareHashAndPassword([]byte(hashed), plain)
+func isBcryptHash(hashed string) bool {
+	for _, prefix := range []string{"$2a$", "$2b$", "$2y$"} {
+		if strings.HasPrefix(hashed, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func compareBcrypt(hashed string, password []byte) error {
+	err := bcrypt.CompareHashAndPassword([]byte(hashed), password)
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return ErrPasswordMismatch
+	}
+	return err
 }
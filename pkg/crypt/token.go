@@ -0,0 +1,30 @@
+package crypt
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+)
+
+const (
+	tokenBytes = 32
+)
+
+// NewToken generates a random url safe token, suitable for one-time links sent by mail.
+func NewToken() (string, error) {
+	b := make([]byte, tokenBytes)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashToken returns the hex encoded SHA-256 digest of the token.
+// Tokens have enough entropy to be stored with a fast hash, unlike passwords.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,190 @@
+package jwk
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"math/big"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+const (
+	AlgorithmRS256 = "RS256"
+	AlgorithmEdDSA = "EdDSA"
+)
+
+var (
+	ErrInvalidKey     = errors.New("invalid key")
+	ErrUnsupportedKey = errors.New("unsupported key type")
+)
+
+// Key is a named asymmetric key, PrivateKey is nil for verification only keys
+type Key struct {
+	ID         string
+	Algorithm  string
+	PrivateKey crypto.Signer
+	PublicKey  crypto.PublicKey
+}
+
+// PublicJWK is the public part of a key, in RFC 7517 JSON Web Key format
+type PublicJWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// LoadPrivateKey read PKCS#1 or PKCS#8 PEM encoded private key from path
+func LoadPrivateKey(id string, path string) (*Key, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var parsed interface{}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("%s: PEM block %s: %w", path, block.Type, ErrUnsupportedKey)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s: %w", path, err, ErrInvalidKey)
+	}
+
+	return NewPrivateKey(id, parsed)
+}
+
+// LoadPublicKey read PKIX or PKCS#1 PEM encoded public key from path
+func LoadPublicKey(id string, path string) (*Key, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var parsed interface{}
+	switch block.Type {
+	case "RSA PUBLIC KEY":
+		parsed, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("%s: PEM block %s: %w", path, block.Type, ErrUnsupportedKey)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s: %w", path, err, ErrInvalidKey)
+	}
+
+	return NewPublicKey(id, parsed)
+}
+
+func NewPrivateKey(id string, key interface{}) (*Key, error) {
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return &Key{ID: id, Algorithm: AlgorithmRS256, PrivateKey: k, PublicKey: &k.PublicKey}, nil
+	case ed25519.PrivateKey:
+		return &Key{ID: id, Algorithm: AlgorithmEdDSA, PrivateKey: k, PublicKey: k.Public()}, nil
+	}
+
+	return nil, fmt.Errorf("%T: %w", key, ErrUnsupportedKey)
+}
+
+func NewPublicKey(id string, key interface{}) (*Key, error) {
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		return &Key{ID: id, Algorithm: AlgorithmRS256, PublicKey: k}, nil
+	case ed25519.PublicKey:
+		return &Key{ID: id, Algorithm: AlgorithmEdDSA, PublicKey: k}, nil
+	}
+
+	return nil, fmt.Errorf("%T: %w", key, ErrUnsupportedKey)
+}
+
+// Public strip private part of the key
+func (k *Key) Public() *Key {
+	return &Key{ID: k.ID, Algorithm: k.Algorithm, PublicKey: k.PublicKey}
+}
+
+func (k *Key) SigningMethod() jwt.SigningMethod {
+	return jwt.GetSigningMethod(k.Algorithm)
+}
+
+func (k *Key) PublicJWK() *PublicJWK {
+	j := &PublicJWK{
+		Use: "sig",
+		Alg: k.Algorithm,
+		Kid: k.ID,
+	}
+
+	switch pub := k.PublicKey.(type) {
+	case *rsa.PublicKey:
+		j.Kty = "RSA"
+		j.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+		j.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+	case ed25519.PublicKey:
+		j.Kty = "OKP"
+		j.Crv = "Ed25519"
+		j.X = base64.RawURLEncoding.EncodeToString(pub)
+	}
+
+	return j
+}
+
+// Key parses the public key, e.g. a key published by another issuer
+func (j *PublicJWK) Key() (*Key, error) {
+	switch j.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(j.N)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s: %w", j.Kid, err, ErrInvalidKey)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(j.E)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s: %w", j.Kid, err, ErrInvalidKey)
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if len(n) == 0 || !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > math.MaxInt32 {
+			return nil, fmt.Errorf("%s: %w", j.Kid, ErrInvalidKey)
+		}
+		return NewPublicKey(j.Kid, &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())})
+	case "OKP":
+		if j.Crv != "Ed25519" {
+			return nil, fmt.Errorf("%s: curve %s: %w", j.Kid, j.Crv, ErrUnsupportedKey)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(j.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("%s: %w", j.Kid, ErrInvalidKey)
+		}
+		return NewPublicKey(j.Kid, ed25519.PublicKey(x))
+	}
+
+	return nil, fmt.Errorf("%s: key type %s: %w", j.Kid, j.Kty, ErrUnsupportedKey)
+}
+
+func readPEM(path string) (*pem.Block, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data found: %w", path, ErrInvalidKey)
+	}
+
+	return block, nil
+}
@@ -0,0 +1,41 @@
+package jwk
+
+// KeySet hold the key used to sign new tokens and every key still accepted for verification.
+// Keeping retired keys in Verification allows rotation without invalidating issued tokens.
+type KeySet struct {
+	Signing      *Key
+	Verification []*Key
+}
+
+func NewKeySet(signing *Key, verification ...*Key) *KeySet {
+	ks := &KeySet{
+		Signing:      signing,
+		Verification: []*Key{},
+	}
+
+	if signing != nil {
+		ks.Verification = append(ks.Verification, signing.Public())
+	}
+	for _, k := range verification {
+		ks.Verification = append(ks.Verification, k.Public())
+	}
+
+	return ks
+}
+
+// Lookup find verification key by kid
+func (ks *KeySet) Lookup(kid string) (*Key, bool) {
+	for _, k := range ks.Verification {
+		if k.ID == kid {
+			return k, true
+		}
+	}
+	return nil, false
+}
+
+// Public list every public verification key
+func (ks *KeySet) Public() []*Key {
+	keys := make([]*Key, len(ks.Verification))
+	copy(keys, ks.Verification)
+	return keys
+}
@@ -0,0 +1,49 @@
+package mail
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+	"time"
+)
+
+var (
+	ErrEmptyPath = errors.New("empty mail file path")
+)
+
+// FileMailer appends messages to a file, one JSON document per line.
+type FileMailer struct {
+	path string
+	mu   sync.Mutex
+}
+
+func NewFileMailer(path string) (*FileMailer, error) {
+	if path == "" {
+		return nil, ErrEmptyPath
+	}
+
+	return &FileMailer{path: path}, nil
+}
+
+func (m *FileMailer) Send(ctx context.Context, msg *Message) error {
+	msg.SentAt = time.Now()
+
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, err := os.OpenFile(m.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(b, '\n'))
+	return err
+}
@@ -0,0 +1,26 @@
+package mail
+
+import (
+	"context"
+	"time"
+
+	"github.com/org39/webapp-tutorial-backend/pkg/log"
+)
+
+// LogMailer writes messages to the application log, for local development.
+type LogMailer struct{}
+
+func NewLogMailer() *LogMailer {
+	return &LogMailer{}
+}
+
+func (m *LogMailer) Send(ctx context.Context, msg *Message) error {
+	msg.SentAt = time.Now()
+
+	log.LoggerWithSpan(ctx).
+		WithField("to", msg.To).
+		WithField("subject", msg.Subject).
+		WithField("body", msg.Body).
+		Info("mail sent")
+	return nil
+}
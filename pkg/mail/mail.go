@@ -0,0 +1,51 @@
+package mail
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	ErrUnknownDriver = errors.New("unknown mail driver")
+)
+
+const (
+	DriverLog    = "log"
+	DriverFile   = "file"
+	DriverMemory = "memory"
+)
+
+type Message struct {
+	To      string    `json:"to"`
+	Subject string    `json:"subject"`
+	Body    string    `json:"body"`
+	SentAt  time.Time `json:"sent_at"`
+}
+
+func NewMessage(to string, subject string, body string) *Message {
+	return &Message{
+		To:      to,
+		Subject: subject,
+		Body:    body,
+	}
+}
+
+// Mailer delivers messages to users.
+type Mailer interface {
+	Send(ctx context.Context, m *Message) error
+}
+
+// New returns the Mailer for the driver, path is only used by the file driver.
+func New(driver string, path string) (Mailer, error) {
+	switch driver {
+	case DriverLog:
+		return NewLogMailer(), nil
+	case DriverFile:
+		return NewFileMailer(path)
+	case DriverMemory:
+		return NewMemoryMailer(), nil
+	}
+
+	return nil, ErrUnknownDriver
+}
@@ -0,0 +1,390 @@
+package oidc
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/org39/webapp-tutorial-backend/pkg/jwk"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+const (
+	discoveryPath = "/.well-known/openid-configuration"
+	// clock skew tolerated between the provider and us
+	leeway = time.Minute
+	// unknown key ids trigger a refetch of the provider keys, at most this often
+	keysRefreshInterval = time.Minute
+	// responses of the provider are small, anything larger is not trusted
+	maxResponseBytes = 1 << 20
+)
+
+var (
+	ErrDiscovery      = errors.New("oidc discovery failed")
+	ErrInvalidGrant   = errors.New("authorization code rejected")
+	ErrInvalidIDToken = errors.New("invalid id token")
+)
+
+// Discovery is the provider metadata used by a relying party
+type Discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Identity is the end-user authenticated by the provider
+type Identity struct {
+	Issuer        string
+	Subject       string
+	Email         string
+	EmailVerified bool
+}
+
+// Provider is an OpenID Connect provider, used with the authorization code flow and PKCE.
+// The metadata and keys of the provider are fetched on first use.
+type Provider struct {
+	issuer       string
+	clientID     string
+	clientSecret string
+	redirectURL  string
+	scopes       []string
+	client       *http.Client
+
+	mu            sync.Mutex
+	discovery     *Discovery
+	keys          map[string]*jwk.Key
+	keysFetchedAt time.Time
+}
+
+func NewProvider(issuer string, clientID string, clientSecret string, redirectURL string, options ...func(*Provider) error) (*Provider, error) {
+	if issuer == "" || clientID == "" || redirectURL == "" {
+		return nil, errors.New("issuer, client id and redirect url are required")
+	}
+
+	p := &Provider{
+		issuer:       strings.TrimSuffix(issuer, "/"),
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		redirectURL:  redirectURL,
+		scopes:       []string{"openid", "email"},
+		client:       &http.Client{Timeout: 10 * time.Second},
+		keys:         map[string]*jwk.Key{},
+	}
+
+	for _, option := range options {
+		if err := option(p); err != nil {
+			return nil, err
+		}
+	}
+
+	return p, nil
+}
+
+func WithScopes(scopes ...string) func(*Provider) error {
+	return func(p *Provider) error {
+		p.scopes = append([]string{"openid"}, scopes...)
+		return nil
+	}
+}
+
+func WithHTTPClient(c *http.Client) func(*Provider) error {
+	return func(p *Provider) error {
+		p.client = c
+		return nil
+	}
+}
+
+// CodeChallenge returns the S256 PKCE challenge of the verifier
+func CodeChallenge(codeVerifier string) string {
+	sum := sha256.Sum256([]byte(codeVerifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// AuthCodeURL returns the authorization endpoint the user agent is sent to
+func (p *Provider) AuthCodeURL(ctx context.Context, state string, nonce string, codeVerifier string) (string, error) {
+	d, err := p.fetchDiscovery(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	u, err := url.Parse(d.AuthorizationEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", err, ErrDiscovery)
+	}
+
+	q := u.Query()
+	q.Set("response_type", "code")
+	q.Set("client_id", p.clientID)
+	q.Set("redirect_uri", p.redirectURL)
+	q.Set("scope", strings.Join(p.scopes, " "))
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	q.Set("code_challenge", CodeChallenge(codeVerifier))
+	q.Set("code_challenge_method", "S256")
+	u.RawQuery = q.Encode()
+
+	return u.String(), nil
+}
+
+// Identify exchanges the authorization code and returns the end-user of the verified id token
+func (p *Provider) Identify(ctx context.Context, code string, codeVerifier string, nonce string) (*Identity, error) {
+	d, err := p.fetchDiscovery(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rawIDToken, err := p.exchange(ctx, d, code, codeVerifier)
+	if err != nil {
+		return nil, err
+	}
+
+	claims, err := p.verifyIDToken(ctx, d, rawIDToken, nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Identity{
+		Issuer:        claims.Issuer,
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified,
+	}, nil
+}
+
+func (p *Provider) fetchDiscovery(ctx context.Context) (*Discovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	d := &Discovery{}
+	if err := p.getJSON(ctx, p.issuer+discoveryPath, d); err != nil {
+		return nil, fmt.Errorf("%s: %w", err, ErrDiscovery)
+	}
+
+	// the issuer must be the one we asked, see OpenID Connect Discovery 4.3
+	if strings.TrimSuffix(d.Issuer, "/") != p.issuer {
+		return nil, fmt.Errorf("issuer %s: %w", d.Issuer, ErrDiscovery)
+	}
+	if d.AuthorizationEndpoint == "" || d.TokenEndpoint == "" || d.JWKSURI == "" {
+		return nil, fmt.Errorf("incomplete metadata: %w", ErrDiscovery)
+	}
+
+	p.discovery = d
+	return d, nil
+}
+
+type tokenResponse struct {
+	IDToken          string `json:"id_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+func (p *Provider) exchange(ctx context.Context, d *Discovery, code string, codeVerifier string) (string, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.redirectURL)
+	form.Set("code_verifier", codeVerifier)
+	form.Set("client_id", p.clientID)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.clientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.clientID), url.QueryEscape(p.clientSecret))
+	}
+
+	res, err := p.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	body := &tokenResponse{}
+	if err := json.NewDecoder(io.LimitReader(res.Body, maxResponseBytes)).Decode(body); err != nil {
+		return "", fmt.Errorf("token endpoint status %d: %s", res.StatusCode, err)
+	}
+
+	switch {
+	case res.StatusCode == http.StatusBadRequest && body.Error == "invalid_grant":
+		return "", fmt.Errorf("%s: %w", body.ErrorDescription, ErrInvalidGrant)
+	case res.StatusCode != http.StatusOK:
+		return "", fmt.Errorf("token endpoint status %d: %s %s", res.StatusCode, body.Error, body.ErrorDescription)
+	case body.IDToken == "":
+		return "", fmt.Errorf("no id token: %w", ErrInvalidIDToken)
+	}
+
+	return body.IDToken, nil
+}
+
+// audience is a single audience or a list of them
+type audience []string
+
+func (a *audience) UnmarshalJSON(b []byte) error {
+	var single string
+	if err := json.Unmarshal(b, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+
+	var list []string
+	if err := json.Unmarshal(b, &list); err != nil {
+		return err
+	}
+	*a = list
+	return nil
+}
+
+func (a audience) contains(s string) bool {
+	for _, v := range a {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+type idTokenClaims struct {
+	Issuer          string   `json:"iss"`
+	Subject         string   `json:"sub"`
+	Audience        audience `json:"aud"`
+	AuthorizedParty string   `json:"azp"`
+	ExpiresAt       int64    `json:"exp"`
+	IssuedAt        int64    `json:"iat"`
+	Nonce           string   `json:"nonce"`
+	Email           string   `json:"email"`
+	EmailVerified   bool     `json:"email_verified"`
+}
+
+func (c *idTokenClaims) Valid() error {
+	now := time.Now()
+	if c.ExpiresAt == 0 || now.After(time.Unix(c.ExpiresAt, 0).Add(leeway)) {
+		return errors.New("token is expired")
+	}
+	if now.Add(leeway).Before(time.Unix(c.IssuedAt, 0)) {
+		return errors.New("token used before issued")
+	}
+	return nil
+}
+
+// verifyIDToken checks the id token as required by OpenID Connect Core 3.1.3.7
+func (p *Provider) verifyIDToken(ctx context.Context, d *Discovery, rawIDToken string, nonce string) (*idTokenClaims, error) {
+	claims := &idTokenClaims{}
+	_, err := jwt.ParseWithClaims(rawIDToken, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		key, err := p.lookupKey(ctx, d, kid)
+		if err != nil {
+			return nil, err
+		}
+
+		// the algorithm is the one of the key, never the one claimed by the token
+		if t.Method.Alg() != key.Algorithm {
+			return nil, fmt.Errorf("unexpected signing method %s", t.Method.Alg())
+		}
+		return key.PublicKey, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", err, ErrInvalidIDToken)
+	}
+
+	switch {
+	case claims.Issuer != d.Issuer:
+		return nil, fmt.Errorf("issuer %s: %w", claims.Issuer, ErrInvalidIDToken)
+	case !claims.Audience.contains(p.clientID):
+		return nil, fmt.Errorf("audience %v: %w", claims.Audience, ErrInvalidIDToken)
+	case len(claims.Audience) > 1 && claims.AuthorizedParty != p.clientID:
+		return nil, fmt.Errorf("authorized party %s: %w", claims.AuthorizedParty, ErrInvalidIDToken)
+	case subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1:
+		return nil, fmt.Errorf("nonce mismatch: %w", ErrInvalidIDToken)
+	case claims.Subject == "":
+		return nil, fmt.Errorf("no subject: %w", ErrInvalidIDToken)
+	}
+
+	return claims, nil
+}
+
+func (p *Provider) lookupKey(ctx context.Context, d *Discovery, kid string) (*jwk.Key, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if k, ok := p.keys[kid]; ok {
+		return k, nil
+	}
+
+	// keys are rotated by the provider, refetch them for an unknown key id
+	if time.Since(p.keysFetchedAt) < keysRefreshInterval {
+		return nil, fmt.Errorf("unknown key id %s", kid)
+	}
+
+	set := &struct {
+		Keys []*jwk.PublicJWK `json:"keys"`
+	}{}
+	if err := p.getJSON(ctx, d.JWKSURI, set); err != nil {
+		return nil, err
+	}
+
+	keys := map[string]*jwk.Key{}
+	for _, j := range set.Keys {
+		if j.Use != "" && j.Use != "sig" {
+			continue
+		}
+		k, err := j.Key()
+		if err != nil {
+			// keys we do not support are not used to sign our tokens
+			continue
+		}
+		if j.Alg != "" && j.Alg != k.Algorithm {
+			continue
+		}
+		keys[j.Kid] = k
+	}
+	p.keys = keys
+	p.keysFetchedAt = time.Now()
+
+	k, ok := p.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key id %s", kid)
+	}
+	return k, nil
+}
+
+func (p *Provider) getJSON(ctx context.Context, endpoint string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	res, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		// drain, so the connection can be reused
+		_, _ = io.Copy(ioutil.Discard, io.LimitReader(res.Body, maxResponseBytes))
+		return fmt.Errorf("%s: status %d", endpoint, res.StatusCode)
+	}
+
+	return json.NewDecoder(io.LimitReader(res.Body, maxResponseBytes)).Decode(v)
+}
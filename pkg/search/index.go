@@ -0,0 +1,126 @@
+package search
+
+import (
+	"math"
+	"sort"
+	"sync"
+)
+
+const (
+	// BM25 parameters, term frequency saturation and length normalization
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// Hit is a document matching a search, a higher score is more relevant.
+type Hit struct {
+	ID    string
+	Score float64
+}
+
+// Index is an inverted index of documents kept in memory.
+type Index struct {
+	mu sync.RWMutex
+	// term -> document -> occurrences
+	postings map[string]map[string]int
+	// document -> its indexed words, with duplicates
+	words       map[string][]string
+	totalLength int
+}
+
+func NewIndex() *Index {
+	return &Index{
+		postings: map[string]map[string]int{},
+		words:    map[string][]string{},
+	}
+}
+
+// Add indexes the text of the document, replacing what was indexed for it.
+func (x *Index) Add(id string, text string) {
+	words := Tokenize(text)
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	x.remove(id)
+	for _, w := range words {
+		docs, ok := x.postings[w]
+		if !ok {
+			docs = map[string]int{}
+			x.postings[w] = docs
+		}
+		docs[id]++
+	}
+	x.words[id] = words
+	x.totalLength += len(words)
+}
+
+// Remove forgets the document, removing a missing document is not an error.
+func (x *Index) Remove(id string) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	x.remove(id)
+}
+
+func (x *Index) remove(id string) {
+	words, ok := x.words[id]
+	if !ok {
+		return
+	}
+
+	for _, w := range words {
+		docs := x.postings[w]
+		delete(docs, id)
+		if len(docs) == 0 {
+			delete(x.postings, w)
+		}
+	}
+	delete(x.words, id)
+	x.totalLength -= len(words)
+}
+
+// Search returns the documents containing any of the terms, the most relevant first.
+// Terms are words returned by Tokenize.
+func (x *Index) Search(terms []string) []Hit {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	if len(x.words) == 0 {
+		return []Hit{}
+	}
+	n := float64(len(x.words))
+	avgLength := float64(x.totalLength) / n
+
+	scores := map[string]float64{}
+	seen := map[string]bool{}
+	for _, t := range terms {
+		// repeating a word in the query does not make it weigh more
+		if seen[t] {
+			continue
+		}
+		seen[t] = true
+
+		docs := x.postings[t]
+		idf := math.Log(1 + (n-float64(len(docs))+0.5)/(float64(len(docs))+0.5))
+		for id, freq := range docs {
+			tf := float64(freq)
+			norm := 1 - bm25B + bm25B*float64(len(x.words[id]))/avgLength
+			scores[id] += idf * tf * (bm25K1 + 1) / (tf + bm25K1*norm)
+		}
+	}
+
+	hits := make([]Hit, 0, len(scores))
+	for id, score := range scores {
+		hits = append(hits, Hit{ID: id, Score: score})
+	}
+	// ties are broken by id, so results are stable
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].ID < hits[j].ID
+	})
+
+	return hits
+}
@@ -0,0 +1,68 @@
+// Package search splits text into words like MySQL's full-text parser, keeps an in-memory inverted index of
+// documents ranked with BM25, and cuts highlighted snippets of the words found.
+package search
+
+import (
+	"strings"
+	"unicode"
+)
+
+const (
+	// words shorter or longer are not indexed, like innodb_ft_min_token_size and innodb_ft_max_token_size
+	MinTokenLength = 3
+	MaxTokenLength = 84
+)
+
+// stopwords are not indexed, this is the default list of InnoDB
+var stopwords = map[string]bool{
+	"a": true, "about": true, "an": true, "are": true, "as": true, "at": true, "be": true, "by": true,
+	"com": true, "de": true, "en": true, "for": true, "from": true, "how": true, "i": true, "in": true,
+	"is": true, "it": true, "la": true, "of": true, "on": true, "or": true, "that": true, "the": true,
+	"this": true, "to": true, "was": true, "what": true, "when": true, "where": true, "who": true,
+	"will": true, "with": true, "und": true, "www": true,
+}
+
+// token is a word of a text, start and end are rune offsets
+type token struct {
+	word       string
+	start, end int
+}
+
+// Tokenize returns the lower case words of the text which are indexed, in order and with duplicates.
+// Words are runs of letters, digits and '_'.
+func Tokenize(text string) []string {
+	toks := tokenize([]rune(text))
+	words := make([]string, len(toks))
+	for i, t := range toks {
+		words[i] = t.word
+	}
+
+	return words
+}
+
+func tokenize(runes []rune) []token {
+	toks := []token{}
+	for i := 0; i < len(runes); {
+		if !isWordRune(runes[i]) {
+			i++
+			continue
+		}
+
+		j := i
+		for j < len(runes) && isWordRune(runes[j]) {
+			j++
+		}
+
+		word := strings.ToLower(string(runes[i:j]))
+		if l := j - i; l >= MinTokenLength && l <= MaxTokenLength && !stopwords[word] {
+			toks = append(toks, token{word: word, start: i, end: j})
+		}
+		i = j
+	}
+
+	return toks
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
@@ -0,0 +1,85 @@
+package search
+
+import (
+	"html"
+	"strings"
+)
+
+const (
+	highlightStart = "<mark>"
+	highlightEnd   = "</mark>"
+	ellipsis       = "…"
+
+	// a snippet starts this share of its length before the first word found
+	snippetLead = 4
+)
+
+// Snippet returns at most maxLength runes of the text around the first of the terms, with an ellipsis
+// where it was cut. The snippet is HTML escaped and the terms are wrapped in <mark></mark>.
+func Snippet(text string, terms []string, maxLength int) string {
+	runes := []rune(text)
+	termSet := make(map[string]bool, len(terms))
+	for _, t := range terms {
+		termSet[t] = true
+	}
+
+	found := []token{}
+	for _, t := range tokenize(runes) {
+		if termSet[t.word] {
+			found = append(found, t)
+		}
+	}
+
+	start := 0
+	if len(found) > 0 && len(runes) > maxLength {
+		start = found[0].start - maxLength/snippetLead
+		if start < 0 {
+			start = 0
+		}
+		// keep the end of the text in the snippet when it is near
+		if start+maxLength > len(runes) {
+			start = len(runes) - maxLength
+		}
+		// do not cut a word in front
+		for start > 0 && start < found[0].start && isWordRune(runes[start-1]) {
+			start++
+		}
+	}
+
+	end := start + maxLength
+	if end >= len(runes) {
+		end = len(runes)
+	} else {
+		// nor at the end, unless the word is longer than the snippet
+		for cut := end; cut > start && isWordRune(runes[cut-1]) && isWordRune(runes[cut]); cut-- {
+			end = cut - 1
+		}
+		if end == start {
+			end = start + maxLength
+		}
+	}
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString(ellipsis)
+	}
+
+	pos := start
+	for _, t := range found {
+		if t.start < start || t.end > end {
+			continue
+		}
+		b.WriteString(html.EscapeString(string(runes[pos:t.start])))
+		b.WriteString(highlightStart)
+		b.WriteString(html.EscapeString(string(runes[t.start:t.end])))
+		b.WriteString(highlightEnd)
+		pos = t.end
+	}
+	b.WriteString(html.EscapeString(strings.TrimRight(string(runes[pos:end]), " ")))
+
+	if end < len(runes) {
+		b.WriteString(ellipsis)
+	}
+
+	return b.String()
+}
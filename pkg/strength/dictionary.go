@@ -0,0 +1,28 @@
+package strength
+
+// commonPasswords are the most used passwords and password words, most frequent first.
+// The rank of a word is how many guesses an attacker needs to reach it.
+var commonPasswords = []string{
+	"123456", "password", "12345678", "qwerty", "123456789", "12345", "1234", "111111",
+	"1234567", "dragon", "123123", "baseball", "abc123", "football", "monkey", "letmein",
+	"696969", "shadow", "master", "666666", "qwertyuiop", "123321", "mustang", "1234567890",
+	"michael", "654321", "superman", "1qaz2wsx", "7777777", "121212", "000000", "qazwsx",
+	"123qwe", "killer", "trustno1", "jordan", "jennifer", "zxcvbnm", "asdfgh", "hunter",
+	"buster", "soccer", "harley", "batman", "andrew", "tigger", "sunshine", "iloveyou",
+	"2000", "charlie", "robert", "thomas", "hockey", "ranger", "daniel", "starwars",
+	"klaster", "112233", "george", "computer", "michelle", "jessica", "pepper", "1111",
+	"zxcvbn", "555555", "11111111", "131313", "freedom", "777777", "pass", "maggie",
+	"159753", "aaaaaa", "ginger", "princess", "joshua", "cheese", "amanda", "summer",
+	"love", "ashley", "nicole", "chelsea", "biteme", "matthew", "access", "yankees",
+	"987654321", "dallas", "austin", "thunder", "taylor", "matrix", "mobilemail", "mom",
+	"monitor", "monitoring", "montana", "moon", "moscow", "welcome", "admin", "login",
+	"passw0rd", "qwerty123", "secret", "whatever", "hello", "flower", "hottie", "lovely",
+	"angel", "loveme", "ninja", "azerty", "solo", "starwars", "donald", "princess",
+	"football", "q1w2e3r4", "zaq1zaq1", "mypass", "mypassword", "changeme", "default",
+	"guest", "root", "toor", "test", "testing", "letmein", "system", "server",
+	"strong", "very", "good", "best", "super", "secure", "private", "personal",
+	"spring", "autumn", "winter", "january", "february", "march", "april", "june",
+	"july", "august", "september", "october", "november", "december", "monday", "friday",
+	"family", "friend", "friends", "forever", "orange", "purple", "yellow", "silver",
+	"golden", "diamond", "cookie", "chocolate", "banana", "apple", "pokemon", "naruto",
+}
@@ -0,0 +1,352 @@
+// Package strength estimates how many guesses an attacker needs to find a password, in the manner of zxcvbn.
+// The password is split into the cheapest sequence of guessable patterns: common passwords, words known
+// about the user, sequences, repeats, keyboard rows and years. Characters no pattern explains are brute-forced.
+package strength
+
+import (
+	"strings"
+	"unicode"
+)
+
+const (
+	// MaxScore is the score of very unguessable passwords
+	MaxScore = 4
+
+	// guesses per character no pattern explains
+	bruteforceCardinality = 10
+	// shorter matches are cheaper to brute-force than to look up
+	minMatchLength = 3
+	// longest unit of a repeat, e.g. "abc" in "abcabcabc"
+	maxRepeatUnitLength = 8
+
+	// straight runs along a row of the keyboard
+	keyboardStartingPositions = 47
+	keyboardAverageDegree     = 4
+	minKeyboardLength         = 4
+
+	// years are guessed around the reference year
+	minYear         = 1900
+	maxYear         = 2099
+	referenceYear   = 2020
+	minYearDistance = 20
+)
+
+var (
+	// guesses under each threshold give the score of the threshold index, like zxcvbn
+	scoreThresholds = []float64{1e3, 1e6, 1e8, 1e10}
+
+	keyboardRows = []string{"qwertyuiop", "asdfghjkl", "zxcvbnm", "1234567890"}
+
+	// substitutions undone before looking words up, e.g. "p@ssw0rd"
+	l33tTable = map[rune]rune{
+		'4': 'a', '@': 'a', '8': 'b', '(': 'c', '3': 'e', '6': 'g',
+		'1': 'i', '!': 'i', '|': 'i', '0': 'o', '$': 's', '5': 's',
+		'7': 't', '+': 't', '2': 'z',
+	}
+)
+
+type match struct {
+	// runes i to j of the password, both included
+	i, j    int
+	guesses float64
+}
+
+type entry struct {
+	word string
+	rank int
+}
+
+// Score returns 0 (too guessable) to MaxScore (very unguessable).
+// userInputs are words an attacker knows about the user, e.g. parts of the email address.
+func Score(password string, userInputs ...string) int {
+	guesses := Guesses(password, userInputs...)
+	for score, threshold := range scoreThresholds {
+		if guesses < threshold {
+			return score
+		}
+	}
+
+	return MaxScore
+}
+
+// Guesses returns the estimated number of guesses to find the password.
+func Guesses(password string, userInputs ...string) float64 {
+	runes := []rune(password)
+	if len(runes) == 0 {
+		return 1
+	}
+
+	matches := dictionaryMatches(runes, newDictionary(userInputs))
+	matches = append(matches, sequenceMatches(runes)...)
+	matches = append(matches, repeatMatches(runes)...)
+	matches = append(matches, keyboardMatches(runes)...)
+	matches = append(matches, yearMatches(runes)...)
+
+	// best[k] is the fewest guesses for the first k runes
+	best := make([]float64, len(runes)+1)
+	best[0] = 1
+	for k := 1; k <= len(runes); k++ {
+		best[k] = best[k-1] * bruteforceCardinality
+		for _, m := range matches {
+			if m.j+1 != k {
+				continue
+			}
+			if g := best[m.i] * m.guesses; g < best[k] {
+				best[k] = g
+			}
+		}
+	}
+
+	return best[len(runes)]
+}
+
+// newDictionary ranks user inputs before common passwords, they are the first guesses of a targeted attack.
+func newDictionary(userInputs []string) map[string]entry {
+	dict := make(map[string]entry, len(userInputs)+len(commonPasswords))
+	add := func(word string) {
+		word = strings.ToLower(word)
+		if len([]rune(word)) < minMatchLength {
+			return
+		}
+		key := unl33t(word)
+		if _, ok := dict[key]; !ok {
+			dict[key] = entry{word: word, rank: len(dict) + 1}
+		}
+	}
+
+	for _, w := range userInputs {
+		add(w)
+	}
+	for _, w := range commonPasswords {
+		add(w)
+	}
+
+	return dict
+}
+
+func dictionaryMatches(runes []rune, dict map[string]entry) []match {
+	maxLength := 0
+	for key := range dict {
+		if l := len([]rune(key)); l > maxLength {
+			maxLength = l
+		}
+	}
+
+	lower := []rune(strings.ToLower(string(runes)))
+	if len(lower) != len(runes) {
+		// case folding changed the length, positions would not line up
+		lower = runes
+	}
+	normalized := []rune(unl33t(string(lower)))
+
+	matches := []match{}
+	for i := range runes {
+		for j := i + minMatchLength - 1; j < len(runes) && j-i < maxLength; j++ {
+			for _, reversed := range []bool{false, true} {
+				key := string(normalized[i : j+1])
+				if reversed {
+					key = reverse(key)
+				}
+
+				e, ok := dict[key]
+				if !ok {
+					continue
+				}
+
+				guesses := float64(e.rank) * uppercaseVariations(runes[i:j+1])
+				word := string(lower[i : j+1])
+				if reversed {
+					word = reverse(word)
+				}
+				if word != e.word {
+					guesses *= 2
+				}
+				if reversed {
+					guesses *= 2
+				}
+				matches = append(matches, match{i: i, j: j, guesses: guesses})
+			}
+		}
+	}
+
+	return matches
+}
+
+// sequenceMatches finds runs with a constant step, e.g. "abcd", "9753".
+func sequenceMatches(runes []rune) []match {
+	matches := []match{}
+	for i := 0; i < len(runes)-1; {
+		delta := runes[i+1] - runes[i]
+		j := i + 1
+		for j+1 < len(runes) && runes[j+1]-runes[j] == delta {
+			j++
+		}
+
+		if delta != 0 && abs(int(delta)) <= 5 && j-i+1 >= minMatchLength {
+			base := 26.0
+			switch {
+			case strings.ContainsRune("aAzZ019", runes[i]):
+				// obvious starting points are guessed first
+				base = 4
+			case unicode.IsDigit(runes[i]):
+				base = 10
+			}
+			guesses := base * float64(j-i+1)
+			if delta < 0 {
+				guesses *= 2
+			}
+			matches = append(matches, match{i: i, j: j, guesses: guesses})
+		}
+
+		i = j
+	}
+
+	return matches
+}
+
+// repeatMatches finds units repeated back to back, e.g. "aaaa", "abcabc".
+func repeatMatches(runes []rune) []match {
+	matches := []match{}
+	for i := range runes {
+		for l := 1; l <= maxRepeatUnitLength && i+2*l <= len(runes); l++ {
+			unit := string(runes[i : i+l])
+			count := 1
+			for i+(count+1)*l <= len(runes) && string(runes[i+count*l:i+(count+1)*l]) == unit {
+				count++
+			}
+
+			if count < 2 || count*l < minMatchLength {
+				continue
+			}
+			guesses := Guesses(unit) * float64(count)
+			matches = append(matches, match{i: i, j: i + count*l - 1, guesses: guesses})
+		}
+	}
+
+	return matches
+}
+
+// keyboardMatches finds straight runs along a row of a QWERTY keyboard, either way, e.g. "asdf", "poiuy".
+func keyboardMatches(runes []rune) []match {
+	lower := strings.ToLower(string(runes))
+	if len([]rune(lower)) != len(runes) {
+		return nil
+	}
+	lowerRunes := []rune(lower)
+
+	matches := []match{}
+	for i := range lowerRunes {
+		for j := i + minKeyboardLength - 1; j < len(lowerRunes); j++ {
+			s := string(lowerRunes[i : j+1])
+			if !onKeyboardRow(s) {
+				break
+			}
+			guesses := float64(keyboardStartingPositions*keyboardAverageDegree) * float64(j-i+1)
+			matches = append(matches, match{i: i, j: j, guesses: guesses * uppercaseVariations(runes[i:j+1])})
+		}
+	}
+
+	return matches
+}
+
+func onKeyboardRow(s string) bool {
+	for _, row := range keyboardRows {
+		if strings.Contains(row, s) || strings.Contains(reverse(row), s) {
+			return true
+		}
+	}
+	return false
+}
+
+// yearMatches finds recent years, e.g. "1987", which are guessed from the reference year outwards.
+func yearMatches(runes []rune) []match {
+	matches := []match{}
+	for i := 0; i+4 <= len(runes); i++ {
+		year := 0
+		digits := true
+		for _, r := range runes[i : i+4] {
+			if r < '0' || r > '9' {
+				digits = false
+				break
+			}
+			year = year*10 + int(r-'0')
+		}
+
+		if !digits || year < minYear || year > maxYear {
+			continue
+		}
+		distance := abs(year - referenceYear)
+		if distance < minYearDistance {
+			distance = minYearDistance
+		}
+		matches = append(matches, match{i: i, j: i + 3, guesses: float64(distance)})
+	}
+
+	return matches
+}
+
+// uppercaseVariations is how many ways the letters could be capitalized, all lower and first upper are guessed first.
+func uppercaseVariations(runes []rune) float64 {
+	upper, lower := 0, 0
+	for _, r := range runes {
+		switch {
+		case unicode.IsUpper(r):
+			upper++
+		case unicode.IsLower(r):
+			lower++
+		}
+	}
+
+	switch {
+	case upper == 0:
+		return 1
+	case lower == 0 || (upper == 1 && unicode.IsUpper(runes[0])):
+		return 2
+	}
+
+	// choose which letters are upper, like zxcvbn
+	variations := 0.0
+	for k := 1; k <= min(upper, lower); k++ {
+		variations += binomial(upper+lower, k)
+	}
+	return variations
+}
+
+func unl33t(s string) string {
+	return strings.Map(func(r rune) rune {
+		if sub, ok := l33tTable[r]; ok {
+			return sub
+		}
+		return r
+	}, s)
+}
+
+func reverse(s string) string {
+	runes := []rune(s)
+	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+		runes[i], runes[j] = runes[j], runes[i]
+	}
+	return string(runes)
+}
+
+func binomial(n int, k int) float64 {
+	r := 1.0
+	for i := 1; i <= k; i++ {
+		r = r * float64(n-k+i) / float64(i)
+	}
+	return r
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+func min(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,31 @@
+package totp
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"io"
+	"strings"
+)
+
+const (
+	recoveryCodeBytes = 10
+	recoveryCodeChars = 10
+)
+
+// NewRecoveryCode generates a one-time code, like "abcde-fghij", for users who lost their authenticator.
+func NewRecoveryCode() (string, error) {
+	b := make([]byte, recoveryCodeBytes)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		return "", err
+	}
+
+	c := strings.ToLower(base32.StdEncoding.EncodeToString(b))[:recoveryCodeChars]
+	return c[:recoveryCodeChars/2] + "-" + c[recoveryCodeChars/2:], nil
+}
+
+// NormalizeRecoveryCode strips separators and case, so codes typed by hand still match.
+func NormalizeRecoveryCode(c string) string {
+	c = strings.ReplaceAll(c, "-", "")
+	c = strings.ReplaceAll(c, " ", "")
+	return strings.ToLower(c)
+}
@@ -0,0 +1,125 @@
+package rest
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/org39/webapp-tutorial-backend/entity"
+	"github.com/org39/webapp-tutorial-backend/presenter/rest/rr"
+	"github.com/org39/webapp-tutorial-backend/usecase/user"
+
+	"github.com/labstack/echo/v4"
+	"github.com/org39/webapp-tutorial-backend/pkg/log"
+)
+
+type AdminDispatcher struct {
+	UserUsecase    user.Usecase    `inject:""`
+	AuthMiddleware *AuthMiddleware `inject:""`
+}
+
+func (d *AdminDispatcher) Dispatch(e *echo.Echo) {
+	auth := d.AuthMiddleware.Middleware()
+	admin := d.AuthMiddleware.RoleMiddleware(entity.RoleAdmin)
+	read := d.AuthMiddleware.ScopeMiddleware(entity.ScopeUserRead)
+	write := d.AuthMiddleware.ScopeMiddleware(entity.ScopeUserWrite)
+
+	g := e.Group("admin", auth, admin)
+	g.GET("/users", d.ListUsers(), read)
+	g.GET("/users/:id", d.GetUser(), read)
+	g.POST("/users/:id/disable", d.DisableUser(), write)
+	g.POST("/users/:id/enable", d.EnableUser(), write)
+	g.POST("/users/:id/logout", d.ForceLogout(), write)
+}
+
+func (d *AdminDispatcher) ListUsers() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+		ctx := req.Context()
+		logger := log.LoggerWithSpan(ctx)
+
+		payload, err := rr.NewFactory().NewAdminUserListRequest(c)
+		if err != nil {
+			return c.NoContent(http.StatusBadRequest)
+		}
+
+		users, err := d.UserUsecase.ListUsers(ctx, payload.Email, payload.Limit, payload.Offset)
+		if err != nil {
+			return toHTTPError(logger, err)
+		}
+
+		return c.JSON(http.StatusOK,
+			rr.NewFactory().NewAdminUsersResponse(users),
+		)
+	}
+}
+
+func (d *AdminDispatcher) GetUser() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+		ctx := req.Context()
+		logger := log.LoggerWithSpan(ctx)
+
+		u, err := d.UserUsecase.FetchByID(ctx, c.Param("id"))
+		if err != nil {
+			return toHTTPError(logger, err)
+		}
+
+		return c.JSON(http.StatusOK,
+			rr.NewFactory().NewAdminUserResponse(u),
+		)
+	}
+}
+
+func (d *AdminDispatcher) DisableUser() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+		ctx := req.Context()
+		logger := log.LoggerWithSpan(ctx)
+
+		authCtx, ok := c.(*AuthorizedContext)
+		if !ok {
+			logger.WithError(errors.New("invalid authorized context")).Error()
+			return echo.NewHTTPError(http.StatusInternalServerError)
+		}
+
+		// an admin locked out of the account could not undo it
+		id := c.Param("id")
+		if id == authCtx.UserID() {
+			return echo.NewHTTPError(http.StatusBadRequest, "cannot disable your own account")
+		}
+
+		if err := d.UserUsecase.DisableUser(ctx, id); err != nil {
+			return toHTTPError(logger, err)
+		}
+
+		return c.NoContent(http.StatusNoContent)
+	}
+}
+
+func (d *AdminDispatcher) EnableUser() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+		ctx := req.Context()
+		logger := log.LoggerWithSpan(ctx)
+
+		if err := d.UserUsecase.EnableUser(ctx, c.Param("id")); err != nil {
+			return toHTTPError(logger, err)
+		}
+
+		return c.NoContent(http.StatusNoContent)
+	}
+}
+
+func (d *AdminDispatcher) ForceLogout() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+		ctx := req.Context()
+		logger := log.LoggerWithSpan(ctx)
+
+		if err := d.UserUsecase.ForceLogout(ctx, c.Param("id")); err != nil {
+			return toHTTPError(logger, err)
+		}
+
+		return c.NoContent(http.StatusNoContent)
+	}
+}
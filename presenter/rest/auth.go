@@ -2,10 +2,13 @@ package rest
 
 import (
 	"errors"
+	"fmt"
 	"net/http"
 	"strings"
 
+	"github.com/org39/webapp-tutorial-backend/entity"
 	"github.com/org39/webapp-tutorial-backend/usecase/auth"
+	"github.com/org39/webapp-tutorial-backend/usecase/user"
 
 	"github.com/labstack/echo/v4"
 	"github.com/org39/webapp-tutorial-backend/pkg/log"
@@ -17,20 +20,45 @@ const (
 )
 
 type AuthMiddleware struct {
-	AuthUsercase auth.Usecase `inject:""`
+	AuthUsercase         auth.Usecase `inject:""`
+	UserUsecase          user.Usecase `inject:""`
+	RequireVerifiedEmail bool         `inject:"rest.auth.require_verified_email"`
 }
 
 type AuthorizedContext struct {
 	echo.Context
-	userID string
+	claims *entity.AuthClaims
 }
 
 func (c *AuthorizedContext) UserID() string {
-	return c.userID
+	return c.claims.UserID
 }
 
-func newAuthrizedContext(c echo.Context, userID string) *AuthorizedContext {
-	return &AuthorizedContext{c, userID}
+// SessionID returns the session the token of the request was issued to, empty for personal access tokens.
+func (c *AuthorizedContext) SessionID() string {
+	return c.claims.SessionID
+}
+
+// Scopes returns the scopes granted to the token of the request.
+func (c *AuthorizedContext) Scopes() []string {
+	return c.claims.Scopes
+}
+
+func (c *AuthorizedContext) HasScopes(scopes ...string) bool {
+	return c.claims.HasScopes(scopes...)
+}
+
+// Roles returns the roles of the user when the token was issued, personal access tokens carry none.
+func (c *AuthorizedContext) Roles() []string {
+	return c.claims.Roles
+}
+
+func (c *AuthorizedContext) HasRole(role string) bool {
+	return c.claims.HasRole(role)
+}
+
+func newAuthrizedContext(c echo.Context, claims *entity.AuthClaims) *AuthorizedContext {
+	return &AuthorizedContext{c, claims}
 }
 
 func (a *AuthMiddleware) Middleware() echo.MiddlewareFunc {
@@ -51,7 +79,7 @@ func (a *AuthMiddleware) Middleware() echo.MiddlewareFunc {
 			}
 
 			// verify token
-			userID, err := a.AuthUsercase.VerifyToken(ctx, token)
+			claims, err := a.AuthUsercase.VerifyToken(ctx, token)
 			switch {
 			case errors.Is(err, auth.ErrUnauthorized):
 				return echo.NewHTTPError(http.StatusUnauthorized)
@@ -64,7 +92,7 @@ func (a *AuthMiddleware) Middleware() echo.MiddlewareFunc {
 			}
 
 			// if token is valid, process request with authrized context
-			authorizedContext := newAuthrizedContext(c, userID)
+			authorizedContext := newAuthrizedContext(c, claims)
 			err = next(authorizedContext)
 			if err != nil {
 				c.Error(err)
@@ -75,6 +103,90 @@ func (a *AuthMiddleware) Middleware() echo.MiddlewareFunc {
 	}
 }
 
+// VerifiedMiddleware rejects users who did not verify their email address, when it is required.
+// It must be placed after Middleware.
+func (a *AuthMiddleware) VerifiedMiddleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if !a.RequireVerifiedEmail {
+				return next(c)
+			}
+
+			req := c.Request()
+			ctx := req.Context()
+			logger := log.LoggerWithSpan(ctx)
+
+			authCtx, ok := c.(*AuthorizedContext)
+			if !ok {
+				logger.WithError(errors.New("invalid authorized context")).Error()
+				return echo.NewHTTPError(http.StatusInternalServerError)
+			}
+
+			u, err := a.UserUsecase.FetchByID(ctx, authCtx.UserID())
+			if err != nil {
+				return toHTTPError(logger, err)
+			}
+
+			if !u.Verified() {
+				return echo.NewHTTPError(http.StatusForbidden, "email address is not verified")
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// ScopeMiddleware rejects tokens which were not granted every given scope.
+// It must be placed after Middleware.
+func (a *AuthMiddleware) ScopeMiddleware(scopes ...string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			ctx := req.Context()
+			logger := log.LoggerWithSpan(ctx)
+
+			authCtx, ok := c.(*AuthorizedContext)
+			if !ok {
+				logger.WithError(errors.New("invalid authorized context")).Error()
+				return echo.NewHTTPError(http.StatusInternalServerError)
+			}
+
+			if !authCtx.HasScopes(scopes...) {
+				// RFC 6750, tell the client which scope it is missing
+				c.Response().Header().Set(echo.HeaderWWWAuthenticate,
+					fmt.Sprintf(`%s error="insufficient_scope", scope="%s"`, bearer, strings.Join(scopes, " ")))
+				return echo.NewHTTPError(http.StatusForbidden, "insufficient scope")
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// RoleMiddleware rejects tokens of users who were not granted the role.
+// It must be placed after Middleware.
+func (a *AuthMiddleware) RoleMiddleware(role string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			ctx := req.Context()
+			logger := log.LoggerWithSpan(ctx)
+
+			authCtx, ok := c.(*AuthorizedContext)
+			if !ok {
+				logger.WithError(errors.New("invalid authorized context")).Error()
+				return echo.NewHTTPError(http.StatusInternalServerError)
+			}
+
+			if !authCtx.HasRole(role) {
+				return echo.NewHTTPError(http.StatusForbidden, "insufficient role")
+			}
+
+			return next(c)
+		}
+	}
+}
+
 func extractBearerToken(v string) string {
 	invalidToken := ""
 	parts := strings.Split(v, " ")
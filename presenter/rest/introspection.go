@@ -0,0 +1,80 @@
+package rest
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/org39/webapp-tutorial-backend/presenter/rest/rr"
+	"github.com/org39/webapp-tutorial-backend/usecase/auth"
+
+	"github.com/labstack/echo/v4"
+	"github.com/org39/webapp-tutorial-backend/pkg/log"
+)
+
+const (
+	introspectionEndpoint = "oauth/introspect"
+	introspectionRealm    = `Basic realm="introspection"`
+)
+
+// IntrospectionDispatcher lets other services verify tokens, they authenticate with client credentials.
+type IntrospectionDispatcher struct {
+	AuthUsercase auth.Usecase `inject:""`
+}
+
+func (d *IntrospectionDispatcher) Dispatch(e *echo.Echo) {
+	e.POST(introspectionEndpoint, d.Introspect())
+}
+
+func (d *IntrospectionDispatcher) Introspect() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+		ctx := req.Context()
+		logger := log.LoggerWithSpan(ctx)
+
+		payload := rr.NewFactory().NewIntrospectionRequest("")
+		if err := c.Bind(payload); err != nil {
+			return c.NoContent(http.StatusBadRequest)
+		}
+
+		clientID, clientSecret, err := introspectionClientCredentials(req, payload)
+		if err != nil {
+			return c.NoContent(http.StatusBadRequest)
+		}
+
+		introspection, err := d.AuthUsercase.Introspect(ctx, clientID, clientSecret, payload.Token)
+		switch {
+		case errors.Is(err, auth.ErrUnauthorized):
+			c.Response().Header().Set(echo.HeaderWWWAuthenticate, introspectionRealm)
+			return echo.NewHTTPError(http.StatusUnauthorized, "invalid client")
+		case errors.Is(err, auth.ErrInvalidRequest):
+			return echo.NewHTTPError(http.StatusBadRequest)
+		case err != nil:
+			logger.WithError(err).Error()
+			return echo.NewHTTPError(http.StatusInternalServerError)
+		}
+
+		// the answer changes as soon as the token is revoked
+		c.Response().Header().Set(headerCacheControl, "no-store")
+		return c.JSON(http.StatusOK, rr.NewFactory().NewIntrospectionResponse(introspection))
+	}
+}
+
+// introspectionClientCredentials prefers HTTP Basic authentication, whose credentials are form encoded (RFC 6749 2.3.1).
+func introspectionClientCredentials(req *http.Request, payload *rr.IntrospectionRequest) (string, string, error) {
+	id, secret, ok := req.BasicAuth()
+	if !ok {
+		return payload.ClientID, payload.ClientSecret, nil
+	}
+
+	id, err := url.QueryUnescape(id)
+	if err != nil {
+		return "", "", err
+	}
+	secret, err = url.QueryUnescape(secret)
+	if err != nil {
+		return "", "", err
+	}
+
+	return id, secret, nil
+}
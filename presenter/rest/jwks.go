@@ -0,0 +1,43 @@
+package rest
+
+import (
+	"net/http"
+
+	"github.com/org39/webapp-tutorial-backend/presenter/rest/rr"
+	"github.com/org39/webapp-tutorial-backend/usecase/auth"
+
+	"github.com/labstack/echo/v4"
+	"github.com/org39/webapp-tutorial-backend/pkg/log"
+)
+
+const (
+	jwksEndpoint = ".well-known/jwks.json"
+)
+
+type JWKSDispatcher struct {
+	AuthUsercase auth.Usecase `inject:""`
+}
+
+func (d *JWKSDispatcher) Dispatch(e *echo.Echo) {
+	e.GET(jwksEndpoint, d.GetJWKS())
+}
+
+func (d *JWKSDispatcher) GetJWKS() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+		ctx := req.Context()
+		logger := log.LoggerWithSpan(ctx)
+
+		keys, err := d.AuthUsercase.PublicKeys(ctx)
+		if err != nil {
+			logger.WithError(err).Error()
+			return echo.NewHTTPError(http.StatusInternalServerError)
+		}
+
+		// let verifiers cache keys for a while, rotated keys stay published until old tokens expire
+		c.Response().Header().Set("Cache-Control", "public, max-age=300")
+		return c.JSON(http.StatusOK,
+			rr.NewFactory().NewJWKSResponse(keys),
+		)
+	}
+}
@@ -39,6 +39,34 @@ func New(g *inject.Graph, readiness echo.HandlerFunc) (*echo.Echo, error) {
 		return nil, err
 	}
 
+	// tag RestAPI
+	tagAPI := new(TagDispatcher)
+	restAPI.AttachDispatcher(tagAPI)
+	if err := g.Provide(&inject.Object{Value: tagAPI}); err != nil {
+		return nil, err
+	}
+
+	// admin RestAPI
+	adminAPI := new(AdminDispatcher)
+	restAPI.AttachDispatcher(adminAPI)
+	if err := g.Provide(&inject.Object{Value: adminAPI}); err != nil {
+		return nil, err
+	}
+
+	// JWKS RestAPI
+	jwksAPI := new(JWKSDispatcher)
+	restAPI.AttachDispatcher(jwksAPI)
+	if err := g.Provide(&inject.Object{Value: jwksAPI}); err != nil {
+		return nil, err
+	}
+
+	// token introspection RestAPI
+	introspectionAPI := new(IntrospectionDispatcher)
+	restAPI.AttachDispatcher(introspectionAPI)
+	if err := g.Provide(&inject.Object{Value: introspectionAPI}); err != nil {
+		return nil, err
+	}
+
 	// build dependency graph
 	if err := g.Populate(); err != nil {
 		return nil, err
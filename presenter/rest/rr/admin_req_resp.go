@@ -0,0 +1,82 @@
+package rr
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/org39/webapp-tutorial-backend/entity"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	defaultAdminUserListLimit = 50
+)
+
+func (f *Factory) NewAdminUserListRequest(c echo.Context) (*AdminUserListRequest, error) {
+	req := &AdminUserListRequest{
+		Email: c.QueryParam("email"),
+		Limit: defaultAdminUserListLimit,
+	}
+
+	if v := c.QueryParam("limit"); v != "" {
+		limit, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		req.Limit = limit
+	}
+
+	if v := c.QueryParam("offset"); v != "" {
+		offset, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		req.Offset = offset
+	}
+
+	return req, nil
+}
+
+func (f *Factory) NewAdminUserResponse(u *entity.User) *AdminUserResponse {
+	roles := u.Roles
+	if roles == nil {
+		roles = []string{}
+	}
+
+	return &AdminUserResponse{
+		ID:         u.ID,
+		Email:      u.Email,
+		Verified:   u.Verified(),
+		Roles:      roles,
+		Disabled:   u.Disabled(),
+		DisabledAt: u.DisabledAt,
+		CreatedAt:  u.CreatedAt,
+	}
+}
+
+func (f *Factory) NewAdminUsersResponse(users []*entity.User) []*AdminUserResponse {
+	resp := make([]*AdminUserResponse, len(users))
+	for i, u := range users {
+		resp[i] = f.NewAdminUserResponse(u)
+	}
+	return resp
+}
+
+// ------------------------------------------------------------------
+type AdminUserListRequest struct {
+	// part of the email address, empty lists every user
+	Email  string
+	Limit  uint64
+	Offset uint64
+}
+
+type AdminUserResponse struct {
+	ID         string     `json:"id"`
+	Email      string     `json:"email"`
+	Verified   bool       `json:"verified"`
+	Roles      []string   `json:"roles"`
+	Disabled   bool       `json:"disabled"`
+	DisabledAt *time.Time `json:"disabled_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
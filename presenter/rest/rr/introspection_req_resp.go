@@ -0,0 +1,57 @@
+package rr
+
+import (
+	"strings"
+
+	"github.com/org39/webapp-tutorial-backend/entity"
+)
+
+// token_type of active tokens, every token of this backend is a bearer token
+const introspectionTokenType = "Bearer"
+
+func (f *Factory) NewIntrospectionRequest(token string) *IntrospectionRequest {
+	return &IntrospectionRequest{
+		Token: token,
+	}
+}
+
+func (f *Factory) NewIntrospectionResponse(i *entity.TokenIntrospection) *IntrospectionResponse {
+	if !i.Active {
+		return &IntrospectionResponse{Active: false}
+	}
+
+	resp := &IntrospectionResponse{
+		Active:    true,
+		Scope:     strings.Join(i.Claims.Scopes, " "),
+		Subject:   i.Claims.UserID,
+		TokenType: introspectionTokenType,
+		SessionID: i.Claims.SessionID,
+		Roles:     i.Claims.Roles,
+	}
+	if i.Claims.ExpiresAt != nil {
+		resp.ExpiresAt = i.Claims.ExpiresAt.Unix()
+	}
+
+	return resp
+}
+
+// ------------------------------------------------------------------
+// IntrospectionRequest is form encoded, as RFC 7662 requires.
+type IntrospectionRequest struct {
+	Token string `form:"token"`
+	// every kind of token is looked up, the hint is accepted and ignored
+	TokenTypeHint string `form:"token_type_hint"`
+	ClientID      string `form:"client_id"`
+	ClientSecret  string `form:"client_secret"`
+}
+
+// IntrospectionResponse of an inactive token carries nothing but active.
+type IntrospectionResponse struct {
+	Active    bool     `json:"active"`
+	Scope     string   `json:"scope,omitempty"`
+	Subject   string   `json:"sub,omitempty"`
+	ExpiresAt int64    `json:"exp,omitempty"`
+	TokenType string   `json:"token_type,omitempty"`
+	SessionID string   `json:"sid,omitempty"`
+	Roles     []string `json:"roles,omitempty"`
+}
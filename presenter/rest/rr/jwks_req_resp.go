@@ -0,0 +1,20 @@
+package rr
+
+import (
+	"github.com/org39/webapp-tutorial-backend/pkg/jwk"
+)
+
+func (f *Factory) NewJWKSResponse(keys []*jwk.Key) *JWKSResponse {
+	resp := &JWKSResponse{
+		Keys: make([]*jwk.PublicJWK, len(keys)),
+	}
+	for i, k := range keys {
+		resp.Keys[i] = k.PublicJWK()
+	}
+	return resp
+}
+
+// ------------------------------------------------------------------
+type JWKSResponse struct {
+	Keys []*jwk.PublicJWK `json:"keys"`
+}
@@ -0,0 +1,60 @@
+package rr
+
+import (
+	"time"
+
+	"github.com/org39/webapp-tutorial-backend/entity"
+
+	"github.com/labstack/echo/v4"
+)
+
+func (f *Factory) NewTagCreateRequest(c echo.Context) (*TagCreateRequest, error) {
+	req := &TagCreateRequest{}
+	err := c.Bind(req)
+	return req, err
+}
+
+func (f *Factory) NewTagUpdateRequest(c echo.Context) (*TagUpdateRequest, error) {
+	req := &TagUpdateRequest{}
+	err := c.Bind(req)
+	return req, err
+}
+
+func (f *Factory) NewTagResponse(tag *entity.Tag) *TagResponse {
+	return &TagResponse{
+		ID:        tag.ID,
+		Name:      tag.Name,
+		Color:     tag.Color,
+		CreatedAt: tag.CreatedAt,
+		UpdatedAt: tag.UpdatedAt,
+	}
+}
+
+func (f *Factory) NewTagsResponse(tags []*entity.Tag) []*TagResponse {
+	resp := make([]*TagResponse, len(tags))
+	for i, tag := range tags {
+		resp[i] = f.NewTagResponse(tag)
+	}
+	return resp
+}
+
+// ------------------------------------------------------------------
+// TagCreateRequest creates a gray tag when the color is missing.
+type TagCreateRequest struct {
+	Name  string `json:"name"`
+	Color string `json:"color"`
+}
+
+// TagUpdateRequest keeps the fields missing from the body.
+type TagUpdateRequest struct {
+	Name  *string `json:"name"`
+	Color *string `json:"color"`
+}
+
+type TagResponse struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Color     string    `json:"color"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
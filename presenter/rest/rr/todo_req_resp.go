@@ -1,6 +1,8 @@
 package rr
 
 import (
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/org39/webapp-tutorial-backend/entity"
@@ -8,12 +10,110 @@ import (
 	"github.com/labstack/echo/v4"
 )
 
+const (
+	queryDateLayout = "2006-01-02"
+
+	defaultTodoPageLimit   = 50
+	defaultTodoSearchLimit = 20
+)
+
 func (f *Factory) NewTodoCreatRequest(c echo.Context) (*TodoCreatRequest, error) {
 	req := &TodoCreatRequest{}
 	err := c.Bind(req)
 	return req, err
 }
 
+// NewTodoListRequest reads the filter and the order from the query.
+// Open todos which are not deleted are listed oldest first by default.
+// Dates are RFC 3339 timestamps or days, e.g. 2021-05-01 is its midnight in UTC.
+func (f *Factory) NewTodoListRequest(c echo.Context) (*TodoListRequest, error) {
+	req := &TodoListRequest{
+		Status:   entity.TodoStatusOpen,
+		Deleted:  entity.TodoDeletedExclude,
+		Content:  c.QueryParam("content"),
+		TagMatch: entity.TodoTagMatchAny,
+		Sort:     entity.TodoSortCreatedAt,
+		Order:    entity.TodoOrderAsc,
+		Cursor:   c.QueryParam("cursor"),
+		Limit:    defaultTodoPageLimit,
+	}
+
+	// comma separated ids
+	if v := c.QueryParam("tags"); v != "" {
+		req.Tags = strings.Split(v, ",")
+	}
+
+	if v := c.QueryParam("tag_match"); v != "" {
+		req.TagMatch = v
+	}
+
+	if v := c.QueryParam("sort"); v != "" {
+		req.Sort = v
+	}
+
+	if v := c.QueryParam("order"); v != "" {
+		req.Order = v
+	}
+
+	if v := c.QueryParam("limit"); v != "" {
+		limit, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		req.Limit = limit
+	}
+
+	if v := c.QueryParam("status"); v != "" {
+		req.Status = v
+	}
+
+	if v := c.QueryParam("deleted"); v != "" {
+		req.Deleted = v
+	}
+
+	dates := []struct {
+		param string
+		dest  **time.Time
+	}{
+		{"created_after", &req.CreatedAfter},
+		{"created_before", &req.CreatedBefore},
+		{"updated_after", &req.UpdatedAfter},
+		{"updated_before", &req.UpdatedBefore},
+	}
+	for _, d := range dates {
+		v := c.QueryParam(d.param)
+		if v == "" {
+			continue
+		}
+
+		t, err := parseQueryDate(v)
+		if err != nil {
+			return nil, err
+		}
+		*d.dest = &t
+	}
+
+	return req, nil
+}
+
+// NewTodoSearchRequest reads the words to search for from q.
+func (f *Factory) NewTodoSearchRequest(c echo.Context) (*TodoSearchRequest, error) {
+	req := &TodoSearchRequest{
+		Query: c.QueryParam("q"),
+		Limit: defaultTodoSearchLimit,
+	}
+
+	if v := c.QueryParam("limit"); v != "" {
+		limit, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		req.Limit = limit
+	}
+
+	return req, nil
+}
+
 func (f *Factory) NewTodoResponse(todo *entity.Todo) *TodoResponse {
 	return &TodoResponse{
 		ID:        todo.ID,
@@ -22,6 +122,10 @@ func (f *Factory) NewTodoResponse(todo *entity.Todo) *TodoResponse {
 		CreatedAt: todo.CreatedAt,
 		UpdatedAt: todo.UpdatedAt,
 		Deleted:   todo.Deleted,
+		DueAt:     todo.DueAt,
+		Priority:  todo.Priority,
+		Position:  todo.Position,
+		Tags:      f.NewTagsResponse(todo.Tags),
 	}
 }
 
@@ -34,21 +138,91 @@ func (f *Factory) NewTodoUpdateRequest(c echo.Context) (*TodoUpdateRequest, erro
 func (f *Factory) NewTodosResponse(todos []*entity.Todo) []*TodoResponse {
 	resp := make([]*TodoResponse, len(todos))
 	for i, todo := range todos {
-		resp[i] = &TodoResponse{
-			ID:        todo.ID,
-			Content:   todo.Content,
-			Completed: todo.Completed,
-			CreatedAt: todo.CreatedAt,
-			UpdatedAt: todo.UpdatedAt,
-			Deleted:   todo.Deleted,
-		}
+		resp[i] = f.NewTodoResponse(todo)
+	}
+	return resp
+}
+
+func parseQueryDate(v string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+
+	return time.Parse(queryDateLayout, v)
+}
+
+func (f *Factory) NewTodoPageResponse(page *entity.TodoPage) *TodoPageResponse {
+	resp := &TodoPageResponse{
+		Items: f.NewTodosResponse(page.Todos),
+	}
+
+	if page.Next != nil {
+		next := page.Next.Encode()
+		resp.NextCursor = &next
 	}
+
 	return resp
 }
 
+func (f *Factory) NewTodoSearchResponse(results []*entity.TodoSearchResult) *TodoSearchResponse {
+	items := make([]*TodoSearchResultResponse, len(results))
+	for i, r := range results {
+		items[i] = &TodoSearchResultResponse{
+			TodoResponse: f.NewTodoResponse(r.Todo),
+			Score:        r.Score,
+			Snippet:      r.Snippet,
+		}
+	}
+
+	return &TodoSearchResponse{Items: items}
+}
+
 // ------------------------------------------------------------------
+type TodoListRequest struct {
+	Status        string
+	Deleted       string
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	UpdatedAfter  *time.Time
+	UpdatedBefore *time.Time
+	Content       string
+	Tags          []string
+	TagMatch      string
+	Sort          string
+	Order         string
+	// opaque position to continue after, empty for the first page
+	Cursor string
+	Limit  uint64
+}
+
+// TodoPageResponse is a page of todos, NextCursor is null on the last page.
+type TodoPageResponse struct {
+	Items      []*TodoResponse `json:"items"`
+	NextCursor *string         `json:"next_cursor"`
+}
+
+type TodoSearchRequest struct {
+	Query string
+	Limit uint64
+}
+
+// TodoSearchResponse lists the todos found, the most relevant first.
+type TodoSearchResponse struct {
+	Items []*TodoSearchResultResponse `json:"items"`
+}
+
+// TodoSearchResultResponse is a todo with its relevance, snippet is HTML with the words found in <mark></mark>.
+type TodoSearchResultResponse struct {
+	*TodoResponse
+	Score   float64 `json:"score"`
+	Snippet string  `json:"snippet"`
+}
+
 type TodoCreatRequest struct {
-	Content string `json:"content"`
+	Content  string     `json:"content"`
+	DueAt    *time.Time `json:"due_at"`
+	Priority int        `json:"priority"`
+	Position int        `json:"position"`
 }
 
 type TodoResponse struct {
@@ -58,10 +232,20 @@ type TodoResponse struct {
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 	Deleted   bool      `json:"deleted"`
+	// null when the todo has no due date
+	DueAt    *time.Time `json:"due_at"`
+	Priority int        `json:"priority"`
+	Position int        `json:"position"`
+	// by name
+	Tags []*TagResponse `json:"tags"`
 }
 
+// TodoUpdateRequest replaces the todo, a missing due_at removes its due date.
 type TodoUpdateRequest struct {
-	Content   string `json:"content"`
-	Completed bool   `json:"completed"`
-	Deleted   bool   `json:"deleted"`
+	Content   string     `json:"content"`
+	Completed bool       `json:"completed"`
+	Deleted   bool       `json:"deleted"`
+	DueAt     *time.Time `json:"due_at"`
+	Priority  int        `json:"priority"`
+	Position  int        `json:"position"`
 }
@@ -0,0 +1,54 @@
+package rr
+
+import (
+	"time"
+
+	"github.com/org39/webapp-tutorial-backend/entity"
+)
+
+// avatars are served by GET avatars/:id
+const avatarPathPrefix = "/avatars/"
+
+func (f *Factory) NewUserProfileUpdateRequest() *UserProfileUpdateRequest {
+	return &UserProfileUpdateRequest{}
+}
+
+func (f *Factory) NewUserProfileResponse(profile *entity.UserProfile) *UserProfileResponse {
+	var avatarURL *string
+	if profile.HasAvatar() {
+		url := avatarPathPrefix + profile.AvatarID
+		avatarURL = &url
+	}
+
+	preferences := profile.Preferences
+	if preferences == nil {
+		preferences = map[string]interface{}{}
+	}
+
+	return &UserProfileResponse{
+		DisplayName: profile.DisplayName,
+		TimeZone:    profile.TimeZone,
+		Locale:      profile.Locale,
+		AvatarURL:   avatarURL,
+		Preferences: preferences,
+		UpdatedAt:   profile.UpdatedAt,
+	}
+}
+
+// ------------------------------------------------------------------
+// UserProfileUpdateRequest keeps the fields missing from the body.
+type UserProfileUpdateRequest struct {
+	DisplayName *string                `json:"display_name"`
+	TimeZone    *string                `json:"time_zone"`
+	Locale      *string                `json:"locale"`
+	Preferences map[string]interface{} `json:"preferences"`
+}
+
+type UserProfileResponse struct {
+	DisplayName string                 `json:"display_name"`
+	TimeZone    string                 `json:"time_zone"`
+	Locale      string                 `json:"locale"`
+	AvatarURL   *string                `json:"avatar_url"`
+	Preferences map[string]interface{} `json:"preferences"`
+	UpdatedAt   time.Time              `json:"updated_at"`
+}
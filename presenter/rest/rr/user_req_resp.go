@@ -2,6 +2,8 @@ package rr
 
 import (
 	"time"
+
+	"github.com/org39/webapp-tutorial-backend/entity"
 )
 
 func (f *Factory) NewUserSignUpRequest(email string, plainPassword string) *UserSignUpRequest {
@@ -44,10 +46,189 @@ func (f *Factory) NewUserRefreshResponse(accessToken string) *UserRefreshRespons
 	}
 }
 
-func (f *Factory) NewUserResponse(email string, createdAt time.Time) *UserResponse {
+func (f *Factory) NewUserResponse(email string, verified bool, createdAt time.Time, profile *entity.UserProfile) *UserResponse {
 	return &UserResponse{
-		Email:     email,
-		CreatedAt: createdAt,
+		Email:               email,
+		Verified:            verified,
+		CreatedAt:           createdAt,
+		UserProfileResponse: f.NewUserProfileResponse(profile),
+	}
+}
+
+func (f *Factory) NewUserVerifyRequest(token string) *UserVerifyRequest {
+	return &UserVerifyRequest{
+		Token: token,
+	}
+}
+
+func (f *Factory) NewUserMagicLinkRequest(email string) *UserMagicLinkRequest {
+	return &UserMagicLinkRequest{
+		Email: email,
+	}
+}
+
+func (f *Factory) NewUserMagicLinkLoginRequest(token string) *UserMagicLinkLoginRequest {
+	return &UserMagicLinkLoginRequest{
+		Token: token,
+	}
+}
+
+func (f *Factory) NewUserForgotPasswordRequest(email string) *UserForgotPasswordRequest {
+	return &UserForgotPasswordRequest{
+		Email: email,
+	}
+}
+
+func (f *Factory) NewUserResetPasswordRequest(token string, plainPassword string) *UserResetPasswordRequest {
+	return &UserResetPasswordRequest{
+		Token:         token,
+		PlainPassword: plainPassword,
+	}
+}
+
+func (f *Factory) NewUserChangePasswordRequest(currentPassword string, plainPassword string) *UserChangePasswordRequest {
+	return &UserChangePasswordRequest{
+		CurrentPassword: currentPassword,
+		PlainPassword:   plainPassword,
+	}
+}
+
+func (f *Factory) NewUserChangeEmailRequest(email string, currentPassword string) *UserChangeEmailRequest {
+	return &UserChangeEmailRequest{
+		Email:           email,
+		CurrentPassword: currentPassword,
+	}
+}
+
+func (f *Factory) NewUserOAuthFlowCookie(flow *entity.OAuthFlow) *UserOAuthFlowCookie {
+	return &UserOAuthFlowCookie{
+		Provider:     flow.Provider,
+		State:        flow.State,
+		Nonce:        flow.Nonce,
+		CodeVerifier: flow.CodeVerifier,
+	}
+}
+
+func (f *Factory) NewUserMFAChallengeResponse(mfaToken string) *UserMFAChallengeResponse {
+	return &UserMFAChallengeResponse{
+		MFARequired: true,
+		MFAToken:    mfaToken,
+	}
+}
+
+func (f *Factory) NewUserLoginMFARequest(mfaToken string, code string) *UserLoginMFARequest {
+	return &UserLoginMFARequest{
+		MFAToken: mfaToken,
+		Code:     code,
+	}
+}
+
+func (f *Factory) NewUserMFACodeRequest(code string) *UserMFACodeRequest {
+	return &UserMFACodeRequest{
+		Code: code,
+	}
+}
+
+func (f *Factory) NewUserMFAEnrollResponse(secret string, uri string) *UserMFAEnrollResponse {
+	return &UserMFAEnrollResponse{
+		Secret: secret,
+		URI:    uri,
+	}
+}
+
+func (f *Factory) NewUserRecoveryCodesResponse(codes []string) *UserRecoveryCodesResponse {
+	return &UserRecoveryCodesResponse{
+		RecoveryCodes: codes,
+	}
+}
+
+func (f *Factory) NewUserTokenCreateRequest(name string, scopes []string, expiresIn int64) *UserTokenCreateRequest {
+	return &UserTokenCreateRequest{
+		Name:      name,
+		Scopes:    scopes,
+		ExpiresIn: expiresIn,
+	}
+}
+
+func (f *Factory) NewUserTokenCreateResponse(t *entity.IssuedPersonalAccessToken) *UserTokenCreateResponse {
+	return &UserTokenCreateResponse{
+		UserTokenResponse: f.NewUserTokenResponse(t.PersonalAccessToken),
+		Token:             t.Token,
+	}
+}
+
+func (f *Factory) NewUserTokenResponse(t *entity.PersonalAccessToken) *UserTokenResponse {
+	return &UserTokenResponse{
+		ID:         t.ID,
+		Name:       t.Name,
+		Scopes:     t.Scopes,
+		LastUsedAt: t.LastUsedAt,
+		ExpiresAt:  t.ExpiresAt,
+		CreatedAt:  t.CreatedAt,
+	}
+}
+
+func (f *Factory) NewUserTokensResponse(tokens []*entity.PersonalAccessToken) []*UserTokenResponse {
+	resp := make([]*UserTokenResponse, len(tokens))
+	for i, t := range tokens {
+		resp[i] = f.NewUserTokenResponse(t)
+	}
+	return resp
+}
+
+func (f *Factory) NewUserSessionResponse(s *entity.Session, current bool) *UserSessionResponse {
+	return &UserSessionResponse{
+		ID:         s.ID,
+		Label:      s.Label,
+		UserAgent:  s.UserAgent,
+		IP:         s.IP,
+		Current:    current,
+		LastSeenAt: s.LastSeenAt,
+		ExpiresAt:  s.ExpiresAt,
+		CreatedAt:  s.CreatedAt,
+	}
+}
+
+// NewUserSessionsResponse marks the session of the request as current.
+func (f *Factory) NewUserSessionsResponse(sessions []*entity.Session, currentID string) []*UserSessionResponse {
+	resp := make([]*UserSessionResponse, len(sessions))
+	for i, s := range sessions {
+		resp[i] = f.NewUserSessionResponse(s, s.ID == currentID)
+	}
+	return resp
+}
+
+func (f *Factory) NewUserDeleteRequest(currentPassword string) *UserDeleteRequest {
+	return &UserDeleteRequest{
+		CurrentPassword: currentPassword,
+	}
+}
+
+func (f *Factory) NewPasswordRejectedResponse(reasons []string) *PasswordRejectedResponse {
+	return &PasswordRejectedResponse{
+		Message: "password rejected",
+		Reasons: reasons,
+	}
+}
+
+func (f *Factory) NewUserExportResponse(export *entity.UserExport) *UserExportResponse {
+	roles := export.User.Roles
+	if roles == nil {
+		roles = []string{}
+	}
+
+	return &UserExportResponse{
+		User: &UserExportProfile{
+			ID:         export.User.ID,
+			Email:      export.User.Email,
+			Roles:      roles,
+			VerifiedAt: export.User.VerifiedAt,
+			CreatedAt:  export.User.CreatedAt,
+		},
+		Profile:    f.NewUserProfileResponse(export.Profile),
+		Todos:      f.NewTodosResponse(export.Todos),
+		Tags:       f.NewTagsResponse(export.Tags),
+		ExportedAt: export.ExportedAt,
 	}
 }
 
@@ -82,5 +263,127 @@ type UserRefreshResponse struct {
 
 type UserResponse struct {
 	Email     string    `json:"email"`
+	Verified  bool      `json:"verified"`
 	CreatedAt time.Time `json:"created_at"`
+	*UserProfileResponse
+}
+
+type UserMagicLinkRequest struct {
+	Email string `json:"email"`
+}
+
+type UserMagicLinkLoginRequest struct {
+	Token string `json:"token"`
+}
+
+type UserForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+type UserResetPasswordRequest struct {
+	Token         string `json:"token"`
+	PlainPassword string `json:"password"`
+}
+
+type UserChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	PlainPassword   string `json:"password"`
+}
+
+type UserChangeEmailRequest struct {
+	Email           string `json:"email"`
+	CurrentPassword string `json:"current_password"`
+}
+
+// UserOAuthFlowCookie is a login with an external provider in progress, kept by the user agent
+type UserOAuthFlowCookie struct {
+	Provider     string `json:"provider"`
+	State        string `json:"state"`
+	Nonce        string `json:"nonce"`
+	CodeVerifier string `json:"code_verifier"`
+}
+
+type UserVerifyRequest struct {
+	Token string `json:"token"`
+}
+
+type UserMFAChallengeResponse struct {
+	MFARequired bool   `json:"mfa_required"`
+	MFAToken    string `json:"mfa_token"`
+}
+
+type UserLoginMFARequest struct {
+	MFAToken string `json:"mfa_token"`
+	Code     string `json:"code"`
+}
+
+type UserMFACodeRequest struct {
+	Code string `json:"code"`
+}
+
+type UserMFAEnrollResponse struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"`
+}
+
+type UserRecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type UserTokenCreateRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+	// seconds until the token expires, 0 means never
+	ExpiresIn int64 `json:"expires_in"`
+}
+
+type UserTokenResponse struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+type UserSessionResponse struct {
+	ID         string    `json:"id"`
+	Label      string    `json:"label"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	Current    bool      `json:"current"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type UserTokenCreateResponse struct {
+	*UserTokenResponse
+	Token string `json:"token"`
+}
+
+type UserDeleteRequest struct {
+	CurrentPassword string `json:"password"`
+}
+
+// PasswordRejectedResponse tells why a new password was rejected, so clients can show it next to the field.
+type PasswordRejectedResponse struct {
+	Message string   `json:"message"`
+	Reasons []string `json:"reasons"`
+}
+
+type UserExportResponse struct {
+	User       *UserExportProfile   `json:"user"`
+	Profile    *UserProfileResponse `json:"profile"`
+	Todos      []*TodoResponse      `json:"todos"`
+	Tags       []*TagResponse       `json:"tags"`
+	ExportedAt time.Time            `json:"exported_at"`
+}
+
+type UserExportProfile struct {
+	ID         string     `json:"id"`
+	Email      string     `json:"email"`
+	Roles      []string   `json:"roles"`
+	VerifiedAt *time.Time `json:"verified_at"`
+	CreatedAt  time.Time  `json:"created_at"`
 }
@@ -0,0 +1,179 @@
+package rest
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/org39/webapp-tutorial-backend/entity"
+	"github.com/org39/webapp-tutorial-backend/presenter/rest/rr"
+	"github.com/org39/webapp-tutorial-backend/usecase/todo"
+	"github.com/org39/webapp-tutorial-backend/usecase/user"
+
+	"github.com/labstack/echo/v4"
+	"github.com/org39/webapp-tutorial-backend/pkg/log"
+)
+
+type TagDispatcher struct {
+	TodoUsecase    todo.Usecase    `inject:""`
+	UserUsecase    user.Usecase    `inject:""`
+	AuthMiddleware *AuthMiddleware `inject:""`
+}
+
+func (d *TagDispatcher) Dispatch(e *echo.Echo) {
+	auth := d.AuthMiddleware.Middleware()
+	verified := d.AuthMiddleware.VerifiedMiddleware()
+	read := d.AuthMiddleware.ScopeMiddleware(entity.ScopeTodosRead)
+	write := d.AuthMiddleware.ScopeMiddleware(entity.ScopeTodosWrite)
+
+	e.GET("tags", d.GetAllByUser(), auth, read, verified)
+	e.GET("tags/:id", d.GetByID(), auth, read, verified)
+	e.POST("tags", d.Create(), auth, write, verified)
+	e.PATCH("tags/:id", d.UpdateByID(), auth, write, verified)
+	e.DELETE("tags/:id", d.DeleteByID(), auth, write, verified)
+}
+
+func (d *TagDispatcher) GetAllByUser() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+		ctx := req.Context()
+		logger := log.LoggerWithSpan(ctx)
+
+		authCtx, ok := c.(*AuthorizedContext)
+		if !ok {
+			logger.WithError(errors.New("invalid authorized context")).Error()
+			return echo.NewHTTPError(http.StatusInternalServerError)
+		}
+		user, err := d.UserUsecase.FetchByID(ctx, authCtx.UserID())
+		if err != nil {
+			return toHTTPError(logger, err)
+		}
+
+		tags, err := d.TodoUsecase.FetchTagsByUser(ctx, user)
+		if err != nil {
+			return toTodoHTTPError(logger, err)
+		}
+
+		return c.JSON(http.StatusOK,
+			rr.NewFactory().NewTagsResponse(tags),
+		)
+	}
+}
+
+func (d *TagDispatcher) GetByID() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+		ctx := req.Context()
+		logger := log.LoggerWithSpan(ctx)
+
+		authCtx, ok := c.(*AuthorizedContext)
+		if !ok {
+			logger.WithError(errors.New("invalid authorized context")).Error()
+			return echo.NewHTTPError(http.StatusInternalServerError)
+		}
+		user, err := d.UserUsecase.FetchByID(ctx, authCtx.UserID())
+		if err != nil {
+			return toHTTPError(logger, err)
+		}
+
+		id := c.Param("id")
+		tag, err := d.TodoUsecase.FetchTagByID(ctx, user, id)
+		if err != nil {
+			return toTodoHTTPError(logger, err)
+		}
+
+		return c.JSON(http.StatusOK,
+			rr.NewFactory().NewTagResponse(tag),
+		)
+	}
+}
+
+func (d *TagDispatcher) Create() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+		ctx := req.Context()
+		logger := log.LoggerWithSpan(ctx)
+
+		authCtx, ok := c.(*AuthorizedContext)
+		if !ok {
+			logger.WithError(errors.New("invalid authorized context")).Error()
+			return echo.NewHTTPError(http.StatusInternalServerError)
+		}
+		user, err := d.UserUsecase.FetchByID(ctx, authCtx.UserID())
+		if err != nil {
+			return toHTTPError(logger, err)
+		}
+
+		payload, err := rr.NewFactory().NewTagCreateRequest(c)
+		if err != nil {
+			return c.NoContent(http.StatusBadRequest)
+		}
+
+		tag, err := d.TodoUsecase.CreateTag(ctx, user, payload.Name, payload.Color)
+		if err != nil {
+			return toTodoHTTPError(logger, err)
+		}
+
+		return c.JSON(http.StatusCreated,
+			rr.NewFactory().NewTagResponse(tag),
+		)
+	}
+}
+
+func (d *TagDispatcher) UpdateByID() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+		ctx := req.Context()
+		logger := log.LoggerWithSpan(ctx)
+
+		authCtx, ok := c.(*AuthorizedContext)
+		if !ok {
+			logger.WithError(errors.New("invalid authorized context")).Error()
+			return echo.NewHTTPError(http.StatusInternalServerError)
+		}
+		user, err := d.UserUsecase.FetchByID(ctx, authCtx.UserID())
+		if err != nil {
+			return toHTTPError(logger, err)
+		}
+
+		id := c.Param("id")
+		payload, err := rr.NewFactory().NewTagUpdateRequest(c)
+		if err != nil {
+			return c.NoContent(http.StatusBadRequest)
+		}
+
+		update := entity.NewFactory().NewTagUpdate(payload.Name, payload.Color)
+		tag, err := d.TodoUsecase.UpdateTag(ctx, user, id, update)
+		if err != nil {
+			return toTodoHTTPError(logger, err)
+		}
+
+		return c.JSON(http.StatusOK,
+			rr.NewFactory().NewTagResponse(tag),
+		)
+	}
+}
+
+func (d *TagDispatcher) DeleteByID() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+		ctx := req.Context()
+		logger := log.LoggerWithSpan(ctx)
+
+		authCtx, ok := c.(*AuthorizedContext)
+		if !ok {
+			logger.WithError(errors.New("invalid authorized context")).Error()
+			return echo.NewHTTPError(http.StatusInternalServerError)
+		}
+		user, err := d.UserUsecase.FetchByID(ctx, authCtx.UserID())
+		if err != nil {
+			return toHTTPError(logger, err)
+		}
+
+		id := c.Param("id")
+		if err := d.TodoUsecase.DeleteTag(ctx, user, id); err != nil {
+			return toTodoHTTPError(logger, err)
+		}
+
+		return c.NoContent(http.StatusOK)
+	}
+}
@@ -2,8 +2,10 @@ package rest
 
 import (
 	"errors"
+	"fmt"
 	"net/http"
 
+	"github.com/org39/webapp-tutorial-backend/entity"
 	"github.com/org39/webapp-tutorial-backend/presenter/rest/rr"
 	"github.com/org39/webapp-tutorial-backend/usecase/todo"
 	"github.com/org39/webapp-tutorial-backend/usecase/user"
@@ -12,6 +14,10 @@ import (
 	"github.com/org39/webapp-tutorial-backend/pkg/log"
 )
 
+const (
+	headerLink = "Link"
+)
+
 type TodoDispatcher struct {
 	TodoUsecase    todo.Usecase    `inject:""`
 	UserUsecase    user.Usecase    `inject:""`
@@ -20,12 +26,18 @@ type TodoDispatcher struct {
 
 func (d *TodoDispatcher) Dispatch(e *echo.Echo) {
 	auth := d.AuthMiddleware.Middleware()
-
-	e.GET("todos", d.GetAllByUser(), auth)
-	e.GET("todos/:id", d.GetByID(), auth)
-	e.POST("todos", d.Create(), auth)
-	e.PUT("todos/:id", d.UpdateByID(), auth)
-	e.DELETE("todos/:id", d.DeleteByID(), auth)
+	verified := d.AuthMiddleware.VerifiedMiddleware()
+	read := d.AuthMiddleware.ScopeMiddleware(entity.ScopeTodosRead)
+	write := d.AuthMiddleware.ScopeMiddleware(entity.ScopeTodosWrite)
+
+	e.GET("todos", d.GetAllByUser(), auth, read, verified)
+	e.GET("todos/search", d.Search(), auth, read, verified)
+	e.GET("todos/:id", d.GetByID(), auth, read, verified)
+	e.POST("todos", d.Create(), auth, write, verified)
+	e.PUT("todos/:id", d.UpdateByID(), auth, write, verified)
+	e.DELETE("todos/:id", d.DeleteByID(), auth, write, verified)
+	e.PUT("todos/:id/tags/:tag_id", d.AttachTag(), auth, write, verified)
+	e.DELETE("todos/:id/tags/:tag_id", d.DetachTag(), auth, write, verified)
 }
 
 func (d *TodoDispatcher) GetAllByUser() echo.HandlerFunc {
@@ -44,13 +56,66 @@ func (d *TodoDispatcher) GetAllByUser() echo.HandlerFunc {
 			return toHTTPError(logger, err)
 		}
 
-		todos, err := d.TodoUsecase.FetchAllByUser(ctx, user, false, false)
+		payload, err := rr.NewFactory().NewTodoListRequest(c)
+		if err != nil {
+			return c.NoContent(http.StatusBadRequest)
+		}
+
+		var after *entity.TodoCursor
+		if payload.Cursor != "" {
+			after, err = entity.NewFactory().NewTodoCursorFromString(payload.Cursor)
+			if err != nil {
+				return c.NoContent(http.StatusBadRequest)
+			}
+		}
+
+		filter := entity.NewFactory().NewTodoFilter(payload.Status, payload.Deleted,
+			payload.CreatedAfter, payload.CreatedBefore, payload.UpdatedAfter, payload.UpdatedBefore, payload.Content, payload.Tags, payload.TagMatch)
+		sort := entity.NewFactory().NewTodoSort(payload.Sort, payload.Order)
+		page, err := d.TodoUsecase.FetchPageByUser(ctx, user, filter, sort, after, payload.Limit)
+		if err != nil {
+			return toTodoHTTPError(logger, err)
+		}
+
+		if page.Next != nil {
+			c.Response().Header().Set(headerLink, nextPageLink(c, page.Next.Encode()))
+		}
+
+		return c.JSON(http.StatusOK,
+			rr.NewFactory().NewTodoPageResponse(page),
+		)
+	}
+}
+
+func (d *TodoDispatcher) Search() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+		ctx := req.Context()
+		logger := log.LoggerWithSpan(ctx)
+
+		authCtx, ok := c.(*AuthorizedContext)
+		if !ok {
+			logger.WithError(errors.New("invalid authorized context")).Error()
+			return echo.NewHTTPError(http.StatusInternalServerError)
+		}
+		user, err := d.UserUsecase.FetchByID(ctx, authCtx.UserID())
+		if err != nil {
+			return toHTTPError(logger, err)
+		}
+
+		payload, err := rr.NewFactory().NewTodoSearchRequest(c)
+		if err != nil {
+			return c.NoContent(http.StatusBadRequest)
+		}
+
+		query := entity.NewFactory().NewTodoSearch(payload.Query, payload.Limit)
+		results, err := d.TodoUsecase.Search(ctx, user, query)
 		if err != nil {
 			return toTodoHTTPError(logger, err)
 		}
 
 		return c.JSON(http.StatusOK,
-			rr.NewFactory().NewTodosResponse(todos),
+			rr.NewFactory().NewTodoSearchResponse(results),
 		)
 	}
 }
@@ -76,7 +141,7 @@ func (d *TodoDispatcher) Create() echo.HandlerFunc {
 			return c.NoContent(http.StatusBadRequest)
 		}
 
-		todo, err := d.TodoUsecase.Create(ctx, user, payload.Content)
+		todo, err := d.TodoUsecase.Create(ctx, user, payload.Content, payload.DueAt, payload.Priority, payload.Position)
 		if err != nil {
 			return toTodoHTTPError(logger, err)
 		}
@@ -137,7 +202,7 @@ func (d *TodoDispatcher) UpdateByID() echo.HandlerFunc {
 			return c.NoContent(http.StatusBadRequest)
 		}
 
-		todo, err := d.TodoUsecase.Update(ctx, user, id, payload.Content, payload.Completed, payload.Deleted)
+		todo, err := d.TodoUsecase.Update(ctx, user, id, payload.Content, payload.Completed, payload.Deleted, payload.DueAt, payload.Priority, payload.Position)
 		if err != nil {
 			return toTodoHTTPError(logger, err)
 		}
@@ -173,6 +238,70 @@ func (d *TodoDispatcher) DeleteByID() echo.HandlerFunc {
 	}
 }
 
+func (d *TodoDispatcher) AttachTag() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+		ctx := req.Context()
+		logger := log.LoggerWithSpan(ctx)
+
+		authCtx, ok := c.(*AuthorizedContext)
+		if !ok {
+			logger.WithError(errors.New("invalid authorized context")).Error()
+			return echo.NewHTTPError(http.StatusInternalServerError)
+		}
+		user, err := d.UserUsecase.FetchByID(ctx, authCtx.UserID())
+		if err != nil {
+			return toHTTPError(logger, err)
+		}
+
+		todo, err := d.TodoUsecase.AttachTag(ctx, user, c.Param("id"), c.Param("tag_id"))
+		if err != nil {
+			return toTodoHTTPError(logger, err)
+		}
+
+		return c.JSON(http.StatusOK,
+			rr.NewFactory().NewTodoResponse(todo),
+		)
+	}
+}
+
+func (d *TodoDispatcher) DetachTag() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+		ctx := req.Context()
+		logger := log.LoggerWithSpan(ctx)
+
+		authCtx, ok := c.(*AuthorizedContext)
+		if !ok {
+			logger.WithError(errors.New("invalid authorized context")).Error()
+			return echo.NewHTTPError(http.StatusInternalServerError)
+		}
+		user, err := d.UserUsecase.FetchByID(ctx, authCtx.UserID())
+		if err != nil {
+			return toHTTPError(logger, err)
+		}
+
+		todo, err := d.TodoUsecase.DetachTag(ctx, user, c.Param("id"), c.Param("tag_id"))
+		if err != nil {
+			return toTodoHTTPError(logger, err)
+		}
+
+		return c.JSON(http.StatusOK,
+			rr.NewFactory().NewTodoResponse(todo),
+		)
+	}
+}
+
+// nextPageLink returns a Link header to the same listing continued after the cursor, as in RFC 8288.
+func nextPageLink(c echo.Context, cursor string) string {
+	u := *c.Request().URL
+	q := u.Query()
+	q.Set("cursor", cursor)
+	u.RawQuery = q.Encode()
+
+	return fmt.Sprintf(`<%s>; rel="next"`, u.RequestURI())
+}
+
 func toTodoHTTPError(logger *log.Logger, err error) error {
 	// errors defined in usecase
 	switch {
@@ -1,9 +1,28 @@
 package rest
 
 import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/org39/webapp-tutorial-backend/entity"
+	"github.com/org39/webapp-tutorial-backend/pkg/clientinfo"
+	"github.com/org39/webapp-tutorial-backend/pkg/cookie"
+	"github.com/org39/webapp-tutorial-backend/pkg/crypt"
 	"github.com/org39/webapp-tutorial-backend/presenter/rest/rr"
 	"github.com/org39/webapp-tutorial-backend/usecase/auth"
 	"github.com/org39/webapp-tutorial-backend/usecase/user"
@@ -14,29 +33,78 @@ import (
 
 const (
 	refreshTokenCookie = "refresh_token"
+	csrfTokenCookie    = "csrf_token"
+	oauthFlowCookie    = "oauth_flow"
+	headerRetryAfter   = "Retry-After"
+	headerCSRFToken    = "X-CSRF-Token"
+	headerCacheControl = "Cache-Control"
+
+	// name of the JSON document in the archive of GET user/export
+	exportFileName = "export.json"
+
+	// time the user has to log in at the provider
+	oauthFlowMaxAge = 10 * time.Minute
+
+	// multipart field of PUT user/avatar
+	avatarFormField = "avatar"
+	// the content behind an avatar id never changes
+	avatarCacheControl = "public, max-age=31536000, immutable"
 )
 
 type UserDispatcher struct {
 	UserUsecase        user.Usecase    `inject:""`
 	AuthUsercase       auth.Usecase    `inject:""`
 	AuthMiddleware     *AuthMiddleware `inject:""`
-	SecureRefreshToken bool            `inject:"rest.auth.secure_refresh_token"`
+	RefreshTokenCookie *cookie.Policy  `inject:"rest.auth.refresh_token_cookie"`
+	CSRFCookie         *cookie.Policy  `inject:"rest.auth.csrf_cookie"`
+	TrustProxyHeaders  bool            `inject:"rest.trust_proxy_headers"`
+	OAuthRedirectURL   string          `inject:"rest.oauth.redirect_url"`
 	Logger             *log.Logger     `inject:""`
 }
 
 func (d *UserDispatcher) Dispatch(e *echo.Echo) {
 	auth := d.AuthMiddleware.Middleware()
+	read := d.AuthMiddleware.ScopeMiddleware(entity.ScopeUserRead)
+	write := d.AuthMiddleware.ScopeMiddleware(entity.ScopeUserWrite)
+	csrf := d.CSRFMiddleware()
 
-	e.GET("user", d.GetUser(), auth)
+	e.GET("user", d.GetUser(), auth, read)
+	e.DELETE("user", d.DeleteUser(), auth, write)
+	e.GET("user/export", d.Export(), auth, read)
 	e.POST("user/register", d.Register())
 	e.POST("user/login", d.Login())
-	e.POST("user/refresh", d.Refresh())
+	e.POST("user/login/mfa", d.LoginMFA())
+	e.POST("user/magic-link", d.RequestMagicLink())
+	e.POST("user/magic-link/consume", d.MagicLinkLogin())
+	e.GET("user/oauth/:provider/start", d.OAuthStart())
+	e.GET("user/oauth/:provider/callback", d.OAuthCallback())
+	e.POST("user/refresh", d.Refresh(), csrf)
+	e.POST("user/logout", d.Logout(), csrf)
+	e.POST("user/logout-all", d.LogoutAll(), auth, write)
+	e.POST("user/password/forgot", d.ForgotPassword())
+	e.POST("user/password/reset", d.ResetPassword())
+	e.PUT("user/password", d.ChangePassword(), auth, write)
+	e.PUT("user/email", d.ChangeEmail(), auth, write)
+	e.POST("user/verify", d.VerifyEmail())
+	e.POST("user/verify/resend", d.ResendVerification(), auth, write)
+	e.POST("user/mfa/enroll", d.EnrollMFA(), auth, write)
+	e.POST("user/mfa/confirm", d.ConfirmMFA(), auth, write)
+	e.POST("user/mfa/recovery-codes", d.RegenerateRecoveryCodes(), auth, write)
+	e.POST("user/mfa/disable", d.DisableMFA(), auth, write)
+	e.POST("user/tokens", d.CreateToken(), auth, write)
+	e.GET("user/tokens", d.ListTokens(), auth, read)
+	e.DELETE("user/tokens/:id", d.RevokeToken(), auth, write)
+	e.GET("user/sessions", d.ListSessions(), auth, read)
+	e.DELETE("user/sessions/:id", d.RevokeSession(), auth, write)
+	e.PATCH("user", d.UpdateProfile(), auth, write)
+	e.PUT("user/avatar", d.SetAvatar(), auth, write)
+	e.DELETE("user/avatar", d.DeleteAvatar(), auth, write)
+	e.GET("avatars/:id", d.GetAvatar())
 }
 
 func (d *UserDispatcher) Register() echo.HandlerFunc {
 	return func(c echo.Context) error {
-		req := c.Request()
-		ctx := req.Context()
+		ctx := d.clientContext(c)
 		logger := log.LoggerWithSpan(ctx)
 
 		payload := rr.NewFactory().NewUserSignUpRequest("", "")
@@ -50,13 +118,7 @@ func (d *UserDispatcher) Register() echo.HandlerFunc {
 		}
 
 		// set refresh token as cookie
-		cookie := new(http.Cookie)
-		cookie.Name = refreshTokenCookie
-		cookie.Value = tokens.RefreshToken
-		if d.SecureRefreshToken {
-			cookie.Secure = true
-		}
-		c.SetCookie(cookie)
+		d.setRefreshTokenCookie(c, tokens.RefreshToken)
 
 		return c.JSON(http.StatusCreated,
 			rr.NewFactory().NewUserSignUpResponse(user.Email, user.CreatedAt, tokens.AccessToken),
@@ -66,8 +128,7 @@ func (d *UserDispatcher) Register() echo.HandlerFunc {
 
 func (d *UserDispatcher) Login() echo.HandlerFunc {
 	return func(c echo.Context) error {
-		req := c.Request()
-		ctx := req.Context()
+		ctx := d.clientContext(c)
 		logger := log.LoggerWithSpan(ctx)
 
 		payload := rr.NewFactory().NewUserLoginRequest("", "")
@@ -75,19 +136,46 @@ func (d *UserDispatcher) Login() echo.HandlerFunc {
 			return c.NoContent(http.StatusBadRequest)
 		}
 
-		tokens, err := d.UserUsecase.Login(ctx, payload.Email, payload.PlainPassword)
+		tokens, challenge, err := d.UserUsecase.Login(ctx, payload.Email, payload.PlainPassword, d.clientIP(c))
 		if err != nil {
+			setRetryAfterHeader(c, err)
 			return toHTTPError(logger, err)
 		}
 
+		// second factor required, tokens are issued by LoginMFA
+		if challenge != nil {
+			return c.JSON(http.StatusOK,
+				rr.NewFactory().NewUserMFAChallengeResponse(challenge.Token),
+			)
+		}
+
 		// set refresh token as cookie
-		cookie := new(http.Cookie)
-		cookie.Name = refreshTokenCookie
-		cookie.Value = tokens.RefreshToken
-		if d.SecureRefreshToken {
-			cookie.Secure = true
+		d.setRefreshTokenCookie(c, tokens.RefreshToken)
+
+		return c.JSON(http.StatusOK,
+			rr.NewFactory().NewUserLoginResponse(tokens.AccessToken),
+		)
+	}
+}
+
+func (d *UserDispatcher) LoginMFA() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		ctx := d.clientContext(c)
+		logger := log.LoggerWithSpan(ctx)
+
+		payload := rr.NewFactory().NewUserLoginMFARequest("", "")
+		if err := c.Bind(payload); err != nil {
+			return c.NoContent(http.StatusBadRequest)
+		}
+
+		tokens, err := d.UserUsecase.LoginMFA(ctx, payload.MFAToken, payload.Code)
+		if err != nil {
+			setRetryAfterHeader(c, err)
+			return toHTTPError(logger, err)
 		}
-		c.SetCookie(cookie)
+
+		// set refresh token as cookie
+		d.setRefreshTokenCookie(c, tokens.RefreshToken)
 
 		return c.JSON(http.StatusOK,
 			rr.NewFactory().NewUserLoginResponse(tokens.AccessToken),
@@ -95,12 +183,121 @@ func (d *UserDispatcher) Login() echo.HandlerFunc {
 	}
 }
 
-func (d *UserDispatcher) Refresh() echo.HandlerFunc {
+func (d *UserDispatcher) RequestMagicLink() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+		ctx := req.Context()
+		logger := log.LoggerWithSpan(ctx)
+
+		payload := rr.NewFactory().NewUserMagicLinkRequest("")
+		if err := c.Bind(payload); err != nil {
+			return c.NoContent(http.StatusBadRequest)
+		}
+
+		if err := d.UserUsecase.RequestMagicLink(ctx, payload.Email); err != nil {
+			return toHTTPError(logger, err)
+		}
+
+		// same response whether the email exists or not
+		return c.NoContent(http.StatusAccepted)
+	}
+}
+
+func (d *UserDispatcher) MagicLinkLogin() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		ctx := d.clientContext(c)
+		logger := log.LoggerWithSpan(ctx)
+
+		payload := rr.NewFactory().NewUserMagicLinkLoginRequest("")
+		if err := c.Bind(payload); err != nil {
+			return c.NoContent(http.StatusBadRequest)
+		}
+
+		tokens, challenge, err := d.UserUsecase.MagicLinkLogin(ctx, payload.Token)
+		if err != nil {
+			return toHTTPError(logger, err)
+		}
+
+		// second factor required, tokens are issued by LoginMFA
+		if challenge != nil {
+			return c.JSON(http.StatusOK,
+				rr.NewFactory().NewUserMFAChallengeResponse(challenge.Token),
+			)
+		}
+
+		// set refresh token as cookie
+		d.setRefreshTokenCookie(c, tokens.RefreshToken)
+
+		return c.JSON(http.StatusOK,
+			rr.NewFactory().NewUserLoginResponse(tokens.AccessToken),
+		)
+	}
+}
+
+func (d *UserDispatcher) OAuthStart() echo.HandlerFunc {
 	return func(c echo.Context) error {
 		req := c.Request()
 		ctx := req.Context()
 		logger := log.LoggerWithSpan(ctx)
 
+		flow, authURL, err := d.UserUsecase.StartOAuthLogin(ctx, c.Param("provider"))
+		if err != nil {
+			return toHTTPError(logger, err)
+		}
+
+		if err := d.setOAuthFlowCookie(c, flow); err != nil {
+			logger.WithError(err).Error()
+			return echo.NewHTTPError(http.StatusInternalServerError)
+		}
+
+		return c.Redirect(http.StatusFound, authURL)
+	}
+}
+
+// OAuthCallback completes the login and sends the user agent back to the frontend.
+// The outcome is in the fragment of the redirect, the refresh token in its cookie.
+func (d *UserDispatcher) OAuthCallback() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		ctx := d.clientContext(c)
+		logger := log.LoggerWithSpan(ctx)
+
+		// single use, whatever the outcome
+		flow := d.oauthFlowFromCookie(c)
+		d.clearOAuthFlowCookie(c)
+
+		// the user denied access at the provider, or the provider failed
+		if e := c.QueryParam("error"); e != "" {
+			if e != "access_denied" {
+				e = "provider_error"
+			}
+			return d.redirectOAuthResult(c, "error", e)
+		}
+
+		tokens, challenge, err := d.UserUsecase.OAuthLogin(ctx, flow, c.Param("provider"), c.QueryParam("state"), c.QueryParam("code"))
+		if err != nil {
+			code := http.StatusInternalServerError
+			var he *echo.HTTPError
+			if errors.As(toHTTPError(logger, err), &he) {
+				code = he.Code
+			}
+			return d.redirectOAuthResult(c, "error", strings.ToLower(strings.ReplaceAll(http.StatusText(code), " ", "_")))
+		}
+
+		// second factor required, tokens are issued by LoginMFA
+		if challenge != nil {
+			return d.redirectOAuthResult(c, "mfa_token", challenge.Token)
+		}
+
+		d.setRefreshTokenCookie(c, tokens.RefreshToken)
+		return c.Redirect(http.StatusFound, d.OAuthRedirectURL)
+	}
+}
+
+func (d *UserDispatcher) Refresh() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		ctx := d.clientContext(c)
+		logger := log.LoggerWithSpan(ctx)
+
 		cookie, err := c.Cookie(refreshTokenCookie)
 		if err != nil {
 			return toHTTPError(logger, err)
@@ -113,13 +310,7 @@ func (d *UserDispatcher) Refresh() echo.HandlerFunc {
 		}
 
 		// set refresh token as cookie
-		newCookie := new(http.Cookie)
-		newCookie.Name = refreshTokenCookie
-		newCookie.Value = tokens.RefreshToken
-		if d.SecureRefreshToken {
-			newCookie.Secure = true
-		}
-		c.SetCookie(newCookie)
+		d.setRefreshTokenCookie(c, tokens.RefreshToken)
 
 		return c.JSON(http.StatusOK,
 			rr.NewFactory().NewUserRefreshResponse(tokens.AccessToken),
@@ -127,7 +318,30 @@ func (d *UserDispatcher) Refresh() echo.HandlerFunc {
 	}
 }
 
-func (d *UserDispatcher) GetUser() echo.HandlerFunc {
+func (d *UserDispatcher) Logout() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+		ctx := req.Context()
+		logger := log.LoggerWithSpan(ctx)
+
+		// logout is idempotent, missing or already invalid token just clears the cookie
+		cookie, err := c.Cookie(refreshTokenCookie)
+		if err == nil {
+			err = d.UserUsecase.Logout(ctx, cookie.Value)
+			switch {
+			case errors.Is(err, user.ErrUnauthorized):
+			case errors.Is(err, user.ErrInvalidRequest):
+			case err != nil:
+				return toHTTPError(logger, err)
+			}
+		}
+
+		d.clearRefreshTokenCookie(c)
+		return c.NoContent(http.StatusNoContent)
+	}
+}
+
+func (d *UserDispatcher) LogoutAll() echo.HandlerFunc {
 	return func(c echo.Context) error {
 		req := c.Request()
 		ctx := req.Context()
@@ -138,35 +352,780 @@ func (d *UserDispatcher) GetUser() echo.HandlerFunc {
 			logger.WithError(errors.New("invalid authorized context")).Error()
 			return echo.NewHTTPError(http.StatusInternalServerError)
 		}
-		user, err := d.UserUsecase.FetchByID(ctx, authCtx.UserID())
+
+		if err := d.UserUsecase.LogoutAll(ctx, authCtx.UserID()); err != nil {
+			return toHTTPError(logger, err)
+		}
+
+		d.clearRefreshTokenCookie(c)
+		return c.NoContent(http.StatusNoContent)
+	}
+}
+
+func (d *UserDispatcher) ForgotPassword() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+		ctx := req.Context()
+		logger := log.LoggerWithSpan(ctx)
+
+		payload := rr.NewFactory().NewUserForgotPasswordRequest("")
+		if err := c.Bind(payload); err != nil {
+			return c.NoContent(http.StatusBadRequest)
+		}
+
+		if err := d.UserUsecase.RequestPasswordReset(ctx, payload.Email); err != nil {
+			return toHTTPError(logger, err)
+		}
+
+		// same response whether the email exists or not
+		return c.NoContent(http.StatusAccepted)
+	}
+}
+
+func (d *UserDispatcher) ResetPassword() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+		ctx := req.Context()
+		logger := log.LoggerWithSpan(ctx)
+
+		payload := rr.NewFactory().NewUserResetPasswordRequest("", "")
+		if err := c.Bind(payload); err != nil {
+			return c.NoContent(http.StatusBadRequest)
+		}
+
+		if err := d.UserUsecase.ResetPassword(ctx, payload.Token, payload.PlainPassword); err != nil {
+			return toHTTPError(logger, err)
+		}
+
+		// every session was revoked
+		d.clearRefreshTokenCookie(c)
+		return c.NoContent(http.StatusNoContent)
+	}
+}
+
+func (d *UserDispatcher) ChangePassword() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		ctx := d.clientContext(c)
+		logger := log.LoggerWithSpan(ctx)
+
+		authCtx, ok := c.(*AuthorizedContext)
+		if !ok {
+			logger.WithError(errors.New("invalid authorized context")).Error()
+			return echo.NewHTTPError(http.StatusInternalServerError)
+		}
+
+		payload := rr.NewFactory().NewUserChangePasswordRequest("", "")
+		if err := c.Bind(payload); err != nil {
+			return c.NoContent(http.StatusBadRequest)
+		}
+
+		tokens, err := d.UserUsecase.ChangePassword(ctx, authCtx.UserID(), payload.CurrentPassword, payload.PlainPassword)
 		if err != nil {
+			setRetryAfterHeader(c, err)
 			return toHTTPError(logger, err)
 		}
 
+		// every other session was revoked, this one continues with new tokens
+		d.setRefreshTokenCookie(c, tokens.RefreshToken)
+
 		return c.JSON(http.StatusOK,
-			rr.NewFactory().NewUserResponse(user.Email, user.CreatedAt))
+			rr.NewFactory().NewUserLoginResponse(tokens.AccessToken),
+		)
 	}
 }
 
-func toHTTPError(logger *log.Logger, err error) error {
-	switch {
-	// errors defined in usecase
-	case errors.Is(err, user.ErrInvalidRequest):
-		return echo.NewHTTPError(http.StatusBadRequest)
+func (d *UserDispatcher) ChangeEmail() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+		ctx := req.Context()
+		logger := log.LoggerWithSpan(ctx)
 
-	case errors.Is(err, user.ErrNotFound):
-		return echo.NewHTTPError(http.StatusNotFound)
+		authCtx, ok := c.(*AuthorizedContext)
+		if !ok {
+			logger.WithError(errors.New("invalid authorized context")).Error()
+			return echo.NewHTTPError(http.StatusInternalServerError)
+		}
 
-	case errors.Is(err, user.ErrSystemError):
-		logger.WithError(err).Error()
-		return echo.NewHTTPError(http.StatusInternalServerError)
+		payload := rr.NewFactory().NewUserChangeEmailRequest("", "")
+		if err := c.Bind(payload); err != nil {
+			return c.NoContent(http.StatusBadRequest)
+		}
 
-	case errors.Is(err, user.ErrDatabaseError):
-		logger.WithError(err).Error()
-		return echo.NewHTTPError(http.StatusInternalServerError)
+		user, err := d.UserUsecase.ChangeEmail(ctx, authCtx.UserID(), authCtx.SessionID(), payload.CurrentPassword, payload.Email)
+		if err != nil {
+			setRetryAfterHeader(c, err)
+			return toHTTPError(logger, err)
+		}
 
-	case errors.Is(err, user.ErrUnauthorized):
-		return echo.NewHTTPError(http.StatusUnauthorized)
+		profile, err := d.UserUsecase.FetchProfile(ctx, user.ID)
+		if err != nil {
+			return toHTTPError(logger, err)
+		}
+
+		return c.JSON(http.StatusOK,
+			rr.NewFactory().NewUserResponse(user.Email, user.Verified(), user.CreatedAt, profile))
+	}
+}
+
+func (d *UserDispatcher) VerifyEmail() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+		ctx := req.Context()
+		logger := log.LoggerWithSpan(ctx)
+
+		payload := rr.NewFactory().NewUserVerifyRequest("")
+		if err := c.Bind(payload); err != nil {
+			return c.NoContent(http.StatusBadRequest)
+		}
+
+		if err := d.UserUsecase.VerifyEmail(ctx, payload.Token); err != nil {
+			return toHTTPError(logger, err)
+		}
+
+		return c.NoContent(http.StatusNoContent)
+	}
+}
+
+func (d *UserDispatcher) ResendVerification() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+		ctx := req.Context()
+		logger := log.LoggerWithSpan(ctx)
+
+		authCtx, ok := c.(*AuthorizedContext)
+		if !ok {
+			logger.WithError(errors.New("invalid authorized context")).Error()
+			return echo.NewHTTPError(http.StatusInternalServerError)
+		}
+
+		if err := d.UserUsecase.ResendVerification(ctx, authCtx.UserID()); err != nil {
+			return toHTTPError(logger, err)
+		}
+
+		return c.NoContent(http.StatusAccepted)
+	}
+}
+
+func (d *UserDispatcher) EnrollMFA() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+		ctx := req.Context()
+		logger := log.LoggerWithSpan(ctx)
+
+		authCtx, ok := c.(*AuthorizedContext)
+		if !ok {
+			logger.WithError(errors.New("invalid authorized context")).Error()
+			return echo.NewHTTPError(http.StatusInternalServerError)
+		}
+
+		enrollment, err := d.UserUsecase.EnrollMFA(ctx, authCtx.UserID())
+		if err != nil {
+			return toHTTPError(logger, err)
+		}
+
+		return c.JSON(http.StatusOK,
+			rr.NewFactory().NewUserMFAEnrollResponse(enrollment.Secret, enrollment.URI),
+		)
+	}
+}
+
+func (d *UserDispatcher) ConfirmMFA() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+		ctx := req.Context()
+		logger := log.LoggerWithSpan(ctx)
+
+		authCtx, ok := c.(*AuthorizedContext)
+		if !ok {
+			logger.WithError(errors.New("invalid authorized context")).Error()
+			return echo.NewHTTPError(http.StatusInternalServerError)
+		}
+
+		payload := rr.NewFactory().NewUserMFACodeRequest("")
+		if err := c.Bind(payload); err != nil {
+			return c.NoContent(http.StatusBadRequest)
+		}
+
+		codes, err := d.UserUsecase.ConfirmMFA(ctx, authCtx.UserID(), payload.Code)
+		if err != nil {
+			return toHTTPError(logger, err)
+		}
+
+		return c.JSON(http.StatusOK,
+			rr.NewFactory().NewUserRecoveryCodesResponse(codes),
+		)
+	}
+}
+
+func (d *UserDispatcher) RegenerateRecoveryCodes() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+		ctx := req.Context()
+		logger := log.LoggerWithSpan(ctx)
+
+		authCtx, ok := c.(*AuthorizedContext)
+		if !ok {
+			logger.WithError(errors.New("invalid authorized context")).Error()
+			return echo.NewHTTPError(http.StatusInternalServerError)
+		}
+
+		payload := rr.NewFactory().NewUserMFACodeRequest("")
+		if err := c.Bind(payload); err != nil {
+			return c.NoContent(http.StatusBadRequest)
+		}
+
+		codes, err := d.UserUsecase.RegenerateRecoveryCodes(ctx, authCtx.UserID(), payload.Code)
+		if err != nil {
+			setRetryAfterHeader(c, err)
+			return toHTTPError(logger, err)
+		}
+
+		return c.JSON(http.StatusOK,
+			rr.NewFactory().NewUserRecoveryCodesResponse(codes),
+		)
+	}
+}
+
+func (d *UserDispatcher) DisableMFA() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+		ctx := req.Context()
+		logger := log.LoggerWithSpan(ctx)
+
+		authCtx, ok := c.(*AuthorizedContext)
+		if !ok {
+			logger.WithError(errors.New("invalid authorized context")).Error()
+			return echo.NewHTTPError(http.StatusInternalServerError)
+		}
+
+		payload := rr.NewFactory().NewUserMFACodeRequest("")
+		if err := c.Bind(payload); err != nil {
+			return c.NoContent(http.StatusBadRequest)
+		}
+
+		if err := d.UserUsecase.DisableMFA(ctx, authCtx.UserID(), payload.Code); err != nil {
+			setRetryAfterHeader(c, err)
+			return toHTTPError(logger, err)
+		}
+
+		return c.NoContent(http.StatusNoContent)
+	}
+}
+
+func (d *UserDispatcher) CreateToken() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+		ctx := req.Context()
+		logger := log.LoggerWithSpan(ctx)
+
+		authCtx, ok := c.(*AuthorizedContext)
+		if !ok {
+			logger.WithError(errors.New("invalid authorized context")).Error()
+			return echo.NewHTTPError(http.StatusInternalServerError)
+		}
+
+		payload := rr.NewFactory().NewUserTokenCreateRequest("", nil, 0)
+		if err := c.Bind(payload); err != nil {
+			return c.NoContent(http.StatusBadRequest)
+		}
+
+		// a token can not hand out more than it was granted
+		if !authCtx.HasScopes(payload.Scopes...) {
+			return echo.NewHTTPError(http.StatusForbidden, "insufficient scope")
+		}
+
+		// reject values which would overflow a time.Duration
+		if payload.ExpiresIn > int64(math.MaxInt64/time.Second) {
+			return c.NoContent(http.StatusBadRequest)
+		}
+		duration := time.Duration(payload.ExpiresIn) * time.Second
+		token, err := d.UserUsecase.CreatePersonalAccessToken(ctx, authCtx.UserID(), payload.Name, payload.Scopes, duration)
+		if err != nil {
+			return toHTTPError(logger, err)
+		}
+
+		return c.JSON(http.StatusCreated,
+			rr.NewFactory().NewUserTokenCreateResponse(token),
+		)
+	}
+}
+
+func (d *UserDispatcher) ListTokens() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+		ctx := req.Context()
+		logger := log.LoggerWithSpan(ctx)
+
+		authCtx, ok := c.(*AuthorizedContext)
+		if !ok {
+			logger.WithError(errors.New("invalid authorized context")).Error()
+			return echo.NewHTTPError(http.StatusInternalServerError)
+		}
+
+		tokens, err := d.UserUsecase.ListPersonalAccessTokens(ctx, authCtx.UserID())
+		if err != nil {
+			return toHTTPError(logger, err)
+		}
+
+		return c.JSON(http.StatusOK,
+			rr.NewFactory().NewUserTokensResponse(tokens),
+		)
+	}
+}
+
+func (d *UserDispatcher) RevokeToken() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+		ctx := req.Context()
+		logger := log.LoggerWithSpan(ctx)
+
+		authCtx, ok := c.(*AuthorizedContext)
+		if !ok {
+			logger.WithError(errors.New("invalid authorized context")).Error()
+			return echo.NewHTTPError(http.StatusInternalServerError)
+		}
+
+		id := c.Param("id")
+		if err := d.UserUsecase.RevokePersonalAccessToken(ctx, authCtx.UserID(), id); err != nil {
+			return toHTTPError(logger, err)
+		}
+
+		return c.NoContent(http.StatusNoContent)
+	}
+}
+
+func (d *UserDispatcher) ListSessions() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+		ctx := req.Context()
+		logger := log.LoggerWithSpan(ctx)
+
+		authCtx, ok := c.(*AuthorizedContext)
+		if !ok {
+			logger.WithError(errors.New("invalid authorized context")).Error()
+			return echo.NewHTTPError(http.StatusInternalServerError)
+		}
+
+		sessions, err := d.UserUsecase.ListSessions(ctx, authCtx.UserID())
+		if err != nil {
+			return toHTTPError(logger, err)
+		}
+
+		return c.JSON(http.StatusOK,
+			rr.NewFactory().NewUserSessionsResponse(sessions, authCtx.SessionID()),
+		)
+	}
+}
+
+func (d *UserDispatcher) RevokeSession() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+		ctx := req.Context()
+		logger := log.LoggerWithSpan(ctx)
+
+		authCtx, ok := c.(*AuthorizedContext)
+		if !ok {
+			logger.WithError(errors.New("invalid authorized context")).Error()
+			return echo.NewHTTPError(http.StatusInternalServerError)
+		}
+
+		id := c.Param("id")
+		if err := d.UserUsecase.RevokeSession(ctx, authCtx.UserID(), id); err != nil {
+			return toHTTPError(logger, err)
+		}
+
+		// the current session ended, like a logout
+		if id == authCtx.SessionID() {
+			d.clearRefreshTokenCookie(c)
+		}
+
+		return c.NoContent(http.StatusNoContent)
+	}
+}
+
+func (d *UserDispatcher) GetUser() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+		ctx := req.Context()
+		logger := log.LoggerWithSpan(ctx)
+
+		authCtx, ok := c.(*AuthorizedContext)
+		if !ok {
+			logger.WithError(errors.New("invalid authorized context")).Error()
+			return echo.NewHTTPError(http.StatusInternalServerError)
+		}
+		user, err := d.UserUsecase.FetchByID(ctx, authCtx.UserID())
+		if err != nil {
+			return toHTTPError(logger, err)
+		}
+
+		profile, err := d.UserUsecase.FetchProfile(ctx, user.ID)
+		if err != nil {
+			return toHTTPError(logger, err)
+		}
+
+		return c.JSON(http.StatusOK,
+			rr.NewFactory().NewUserResponse(user.Email, user.Verified(), user.CreatedAt, profile))
+	}
+}
+
+func (d *UserDispatcher) UpdateProfile() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+		ctx := req.Context()
+		logger := log.LoggerWithSpan(ctx)
+
+		authCtx, ok := c.(*AuthorizedContext)
+		if !ok {
+			logger.WithError(errors.New("invalid authorized context")).Error()
+			return echo.NewHTTPError(http.StatusInternalServerError)
+		}
+
+		payload := rr.NewFactory().NewUserProfileUpdateRequest()
+		if err := c.Bind(payload); err != nil {
+			return c.NoContent(http.StatusBadRequest)
+		}
+
+		update := entity.NewFactory().NewUserProfileUpdate(payload.DisplayName, payload.TimeZone, payload.Locale, payload.Preferences)
+		profile, err := d.UserUsecase.UpdateProfile(ctx, authCtx.UserID(), update)
+		if err != nil {
+			return toHTTPError(logger, err)
+		}
+
+		return c.JSON(http.StatusOK, rr.NewFactory().NewUserProfileResponse(profile))
+	}
+}
+
+// SetAvatar accepts the image in the "avatar" field of a multipart form, or as the raw body.
+func (d *UserDispatcher) SetAvatar() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+		ctx := req.Context()
+		logger := log.LoggerWithSpan(ctx)
+
+		authCtx, ok := c.(*AuthorizedContext)
+		if !ok {
+			logger.WithError(errors.New("invalid authorized context")).Error()
+			return echo.NewHTTPError(http.StatusInternalServerError)
+		}
+
+		image, err := readAvatar(c)
+		if err != nil {
+			return c.NoContent(http.StatusBadRequest)
+		}
+		if len(image) > entity.MaxAvatarSize {
+			return c.NoContent(http.StatusRequestEntityTooLarge)
+		}
+
+		profile, err := d.UserUsecase.SetAvatar(ctx, authCtx.UserID(), image)
+		if err != nil {
+			return toHTTPError(logger, err)
+		}
+
+		return c.JSON(http.StatusOK, rr.NewFactory().NewUserProfileResponse(profile))
+	}
+}
+
+func (d *UserDispatcher) DeleteAvatar() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+		ctx := req.Context()
+		logger := log.LoggerWithSpan(ctx)
+
+		authCtx, ok := c.(*AuthorizedContext)
+		if !ok {
+			logger.WithError(errors.New("invalid authorized context")).Error()
+			return echo.NewHTTPError(http.StatusInternalServerError)
+		}
+
+		profile, err := d.UserUsecase.DeleteAvatar(ctx, authCtx.UserID())
+		if err != nil {
+			return toHTTPError(logger, err)
+		}
+
+		return c.JSON(http.StatusOK, rr.NewFactory().NewUserProfileResponse(profile))
+	}
+}
+
+// GetAvatar is public, avatar ids are random and change with every image.
+func (d *UserDispatcher) GetAvatar() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+		ctx := req.Context()
+		logger := log.LoggerWithSpan(ctx)
+
+		image, contentType, err := d.UserUsecase.FetchAvatar(ctx, c.Param("id"))
+		if err != nil {
+			return toHTTPError(logger, err)
+		}
+
+		c.Response().Header().Set(headerCacheControl, avatarCacheControl)
+		return c.Blob(http.StatusOK, contentType, image)
+	}
+}
+
+// CSRFMiddleware guards the routes authenticated by the refresh token cookie with a double-submit token.
+// The client sends the csrf cookie back in the X-CSRF-Token header, which cross-site pages can not read.
+func (d *UserDispatcher) CSRFMiddleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			// without the refresh token cookie, the request carries no credential to abuse
+			if _, err := c.Cookie(refreshTokenCookie); err != nil {
+				return next(c)
+			}
+
+			token := c.Request().Header.Get(headerCSRFToken)
+			cookie, err := c.Cookie(csrfTokenCookie)
+			if err != nil || len(token) == 0 || subtle.ConstantTimeCompare([]byte(token), []byte(cookie.Value)) != 1 {
+				return echo.NewHTTPError(http.StatusForbidden, "invalid csrf token")
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// setRefreshTokenCookie also issues a new csrf token, to be sent back with the refresh token.
+func (d *UserDispatcher) setRefreshTokenCookie(c echo.Context, refreshToken string) {
+	c.SetCookie(d.RefreshTokenCookie.Cookie(refreshTokenCookie, refreshToken))
+
+	csrfToken, err := crypt.NewToken()
+	if err != nil {
+		// the refresh token is unusable without it, the client has to log in again
+		log.LoggerWithSpan(c.Request().Context()).WithError(err).Error("fail to generate csrf token")
+		return
+	}
+	c.SetCookie(d.CSRFCookie.Cookie(csrfTokenCookie, csrfToken))
+}
+
+func (d *UserDispatcher) Export() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+		ctx := req.Context()
+		logger := log.LoggerWithSpan(ctx)
+
+		authCtx, ok := c.(*AuthorizedContext)
+		if !ok {
+			logger.WithError(errors.New("invalid authorized context")).Error()
+			return echo.NewHTTPError(http.StatusInternalServerError)
+		}
+
+		export, err := d.UserUsecase.Export(ctx, authCtx.UserID())
+		if err != nil {
+			return toHTTPError(logger, err)
+		}
+
+		archive, err := zipJSON(exportFileName, rr.NewFactory().NewUserExportResponse(export))
+		if err != nil {
+			logger.WithError(err).Error()
+			return echo.NewHTTPError(http.StatusInternalServerError)
+		}
+
+		c.Response().Header().Set(echo.HeaderContentDisposition,
+			fmt.Sprintf(`attachment; filename="export-%s.zip"`, export.ExportedAt.UTC().Format("20060102")))
+		return c.Blob(http.StatusOK, "application/zip", archive)
+	}
+}
+
+func (d *UserDispatcher) DeleteUser() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+		ctx := req.Context()
+		logger := log.LoggerWithSpan(ctx)
+
+		authCtx, ok := c.(*AuthorizedContext)
+		if !ok {
+			logger.WithError(errors.New("invalid authorized context")).Error()
+			return echo.NewHTTPError(http.StatusInternalServerError)
+		}
+
+		payload := rr.NewFactory().NewUserDeleteRequest("")
+		if err := c.Bind(payload); err != nil {
+			return c.NoContent(http.StatusBadRequest)
+		}
+
+		if err := d.UserUsecase.Delete(ctx, authCtx.UserID(), authCtx.SessionID(), payload.CurrentPassword); err != nil {
+			setRetryAfterHeader(c, err)
+			return toHTTPError(logger, err)
+		}
+
+		// the refresh token was deleted with the user
+		d.clearRefreshTokenCookie(c)
+
+		return c.NoContent(http.StatusNoContent)
+	}
+}
+
+func (d *UserDispatcher) clearRefreshTokenCookie(c echo.Context) {
+	c.SetCookie(d.RefreshTokenCookie.Expired(refreshTokenCookie))
+	c.SetCookie(d.CSRFCookie.Expired(csrfTokenCookie))
+}
+
+// setOAuthFlowCookie keeps the flow for the callback. Lax, so it is sent
+// when the provider redirects back, and only to the login routes.
+func (d *UserDispatcher) setOAuthFlowCookie(c echo.Context, flow *entity.OAuthFlow) error {
+	b, err := json.Marshal(rr.NewFactory().NewUserOAuthFlowCookie(flow))
+	if err != nil {
+		return err
+	}
+
+	cookie := new(http.Cookie)
+	cookie.Name = oauthFlowCookie
+	cookie.Value = base64.RawURLEncoding.EncodeToString(b)
+	cookie.Path = "/user/oauth/"
+	cookie.MaxAge = int(oauthFlowMaxAge.Seconds())
+	cookie.HttpOnly = true
+	cookie.SameSite = http.SameSiteLaxMode
+	cookie.Secure = d.RefreshTokenCookie.Secure
+	c.SetCookie(cookie)
+	return nil
+}
+
+// oauthFlowFromCookie returns nil when the cookie is missing or malformed.
+func (d *UserDispatcher) oauthFlowFromCookie(c echo.Context) *entity.OAuthFlow {
+	cookie, err := c.Cookie(oauthFlowCookie)
+	if err != nil {
+		return nil
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(cookie.Value)
+	if err != nil {
+		return nil
+	}
+
+	v := &rr.UserOAuthFlowCookie{}
+	if err := json.Unmarshal(b, v); err != nil {
+		return nil
+	}
+
+	return entity.NewFactory().ResumeOAuthFlow(v.Provider, v.State, v.Nonce, v.CodeVerifier)
+}
+
+func (d *UserDispatcher) clearOAuthFlowCookie(c echo.Context) {
+	cookie := new(http.Cookie)
+	cookie.Name = oauthFlowCookie
+	cookie.Value = ""
+	cookie.Path = "/user/oauth/"
+	cookie.MaxAge = -1
+	cookie.HttpOnly = true
+	cookie.Secure = d.RefreshTokenCookie.Secure
+	c.SetCookie(cookie)
+}
+
+// redirectOAuthResult sends the user agent back to the frontend, fragments are not sent to servers.
+func (d *UserDispatcher) redirectOAuthResult(c echo.Context, key string, value string) error {
+	return c.Redirect(http.StatusFound, d.OAuthRedirectURL+"#"+url.Values{key: []string{value}}.Encode())
+}
+
+// clientContext returns the context of the request carrying its client, which is recorded with sessions.
+func (d *UserDispatcher) clientContext(c echo.Context) context.Context {
+	ip := d.clientIP(c)
+	if net.ParseIP(ip) == nil {
+		ip = ""
+	}
+
+	return clientinfo.NewContext(c.Request().Context(), &clientinfo.Info{
+		IP:        ip,
+		UserAgent: c.Request().UserAgent(),
+	})
+}
+
+// clientIP returns the address of the client.
+// Forwarded headers can be forged, they are used only behind a trusted proxy.
+func (d *UserDispatcher) clientIP(c echo.Context) string {
+	if d.TrustProxyHeaders {
+		return c.RealIP()
+	}
+
+	ip, _, err := net.SplitHostPort(c.Request().RemoteAddr)
+	if err != nil {
+		return c.Request().RemoteAddr
+	}
+	return ip
+}
+
+// setRetryAfterHeader tells throttled clients how many seconds to wait.
+func setRetryAfterHeader(c echo.Context, err error) {
+	var retry *user.RetryAfterError
+	if !errors.As(err, &retry) {
+		return
+	}
+
+	seconds := int64(math.Ceil(retry.RetryAfter.Seconds()))
+	c.Response().Header().Set(headerRetryAfter, strconv.FormatInt(seconds, 10))
+}
+
+// readAvatar reads one byte more than the maximum size, so larger images are noticed.
+func readAvatar(c echo.Context) ([]byte, error) {
+	req := c.Request()
+	if !strings.HasPrefix(req.Header.Get(echo.HeaderContentType), echo.MIMEMultipartForm) {
+		return ioutil.ReadAll(io.LimitReader(req.Body, entity.MaxAvatarSize+1))
+	}
+
+	header, err := c.FormFile(avatarFormField)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := header.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ioutil.ReadAll(io.LimitReader(f, entity.MaxAvatarSize+1))
+}
+
+// zipJSON returns a zip archive holding v as a single JSON document.
+func zipJSON(name string, v interface{}) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	w := zip.NewWriter(buf)
+
+	f, err := w.Create(name)
+	if err != nil {
+		return nil, err
+	}
+
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func toHTTPError(logger *log.Logger, err error) error {
+	var rejected *user.PasswordRejectedError
+	switch {
+	// the reasons are shown to users, an invalid request says nothing more
+	case errors.As(err, &rejected):
+		return echo.NewHTTPError(http.StatusBadRequest, rr.NewFactory().NewPasswordRejectedResponse(rejected.Reasons))
+
+	// errors defined in usecase
+	case errors.Is(err, user.ErrInvalidRequest):
+		return echo.NewHTTPError(http.StatusBadRequest)
+
+	case errors.Is(err, user.ErrNotFound):
+		return echo.NewHTTPError(http.StatusNotFound)
+
+	case errors.Is(err, user.ErrSystemError):
+		logger.WithError(err).Error()
+		return echo.NewHTTPError(http.StatusInternalServerError)
+
+	case errors.Is(err, user.ErrDatabaseError):
+		logger.WithError(err).Error()
+		return echo.NewHTTPError(http.StatusInternalServerError)
+
+	case errors.Is(err, user.ErrUnauthorized):
+		return echo.NewHTTPError(http.StatusUnauthorized)
+
+	case errors.Is(err, user.ErrTooManyAttempts):
+		return echo.NewHTTPError(http.StatusTooManyRequests)
 
 	// errors defined in net/http
 	case errors.Is(err, http.ErrNoCookie):
@@ -0,0 +1,72 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/org39/webapp-tutorial-backend/entity/dto"
+	"github.com/org39/webapp-tutorial-backend/pkg/db"
+	"github.com/org39/webapp-tutorial-backend/usecase/auth"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+// AccountRepository reads the roles and the state of users, for the auth usecase.
+type AccountRepository struct {
+	DB    *db.DB `inject:""`
+	Table string `inject:"repo.user.table"`
+}
+
+func NewAccountRepository(options ...func(*AccountRepository) error) (auth.AccountRepository, error) {
+	r := &AccountRepository{}
+
+	for _, option := range options {
+		if err := option(r); err != nil {
+			return nil, err
+		}
+	}
+
+	return r, nil
+}
+
+func WithAccountDB(db *db.DB) func(*AccountRepository) error {
+	return func(r *AccountRepository) error {
+		r.DB = db
+		return nil
+	}
+}
+
+func WithAccountTable(table string) func(*AccountRepository) error {
+	return func(r *AccountRepository) error {
+		r.Table = table
+		return nil
+	}
+}
+
+func (r *AccountRepository) FetchByUserID(ctx context.Context, userID string) (*dto.Account, error) {
+	query, args, err := sq.Select("roles", "disabled_at").From(r.Table).Where(sq.Eq{"id": userID}).ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", err.Error(), auth.ErrDatabaseError)
+	}
+
+	var roles string
+	var disabledAt sql.NullTime
+	err = r.DB.QueryRow(ctx, query, args...).Scan(&roles, &disabledAt)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil, auth.ErrNotFound
+	case err != nil:
+		return nil, fmt.Errorf("%s: %w", err.Error(), auth.ErrDatabaseError)
+	}
+
+	var disabled *time.Time
+	if disabledAt.Valid {
+		disabled = &disabledAt.Time
+	}
+
+	return dto.NewFactory().NewAccount(userID, strings.Fields(roles), disabled), nil
+}
@@ -0,0 +1,102 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/org39/webapp-tutorial-backend/pkg/db"
+	"github.com/org39/webapp-tutorial-backend/usecase/auth"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type AccountRepoTestSuite struct {
+	suite.Suite
+	AccountRepository auth.AccountRepository
+	DB                *db.DB
+	Sqlmock           sqlmock.Sqlmock
+}
+
+func (s *AccountRepoTestSuite) SetupTest() {
+	mockdb, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		assert.Fail(s.T(), fmt.Sprintf("fail to sqlmock: %s", err))
+	}
+	s.DB = &db.DB{DB: mockdb}
+	s.Sqlmock = mock
+
+	r, err := NewAccountRepository(
+		WithAccountTable("users"),
+		WithAccountDB(s.DB),
+	)
+	if err != nil {
+		assert.Fail(s.T(), fmt.Sprintf("fail to create repository: %s", err))
+	}
+
+	s.AccountRepository = r
+}
+
+func (s *AccountRepoTestSuite) TearDownTest() {
+	s.DB.Close()
+}
+
+func (s *AccountRepoTestSuite) TestFetchByUserIDExist() {
+	ctx := context.Background()
+	userID := "2192fc7b-bd9b-446d-a50e-5ce0ba02cee6"
+	disabledAt := time.Now()
+
+	q := "SELECT roles, disabled_at FROM users WHERE id = ?"
+	s.Sqlmock.ExpectQuery(q).
+		WithArgs(userID).
+		WillReturnRows(sqlmock.NewRows([]string{"roles", "disabled_at"}).AddRow("admin", disabledAt))
+
+	// assert
+	account, err := s.AccountRepository.FetchByUserID(ctx, userID)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), userID, account.UserID)
+	assert.Equal(s.T(), []string{"admin"}, account.Roles)
+	assert.NotNil(s.T(), account.DisabledAt)
+	assert.NoError(s.T(), s.Sqlmock.ExpectationsWereMet())
+}
+
+func (s *AccountRepoTestSuite) TestFetchByUserIDWithoutRole() {
+	ctx := context.Background()
+	userID := "2192fc7b-bd9b-446d-a50e-5ce0ba02cee6"
+
+	q := "SELECT roles, disabled_at FROM users WHERE id = ?"
+	s.Sqlmock.ExpectQuery(q).
+		WithArgs(userID).
+		WillReturnRows(sqlmock.NewRows([]string{"roles", "disabled_at"}).AddRow("", nil))
+
+	// assert
+	account, err := s.AccountRepository.FetchByUserID(ctx, userID)
+	assert.NoError(s.T(), err)
+	assert.Empty(s.T(), account.Roles)
+	assert.Nil(s.T(), account.DisabledAt)
+	assert.NoError(s.T(), s.Sqlmock.ExpectationsWereMet())
+}
+
+func (s *AccountRepoTestSuite) TestFetchByUserIDNotExist() {
+	ctx := context.Background()
+	userID := "2192fc7b-bd9b-446d-a50e-5ce0ba02cee6"
+
+	q := "SELECT roles, disabled_at FROM users WHERE id = ?"
+	s.Sqlmock.ExpectQuery(q).
+		WithArgs(userID).
+		WillReturnError(sql.ErrNoRows)
+
+	// assert
+	account, err := s.AccountRepository.FetchByUserID(ctx, userID)
+	assert.Nil(s.T(), account)
+	assert.ErrorIs(s.T(), err, auth.ErrNotFound)
+	assert.NoError(s.T(), s.Sqlmock.ExpectationsWereMet())
+}
+
+func TestAccountRepo(t *testing.T) {
+	suite.Run(t, new(AccountRepoTestSuite))
+}
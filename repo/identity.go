@@ -0,0 +1,90 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/org39/webapp-tutorial-backend/entity/dto"
+	"github.com/org39/webapp-tutorial-backend/pkg/db"
+	"github.com/org39/webapp-tutorial-backend/usecase/user"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+var (
+	identityCols = []string{"id", "user_id", "provider", "subject", "email", "created_at"}
+)
+
+type IdentityRepository struct {
+	DB    *db.DB `inject:""`
+	Table string `inject:"repo.identity.table"`
+}
+
+func NewIdentityRepository(options ...func(*IdentityRepository) error) (user.IdentityRepository, error) {
+	r := &IdentityRepository{}
+
+	for _, option := range options {
+		if err := option(r); err != nil {
+			return nil, err
+		}
+	}
+
+	return r, nil
+}
+
+func WithIdentityDB(db *db.DB) func(*IdentityRepository) error {
+	return func(r *IdentityRepository) error {
+		r.DB = db
+		return nil
+	}
+}
+
+func WithIdentityTable(table string) func(*IdentityRepository) error {
+	return func(r *IdentityRepository) error {
+		r.Table = table
+		return nil
+	}
+}
+
+func (r *IdentityRepository) Store(ctx context.Context, i *dto.Identity) error {
+	query, args, err := sq.Insert(r.Table).
+		Columns(identityCols...).
+		Values(i.ID, i.UserID, i.Provider, i.Subject, i.Email, i.CreatedAt).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("%s: %w", err.Error(), user.ErrDatabaseError)
+	}
+
+	_, err = r.DB.Exec(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("%s: %w", err.Error(), user.ErrDatabaseError)
+	}
+	return nil
+}
+
+func (r *IdentityRepository) FetchBySubject(ctx context.Context, provider string, subject string) (*dto.Identity, error) {
+	query, args, err := sq.Select(identityCols...).
+		From(r.Table).
+		Where(sq.Eq{"provider": provider, "subject": subject}).
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", err.Error(), user.ErrDatabaseError)
+	}
+
+	row := r.DB.QueryRow(ctx, query, args...)
+
+	var id, userID, p, s, email string
+	var createdAt time.Time
+	err = row.Scan(&id, &userID, &p, &s, &email, &createdAt)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil, user.ErrNotFound
+	case err != nil:
+		return nil, fmt.Errorf("%s: %w", err.Error(), user.ErrDatabaseError)
+	}
+
+	return dto.NewFactory().NewIdentity(id, userID, p, s, email, createdAt), nil
+}
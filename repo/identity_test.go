@@ -0,0 +1,111 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/org39/webapp-tutorial-backend/entity/dto"
+	"github.com/org39/webapp-tutorial-backend/pkg/db"
+	"github.com/org39/webapp-tutorial-backend/usecase/user"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type IdentityRepoTestSuite struct {
+	suite.Suite
+	IdentityRepository user.IdentityRepository
+	DB                 *db.DB
+	Sqlmock            sqlmock.Sqlmock
+}
+
+func (s *IdentityRepoTestSuite) SetupTest() {
+	mockdb, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		assert.Fail(s.T(), fmt.Sprintf("fail to sqlmock: %s", err))
+	}
+	s.DB = &db.DB{DB: mockdb}
+	s.Sqlmock = mock
+
+	r, err := NewIdentityRepository(
+		WithIdentityTable("user_identities"),
+		WithIdentityDB(s.DB),
+	)
+	if err != nil {
+		assert.Fail(s.T(), fmt.Sprintf("fail to create repository: %s", err))
+	}
+
+	s.IdentityRepository = r
+}
+
+func (s *IdentityRepoTestSuite) TearDownTest() {
+	s.DB.Close()
+}
+
+func (s *IdentityRepoTestSuite) newIdentity() *dto.Identity {
+	id := "4daaaea8-4721-4644-aaac-7958805b4530"
+	userID := "2192fc7b-bd9b-446d-a50e-5ce0ba02cee6"
+	return dto.NewFactory().NewIdentity(id, userID, "google", "110169484474386276334", "hatsune@miku.com", time.Now())
+}
+
+func (s *IdentityRepoTestSuite) TestStoreSuccess() {
+	ctx := context.Background()
+	i := s.newIdentity()
+
+	q := "INSERT INTO user_identities (id,user_id,provider,subject,email,created_at) VALUES (?,?,?,?,?,?)"
+	s.Sqlmock.ExpectBegin()
+	s.Sqlmock.ExpectExec(q).
+		WithArgs(i.ID, i.UserID, i.Provider, i.Subject, i.Email, i.CreatedAt).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	s.Sqlmock.ExpectCommit()
+
+	// assert
+	err := s.IdentityRepository.Store(ctx, i)
+	assert.NoError(s.T(), err)
+	assert.NoError(s.T(), s.Sqlmock.ExpectationsWereMet())
+}
+
+func (s *IdentityRepoTestSuite) TestFetchBySubjectExist() {
+	ctx := context.Background()
+	i := s.newIdentity()
+
+	q := "SELECT id, user_id, provider, subject, email, created_at FROM user_identities WHERE provider = ? AND subject = ?"
+	s.Sqlmock.ExpectQuery(q).
+		WithArgs(i.Provider, i.Subject).
+		WillReturnRows(
+			sqlmock.
+				NewRows(identityCols).
+				AddRow(i.ID, i.UserID, i.Provider, i.Subject, i.Email, i.CreatedAt),
+		)
+
+	// assert
+	res, err := s.IdentityRepository.FetchBySubject(ctx, i.Provider, i.Subject)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), i.ID, res.ID)
+	assert.Equal(s.T(), i.UserID, res.UserID)
+	assert.NoError(s.T(), s.Sqlmock.ExpectationsWereMet())
+}
+
+func (s *IdentityRepoTestSuite) TestFetchBySubjectNotExist() {
+	ctx := context.Background()
+	i := s.newIdentity()
+
+	q := "SELECT id, user_id, provider, subject, email, created_at FROM user_identities WHERE provider = ? AND subject = ?"
+	s.Sqlmock.ExpectQuery(q).
+		WithArgs(i.Provider, i.Subject).
+		WillReturnError(sql.ErrNoRows)
+
+	// assert
+	res, err := s.IdentityRepository.FetchBySubject(ctx, i.Provider, i.Subject)
+	assert.Nil(s.T(), res)
+	assert.ErrorIs(s.T(), err, user.ErrNotFound)
+	assert.NoError(s.T(), s.Sqlmock.ExpectationsWereMet())
+}
+
+func TestIdentityRepo(t *testing.T) {
+	suite.Run(t, new(IdentityRepoTestSuite))
+}
@@ -0,0 +1,98 @@
+package repo
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/org39/webapp-tutorial-backend/entity/dto"
+	"github.com/org39/webapp-tutorial-backend/usecase/user"
+)
+
+const (
+	// expired counters are swept at most this often
+	loginAttemptSweepInterval = time.Minute
+)
+
+type loginAttemptEntry struct {
+	failures      int
+	lastFailureAt time.Time
+	expiresAt     time.Time
+}
+
+// LoginAttemptRepository keeps login failure counters in memory.
+// Counters are per process, every instance of the application throttles on its own.
+type LoginAttemptRepository struct {
+	mu        sync.Mutex
+	entries   map[string]*loginAttemptEntry
+	lastSweep time.Time
+}
+
+func NewLoginAttemptRepository(options ...func(*LoginAttemptRepository) error) (user.LoginAttemptRepository, error) {
+	r := &LoginAttemptRepository{
+		entries: map[string]*loginAttemptEntry{},
+	}
+
+	for _, option := range options {
+		if err := option(r); err != nil {
+			return nil, err
+		}
+	}
+
+	return r, nil
+}
+
+func (r *LoginAttemptRepository) Fetch(ctx context.Context, key string) (*dto.LoginAttempts, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	e, ok := r.entries[key]
+	if !ok || !time.Now().Before(e.expiresAt) {
+		return nil, user.ErrNotFound
+	}
+
+	return dto.NewFactory().NewLoginAttempts(key, e.failures, e.lastFailureAt), nil
+}
+
+// RecordFailure counts a failure at the given time, the counter is forgotten ttl after it.
+func (r *LoginAttemptRepository) RecordFailure(ctx context.Context, key string, at time.Time, ttl time.Duration) (*dto.LoginAttempts, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.sweep(at)
+
+	e, ok := r.entries[key]
+	if !ok || !at.Before(e.expiresAt) {
+		e = &loginAttemptEntry{}
+		r.entries[key] = e
+	}
+
+	e.failures++
+	e.lastFailureAt = at
+	e.expiresAt = at.Add(ttl)
+
+	return dto.NewFactory().NewLoginAttempts(key, e.failures, e.lastFailureAt), nil
+}
+
+func (r *LoginAttemptRepository) Reset(ctx context.Context, key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.entries, key)
+	return nil
+}
+
+// sweep drops expired counters, so spraying keys can not grow the map forever.
+// It must be called with the lock held.
+func (r *LoginAttemptRepository) sweep(now time.Time) {
+	if now.Sub(r.lastSweep) < loginAttemptSweepInterval {
+		return
+	}
+	r.lastSweep = now
+
+	for key, e := range r.entries {
+		if !now.Before(e.expiresAt) {
+			delete(r.entries, key)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/org39/webapp-tutorial-backend/usecase/user"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type LoginAttemptRepoTestSuite struct {
+	suite.Suite
+	LoginAttemptRepository user.LoginAttemptRepository
+}
+
+func (s *LoginAttemptRepoTestSuite) SetupTest() {
+	r, err := NewLoginAttemptRepository()
+	if err != nil {
+		assert.Fail(s.T(), fmt.Sprintf("fail to create repository: %s", err))
+	}
+
+	s.LoginAttemptRepository = r
+}
+
+func (s *LoginAttemptRepoTestSuite) TestFetchNotExist() {
+	ctx := context.Background()
+
+	// assert
+	res, err := s.LoginAttemptRepository.Fetch(ctx, "account:hatsune@miku.com")
+	assert.Nil(s.T(), res)
+	assert.ErrorIs(s.T(), err, user.ErrNotFound)
+}
+
+func (s *LoginAttemptRepoTestSuite) TestRecordFailureCounts() {
+	ctx := context.Background()
+	key := "account:hatsune@miku.com"
+	now := time.Now()
+
+	_, err := s.LoginAttemptRepository.RecordFailure(ctx, key, now.Add(-time.Second), time.Minute)
+	assert.NoError(s.T(), err)
+	res, err := s.LoginAttemptRepository.RecordFailure(ctx, key, now, time.Minute)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), 2, res.Failures)
+
+	// assert
+	fetched, err := s.LoginAttemptRepository.Fetch(ctx, key)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), key, fetched.Key)
+	assert.Equal(s.T(), 2, fetched.Failures)
+	assert.Equal(s.T(), now, fetched.LastFailureAt)
+
+	// other keys are counted apart
+	_, err = s.LoginAttemptRepository.Fetch(ctx, "ip:192.0.2.1")
+	assert.ErrorIs(s.T(), err, user.ErrNotFound)
+}
+
+func (s *LoginAttemptRepoTestSuite) TestRecordFailureRestartsAfterExpiration() {
+	ctx := context.Background()
+	key := "account:hatsune@miku.com"
+	now := time.Now()
+
+	_, err := s.LoginAttemptRepository.RecordFailure(ctx, key, now.Add(-2*time.Minute), time.Minute)
+	assert.NoError(s.T(), err)
+
+	_, err = s.LoginAttemptRepository.Fetch(ctx, key)
+	assert.ErrorIs(s.T(), err, user.ErrNotFound)
+
+	// assert
+	res, err := s.LoginAttemptRepository.RecordFailure(ctx, key, now, time.Minute)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), 1, res.Failures)
+}
+
+func (s *LoginAttemptRepoTestSuite) TestReset() {
+	ctx := context.Background()
+	key := "account:hatsune@miku.com"
+
+	_, err := s.LoginAttemptRepository.RecordFailure(ctx, key, time.Now(), time.Minute)
+	assert.NoError(s.T(), err)
+
+	// assert
+	assert.NoError(s.T(), s.LoginAttemptRepository.Reset(ctx, key))
+	_, err = s.LoginAttemptRepository.Fetch(ctx, key)
+	assert.ErrorIs(s.T(), err, user.ErrNotFound)
+}
+
+func (s *LoginAttemptRepoTestSuite) TestSweepDropsExpired() {
+	ctx := context.Background()
+	now := time.Now()
+
+	_, err := s.LoginAttemptRepository.RecordFailure(ctx, "ip:192.0.2.1", now.Add(-2*time.Minute), time.Minute)
+	assert.NoError(s.T(), err)
+	_, err = s.LoginAttemptRepository.RecordFailure(ctx, "ip:192.0.2.2", now, time.Minute)
+	assert.NoError(s.T(), err)
+
+	// assert
+	r := s.LoginAttemptRepository.(*LoginAttemptRepository)
+	assert.Len(s.T(), r.entries, 1)
+	assert.Contains(s.T(), r.entries, "ip:192.0.2.2")
+}
+
+func TestLoginAttemptRepo(t *testing.T) {
+	suite.Run(t, new(LoginAttemptRepoTestSuite))
+}
@@ -0,0 +1,186 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/org39/webapp-tutorial-backend/entity/dto"
+	"github.com/org39/webapp-tutorial-backend/pkg/db"
+	"github.com/org39/webapp-tutorial-backend/usecase/auth"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+const (
+	// scopes are stored in a single column, separated like an OAuth scope parameter
+	scopeSeparator = " "
+)
+
+var (
+	personalAccessTokenCols = []string{"id", "user_id", "name", "scopes", "token_hash", "last_used_at", "expires_at", "created_at"}
+)
+
+type PersonalAccessTokenRepository struct {
+	DB    *db.DB `inject:""`
+	Table string `inject:"repo.personal_access_token.table"`
+}
+
+func NewPersonalAccessTokenRepository(options ...func(*PersonalAccessTokenRepository) error) (auth.PersonalAccessTokenRepository, error) {
+	r := &PersonalAccessTokenRepository{}
+
+	for _, option := range options {
+		if err := option(r); err != nil {
+			return nil, err
+		}
+	}
+
+	return r, nil
+}
+
+func WithPersonalAccessTokenDB(db *db.DB) func(*PersonalAccessTokenRepository) error {
+	return func(r *PersonalAccessTokenRepository) error {
+		r.DB = db
+		return nil
+	}
+}
+
+func WithPersonalAccessTokenTable(table string) func(*PersonalAccessTokenRepository) error {
+	return func(r *PersonalAccessTokenRepository) error {
+		r.Table = table
+		return nil
+	}
+}
+
+func (r *PersonalAccessTokenRepository) Store(ctx context.Context, t *dto.PersonalAccessToken) error {
+	query, args, err := sq.Insert(r.Table).
+		Columns(personalAccessTokenCols...).
+		Values(t.ID, t.UserID, t.Name, strings.Join(t.Scopes, scopeSeparator), t.TokenHash, t.LastUsedAt, t.ExpiresAt, t.CreatedAt).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("%s: %w", err.Error(), auth.ErrDatabaseError)
+	}
+
+	_, err = r.DB.Exec(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("%s: %w", err.Error(), auth.ErrDatabaseError)
+	}
+	return nil
+}
+
+func (r *PersonalAccessTokenRepository) FetchByHash(ctx context.Context, tokenHash string) (*dto.PersonalAccessToken, error) {
+	query, args, err := r.selectPersonalAccessToken().Where(sq.Eq{"token_hash": tokenHash}).ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", err.Error(), auth.ErrDatabaseError)
+	}
+
+	row := r.DB.QueryRow(ctx, query, args...)
+	t, err := r.scanPersonalAccessToken(row)
+	if err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+func (r *PersonalAccessTokenRepository) FetchAllByUserID(ctx context.Context, userID string) ([]*dto.PersonalAccessToken, error) {
+	query, args, err := r.selectPersonalAccessToken().
+		Where(sq.Eq{"user_id": userID}).
+		OrderBy("created_at").
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", err.Error(), auth.ErrDatabaseError)
+	}
+
+	rows, err := r.DB.Query(ctx, query, args...)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return []*dto.PersonalAccessToken{}, nil
+	case err != nil:
+		return nil, fmt.Errorf("%s: %w", err.Error(), auth.ErrDatabaseError)
+	}
+	defer rows.Close()
+
+	tokens := []*dto.PersonalAccessToken{}
+	for rows.Next() {
+		t, err := r.scanPersonalAccessToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, t)
+	}
+
+	return tokens, nil
+}
+
+func (r *PersonalAccessTokenRepository) UpdateLastUsed(ctx context.Context, id string, lastUsedAt time.Time) error {
+	query, args, err := sq.Update(r.Table).
+		Set("last_used_at", lastUsedAt).
+		Where(sq.Eq{"id": id}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("%s: %w", err.Error(), auth.ErrDatabaseError)
+	}
+
+	_, err = r.DB.Exec(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("%s: %w", err.Error(), auth.ErrDatabaseError)
+	}
+	return nil
+}
+
+// Delete removes the token of the user.
+// It returns auth.ErrNotFound when the user has no such token.
+func (r *PersonalAccessTokenRepository) Delete(ctx context.Context, userID string, id string) error {
+	query, args, err := sq.Delete(r.Table).
+		Where(sq.Eq{"id": id, "user_id": userID}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("%s: %w", err.Error(), auth.ErrDatabaseError)
+	}
+
+	res, err := r.DB.Exec(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("%s: %w", err.Error(), auth.ErrDatabaseError)
+	}
+
+	affected, err := res.RowsAffected()
+	switch {
+	case err != nil:
+		return fmt.Errorf("%s: %w", err.Error(), auth.ErrDatabaseError)
+	case affected == 0:
+		return auth.ErrNotFound
+	}
+	return nil
+}
+
+func (r *PersonalAccessTokenRepository) selectPersonalAccessToken() sq.SelectBuilder {
+	return sq.Select(personalAccessTokenCols...).From(r.Table)
+}
+
+func (r *PersonalAccessTokenRepository) scanPersonalAccessToken(row db.Scanable) (*dto.PersonalAccessToken, error) {
+	var id, userID, name, scopes, tokenHash string
+	var lastUsedAt, expiresAt sql.NullTime
+	var createdAt time.Time
+
+	err := row.Scan(&id, &userID, &name, &scopes, &tokenHash, &lastUsedAt, &expiresAt, &createdAt)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil, auth.ErrNotFound
+	case err != nil:
+		return nil, fmt.Errorf("%s: %w", err.Error(), auth.ErrDatabaseError)
+	}
+
+	var lastUsed, expires *time.Time
+	if lastUsedAt.Valid {
+		lastUsed = &lastUsedAt.Time
+	}
+	if expiresAt.Valid {
+		expires = &expiresAt.Time
+	}
+
+	return dto.NewFactory().NewPersonalAccessToken(id, userID, name, strings.Fields(scopes), tokenHash, lastUsed, expires, createdAt), nil
+}
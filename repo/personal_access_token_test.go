@@ -0,0 +1,208 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/org39/webapp-tutorial-backend/entity/dto"
+	"github.com/org39/webapp-tutorial-backend/pkg/db"
+	"github.com/org39/webapp-tutorial-backend/usecase/auth"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type PersonalAccessTokenRepoTestSuite struct {
+	suite.Suite
+	PersonalAccessTokenRepository auth.PersonalAccessTokenRepository
+	DB                            *db.DB
+	Sqlmock                       sqlmock.Sqlmock
+}
+
+func (s *PersonalAccessTokenRepoTestSuite) SetupTest() {
+	mockdb, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		assert.Fail(s.T(), fmt.Sprintf("fail to sqlmock: %s", err))
+	}
+	s.DB = &db.DB{DB: mockdb}
+	s.Sqlmock = mock
+
+	r, err := NewPersonalAccessTokenRepository(
+		WithPersonalAccessTokenTable("personal_access_tokens"),
+		WithPersonalAccessTokenDB(s.DB),
+	)
+	if err != nil {
+		assert.Fail(s.T(), fmt.Sprintf("fail to create repository: %s", err))
+	}
+
+	s.PersonalAccessTokenRepository = r
+}
+
+func (s *PersonalAccessTokenRepoTestSuite) TearDownTest() {
+	s.DB.Close()
+}
+
+func (s *PersonalAccessTokenRepoTestSuite) newPersonalAccessToken() *dto.PersonalAccessToken {
+	id := "4daaaea8-4721-4644-aaac-7958805b4530"
+	userID := "2192fc7b-bd9b-446d-a50e-5ce0ba02cee6"
+	tokenHash := "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+	return dto.NewFactory().NewPersonalAccessToken(id, userID, "ci", []string{"todos:read", "todos:write"}, tokenHash, nil, nil, time.Now())
+}
+
+func (s *PersonalAccessTokenRepoTestSuite) TestStoreSuccess() {
+	ctx := context.Background()
+	t := s.newPersonalAccessToken()
+
+	q := "INSERT INTO personal_access_tokens (id,user_id,name,scopes,token_hash,last_used_at,expires_at,created_at) VALUES (?,?,?,?,?,?,?,?)"
+	s.Sqlmock.ExpectBegin()
+	s.Sqlmock.ExpectExec(q).
+		WithArgs(t.ID, t.UserID, t.Name, "todos:read todos:write", t.TokenHash, t.LastUsedAt, t.ExpiresAt, t.CreatedAt).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	s.Sqlmock.ExpectCommit()
+
+	// assert
+	err := s.PersonalAccessTokenRepository.Store(ctx, t)
+	assert.NoError(s.T(), err)
+	assert.NoError(s.T(), s.Sqlmock.ExpectationsWereMet())
+}
+
+func (s *PersonalAccessTokenRepoTestSuite) TestFetchByHashExist() {
+	ctx := context.Background()
+	t := s.newPersonalAccessToken()
+	expiresAt := time.Now().Add(time.Hour)
+
+	q := "SELECT id, user_id, name, scopes, token_hash, last_used_at, expires_at, created_at FROM personal_access_tokens WHERE token_hash = ?"
+	s.Sqlmock.ExpectQuery(q).
+		WithArgs(t.TokenHash).
+		WillReturnRows(
+			sqlmock.
+				NewRows(personalAccessTokenCols).
+				AddRow(t.ID, t.UserID, t.Name, "todos:read todos:write", t.TokenHash, nil, expiresAt, t.CreatedAt),
+		)
+
+	// assert
+	res, err := s.PersonalAccessTokenRepository.FetchByHash(ctx, t.TokenHash)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), t.ID, res.ID)
+	assert.Equal(s.T(), t.UserID, res.UserID)
+	assert.Equal(s.T(), t.Scopes, res.Scopes)
+	assert.Nil(s.T(), res.LastUsedAt)
+	assert.NotNil(s.T(), res.ExpiresAt)
+	assert.NoError(s.T(), s.Sqlmock.ExpectationsWereMet())
+}
+
+func (s *PersonalAccessTokenRepoTestSuite) TestFetchByHashNotExist() {
+	ctx := context.Background()
+	t := s.newPersonalAccessToken()
+
+	q := "SELECT id, user_id, name, scopes, token_hash, last_used_at, expires_at, created_at FROM personal_access_tokens WHERE token_hash = ?"
+	s.Sqlmock.ExpectQuery(q).
+		WithArgs(t.TokenHash).
+		WillReturnError(sql.ErrNoRows)
+
+	// assert
+	res, err := s.PersonalAccessTokenRepository.FetchByHash(ctx, t.TokenHash)
+	assert.Nil(s.T(), res)
+	assert.ErrorIs(s.T(), err, auth.ErrNotFound)
+	assert.NoError(s.T(), s.Sqlmock.ExpectationsWereMet())
+}
+
+func (s *PersonalAccessTokenRepoTestSuite) TestFetchAllByUserIDExist() {
+	ctx := context.Background()
+	t := s.newPersonalAccessToken()
+
+	q := "SELECT id, user_id, name, scopes, token_hash, last_used_at, expires_at, created_at FROM personal_access_tokens WHERE user_id = ? ORDER BY created_at"
+	s.Sqlmock.ExpectQuery(q).
+		WithArgs(t.UserID).
+		WillReturnRows(
+			sqlmock.
+				NewRows(personalAccessTokenCols).
+				AddRow(t.ID, t.UserID, t.Name, "todos:read todos:write", t.TokenHash, t.CreatedAt, nil, t.CreatedAt),
+		)
+
+	// assert
+	res, err := s.PersonalAccessTokenRepository.FetchAllByUserID(ctx, t.UserID)
+	assert.NoError(s.T(), err)
+	assert.Len(s.T(), res, 1)
+	assert.Equal(s.T(), t.ID, res[0].ID)
+	assert.NotNil(s.T(), res[0].LastUsedAt)
+	assert.Nil(s.T(), res[0].ExpiresAt)
+	assert.NoError(s.T(), s.Sqlmock.ExpectationsWereMet())
+}
+
+func (s *PersonalAccessTokenRepoTestSuite) TestFetchAllByUserIDNotExist() {
+	ctx := context.Background()
+	t := s.newPersonalAccessToken()
+
+	q := "SELECT id, user_id, name, scopes, token_hash, last_used_at, expires_at, created_at FROM personal_access_tokens WHERE user_id = ? ORDER BY created_at"
+	s.Sqlmock.ExpectQuery(q).
+		WithArgs(t.UserID).
+		WillReturnError(sql.ErrNoRows)
+
+	// assert
+	res, err := s.PersonalAccessTokenRepository.FetchAllByUserID(ctx, t.UserID)
+	assert.NotNil(s.T(), res)
+	assert.Empty(s.T(), res)
+	assert.NoError(s.T(), err)
+	assert.NoError(s.T(), s.Sqlmock.ExpectationsWereMet())
+}
+
+func (s *PersonalAccessTokenRepoTestSuite) TestUpdateLastUsedSuccess() {
+	ctx := context.Background()
+	t := s.newPersonalAccessToken()
+	now := time.Now()
+
+	q := "UPDATE personal_access_tokens SET last_used_at = ? WHERE id = ?"
+	s.Sqlmock.ExpectBegin()
+	s.Sqlmock.ExpectExec(q).
+		WithArgs(now, t.ID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	s.Sqlmock.ExpectCommit()
+
+	// assert
+	err := s.PersonalAccessTokenRepository.UpdateLastUsed(ctx, t.ID, now)
+	assert.NoError(s.T(), err)
+	assert.NoError(s.T(), s.Sqlmock.ExpectationsWereMet())
+}
+
+func (s *PersonalAccessTokenRepoTestSuite) TestDeleteSuccess() {
+	ctx := context.Background()
+	t := s.newPersonalAccessToken()
+
+	q := "DELETE FROM personal_access_tokens WHERE id = ? AND user_id = ?"
+	s.Sqlmock.ExpectBegin()
+	s.Sqlmock.ExpectExec(q).
+		WithArgs(t.ID, t.UserID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	s.Sqlmock.ExpectCommit()
+
+	// assert
+	err := s.PersonalAccessTokenRepository.Delete(ctx, t.UserID, t.ID)
+	assert.NoError(s.T(), err)
+	assert.NoError(s.T(), s.Sqlmock.ExpectationsWereMet())
+}
+
+func (s *PersonalAccessTokenRepoTestSuite) TestDeleteNotExist() {
+	ctx := context.Background()
+	t := s.newPersonalAccessToken()
+
+	q := "DELETE FROM personal_access_tokens WHERE id = ? AND user_id = ?"
+	s.Sqlmock.ExpectBegin()
+	s.Sqlmock.ExpectExec(q).
+		WithArgs(t.ID, t.UserID).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	s.Sqlmock.ExpectCommit()
+
+	// assert
+	err := s.PersonalAccessTokenRepository.Delete(ctx, t.UserID, t.ID)
+	assert.ErrorIs(s.T(), err, auth.ErrNotFound)
+	assert.NoError(s.T(), s.Sqlmock.ExpectationsWereMet())
+}
+
+func TestPersonalAccessTokenRepo(t *testing.T) {
+	suite.Run(t, new(PersonalAccessTokenRepoTestSuite))
+}
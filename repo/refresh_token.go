@@ -0,0 +1,159 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/org39/webapp-tutorial-backend/entity/dto"
+	"github.com/org39/webapp-tutorial-backend/pkg/db"
+	"github.com/org39/webapp-tutorial-backend/usecase/auth"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+var (
+	refreshTokenCols = []string{"id", "family_id", "user_id", "rotated", "revoked", "expires_at", "created_at"}
+)
+
+type RefreshTokenRepository struct {
+	DB    *db.DB `inject:""`
+	Table string `inject:"repo.refresh_token.table"`
+}
+
+func NewRefreshTokenRepository(options ...func(*RefreshTokenRepository) error) (auth.RefreshTokenRepository, error) {
+	r := &RefreshTokenRepository{}
+
+	for _, option := range options {
+		if err := option(r); err != nil {
+			return nil, err
+		}
+	}
+
+	return r, nil
+}
+
+func WithRefreshTokenDB(db *db.DB) func(*RefreshTokenRepository) error {
+	return func(r *RefreshTokenRepository) error {
+		r.DB = db
+		return nil
+	}
+}
+
+func WithRefreshTokenTable(table string) func(*RefreshTokenRepository) error {
+	return func(r *RefreshTokenRepository) error {
+		r.Table = table
+		return nil
+	}
+}
+
+func (r *RefreshTokenRepository) Store(ctx context.Context, t *dto.RefreshToken) error {
+	query, args, err := sq.Insert(r.Table).
+		Columns(refreshTokenCols...).
+		Values(t.ID, t.FamilyID, t.UserID, t.Rotated, t.Revoked, t.ExpiresAt, t.CreatedAt).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("%s: %w", err.Error(), auth.ErrDatabaseError)
+	}
+
+	_, err = r.DB.Exec(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("%s: %w", err.Error(), auth.ErrDatabaseError)
+	}
+	return nil
+}
+
+func (r *RefreshTokenRepository) FetchByID(ctx context.Context, id string) (*dto.RefreshToken, error) {
+	query, args, err := r.selectRefreshToken().Where(sq.Eq{"id": id}).ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", err.Error(), auth.ErrDatabaseError)
+	}
+
+	row := r.DB.QueryRow(ctx, query, args...)
+	t, err := r.scanRefreshToken(row)
+	if err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// Rotate marks the token as rotated, only if nobody else rotated or revoked it first.
+// It returns auth.ErrNotFound when the token was not usable anymore.
+func (r *RefreshTokenRepository) Rotate(ctx context.Context, t *dto.RefreshToken) error {
+	query, args, err := sq.Update(r.Table).
+		Set("rotated", true).
+		Where(sq.Eq{"id": t.ID, "rotated": false, "revoked": false}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("%s: %w", err.Error(), auth.ErrDatabaseError)
+	}
+
+	res, err := r.DB.Exec(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("%s: %w", err.Error(), auth.ErrDatabaseError)
+	}
+
+	affected, err := res.RowsAffected()
+	switch {
+	case err != nil:
+		return fmt.Errorf("%s: %w", err.Error(), auth.ErrDatabaseError)
+	case affected == 0:
+		return auth.ErrNotFound
+	}
+	return nil
+}
+
+func (r *RefreshTokenRepository) RevokeFamily(ctx context.Context, familyID string) error {
+	query, args, err := sq.Update(r.Table).
+		Set("revoked", true).
+		Where(sq.Eq{"family_id": familyID}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("%s: %w", err.Error(), auth.ErrDatabaseError)
+	}
+
+	_, err = r.DB.Exec(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("%s: %w", err.Error(), auth.ErrDatabaseError)
+	}
+	return nil
+}
+
+func (r *RefreshTokenRepository) RevokeAllByUser(ctx context.Context, userID string) error {
+	query, args, err := sq.Update(r.Table).
+		Set("revoked", true).
+		Where(sq.Eq{"user_id": userID, "revoked": false}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("%s: %w", err.Error(), auth.ErrDatabaseError)
+	}
+
+	_, err = r.DB.Exec(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("%s: %w", err.Error(), auth.ErrDatabaseError)
+	}
+	return nil
+}
+
+func (r *RefreshTokenRepository) selectRefreshToken() sq.SelectBuilder {
+	return sq.Select(refreshTokenCols...).From(r.Table)
+}
+
+func (r *RefreshTokenRepository) scanRefreshToken(row db.Scanable) (*dto.RefreshToken, error) {
+	var id, familyID, userID string
+	var rotated, revoked bool
+	var expiresAt, createdAt time.Time
+
+	err := row.Scan(&id, &familyID, &userID, &rotated, &revoked, &expiresAt, &createdAt)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil, auth.ErrNotFound
+	case err != nil:
+		return nil, fmt.Errorf("%s: %w", err.Error(), auth.ErrDatabaseError)
+	}
+
+	return dto.NewFactory().NewRefreshToken(id, familyID, userID, rotated, revoked, expiresAt, createdAt), nil
+}
@@ -0,0 +1,181 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/org39/webapp-tutorial-backend/entity/dto"
+	"github.com/org39/webapp-tutorial-backend/pkg/db"
+	"github.com/org39/webapp-tutorial-backend/usecase/auth"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type RefreshTokenRepoTestSuite struct {
+	suite.Suite
+	RefreshTokenRepository auth.RefreshTokenRepository
+	DB                     *db.DB
+	Sqlmock                sqlmock.Sqlmock
+}
+
+func (s *RefreshTokenRepoTestSuite) SetupTest() {
+	mockdb, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		assert.Fail(s.T(), fmt.Sprintf("fail to sqlmock: %s", err))
+	}
+	s.DB = &db.DB{DB: mockdb}
+	s.Sqlmock = mock
+
+	r, err := NewRefreshTokenRepository(
+		WithRefreshTokenTable("refresh_tokens"),
+		WithRefreshTokenDB(s.DB),
+	)
+	if err != nil {
+		assert.Fail(s.T(), fmt.Sprintf("fail to create repository: %s", err))
+	}
+
+	s.RefreshTokenRepository = r
+}
+
+func (s *RefreshTokenRepoTestSuite) TearDownTest() {
+	s.DB.Close()
+}
+
+func (s *RefreshTokenRepoTestSuite) newRefreshToken() *dto.RefreshToken {
+	id := "4daaaea8-4721-4644-aaac-7958805b4530"
+	familyID := "fb2211c9-5d53-4a44-895b-79c42174d521"
+	userID := "2192fc7b-bd9b-446d-a50e-5ce0ba02cee6"
+	return dto.NewFactory().NewRefreshToken(id, familyID, userID, false, false, time.Now().Add(time.Hour), time.Now())
+}
+
+func (s *RefreshTokenRepoTestSuite) TestStoreSuccess() {
+	ctx := context.Background()
+	t := s.newRefreshToken()
+
+	q := "INSERT INTO refresh_tokens (id,family_id,user_id,rotated,revoked,expires_at,created_at) VALUES (?,?,?,?,?,?,?)"
+	s.Sqlmock.ExpectBegin()
+	s.Sqlmock.ExpectExec(q).
+		WithArgs(t.ID, t.FamilyID, t.UserID, t.Rotated, t.Revoked, t.ExpiresAt, t.CreatedAt).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	s.Sqlmock.ExpectCommit()
+
+	// assert
+	err := s.RefreshTokenRepository.Store(ctx, t)
+	assert.NoError(s.T(), err)
+	assert.NoError(s.T(), s.Sqlmock.ExpectationsWereMet())
+}
+
+func (s *RefreshTokenRepoTestSuite) TestFetchByIDExist() {
+	ctx := context.Background()
+	t := s.newRefreshToken()
+
+	q := "SELECT id, family_id, user_id, rotated, revoked, expires_at, created_at FROM refresh_tokens WHERE id = ?"
+	s.Sqlmock.ExpectQuery(q).
+		WithArgs(t.ID).
+		WillReturnRows(
+			sqlmock.
+				NewRows(refreshTokenCols).
+				AddRow(t.ID, t.FamilyID, t.UserID, t.Rotated, t.Revoked, t.ExpiresAt, t.CreatedAt),
+		)
+
+	// assert
+	res, err := s.RefreshTokenRepository.FetchByID(ctx, t.ID)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), t.ID, res.ID)
+	assert.Equal(s.T(), t.FamilyID, res.FamilyID)
+	assert.Equal(s.T(), t.UserID, res.UserID)
+	assert.NoError(s.T(), s.Sqlmock.ExpectationsWereMet())
+}
+
+func (s *RefreshTokenRepoTestSuite) TestFetchByIDNotExist() {
+	ctx := context.Background()
+	id := "4daaaea8-4721-4644-aaac-7958805b4530"
+
+	q := "SELECT id, family_id, user_id, rotated, revoked, expires_at, created_at FROM refresh_tokens WHERE id = ?"
+	s.Sqlmock.ExpectQuery(q).
+		WithArgs(id).
+		WillReturnError(sql.ErrNoRows)
+
+	// assert
+	res, err := s.RefreshTokenRepository.FetchByID(ctx, id)
+	assert.Nil(s.T(), res)
+	assert.ErrorIs(s.T(), err, auth.ErrNotFound)
+	assert.NoError(s.T(), s.Sqlmock.ExpectationsWereMet())
+}
+
+func (s *RefreshTokenRepoTestSuite) TestRotateSuccess() {
+	ctx := context.Background()
+	t := s.newRefreshToken()
+
+	q := "UPDATE refresh_tokens SET rotated = ? WHERE id = ? AND revoked = ? AND rotated = ?"
+	s.Sqlmock.ExpectBegin()
+	s.Sqlmock.ExpectExec(q).
+		WithArgs(true, t.ID, false, false).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	s.Sqlmock.ExpectCommit()
+
+	// assert
+	err := s.RefreshTokenRepository.Rotate(ctx, t)
+	assert.NoError(s.T(), err)
+	assert.NoError(s.T(), s.Sqlmock.ExpectationsWereMet())
+}
+
+func (s *RefreshTokenRepoTestSuite) TestRotateAlreadyRotated() {
+	ctx := context.Background()
+	t := s.newRefreshToken()
+
+	q := "UPDATE refresh_tokens SET rotated = ? WHERE id = ? AND revoked = ? AND rotated = ?"
+	s.Sqlmock.ExpectBegin()
+	s.Sqlmock.ExpectExec(q).
+		WithArgs(true, t.ID, false, false).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	s.Sqlmock.ExpectCommit()
+
+	// assert
+	err := s.RefreshTokenRepository.Rotate(ctx, t)
+	assert.ErrorIs(s.T(), err, auth.ErrNotFound)
+	assert.NoError(s.T(), s.Sqlmock.ExpectationsWereMet())
+}
+
+func (s *RefreshTokenRepoTestSuite) TestRevokeFamilySuccess() {
+	ctx := context.Background()
+	t := s.newRefreshToken()
+
+	q := "UPDATE refresh_tokens SET revoked = ? WHERE family_id = ?"
+	s.Sqlmock.ExpectBegin()
+	s.Sqlmock.ExpectExec(q).
+		WithArgs(true, t.FamilyID).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	s.Sqlmock.ExpectCommit()
+
+	// assert
+	err := s.RefreshTokenRepository.RevokeFamily(ctx, t.FamilyID)
+	assert.NoError(s.T(), err)
+	assert.NoError(s.T(), s.Sqlmock.ExpectationsWereMet())
+}
+
+func (s *RefreshTokenRepoTestSuite) TestRevokeAllByUserSuccess() {
+	ctx := context.Background()
+	t := s.newRefreshToken()
+
+	q := "UPDATE refresh_tokens SET revoked = ? WHERE revoked = ? AND user_id = ?"
+	s.Sqlmock.ExpectBegin()
+	s.Sqlmock.ExpectExec(q).
+		WithArgs(true, false, t.UserID).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	s.Sqlmock.ExpectCommit()
+
+	// assert
+	err := s.RefreshTokenRepository.RevokeAllByUser(ctx, t.UserID)
+	assert.NoError(s.T(), err)
+	assert.NoError(s.T(), s.Sqlmock.ExpectationsWereMet())
+}
+
+func TestRefreshTokenRepo(t *testing.T) {
+	suite.Run(t, new(RefreshTokenRepoTestSuite))
+}
@@ -0,0 +1,185 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/org39/webapp-tutorial-backend/entity/dto"
+	"github.com/org39/webapp-tutorial-backend/pkg/db"
+	"github.com/org39/webapp-tutorial-backend/usecase/auth"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+var (
+	sessionCols = []string{"id", "user_id", "label", "user_agent", "ip", "revoked", "last_seen_at", "expires_at", "created_at"}
+)
+
+type SessionRepository struct {
+	DB    *db.DB `inject:""`
+	Table string `inject:"repo.session.table"`
+}
+
+func NewSessionRepository(options ...func(*SessionRepository) error) (auth.SessionRepository, error) {
+	r := &SessionRepository{}
+
+	for _, option := range options {
+		if err := option(r); err != nil {
+			return nil, err
+		}
+	}
+
+	return r, nil
+}
+
+func WithSessionDB(db *db.DB) func(*SessionRepository) error {
+	return func(r *SessionRepository) error {
+		r.DB = db
+		return nil
+	}
+}
+
+func WithSessionTable(table string) func(*SessionRepository) error {
+	return func(r *SessionRepository) error {
+		r.Table = table
+		return nil
+	}
+}
+
+func (r *SessionRepository) Store(ctx context.Context, s *dto.Session) error {
+	query, args, err := sq.Insert(r.Table).
+		Columns(sessionCols...).
+		Values(s.ID, s.UserID, s.Label, s.UserAgent, s.IP, s.Revoked, s.LastSeenAt, s.ExpiresAt, s.CreatedAt).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("%s: %w", err.Error(), auth.ErrDatabaseError)
+	}
+
+	_, err = r.DB.Exec(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("%s: %w", err.Error(), auth.ErrDatabaseError)
+	}
+	return nil
+}
+
+func (r *SessionRepository) FetchByID(ctx context.Context, id string) (*dto.Session, error) {
+	query, args, err := r.selectSession().Where(sq.Eq{"id": id}).ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", err.Error(), auth.ErrDatabaseError)
+	}
+
+	row := r.DB.QueryRow(ctx, query, args...)
+	s, err := r.scanSession(row)
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// FetchActiveByUserID returns the sessions of the user which are neither revoked nor expired at now,
+// the most recently seen first.
+func (r *SessionRepository) FetchActiveByUserID(ctx context.Context, userID string, now time.Time) ([]*dto.Session, error) {
+	query, args, err := r.selectSession().
+		Where(sq.Eq{"user_id": userID, "revoked": false}).
+		Where(sq.Gt{"expires_at": now}).
+		OrderBy("last_seen_at DESC").
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", err.Error(), auth.ErrDatabaseError)
+	}
+
+	rows, err := r.DB.Query(ctx, query, args...)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return []*dto.Session{}, nil
+	case err != nil:
+		return nil, fmt.Errorf("%s: %w", err.Error(), auth.ErrDatabaseError)
+	}
+	defer rows.Close()
+
+	sessions := []*dto.Session{}
+	for rows.Next() {
+		s, err := r.scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+
+	return sessions, nil
+}
+
+// Touch records a refresh of the session, from the given address.
+func (r *SessionRepository) Touch(ctx context.Context, id string, ip string, lastSeenAt time.Time, expiresAt time.Time) error {
+	query, args, err := sq.Update(r.Table).
+		Set("ip", ip).
+		Set("last_seen_at", lastSeenAt).
+		Set("expires_at", expiresAt).
+		Where(sq.Eq{"id": id, "revoked": false}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("%s: %w", err.Error(), auth.ErrDatabaseError)
+	}
+
+	_, err = r.DB.Exec(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("%s: %w", err.Error(), auth.ErrDatabaseError)
+	}
+	return nil
+}
+
+func (r *SessionRepository) Revoke(ctx context.Context, id string) error {
+	query, args, err := sq.Update(r.Table).
+		Set("revoked", true).
+		Where(sq.Eq{"id": id}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("%s: %w", err.Error(), auth.ErrDatabaseError)
+	}
+
+	_, err = r.DB.Exec(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("%s: %w", err.Error(), auth.ErrDatabaseError)
+	}
+	return nil
+}
+
+func (r *SessionRepository) RevokeAllByUser(ctx context.Context, userID string) error {
+	query, args, err := sq.Update(r.Table).
+		Set("revoked", true).
+		Where(sq.Eq{"user_id": userID, "revoked": false}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("%s: %w", err.Error(), auth.ErrDatabaseError)
+	}
+
+	_, err = r.DB.Exec(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("%s: %w", err.Error(), auth.ErrDatabaseError)
+	}
+	return nil
+}
+
+func (r *SessionRepository) selectSession() sq.SelectBuilder {
+	return sq.Select(sessionCols...).From(r.Table)
+}
+
+func (r *SessionRepository) scanSession(row db.Scanable) (*dto.Session, error) {
+	var id, userID, label, userAgent, ip string
+	var revoked bool
+	var lastSeenAt, expiresAt, createdAt time.Time
+
+	err := row.Scan(&id, &userID, &label, &userAgent, &ip, &revoked, &lastSeenAt, &expiresAt, &createdAt)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil, auth.ErrNotFound
+	case err != nil:
+		return nil, fmt.Errorf("%s: %w", err.Error(), auth.ErrDatabaseError)
+	}
+
+	return dto.NewFactory().NewSession(id, userID, label, userAgent, ip, revoked, lastSeenAt, expiresAt, createdAt), nil
+}
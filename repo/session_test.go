@@ -0,0 +1,204 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/org39/webapp-tutorial-backend/entity/dto"
+	"github.com/org39/webapp-tutorial-backend/pkg/db"
+	"github.com/org39/webapp-tutorial-backend/usecase/auth"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type SessionRepoTestSuite struct {
+	suite.Suite
+	SessionRepository auth.SessionRepository
+	DB                *db.DB
+	Sqlmock           sqlmock.Sqlmock
+}
+
+func (s *SessionRepoTestSuite) SetupTest() {
+	mockdb, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		assert.Fail(s.T(), fmt.Sprintf("fail to sqlmock: %s", err))
+	}
+	s.DB = &db.DB{DB: mockdb}
+	s.Sqlmock = mock
+
+	r, err := NewSessionRepository(
+		WithSessionTable("sessions"),
+		WithSessionDB(s.DB),
+	)
+	if err != nil {
+		assert.Fail(s.T(), fmt.Sprintf("fail to create repository: %s", err))
+	}
+
+	s.SessionRepository = r
+}
+
+func (s *SessionRepoTestSuite) TearDownTest() {
+	s.DB.Close()
+}
+
+func (s *SessionRepoTestSuite) newSession() *dto.Session {
+	id := "4daaaea8-4721-4644-aaac-7958805b4530"
+	userID := "2192fc7b-bd9b-446d-a50e-5ce0ba02cee6"
+	now := time.Now()
+	return dto.NewFactory().NewSession(id, userID, "Firefox on Windows", "Mozilla/5.0 (Windows NT 10.0) Firefox/92.0", "192.0.2.1", false, now, now.Add(time.Hour), now)
+}
+
+func (s *SessionRepoTestSuite) TestStoreSuccess() {
+	ctx := context.Background()
+	t := s.newSession()
+
+	q := "INSERT INTO sessions (id,user_id,label,user_agent,ip,revoked,last_seen_at,expires_at,created_at) VALUES (?,?,?,?,?,?,?,?,?)"
+	s.Sqlmock.ExpectBegin()
+	s.Sqlmock.ExpectExec(q).
+		WithArgs(t.ID, t.UserID, t.Label, t.UserAgent, t.IP, t.Revoked, t.LastSeenAt, t.ExpiresAt, t.CreatedAt).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	s.Sqlmock.ExpectCommit()
+
+	// assert
+	err := s.SessionRepository.Store(ctx, t)
+	assert.NoError(s.T(), err)
+	assert.NoError(s.T(), s.Sqlmock.ExpectationsWereMet())
+}
+
+func (s *SessionRepoTestSuite) TestFetchByIDExist() {
+	ctx := context.Background()
+	t := s.newSession()
+
+	q := "SELECT id, user_id, label, user_agent, ip, revoked, last_seen_at, expires_at, created_at FROM sessions WHERE id = ?"
+	s.Sqlmock.ExpectQuery(q).
+		WithArgs(t.ID).
+		WillReturnRows(
+			sqlmock.
+				NewRows(sessionCols).
+				AddRow(t.ID, t.UserID, t.Label, t.UserAgent, t.IP, t.Revoked, t.LastSeenAt, t.ExpiresAt, t.CreatedAt),
+		)
+
+	// assert
+	res, err := s.SessionRepository.FetchByID(ctx, t.ID)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), t, res)
+	assert.NoError(s.T(), s.Sqlmock.ExpectationsWereMet())
+}
+
+func (s *SessionRepoTestSuite) TestFetchByIDNotExist() {
+	ctx := context.Background()
+	t := s.newSession()
+
+	q := "SELECT id, user_id, label, user_agent, ip, revoked, last_seen_at, expires_at, created_at FROM sessions WHERE id = ?"
+	s.Sqlmock.ExpectQuery(q).
+		WithArgs(t.ID).
+		WillReturnError(sql.ErrNoRows)
+
+	// assert
+	res, err := s.SessionRepository.FetchByID(ctx, t.ID)
+	assert.Nil(s.T(), res)
+	assert.ErrorIs(s.T(), err, auth.ErrNotFound)
+	assert.NoError(s.T(), s.Sqlmock.ExpectationsWereMet())
+}
+
+func (s *SessionRepoTestSuite) TestFetchActiveByUserIDExist() {
+	ctx := context.Background()
+	t := s.newSession()
+	now := time.Now()
+
+	q := "SELECT id, user_id, label, user_agent, ip, revoked, last_seen_at, expires_at, created_at FROM sessions WHERE revoked = ? AND user_id = ? AND expires_at > ? ORDER BY last_seen_at DESC"
+	s.Sqlmock.ExpectQuery(q).
+		WithArgs(false, t.UserID, now).
+		WillReturnRows(
+			sqlmock.
+				NewRows(sessionCols).
+				AddRow(t.ID, t.UserID, t.Label, t.UserAgent, t.IP, t.Revoked, t.LastSeenAt, t.ExpiresAt, t.CreatedAt),
+		)
+
+	// assert
+	res, err := s.SessionRepository.FetchActiveByUserID(ctx, t.UserID, now)
+	assert.NoError(s.T(), err)
+	assert.Len(s.T(), res, 1)
+	assert.Equal(s.T(), t.ID, res[0].ID)
+	assert.NoError(s.T(), s.Sqlmock.ExpectationsWereMet())
+}
+
+func (s *SessionRepoTestSuite) TestFetchActiveByUserIDNotExist() {
+	ctx := context.Background()
+	t := s.newSession()
+	now := time.Now()
+
+	q := "SELECT id, user_id, label, user_agent, ip, revoked, last_seen_at, expires_at, created_at FROM sessions WHERE revoked = ? AND user_id = ? AND expires_at > ? ORDER BY last_seen_at DESC"
+	s.Sqlmock.ExpectQuery(q).
+		WithArgs(false, t.UserID, now).
+		WillReturnError(sql.ErrNoRows)
+
+	// assert
+	res, err := s.SessionRepository.FetchActiveByUserID(ctx, t.UserID, now)
+	assert.NotNil(s.T(), res)
+	assert.Empty(s.T(), res)
+	assert.NoError(s.T(), err)
+	assert.NoError(s.T(), s.Sqlmock.ExpectationsWereMet())
+}
+
+func (s *SessionRepoTestSuite) TestTouchSuccess() {
+	ctx := context.Background()
+	t := s.newSession()
+	now := time.Now()
+	expiresAt := now.Add(time.Hour)
+
+	q := "UPDATE sessions SET ip = ?, last_seen_at = ?, expires_at = ? WHERE id = ? AND revoked = ?"
+	s.Sqlmock.ExpectBegin()
+	s.Sqlmock.ExpectExec(q).
+		WithArgs("198.51.100.7", now, expiresAt, t.ID, false).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	s.Sqlmock.ExpectCommit()
+
+	// assert
+	err := s.SessionRepository.Touch(ctx, t.ID, "198.51.100.7", now, expiresAt)
+	assert.NoError(s.T(), err)
+	assert.NoError(s.T(), s.Sqlmock.ExpectationsWereMet())
+}
+
+func (s *SessionRepoTestSuite) TestRevokeSuccess() {
+	ctx := context.Background()
+	t := s.newSession()
+
+	q := "UPDATE sessions SET revoked = ? WHERE id = ?"
+	s.Sqlmock.ExpectBegin()
+	s.Sqlmock.ExpectExec(q).
+		WithArgs(true, t.ID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	s.Sqlmock.ExpectCommit()
+
+	// assert
+	err := s.SessionRepository.Revoke(ctx, t.ID)
+	assert.NoError(s.T(), err)
+	assert.NoError(s.T(), s.Sqlmock.ExpectationsWereMet())
+}
+
+func (s *SessionRepoTestSuite) TestRevokeAllByUserSuccess() {
+	ctx := context.Background()
+	t := s.newSession()
+
+	q := "UPDATE sessions SET revoked = ? WHERE revoked = ? AND user_id = ?"
+	s.Sqlmock.ExpectBegin()
+	s.Sqlmock.ExpectExec(q).
+		WithArgs(true, false, t.UserID).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	s.Sqlmock.ExpectCommit()
+
+	// assert
+	err := s.SessionRepository.RevokeAllByUser(ctx, t.UserID)
+	assert.NoError(s.T(), err)
+	assert.NoError(s.T(), s.Sqlmock.ExpectationsWereMet())
+}
+
+func TestSessionRepo(t *testing.T) {
+	suite.Run(t, new(SessionRepoTestSuite))
+}
@@ -0,0 +1,250 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/org39/webapp-tutorial-backend/entity/dto"
+	"github.com/org39/webapp-tutorial-backend/pkg/db"
+	"github.com/org39/webapp-tutorial-backend/usecase/todo"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+var (
+	tagCols = []string{"id", "user_id", "name", "color", "created_at", "updated_at"}
+)
+
+// TagRepository keeps tags, and which todos have them in the todo tag table.
+type TagRepository struct {
+	DB           *db.DB `inject:""`
+	Table        string `inject:"repo.tag.table"`
+	TodoTagTable string `inject:"repo.todo_tag.table"`
+}
+
+func NewTagRepository(options ...func(*TagRepository) error) (todo.TagRepository, error) {
+	r := &TagRepository{}
+
+	for _, option := range options {
+		if err := option(r); err != nil {
+			return nil, err
+		}
+	}
+
+	return r, nil
+}
+
+func WithTagDB(db *db.DB) func(*TagRepository) error {
+	return func(r *TagRepository) error {
+		r.DB = db
+		return nil
+	}
+}
+
+func WithTagTable(table string) func(*TagRepository) error {
+	return func(r *TagRepository) error {
+		r.Table = table
+		return nil
+	}
+}
+
+func WithTagTodoTagTable(table string) func(*TagRepository) error {
+	return func(r *TagRepository) error {
+		r.TodoTagTable = table
+		return nil
+	}
+}
+
+func (r *TagRepository) Store(ctx context.Context, t *dto.Tag) error {
+	query, args, err := sq.Insert(r.Table).Columns(tagCols...).
+		Values(t.ID, t.UserID, t.Name, t.Color, t.CreatedAt, t.UpdatedAt).ToSql()
+	if err != nil {
+		return fmt.Errorf("%s: %w", err.Error(), todo.ErrDatabaseError)
+	}
+
+	_, err = r.DB.Exec(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("%s: %w", err.Error(), todo.ErrDatabaseError)
+	}
+	return nil
+}
+
+func (r *TagRepository) Update(ctx context.Context, t *dto.Tag) error {
+	query, args, err := sq.Update(r.Table).
+		Set("name", t.Name).
+		Set("color", t.Color).
+		Set("updated_at", t.UpdatedAt).
+		Where(sq.Eq{"id": t.ID}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("%s: %w", err.Error(), todo.ErrDatabaseError)
+	}
+
+	_, err = r.DB.Exec(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("%s: %w", err.Error(), todo.ErrDatabaseError)
+	}
+	return nil
+}
+
+// Delete removes the tag from its todos and deletes it, all or nothing.
+func (r *TagRepository) Delete(ctx context.Context, t *dto.Tag) error {
+	queries := []sq.DeleteBuilder{
+		sq.Delete(r.TodoTagTable).Where(sq.Eq{"tag_id": t.ID}),
+		sq.Delete(r.Table).Where(sq.Eq{"id": t.ID}),
+	}
+
+	err := r.DB.WithTransaction(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		for _, q := range queries {
+			query, args, err := q.ToSql()
+			if err != nil {
+				return err
+			}
+
+			if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", err.Error(), todo.ErrDatabaseError)
+	}
+	return nil
+}
+
+func (r *TagRepository) FetchByID(ctx context.Context, id string) (*dto.Tag, error) {
+	query, args, err := sq.Select(tagCols...).From(r.Table).Where(sq.Eq{"id": id}).ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", err.Error(), todo.ErrDatabaseError)
+	}
+
+	row := r.DB.QueryRow(ctx, query, args...)
+	t, err := r.scanTag(row)
+	if err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// FetchAllByUser returns the tags of the user by name.
+func (r *TagRepository) FetchAllByUser(ctx context.Context, u *dto.User) ([]*dto.Tag, error) {
+	query, args, err := sq.Select(tagCols...).From(r.Table).
+		Where(sq.Eq{"user_id": u.ID}).
+		OrderBy("name", "id").
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", err.Error(), todo.ErrDatabaseError)
+	}
+
+	rows, err := r.DB.Query(ctx, query, args...)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return []*dto.Tag{}, nil
+	case err != nil:
+		return nil, fmt.Errorf("%s: %w", err.Error(), todo.ErrDatabaseError)
+	}
+	defer rows.Close()
+
+	tags := []*dto.Tag{}
+	for rows.Next() {
+		t, err := r.scanTag(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", err.Error(), todo.ErrDatabaseError)
+		}
+		tags = append(tags, t)
+	}
+
+	return tags, nil
+}
+
+// FetchByTodos returns the tags of each todo by name, todos without tags are left out.
+func (r *TagRepository) FetchByTodos(ctx context.Context, todoIDs []string) (map[string][]*dto.Tag, error) {
+	cols := make([]string, len(tagCols))
+	for i, c := range tagCols {
+		cols[i] = "t." + c
+	}
+
+	query, args, err := sq.Select("tt.todo_id").Columns(cols...).
+		From(r.TodoTagTable+" tt").
+		Join(r.Table+" t ON t.id = tt.tag_id").
+		Where(sq.Eq{"tt.todo_id": todoIDs}).
+		OrderBy("t.name", "t.id").
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", err.Error(), todo.ErrDatabaseError)
+	}
+
+	rows, err := r.DB.Query(ctx, query, args...)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return map[string][]*dto.Tag{}, nil
+	case err != nil:
+		return nil, fmt.Errorf("%s: %w", err.Error(), todo.ErrDatabaseError)
+	}
+	defer rows.Close()
+
+	tags := map[string][]*dto.Tag{}
+	for rows.Next() {
+		var todoID, id, userID, name, color string
+		var createdAt, updatedAt time.Time
+
+		if err := rows.Scan(&todoID, &id, &userID, &name, &color, &createdAt, &updatedAt); err != nil {
+			return nil, fmt.Errorf("%s: %w", err.Error(), todo.ErrDatabaseError)
+		}
+		tags[todoID] = append(tags[todoID], dto.NewFactory().NewTag(id, userID, name, color, createdAt, updatedAt))
+	}
+
+	return tags, nil
+}
+
+// Attach tags the todo, tagging it twice changes nothing.
+func (r *TagRepository) Attach(ctx context.Context, t *dto.Todo, tag *dto.Tag) error {
+	query, args, err := sq.Insert(r.TodoTagTable).Options("IGNORE").
+		Columns("todo_id", "tag_id", "user_id", "created_at").
+		Values(t.ID, tag.ID, t.UserID, time.Now()).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("%s: %w", err.Error(), todo.ErrDatabaseError)
+	}
+
+	_, err = r.DB.Exec(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("%s: %w", err.Error(), todo.ErrDatabaseError)
+	}
+	return nil
+}
+
+func (r *TagRepository) Detach(ctx context.Context, t *dto.Todo, tag *dto.Tag) error {
+	query, args, err := sq.Delete(r.TodoTagTable).
+		Where(sq.Eq{"todo_id": t.ID, "tag_id": tag.ID}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("%s: %w", err.Error(), todo.ErrDatabaseError)
+	}
+
+	_, err = r.DB.Exec(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("%s: %w", err.Error(), todo.ErrDatabaseError)
+	}
+	return nil
+}
+
+func (r *TagRepository) scanTag(row db.Scanable) (*dto.Tag, error) {
+	var id, userID, name, color string
+	var createdAt, updatedAt time.Time
+
+	err := row.Scan(&id, &userID, &name, &color, &createdAt, &updatedAt)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil, todo.ErrNotFound
+	case err != nil:
+		return nil, fmt.Errorf("%s: %w", err.Error(), todo.ErrDatabaseError)
+	}
+
+	return dto.NewFactory().NewTag(id, userID, name, color, createdAt, updatedAt), nil
+}
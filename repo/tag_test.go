@@ -0,0 +1,234 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/org39/webapp-tutorial-backend/entity/dto"
+	"github.com/org39/webapp-tutorial-backend/pkg/db"
+	"github.com/org39/webapp-tutorial-backend/usecase/todo"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type TagRepoTestSuite struct {
+	suite.Suite
+	TagRepository todo.TagRepository
+	DB            *db.DB
+	Sqlmock       sqlmock.Sqlmock
+}
+
+func (s *TagRepoTestSuite) SetupTest() {
+	mockdb, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		assert.Fail(s.T(), fmt.Sprintf("fail to sqlmock: %s", err))
+	}
+	s.DB = &db.DB{DB: mockdb}
+	s.Sqlmock = mock
+
+	r, err := NewTagRepository(
+		WithTagTable("tags"),
+		WithTagTodoTagTable("todo_tags"),
+		WithTagDB(s.DB),
+	)
+	if err != nil {
+		assert.Fail(s.T(), fmt.Sprintf("fail to create repository: %s", err))
+	}
+
+	s.TagRepository = r
+}
+
+func (s *TagRepoTestSuite) TearDownTest() {
+	s.DB.Close()
+}
+
+func (s *TagRepoTestSuite) TestStoreSuccess() {
+	ctx := context.Background()
+
+	t := dto.NewFactory().NewTag("7d3c1a52-96b4-4f0e-8d2b-3a1f6e9c0b47", "2192fc7b-bd9b-446d-a50e-5ce0ba02cee6", "home", "#4caf50", time.Now(), time.Now())
+
+	q := "INSERT INTO tags (id,user_id,name,color,created_at,updated_at) VALUES (?,?,?,?,?,?)"
+	s.Sqlmock.ExpectBegin()
+	s.Sqlmock.ExpectExec(q).
+		WithArgs(t.ID, t.UserID, t.Name, t.Color, t.CreatedAt, t.UpdatedAt).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	s.Sqlmock.ExpectCommit()
+
+	// assert
+	err := s.TagRepository.Store(ctx, t)
+	assert.NoError(s.T(), err)
+	assert.NoError(s.T(), s.Sqlmock.ExpectationsWereMet())
+}
+
+func (s *TagRepoTestSuite) TestUpdateSuccess() {
+	ctx := context.Background()
+
+	t := dto.NewFactory().NewTag("7d3c1a52-96b4-4f0e-8d2b-3a1f6e9c0b47", "2192fc7b-bd9b-446d-a50e-5ce0ba02cee6", "home", "#4caf50", time.Now(), time.Now())
+
+	q := "UPDATE tags SET name = ?, color = ?, updated_at = ? WHERE id = ?"
+	s.Sqlmock.ExpectBegin()
+	s.Sqlmock.ExpectExec(q).
+		WithArgs(t.Name, t.Color, t.UpdatedAt, t.ID).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	s.Sqlmock.ExpectCommit()
+
+	// assert
+	err := s.TagRepository.Update(ctx, t)
+	assert.NoError(s.T(), err)
+	assert.NoError(s.T(), s.Sqlmock.ExpectationsWereMet())
+}
+
+func (s *TagRepoTestSuite) TestDeleteSuccess() {
+	ctx := context.Background()
+
+	t := dto.NewFactory().NewTag("7d3c1a52-96b4-4f0e-8d2b-3a1f6e9c0b47", "2192fc7b-bd9b-446d-a50e-5ce0ba02cee6", "home", "#4caf50", time.Now(), time.Now())
+
+	// the tag is removed from its todos first
+	s.Sqlmock.ExpectBegin()
+	s.Sqlmock.ExpectExec("DELETE FROM todo_tags WHERE tag_id = ?").
+		WithArgs(t.ID).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	s.Sqlmock.ExpectExec("DELETE FROM tags WHERE id = ?").
+		WithArgs(t.ID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	s.Sqlmock.ExpectCommit()
+
+	// assert
+	err := s.TagRepository.Delete(ctx, t)
+	assert.NoError(s.T(), err)
+	assert.NoError(s.T(), s.Sqlmock.ExpectationsWereMet())
+}
+
+func (s *TagRepoTestSuite) TestFetchByIDExist() {
+	ctx := context.Background()
+
+	t := dto.NewFactory().NewTag("7d3c1a52-96b4-4f0e-8d2b-3a1f6e9c0b47", "2192fc7b-bd9b-446d-a50e-5ce0ba02cee6", "home", "#4caf50", time.Now(), time.Now())
+
+	q := "SELECT id, user_id, name, color, created_at, updated_at FROM tags WHERE id = ?"
+	s.Sqlmock.ExpectQuery(q).
+		WithArgs(t.ID).
+		WillReturnRows(
+			sqlmock.NewRows(tagCols).
+				AddRow(t.ID, t.UserID, t.Name, t.Color, t.CreatedAt, t.UpdatedAt),
+		)
+
+	// assert
+	res, err := s.TagRepository.FetchByID(ctx, t.ID)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), t, res)
+	assert.NoError(s.T(), s.Sqlmock.ExpectationsWereMet())
+}
+
+func (s *TagRepoTestSuite) TestFetchByIDNotExist() {
+	ctx := context.Background()
+
+	id := "7d3c1a52-96b4-4f0e-8d2b-3a1f6e9c0b47"
+	q := "SELECT id, user_id, name, color, created_at, updated_at FROM tags WHERE id = ?"
+	s.Sqlmock.ExpectQuery(q).
+		WithArgs(id).
+		WillReturnError(sql.ErrNoRows)
+
+	// assert
+	res, err := s.TagRepository.FetchByID(ctx, id)
+	assert.Nil(s.T(), res)
+	assert.ErrorIs(s.T(), err, todo.ErrNotFound)
+	assert.NoError(s.T(), s.Sqlmock.ExpectationsWereMet())
+}
+
+func (s *TagRepoTestSuite) TestFetchAllByUser() {
+	ctx := context.Background()
+
+	u := dto.NewFactory().NewUser("2192fc7b-bd9b-446d-a50e-5ce0ba02cee6", "hatsune@miku.com", "PASSWORD", nil, nil, nil, time.Now())
+	t0 := dto.NewFactory().NewTag("7d3c1a52-96b4-4f0e-8d2b-3a1f6e9c0b47", u.ID, "home", "#4caf50", time.Now(), time.Now())
+	t1 := dto.NewFactory().NewTag("e5b9f2d4-1c8a-4b6e-9f3d-7a2c5e8b1d60", u.ID, "work", "#9e9e9e", time.Now(), time.Now())
+
+	q := "SELECT id, user_id, name, color, created_at, updated_at FROM tags WHERE user_id = ? ORDER BY name, id"
+	s.Sqlmock.ExpectQuery(q).
+		WithArgs(u.ID).
+		WillReturnRows(
+			sqlmock.NewRows(tagCols).
+				AddRow(t0.ID, t0.UserID, t0.Name, t0.Color, t0.CreatedAt, t0.UpdatedAt).
+				AddRow(t1.ID, t1.UserID, t1.Name, t1.Color, t1.CreatedAt, t1.UpdatedAt),
+		)
+
+	// assert
+	res, err := s.TagRepository.FetchAllByUser(ctx, u)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), []*dto.Tag{t0, t1}, res)
+	assert.NoError(s.T(), s.Sqlmock.ExpectationsWereMet())
+}
+
+func (s *TagRepoTestSuite) TestFetchByTodos() {
+	ctx := context.Background()
+
+	userID := "2192fc7b-bd9b-446d-a50e-5ce0ba02cee6"
+	todoID0 := "4daaaea8-4721-4644-aaac-7958805b4530"
+	todoID1 := "fb2211c9-5d53-4a44-895b-79c42174d521"
+	t0 := dto.NewFactory().NewTag("7d3c1a52-96b4-4f0e-8d2b-3a1f6e9c0b47", userID, "home", "#4caf50", time.Now(), time.Now())
+	t1 := dto.NewFactory().NewTag("e5b9f2d4-1c8a-4b6e-9f3d-7a2c5e8b1d60", userID, "work", "#9e9e9e", time.Now(), time.Now())
+
+	q := "SELECT tt.todo_id, t.id, t.user_id, t.name, t.color, t.created_at, t.updated_at FROM todo_tags tt JOIN tags t ON t.id = tt.tag_id WHERE tt.todo_id IN (?,?) ORDER BY t.name, t.id"
+	s.Sqlmock.ExpectQuery(q).
+		WithArgs(todoID0, todoID1).
+		WillReturnRows(
+			sqlmock.NewRows(append([]string{"todo_id"}, tagCols...)).
+				AddRow(todoID0, t0.ID, t0.UserID, t0.Name, t0.Color, t0.CreatedAt, t0.UpdatedAt).
+				AddRow(todoID0, t1.ID, t1.UserID, t1.Name, t1.Color, t1.CreatedAt, t1.UpdatedAt),
+		)
+
+	// assert, todos without tags are left out
+	res, err := s.TagRepository.FetchByTodos(ctx, []string{todoID0, todoID1})
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), map[string][]*dto.Tag{todoID0: {t0, t1}}, res)
+	assert.NoError(s.T(), s.Sqlmock.ExpectationsWereMet())
+}
+
+func (s *TagRepoTestSuite) TestAttachSuccess() {
+	ctx := context.Background()
+
+	userID := "2192fc7b-bd9b-446d-a50e-5ce0ba02cee6"
+	t := dto.NewFactory().NewTodo("4daaaea8-4721-4644-aaac-7958805b4530", userID, "things todo", false, time.Now(), time.Now(), false, nil, 0, 0)
+	tag := dto.NewFactory().NewTag("7d3c1a52-96b4-4f0e-8d2b-3a1f6e9c0b47", userID, "home", "#4caf50", time.Now(), time.Now())
+
+	// tagging twice is ignored
+	q := "INSERT IGNORE INTO todo_tags (todo_id,tag_id,user_id,created_at) VALUES (?,?,?,?)"
+	s.Sqlmock.ExpectBegin()
+	s.Sqlmock.ExpectExec(q).
+		WithArgs(t.ID, tag.ID, userID, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	s.Sqlmock.ExpectCommit()
+
+	// assert
+	err := s.TagRepository.Attach(ctx, t, tag)
+	assert.NoError(s.T(), err)
+	assert.NoError(s.T(), s.Sqlmock.ExpectationsWereMet())
+}
+
+func (s *TagRepoTestSuite) TestDetachSuccess() {
+	ctx := context.Background()
+
+	userID := "2192fc7b-bd9b-446d-a50e-5ce0ba02cee6"
+	t := dto.NewFactory().NewTodo("4daaaea8-4721-4644-aaac-7958805b4530", userID, "things todo", false, time.Now(), time.Now(), false, nil, 0, 0)
+	tag := dto.NewFactory().NewTag("7d3c1a52-96b4-4f0e-8d2b-3a1f6e9c0b47", userID, "home", "#4caf50", time.Now(), time.Now())
+
+	q := "DELETE FROM todo_tags WHERE tag_id = ? AND todo_id = ?"
+	s.Sqlmock.ExpectBegin()
+	s.Sqlmock.ExpectExec(q).
+		WithArgs(tag.ID, t.ID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	s.Sqlmock.ExpectCommit()
+
+	// assert
+	err := s.TagRepository.Detach(ctx, t, tag)
+	assert.NoError(s.T(), err)
+	assert.NoError(s.T(), s.Sqlmock.ExpectationsWereMet())
+}
+
+func TestTagRepo(t *testing.T) {
+	suite.Run(t, new(TagRepoTestSuite))
+}
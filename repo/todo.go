@@ -15,12 +15,27 @@ import (
 )
 
 var (
-	todoCols = []string{"id", "user_id", "content", "completed", "created_at", "updated_at", "deleted"}
+	todoCols = []string{"id", "user_id", "content", "completed", "created_at", "updated_at", "deleted", "due_at", "priority", "position"}
+
+	// columns todos can be sorted by, nothing else reaches ORDER BY
+	todoSortColumns = map[string]bool{
+		"created_at": true,
+		"updated_at": true,
+		"due_at":     true,
+		"priority":   true,
+		"position":   true,
+	}
+	// sort columns a todo may have no value in
+	todoNullableSortColumns = map[string]bool{
+		"due_at": true,
+	}
 )
 
 type TodoRepository struct {
 	DB    *db.DB `inject:""`
 	Table string `inject:"repo.todo.table"`
+	// which todos have which tags, for filtering by tag
+	TodoTagTable string `inject:"repo.todo_tag.table"`
 }
 
 func NewTodoRepository(options ...func(*TodoRepository) error) (todo.Repository, error) {
@@ -49,9 +64,16 @@ func WithTodoTable(table string) func(*TodoRepository) error {
 	}
 }
 
+func WithTodoTagTable(table string) func(*TodoRepository) error {
+	return func(r *TodoRepository) error {
+		r.TodoTagTable = table
+		return nil
+	}
+}
+
 func (r *TodoRepository) Store(ctx context.Context, t *dto.Todo) error {
 	query, args, err := sq.Insert(r.Table).Columns(todoCols...).
-		Values(t.ID, t.UserID, t.Content, t.Completed, t.CreatedAt, t.UpdatedAt, t.Deleted).ToSql()
+		Values(t.ID, t.UserID, t.Content, t.Completed, t.CreatedAt, t.UpdatedAt, t.Deleted, t.DueAt, t.Priority, t.Position).ToSql()
 	if err != nil {
 		return fmt.Errorf("%s: %w", err.Error(), todo.ErrDatabaseError)
 	}
@@ -68,6 +90,9 @@ func (r *TodoRepository) Update(ctx context.Context, t *dto.Todo) error {
 		Set("content", t.Content).
 		Set("completed", t.Completed).
 		Set("deleted", t.Deleted).
+		Set("due_at", t.DueAt).
+		Set("priority", t.Priority).
+		Set("position", t.Position).
 		Where(sq.Eq{"id": t.ID}).
 		ToSql()
 	if err != nil {
@@ -96,19 +121,66 @@ func (r *TodoRepository) Delete(ctx context.Context, t *dto.Todo) error {
 	return nil
 }
 
-func (r *TodoRepository) FetchAllByUser(ctx context.Context, u *dto.User, showCompleted bool, showDeleted bool) ([]*dto.Todo, error) {
-	q := r.selectTodo()
-	switch {
-	case showCompleted && showDeleted:
-		q = q.Where(sq.Eq{"user_id": u.ID})
-	case !showCompleted && showDeleted:
-		q = q.Where(sq.Eq{"user_id": u.ID, "completed": false})
-	case !showCompleted && !showDeleted:
-		q = q.Where(sq.Eq{"user_id": u.ID, "completed": false, "deleted": false})
-	case showCompleted && !showDeleted:
-		q = q.Where(sq.Eq{"user_id": u.ID, "deleted": false})
+// FetchAllByUser returns every todo of the user selected by the filter.
+func (r *TodoRepository) FetchAllByUser(ctx context.Context, u *dto.User, f *dto.TodoFilter) ([]*dto.Todo, error) {
+	return r.fetchTodos(ctx, r.selectTodo().Where(r.todoFilterCond(u, f)))
+}
+
+// FetchPageByUser returns at most limit todos of the user selected by the filter, in the order.
+// The page starts after the cursor, or with the first todo when it is nil.
+func (r *TodoRepository) FetchPageByUser(ctx context.Context, u *dto.User, f *dto.TodoFilter, sort *dto.TodoSort, after *dto.TodoCursor, limit uint64) ([]*dto.Todo, error) {
+	col := sort.Column
+	if !todoSortColumns[col] {
+		return nil, fmt.Errorf("unknown sort column %q: %w", col, todo.ErrInvalidRequest)
+	}
+
+	direction := "ASC"
+	if sort.Descending {
+		direction = "DESC"
+	}
+
+	where := r.todoFilterCond(u, f)
+	if after != nil {
+		where = append(where, afterCursorCond(col, todoNullableSortColumns[col], sort.Descending, after))
+	}
+
+	q := r.selectTodo().Where(where).
+		OrderBy(col+" "+direction, "id "+direction).
+		Limit(limit)
+	return r.fetchTodos(ctx, q)
+}
+
+// afterCursorCond selects the todos after the cursor in the order.
+// MySQL puts NULLs first in ascending order and last in descending order.
+func afterCursorCond(col string, nullable bool, descending bool, after *dto.TodoCursor) sq.Sqlizer {
+	if after.Value == nil {
+		if descending {
+			return sq.And{sq.Eq{col: nil}, sq.Lt{"id": after.ID}}
+		}
+		return sq.Or{
+			sq.And{sq.Eq{col: nil}, sq.Gt{"id": after.ID}},
+			sq.NotEq{col: nil},
+		}
 	}
 
+	if descending {
+		cond := sq.Or{
+			sq.Lt{col: after.Value},
+			sq.And{sq.Eq{col: after.Value}, sq.Lt{"id": after.ID}},
+		}
+		if nullable {
+			cond = append(cond, sq.Eq{col: nil})
+		}
+		return cond
+	}
+	// NULLs were listed before the cursor, and compare to nothing
+	return sq.Or{
+		sq.Gt{col: after.Value},
+		sq.And{sq.Eq{col: after.Value}, sq.Gt{"id": after.ID}},
+	}
+}
+
+func (r *TodoRepository) fetchTodos(ctx context.Context, q sq.SelectBuilder) ([]*dto.Todo, error) {
 	query, args, err := q.ToSql()
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", err.Error(), todo.ErrDatabaseError)
@@ -150,6 +222,42 @@ func (r *TodoRepository) FetchByID(ctx context.Context, id string) (*dto.Todo, e
 	return t, nil
 }
 
+// todoFilterCond selects the todos of the user matching the filter.
+func (r *TodoRepository) todoFilterCond(u *dto.User, f *dto.TodoFilter) sq.And {
+	where := sq.And{sq.Eq{"user_id": u.ID}}
+	if f.Completed != nil {
+		where = append(where, sq.Eq{"completed": *f.Completed})
+	}
+	if f.Deleted != nil {
+		where = append(where, sq.Eq{"deleted": *f.Deleted})
+	}
+	if f.CreatedAfter != nil {
+		where = append(where, sq.GtOrEq{"created_at": *f.CreatedAfter})
+	}
+	if f.CreatedBefore != nil {
+		where = append(where, sq.Lt{"created_at": *f.CreatedBefore})
+	}
+	if f.UpdatedAfter != nil {
+		where = append(where, sq.GtOrEq{"updated_at": *f.UpdatedAfter})
+	}
+	if f.UpdatedBefore != nil {
+		where = append(where, sq.Lt{"updated_at": *f.UpdatedBefore})
+	}
+	if f.Content != "" {
+		where = append(where, sq.Like{"content": "%" + likeEscaper.Replace(f.Content) + "%"})
+	}
+	if len(f.TagIDs) > 0 {
+		tagged := sq.Select("todo_id").From(r.TodoTagTable).Where(sq.Eq{"tag_id": f.TagIDs})
+		if f.AllTags {
+			// a todo has a tag once, so having them all is having as many as asked for
+			tagged = tagged.GroupBy("todo_id").Having("COUNT(*) = ?", len(f.TagIDs))
+		}
+		where = append(where, sq.Expr("id IN (?)", tagged))
+	}
+
+	return where
+}
+
 func (r *TodoRepository) selectTodo() sq.SelectBuilder {
 	return sq.Select(todoCols...).From(r.Table)
 }
@@ -158,8 +266,10 @@ func (r *TodoRepository) scanTodo(row db.Scanable) (*dto.Todo, error) {
 	var id, userID, content string
 	var completed, deleted bool
 	var createdAt, updatedAt time.Time
+	var dueAt sql.NullTime
+	var priority, position int
 
-	err := row.Scan(&id, &userID, &content, &completed, &createdAt, &updatedAt, &deleted)
+	err := row.Scan(&id, &userID, &content, &completed, &createdAt, &updatedAt, &deleted, &dueAt, &priority, &position)
 	switch {
 	case errors.Is(err, sql.ErrNoRows):
 		return nil, todo.ErrNotFound
@@ -167,5 +277,10 @@ func (r *TodoRepository) scanTodo(row db.Scanable) (*dto.Todo, error) {
 		return nil, fmt.Errorf("%s: %w", err.Error(), todo.ErrDatabaseError)
 	}
 
-	return dto.NewFactory().NewTodo(id, userID, content, completed, createdAt, updatedAt, deleted), nil
+	var due *time.Time
+	if dueAt.Valid {
+		due = &dueAt.Time
+	}
+
+	return dto.NewFactory().NewTodo(id, userID, content, completed, createdAt, updatedAt, deleted, due, priority, position), nil
 }
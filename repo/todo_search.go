@@ -0,0 +1,111 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/org39/webapp-tutorial-backend/entity/dto"
+	"github.com/org39/webapp-tutorial-backend/pkg/db"
+	"github.com/org39/webapp-tutorial-backend/usecase/todo"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+const (
+	// where todos are searched
+	TodoSearchDriverMySQL  = "mysql"
+	TodoSearchDriverMemory = "memory"
+)
+
+// TodoSearchIndex searches todos with the FULLTEXT index on their content.
+type TodoSearchIndex struct {
+	DB    *db.DB `inject:""`
+	Table string `inject:"repo.todo.table"`
+}
+
+func NewTodoSearchIndex(options ...func(*TodoSearchIndex) error) (todo.SearchIndex, error) {
+	i := &TodoSearchIndex{}
+
+	for _, option := range options {
+		if err := option(i); err != nil {
+			return nil, err
+		}
+	}
+
+	return i, nil
+}
+
+func WithTodoSearchDB(db *db.DB) func(*TodoSearchIndex) error {
+	return func(i *TodoSearchIndex) error {
+		i.DB = db
+		return nil
+	}
+}
+
+func WithTodoSearchTable(table string) func(*TodoSearchIndex) error {
+	return func(i *TodoSearchIndex) error {
+		i.Table = table
+		return nil
+	}
+}
+
+// Index does nothing, MySQL keeps the FULLTEXT index up to date.
+func (i *TodoSearchIndex) Index(ctx context.Context, t *dto.Todo) error {
+	return nil
+}
+
+// RemoveUser does nothing, the FULLTEXT index loses the todos with their rows.
+func (i *TodoSearchIndex) RemoveUser(ctx context.Context, u *dto.User) error {
+	return nil
+}
+
+// Search returns at most s.Limit todos of the user which are not deleted, ranked by MySQL's relevance.
+func (i *TodoSearchIndex) Search(ctx context.Context, u *dto.User, s *dto.TodoSearch) ([]*dto.TodoSearchHit, error) {
+	// natural language mode has no operators, the terms need no escaping
+	match := sq.Expr("MATCH (content) AGAINST (? IN NATURAL LANGUAGE MODE)", strings.Join(s.Terms, " "))
+	query, args, err := sq.Select(todoCols...).Column(sq.Alias(match, "score")).From(i.Table).
+		Where(sq.And{sq.Eq{"user_id": u.ID}, sq.Eq{"deleted": false}, match}).
+		OrderBy("score DESC", "id").
+		Limit(s.Limit).
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", err.Error(), todo.ErrDatabaseError)
+	}
+
+	rows, err := i.DB.Query(ctx, query, args...)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return []*dto.TodoSearchHit{}, nil
+	case err != nil:
+		return nil, fmt.Errorf("%s: %w", err.Error(), todo.ErrDatabaseError)
+	}
+	defer rows.Close()
+
+	hits := []*dto.TodoSearchHit{}
+	for rows.Next() {
+		var id, userID, content string
+		var completed, deleted bool
+		var createdAt, updatedAt time.Time
+		var dueAt sql.NullTime
+		var priority, position int
+		var score float64
+
+		if err := rows.Scan(&id, &userID, &content, &completed, &createdAt, &updatedAt, &deleted, &dueAt, &priority, &position, &score); err != nil {
+			return nil, fmt.Errorf("%s: %w", err.Error(), todo.ErrDatabaseError)
+		}
+
+		var due *time.Time
+		if dueAt.Valid {
+			due = &dueAt.Time
+		}
+
+		t := dto.NewFactory().NewTodo(id, userID, content, completed, createdAt, updatedAt, deleted, due, priority, position)
+		hits = append(hits, dto.NewFactory().NewTodoSearchHit(t, score))
+	}
+
+	return hits, nil
+}
@@ -0,0 +1,81 @@
+package repo
+
+import (
+	"context"
+	"sync"
+
+	"github.com/org39/webapp-tutorial-backend/entity/dto"
+	"github.com/org39/webapp-tutorial-backend/pkg/search"
+	"github.com/org39/webapp-tutorial-backend/usecase/todo"
+)
+
+// MemoryTodoSearchIndex searches todos with an inverted index kept in memory, e.g. for tests without MySQL.
+// Only todos indexed since the process started are found.
+type MemoryTodoSearchIndex struct {
+	mu    sync.RWMutex
+	index *search.Index
+	todos map[string]*dto.Todo
+}
+
+func NewMemoryTodoSearchIndex(options ...func(*MemoryTodoSearchIndex) error) (todo.SearchIndex, error) {
+	i := &MemoryTodoSearchIndex{
+		index: search.NewIndex(),
+		todos: map[string]*dto.Todo{},
+	}
+
+	for _, option := range options {
+		if err := option(i); err != nil {
+			return nil, err
+		}
+	}
+
+	return i, nil
+}
+
+// Index adds the todo, or replaces it when it was indexed before.
+func (i *MemoryTodoSearchIndex) Index(ctx context.Context, t *dto.Todo) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	copied := *t
+	i.todos[t.ID] = &copied
+	i.index.Add(t.ID, t.Content)
+	return nil
+}
+
+// RemoveUser removes every todo of the user.
+func (i *MemoryTodoSearchIndex) RemoveUser(ctx context.Context, u *dto.User) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	for id, t := range i.todos {
+		if t.UserID == u.ID {
+			delete(i.todos, id)
+			i.index.Remove(id)
+		}
+	}
+	return nil
+}
+
+// Search returns at most s.Limit todos of the user which are not deleted, ranked with BM25.
+func (i *MemoryTodoSearchIndex) Search(ctx context.Context, u *dto.User, s *dto.TodoSearch) ([]*dto.TodoSearchHit, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	hits := []*dto.TodoSearchHit{}
+	for _, hit := range i.index.Search(s.Terms) {
+		if uint64(len(hits)) == s.Limit {
+			break
+		}
+
+		t := i.todos[hit.ID]
+		if t.UserID != u.ID || t.Deleted {
+			continue
+		}
+
+		copied := *t
+		hits = append(hits, dto.NewFactory().NewTodoSearchHit(&copied, hit.Score))
+	}
+
+	return hits, nil
+}
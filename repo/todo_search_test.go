@@ -0,0 +1,198 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/org39/webapp-tutorial-backend/entity/dto"
+	"github.com/org39/webapp-tutorial-backend/pkg/db"
+	"github.com/org39/webapp-tutorial-backend/usecase/todo"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type TodoSearchIndexTestSuite struct {
+	suite.Suite
+	SearchIndex todo.SearchIndex
+	DB          *db.DB
+	Sqlmock     sqlmock.Sqlmock
+}
+
+func (s *TodoSearchIndexTestSuite) SetupTest() {
+	mockdb, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		assert.Fail(s.T(), fmt.Sprintf("fail to sqlmock: %s", err))
+	}
+	s.DB = &db.DB{DB: mockdb}
+	s.Sqlmock = mock
+
+	i, err := NewTodoSearchIndex(
+		WithTodoSearchTable("todos"),
+		WithTodoSearchDB(s.DB),
+	)
+	if err != nil {
+		assert.Fail(s.T(), fmt.Sprintf("fail to create search index: %s", err))
+	}
+
+	s.SearchIndex = i
+}
+
+func (s *TodoSearchIndexTestSuite) TearDownTest() {
+	s.DB.Close()
+}
+
+func (s *TodoSearchIndexTestSuite) TestIndexDoesNothing() {
+	ctx := context.Background()
+
+	t := dto.NewFactory().NewTodo("4daaaea8-4721-4644-aaac-7958805b4530", "2192fc7b-bd9b-446d-a50e-5ce0ba02cee6", "things todo", false, time.Now(), time.Now(), false, nil, 0, 0)
+
+	// assert, MySQL keeps the index up to date
+	assert.NoError(s.T(), s.SearchIndex.Index(ctx, t))
+	assert.NoError(s.T(), s.Sqlmock.ExpectationsWereMet())
+}
+
+func (s *TodoSearchIndexTestSuite) TestSearchSuccess() {
+	ctx := context.Background()
+
+	u := dto.NewFactory().NewUser("5c2dd83a-6250-40f3-a47e-21d957c07d06", "hatsune@miku.com", "PASSWORD", nil, nil, nil, time.Now())
+	t := dto.NewFactory().NewTodo("fb2211c9-5d53-4a44-895b-79c42174d521", u.ID, "buy milk", false, time.Now(), time.Now(), false, nil, 0, 0)
+	rows := sqlmock.NewRows(append(todoCols, "score")).
+		AddRow(t.ID, t.UserID, t.Content, t.Completed, t.CreatedAt, t.UpdatedAt, t.Deleted, nil, t.Priority, t.Position, 0.25)
+
+	q := "SELECT id, user_id, content, completed, created_at, updated_at, deleted, due_at, priority, position, (MATCH (content) AGAINST (? IN NATURAL LANGUAGE MODE)) AS score FROM todos WHERE (user_id = ? AND deleted = ? AND MATCH (content) AGAINST (? IN NATURAL LANGUAGE MODE)) ORDER BY score DESC, id LIMIT 20"
+	s.Sqlmock.ExpectQuery(q).
+		WithArgs("buy milk", u.ID, false, "buy milk").
+		WillReturnRows(rows)
+
+	// assert
+	res, err := s.SearchIndex.Search(ctx, u, dto.NewFactory().NewTodoSearch([]string{"buy", "milk"}, 20))
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), []*dto.TodoSearchHit{dto.NewFactory().NewTodoSearchHit(t, 0.25)}, res)
+	assert.NoError(s.T(), s.Sqlmock.ExpectationsWereMet())
+}
+
+func (s *TodoSearchIndexTestSuite) TestSearchNotFound() {
+	ctx := context.Background()
+
+	u := dto.NewFactory().NewUser("5c2dd83a-6250-40f3-a47e-21d957c07d06", "hatsune@miku.com", "PASSWORD", nil, nil, nil, time.Now())
+
+	q := "SELECT id, user_id, content, completed, created_at, updated_at, deleted, due_at, priority, position, (MATCH (content) AGAINST (? IN NATURAL LANGUAGE MODE)) AS score FROM todos WHERE (user_id = ? AND deleted = ? AND MATCH (content) AGAINST (? IN NATURAL LANGUAGE MODE)) ORDER BY score DESC, id LIMIT 20"
+	s.Sqlmock.ExpectQuery(q).
+		WithArgs("milk", u.ID, false, "milk").
+		WillReturnError(sql.ErrNoRows)
+
+	// assert
+	res, err := s.SearchIndex.Search(ctx, u, dto.NewFactory().NewTodoSearch([]string{"milk"}, 20))
+	assert.NoError(s.T(), err)
+	assert.Empty(s.T(), res)
+	assert.NoError(s.T(), s.Sqlmock.ExpectationsWereMet())
+}
+
+func TestTodoSearchIndex(t *testing.T) {
+	suite.Run(t, new(TodoSearchIndexTestSuite))
+}
+
+type MemoryTodoSearchIndexTestSuite struct {
+	suite.Suite
+	SearchIndex todo.SearchIndex
+	User        *dto.User
+}
+
+func (s *MemoryTodoSearchIndexTestSuite) SetupTest() {
+	i, err := NewMemoryTodoSearchIndex()
+	if err != nil {
+		assert.Fail(s.T(), fmt.Sprintf("fail to create search index: %s", err))
+	}
+
+	s.SearchIndex = i
+	s.User = dto.NewFactory().NewUser("5c2dd83a-6250-40f3-a47e-21d957c07d06", "hatsune@miku.com", "PASSWORD", nil, nil, nil, time.Now())
+}
+
+func (s *MemoryTodoSearchIndexTestSuite) index(id string, userID string, content string, deleted bool) *dto.Todo {
+	t := dto.NewFactory().NewTodo(id, userID, content, false, time.Now(), time.Now(), deleted, nil, 0, 0)
+	assert.NoError(s.T(), s.SearchIndex.Index(context.Background(), t))
+	return t
+}
+
+func (s *MemoryTodoSearchIndexTestSuite) TestSearchRanksByRelevance() {
+	ctx := context.Background()
+
+	once := s.index("4daaaea8-4721-4644-aaac-7958805b4530", s.User.ID, "buy milk and bread at the shop before noon", false)
+	twice := s.index("fb2211c9-5d53-4a44-895b-79c42174d521", s.User.ID, "milk, more milk", false)
+	_ = s.index("0b8c5f3e-7d41-4c2a-9e6f-58a1d2c4b7e9", s.User.ID, "call grandma", false)
+
+	// assert
+	res, err := s.SearchIndex.Search(ctx, s.User, dto.NewFactory().NewTodoSearch([]string{"milk"}, 20))
+	assert.NoError(s.T(), err)
+	assert.Len(s.T(), res, 2)
+	assert.Equal(s.T(), twice.ID, res[0].Todo.ID)
+	assert.Equal(s.T(), once.ID, res[1].Todo.ID)
+	assert.Greater(s.T(), res[0].Score, res[1].Score)
+
+	// assert, limit
+	res, err = s.SearchIndex.Search(ctx, s.User, dto.NewFactory().NewTodoSearch([]string{"milk"}, 1))
+	assert.NoError(s.T(), err)
+	assert.Len(s.T(), res, 1)
+	assert.Equal(s.T(), twice.ID, res[0].Todo.ID)
+}
+
+func (s *MemoryTodoSearchIndexTestSuite) TestSearchOnlyFindsTodosOfUserNotDeleted() {
+	ctx := context.Background()
+
+	mine := s.index("4daaaea8-4721-4644-aaac-7958805b4530", s.User.ID, "buy milk", false)
+	_ = s.index("fb2211c9-5d53-4a44-895b-79c42174d521", "2192fc7b-bd9b-446d-a50e-5ce0ba02cee6", "buy milk", false)
+	_ = s.index("0b8c5f3e-7d41-4c2a-9e6f-58a1d2c4b7e9", s.User.ID, "buy more milk", true)
+
+	// assert
+	res, err := s.SearchIndex.Search(ctx, s.User, dto.NewFactory().NewTodoSearch([]string{"milk"}, 20))
+	assert.NoError(s.T(), err)
+	assert.Len(s.T(), res, 1)
+	assert.Equal(s.T(), mine, res[0].Todo)
+}
+
+func (s *MemoryTodoSearchIndexTestSuite) TestIndexReplaces() {
+	ctx := context.Background()
+
+	t := s.index("4daaaea8-4721-4644-aaac-7958805b4530", s.User.ID, "buy milk", false)
+	t.Content = "call grandma"
+	assert.NoError(s.T(), s.SearchIndex.Index(ctx, t))
+
+	// assert, the old content is forgotten
+	res, err := s.SearchIndex.Search(ctx, s.User, dto.NewFactory().NewTodoSearch([]string{"milk"}, 20))
+	assert.NoError(s.T(), err)
+	assert.Empty(s.T(), res)
+
+	res, err = s.SearchIndex.Search(ctx, s.User, dto.NewFactory().NewTodoSearch([]string{"grandma"}, 20))
+	assert.NoError(s.T(), err)
+	assert.Len(s.T(), res, 1)
+	assert.Equal(s.T(), "call grandma", res[0].Todo.Content)
+}
+
+func (s *MemoryTodoSearchIndexTestSuite) TestRemoveUser() {
+	ctx := context.Background()
+
+	other := dto.NewFactory().NewUser("2192fc7b-bd9b-446d-a50e-5ce0ba02cee6", "other@miku.com", "PASSWORD", nil, nil, nil, time.Now())
+	_ = s.index("4daaaea8-4721-4644-aaac-7958805b4530", s.User.ID, "buy milk", false)
+	theirs := s.index("fb2211c9-5d53-4a44-895b-79c42174d521", other.ID, "buy milk", false)
+
+	// assert, only the todos of the user are removed
+	assert.NoError(s.T(), s.SearchIndex.RemoveUser(ctx, s.User))
+
+	res, err := s.SearchIndex.Search(ctx, s.User, dto.NewFactory().NewTodoSearch([]string{"milk"}, 20))
+	assert.NoError(s.T(), err)
+	assert.Empty(s.T(), res)
+
+	res, err = s.SearchIndex.Search(ctx, other, dto.NewFactory().NewTodoSearch([]string{"milk"}, 20))
+	assert.NoError(s.T(), err)
+	assert.Len(s.T(), res, 1)
+	assert.Equal(s.T(), theirs.ID, res[0].Todo.ID)
+}
+
+func TestMemoryTodoSearchIndex(t *testing.T) {
+	suite.Run(t, new(MemoryTodoSearchIndexTestSuite))
+}
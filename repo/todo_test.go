@@ -33,6 +33,7 @@ func (s *TodoRepoTestSuite) SetupTest() {
 
 	r, err := NewTodoRepository(
 		WithTodoTable("todos"),
+		WithTodoTagTable("todo_tags"),
 		WithTodoDB(s.DB),
 	)
 	if err != nil {
@@ -51,12 +52,12 @@ func (s *TodoRepoTestSuite) TestStoreSuccess() {
 
 	userID := "2192fc7b-bd9b-446d-a50e-5ce0ba02cee6"
 	id := "4daaaea8-4721-4644-aaac-7958805b4530"
-	t := dto.NewFactory().NewTodo(id, userID, "things todo", false, time.Now(), time.Now(), false)
+	t := dto.NewFactory().NewTodo(id, userID, "things todo", false, time.Now(), time.Now(), false, nil, 0, 0)
 
-	q := "INSERT INTO todos (id,user_id,content,completed,created_at,updated_at,deleted) VALUES (?,?,?,?,?,?,?)"
+	q := "INSERT INTO todos (id,user_id,content,completed,created_at,updated_at,deleted,due_at,priority,position) VALUES (?,?,?,?,?,?,?,?,?,?)"
 	s.Sqlmock.ExpectBegin()
 	s.Sqlmock.ExpectExec(q).
-		WithArgs(t.ID, t.UserID, t.Content, t.Completed, t.CreatedAt, t.UpdatedAt, t.Deleted).
+		WithArgs(t.ID, t.UserID, t.Content, t.Completed, t.CreatedAt, t.UpdatedAt, t.Deleted, nil, t.Priority, t.Position).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 	s.Sqlmock.ExpectCommit()
 
@@ -71,12 +72,12 @@ func (s *TodoRepoTestSuite) TestUpdateSuccess() {
 
 	userID := "2192fc7b-bd9b-446d-a50e-5ce0ba02cee6"
 	id := "4daaaea8-4721-4644-aaac-7958805b4530"
-	t := dto.NewFactory().NewTodo(id, userID, "things todo", false, time.Now(), time.Now(), false)
+	t := dto.NewFactory().NewTodo(id, userID, "things todo", false, time.Now(), time.Now(), false, nil, 0, 0)
 
-	q := "UPDATE todos SET content = ?, completed = ?, deleted = ? WHERE id = ?"
+	q := "UPDATE todos SET content = ?, completed = ?, deleted = ?, due_at = ?, priority = ?, position = ? WHERE id = ?"
 	s.Sqlmock.ExpectBegin()
 	s.Sqlmock.ExpectExec(q).
-		WithArgs(t.Content, t.Completed, t.Deleted, t.ID).
+		WithArgs(t.Content, t.Completed, t.Deleted, nil, t.Priority, t.Position, t.ID).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 	s.Sqlmock.ExpectCommit()
 
@@ -91,7 +92,7 @@ func (s *TodoRepoTestSuite) TestDeleteSuccess() {
 
 	userID := "2192fc7b-bd9b-446d-a50e-5ce0ba02cee6"
 	id := "4daaaea8-4721-4644-aaac-7958805b4530"
-	t := dto.NewFactory().NewTodo(id, userID, "things todo", false, time.Now(), time.Now(), false)
+	t := dto.NewFactory().NewTodo(id, userID, "things todo", false, time.Now(), time.Now(), false, nil, 0, 0)
 
 	q := "DELETE FROM todos WHERE id = ?"
 	s.Sqlmock.ExpectBegin()
@@ -111,15 +112,15 @@ func (s *TodoRepoTestSuite) TestFetchByIDExist() {
 
 	userID := "2192fc7b-bd9b-446d-a50e-5ce0ba02cee6"
 	id := "4daaaea8-4721-4644-aaac-7958805b4530"
-	t := dto.NewFactory().NewTodo(id, userID, "things todo", false, time.Now(), time.Now(), false)
+	t := dto.NewFactory().NewTodo(id, userID, "things todo", false, time.Now(), time.Now(), false, nil, 0, 0)
 
-	q := "SELECT id, user_id, content, completed, created_at, updated_at, deleted FROM todos WHERE id = ?"
+	q := "SELECT id, user_id, content, completed, created_at, updated_at, deleted, due_at, priority, position FROM todos WHERE id = ?"
 	s.Sqlmock.ExpectQuery(q).
 		WithArgs(t.ID).
 		WillReturnRows(
 			sqlmock.
-				NewRows([]string{"id", "user_id", "content", "completed", "created_at", "updated_at", "deleted"}).
-				AddRow(t.ID, t.UserID, t.Content, t.Completed, t.CreatedAt, t.UpdatedAt, t.Deleted),
+				NewRows(todoCols).
+				AddRow(t.ID, t.UserID, t.Content, t.Completed, t.CreatedAt, t.UpdatedAt, t.Deleted, nil, t.Priority, t.Position),
 		)
 
 	// assert
@@ -138,7 +139,7 @@ func (s *TodoRepoTestSuite) TestFetchByIDNotExist() {
 
 	id := "4daaaea8-4721-4644-aaac-7958805b4530"
 
-	q := "SELECT id, user_id, content, completed, created_at, updated_at, deleted FROM todos WHERE id = ?"
+	q := "SELECT id, user_id, content, completed, created_at, updated_at, deleted, due_at, priority, position FROM todos WHERE id = ?"
 	s.Sqlmock.ExpectQuery(q).
 		WithArgs(id).
 		WillReturnError(sql.ErrNoRows)
@@ -153,20 +154,216 @@ func (s *TodoRepoTestSuite) TestFetchByIDNotExist() {
 func (s *TodoRepoTestSuite) TestFetchAllByUserNotExist() {
 	ctx := context.Background()
 
-	u := dto.NewFactory().NewUser("5c2dd83a-6250-40f3-a47e-21d957c07d06", "hatsune@miku.com", "PASSWORD", time.Now())
-	q := "SELECT id, user_id, content, completed, created_at, updated_at, deleted FROM todos WHERE completed = ? AND deleted = ? AND user_id = ?"
+	u := dto.NewFactory().NewUser("5c2dd83a-6250-40f3-a47e-21d957c07d06", "hatsune@miku.com", "PASSWORD", nil, nil, nil, time.Now())
+	completed, deleted := false, false
+	f := dto.NewFactory().NewTodoFilter(&completed, &deleted, nil, nil, nil, nil, "", nil, false)
+	q := "SELECT id, user_id, content, completed, created_at, updated_at, deleted, due_at, priority, position FROM todos WHERE (user_id = ? AND completed = ? AND deleted = ?)"
 	s.Sqlmock.ExpectQuery(q).
-		WithArgs(false, false, u.ID).
+		WithArgs(u.ID, false, false).
 		WillReturnError(sql.ErrNoRows)
 
 	// assert
-	res, err := s.TodoRepository.FetchAllByUser(ctx, u, false, false)
+	res, err := s.TodoRepository.FetchAllByUser(ctx, u, f)
 	assert.NotNil(s.T(), res)
 	assert.Empty(s.T(), res)
 	assert.NoError(s.T(), err)
 	assert.NoError(s.T(), s.Sqlmock.ExpectationsWereMet())
 }
 
+func (s *TodoRepoTestSuite) TestFetchAllByUserWithFilter() {
+	ctx := context.Background()
+
+	u := dto.NewFactory().NewUser("5c2dd83a-6250-40f3-a47e-21d957c07d06", "hatsune@miku.com", "PASSWORD", nil, nil, nil, time.Now())
+	createdAfter := time.Date(2021, 5, 1, 0, 0, 0, 0, time.UTC)
+	createdBefore := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	updatedAfter := time.Date(2021, 5, 15, 0, 0, 0, 0, time.UTC)
+	f := dto.NewFactory().NewTodoFilter(nil, nil, &createdAfter, &createdBefore, &updatedAfter, nil, "50%_off", nil, false)
+
+	id := "4daaaea8-4721-4644-aaac-7958805b4530"
+	t := dto.NewFactory().NewTodo(id, u.ID, "buy at 50%_off", false, createdAfter, updatedAfter, false, nil, 0, 0)
+	rows := sqlmock.NewRows(todoCols).
+		AddRow(t.ID, t.UserID, t.Content, t.Completed, t.CreatedAt, t.UpdatedAt, t.Deleted, nil, t.Priority, t.Position)
+
+	// wildcards typed by the user are matched literally
+	q := "SELECT id, user_id, content, completed, created_at, updated_at, deleted, due_at, priority, position FROM todos WHERE (user_id = ? AND created_at >= ? AND created_at < ? AND updated_at >= ? AND content LIKE ?)"
+	s.Sqlmock.ExpectQuery(q).
+		WithArgs(u.ID, createdAfter, createdBefore, updatedAfter, `%50\%\_off%`).
+		WillReturnRows(rows)
+
+	// assert
+	res, err := s.TodoRepository.FetchAllByUser(ctx, u, f)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), []*dto.Todo{t}, res)
+	assert.NoError(s.T(), s.Sqlmock.ExpectationsWereMet())
+}
+
+func (s *TodoRepoTestSuite) TestFetchAllByUserWithAnyTag() {
+	ctx := context.Background()
+
+	u := dto.NewFactory().NewUser("5c2dd83a-6250-40f3-a47e-21d957c07d06", "hatsune@miku.com", "PASSWORD", nil, nil, nil, time.Now())
+	tagIDs := []string{"7d3c1a52-96b4-4f0e-8d2b-3a1f6e9c0b47", "e5b9f2d4-1c8a-4b6e-9f3d-7a2c5e8b1d60"}
+	f := dto.NewFactory().NewTodoFilter(nil, nil, nil, nil, nil, nil, "", tagIDs, false)
+
+	q := "SELECT id, user_id, content, completed, created_at, updated_at, deleted, due_at, priority, position FROM todos WHERE (user_id = ? AND id IN (SELECT todo_id FROM todo_tags WHERE tag_id IN (?,?)))"
+	s.Sqlmock.ExpectQuery(q).
+		WithArgs(u.ID, tagIDs[0], tagIDs[1]).
+		WillReturnError(sql.ErrNoRows)
+
+	// assert
+	res, err := s.TodoRepository.FetchAllByUser(ctx, u, f)
+	assert.NoError(s.T(), err)
+	assert.Empty(s.T(), res)
+	assert.NoError(s.T(), s.Sqlmock.ExpectationsWereMet())
+}
+
+func (s *TodoRepoTestSuite) TestFetchAllByUserWithAllTags() {
+	ctx := context.Background()
+
+	u := dto.NewFactory().NewUser("5c2dd83a-6250-40f3-a47e-21d957c07d06", "hatsune@miku.com", "PASSWORD", nil, nil, nil, time.Now())
+	tagIDs := []string{"7d3c1a52-96b4-4f0e-8d2b-3a1f6e9c0b47", "e5b9f2d4-1c8a-4b6e-9f3d-7a2c5e8b1d60"}
+	f := dto.NewFactory().NewTodoFilter(nil, nil, nil, nil, nil, nil, "", tagIDs, true)
+
+	// a todo has each tag once, so it has all of them when it has as many
+	q := "SELECT id, user_id, content, completed, created_at, updated_at, deleted, due_at, priority, position FROM todos WHERE (user_id = ? AND id IN (SELECT todo_id FROM todo_tags WHERE tag_id IN (?,?) GROUP BY todo_id HAVING COUNT(*) = ?))"
+	s.Sqlmock.ExpectQuery(q).
+		WithArgs(u.ID, tagIDs[0], tagIDs[1], 2).
+		WillReturnError(sql.ErrNoRows)
+
+	// assert
+	res, err := s.TodoRepository.FetchAllByUser(ctx, u, f)
+	assert.NoError(s.T(), err)
+	assert.Empty(s.T(), res)
+	assert.NoError(s.T(), s.Sqlmock.ExpectationsWereMet())
+}
+
+func (s *TodoRepoTestSuite) TestFetchPageByUserAfterCursor() {
+	ctx := context.Background()
+
+	u := dto.NewFactory().NewUser("5c2dd83a-6250-40f3-a47e-21d957c07d06", "hatsune@miku.com", "PASSWORD", nil, nil, nil, time.Now())
+	completed, deleted := false, false
+	f := dto.NewFactory().NewTodoFilter(&completed, &deleted, nil, nil, nil, nil, "", nil, false)
+	sort := dto.NewFactory().NewTodoSort("created_at", false)
+	createdAt := time.Date(2021, 5, 1, 0, 0, 0, 0, time.UTC)
+	after := dto.NewFactory().NewTodoCursor(createdAt, "4daaaea8-4721-4644-aaac-7958805b4530")
+
+	id := "fb2211c9-5d53-4a44-895b-79c42174d521"
+	t := dto.NewFactory().NewTodo(id, u.ID, "things todo", false, createdAt, createdAt, false, nil, 0, 0)
+	rows := sqlmock.NewRows(todoCols).
+		AddRow(t.ID, t.UserID, t.Content, t.Completed, t.CreatedAt, t.UpdatedAt, t.Deleted, nil, t.Priority, t.Position)
+
+	// todos created in the same second are ordered by id
+	q := "SELECT id, user_id, content, completed, created_at, updated_at, deleted, due_at, priority, position FROM todos WHERE (user_id = ? AND completed = ? AND deleted = ? AND (created_at > ? OR (created_at = ? AND id > ?))) ORDER BY created_at ASC, id ASC LIMIT 3"
+	s.Sqlmock.ExpectQuery(q).
+		WithArgs(u.ID, false, false, after.Value, after.Value, after.ID).
+		WillReturnRows(rows)
+
+	// assert
+	res, err := s.TodoRepository.FetchPageByUser(ctx, u, f, sort, after, 3)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), []*dto.Todo{t}, res)
+	assert.NoError(s.T(), s.Sqlmock.ExpectationsWereMet())
+}
+
+func (s *TodoRepoTestSuite) TestFetchPageByUserDescending() {
+	ctx := context.Background()
+
+	u := dto.NewFactory().NewUser("5c2dd83a-6250-40f3-a47e-21d957c07d06", "hatsune@miku.com", "PASSWORD", nil, nil, nil, time.Now())
+	f := dto.NewFactory().NewTodoFilter(nil, nil, nil, nil, nil, nil, "", nil, false)
+	sort := dto.NewFactory().NewTodoSort("updated_at", true)
+	after := dto.NewFactory().NewTodoCursor(time.Date(2021, 5, 1, 0, 0, 0, 0, time.UTC), "4daaaea8-4721-4644-aaac-7958805b4530")
+
+	q := "SELECT id, user_id, content, completed, created_at, updated_at, deleted, due_at, priority, position FROM todos WHERE (user_id = ? AND (updated_at < ? OR (updated_at = ? AND id < ?))) ORDER BY updated_at DESC, id DESC LIMIT 51"
+	s.Sqlmock.ExpectQuery(q).
+		WithArgs(u.ID, after.Value, after.Value, after.ID).
+		WillReturnError(sql.ErrNoRows)
+
+	// assert
+	res, err := s.TodoRepository.FetchPageByUser(ctx, u, f, sort, after, 51)
+	assert.NoError(s.T(), err)
+	assert.Empty(s.T(), res)
+	assert.NoError(s.T(), s.Sqlmock.ExpectationsWereMet())
+}
+
+func (s *TodoRepoTestSuite) TestFetchPageByUserByDueDate() {
+	ctx := context.Background()
+
+	u := dto.NewFactory().NewUser("5c2dd83a-6250-40f3-a47e-21d957c07d06", "hatsune@miku.com", "PASSWORD", nil, nil, nil, time.Now())
+	f := dto.NewFactory().NewTodoFilter(nil, nil, nil, nil, nil, nil, "", nil, false)
+	sort := dto.NewFactory().NewTodoSort("due_at", false)
+	// the previous page ended among the todos without a due date
+	after := dto.NewFactory().NewTodoCursor(nil, "4daaaea8-4721-4644-aaac-7958805b4530")
+
+	dueAt := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	t := dto.NewFactory().NewTodo("fb2211c9-5d53-4a44-895b-79c42174d521", u.ID, "things todo", false, time.Now(), time.Now(), false, &dueAt, 2, 0)
+	rows := sqlmock.NewRows(todoCols).
+		AddRow(t.ID, t.UserID, t.Content, t.Completed, t.CreatedAt, t.UpdatedAt, t.Deleted, dueAt, t.Priority, t.Position)
+
+	// NULLs come first in ascending order, then every todo with a due date
+	q := "SELECT id, user_id, content, completed, created_at, updated_at, deleted, due_at, priority, position FROM todos WHERE (user_id = ? AND ((due_at IS NULL AND id > ?) OR due_at IS NOT NULL)) ORDER BY due_at ASC, id ASC LIMIT 3"
+	s.Sqlmock.ExpectQuery(q).
+		WithArgs(u.ID, after.ID).
+		WillReturnRows(rows)
+
+	// assert
+	res, err := s.TodoRepository.FetchPageByUser(ctx, u, f, sort, after, 3)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), []*dto.Todo{t}, res)
+	assert.NoError(s.T(), s.Sqlmock.ExpectationsWereMet())
+}
+
+func (s *TodoRepoTestSuite) TestFetchPageByUserByDueDateDescending() {
+	ctx := context.Background()
+
+	u := dto.NewFactory().NewUser("5c2dd83a-6250-40f3-a47e-21d957c07d06", "hatsune@miku.com", "PASSWORD", nil, nil, nil, time.Now())
+	f := dto.NewFactory().NewTodoFilter(nil, nil, nil, nil, nil, nil, "", nil, false)
+	sort := dto.NewFactory().NewTodoSort("due_at", true)
+	after := dto.NewFactory().NewTodoCursor(time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC), "4daaaea8-4721-4644-aaac-7958805b4530")
+
+	// NULLs come last in descending order
+	q := "SELECT id, user_id, content, completed, created_at, updated_at, deleted, due_at, priority, position FROM todos WHERE (user_id = ? AND (due_at < ? OR (due_at = ? AND id < ?) OR due_at IS NULL)) ORDER BY due_at DESC, id DESC LIMIT 3"
+	s.Sqlmock.ExpectQuery(q).
+		WithArgs(u.ID, after.Value, after.Value, after.ID).
+		WillReturnError(sql.ErrNoRows)
+
+	// assert
+	res, err := s.TodoRepository.FetchPageByUser(ctx, u, f, sort, after, 3)
+	assert.NoError(s.T(), err)
+	assert.Empty(s.T(), res)
+	assert.NoError(s.T(), s.Sqlmock.ExpectationsWereMet())
+}
+
+func (s *TodoRepoTestSuite) TestFetchPageByUserByPriority() {
+	ctx := context.Background()
+
+	u := dto.NewFactory().NewUser("5c2dd83a-6250-40f3-a47e-21d957c07d06", "hatsune@miku.com", "PASSWORD", nil, nil, nil, time.Now())
+	f := dto.NewFactory().NewTodoFilter(nil, nil, nil, nil, nil, nil, "", nil, false)
+	sort := dto.NewFactory().NewTodoSort("priority", true)
+	after := dto.NewFactory().NewTodoCursor(2, "4daaaea8-4721-4644-aaac-7958805b4530")
+
+	q := "SELECT id, user_id, content, completed, created_at, updated_at, deleted, due_at, priority, position FROM todos WHERE (user_id = ? AND (priority < ? OR (priority = ? AND id < ?))) ORDER BY priority DESC, id DESC LIMIT 3"
+	s.Sqlmock.ExpectQuery(q).
+		WithArgs(u.ID, 2, 2, after.ID).
+		WillReturnError(sql.ErrNoRows)
+
+	// assert
+	res, err := s.TodoRepository.FetchPageByUser(ctx, u, f, sort, after, 3)
+	assert.NoError(s.T(), err)
+	assert.Empty(s.T(), res)
+	assert.NoError(s.T(), s.Sqlmock.ExpectationsWereMet())
+}
+
+func (s *TodoRepoTestSuite) TestFetchPageByUserFailWithUnknownColumn() {
+	ctx := context.Background()
+
+	u := dto.NewFactory().NewUser("5c2dd83a-6250-40f3-a47e-21d957c07d06", "hatsune@miku.com", "PASSWORD", nil, nil, nil, time.Now())
+	f := dto.NewFactory().NewTodoFilter(nil, nil, nil, nil, nil, nil, "", nil, false)
+
+	// assert, no query is sent
+	_, err := s.TodoRepository.FetchPageByUser(ctx, u, f, dto.NewFactory().NewTodoSort("content; DROP TABLE todos", false), nil, 3)
+	assert.ErrorIs(s.T(), err, todo.ErrInvalidRequest)
+	assert.NoError(s.T(), s.Sqlmock.ExpectationsWereMet())
+}
+
 func TestTodoRepo(t *testing.T) {
 	suite.Run(t, new(TodoRepoTestSuite))
 }
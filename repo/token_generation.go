@@ -0,0 +1,83 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/org39/webapp-tutorial-backend/pkg/db"
+	"github.com/org39/webapp-tutorial-backend/usecase/auth"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+var (
+	tokenGenerationCols = []string{"user_id", "generation"}
+)
+
+type TokenGenerationRepository struct {
+	DB    *db.DB `inject:""`
+	Table string `inject:"repo.token_generation.table"`
+}
+
+func NewTokenGenerationRepository(options ...func(*TokenGenerationRepository) error) (auth.TokenGenerationRepository, error) {
+	r := &TokenGenerationRepository{}
+
+	for _, option := range options {
+		if err := option(r); err != nil {
+			return nil, err
+		}
+	}
+
+	return r, nil
+}
+
+func WithTokenGenerationDB(db *db.DB) func(*TokenGenerationRepository) error {
+	return func(r *TokenGenerationRepository) error {
+		r.DB = db
+		return nil
+	}
+}
+
+func WithTokenGenerationTable(table string) func(*TokenGenerationRepository) error {
+	return func(r *TokenGenerationRepository) error {
+		r.Table = table
+		return nil
+	}
+}
+
+func (r *TokenGenerationRepository) FetchByUserID(ctx context.Context, userID string) (int64, error) {
+	query, args, err := sq.Select("generation").From(r.Table).Where(sq.Eq{"user_id": userID}).ToSql()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", err.Error(), auth.ErrDatabaseError)
+	}
+
+	var generation int64
+	err = r.DB.QueryRow(ctx, query, args...).Scan(&generation)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return 0, auth.ErrNotFound
+	case err != nil:
+		return 0, fmt.Errorf("%s: %w", err.Error(), auth.ErrDatabaseError)
+	}
+
+	return generation, nil
+}
+
+func (r *TokenGenerationRepository) Increment(ctx context.Context, userID string) error {
+	query, args, err := sq.Insert(r.Table).
+		Columns(tokenGenerationCols...).
+		Values(userID, 1).
+		Suffix("ON DUPLICATE KEY UPDATE generation = generation + 1").
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("%s: %w", err.Error(), auth.ErrDatabaseError)
+	}
+
+	_, err = r.DB.Exec(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("%s: %w", err.Error(), auth.ErrDatabaseError)
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+
+	"github.com/org39/webapp-tutorial-backend/pkg/db"
+	"github.com/org39/webapp-tutorial-backend/usecase/auth"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type TokenGenerationRepoTestSuite struct {
+	suite.Suite
+	TokenGenerationRepository auth.TokenGenerationRepository
+	DB                        *db.DB
+	Sqlmock                   sqlmock.Sqlmock
+}
+
+func (s *TokenGenerationRepoTestSuite) SetupTest() {
+	mockdb, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		assert.Fail(s.T(), fmt.Sprintf("fail to sqlmock: %s", err))
+	}
+	s.DB = &db.DB{DB: mockdb}
+	s.Sqlmock = mock
+
+	r, err := NewTokenGenerationRepository(
+		WithTokenGenerationTable("token_generations"),
+		WithTokenGenerationDB(s.DB),
+	)
+	if err != nil {
+		assert.Fail(s.T(), fmt.Sprintf("fail to create repository: %s", err))
+	}
+
+	s.TokenGenerationRepository = r
+}
+
+func (s *TokenGenerationRepoTestSuite) TearDownTest() {
+	s.DB.Close()
+}
+
+func (s *TokenGenerationRepoTestSuite) TestFetchByUserIDExist() {
+	ctx := context.Background()
+	userID := "2192fc7b-bd9b-446d-a50e-5ce0ba02cee6"
+
+	q := "SELECT generation FROM token_generations WHERE user_id = ?"
+	s.Sqlmock.ExpectQuery(q).
+		WithArgs(userID).
+		WillReturnRows(sqlmock.NewRows([]string{"generation"}).AddRow(3))
+
+	// assert
+	generation, err := s.TokenGenerationRepository.FetchByUserID(ctx, userID)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), int64(3), generation)
+	assert.NoError(s.T(), s.Sqlmock.ExpectationsWereMet())
+}
+
+func (s *TokenGenerationRepoTestSuite) TestFetchByUserIDNotExist() {
+	ctx := context.Background()
+	userID := "2192fc7b-bd9b-446d-a50e-5ce0ba02cee6"
+
+	q := "SELECT generation FROM token_generations WHERE user_id = ?"
+	s.Sqlmock.ExpectQuery(q).
+		WithArgs(userID).
+		WillReturnError(sql.ErrNoRows)
+
+	// assert
+	_, err := s.TokenGenerationRepository.FetchByUserID(ctx, userID)
+	assert.ErrorIs(s.T(), err, auth.ErrNotFound)
+	assert.NoError(s.T(), s.Sqlmock.ExpectationsWereMet())
+}
+
+func (s *TokenGenerationRepoTestSuite) TestIncrementSuccess() {
+	ctx := context.Background()
+	userID := "2192fc7b-bd9b-446d-a50e-5ce0ba02cee6"
+
+	q := "INSERT INTO token_generations (user_id,generation) VALUES (?,?) ON DUPLICATE KEY UPDATE generation = generation + 1"
+	s.Sqlmock.ExpectBegin()
+	s.Sqlmock.ExpectExec(q).
+		WithArgs(userID, 1).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	s.Sqlmock.ExpectCommit()
+
+	// assert
+	err := s.TokenGenerationRepository.Increment(ctx, userID)
+	assert.NoError(s.T(), err)
+	assert.NoError(s.T(), s.Sqlmock.ExpectationsWereMet())
+}
+
+func TestTokenGenerationRepo(t *testing.T) {
+	suite.Run(t, new(TokenGenerationRepoTestSuite))
+}
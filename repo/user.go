@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/org39/webapp-tutorial-backend/entity/dto"
@@ -14,13 +15,22 @@ import (
 	sq "github.com/Masterminds/squirrel"
 )
 
+const (
+	roleSeparator = " "
+)
+
 var (
-	userCols = []string{"id", "email", "password", "created_at"}
+	userCols = []string{"id", "email", "password", "roles", "verified_at", "disabled_at", "created_at"}
+
+	// LIKE wildcards are escaped, searches match the text as typed
+	likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
 )
 
 type UserRepository struct {
 	DB    *db.DB `inject:""`
 	Table string `inject:"repo.user.table"`
+	// tables with a user_id column, their rows are deleted with the user
+	OwnedTables []string `inject:"repo.user.owned_tables"`
 }
 
 func NewUserRepository(options ...func(*UserRepository) error) (user.Repository, error) {
@@ -49,6 +59,13 @@ func WithUserTable(table string) func(*UserRepository) error {
 	}
 }
 
+func WithUserOwnedTables(tables ...string) func(*UserRepository) error {
+	return func(r *UserRepository) error {
+		r.OwnedTables = tables
+		return nil
+	}
+}
+
 func (r *UserRepository) FetchByID(ctx context.Context, id string) (*dto.User, error) {
 	query, args, err := r.selectUser().Where(sq.Eq{"id": id}).ToSql()
 	if err != nil {
@@ -82,7 +99,7 @@ func (r *UserRepository) FetchByEmail(ctx context.Context, email string) (*dto.U
 func (r *UserRepository) Store(ctx context.Context, u *dto.User) error {
 	query, args, err := sq.Insert(r.Table).
 		Columns(userCols...).
-		Values(u.ID, u.Email, u.Password, u.CreatedAt).
+		Values(u.ID, u.Email, u.Password, strings.Join(u.Roles, roleSeparator), u.VerifiedAt, u.DisabledAt, u.CreatedAt).
 		ToSql()
 	if err != nil {
 		return fmt.Errorf("%s: %w", err.Error(), user.ErrDatabaseError)
@@ -99,6 +116,9 @@ func (r *UserRepository) Update(ctx context.Context, u *dto.User) error {
 	query, args, err := sq.Update(r.Table).
 		Set("email", u.Email).
 		Set("password", u.Password).
+		Set("roles", strings.Join(u.Roles, roleSeparator)).
+		Set("verified_at", u.VerifiedAt).
+		Set("disabled_at", u.DisabledAt).
 		Where(sq.Eq{"id": u.ID}).
 		ToSql()
 	if err != nil {
@@ -112,15 +132,81 @@ func (r *UserRepository) Update(ctx context.Context, u *dto.User) error {
 	return nil
 }
 
+// Delete removes the user and every row the user owns, all or nothing.
+func (r *UserRepository) Delete(ctx context.Context, id string) error {
+	queries := make([]sq.DeleteBuilder, 0, len(r.OwnedTables)+1)
+	for _, table := range r.OwnedTables {
+		queries = append(queries, sq.Delete(table).Where(sq.Eq{"user_id": id}))
+	}
+	queries = append(queries, sq.Delete(r.Table).Where(sq.Eq{"id": id}))
+
+	err := r.DB.WithTransaction(ctx, func(ctx context.Context, tx *sql.Tx) error {
+		for _, q := range queries {
+			query, args, err := q.ToSql()
+			if err != nil {
+				return err
+			}
+
+			if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", err.Error(), user.ErrDatabaseError)
+	}
+	return nil
+}
+
+// Search returns the users whose email contains the query, the oldest first.
+// An empty query matches every user.
+func (r *UserRepository) Search(ctx context.Context, email string, limit uint64, offset uint64) ([]*dto.User, error) {
+	builder := r.selectUser()
+	if email != "" {
+		builder = builder.Where(sq.Like{"email": "%" + likeEscaper.Replace(email) + "%"})
+	}
+
+	query, args, err := builder.
+		OrderBy("created_at", "id").
+		Limit(limit).
+		Offset(offset).
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", err.Error(), user.ErrDatabaseError)
+	}
+
+	rows, err := r.DB.Query(ctx, query, args...)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return []*dto.User{}, nil
+	case err != nil:
+		return nil, fmt.Errorf("%s: %w", err.Error(), user.ErrDatabaseError)
+	}
+	defer rows.Close()
+
+	users := []*dto.User{}
+	for rows.Next() {
+		u, err := r.scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+
+	return users, nil
+}
+
 func (r *UserRepository) selectUser() sq.SelectBuilder {
 	return sq.Select(userCols...).From(r.Table)
 }
 
 func (r *UserRepository) scanUser(row db.Scanable) (*dto.User, error) {
-	var id, email, password string
+	var id, email, password, roles string
+	var verifiedAt, disabledAt sql.NullTime
 	var CreatedAt time.Time
 
-	err := row.Scan(&id, &email, &password, &CreatedAt)
+	err := row.Scan(&id, &email, &password, &roles, &verifiedAt, &disabledAt, &CreatedAt)
 	switch {
 	case errors.Is(err, sql.ErrNoRows):
 		return nil, user.ErrNotFound
@@ -128,5 +214,15 @@ func (r *UserRepository) scanUser(row db.Scanable) (*dto.User, error) {
 		return nil, fmt.Errorf("%s: %w", err.Error(), user.ErrDatabaseError)
 	}
 
-	return dto.NewFactory().NewUser(id, email, password, CreatedAt), nil
+	var verified *time.Time
+	if verifiedAt.Valid {
+		verified = &verifiedAt.Time
+	}
+
+	var disabled *time.Time
+	if disabledAt.Valid {
+		disabled = &disabledAt.Time
+	}
+
+	return dto.NewFactory().NewUser(id, email, password, strings.Fields(roles), verified, disabled, CreatedAt), nil
 }
@@ -0,0 +1,159 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/org39/webapp-tutorial-backend/entity/dto"
+	"github.com/org39/webapp-tutorial-backend/pkg/db"
+	"github.com/org39/webapp-tutorial-backend/usecase/user"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+var (
+	userMFACols = []string{"user_id", "secret", "enabled", "last_used_step", "created_at"}
+)
+
+type UserMFARepository struct {
+	DB    *db.DB `inject:""`
+	Table string `inject:"repo.user_mfa.table"`
+}
+
+func NewUserMFARepository(options ...func(*UserMFARepository) error) (user.MFARepository, error) {
+	r := &UserMFARepository{}
+
+	for _, option := range options {
+		if err := option(r); err != nil {
+			return nil, err
+		}
+	}
+
+	return r, nil
+}
+
+func WithUserMFADB(db *db.DB) func(*UserMFARepository) error {
+	return func(r *UserMFARepository) error {
+		r.DB = db
+		return nil
+	}
+}
+
+func WithUserMFATable(table string) func(*UserMFARepository) error {
+	return func(r *UserMFARepository) error {
+		r.Table = table
+		return nil
+	}
+}
+
+func (r *UserMFARepository) FetchByUserID(ctx context.Context, userID string) (*dto.UserMFA, error) {
+	query, args, err := sq.Select(userMFACols...).From(r.Table).Where(sq.Eq{"user_id": userID}).ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", err.Error(), user.ErrDatabaseError)
+	}
+
+	row := r.DB.QueryRow(ctx, query, args...)
+	m, err := r.scanUserMFA(row)
+	if err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// Store saves a new enrollment, replacing an unconfirmed one of the user.
+func (r *UserMFARepository) Store(ctx context.Context, m *dto.UserMFA) error {
+	query, args, err := sq.Insert(r.Table).
+		Columns(userMFACols...).
+		Values(m.UserID, m.Secret, m.Enabled, m.LastUsedStep, m.CreatedAt).
+		Suffix("ON DUPLICATE KEY UPDATE secret = VALUES(secret), enabled = VALUES(enabled), last_used_step = VALUES(last_used_step), created_at = VALUES(created_at)").
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("%s: %w", err.Error(), user.ErrDatabaseError)
+	}
+
+	_, err = r.DB.Exec(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("%s: %w", err.Error(), user.ErrDatabaseError)
+	}
+	return nil
+}
+
+// Enable turns on the second factor, recording the step of the confirmation code.
+// It returns user.ErrNotFound when there is no pending enrollment.
+func (r *UserMFARepository) Enable(ctx context.Context, userID string, step int64) error {
+	query, args, err := sq.Update(r.Table).
+		Set("enabled", true).
+		Set("last_used_step", step).
+		Where(sq.Eq{"user_id": userID, "enabled": false}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("%s: %w", err.Error(), user.ErrDatabaseError)
+	}
+
+	return r.execAffectingOne(ctx, query, args...)
+}
+
+// UseStep records the step of a code, only if it is newer than the last one used.
+// It returns user.ErrNotFound when the code was already used.
+func (r *UserMFARepository) UseStep(ctx context.Context, userID string, step int64) error {
+	query, args, err := sq.Update(r.Table).
+		Set("last_used_step", step).
+		Where(sq.Eq{"user_id": userID}).
+		Where(sq.Lt{"last_used_step": step}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("%s: %w", err.Error(), user.ErrDatabaseError)
+	}
+
+	return r.execAffectingOne(ctx, query, args...)
+}
+
+func (r *UserMFARepository) Delete(ctx context.Context, userID string) error {
+	query, args, err := sq.Delete(r.Table).Where(sq.Eq{"user_id": userID}).ToSql()
+	if err != nil {
+		return fmt.Errorf("%s: %w", err.Error(), user.ErrDatabaseError)
+	}
+
+	_, err = r.DB.Exec(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("%s: %w", err.Error(), user.ErrDatabaseError)
+	}
+	return nil
+}
+
+func (r *UserMFARepository) execAffectingOne(ctx context.Context, query string, args ...interface{}) error {
+	res, err := r.DB.Exec(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("%s: %w", err.Error(), user.ErrDatabaseError)
+	}
+
+	affected, err := res.RowsAffected()
+	switch {
+	case err != nil:
+		return fmt.Errorf("%s: %w", err.Error(), user.ErrDatabaseError)
+	case affected == 0:
+		return user.ErrNotFound
+	}
+	return nil
+}
+
+func (r *UserMFARepository) scanUserMFA(row db.Scanable) (*dto.UserMFA, error) {
+	var userID, secret string
+	var enabled bool
+	var lastUsedStep int64
+	var createdAt time.Time
+
+	err := row.Scan(&userID, &secret, &enabled, &lastUsedStep, &createdAt)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil, user.ErrNotFound
+	case err != nil:
+		return nil, fmt.Errorf("%s: %w", err.Error(), user.ErrDatabaseError)
+	}
+
+	return dto.NewFactory().NewUserMFA(userID, secret, enabled, lastUsedStep, createdAt), nil
+}
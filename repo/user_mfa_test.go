@@ -0,0 +1,179 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/org39/webapp-tutorial-backend/entity/dto"
+	"github.com/org39/webapp-tutorial-backend/pkg/db"
+	"github.com/org39/webapp-tutorial-backend/usecase/user"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type UserMFARepoTestSuite struct {
+	suite.Suite
+	UserMFARepository user.MFARepository
+	DB                *db.DB
+	Sqlmock           sqlmock.Sqlmock
+}
+
+func (s *UserMFARepoTestSuite) SetupTest() {
+	mockdb, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		assert.Fail(s.T(), fmt.Sprintf("fail to sqlmock: %s", err))
+	}
+	s.DB = &db.DB{DB: mockdb}
+	s.Sqlmock = mock
+
+	r, err := NewUserMFARepository(
+		WithUserMFATable("user_mfa"),
+		WithUserMFADB(s.DB),
+	)
+	if err != nil {
+		assert.Fail(s.T(), fmt.Sprintf("fail to create repository: %s", err))
+	}
+
+	s.UserMFARepository = r
+}
+
+func (s *UserMFARepoTestSuite) TearDownTest() {
+	s.DB.Close()
+}
+
+func (s *UserMFARepoTestSuite) newUserMFA() *dto.UserMFA {
+	userID := "2192fc7b-bd9b-446d-a50e-5ce0ba02cee6"
+	return dto.NewFactory().NewUserMFA(userID, "JBSWY3DPEHPK3PXP", false, 0, time.Now())
+}
+
+func (s *UserMFARepoTestSuite) TestStoreSuccess() {
+	ctx := context.Background()
+	m := s.newUserMFA()
+
+	q := "INSERT INTO user_mfa (user_id,secret,enabled,last_used_step,created_at) VALUES (?,?,?,?,?) " +
+		"ON DUPLICATE KEY UPDATE secret = VALUES(secret), enabled = VALUES(enabled), last_used_step = VALUES(last_used_step), created_at = VALUES(created_at)"
+	s.Sqlmock.ExpectBegin()
+	s.Sqlmock.ExpectExec(q).
+		WithArgs(m.UserID, m.Secret, m.Enabled, m.LastUsedStep, m.CreatedAt).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	s.Sqlmock.ExpectCommit()
+
+	// assert
+	err := s.UserMFARepository.Store(ctx, m)
+	assert.NoError(s.T(), err)
+	assert.NoError(s.T(), s.Sqlmock.ExpectationsWereMet())
+}
+
+func (s *UserMFARepoTestSuite) TestFetchByUserIDExist() {
+	ctx := context.Background()
+	m := s.newUserMFA()
+
+	q := "SELECT user_id, secret, enabled, last_used_step, created_at FROM user_mfa WHERE user_id = ?"
+	s.Sqlmock.ExpectQuery(q).
+		WithArgs(m.UserID).
+		WillReturnRows(
+			sqlmock.
+				NewRows(userMFACols).
+				AddRow(m.UserID, m.Secret, m.Enabled, m.LastUsedStep, m.CreatedAt),
+		)
+
+	// assert
+	res, err := s.UserMFARepository.FetchByUserID(ctx, m.UserID)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), m.UserID, res.UserID)
+	assert.Equal(s.T(), m.Secret, res.Secret)
+	assert.NoError(s.T(), s.Sqlmock.ExpectationsWereMet())
+}
+
+func (s *UserMFARepoTestSuite) TestFetchByUserIDNotExist() {
+	ctx := context.Background()
+	m := s.newUserMFA()
+
+	q := "SELECT user_id, secret, enabled, last_used_step, created_at FROM user_mfa WHERE user_id = ?"
+	s.Sqlmock.ExpectQuery(q).
+		WithArgs(m.UserID).
+		WillReturnError(sql.ErrNoRows)
+
+	// assert
+	res, err := s.UserMFARepository.FetchByUserID(ctx, m.UserID)
+	assert.Nil(s.T(), res)
+	assert.ErrorIs(s.T(), err, user.ErrNotFound)
+	assert.NoError(s.T(), s.Sqlmock.ExpectationsWereMet())
+}
+
+func (s *UserMFARepoTestSuite) TestEnableSuccess() {
+	ctx := context.Background()
+	m := s.newUserMFA()
+
+	q := "UPDATE user_mfa SET enabled = ?, last_used_step = ? WHERE enabled = ? AND user_id = ?"
+	s.Sqlmock.ExpectBegin()
+	s.Sqlmock.ExpectExec(q).
+		WithArgs(true, int64(54321), false, m.UserID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	s.Sqlmock.ExpectCommit()
+
+	// assert
+	err := s.UserMFARepository.Enable(ctx, m.UserID, 54321)
+	assert.NoError(s.T(), err)
+	assert.NoError(s.T(), s.Sqlmock.ExpectationsWereMet())
+}
+
+func (s *UserMFARepoTestSuite) TestUseStepSuccess() {
+	ctx := context.Background()
+	m := s.newUserMFA()
+
+	q := "UPDATE user_mfa SET last_used_step = ? WHERE user_id = ? AND last_used_step < ?"
+	s.Sqlmock.ExpectBegin()
+	s.Sqlmock.ExpectExec(q).
+		WithArgs(int64(54321), m.UserID, int64(54321)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	s.Sqlmock.ExpectCommit()
+
+	// assert
+	err := s.UserMFARepository.UseStep(ctx, m.UserID, 54321)
+	assert.NoError(s.T(), err)
+	assert.NoError(s.T(), s.Sqlmock.ExpectationsWereMet())
+}
+
+func (s *UserMFARepoTestSuite) TestUseStepAlreadyUsed() {
+	ctx := context.Background()
+	m := s.newUserMFA()
+
+	q := "UPDATE user_mfa SET last_used_step = ? WHERE user_id = ? AND last_used_step < ?"
+	s.Sqlmock.ExpectBegin()
+	s.Sqlmock.ExpectExec(q).
+		WithArgs(int64(54321), m.UserID, int64(54321)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	s.Sqlmock.ExpectCommit()
+
+	// assert
+	err := s.UserMFARepository.UseStep(ctx, m.UserID, 54321)
+	assert.ErrorIs(s.T(), err, user.ErrNotFound)
+	assert.NoError(s.T(), s.Sqlmock.ExpectationsWereMet())
+}
+
+func (s *UserMFARepoTestSuite) TestDeleteSuccess() {
+	ctx := context.Background()
+	m := s.newUserMFA()
+
+	q := "DELETE FROM user_mfa WHERE user_id = ?"
+	s.Sqlmock.ExpectBegin()
+	s.Sqlmock.ExpectExec(q).
+		WithArgs(m.UserID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	s.Sqlmock.ExpectCommit()
+
+	// assert
+	err := s.UserMFARepository.Delete(ctx, m.UserID)
+	assert.NoError(s.T(), err)
+	assert.NoError(s.T(), s.Sqlmock.ExpectationsWereMet())
+}
+
+func TestUserMFARepo(t *testing.T) {
+	suite.Run(t, new(UserMFARepoTestSuite))
+}
@@ -0,0 +1,111 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/org39/webapp-tutorial-backend/entity/dto"
+	"github.com/org39/webapp-tutorial-backend/pkg/db"
+	"github.com/org39/webapp-tutorial-backend/usecase/user"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+var (
+	userProfileCols = []string{"user_id", "display_name", "time_zone", "locale", "avatar_id", "preferences", "updated_at"}
+)
+
+type UserProfileRepository struct {
+	DB    *db.DB `inject:""`
+	Table string `inject:"repo.user_profile.table"`
+}
+
+func NewUserProfileRepository(options ...func(*UserProfileRepository) error) (user.ProfileRepository, error) {
+	r := &UserProfileRepository{}
+
+	for _, option := range options {
+		if err := option(r); err != nil {
+			return nil, err
+		}
+	}
+
+	return r, nil
+}
+
+func WithUserProfileDB(db *db.DB) func(*UserProfileRepository) error {
+	return func(r *UserProfileRepository) error {
+		r.DB = db
+		return nil
+	}
+}
+
+func WithUserProfileTable(table string) func(*UserProfileRepository) error {
+	return func(r *UserProfileRepository) error {
+		r.Table = table
+		return nil
+	}
+}
+
+// FetchByUserID returns user.ErrNotFound when the user never saved a profile.
+func (r *UserProfileRepository) FetchByUserID(ctx context.Context, userID string) (*dto.UserProfile, error) {
+	query, args, err := sq.Select(userProfileCols...).From(r.Table).Where(sq.Eq{"user_id": userID}).ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", err.Error(), user.ErrDatabaseError)
+	}
+
+	row := r.DB.QueryRow(ctx, query, args...)
+	p, err := r.scanUserProfile(row)
+	if err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// Store saves the profile, replacing the one of the user.
+func (r *UserProfileRepository) Store(ctx context.Context, p *dto.UserProfile) error {
+	preferences, err := json.Marshal(p.Preferences)
+	if err != nil {
+		return fmt.Errorf("%s: %w", err.Error(), user.ErrDatabaseError)
+	}
+
+	query, args, err := sq.Insert(r.Table).
+		Columns(userProfileCols...).
+		Values(p.UserID, p.DisplayName, p.TimeZone, p.Locale, p.AvatarID, string(preferences), p.UpdatedAt).
+		Suffix("ON DUPLICATE KEY UPDATE display_name = VALUES(display_name), time_zone = VALUES(time_zone), locale = VALUES(locale), avatar_id = VALUES(avatar_id), preferences = VALUES(preferences), updated_at = VALUES(updated_at)").
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("%s: %w", err.Error(), user.ErrDatabaseError)
+	}
+
+	_, err = r.DB.Exec(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("%s: %w", err.Error(), user.ErrDatabaseError)
+	}
+	return nil
+}
+
+func (r *UserProfileRepository) scanUserProfile(row db.Scanable) (*dto.UserProfile, error) {
+	var userID, displayName, timeZone, locale, avatarID string
+	var preferences []byte
+	var updatedAt time.Time
+
+	err := row.Scan(&userID, &displayName, &timeZone, &locale, &avatarID, &preferences, &updatedAt)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil, user.ErrNotFound
+	case err != nil:
+		return nil, fmt.Errorf("%s: %w", err.Error(), user.ErrDatabaseError)
+	}
+
+	doc := map[string]interface{}{}
+	if err := json.Unmarshal(preferences, &doc); err != nil {
+		return nil, fmt.Errorf("%s: %w", err.Error(), user.ErrDatabaseError)
+	}
+
+	return dto.NewFactory().NewUserProfile(userID, displayName, timeZone, locale, avatarID, doc, updatedAt), nil
+}
@@ -0,0 +1,115 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/org39/webapp-tutorial-backend/entity/dto"
+	"github.com/org39/webapp-tutorial-backend/pkg/db"
+	"github.com/org39/webapp-tutorial-backend/usecase/user"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type UserProfileRepoTestSuite struct {
+	suite.Suite
+	UserProfileRepository user.ProfileRepository
+	DB                    *db.DB
+	Sqlmock               sqlmock.Sqlmock
+}
+
+func (s *UserProfileRepoTestSuite) SetupTest() {
+	mockdb, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		assert.Fail(s.T(), fmt.Sprintf("fail to sqlmock: %s", err))
+	}
+	s.DB = &db.DB{DB: mockdb}
+	s.Sqlmock = mock
+
+	r, err := NewUserProfileRepository(
+		WithUserProfileTable("user_profiles"),
+		WithUserProfileDB(s.DB),
+	)
+	if err != nil {
+		assert.Fail(s.T(), fmt.Sprintf("fail to create repository: %s", err))
+	}
+
+	s.UserProfileRepository = r
+}
+
+func (s *UserProfileRepoTestSuite) TearDownTest() {
+	s.DB.Close()
+}
+
+func (s *UserProfileRepoTestSuite) newUserProfile() *dto.UserProfile {
+	userID := "2192fc7b-bd9b-446d-a50e-5ce0ba02cee6"
+	avatarID := "5c6a9a1e-8f3b-4d0c-9d4e-2f7b1c3a6e10"
+	preferences := map[string]interface{}{"default_sort": "created_at"}
+	return dto.NewFactory().NewUserProfile(userID, "Miku", "Asia/Tokyo", "ja-JP", avatarID, preferences, time.Now())
+}
+
+func (s *UserProfileRepoTestSuite) TestStoreSuccess() {
+	ctx := context.Background()
+	p := s.newUserProfile()
+
+	q := "INSERT INTO user_profiles (user_id,display_name,time_zone,locale,avatar_id,preferences,updated_at) VALUES (?,?,?,?,?,?,?) " +
+		"ON DUPLICATE KEY UPDATE display_name = VALUES(display_name), time_zone = VALUES(time_zone), locale = VALUES(locale), avatar_id = VALUES(avatar_id), preferences = VALUES(preferences), updated_at = VALUES(updated_at)"
+	s.Sqlmock.ExpectBegin()
+	s.Sqlmock.ExpectExec(q).
+		WithArgs(p.UserID, p.DisplayName, p.TimeZone, p.Locale, p.AvatarID, `{"default_sort":"created_at"}`, p.UpdatedAt).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	s.Sqlmock.ExpectCommit()
+
+	// assert
+	err := s.UserProfileRepository.Store(ctx, p)
+	assert.NoError(s.T(), err)
+	assert.NoError(s.T(), s.Sqlmock.ExpectationsWereMet())
+}
+
+func (s *UserProfileRepoTestSuite) TestFetchByUserIDExist() {
+	ctx := context.Background()
+	p := s.newUserProfile()
+
+	q := "SELECT user_id, display_name, time_zone, locale, avatar_id, preferences, updated_at FROM user_profiles WHERE user_id = ?"
+	s.Sqlmock.ExpectQuery(q).
+		WithArgs(p.UserID).
+		WillReturnRows(
+			sqlmock.
+				NewRows(userProfileCols).
+				AddRow(p.UserID, p.DisplayName, p.TimeZone, p.Locale, p.AvatarID, []byte(`{"default_sort":"created_at"}`), p.UpdatedAt),
+		)
+
+	// assert
+	res, err := s.UserProfileRepository.FetchByUserID(ctx, p.UserID)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), p.UserID, res.UserID)
+	assert.Equal(s.T(), p.DisplayName, res.DisplayName)
+	assert.Equal(s.T(), p.TimeZone, res.TimeZone)
+	assert.Equal(s.T(), p.Preferences, res.Preferences)
+	assert.NoError(s.T(), s.Sqlmock.ExpectationsWereMet())
+}
+
+func (s *UserProfileRepoTestSuite) TestFetchByUserIDNotExist() {
+	ctx := context.Background()
+	p := s.newUserProfile()
+
+	q := "SELECT user_id, display_name, time_zone, locale, avatar_id, preferences, updated_at FROM user_profiles WHERE user_id = ?"
+	s.Sqlmock.ExpectQuery(q).
+		WithArgs(p.UserID).
+		WillReturnError(sql.ErrNoRows)
+
+	// assert
+	res, err := s.UserProfileRepository.FetchByUserID(ctx, p.UserID)
+	assert.Nil(s.T(), res)
+	assert.ErrorIs(s.T(), err, user.ErrNotFound)
+	assert.NoError(s.T(), s.Sqlmock.ExpectationsWereMet())
+}
+
+func TestUserProfileRepo(t *testing.T) {
+	suite.Run(t, new(UserProfileRepoTestSuite))
+}
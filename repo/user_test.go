@@ -3,6 +3,7 @@ package repo
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"testing"
 	"time"
@@ -33,6 +34,7 @@ func (s *UserRepoTestSuite) SetupTest() {
 
 	r, err := NewUserRepository(
 		WithUserTable("users"),
+		WithUserOwnedTables("todos", "sessions"),
 		WithUserDB(s.DB),
 	)
 	if err != nil {
@@ -51,19 +53,21 @@ func (s *UserRepoTestSuite) TestFetchByEmailExist() {
 	email := "hatsune@miku.com"
 
 	// mock database
-	q := "SELECT id, email, password, created_at FROM users WHERE email = ?"
+	q := "SELECT id, email, password, roles, verified_at, disabled_at, created_at FROM users WHERE email = ?"
 	s.Sqlmock.ExpectQuery(q).
 		WithArgs(email).
 		WillReturnRows(
 			sqlmock.
-				NewRows([]string{"id", "email", "password", "created_at"}).
-				AddRow("id", email, "PASSWORD", time.Now()),
+				NewRows(userCols).
+				AddRow("id", email, "PASSWORD", "admin", nil, nil, time.Now()),
 		)
 
 	// assert
 	user, err := s.UserRepository.FetchByEmail(ctx, email)
 	assert.NoError(s.T(), err)
 	assert.Equal(s.T(), email, user.Email)
+	assert.Equal(s.T(), []string{"admin"}, user.Roles)
+	assert.Nil(s.T(), user.DisabledAt)
 	assert.NoError(s.T(), s.Sqlmock.ExpectationsWereMet())
 }
 
@@ -72,7 +76,7 @@ func (s *UserRepoTestSuite) TestFetchByEmailNotExist() {
 	email := "not-exist@mail.com"
 
 	// mock database
-	q := "SELECT id, email, password, created_at FROM users WHERE email = ?"
+	q := "SELECT id, email, password, roles, verified_at, disabled_at, created_at FROM users WHERE email = ?"
 	s.Sqlmock.ExpectQuery(q).
 		WithArgs(email).WillReturnError(sql.ErrNoRows)
 
@@ -85,12 +89,12 @@ func (s *UserRepoTestSuite) TestFetchByEmailNotExist() {
 
 func (s *UserRepoTestSuite) TestStoreSuccess() {
 	ctx := context.Background()
-	u := dto.NewFactory().NewUser("5c2dd83a-6250-40f3-a47e-21d957c07d06", "hatsune@miku.com", "PASSWORD", time.Now())
+	u := dto.NewFactory().NewUser("5c2dd83a-6250-40f3-a47e-21d957c07d06", "hatsune@miku.com", "PASSWORD", nil, nil, nil, time.Now())
 
-	q := "INSERT INTO users (id,email,password,created_at) VALUES (?,?,?,?)"
+	q := "INSERT INTO users (id,email,password,roles,verified_at,disabled_at,created_at) VALUES (?,?,?,?,?,?,?)"
 	s.Sqlmock.ExpectBegin()
 	s.Sqlmock.ExpectExec(q).
-		WithArgs(u.ID, u.Email, u.Password, u.CreatedAt).
+		WithArgs(u.ID, u.Email, u.Password, "", u.VerifiedAt, u.DisabledAt, u.CreatedAt).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 	s.Sqlmock.ExpectCommit()
 
@@ -102,12 +106,13 @@ func (s *UserRepoTestSuite) TestStoreSuccess() {
 
 func (s *UserRepoTestSuite) TestUpdateSuccess() {
 	ctx := context.Background()
-	u := dto.NewFactory().NewUser("5c2dd83a-6250-40f3-a47e-21d957c07d06", "hatsune@miku.com", "PASSWORD", time.Now())
+	disabledAt := time.Now()
+	u := dto.NewFactory().NewUser("5c2dd83a-6250-40f3-a47e-21d957c07d06", "hatsune@miku.com", "PASSWORD", []string{"admin"}, nil, &disabledAt, time.Now())
 
-	q := "UPDATE users SET email = ?, password = ? WHERE id = ?"
+	q := "UPDATE users SET email = ?, password = ?, roles = ?, verified_at = ?, disabled_at = ? WHERE id = ?"
 	s.Sqlmock.ExpectBegin()
 	s.Sqlmock.ExpectExec(q).
-		WithArgs(u.Email, u.Password, u.ID).
+		WithArgs(u.Email, u.Password, "admin", u.VerifiedAt, u.DisabledAt, u.ID).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 	s.Sqlmock.ExpectCommit()
 
@@ -117,6 +122,84 @@ func (s *UserRepoTestSuite) TestUpdateSuccess() {
 	assert.NoError(s.T(), s.Sqlmock.ExpectationsWereMet())
 }
 
+func (s *UserRepoTestSuite) TestDeleteSuccess() {
+	ctx := context.Background()
+	id := "5c2dd83a-6250-40f3-a47e-21d957c07d06"
+
+	// rows the user owns go first, in one transaction
+	s.Sqlmock.ExpectBegin()
+	s.Sqlmock.ExpectExec("DELETE FROM todos WHERE user_id = ?").
+		WithArgs(id).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	s.Sqlmock.ExpectExec("DELETE FROM sessions WHERE user_id = ?").
+		WithArgs(id).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	s.Sqlmock.ExpectExec("DELETE FROM users WHERE id = ?").
+		WithArgs(id).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	s.Sqlmock.ExpectCommit()
+
+	// assert
+	err := s.UserRepository.Delete(ctx, id)
+	assert.NoError(s.T(), err)
+	assert.NoError(s.T(), s.Sqlmock.ExpectationsWereMet())
+}
+
+func (s *UserRepoTestSuite) TestDeleteRollbackOnError() {
+	ctx := context.Background()
+	id := "5c2dd83a-6250-40f3-a47e-21d957c07d06"
+
+	s.Sqlmock.ExpectBegin()
+	s.Sqlmock.ExpectExec("DELETE FROM todos WHERE user_id = ?").
+		WithArgs(id).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	s.Sqlmock.ExpectExec("DELETE FROM sessions WHERE user_id = ?").
+		WithArgs(id).
+		WillReturnError(errors.New("lock wait timeout"))
+	s.Sqlmock.ExpectRollback()
+
+	// assert, the user and the todos are kept
+	err := s.UserRepository.Delete(ctx, id)
+	assert.ErrorIs(s.T(), err, user.ErrDatabaseError)
+	assert.NoError(s.T(), s.Sqlmock.ExpectationsWereMet())
+}
+
+func (s *UserRepoTestSuite) TestSearchExist() {
+	ctx := context.Background()
+
+	// wildcards in the query are matched literally
+	q := "SELECT id, email, password, roles, verified_at, disabled_at, created_at FROM users WHERE email LIKE ? ORDER BY created_at, id LIMIT 20 OFFSET 40"
+	s.Sqlmock.ExpectQuery(q).
+		WithArgs(`%miku\_%`).
+		WillReturnRows(
+			sqlmock.
+				NewRows(userCols).
+				AddRow("5c2dd83a-6250-40f3-a47e-21d957c07d06", "miku_39@miku.com", "PASSWORD", "", nil, nil, time.Now()),
+		)
+
+	// assert
+	users, err := s.UserRepository.Search(ctx, "miku_", 20, 40)
+	assert.NoError(s.T(), err)
+	assert.Len(s.T(), users, 1)
+	assert.Equal(s.T(), "miku_39@miku.com", users[0].Email)
+	assert.NoError(s.T(), s.Sqlmock.ExpectationsWereMet())
+}
+
+func (s *UserRepoTestSuite) TestSearchEveryUser() {
+	ctx := context.Background()
+
+	q := "SELECT id, email, password, roles, verified_at, disabled_at, created_at FROM users ORDER BY created_at, id LIMIT 20 OFFSET 0"
+	s.Sqlmock.ExpectQuery(q).
+		WillReturnError(sql.ErrNoRows)
+
+	// assert
+	users, err := s.UserRepository.Search(ctx, "", 20, 0)
+	assert.NoError(s.T(), err)
+	assert.NotNil(s.T(), users)
+	assert.Empty(s.T(), users)
+	assert.NoError(s.T(), s.Sqlmock.ExpectationsWereMet())
+}
+
 func TestUserRepo(t *testing.T) {
 	suite.Run(t, new(UserRepoTestSuite))
 }
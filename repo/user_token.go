@@ -0,0 +1,146 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/org39/webapp-tutorial-backend/entity/dto"
+	"github.com/org39/webapp-tutorial-backend/pkg/db"
+	"github.com/org39/webapp-tutorial-backend/usecase/user"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+var (
+	userTokenCols = []string{"id", "user_id", "purpose", "token_hash", "used", "expires_at", "created_at"}
+)
+
+type UserTokenRepository struct {
+	DB    *db.DB `inject:""`
+	Table string `inject:"repo.user_token.table"`
+}
+
+func NewUserTokenRepository(options ...func(*UserTokenRepository) error) (user.TokenRepository, error) {
+	r := &UserTokenRepository{}
+
+	for _, option := range options {
+		if err := option(r); err != nil {
+			return nil, err
+		}
+	}
+
+	return r, nil
+}
+
+func WithUserTokenDB(db *db.DB) func(*UserTokenRepository) error {
+	return func(r *UserTokenRepository) error {
+		r.DB = db
+		return nil
+	}
+}
+
+func WithUserTokenTable(table string) func(*UserTokenRepository) error {
+	return func(r *UserTokenRepository) error {
+		r.Table = table
+		return nil
+	}
+}
+
+func (r *UserTokenRepository) Store(ctx context.Context, t *dto.UserToken) error {
+	query, args, err := sq.Insert(r.Table).
+		Columns(userTokenCols...).
+		Values(t.ID, t.UserID, t.Purpose, t.TokenHash, t.Used, t.ExpiresAt, t.CreatedAt).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("%s: %w", err.Error(), user.ErrDatabaseError)
+	}
+
+	_, err = r.DB.Exec(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("%s: %w", err.Error(), user.ErrDatabaseError)
+	}
+	return nil
+}
+
+func (r *UserTokenRepository) FetchByHash(ctx context.Context, purpose string, tokenHash string) (*dto.UserToken, error) {
+	query, args, err := r.selectUserToken().
+		Where(sq.Eq{"token_hash": tokenHash}).
+		Where(sq.Eq{"purpose": purpose}).
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", err.Error(), user.ErrDatabaseError)
+	}
+
+	row := r.DB.QueryRow(ctx, query, args...)
+	t, err := r.scanUserToken(row)
+	if err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// Consume marks the token as used, only if nobody else used it first.
+// It returns user.ErrNotFound when the token was already used.
+func (r *UserTokenRepository) Consume(ctx context.Context, id string) error {
+	query, args, err := sq.Update(r.Table).
+		Set("used", true).
+		Where(sq.Eq{"id": id, "used": false}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("%s: %w", err.Error(), user.ErrDatabaseError)
+	}
+
+	res, err := r.DB.Exec(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("%s: %w", err.Error(), user.ErrDatabaseError)
+	}
+
+	affected, err := res.RowsAffected()
+	switch {
+	case err != nil:
+		return fmt.Errorf("%s: %w", err.Error(), user.ErrDatabaseError)
+	case affected == 0:
+		return user.ErrNotFound
+	}
+	return nil
+}
+
+func (r *UserTokenRepository) InvalidateByUser(ctx context.Context, userID string, purpose string) error {
+	query, args, err := sq.Update(r.Table).
+		Set("used", true).
+		Where(sq.Eq{"purpose": purpose, "used": false, "user_id": userID}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("%s: %w", err.Error(), user.ErrDatabaseError)
+	}
+
+	_, err = r.DB.Exec(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("%s: %w", err.Error(), user.ErrDatabaseError)
+	}
+	return nil
+}
+
+func (r *UserTokenRepository) selectUserToken() sq.SelectBuilder {
+	return sq.Select(userTokenCols...).From(r.Table)
+}
+
+func (r *UserTokenRepository) scanUserToken(row db.Scanable) (*dto.UserToken, error) {
+	var id, userID, purpose, tokenHash string
+	var used bool
+	var expiresAt, createdAt time.Time
+
+	err := row.Scan(&id, &userID, &purpose, &tokenHash, &used, &expiresAt, &createdAt)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil, user.ErrNotFound
+	case err != nil:
+		return nil, fmt.Errorf("%s: %w", err.Error(), user.ErrDatabaseError)
+	}
+
+	return dto.NewFactory().NewUserToken(id, userID, purpose, tokenHash, used, expiresAt, createdAt), nil
+}
@@ -0,0 +1,164 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/org39/webapp-tutorial-backend/entity/dto"
+	"github.com/org39/webapp-tutorial-backend/pkg/db"
+	"github.com/org39/webapp-tutorial-backend/usecase/user"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type UserTokenRepoTestSuite struct {
+	suite.Suite
+	UserTokenRepository user.TokenRepository
+	DB                  *db.DB
+	Sqlmock             sqlmock.Sqlmock
+}
+
+func (s *UserTokenRepoTestSuite) SetupTest() {
+	mockdb, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		assert.Fail(s.T(), fmt.Sprintf("fail to sqlmock: %s", err))
+	}
+	s.DB = &db.DB{DB: mockdb}
+	s.Sqlmock = mock
+
+	r, err := NewUserTokenRepository(
+		WithUserTokenTable("user_tokens"),
+		WithUserTokenDB(s.DB),
+	)
+	if err != nil {
+		assert.Fail(s.T(), fmt.Sprintf("fail to create repository: %s", err))
+	}
+
+	s.UserTokenRepository = r
+}
+
+func (s *UserTokenRepoTestSuite) TearDownTest() {
+	s.DB.Close()
+}
+
+func (s *UserTokenRepoTestSuite) newUserToken() *dto.UserToken {
+	id := "4daaaea8-4721-4644-aaac-7958805b4530"
+	userID := "2192fc7b-bd9b-446d-a50e-5ce0ba02cee6"
+	tokenHash := "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+	return dto.NewFactory().NewUserToken(id, userID, "password_reset", tokenHash, false, time.Now().Add(time.Hour), time.Now())
+}
+
+func (s *UserTokenRepoTestSuite) TestStoreSuccess() {
+	ctx := context.Background()
+	t := s.newUserToken()
+
+	q := "INSERT INTO user_tokens (id,user_id,purpose,token_hash,used,expires_at,created_at) VALUES (?,?,?,?,?,?,?)"
+	s.Sqlmock.ExpectBegin()
+	s.Sqlmock.ExpectExec(q).
+		WithArgs(t.ID, t.UserID, t.Purpose, t.TokenHash, t.Used, t.ExpiresAt, t.CreatedAt).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	s.Sqlmock.ExpectCommit()
+
+	// assert
+	err := s.UserTokenRepository.Store(ctx, t)
+	assert.NoError(s.T(), err)
+	assert.NoError(s.T(), s.Sqlmock.ExpectationsWereMet())
+}
+
+func (s *UserTokenRepoTestSuite) TestFetchByHashExist() {
+	ctx := context.Background()
+	t := s.newUserToken()
+
+	q := "SELECT id, user_id, purpose, token_hash, used, expires_at, created_at FROM user_tokens WHERE token_hash = ? AND purpose = ?"
+	s.Sqlmock.ExpectQuery(q).
+		WithArgs(t.TokenHash, t.Purpose).
+		WillReturnRows(
+			sqlmock.
+				NewRows(userTokenCols).
+				AddRow(t.ID, t.UserID, t.Purpose, t.TokenHash, t.Used, t.ExpiresAt, t.CreatedAt),
+		)
+
+	// assert
+	res, err := s.UserTokenRepository.FetchByHash(ctx, t.Purpose, t.TokenHash)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), t.ID, res.ID)
+	assert.Equal(s.T(), t.UserID, res.UserID)
+	assert.Equal(s.T(), t.Purpose, res.Purpose)
+	assert.NoError(s.T(), s.Sqlmock.ExpectationsWereMet())
+}
+
+func (s *UserTokenRepoTestSuite) TestFetchByHashNotExist() {
+	ctx := context.Background()
+	t := s.newUserToken()
+
+	q := "SELECT id, user_id, purpose, token_hash, used, expires_at, created_at FROM user_tokens WHERE token_hash = ? AND purpose = ?"
+	s.Sqlmock.ExpectQuery(q).
+		WithArgs(t.TokenHash, t.Purpose).
+		WillReturnError(sql.ErrNoRows)
+
+	// assert
+	res, err := s.UserTokenRepository.FetchByHash(ctx, t.Purpose, t.TokenHash)
+	assert.Nil(s.T(), res)
+	assert.ErrorIs(s.T(), err, user.ErrNotFound)
+	assert.NoError(s.T(), s.Sqlmock.ExpectationsWereMet())
+}
+
+func (s *UserTokenRepoTestSuite) TestConsumeSuccess() {
+	ctx := context.Background()
+	t := s.newUserToken()
+
+	q := "UPDATE user_tokens SET used = ? WHERE id = ? AND used = ?"
+	s.Sqlmock.ExpectBegin()
+	s.Sqlmock.ExpectExec(q).
+		WithArgs(true, t.ID, false).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	s.Sqlmock.ExpectCommit()
+
+	// assert
+	err := s.UserTokenRepository.Consume(ctx, t.ID)
+	assert.NoError(s.T(), err)
+	assert.NoError(s.T(), s.Sqlmock.ExpectationsWereMet())
+}
+
+func (s *UserTokenRepoTestSuite) TestConsumeAlreadyUsed() {
+	ctx := context.Background()
+	t := s.newUserToken()
+
+	q := "UPDATE user_tokens SET used = ? WHERE id = ? AND used = ?"
+	s.Sqlmock.ExpectBegin()
+	s.Sqlmock.ExpectExec(q).
+		WithArgs(true, t.ID, false).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	s.Sqlmock.ExpectCommit()
+
+	// assert
+	err := s.UserTokenRepository.Consume(ctx, t.ID)
+	assert.ErrorIs(s.T(), err, user.ErrNotFound)
+	assert.NoError(s.T(), s.Sqlmock.ExpectationsWereMet())
+}
+
+func (s *UserTokenRepoTestSuite) TestInvalidateByUserSuccess() {
+	ctx := context.Background()
+	t := s.newUserToken()
+
+	q := "UPDATE user_tokens SET used = ? WHERE purpose = ? AND used = ? AND user_id = ?"
+	s.Sqlmock.ExpectBegin()
+	s.Sqlmock.ExpectExec(q).
+		WithArgs(true, t.Purpose, false, t.UserID).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	s.Sqlmock.ExpectCommit()
+
+	// assert
+	err := s.UserTokenRepository.InvalidateByUser(ctx, t.UserID, t.Purpose)
+	assert.NoError(s.T(), err)
+	assert.NoError(s.T(), s.Sqlmock.ExpectationsWereMet())
+}
+
+func TestUserTokenRepo(t *testing.T) {
+	suite.Run(t, new(UserTokenRepoTestSuite))
+}
@@ -0,0 +1,268 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	app "github.com/org39/webapp-tutorial-backend/app/server"
+
+	"github.com/labstack/echo/v4"
+	"github.com/org39/webapp-tutorial-backend/pkg/testreport"
+	"github.com/steinfletcher/apitest"
+	jpassert "github.com/steinfletcher/apitest-jsonpath"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type AdminIntegrationTestSuite struct {
+	suite.Suite
+
+	Application       *app.App
+	Server            *echo.Echo
+	TestSuiteReporter *testreport.TestSuiteReporter
+}
+
+func (s *AdminIntegrationTestSuite) SetupSuite() {
+	reporter := testreport.New("AdminIntegrationTest", "./report")
+	application, server, err := buildTestServer()
+	if err != nil {
+		assert.Fail(s.T(), fmt.Sprintf("fail to create test Server: %s", err))
+	}
+
+	s.Application = application
+	s.Server = server
+	s.TestSuiteReporter = reporter
+}
+
+func (s *AdminIntegrationTestSuite) SetupTest() {
+	tables := []string{
+		s.Application.Config.UserTable,
+		s.Application.Config.AuthRefreshTokenTable,
+		s.Application.Config.AuthTokenGenerationTable,
+		s.Application.Config.AuthSessionTable,
+	}
+
+	for _, table := range tables {
+		_, err := s.Application.DB.Exec(context.Background(), fmt.Sprintf("TRUNCATE %s", table))
+		if err != nil {
+			assert.Fail(s.T(), fmt.Sprintf("fail to truncate %s table: %s", table, err))
+		}
+	}
+}
+
+func (s *AdminIntegrationTestSuite) TearDownSuite() {
+	s.Application.DB.Close()
+	s.TestSuiteReporter.Flush()
+}
+
+func (s *AdminIntegrationTestSuite) apiTest(name string) *apitest.APITest {
+	return apitest.New(name).
+		Recorder(recorder).
+		Report(s.TestSuiteReporter).
+		Handler(s.Server)
+}
+
+// createAdminAccount promotes a test account, roles are granted in the database
+// and carried by tokens issued after it.
+func (s *AdminIntegrationTestSuite) createAdminAccount(name string) Account {
+	account := createTestAccount(s.T(), s.apiTest(name))
+
+	_, err := s.Application.DB.Exec(context.Background(),
+		fmt.Sprintf("UPDATE %s SET roles = ? WHERE email = ?", s.Application.Config.UserTable), "admin", account.User.Email)
+	if err != nil {
+		assert.Fail(s.T(), fmt.Sprintf("fail to grant admin role: %s", err))
+	}
+
+	res := s.apiTest(name).
+		Post("/user/login").
+		JSON(map[string]string{
+			"email":    account.User.Email,
+			"password": account.Password,
+		}).
+		Expect(s.T()).
+		Status(http.StatusOK).
+		End()
+	res.JSON(&account)
+
+	return account
+}
+
+// createMemberAccount signs up another user, whose id is looked up by the admin.
+func (s *AdminIntegrationTestSuite) createMemberAccount(name string, admin Account) Account {
+	account := Account{
+		User: User{
+			Email: "kagamine@rin.com",
+		},
+		Password: "very-strong-password",
+	}
+
+	res := s.apiTest(name).
+		Post("/user/register").
+		JSON(map[string]string{
+			"email":    account.User.Email,
+			"password": account.Password,
+		}).
+		Expect(s.T()).
+		Status(http.StatusCreated).
+		End()
+	res.JSON(&account)
+
+	users := []User{}
+	s.apiTest(name).
+		Get("/admin/users").
+		Query("email", "rin").
+		Header("Authorization", fmt.Sprintf("Bearer %s", admin.AccessToken)).
+		Expect(s.T()).
+		Assert(jpassert.Len("$", 1)).
+		Status(http.StatusOK).
+		End().
+		JSON(&users)
+	if len(users) == 1 {
+		account.User.ID = users[0].ID
+	}
+
+	return account
+}
+
+func (s *AdminIntegrationTestSuite) TestListUsersSuccess() {
+	admin := s.createAdminAccount("TestListUsersSuccess")
+	_ = s.createMemberAccount("TestListUsersSuccess", admin)
+
+	s.apiTest("TestListUsersSuccess").
+		Get("/admin/users").
+		Header("Authorization", fmt.Sprintf("Bearer %s", admin.AccessToken)).
+		Expect(s.T()).
+		Assert(jpassert.Len("$", 2)).
+		Assert(jpassert.Equal("$[0].email", admin.User.Email)).
+		Assert(jpassert.Equal("$[0].roles[0]", "admin")).
+		Assert(jpassert.Equal("$[1].disabled", false)).
+		Status(http.StatusOK).
+		End()
+
+	s.apiTest("TestListUsersSuccess").
+		Get("/admin/users").
+		Query("limit", "1").
+		Query("offset", "1").
+		Header("Authorization", fmt.Sprintf("Bearer %s", admin.AccessToken)).
+		Expect(s.T()).
+		Assert(jpassert.Len("$", 1)).
+		Assert(jpassert.Equal("$[0].email", "kagamine@rin.com")).
+		Status(http.StatusOK).
+		End()
+}
+
+func (s *AdminIntegrationTestSuite) TestAdminRoleRequired() {
+	account := createTestAccount(s.T(), s.apiTest("TestAdminRoleRequired"))
+
+	s.apiTest("TestAdminRoleRequired").
+		Get("/admin/users").
+		Header("Authorization", fmt.Sprintf("Bearer %s", account.AccessToken)).
+		Expect(s.T()).
+		Status(http.StatusForbidden).
+		End()
+}
+
+func (s *AdminIntegrationTestSuite) TestDisableUserSuccess() {
+	admin := s.createAdminAccount("TestDisableUserSuccess")
+	member := s.createMemberAccount("TestDisableUserSuccess", admin)
+
+	s.apiTest("TestDisableUserSuccess").
+		Post(fmt.Sprintf("/admin/users/%s/disable", member.User.ID)).
+		Header("Authorization", fmt.Sprintf("Bearer %s", admin.AccessToken)).
+		Expect(s.T()).
+		Status(http.StatusNoContent).
+		End()
+
+	s.apiTest("TestDisableUserSuccess").
+		Get(fmt.Sprintf("/admin/users/%s", member.User.ID)).
+		Header("Authorization", fmt.Sprintf("Bearer %s", admin.AccessToken)).
+		Expect(s.T()).
+		Assert(jpassert.Equal("$.disabled", true)).
+		Assert(jpassert.Present("$.disabled_at")).
+		Status(http.StatusOK).
+		End()
+
+	// tokens issued before are revoked, and no new ones are issued
+	s.apiTest("TestDisableUserSuccess").
+		Get("/user").
+		Header("Authorization", fmt.Sprintf("Bearer %s", member.AccessToken)).
+		Expect(s.T()).
+		Status(http.StatusUnauthorized).
+		End()
+
+	s.apiTest("TestDisableUserSuccess").
+		Post("/user/login").
+		JSON(map[string]string{
+			"email":    member.User.Email,
+			"password": member.Password,
+		}).
+		Expect(s.T()).
+		Status(http.StatusUnauthorized).
+		End()
+
+	s.apiTest("TestDisableUserSuccess").
+		Post(fmt.Sprintf("/admin/users/%s/enable", member.User.ID)).
+		Header("Authorization", fmt.Sprintf("Bearer %s", admin.AccessToken)).
+		Expect(s.T()).
+		Status(http.StatusNoContent).
+		End()
+
+	s.apiTest("TestDisableUserSuccess").
+		Post("/user/login").
+		JSON(map[string]string{
+			"email":    member.User.Email,
+			"password": member.Password,
+		}).
+		Expect(s.T()).
+		Status(http.StatusOK).
+		End()
+}
+
+func (s *AdminIntegrationTestSuite) TestDisableOwnAccountFail() {
+	admin := s.createAdminAccount("TestDisableOwnAccountFail")
+
+	users := []User{}
+	s.apiTest("TestDisableOwnAccountFail").
+		Get("/admin/users").
+		Header("Authorization", fmt.Sprintf("Bearer %s", admin.AccessToken)).
+		Expect(s.T()).
+		Status(http.StatusOK).
+		End().
+		JSON(&users)
+	assert.Len(s.T(), users, 1)
+
+	s.apiTest("TestDisableOwnAccountFail").
+		Post(fmt.Sprintf("/admin/users/%s/disable", users[0].ID)).
+		Header("Authorization", fmt.Sprintf("Bearer %s", admin.AccessToken)).
+		Expect(s.T()).
+		Status(http.StatusBadRequest).
+		End()
+}
+
+func (s *AdminIntegrationTestSuite) TestForceLogoutSuccess() {
+	admin := s.createAdminAccount("TestForceLogoutSuccess")
+	member := s.createMemberAccount("TestForceLogoutSuccess", admin)
+
+	s.apiTest("TestForceLogoutSuccess").
+		Post(fmt.Sprintf("/admin/users/%s/logout", member.User.ID)).
+		Header("Authorization", fmt.Sprintf("Bearer %s", admin.AccessToken)).
+		Expect(s.T()).
+		Status(http.StatusNoContent).
+		End()
+
+	s.apiTest("TestForceLogoutSuccess").
+		Get("/user").
+		Header("Authorization", fmt.Sprintf("Bearer %s", member.AccessToken)).
+		Expect(s.T()).
+		Status(http.StatusUnauthorized).
+		End()
+}
+
+func TestAdminIntegrationTest(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode")
+	}
+	suite.Run(t, new(AdminIntegrationTestSuite))
+}
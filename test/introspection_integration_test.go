@@ -0,0 +1,144 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	app "github.com/org39/webapp-tutorial-backend/app/server"
+
+	"github.com/labstack/echo/v4"
+	"github.com/org39/webapp-tutorial-backend/pkg/testreport"
+	"github.com/steinfletcher/apitest"
+	jpassert "github.com/steinfletcher/apitest-jsonpath"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type IntrospectionIntegrationTestSuite struct {
+	suite.Suite
+
+	Application       *app.App
+	Server            *echo.Echo
+	TestSuiteReporter *testreport.TestSuiteReporter
+}
+
+func (s *IntrospectionIntegrationTestSuite) SetupSuite() {
+	reporter := testreport.New("IntrospectionIntegrationTest", "./report")
+	application, server, err := buildTestServer()
+	if err != nil {
+		assert.Fail(s.T(), fmt.Sprintf("fail to create test Server: %s", err))
+	}
+
+	s.Application = application
+	s.Server = server
+	s.TestSuiteReporter = reporter
+}
+
+func (s *IntrospectionIntegrationTestSuite) SetupTest() {
+	tables := []string{
+		s.Application.Config.UserTable,
+		s.Application.Config.AuthRefreshTokenTable,
+		s.Application.Config.AuthTokenGenerationTable,
+		s.Application.Config.AuthSessionTable,
+	}
+
+	for _, table := range tables {
+		_, err := s.Application.DB.Exec(context.Background(), fmt.Sprintf("TRUNCATE %s", table))
+		if err != nil {
+			assert.Fail(s.T(), fmt.Sprintf("fail to truncate %s table: %s", table, err))
+		}
+	}
+}
+
+func (s *IntrospectionIntegrationTestSuite) TearDownSuite() {
+	s.Application.DB.Close()
+	s.TestSuiteReporter.Flush()
+}
+
+func (s *IntrospectionIntegrationTestSuite) apiTest(name string) *apitest.APITest {
+	return apitest.New(name).
+		Recorder(recorder).
+		Report(s.TestSuiteReporter).
+		Handler(s.Server)
+}
+
+func (s *IntrospectionIntegrationTestSuite) TestIntrospectSuccess() {
+	account := createTestAccount(s.T(), s.apiTest("TestIntrospectSuccess"))
+
+	s.apiTest("TestIntrospectSuccess").
+		Post("/oauth/introspect").
+		BasicAuth(testIntrospectionClientID, testIntrospectionClientSecret).
+		FormData("token", account.AccessToken).
+		Expect(s.T()).
+		Header("Cache-Control", "no-store").
+		Assert(jpassert.Equal("$.active", true)).
+		Assert(jpassert.Present("$.sub")).
+		Assert(jpassert.Equal("$.token_type", "Bearer")).
+		Assert(jpassert.Present("$.scope")).
+		Assert(jpassert.Present("$.exp")).
+		Status(http.StatusOK).
+		End()
+
+	// clients may send their credentials in the body too
+	s.apiTest("TestIntrospectSuccess").
+		Post("/oauth/introspect").
+		FormData("token", account.AccessToken).
+		FormData("client_id", testIntrospectionClientID).
+		FormData("client_secret", testIntrospectionClientSecret).
+		Expect(s.T()).
+		Assert(jpassert.Equal("$.active", true)).
+		Status(http.StatusOK).
+		End()
+}
+
+func (s *IntrospectionIntegrationTestSuite) TestIntrospectAfterLogoutAll() {
+	account := createTestAccount(s.T(), s.apiTest("TestIntrospectAfterLogoutAll"))
+
+	s.apiTest("TestIntrospectAfterLogoutAll").
+		Post("/user/logout-all").
+		Header("Authorization", fmt.Sprintf("Bearer %s", account.AccessToken)).
+		Expect(s.T()).
+		Status(http.StatusNoContent).
+		End()
+
+	// assert, revoked tokens are inactive, and nothing else is told
+	s.apiTest("TestIntrospectAfterLogoutAll").
+		Post("/oauth/introspect").
+		BasicAuth(testIntrospectionClientID, testIntrospectionClientSecret).
+		FormData("token", account.AccessToken).
+		Expect(s.T()).
+		Body(`{"active":false}`).
+		Status(http.StatusOK).
+		End()
+}
+
+func (s *IntrospectionIntegrationTestSuite) TestIntrospectWithInvalidClient() {
+	account := createTestAccount(s.T(), s.apiTest("TestIntrospectWithInvalidClient"))
+
+	s.apiTest("TestIntrospectWithInvalidClient").
+		Post("/oauth/introspect").
+		BasicAuth(testIntrospectionClientID, "wrong-secret").
+		FormData("token", account.AccessToken).
+		Expect(s.T()).
+		Header("WWW-Authenticate", `Basic realm="introspection"`).
+		Status(http.StatusUnauthorized).
+		End()
+
+	// a user token is not a client credential
+	s.apiTest("TestIntrospectWithInvalidClient").
+		Post("/oauth/introspect").
+		Header("Authorization", fmt.Sprintf("Bearer %s", account.AccessToken)).
+		FormData("token", account.AccessToken).
+		Expect(s.T()).
+		Status(http.StatusUnauthorized).
+		End()
+}
+
+func TestIntrospectionIntegrationTest(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode")
+	}
+	suite.Run(t, new(IntrospectionIntegrationTestSuite))
+}
@@ -0,0 +1,320 @@
+package test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	app "github.com/org39/webapp-tutorial-backend/app/server"
+	"github.com/org39/webapp-tutorial-backend/pkg/jwk"
+	"github.com/org39/webapp-tutorial-backend/pkg/oidc"
+	"github.com/org39/webapp-tutorial-backend/pkg/testreport"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/labstack/echo/v4"
+	"github.com/steinfletcher/apitest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+const (
+	mockOAuthProvider = "mock"
+	mockClientID      = "webapp"
+	mockClientSecret  = "webapp-secret"
+)
+
+// mockIssuer is an OpenID Connect provider issuing id tokens for the codes it is told about
+type mockIssuer struct {
+	Server *httptest.Server
+	Key    *jwk.Key
+
+	mu    sync.Mutex
+	codes map[string]mockGrant
+}
+
+type mockGrant struct {
+	Challenge string
+	Nonce     string
+	Subject   string
+	Email     string
+}
+
+func newMockIssuer() (*mockIssuer, error) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := jwk.NewPrivateKey("mock-key", rsaKey)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &mockIssuer{Key: key, codes: map[string]mockGrant{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", m.discovery)
+	mux.HandleFunc("/jwks", m.jwks)
+	mux.HandleFunc("/token", m.token)
+	m.Server = httptest.NewServer(mux)
+
+	return m, nil
+}
+
+// Authorize plays the user logging in at the provider, it returns the code of the redirect.
+func (m *mockIssuer) Authorize(authURL string, subject string, email string) (string, string, error) {
+	u, err := url.Parse(authURL)
+	if err != nil {
+		return "", "", err
+	}
+
+	q := u.Query()
+	if q.Get("code_challenge_method") != "S256" {
+		return "", "", fmt.Errorf("unexpected code challenge method %s", q.Get("code_challenge_method"))
+	}
+
+	code := fmt.Sprintf("code-%d", time.Now().UnixNano())
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.codes[code] = mockGrant{
+		Challenge: q.Get("code_challenge"),
+		Nonce:     q.Get("nonce"),
+		Subject:   subject,
+		Email:     email,
+	}
+
+	return code, q.Get("state"), nil
+}
+
+func (m *mockIssuer) discovery(w http.ResponseWriter, r *http.Request) {
+	m.writeJSON(w, http.StatusOK, &oidc.Discovery{
+		Issuer:                m.Server.URL,
+		AuthorizationEndpoint: m.Server.URL + "/authorize",
+		TokenEndpoint:         m.Server.URL + "/token",
+		JWKSURI:               m.Server.URL + "/jwks",
+	})
+}
+
+func (m *mockIssuer) jwks(w http.ResponseWriter, r *http.Request) {
+	m.writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []*jwk.PublicJWK{m.Key.PublicJWK()},
+	})
+}
+
+func (m *mockIssuer) token(w http.ResponseWriter, r *http.Request) {
+	clientID, clientSecret, ok := r.BasicAuth()
+	if !ok || clientID != mockClientID || clientSecret != mockClientSecret {
+		m.writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	// codes are single use
+	m.mu.Lock()
+	grant, ok := m.codes[r.PostFormValue("code")]
+	delete(m.codes, r.PostFormValue("code"))
+	m.mu.Unlock()
+
+	if !ok || oidc.CodeChallenge(r.PostFormValue("code_verifier")) != grant.Challenge {
+		m.writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	now := time.Now()
+	t := jwt.NewWithClaims(m.Key.SigningMethod(), jwt.MapClaims{
+		"iss":            m.Server.URL,
+		"sub":            grant.Subject,
+		"aud":            mockClientID,
+		"exp":            now.Add(5 * time.Minute).Unix(),
+		"iat":            now.Unix(),
+		"nonce":          grant.Nonce,
+		"email":          grant.Email,
+		"email_verified": true,
+	})
+	t.Header["kid"] = m.Key.ID
+
+	idToken, err := t.SignedString(m.Key.PrivateKey)
+	if err != nil {
+		m.writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+
+	m.writeJSON(w, http.StatusOK, map[string]string{
+		"access_token": "mock-access-token",
+		"token_type":   "Bearer",
+		"id_token":     idToken,
+	})
+}
+
+func (m *mockIssuer) writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+type OAuthIntegrationTestSuite struct {
+	suite.Suite
+
+	Application       *app.App
+	Server            *echo.Echo
+	Issuer            *mockIssuer
+	TestSuiteReporter *testreport.TestSuiteReporter
+}
+
+func (s *OAuthIntegrationTestSuite) SetupSuite() {
+	reporter := testreport.New("OAuthIntegrationTest", "./report")
+
+	issuer, err := newMockIssuer()
+	if err != nil {
+		assert.Fail(s.T(), fmt.Sprintf("fail to create mock issuer: %s", err))
+	}
+
+	// register the mock issuer as a provider
+	env := map[string]string{
+		"USER_OAUTH_ISSUERS":        mockOAuthProvider + ":" + issuer.Server.URL,
+		"USER_OAUTH_CLIENT_IDS":     mockOAuthProvider + ":" + mockClientID,
+		"USER_OAUTH_CLIENT_SECRETS": mockOAuthProvider + ":" + mockClientSecret,
+	}
+	for k, v := range env {
+		if err := os.Setenv(k, v); err != nil {
+			assert.Fail(s.T(), fmt.Sprintf("fail to set %s: %s", k, err))
+		}
+	}
+
+	application, server, err := buildTestServer()
+	if err != nil {
+		assert.Fail(s.T(), fmt.Sprintf("fail to create test Server: %s", err))
+	}
+
+	s.Application = application
+	s.Server = server
+	s.Issuer = issuer
+	s.TestSuiteReporter = reporter
+}
+
+func (s *OAuthIntegrationTestSuite) SetupTest() {
+	for _, table := range []string{
+		s.Application.Config.UserTable,
+		s.Application.Config.UserTokenTable,
+		s.Application.Config.UserIdentityTable,
+		s.Application.Config.AuthRefreshTokenTable,
+		s.Application.Config.AuthTokenGenerationTable,
+		s.Application.Config.AuthSessionTable,
+	} {
+		_, err := s.Application.DB.Exec(context.Background(), fmt.Sprintf("TRUNCATE %s", table))
+		if err != nil {
+			assert.Fail(s.T(), fmt.Sprintf("fail to truncate %s table: %s", table, err))
+		}
+	}
+}
+
+func (s *OAuthIntegrationTestSuite) TearDownSuite() {
+	for _, k := range []string{"USER_OAUTH_ISSUERS", "USER_OAUTH_CLIENT_IDS", "USER_OAUTH_CLIENT_SECRETS"} {
+		os.Unsetenv(k)
+	}
+
+	s.Issuer.Server.Close()
+	s.Application.DB.Close()
+	s.TestSuiteReporter.Flush()
+}
+
+func (s *OAuthIntegrationTestSuite) apiTest(name string) *apitest.APITest {
+	return apitest.New(name).
+		Recorder(recorder).
+		Report(s.TestSuiteReporter).
+		Handler(s.Server)
+}
+
+// login runs the flow up to the callback, as the user agent would
+func (s *OAuthIntegrationTestSuite) login(name string, subject string, email string) *http.Response {
+	startResp := s.apiTest(name).
+		Get(fmt.Sprintf("/user/oauth/%s/start", mockOAuthProvider)).
+		Expect(s.T()).
+		CookiePresent("oauth_flow").
+		Status(http.StatusFound).
+		End().Response
+	flowCookie := findCookieByName(startResp.Cookies(), "oauth_flow")
+
+	code, state, err := s.Issuer.Authorize(startResp.Header.Get("Location"), subject, email)
+	assert.NoError(s.T(), err)
+
+	return s.apiTest(name).
+		Get(fmt.Sprintf("/user/oauth/%s/callback", mockOAuthProvider)).
+		Query("code", code).
+		Query("state", state).
+		Cookie("oauth_flow", flowCookie.Value).
+		Expect(s.T()).
+		Status(http.StatusFound).
+		End().Response
+}
+
+func (s *OAuthIntegrationTestSuite) TestOAuthLoginSignUpSuccess() {
+	resp := s.login("TestOAuthLoginSignUpSuccess", "mock-user-1", "rin@kagamine.com")
+	assert.Equal(s.T(), s.Application.Config.RestOAuthRedirectURL, resp.Header.Get("Location"))
+	refreshTokenCookie := findCookieByName(resp.Cookies(), "refresh_token")
+	assert.NotNil(s.T(), refreshTokenCookie)
+	csrfTokenCookie := findCookieByName(resp.Cookies(), "csrf_token")
+	assert.NotNil(s.T(), csrfTokenCookie)
+
+	// the refresh token works like one of a password login
+	s.apiTest("TestOAuthLoginSignUpSuccess").
+		Post("/user/refresh").
+		Cookie("refresh_token", refreshTokenCookie.Value).
+		Cookie("csrf_token", csrfTokenCookie.Value).
+		Header("X-CSRF-Token", csrfTokenCookie.Value).
+		Expect(s.T()).
+		CookiePresent("refresh_token").
+		Status(http.StatusOK).
+		End()
+
+	// the second login uses the linked identity
+	resp = s.login("TestOAuthLoginSignUpSuccess", "mock-user-1", "rin@kagamine.com")
+	assert.Equal(s.T(), s.Application.Config.RestOAuthRedirectURL, resp.Header.Get("Location"))
+	assert.NotNil(s.T(), findCookieByName(resp.Cookies(), "refresh_token"))
+}
+
+func (s *OAuthIntegrationTestSuite) TestOAuthLoginStateMismatch() {
+	startResp := s.apiTest("TestOAuthLoginStateMismatch").
+		Get(fmt.Sprintf("/user/oauth/%s/start", mockOAuthProvider)).
+		Expect(s.T()).
+		Status(http.StatusFound).
+		End().Response
+	flowCookie := findCookieByName(startResp.Cookies(), "oauth_flow")
+
+	code, _, err := s.Issuer.Authorize(startResp.Header.Get("Location"), "mock-user-2", "len@kagamine.com")
+	assert.NoError(s.T(), err)
+
+	resp := s.apiTest("TestOAuthLoginStateMismatch").
+		Get(fmt.Sprintf("/user/oauth/%s/callback", mockOAuthProvider)).
+		Query("code", code).
+		Query("state", "forged-state").
+		Cookie("oauth_flow", flowCookie.Value).
+		Expect(s.T()).
+		Status(http.StatusFound).
+		End().Response
+
+	assert.Equal(s.T(), s.Application.Config.RestOAuthRedirectURL+"#error=unauthorized", resp.Header.Get("Location"))
+	assert.Nil(s.T(), findCookieByName(resp.Cookies(), "refresh_token"))
+}
+
+func (s *OAuthIntegrationTestSuite) TestOAuthStartUnknownProvider() {
+	s.apiTest("TestOAuthStartUnknownProvider").
+		Get("/user/oauth/unknown/start").
+		Expect(s.T()).
+		Status(http.StatusNotFound).
+		End()
+}
+
+func TestOAuthIntegrationTest(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping test in short mode")
+	}
+	suite.Run(t, new(OAuthIntegrationTestSuite))
+}
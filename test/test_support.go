@@ -5,10 +5,16 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"net/url"
+	"os"
+	"regexp"
 	"testing"
 	"time"
 
 	app "github.com/org39/webapp-tutorial-backend/app/server"
+	"github.com/org39/webapp-tutorial-backend/pkg/blob"
+	"github.com/org39/webapp-tutorial-backend/pkg/crypt"
+	"github.com/org39/webapp-tutorial-backend/pkg/mail"
 	"github.com/org39/webapp-tutorial-backend/presenter/rest"
 
 	"github.com/go-sql-driver/mysql"
@@ -30,6 +36,21 @@ func buildTestServer() (*app.App, *echo.Echo, error) {
 	// clear dependency graph
 	app.ClearDepencencyGraph()
 
+	// keep mails in memory, so tests can read tokens sent to users
+	if err := os.Setenv("MAIL_DRIVER", mail.DriverMemory); err != nil {
+		return nil, nil, err
+	}
+
+	// keep uploaded files in memory
+	if err := os.Setenv("BLOB_DRIVER", blob.DriverMemory); err != nil {
+		return nil, nil, err
+	}
+
+	// services allowed to introspect tokens
+	if err := os.Setenv("AUTH_INTROSPECTION_CLIENTS", fmt.Sprintf("%s:%s", testIntrospectionClientID, crypt.HashToken(testIntrospectionClientSecret))); err != nil {
+		return nil, nil, err
+	}
+
 	// build application
 	application, err := app.New(newRecorededMysqlConn)
 	if err != nil {
@@ -86,6 +107,34 @@ func findCookieByName(cookies []*http.Cookie, name string) *http.Cookie {
 	return nil
 }
 
+// tokenFromMail extracts the token of the link in the latest mail sent to the address.
+func tokenFromMail(t *testing.T, application *app.App, to string) string {
+	mailer, ok := application.Mailer.(*mail.MemoryMailer)
+	if !ok {
+		assert.Fail(t, "mailer is not a memory mailer")
+		return ""
+	}
+
+	msg := mailer.Last(to)
+	if msg == nil {
+		assert.Fail(t, fmt.Sprintf("no mail sent to %s", to))
+		return ""
+	}
+
+	link, err := url.Parse(regexp.MustCompile(`https?://\S+`).FindString(msg.Body))
+	if err != nil {
+		assert.Fail(t, fmt.Sprintf("fail to parse link: %s", err))
+		return ""
+	}
+
+	return link.Query().Get("token")
+}
+
+const (
+	testIntrospectionClientID     = "todo-service"
+	testIntrospectionClientSecret = "client-secret"
+)
+
 type User struct {
 	ID    string `json:"id"`
 	Email string `json:"email"`
@@ -95,6 +144,7 @@ type Account struct {
 	Password     string
 	AccessToken  string `json:"access_token"`
 	RefreshToken string
+	CSRFToken    string
 }
 
 func createTestAccount(t *testing.T, apiTest *apitest.APITest) Account {
@@ -126,6 +176,11 @@ func createTestAccount(t *testing.T, apiTest *apitest.APITest) Account {
 	assert.NotNil(t, refreshTokenCookie)
 	account.RefreshToken = refreshTokenCookie.Value
 
+	// fetch csrfToken, sent back with the refresh token
+	csrfTokenCookie := findCookieByName(loginRespCookies, "csrf_token")
+	assert.NotNil(t, csrfTokenCookie)
+	account.CSRFToken = csrfTokenCookie.Value
+
 	return account
 }
 
@@ -155,3 +210,27 @@ func createTestTodo(t *testing.T, apiTest *apitest.APITest, account Account, con
 
 	return todo
 }
+
+type Tag struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Color string `json:"color"`
+}
+
+func createTestTag(t *testing.T, apiTest *apitest.APITest, account Account, name string) Tag {
+	res := apiTest.Post("/tags").
+		JSON(map[string]string{
+			"name": name,
+		}).
+		Header("Authorization", fmt.Sprintf("Bearer %s", account.AccessToken)).
+		Expect(t).
+		Assert(jpassert.Equal("$.name", name)).
+		Status(http.StatusCreated).
+		End()
+
+	// fetch newly created tag from response body
+	tag := Tag{}
+	res.JSON(&tag)
+
+	return tag
+}
@@ -0,0 +1,15 @@
+CREATE DATABASE IF NOT EXISTS todo_tutorial;
+
+CREATE TABLE IF NOT EXISTS todo_tutorial.refresh_tokens (
+	id VARCHAR(36) NOT NULL,
+	family_id VARCHAR(36) NOT NULL,
+	user_id VARCHAR(36) NOT NULL,
+	rotated BOOLEAN NOT NULL,
+	revoked BOOLEAN NOT NULL,
+	expires_at TIMESTAMP NOT NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (id)
+);
+
+CREATE INDEX idx_refresh_token_family_id ON todo_tutorial.refresh_tokens(family_id);
+CREATE INDEX idx_refresh_token_user_id ON todo_tutorial.refresh_tokens(user_id);
@@ -0,0 +1,7 @@
+CREATE DATABASE IF NOT EXISTS todo_tutorial;
+
+CREATE TABLE IF NOT EXISTS todo_tutorial.token_generations (
+	user_id VARCHAR(36) NOT NULL,
+	generation BIGINT NOT NULL,
+	PRIMARY KEY (user_id)
+);
@@ -0,0 +1,15 @@
+CREATE DATABASE IF NOT EXISTS todo_tutorial;
+
+CREATE TABLE IF NOT EXISTS todo_tutorial.user_tokens (
+	id VARCHAR(36) NOT NULL,
+	user_id VARCHAR(36) NOT NULL,
+	purpose VARCHAR(32) NOT NULL,
+	token_hash CHAR(64) NOT NULL,
+	used BOOLEAN NOT NULL,
+	expires_at TIMESTAMP NOT NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (id),
+	UNIQUE KEY uniq_user_token_hash (token_hash)
+);
+
+CREATE INDEX idx_user_token_user_id ON todo_tutorial.user_tokens(user_id, purpose);
@@ -0,0 +1 @@
+ALTER TABLE todo_tutorial.users ADD COLUMN verified_at TIMESTAMP NULL DEFAULT NULL AFTER password;
@@ -0,0 +1,10 @@
+CREATE DATABASE IF NOT EXISTS todo_tutorial;
+
+CREATE TABLE IF NOT EXISTS todo_tutorial.user_mfa (
+	user_id VARCHAR(36) NOT NULL,
+	secret VARCHAR(64) NOT NULL,
+	enabled BOOLEAN NOT NULL,
+	last_used_step BIGINT NOT NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (user_id)
+);
@@ -0,0 +1,16 @@
+CREATE DATABASE IF NOT EXISTS todo_tutorial;
+
+CREATE TABLE IF NOT EXISTS todo_tutorial.personal_access_tokens (
+	id VARCHAR(36) NOT NULL,
+	user_id VARCHAR(36) NOT NULL,
+	name VARCHAR(64) NOT NULL,
+	scopes VARCHAR(255) NOT NULL,
+	token_hash CHAR(64) NOT NULL,
+	last_used_at TIMESTAMP NULL DEFAULT NULL,
+	expires_at TIMESTAMP NULL DEFAULT NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (id),
+	UNIQUE KEY uniq_personal_access_token_hash (token_hash)
+);
+
+CREATE INDEX idx_personal_access_token_user_id ON todo_tutorial.personal_access_tokens(user_id);
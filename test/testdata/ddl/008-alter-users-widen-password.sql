@@ -0,0 +1 @@
+ALTER TABLE todo_tutorial.users MODIFY COLUMN password VARCHAR(255) NOT NULL;
@@ -0,0 +1,14 @@
+CREATE DATABASE IF NOT EXISTS todo_tutorial;
+
+CREATE TABLE IF NOT EXISTS todo_tutorial.user_identities (
+	id VARCHAR(36) NOT NULL,
+	user_id VARCHAR(36) NOT NULL,
+	provider VARCHAR(32) NOT NULL,
+	subject VARCHAR(255) NOT NULL,
+	email VARCHAR(256) NOT NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (id),
+	UNIQUE KEY uniq_user_identity_subject (provider, subject)
+);
+
+CREATE INDEX idx_user_identity_user_id ON todo_tutorial.user_identities(user_id);
@@ -0,0 +1,16 @@
+CREATE DATABASE IF NOT EXISTS todo_tutorial;
+
+CREATE TABLE IF NOT EXISTS todo_tutorial.sessions (
+	id VARCHAR(36) NOT NULL,
+	user_id VARCHAR(36) NOT NULL,
+	label VARCHAR(64) NOT NULL,
+	user_agent VARCHAR(255) NOT NULL,
+	ip VARCHAR(45) NOT NULL,
+	revoked BOOLEAN NOT NULL,
+	last_seen_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	expires_at TIMESTAMP NOT NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (id)
+);
+
+CREATE INDEX idx_session_user_id ON todo_tutorial.sessions(user_id);
@@ -0,0 +1,2 @@
+ALTER TABLE todo_tutorial.users ADD COLUMN roles VARCHAR(255) NOT NULL DEFAULT '' AFTER password;
+ALTER TABLE todo_tutorial.users ADD COLUMN disabled_at TIMESTAMP NULL DEFAULT NULL AFTER verified_at;
@@ -0,0 +1,12 @@
+CREATE DATABASE IF NOT EXISTS todo_tutorial;
+
+CREATE TABLE IF NOT EXISTS todo_tutorial.user_profiles (
+	user_id VARCHAR(36) NOT NULL,
+	display_name VARCHAR(64) NOT NULL,
+	time_zone VARCHAR(64) NOT NULL,
+	locale VARCHAR(35) NOT NULL,
+	avatar_id VARCHAR(36) NOT NULL,
+	preferences JSON NOT NULL,
+	updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (user_id)
+);
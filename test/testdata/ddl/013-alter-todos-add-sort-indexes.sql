@@ -0,0 +1,2 @@
+CREATE INDEX idx_user_id_created_at ON todo_tutorial.todos(user_id, created_at, id);
+CREATE INDEX idx_user_id_updated_at ON todo_tutorial.todos(user_id, updated_at, id);
@@ -0,0 +1 @@
+CREATE FULLTEXT INDEX ft_content ON todo_tutorial.todos(content);
@@ -0,0 +1,24 @@
+CREATE DATABASE IF NOT EXISTS todo_tutorial;
+
+CREATE TABLE IF NOT EXISTS todo_tutorial.tags (
+	id VARCHAR(36) NOT NULL,
+	user_id VARCHAR(36) NOT NULL,
+	name VARCHAR(64) NOT NULL,
+	color VARCHAR(7) NOT NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (id)
+);
+
+CREATE UNIQUE INDEX idx_tag_user_id_name ON todo_tutorial.tags(user_id, name);
+
+CREATE TABLE IF NOT EXISTS todo_tutorial.todo_tags (
+	todo_id VARCHAR(36) NOT NULL,
+	tag_id VARCHAR(36) NOT NULL,
+	user_id VARCHAR(36) NOT NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (todo_id, tag_id)
+);
+
+CREATE INDEX idx_todo_tag_tag_id ON todo_tutorial.todo_tags(tag_id);
+CREATE INDEX idx_todo_tag_user_id ON todo_tutorial.todo_tags(user_id);
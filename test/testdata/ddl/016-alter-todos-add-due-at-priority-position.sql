@@ -0,0 +1,6 @@
+ALTER TABLE todo_tutorial.todos ADD COLUMN due_at TIMESTAMP NULL DEFAULT NULL AFTER deleted;
+ALTER TABLE todo_tutorial.todos ADD COLUMN priority TINYINT NOT NULL DEFAULT 0 AFTER due_at;
+ALTER TABLE todo_tutorial.todos ADD COLUMN position INT NOT NULL DEFAULT 0 AFTER priority;
+CREATE INDEX idx_user_id_due_at ON todo_tutorial.todos(user_id, due_at, id);
+CREATE INDEX idx_user_id_priority ON todo_tutorial.todos(user_id, priority, id);
+CREATE INDEX idx_user_id_position ON todo_tutorial.todos(user_id, position, id);
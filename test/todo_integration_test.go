@@ -46,6 +46,16 @@ func (s *TodoIntegrationTestSuite) SetupTest() {
 	if err != nil {
 		assert.Fail(s.T(), fmt.Sprintf("fail to truncate %s table: %s", s.Application.Config.TodoTable, err))
 	}
+
+	_, err = s.Application.DB.Exec(context.Background(), fmt.Sprintf("TRUNCATE %s", s.Application.Config.TagTable))
+	if err != nil {
+		assert.Fail(s.T(), fmt.Sprintf("fail to truncate %s table: %s", s.Application.Config.TagTable, err))
+	}
+
+	_, err = s.Application.DB.Exec(context.Background(), fmt.Sprintf("TRUNCATE %s", s.Application.Config.TodoTagTable))
+	if err != nil {
+		assert.Fail(s.T(), fmt.Sprintf("fail to truncate %s table: %s", s.Application.Config.TodoTagTable, err))
+	}
 }
 
 func (s *TodoIntegrationTestSuite) TearDownSuite() {
@@ -105,14 +115,420 @@ func (s *TodoIntegrationTestSuite) TestGetAllTodosSuccess() {
 		Get("/todos").
 		Header("Authorization", fmt.Sprintf("Bearer %s", account.AccessToken)).
 		Expect(s.T()).
-		Assert(jpassert.Len("$", 1)).
-		Assert(jpassert.Equal("$[0].content", content)).
-		Assert(jpassert.Equal("$[0].completed", false)).
-		Assert(jpassert.Equal("$[0].deleted", false)).
+		Assert(jpassert.Len("$.items", 1)).
+		Assert(jpassert.Equal("$.items[0].content", content)).
+		Assert(jpassert.Equal("$.items[0].completed", false)).
+		Assert(jpassert.Equal("$.items[0].deleted", false)).
+		Status(http.StatusOK).
+		End()
+}
+
+func (s *TodoIntegrationTestSuite) TestGetAllTodosWithFilter() {
+	account := createTestAccount(s.T(), s.apiTest("TestGetAllTodosWithFilter"))
+	_ = createTestTodo(s.T(), s.apiTest("TestGetAllTodosWithFilter"), account, "buy milk")
+	done := createTestTodo(s.T(), s.apiTest("TestGetAllTodosWithFilter"), account, "walk the dog")
+
+	s.apiTest("TestGetAllTodosWithFilter").
+		Put(fmt.Sprintf("/todos/%s", done.ID)).
+		Header("Authorization", fmt.Sprintf("Bearer %s", account.AccessToken)).
+		JSON(map[string]interface{}{
+			"content":   done.Content,
+			"completed": true,
+			"deleted":   false,
+		}).
+		Expect(s.T()).
+		Status(http.StatusOK).
+		End()
+
+	s.apiTest("TestGetAllTodosWithFilter").
+		Get("/todos").
+		Query("status", "completed").
+		Header("Authorization", fmt.Sprintf("Bearer %s", account.AccessToken)).
+		Expect(s.T()).
+		Assert(jpassert.Len("$.items", 1)).
+		Assert(jpassert.Equal("$.items[0].content", "walk the dog")).
+		Status(http.StatusOK).
+		End()
+
+	s.apiTest("TestGetAllTodosWithFilter").
+		Get("/todos").
+		Query("status", "all").
+		Query("content", "milk").
+		Query("created_after", "2021-01-01").
+		Header("Authorization", fmt.Sprintf("Bearer %s", account.AccessToken)).
+		Expect(s.T()).
+		Assert(jpassert.Len("$.items", 1)).
+		Assert(jpassert.Equal("$.items[0].content", "buy milk")).
+		Status(http.StatusOK).
+		End()
+
+	s.apiTest("TestGetAllTodosWithFilter").
+		Get("/todos").
+		Query("deleted", "only").
+		Header("Authorization", fmt.Sprintf("Bearer %s", account.AccessToken)).
+		Expect(s.T()).
+		Assert(jpassert.Len("$.items", 0)).
+		Status(http.StatusOK).
+		End()
+}
+
+func (s *TodoIntegrationTestSuite) TestGetAllTodosPaginated() {
+	account := createTestAccount(s.T(), s.apiTest("TestGetAllTodosPaginated"))
+	for _, content := range []string{"first", "second", "third"} {
+		_ = createTestTodo(s.T(), s.apiTest("TestGetAllTodosPaginated"), account, content)
+	}
+
+	var page struct {
+		Items      []map[string]interface{} `json:"items"`
+		NextCursor string                   `json:"next_cursor"`
+	}
+	result := s.apiTest("TestGetAllTodosPaginated").
+		Get("/todos").
+		Query("limit", "2").
+		Header("Authorization", fmt.Sprintf("Bearer %s", account.AccessToken)).
+		Expect(s.T()).
+		Assert(jpassert.Len("$.items", 2)).
+		Assert(jpassert.Present("$.next_cursor")).
+		Status(http.StatusOK).
+		End()
+	result.JSON(&page)
+
+	// the Link header carries the query of the first page
+	assert.Equal(s.T(), fmt.Sprintf(`</todos?cursor=%s&limit=2>; rel="next"`, page.NextCursor), result.Response.Header.Get("Link"))
+
+	s.apiTest("TestGetAllTodosPaginated").
+		Get("/todos").
+		Query("limit", "2").
+		Query("cursor", page.NextCursor).
+		Header("Authorization", fmt.Sprintf("Bearer %s", account.AccessToken)).
+		Expect(s.T()).
+		Assert(jpassert.Len("$.items", 1)).
+		Assert(jpassert.NotPresent("$.next_cursor")).
+		HeaderNotPresent("Link").
+		Status(http.StatusOK).
+		End()
+}
+
+func (s *TodoIntegrationTestSuite) TestGetAllTodosSorted() {
+	account := createTestAccount(s.T(), s.apiTest("TestGetAllTodosSorted"))
+	for _, content := range []string{"first", "second", "third"} {
+		_ = createTestTodo(s.T(), s.apiTest("TestGetAllTodosSorted"), account, content)
+	}
+
+	var page struct {
+		NextCursor string `json:"next_cursor"`
+	}
+	s.apiTest("TestGetAllTodosSorted").
+		Get("/todos").
+		QueryParams(map[string]string{"sort": "created_at", "order": "desc", "limit": "2"}).
+		Header("Authorization", fmt.Sprintf("Bearer %s", account.AccessToken)).
+		Expect(s.T()).
+		Assert(jpassert.Len("$.items", 2)).
+		Assert(jpassert.Equal("$.items[0].content", "third")).
+		Assert(jpassert.Equal("$.items[1].content", "second")).
+		Status(http.StatusOK).
+		End().
+		JSON(&page)
+
+	s.apiTest("TestGetAllTodosSorted").
+		Get("/todos").
+		QueryParams(map[string]string{"sort": "created_at", "order": "desc", "limit": "2", "cursor": page.NextCursor}).
+		Header("Authorization", fmt.Sprintf("Bearer %s", account.AccessToken)).
+		Expect(s.T()).
+		Assert(jpassert.Len("$.items", 1)).
+		Assert(jpassert.Equal("$.items[0].content", "first")).
+		Status(http.StatusOK).
+		End()
+
+	// the cursor belongs to the descending order
+	s.apiTest("TestGetAllTodosSorted").
+		Get("/todos").
+		QueryParams(map[string]string{"limit": "2", "cursor": page.NextCursor}).
+		Header("Authorization", fmt.Sprintf("Bearer %s", account.AccessToken)).
+		Expect(s.T()).
+		Status(http.StatusBadRequest).
+		End()
+}
+
+func (s *TodoIntegrationTestSuite) TestGetAllTodosSortedByPriorityAndDueDate() {
+	account := createTestAccount(s.T(), s.apiTest("TestGetAllTodosSortedByPriorityAndDueDate"))
+	todos := []map[string]interface{}{
+		{"content": "someday", "priority": 1},
+		{"content": "tomorrow", "priority": 3, "due_at": "2021-05-02T09:00:00Z"},
+		{"content": "today", "priority": 2, "due_at": "2021-05-01T09:00:00Z"},
+	}
+	for _, todo := range todos {
+		s.apiTest("TestGetAllTodosSortedByPriorityAndDueDate").
+			Post("/todos").
+			JSON(todo).
+			Header("Authorization", fmt.Sprintf("Bearer %s", account.AccessToken)).
+			Expect(s.T()).
+			Assert(jpassert.Equal("$.content", todo["content"])).
+			Status(http.StatusCreated).
+			End()
+	}
+
+	s.apiTest("TestGetAllTodosSortedByPriorityAndDueDate").
+		Get("/todos").
+		QueryParams(map[string]string{"sort": "priority", "order": "desc"}).
+		Header("Authorization", fmt.Sprintf("Bearer %s", account.AccessToken)).
+		Expect(s.T()).
+		Assert(jpassert.Equal("$.items[0].content", "tomorrow")).
+		Assert(jpassert.Equal("$.items[1].content", "today")).
+		Assert(jpassert.Equal("$.items[2].content", "someday")).
+		Status(http.StatusOK).
+		End()
+
+	// todos without a due date come first
+	var page struct {
+		NextCursor string `json:"next_cursor"`
+	}
+	s.apiTest("TestGetAllTodosSortedByPriorityAndDueDate").
+		Get("/todos").
+		QueryParams(map[string]string{"sort": "due_at", "limit": "1"}).
+		Header("Authorization", fmt.Sprintf("Bearer %s", account.AccessToken)).
+		Expect(s.T()).
+		Assert(jpassert.Equal("$.items[0].content", "someday")).
+		Assert(jpassert.Equal("$.items[0].due_at", nil)).
+		Status(http.StatusOK).
+		End().
+		JSON(&page)
+
+	s.apiTest("TestGetAllTodosSortedByPriorityAndDueDate").
+		Get("/todos").
+		QueryParams(map[string]string{"sort": "due_at", "cursor": page.NextCursor}).
+		Header("Authorization", fmt.Sprintf("Bearer %s", account.AccessToken)).
+		Expect(s.T()).
+		Assert(jpassert.Len("$.items", 2)).
+		Assert(jpassert.Equal("$.items[0].content", "today")).
+		Assert(jpassert.Equal("$.items[1].content", "tomorrow")).
 		Status(http.StatusOK).
 		End()
 }
 
+func (s *TodoIntegrationTestSuite) TestCreateTagSuccess() {
+	account := createTestAccount(s.T(), s.apiTest("TestCreateTagSuccess"))
+	home := createTestTag(s.T(), s.apiTest("TestCreateTagSuccess"), account, "home")
+
+	s.apiTest("TestCreateTagSuccess").
+		Post("/tags").
+		JSON(map[string]string{"name": "Work", "color": "#FF9800"}).
+		Header("Authorization", fmt.Sprintf("Bearer %s", account.AccessToken)).
+		Expect(s.T()).
+		Assert(jpassert.Equal("$.name", "Work")).
+		Assert(jpassert.Equal("$.color", "#ff9800")).
+		Status(http.StatusCreated).
+		End()
+
+	// names are unique regardless of case
+	s.apiTest("TestCreateTagSuccess").
+		Post("/tags").
+		JSON(map[string]string{"name": "HOME"}).
+		Header("Authorization", fmt.Sprintf("Bearer %s", account.AccessToken)).
+		Expect(s.T()).
+		Status(http.StatusBadRequest).
+		End()
+
+	s.apiTest("TestCreateTagSuccess").
+		Get("/tags").
+		Header("Authorization", fmt.Sprintf("Bearer %s", account.AccessToken)).
+		Expect(s.T()).
+		Assert(jpassert.Len("$", 2)).
+		Assert(jpassert.Equal("$[0].id", home.ID)).
+		Assert(jpassert.Equal("$[0].color", "#9e9e9e")).
+		Status(http.StatusOK).
+		End()
+}
+
+func (s *TodoIntegrationTestSuite) TestUpdateTagSuccess() {
+	account := createTestAccount(s.T(), s.apiTest("TestUpdateTagSuccess"))
+	tag := createTestTag(s.T(), s.apiTest("TestUpdateTagSuccess"), account, "home")
+
+	s.apiTest("TestUpdateTagSuccess").
+		Patch(fmt.Sprintf("/tags/%s", tag.ID)).
+		JSON(map[string]string{"color": "#4caf50"}).
+		Header("Authorization", fmt.Sprintf("Bearer %s", account.AccessToken)).
+		Expect(s.T()).
+		Assert(jpassert.Equal("$.name", "home")).
+		Assert(jpassert.Equal("$.color", "#4caf50")).
+		Status(http.StatusOK).
+		End()
+
+	s.apiTest("TestUpdateTagSuccess").
+		Patch(fmt.Sprintf("/tags/%s", tag.ID)).
+		JSON(map[string]string{"color": "green"}).
+		Header("Authorization", fmt.Sprintf("Bearer %s", account.AccessToken)).
+		Expect(s.T()).
+		Status(http.StatusBadRequest).
+		End()
+}
+
+func (s *TodoIntegrationTestSuite) TestTagTodos() {
+	account := createTestAccount(s.T(), s.apiTest("TestTagTodos"))
+	home := createTestTag(s.T(), s.apiTest("TestTagTodos"), account, "home")
+	urgent := createTestTag(s.T(), s.apiTest("TestTagTodos"), account, "urgent")
+	milk := createTestTodo(s.T(), s.apiTest("TestTagTodos"), account, "buy milk")
+	bread := createTestTodo(s.T(), s.apiTest("TestTagTodos"), account, "buy bread")
+	_ = createTestTodo(s.T(), s.apiTest("TestTagTodos"), account, "call grandma")
+
+	tags := map[string][]Tag{milk.ID: {home, urgent}, bread.ID: {home}}
+	for todoID, todoTags := range tags {
+		for _, tag := range todoTags {
+			s.apiTest("TestTagTodos").
+				Put(fmt.Sprintf("/todos/%s/tags/%s", todoID, tag.ID)).
+				Header("Authorization", fmt.Sprintf("Bearer %s", account.AccessToken)).
+				Expect(s.T()).
+				Status(http.StatusOK).
+				End()
+		}
+	}
+
+	// tagging twice changes nothing, tags are by name
+	s.apiTest("TestTagTodos").
+		Put(fmt.Sprintf("/todos/%s/tags/%s", milk.ID, home.ID)).
+		Header("Authorization", fmt.Sprintf("Bearer %s", account.AccessToken)).
+		Expect(s.T()).
+		Assert(jpassert.Len("$.tags", 2)).
+		Assert(jpassert.Equal("$.tags[0].name", "home")).
+		Assert(jpassert.Equal("$.tags[1].name", "urgent")).
+		Status(http.StatusOK).
+		End()
+
+	s.apiTest("TestTagTodos").
+		Get("/todos").
+		Query("tags", fmt.Sprintf("%s,%s", home.ID, urgent.ID)).
+		Header("Authorization", fmt.Sprintf("Bearer %s", account.AccessToken)).
+		Expect(s.T()).
+		Assert(jpassert.Len("$.items", 2)).
+		Status(http.StatusOK).
+		End()
+
+	s.apiTest("TestTagTodos").
+		Get("/todos").
+		Query("tags", fmt.Sprintf("%s,%s", home.ID, urgent.ID)).
+		Query("tag_match", "all").
+		Header("Authorization", fmt.Sprintf("Bearer %s", account.AccessToken)).
+		Expect(s.T()).
+		Assert(jpassert.Len("$.items", 1)).
+		Assert(jpassert.Equal("$.items[0].id", milk.ID)).
+		Status(http.StatusOK).
+		End()
+
+	s.apiTest("TestTagTodos").
+		Delete(fmt.Sprintf("/todos/%s/tags/%s", milk.ID, urgent.ID)).
+		Header("Authorization", fmt.Sprintf("Bearer %s", account.AccessToken)).
+		Expect(s.T()).
+		Assert(jpassert.Len("$.tags", 1)).
+		Status(http.StatusOK).
+		End()
+
+	// deleting a tag removes it from its todos
+	s.apiTest("TestTagTodos").
+		Delete(fmt.Sprintf("/tags/%s", home.ID)).
+		Header("Authorization", fmt.Sprintf("Bearer %s", account.AccessToken)).
+		Expect(s.T()).
+		Status(http.StatusOK).
+		End()
+
+	s.apiTest("TestTagTodos").
+		Get(fmt.Sprintf("/todos/%s", bread.ID)).
+		Header("Authorization", fmt.Sprintf("Bearer %s", account.AccessToken)).
+		Expect(s.T()).
+		Assert(jpassert.Len("$.tags", 0)).
+		Status(http.StatusOK).
+		End()
+
+	s.apiTest("TestTagTodos").
+		Get(fmt.Sprintf("/tags/%s", home.ID)).
+		Header("Authorization", fmt.Sprintf("Bearer %s", account.AccessToken)).
+		Expect(s.T()).
+		Status(http.StatusNotFound).
+		End()
+}
+
+func (s *TodoIntegrationTestSuite) TestGetAllTodosWithInvalidFilter() {
+	account := createTestAccount(s.T(), s.apiTest("TestGetAllTodosWithInvalidFilter"))
+
+	queries := []map[string]string{
+		{"status": "done"},
+		{"deleted": "yes"},
+		{"created_after": "yesterday"},
+		{"updated_after": "2021-06-01", "updated_before": "2021-05-01"},
+		{"limit": "0"},
+		{"limit": "101"},
+		{"cursor": "not-a-cursor"},
+		{"sort": "content"},
+		{"order": "random"},
+		{"tags": "home"},
+		{"tag_match": "most"},
+	}
+	for _, q := range queries {
+		s.apiTest("TestGetAllTodosWithInvalidFilter").
+			Get("/todos").
+			QueryParams(q).
+			Header("Authorization", fmt.Sprintf("Bearer %s", account.AccessToken)).
+			Expect(s.T()).
+			Status(http.StatusBadRequest).
+			End()
+	}
+}
+
+func (s *TodoIntegrationTestSuite) TestSearchTodos() {
+	account := createTestAccount(s.T(), s.apiTest("TestSearchTodos"))
+	milk := createTestTodo(s.T(), s.apiTest("TestSearchTodos"), account, "buy milk and <bread>")
+	_ = createTestTodo(s.T(), s.apiTest("TestSearchTodos"), account, "call grandma")
+
+	s.apiTest("TestSearchTodos").
+		Get("/todos/search").
+		Query("q", "Bread").
+		Header("Authorization", fmt.Sprintf("Bearer %s", account.AccessToken)).
+		Expect(s.T()).
+		Assert(jpassert.Len("$.items", 1)).
+		Assert(jpassert.Equal("$.items[0].id", milk.ID)).
+		Assert(jpassert.Equal("$.items[0].content", milk.Content)).
+		Assert(jpassert.Present("$.items[0].score")).
+		Assert(jpassert.Equal("$.items[0].snippet", "buy milk and &lt;<mark>bread</mark>&gt;")).
+		Status(http.StatusOK).
+		End()
+
+	// deleted todos are not found
+	s.apiTest("TestSearchTodos").
+		Delete(fmt.Sprintf("/todos/%s", milk.ID)).
+		Header("Authorization", fmt.Sprintf("Bearer %s", account.AccessToken)).
+		Expect(s.T()).
+		Status(http.StatusOK).
+		End()
+
+	s.apiTest("TestSearchTodos").
+		Get("/todos/search").
+		Query("q", "bread").
+		Header("Authorization", fmt.Sprintf("Bearer %s", account.AccessToken)).
+		Expect(s.T()).
+		Assert(jpassert.Len("$.items", 0)).
+		Status(http.StatusOK).
+		End()
+}
+
+func (s *TodoIntegrationTestSuite) TestSearchTodosWithInvalidQuery() {
+	account := createTestAccount(s.T(), s.apiTest("TestSearchTodosWithInvalidQuery"))
+
+	queries := []map[string]string{
+		{},
+		{"q": "to be"},
+		{"q": "milk", "limit": "0"},
+		{"q": "milk", "limit": "many"},
+	}
+	for _, q := range queries {
+		s.apiTest("TestSearchTodosWithInvalidQuery").
+			Get("/todos/search").
+			QueryParams(q).
+			Header("Authorization", fmt.Sprintf("Bearer %s", account.AccessToken)).
+			Expect(s.T()).
+			Status(http.StatusBadRequest).
+			End()
+	}
+}
+
 func (s *TodoIntegrationTestSuite) TestGetTodoByIdSuccess() {
 	content := "things todo"
 	account := createTestAccount(s.T(), s.apiTest("TestGetTodoByIdSuccess"))
@@ -1,15 +1,21 @@
 package test
 
 import (
+	"archive/zip"
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"testing"
+	"time"
 
 	app "github.com/org39/webapp-tutorial-backend/app/server"
 
 	"github.com/labstack/echo/v4"
 	"github.com/org39/webapp-tutorial-backend/pkg/testreport"
+	"github.com/org39/webapp-tutorial-backend/pkg/totp"
 	"github.com/steinfletcher/apitest"
 	jpassert "github.com/steinfletcher/apitest-jsonpath"
 	"github.com/stretchr/testify/assert"
@@ -41,6 +47,46 @@ func (s *UserIntegrationTestSuite) SetupTest() {
 	if err != nil {
 		assert.Fail(s.T(), fmt.Sprintf("fail to truncate %s table: %s", s.Application.Config.UserTable, err))
 	}
+
+	_, err = s.Application.DB.Exec(context.Background(), fmt.Sprintf("TRUNCATE %s", s.Application.Config.UserTokenTable))
+	if err != nil {
+		assert.Fail(s.T(), fmt.Sprintf("fail to truncate %s table: %s", s.Application.Config.UserTokenTable, err))
+	}
+
+	_, err = s.Application.DB.Exec(context.Background(), fmt.Sprintf("TRUNCATE %s", s.Application.Config.UserMFATable))
+	if err != nil {
+		assert.Fail(s.T(), fmt.Sprintf("fail to truncate %s table: %s", s.Application.Config.UserMFATable, err))
+	}
+
+	_, err = s.Application.DB.Exec(context.Background(), fmt.Sprintf("TRUNCATE %s", s.Application.Config.AuthRefreshTokenTable))
+	if err != nil {
+		assert.Fail(s.T(), fmt.Sprintf("fail to truncate %s table: %s", s.Application.Config.AuthRefreshTokenTable, err))
+	}
+
+	_, err = s.Application.DB.Exec(context.Background(), fmt.Sprintf("TRUNCATE %s", s.Application.Config.AuthTokenGenerationTable))
+	if err != nil {
+		assert.Fail(s.T(), fmt.Sprintf("fail to truncate %s table: %s", s.Application.Config.AuthTokenGenerationTable, err))
+	}
+
+	_, err = s.Application.DB.Exec(context.Background(), fmt.Sprintf("TRUNCATE %s", s.Application.Config.AuthPersonalAccessTokenTable))
+	if err != nil {
+		assert.Fail(s.T(), fmt.Sprintf("fail to truncate %s table: %s", s.Application.Config.AuthPersonalAccessTokenTable, err))
+	}
+
+	_, err = s.Application.DB.Exec(context.Background(), fmt.Sprintf("TRUNCATE %s", s.Application.Config.AuthSessionTable))
+	if err != nil {
+		assert.Fail(s.T(), fmt.Sprintf("fail to truncate %s table: %s", s.Application.Config.AuthSessionTable, err))
+	}
+
+	_, err = s.Application.DB.Exec(context.Background(), fmt.Sprintf("TRUNCATE %s", s.Application.Config.TodoTable))
+	if err != nil {
+		assert.Fail(s.T(), fmt.Sprintf("fail to truncate %s table: %s", s.Application.Config.TodoTable, err))
+	}
+
+	_, err = s.Application.DB.Exec(context.Background(), fmt.Sprintf("TRUNCATE %s", s.Application.Config.UserProfileTable))
+	if err != nil {
+		assert.Fail(s.T(), fmt.Sprintf("fail to truncate %s table: %s", s.Application.Config.UserProfileTable, err))
+	}
 }
 
 func (s *UserIntegrationTestSuite) TearDownSuite() {
@@ -74,9 +120,12 @@ func (s *UserIntegrationTestSuite) TestLoginRefreshSuccess() {
 		End().Response
 
 	refreshTokenCookie := findCookieByName(loginResp.Cookies(), "refresh_token")
+	csrfTokenCookie := findCookieByName(loginResp.Cookies(), "csrf_token")
 	s.apiTest("TestLoginRefreshSuccess").
 		Post("/user/refresh").
 		Cookie("refresh_token", refreshTokenCookie.Value).
+		Cookie("csrf_token", csrfTokenCookie.Value).
+		Header("X-CSRF-Token", csrfTokenCookie.Value).
 		Expect(s.T()).
 		CookiePresent("refresh_token").
 		Assert(jpassert.Present("$.access_token")).
@@ -84,24 +133,1241 @@ func (s *UserIntegrationTestSuite) TestLoginRefreshSuccess() {
 		End()
 }
 
-func (s *UserIntegrationTestSuite) TestGetUserSuccess() {
-	account := createTestAccount(s.T(), s.apiTest("TestGetUserSuccess"))
-	s.apiTest("TestGetUserSuccess").
+func (s *UserIntegrationTestSuite) TestRefreshTokenCookiePolicy() {
+	res := s.apiTest("TestRefreshTokenCookiePolicy").
+		Post("/user/register").
+		JSON(map[string]string{
+			"email":    "hatsune@miku.com",
+			"password": "very-strong-password",
+		}).
+		Expect(s.T()).
+		Status(http.StatusCreated).
+		End().Response
+
+	refreshTokenCookie := findCookieByName(res.Cookies(), "refresh_token")
+	assert.NotNil(s.T(), refreshTokenCookie)
+	assert.True(s.T(), refreshTokenCookie.HttpOnly)
+	assert.Equal(s.T(), http.SameSiteStrictMode, refreshTokenCookie.SameSite)
+	assert.Equal(s.T(), s.Application.Config.RestRefreshTokenCookiePath, refreshTokenCookie.Path)
+	assert.Equal(s.T(), int(s.Application.Config.AuthRefreshTokenDuration.Seconds()), refreshTokenCookie.MaxAge)
+
+	// the frontend reads the csrf token
+	csrfTokenCookie := findCookieByName(res.Cookies(), "csrf_token")
+	assert.NotNil(s.T(), csrfTokenCookie)
+	assert.False(s.T(), csrfTokenCookie.HttpOnly)
+	assert.Equal(s.T(), "/", csrfTokenCookie.Path)
+}
+
+func (s *UserIntegrationTestSuite) TestRefreshFailWithoutCSRFToken() {
+	account := createTestAccount(s.T(), s.apiTest("TestRefreshFailWithoutCSRFToken"))
+
+	// a cross-site request carries the cookies, but can not read them
+	s.apiTest("TestRefreshFailWithoutCSRFToken").
+		Post("/user/refresh").
+		Cookie("refresh_token", account.RefreshToken).
+		Cookie("csrf_token", account.CSRFToken).
+		Expect(s.T()).
+		Status(http.StatusForbidden).
+		End()
+
+	s.apiTest("TestRefreshFailWithoutCSRFToken").
+		Post("/user/logout").
+		Cookie("refresh_token", account.RefreshToken).
+		Cookie("csrf_token", account.CSRFToken).
+		Header("X-CSRF-Token", "forged-token").
+		Expect(s.T()).
+		Status(http.StatusForbidden).
+		End()
+
+	// the refresh token was left alone
+	s.apiTest("TestRefreshFailWithoutCSRFToken").
+		Post("/user/refresh").
+		Cookie("refresh_token", account.RefreshToken).
+		Cookie("csrf_token", account.CSRFToken).
+		Header("X-CSRF-Token", account.CSRFToken).
+		Expect(s.T()).
+		Status(http.StatusOK).
+		End()
+}
+
+func (s *UserIntegrationTestSuite) TestRefreshTokenReuseRevokesFamily() {
+	account := createTestAccount(s.T(), s.apiTest("TestRefreshTokenReuseRevokesFamily"))
+
+	// first refresh rotates the token
+	refreshResp := s.apiTest("TestRefreshTokenReuseRevokesFamily").
+		Post("/user/refresh").
+		Cookie("refresh_token", account.RefreshToken).
+		Cookie("csrf_token", account.CSRFToken).
+		Header("X-CSRF-Token", account.CSRFToken).
+		Expect(s.T()).
+		CookiePresent("refresh_token").
+		Status(http.StatusOK).
+		End().Response
+	rotatedCookie := findCookieByName(refreshResp.Cookies(), "refresh_token")
+
+	// presenting the old token again is detected as reuse
+	s.apiTest("TestRefreshTokenReuseRevokesFamily").
+		Post("/user/refresh").
+		Cookie("refresh_token", account.RefreshToken).
+		Cookie("csrf_token", account.CSRFToken).
+		Header("X-CSRF-Token", account.CSRFToken).
+		Expect(s.T()).
+		Status(http.StatusUnauthorized).
+		End()
+
+	// and the whole family is revoked
+	s.apiTest("TestRefreshTokenReuseRevokesFamily").
+		Post("/user/refresh").
+		Cookie("refresh_token", rotatedCookie.Value).
+		Cookie("csrf_token", account.CSRFToken).
+		Header("X-CSRF-Token", account.CSRFToken).
+		Expect(s.T()).
+		Status(http.StatusUnauthorized).
+		End()
+}
+
+func (s *UserIntegrationTestSuite) TestLogoutSuccess() {
+	account := createTestAccount(s.T(), s.apiTest("TestLogoutSuccess"))
+
+	s.apiTest("TestLogoutSuccess").
+		Post("/user/logout").
+		Cookie("refresh_token", account.RefreshToken).
+		Cookie("csrf_token", account.CSRFToken).
+		Header("X-CSRF-Token", account.CSRFToken).
+		Expect(s.T()).
+		CookiePresent("refresh_token").
+		Status(http.StatusNoContent).
+		End()
+
+	s.apiTest("TestLogoutSuccess").
+		Post("/user/refresh").
+		Cookie("refresh_token", account.RefreshToken).
+		Cookie("csrf_token", account.CSRFToken).
+		Header("X-CSRF-Token", account.CSRFToken).
+		Expect(s.T()).
+		Status(http.StatusUnauthorized).
+		End()
+}
+
+func (s *UserIntegrationTestSuite) TestLogoutAllSuccess() {
+	account := createTestAccount(s.T(), s.apiTest("TestLogoutAllSuccess"))
+
+	s.apiTest("TestLogoutAllSuccess").
+		Post("/user/logout-all").
+		Header("Authorization", fmt.Sprintf("Bearer %s", account.AccessToken)).
+		Expect(s.T()).
+		Status(http.StatusNoContent).
+		End()
+
+	// every outstanding token is invalidated
+	s.apiTest("TestLogoutAllSuccess").
+		Get("/user").
+		Header("Authorization", fmt.Sprintf("Bearer %s", account.AccessToken)).
+		Expect(s.T()).
+		Status(http.StatusUnauthorized).
+		End()
+
+	s.apiTest("TestLogoutAllSuccess").
+		Post("/user/refresh").
+		Cookie("refresh_token", account.RefreshToken).
+		Cookie("csrf_token", account.CSRFToken).
+		Header("X-CSRF-Token", account.CSRFToken).
+		Expect(s.T()).
+		Status(http.StatusUnauthorized).
+		End()
+}
+
+func (s *UserIntegrationTestSuite) TestSessionsSuccess() {
+	account := createTestAccount(s.T(), s.apiTest("TestSessionsSuccess"))
+
+	// log in again from another device
+	login := struct {
+		AccessToken string `json:"access_token"`
+	}{}
+	s.apiTest("TestSessionsSuccess").
+		Post("/user/login").
+		Header("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:92.0) Gecko/20100101 Firefox/92.0").
+		JSON(map[string]string{
+			"email":    account.User.Email,
+			"password": account.Password,
+		}).
+		Expect(s.T()).
+		CookiePresent("refresh_token").
+		Status(http.StatusOK).
+		End().
+		JSON(&login)
+
+	sessions := []struct {
+		ID      string `json:"id"`
+		Label   string `json:"label"`
+		Current bool   `json:"current"`
+	}{}
+	s.apiTest("TestSessionsSuccess").
+		Get("/user/sessions").
+		Header("Authorization", fmt.Sprintf("Bearer %s", login.AccessToken)).
+		Expect(s.T()).
+		Assert(jpassert.Len("$", 2)).
+		Status(http.StatusOK).
+		End().
+		JSON(&sessions)
+
+	var current, other string
+	for _, session := range sessions {
+		if session.Current {
+			assert.Equal(s.T(), "Firefox on Windows", session.Label)
+			current = session.ID
+		} else {
+			other = session.ID
+		}
+	}
+	assert.NotEmpty(s.T(), current)
+	assert.NotEmpty(s.T(), other)
+
+	// log the first device out
+	s.apiTest("TestSessionsSuccess").
+		Delete(fmt.Sprintf("/user/sessions/%s", other)).
+		Header("Authorization", fmt.Sprintf("Bearer %s", login.AccessToken)).
+		Expect(s.T()).
+		Status(http.StatusNoContent).
+		End()
+
+	s.apiTest("TestSessionsSuccess").
+		Post("/user/refresh").
+		Cookie("refresh_token", account.RefreshToken).
+		Cookie("csrf_token", account.CSRFToken).
+		Header("X-CSRF-Token", account.CSRFToken).
+		Expect(s.T()).
+		Status(http.StatusUnauthorized).
+		End()
+
+	s.apiTest("TestSessionsSuccess").
+		Get("/user/sessions").
+		Header("Authorization", fmt.Sprintf("Bearer %s", login.AccessToken)).
+		Expect(s.T()).
+		Assert(jpassert.Len("$", 1)).
+		Assert(jpassert.Equal("$[0].id", current)).
+		Status(http.StatusOK).
+		End()
+
+	s.apiTest("TestSessionsSuccess").
+		Delete(fmt.Sprintf("/user/sessions/%s", other)).
+		Header("Authorization", fmt.Sprintf("Bearer %s", login.AccessToken)).
+		Expect(s.T()).
+		Status(http.StatusNotFound).
+		End()
+}
+
+func (s *UserIntegrationTestSuite) TestPasswordResetSuccess() {
+	account := createTestAccount(s.T(), s.apiTest("TestPasswordResetSuccess"))
+	newPassword := "another-strong-password"
+
+	s.apiTest("TestPasswordResetSuccess").
+		Post("/user/password/forgot").
+		JSON(map[string]string{
+			"email": account.User.Email,
+		}).
+		Expect(s.T()).
+		Status(http.StatusAccepted).
+		End()
+
+	token := tokenFromMail(s.T(), s.Application, account.User.Email)
+	assert.NotEmpty(s.T(), token)
+
+	s.apiTest("TestPasswordResetSuccess").
+		Post("/user/password/reset").
+		JSON(map[string]string{
+			"token":    token,
+			"password": newPassword,
+		}).
+		Expect(s.T()).
+		Status(http.StatusNoContent).
+		End()
+
+	// reset token is single-use
+	s.apiTest("TestPasswordResetSuccess").
+		Post("/user/password/reset").
+		JSON(map[string]string{
+			"token":    token,
+			"password": newPassword,
+		}).
+		Expect(s.T()).
+		Status(http.StatusUnauthorized).
+		End()
+
+	// existing sessions are revoked
+	s.apiTest("TestPasswordResetSuccess").
+		Post("/user/refresh").
+		Cookie("refresh_token", account.RefreshToken).
+		Cookie("csrf_token", account.CSRFToken).
+		Header("X-CSRF-Token", account.CSRFToken).
+		Expect(s.T()).
+		Status(http.StatusUnauthorized).
+		End()
+
+	// old password no longer works, new one does
+	s.apiTest("TestPasswordResetSuccess").
 		Post("/user/login").
 		JSON(map[string]string{
 			"email":    account.User.Email,
 			"password": account.Password,
 		}).
 		Expect(s.T()).
+		Status(http.StatusUnauthorized).
+		End()
+
+	s.apiTest("TestPasswordResetSuccess").
+		Post("/user/login").
+		JSON(map[string]string{
+			"email":    account.User.Email,
+			"password": newPassword,
+		}).
+		Expect(s.T()).
+		Assert(jpassert.Present("$.access_token")).
+		Status(http.StatusOK).
+		End()
+}
+
+func (s *UserIntegrationTestSuite) TestMagicLinkSignUpSuccess() {
+	email := "rin@kagamine.com"
+
+	s.apiTest("TestMagicLinkSignUpSuccess").
+		Post("/user/magic-link").
+		JSON(map[string]string{
+			"email": email,
+		}).
+		Expect(s.T()).
+		Status(http.StatusAccepted).
+		End()
+
+	token := tokenFromMail(s.T(), s.Application, email)
+	assert.NotEmpty(s.T(), token)
+
+	loginResp := s.apiTest("TestMagicLinkSignUpSuccess").
+		Post("/user/magic-link/consume").
+		JSON(map[string]string{
+			"token": token,
+		}).
+		Expect(s.T()).
 		CookiePresent("refresh_token").
 		Assert(jpassert.Present("$.access_token")).
 		Status(http.StatusOK).
 		End()
-	s.apiTest("TestGetUserSuccess").
+
+	// the link is single use
+	s.apiTest("TestMagicLinkSignUpSuccess").
+		Post("/user/magic-link/consume").
+		JSON(map[string]string{
+			"token": token,
+		}).
+		Expect(s.T()).
+		Status(http.StatusUnauthorized).
+		End()
+
+	// following the link verified the address
+	var account Account
+	loginResp.JSON(&account)
+	s.apiTest("TestMagicLinkSignUpSuccess").
 		Get("/user").
 		Header("Authorization", fmt.Sprintf("Bearer %s", account.AccessToken)).
 		Expect(s.T()).
-		Assert(jpassert.Equal("$.email", account.User.Email)).
+		Assert(jpassert.Equal("$.email", email)).
+		Assert(jpassert.Equal("$.verified", true)).
+		Status(http.StatusOK).
+		End()
+}
+
+func (s *UserIntegrationTestSuite) TestSignUpFailAfterMagicLink() {
+	email := "hatsune@miku.com"
+
+	// somebody asks for a link to the address
+	s.apiTest("TestSignUpFailAfterMagicLink").
+		Post("/user/magic-link").
+		JSON(map[string]string{
+			"email": email,
+		}).
+		Expect(s.T()).
+		Status(http.StatusAccepted).
+		End()
+
+	first := tokenFromMail(s.T(), s.Application, email)
+	assert.NotEmpty(s.T(), first)
+
+	// signing up with the address does not take the user over
+	s.apiTest("TestSignUpFailAfterMagicLink").
+		Post("/user/register").
+		JSON(map[string]string{
+			"email":    email,
+			"password": "very-strong-password",
+		}).
+		Expect(s.T()).
+		Status(http.StatusBadRequest).
+		End()
+
+	// the owner of the address gets another link to log in
+	second := tokenFromMail(s.T(), s.Application, email)
+	assert.NotEqual(s.T(), first, second)
+
+	s.apiTest("TestSignUpFailAfterMagicLink").
+		Post("/user/magic-link/consume").
+		JSON(map[string]string{
+			"token": second,
+		}).
+		Expect(s.T()).
+		Assert(jpassert.Present("$.access_token")).
+		Status(http.StatusOK).
+		End()
+}
+
+func (s *UserIntegrationTestSuite) TestMagicLinkLoginSuccess() {
+	account := createTestAccount(s.T(), s.apiTest("TestMagicLinkLoginSuccess"))
+
+	s.apiTest("TestMagicLinkLoginSuccess").
+		Post("/user/magic-link").
+		JSON(map[string]string{
+			"email": account.User.Email,
+		}).
+		Expect(s.T()).
+		Status(http.StatusAccepted).
+		End()
+
+	s.apiTest("TestMagicLinkLoginSuccess").
+		Post("/user/magic-link/consume").
+		JSON(map[string]string{
+			"token": tokenFromMail(s.T(), s.Application, account.User.Email),
+		}).
+		Expect(s.T()).
+		CookiePresent("refresh_token").
+		Assert(jpassert.Present("$.access_token")).
+		Status(http.StatusOK).
+		End()
+
+	// the password keeps working
+	s.apiTest("TestMagicLinkLoginSuccess").
+		Post("/user/login").
+		JSON(map[string]string{
+			"email":    account.User.Email,
+			"password": account.Password,
+		}).
+		Expect(s.T()).
+		Status(http.StatusOK).
+		End()
+}
+
+func (s *UserIntegrationTestSuite) TestChangePasswordSuccess() {
+	account := createTestAccount(s.T(), s.apiTest("TestChangePasswordSuccess"))
+	newPassword := "another-strong-password"
+
+	changeResp := s.apiTest("TestChangePasswordSuccess").
+		Put("/user/password").
+		Header("Authorization", fmt.Sprintf("Bearer %s", account.AccessToken)).
+		JSON(map[string]string{
+			"current_password": account.Password,
+			"password":         newPassword,
+		}).
+		Expect(s.T()).
+		CookiePresent("refresh_token").
+		Assert(jpassert.Present("$.access_token")).
+		Status(http.StatusOK).
+		End().Response
+
+	// other sessions are revoked
+	s.apiTest("TestChangePasswordSuccess").
+		Post("/user/refresh").
+		Cookie("refresh_token", account.RefreshToken).
+		Cookie("csrf_token", account.CSRFToken).
+		Header("X-CSRF-Token", account.CSRFToken).
+		Expect(s.T()).
+		Status(http.StatusUnauthorized).
+		End()
+
+	// the session which changed the password continues
+	refreshTokenCookie := findCookieByName(changeResp.Cookies(), "refresh_token")
+	csrfTokenCookie := findCookieByName(changeResp.Cookies(), "csrf_token")
+	s.apiTest("TestChangePasswordSuccess").
+		Post("/user/refresh").
+		Cookie("refresh_token", refreshTokenCookie.Value).
+		Cookie("csrf_token", csrfTokenCookie.Value).
+		Header("X-CSRF-Token", csrfTokenCookie.Value).
+		Expect(s.T()).
+		Assert(jpassert.Present("$.access_token")).
+		Status(http.StatusOK).
+		End()
+
+	s.apiTest("TestChangePasswordSuccess").
+		Post("/user/login").
+		JSON(map[string]string{
+			"email":    account.User.Email,
+			"password": newPassword,
+		}).
+		Expect(s.T()).
+		Assert(jpassert.Present("$.access_token")).
+		Status(http.StatusOK).
+		End()
+}
+
+func (s *UserIntegrationTestSuite) TestRegisterFailWhenPasswordRejected() {
+	// clients show every reason at once
+	s.apiTest("TestRegisterFailWhenPasswordRejected").
+		Post("/user/register").
+		JSON(map[string]string{
+			"email":    "hatsune@miku.com",
+			"password": "miku39",
+		}).
+		Expect(s.T()).
+		Assert(jpassert.Equal("$.message", "password rejected")).
+		Assert(jpassert.Contains("$.reasons", "too_short")).
+		Assert(jpassert.Contains("$.reasons", "contains_email")).
+		Assert(jpassert.Contains("$.reasons", "too_weak")).
+		Status(http.StatusBadRequest).
+		End()
+}
+
+func (s *UserIntegrationTestSuite) TestChangePasswordFailWhenPasswordRejected() {
+	account := createTestAccount(s.T(), s.apiTest("TestChangePasswordFailWhenPasswordRejected"))
+
+	s.apiTest("TestChangePasswordFailWhenPasswordRejected").
+		Put("/user/password").
+		Header("Authorization", fmt.Sprintf("Bearer %s", account.AccessToken)).
+		JSON(map[string]string{
+			"current_password": account.Password,
+			"password":         "password1",
+		}).
+		Expect(s.T()).
+		Assert(jpassert.Equal("$.reasons[0]", "too_weak")).
+		Status(http.StatusBadRequest).
+		End()
+}
+
+func (s *UserIntegrationTestSuite) TestChangeEmailSuccess() {
+	account := createTestAccount(s.T(), s.apiTest("TestChangeEmailSuccess"))
+	newEmail := "miku@miku.com"
+
+	s.apiTest("TestChangeEmailSuccess").
+		Post("/user/verify").
+		JSON(map[string]string{
+			"token": tokenFromMail(s.T(), s.Application, account.User.Email),
+		}).
+		Expect(s.T()).
+		Status(http.StatusNoContent).
+		End()
+
+	s.apiTest("TestChangeEmailSuccess").
+		Put("/user/email").
+		Header("Authorization", fmt.Sprintf("Bearer %s", account.AccessToken)).
+		JSON(map[string]string{
+			"email":            newEmail,
+			"current_password": account.Password,
+		}).
+		Expect(s.T()).
+		Assert(jpassert.Equal("$.email", newEmail)).
+		Assert(jpassert.Equal("$.verified", false)).
+		Status(http.StatusOK).
+		End()
+
+	// the new address is verified with the link mailed to it
+	s.apiTest("TestChangeEmailSuccess").
+		Post("/user/verify").
+		JSON(map[string]string{
+			"token": tokenFromMail(s.T(), s.Application, newEmail),
+		}).
+		Expect(s.T()).
+		Status(http.StatusNoContent).
+		End()
+
+	s.apiTest("TestChangeEmailSuccess").
+		Post("/user/login").
+		JSON(map[string]string{
+			"email":    newEmail,
+			"password": account.Password,
+		}).
+		Expect(s.T()).
+		Assert(jpassert.Present("$.access_token")).
+		Status(http.StatusOK).
+		End()
+}
+
+func (s *UserIntegrationTestSuite) TestChangeEmailWithoutPasswordKeepsUser() {
+	email := "rin@kagamine.com"
+	newEmail := "miku@miku.com"
+
+	s.apiTest("TestChangeEmailWithoutPasswordKeepsUser").
+		Post("/user/magic-link").
+		JSON(map[string]string{
+			"email": email,
+		}).
+		Expect(s.T()).
+		Status(http.StatusAccepted).
+		End()
+
+	var account Account
+	s.apiTest("TestChangeEmailWithoutPasswordKeepsUser").
+		Post("/user/magic-link/consume").
+		JSON(map[string]string{
+			"token": tokenFromMail(s.T(), s.Application, email),
+		}).
+		Expect(s.T()).
+		Status(http.StatusOK).
+		End().
+		JSON(&account)
+
+	// the login just now confirms the change
+	s.apiTest("TestChangeEmailWithoutPasswordKeepsUser").
+		Put("/user/email").
+		Header("Authorization", fmt.Sprintf("Bearer %s", account.AccessToken)).
+		JSON(map[string]string{
+			"email": newEmail,
+		}).
+		Expect(s.T()).
+		Assert(jpassert.Equal("$.email", newEmail)).
+		Assert(jpassert.Equal("$.verified", false)).
+		Status(http.StatusOK).
+		End()
+
+	// the unverified address without a password does not make the user free to sign up with
+	s.apiTest("TestChangeEmailWithoutPasswordKeepsUser").
+		Post("/user/register").
+		JSON(map[string]string{
+			"email":    newEmail,
+			"password": "very-strong-password",
+		}).
+		Expect(s.T()).
+		Status(http.StatusBadRequest).
+		End()
+
+	s.apiTest("TestChangeEmailWithoutPasswordKeepsUser").
+		Get("/user").
+		Header("Authorization", fmt.Sprintf("Bearer %s", account.AccessToken)).
+		Expect(s.T()).
+		Assert(jpassert.Equal("$.email", newEmail)).
+		Status(http.StatusOK).
+		End()
+}
+
+func (s *UserIntegrationTestSuite) TestChangeEmailFailWhenEmailAlreadyExist() {
+	account := createTestAccount(s.T(), s.apiTest("TestChangeEmailFailWhenEmailAlreadyExist"))
+
+	s.apiTest("TestChangeEmailFailWhenEmailAlreadyExist").
+		Post("/user/register").
+		JSON(map[string]string{
+			"email":    "miku@miku.com",
+			"password": "very-strong-password",
+		}).
+		Expect(s.T()).
+		Status(http.StatusCreated).
+		End()
+
+	s.apiTest("TestChangeEmailFailWhenEmailAlreadyExist").
+		Put("/user/email").
+		Header("Authorization", fmt.Sprintf("Bearer %s", account.AccessToken)).
+		JSON(map[string]string{
+			"email":            "miku@miku.com",
+			"current_password": account.Password,
+		}).
+		Expect(s.T()).
+		Status(http.StatusBadRequest).
+		End()
+}
+
+func (s *UserIntegrationTestSuite) TestForgotPasswordUnknownEmail() {
+	s.apiTest("TestForgotPasswordUnknownEmail").
+		Post("/user/password/forgot").
+		JSON(map[string]string{
+			"email": "nobody@miku.com",
+		}).
+		Expect(s.T()).
+		Status(http.StatusAccepted).
+		End()
+}
+
+func (s *UserIntegrationTestSuite) TestVerifyEmailSuccess() {
+	account := createTestAccount(s.T(), s.apiTest("TestVerifyEmailSuccess"))
+
+	s.apiTest("TestVerifyEmailSuccess").
+		Get("/user").
+		Header("Authorization", fmt.Sprintf("Bearer %s", account.AccessToken)).
+		Expect(s.T()).
+		Assert(jpassert.Equal("$.verified", false)).
+		Status(http.StatusOK).
+		End()
+
+	// ask for another link, the one sent on sign up stops working
+	signUpToken := tokenFromMail(s.T(), s.Application, account.User.Email)
+	s.apiTest("TestVerifyEmailSuccess").
+		Post("/user/verify/resend").
+		Header("Authorization", fmt.Sprintf("Bearer %s", account.AccessToken)).
+		Expect(s.T()).
+		Status(http.StatusAccepted).
+		End()
+
+	s.apiTest("TestVerifyEmailSuccess").
+		Post("/user/verify").
+		JSON(map[string]string{
+			"token": signUpToken,
+		}).
+		Expect(s.T()).
+		Status(http.StatusUnauthorized).
+		End()
+
+	s.apiTest("TestVerifyEmailSuccess").
+		Post("/user/verify").
+		JSON(map[string]string{
+			"token": tokenFromMail(s.T(), s.Application, account.User.Email),
+		}).
+		Expect(s.T()).
+		Status(http.StatusNoContent).
+		End()
+
+	s.apiTest("TestVerifyEmailSuccess").
+		Get("/user").
+		Header("Authorization", fmt.Sprintf("Bearer %s", account.AccessToken)).
+		Expect(s.T()).
+		Assert(jpassert.Equal("$.verified", true)).
+		Status(http.StatusOK).
+		End()
+}
+
+func (s *UserIntegrationTestSuite) TestLoginThrottled() {
+	// failed logins are remembered by the application, use an address no other test logs in with
+	email := "throttled@miku.com"
+
+	for i := 0; i < s.Application.Config.UserLoginFreeAttempts+1; i++ {
+		s.apiTest("TestLoginThrottled").
+			Post("/user/login").
+			JSON(map[string]string{
+				"email":    email,
+				"password": "wrong-password",
+			}).
+			Expect(s.T()).
+			Status(http.StatusNotFound).
+			End()
+	}
+
+	// delayed
+	s.apiTest("TestLoginThrottled").
+		Post("/user/login").
+		JSON(map[string]string{
+			"email":    email,
+			"password": "wrong-password",
+		}).
+		Expect(s.T()).
+		HeaderPresent("Retry-After").
+		Status(http.StatusTooManyRequests).
+		End()
+}
+
+func (s *UserIntegrationTestSuite) TestMFALoginSuccess() {
+	account := createTestAccount(s.T(), s.apiTest("TestMFALoginSuccess"))
+
+	// enroll
+	enrollment := struct {
+		Secret string `json:"secret"`
+	}{}
+	s.apiTest("TestMFALoginSuccess").
+		Post("/user/mfa/enroll").
+		Header("Authorization", fmt.Sprintf("Bearer %s", account.AccessToken)).
+		Expect(s.T()).
+		Assert(jpassert.Present("$.otpauth_uri")).
+		Status(http.StatusOK).
+		End().
+		JSON(&enrollment)
+
+	// confirm with the first code
+	code, err := totp.Code(enrollment.Secret, time.Now())
+	assert.NoError(s.T(), err)
+
+	recovery := struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}{}
+	s.apiTest("TestMFALoginSuccess").
+		Post("/user/mfa/confirm").
+		Header("Authorization", fmt.Sprintf("Bearer %s", account.AccessToken)).
+		JSON(map[string]string{
+			"code": code,
+		}).
+		Expect(s.T()).
+		Status(http.StatusOK).
+		End().
+		JSON(&recovery)
+	assert.NotEmpty(s.T(), recovery.RecoveryCodes)
+
+	// password alone gives a challenge, not tokens
+	challenge := struct {
+		MFAToken string `json:"mfa_token"`
+	}{}
+	login := func() {
+		s.apiTest("TestMFALoginSuccess").
+			Post("/user/login").
+			JSON(map[string]string{
+				"email":    account.User.Email,
+				"password": account.Password,
+			}).
+			Expect(s.T()).
+			CookieNotPresent("refresh_token").
+			Assert(jpassert.Equal("$.mfa_required", true)).
+			Assert(jpassert.NotPresent("$.access_token")).
+			Status(http.StatusOK).
+			End().
+			JSON(&challenge)
+	}
+	login()
+
+	// the mfa token is not an access token
+	s.apiTest("TestMFALoginSuccess").
+		Get("/user").
+		Header("Authorization", fmt.Sprintf("Bearer %s", challenge.MFAToken)).
+		Expect(s.T()).
+		Status(http.StatusUnauthorized).
+		End()
+
+	// the confirmation code can not be replayed
+	s.apiTest("TestMFALoginSuccess").
+		Post("/user/login/mfa").
+		JSON(map[string]string{
+			"mfa_token": challenge.MFAToken,
+			"code":      code,
+		}).
+		Expect(s.T()).
+		Status(http.StatusUnauthorized).
+		End()
+
+	// next code, allowed by clock drift
+	nextCode, err := totp.Code(enrollment.Secret, time.Now().Add(totp.Period*time.Second))
+	assert.NoError(s.T(), err)
+
+	s.apiTest("TestMFALoginSuccess").
+		Post("/user/login/mfa").
+		JSON(map[string]string{
+			"mfa_token": challenge.MFAToken,
+			"code":      nextCode,
+		}).
+		Expect(s.T()).
+		CookiePresent("refresh_token").
+		Assert(jpassert.Present("$.access_token")).
+		Status(http.StatusOK).
+		End()
+
+	// recovery codes are single-use
+	login()
+	s.apiTest("TestMFALoginSuccess").
+		Post("/user/login/mfa").
+		JSON(map[string]string{
+			"mfa_token": challenge.MFAToken,
+			"code":      recovery.RecoveryCodes[0],
+		}).
+		Expect(s.T()).
+		Assert(jpassert.Present("$.access_token")).
+		Status(http.StatusOK).
+		End()
+
+	s.apiTest("TestMFALoginSuccess").
+		Post("/user/login/mfa").
+		JSON(map[string]string{
+			"mfa_token": challenge.MFAToken,
+			"code":      recovery.RecoveryCodes[0],
+		}).
+		Expect(s.T()).
+		Status(http.StatusUnauthorized).
+		End()
+}
+
+func (s *UserIntegrationTestSuite) TestPersonalAccessTokenSuccess() {
+	account := createTestAccount(s.T(), s.apiTest("TestPersonalAccessTokenSuccess"))
+
+	// create
+	created := struct {
+		ID    string `json:"id"`
+		Token string `json:"token"`
+	}{}
+	s.apiTest("TestPersonalAccessTokenSuccess").
+		Post("/user/tokens").
+		Header("Authorization", fmt.Sprintf("Bearer %s", account.AccessToken)).
+		JSON(map[string]interface{}{
+			"name":   "ci",
+			"scopes": []string{"todos:read", "todos:write"},
+		}).
+		Expect(s.T()).
+		Assert(jpassert.Equal("$.name", "ci")).
+		Assert(jpassert.Present("$.token")).
+		Status(http.StatusCreated).
+		End().
+		JSON(&created)
+
+	// the token authenticates like an access token
+	s.apiTest("TestPersonalAccessTokenSuccess").
+		Get("/user").
+		Header("Authorization", fmt.Sprintf("Bearer %s", created.Token)).
+		Expect(s.T()).
+		Assert(jpassert.Equal("$.email", account.User.Email)).
+		Status(http.StatusOK).
+		End()
+
+	// list never shows the token again, but tracks its usage
+	s.apiTest("TestPersonalAccessTokenSuccess").
+		Get("/user/tokens").
+		Header("Authorization", fmt.Sprintf("Bearer %s", account.AccessToken)).
+		Expect(s.T()).
+		Assert(jpassert.Len("$", 1)).
+		Assert(jpassert.Equal("$[0].id", created.ID)).
+		Assert(jpassert.NotPresent("$[0].token")).
+		Assert(jpassert.NotEqual("$[0].last_used_at", nil)).
+		Status(http.StatusOK).
+		End()
+
+	// revoke
+	s.apiTest("TestPersonalAccessTokenSuccess").
+		Delete(fmt.Sprintf("/user/tokens/%s", created.ID)).
+		Header("Authorization", fmt.Sprintf("Bearer %s", account.AccessToken)).
+		Expect(s.T()).
+		Status(http.StatusNoContent).
+		End()
+
+	s.apiTest("TestPersonalAccessTokenSuccess").
+		Get("/user").
+		Header("Authorization", fmt.Sprintf("Bearer %s", created.Token)).
+		Expect(s.T()).
+		Status(http.StatusUnauthorized).
+		End()
+
+	s.apiTest("TestPersonalAccessTokenSuccess").
+		Delete(fmt.Sprintf("/user/tokens/%s", created.ID)).
+		Header("Authorization", fmt.Sprintf("Bearer %s", account.AccessToken)).
+		Expect(s.T()).
+		Status(http.StatusNotFound).
+		End()
+}
+
+func (s *UserIntegrationTestSuite) TestPersonalAccessTokenScopes() {
+	account := createTestAccount(s.T(), s.apiTest("TestPersonalAccessTokenScopes"))
+
+	created := struct {
+		Token string `json:"token"`
+	}{}
+	s.apiTest("TestPersonalAccessTokenScopes").
+		Post("/user/tokens").
+		Header("Authorization", fmt.Sprintf("Bearer %s", account.AccessToken)).
+		JSON(map[string]interface{}{
+			"name":   "read-only",
+			"scopes": []string{"todos:read", "user:write"},
+		}).
+		Expect(s.T()).
+		Status(http.StatusCreated).
+		End().
+		JSON(&created)
+
+	// granted scope
+	s.apiTest("TestPersonalAccessTokenScopes").
+		Get("/todos").
+		Header("Authorization", fmt.Sprintf("Bearer %s", created.Token)).
+		Expect(s.T()).
+		Status(http.StatusOK).
+		End()
+
+	// missing scopes
+	s.apiTest("TestPersonalAccessTokenScopes").
+		Post("/todos").
+		Header("Authorization", fmt.Sprintf("Bearer %s", created.Token)).
+		JSON(map[string]string{
+			"content": "buy leek",
+		}).
+		Expect(s.T()).
+		Header("WWW-Authenticate", `Bearer error="insufficient_scope", scope="todos:write"`).
+		Status(http.StatusForbidden).
+		End()
+
+	s.apiTest("TestPersonalAccessTokenScopes").
+		Get("/user").
+		Header("Authorization", fmt.Sprintf("Bearer %s", created.Token)).
+		Expect(s.T()).
+		Status(http.StatusForbidden).
+		End()
+
+	// a token can not create a token with more scopes than its own
+	s.apiTest("TestPersonalAccessTokenScopes").
+		Post("/user/tokens").
+		Header("Authorization", fmt.Sprintf("Bearer %s", created.Token)).
+		JSON(map[string]interface{}{
+			"name":   "escalated",
+			"scopes": []string{"todos:write"},
+		}).
+		Expect(s.T()).
+		Status(http.StatusForbidden).
+		End()
+}
+
+func (s *UserIntegrationTestSuite) TestCreatePersonalAccessTokenWithUnknownScope() {
+	account := createTestAccount(s.T(), s.apiTest("TestCreatePersonalAccessTokenWithUnknownScope"))
+
+	s.apiTest("TestCreatePersonalAccessTokenWithUnknownScope").
+		Post("/user/tokens").
+		Header("Authorization", fmt.Sprintf("Bearer %s", account.AccessToken)).
+		JSON(map[string]interface{}{
+			"name":   "ci",
+			"scopes": []string{"admin"},
+		}).
+		Expect(s.T()).
+		Status(http.StatusBadRequest).
+		End()
+}
+
+func (s *UserIntegrationTestSuite) TestGetUserSuccess() {
+	account := createTestAccount(s.T(), s.apiTest("TestGetUserSuccess"))
+	s.apiTest("TestGetUserSuccess").
+		Post("/user/login").
+		JSON(map[string]string{
+			"email":    account.User.Email,
+			"password": account.Password,
+		}).
+		Expect(s.T()).
+		CookiePresent("refresh_token").
+		Assert(jpassert.Present("$.access_token")).
+		Status(http.StatusOK).
+		End()
+	s.apiTest("TestGetUserSuccess").
+		Get("/user").
+		Header("Authorization", fmt.Sprintf("Bearer %s", account.AccessToken)).
+		Expect(s.T()).
+		Assert(jpassert.Equal("$.email", account.User.Email)).
+		Status(http.StatusOK).
+		End()
+}
+
+func (s *UserIntegrationTestSuite) TestUpdateProfileSuccess() {
+	account := createTestAccount(s.T(), s.apiTest("TestUpdateProfileSuccess"))
+
+	s.apiTest("TestUpdateProfileSuccess").
+		Patch("/user").
+		Header("Authorization", fmt.Sprintf("Bearer %s", account.AccessToken)).
+		JSON(map[string]interface{}{
+			"display_name": "Miku",
+			"time_zone":    "Asia/Tokyo",
+			"preferences":  map[string]interface{}{"show_completed": false},
+		}).
+		Expect(s.T()).
+		Assert(jpassert.Equal("$.display_name", "Miku")).
+		Assert(jpassert.Equal("$.time_zone", "Asia/Tokyo")).
+		Assert(jpassert.Equal("$.preferences.show_completed", false)).
+		Status(http.StatusOK).
+		End()
+
+	// fields missing from the body are kept
+	s.apiTest("TestUpdateProfileSuccess").
+		Patch("/user").
+		Header("Authorization", fmt.Sprintf("Bearer %s", account.AccessToken)).
+		JSON(map[string]interface{}{
+			"locale": "ja-JP",
+		}).
+		Expect(s.T()).
+		Status(http.StatusOK).
+		End()
+
+	s.apiTest("TestUpdateProfileSuccess").
+		Get("/user").
+		Header("Authorization", fmt.Sprintf("Bearer %s", account.AccessToken)).
+		Expect(s.T()).
+		Assert(jpassert.Equal("$.email", account.User.Email)).
+		Assert(jpassert.Equal("$.display_name", "Miku")).
+		Assert(jpassert.Equal("$.time_zone", "Asia/Tokyo")).
+		Assert(jpassert.Equal("$.locale", "ja-JP")).
+		Assert(jpassert.NotPresent("$.avatar_url")).
+		Status(http.StatusOK).
+		End()
+}
+
+func (s *UserIntegrationTestSuite) TestUpdateProfileWithInvalidTimeZone() {
+	account := createTestAccount(s.T(), s.apiTest("TestUpdateProfileWithInvalidTimeZone"))
+
+	s.apiTest("TestUpdateProfileWithInvalidTimeZone").
+		Patch("/user").
+		Header("Authorization", fmt.Sprintf("Bearer %s", account.AccessToken)).
+		JSON(map[string]interface{}{
+			"time_zone": "Mars/Olympus_Mons",
+		}).
+		Expect(s.T()).
+		Status(http.StatusBadRequest).
+		End()
+}
+
+func (s *UserIntegrationTestSuite) TestAvatarSuccess() {
+	account := createTestAccount(s.T(), s.apiTest("TestAvatarSuccess"))
+	image := "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"
+
+	resp := s.apiTest("TestAvatarSuccess").
+		Put("/user/avatar").
+		Header("Authorization", fmt.Sprintf("Bearer %s", account.AccessToken)).
+		ContentType("image/png").
+		Body(image).
+		Expect(s.T()).
+		Assert(jpassert.Present("$.avatar_url")).
+		Status(http.StatusOK).
+		End().Response
+
+	profile := struct {
+		AvatarURL string `json:"avatar_url"`
+	}{}
+	assert.NoError(s.T(), json.NewDecoder(resp.Body).Decode(&profile))
+
+	// avatars are public
+	s.apiTest("TestAvatarSuccess").
+		Get(profile.AvatarURL).
+		Expect(s.T()).
+		Header("Content-Type", "image/png").
+		Body(image).
+		Status(http.StatusOK).
+		End()
+
+	s.apiTest("TestAvatarSuccess").
+		Delete("/user/avatar").
+		Header("Authorization", fmt.Sprintf("Bearer %s", account.AccessToken)).
+		Expect(s.T()).
+		Assert(jpassert.NotPresent("$.avatar_url")).
+		Status(http.StatusOK).
+		End()
+
+	s.apiTest("TestAvatarSuccess").
+		Get(profile.AvatarURL).
+		Expect(s.T()).
+		Status(http.StatusNotFound).
+		End()
+}
+
+func (s *UserIntegrationTestSuite) TestSetAvatarWithUnsupportedImage() {
+	account := createTestAccount(s.T(), s.apiTest("TestSetAvatarWithUnsupportedImage"))
+
+	s.apiTest("TestSetAvatarWithUnsupportedImage").
+		Put("/user/avatar").
+		Header("Authorization", fmt.Sprintf("Bearer %s", account.AccessToken)).
+		ContentType("image/svg+xml").
+		Body("<svg></svg>").
+		Expect(s.T()).
+		Status(http.StatusBadRequest).
+		End()
+}
+
+func (s *UserIntegrationTestSuite) TestExportSuccess() {
+	account := createTestAccount(s.T(), s.apiTest("TestExportSuccess"))
+	_ = createTestTodo(s.T(), s.apiTest("TestExportSuccess"), account, "things todo")
+	deleted := createTestTodo(s.T(), s.apiTest("TestExportSuccess"), account, "things done")
+
+	s.apiTest("TestExportSuccess").
+		Put(fmt.Sprintf("/todos/%s", deleted.ID)).
+		Header("Authorization", fmt.Sprintf("Bearer %s", account.AccessToken)).
+		JSON(map[string]interface{}{
+			"content":   deleted.Content,
+			"completed": true,
+			"deleted":   true,
+		}).
+		Expect(s.T()).
+		Status(http.StatusOK).
+		End()
+
+	resp := s.apiTest("TestExportSuccess").
+		Get("/user/export").
+		Header("Authorization", fmt.Sprintf("Bearer %s", account.AccessToken)).
+		Expect(s.T()).
+		Header("Content-Type", "application/zip").
+		Status(http.StatusOK).
+		End().Response
+
+	body, err := ioutil.ReadAll(resp.Body)
+	assert.NoError(s.T(), err)
+	archive, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	assert.NoError(s.T(), err)
+	assert.Len(s.T(), archive.File, 1)
+
+	f, err := archive.File[0].Open()
+	assert.NoError(s.T(), err)
+	defer f.Close()
+
+	// deleted todos are exported too
+	export := struct {
+		User  User   `json:"user"`
+		Todos []Todo `json:"todos"`
+	}{}
+	assert.NoError(s.T(), json.NewDecoder(f).Decode(&export))
+	assert.Equal(s.T(), account.User.Email, export.User.Email)
+	assert.Len(s.T(), export.Todos, 2)
+}
+
+func (s *UserIntegrationTestSuite) TestDeleteUserSuccess() {
+	account := createTestAccount(s.T(), s.apiTest("TestDeleteUserSuccess"))
+	_ = createTestTodo(s.T(), s.apiTest("TestDeleteUserSuccess"), account, "things todo")
+
+	s.apiTest("TestDeleteUserSuccess").
+		Delete("/user").
+		Header("Authorization", fmt.Sprintf("Bearer %s", account.AccessToken)).
+		JSON(map[string]string{
+			"password": "wrong-password",
+		}).
+		Expect(s.T()).
+		Status(http.StatusUnauthorized).
+		End()
+
+	s.apiTest("TestDeleteUserSuccess").
+		Delete("/user").
+		Header("Authorization", fmt.Sprintf("Bearer %s", account.AccessToken)).
+		JSON(map[string]string{
+			"password": account.Password,
+		}).
+		Expect(s.T()).
+		Status(http.StatusNoContent).
+		End()
+
+	// the user and the todos are gone
+	s.apiTest("TestDeleteUserSuccess").
+		Post("/user/login").
+		JSON(map[string]string{
+			"email":    account.User.Email,
+			"password": account.Password,
+		}).
+		Expect(s.T()).
+		Status(http.StatusNotFound).
+		End()
+
+	var count int
+	row := s.Application.DB.QueryRow(context.Background(), fmt.Sprintf("SELECT COUNT(*) FROM %s", s.Application.Config.TodoTable))
+	assert.NoError(s.T(), row.Scan(&count))
+	assert.Zero(s.T(), count)
+}
+
+func (s *UserIntegrationTestSuite) TestDeleteUserWithoutPasswordSuccess() {
+	email := "rin@kagamine.com"
+
+	s.apiTest("TestDeleteUserWithoutPasswordSuccess").
+		Post("/user/magic-link").
+		JSON(map[string]string{
+			"email": email,
+		}).
+		Expect(s.T()).
+		Status(http.StatusAccepted).
+		End()
+
+	var account Account
+	s.apiTest("TestDeleteUserWithoutPasswordSuccess").
+		Post("/user/magic-link/consume").
+		JSON(map[string]string{
+			"token": tokenFromMail(s.T(), s.Application, email),
+		}).
+		Expect(s.T()).
+		Status(http.StatusOK).
+		End().
+		JSON(&account)
+
+	// the login just now confirms the deletion
+	s.apiTest("TestDeleteUserWithoutPasswordSuccess").
+		Delete("/user").
+		Header("Authorization", fmt.Sprintf("Bearer %s", account.AccessToken)).
+		JSON(map[string]string{}).
+		Expect(s.T()).
+		Status(http.StatusNoContent).
+		End()
+}
+
+func (s *UserIntegrationTestSuite) TestJWKSSuccess() {
+	s.apiTest("TestJWKSSuccess").
+		Get("/.well-known/jwks.json").
+		Expect(s.T()).
+		Header("Cache-Control", "public, max-age=300").
+		Assert(jpassert.Present("$.keys")).
 		Status(http.StatusOK).
 		End()
 }
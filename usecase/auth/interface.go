@@ -5,18 +5,71 @@ package auth
 import (
 	"context"
 	"errors"
+	"time"
 
 	"github.com/org39/webapp-tutorial-backend/entity"
+	"github.com/org39/webapp-tutorial-backend/entity/dto"
+	"github.com/org39/webapp-tutorial-backend/pkg/jwk"
 )
 
 var (
 	ErrInvalidRequest = errors.New("invalid request")
+	ErrNotFound       = errors.New("not found")
 	ErrSystemError    = errors.New("system error")
 	ErrUnauthorized   = errors.New("unauthorized")
+	ErrDatabaseError  = errors.New("database error")
 )
 
 type Usecase interface {
 	GenereateToken(ctx context.Context, id string) (*entity.AuthTokenPair, error)
 	RefreshToken(ctx context.Context, refreshToken string) (*entity.AuthTokenPair, error)
-	VerifyToken(ctx context.Context, accessToken string) (string, error)
+	VerifyToken(ctx context.Context, accessToken string) (*entity.AuthClaims, error)
+	Introspect(ctx context.Context, clientID string, clientSecret string, token string) (*entity.TokenIntrospection, error)
+	RevokeToken(ctx context.Context, refreshToken string) error
+	RevokeAllTokens(ctx context.Context, id string) error
+	PublicKeys(ctx context.Context) ([]*jwk.Key, error)
+	GenerateMFAToken(ctx context.Context, id string) (string, error)
+	VerifyMFAToken(ctx context.Context, mfaToken string) (string, error)
+	CreatePersonalAccessToken(ctx context.Context, id string, name string, scopes []string, duration time.Duration) (*entity.IssuedPersonalAccessToken, error)
+	ListPersonalAccessTokens(ctx context.Context, id string) ([]*entity.PersonalAccessToken, error)
+	RevokePersonalAccessToken(ctx context.Context, id string, tokenID string) error
+	ListSessions(ctx context.Context, id string) ([]*entity.Session, error)
+	RevokeSession(ctx context.Context, id string, sessionID string) error
+}
+
+type RefreshTokenRepository interface {
+	Store(ctx context.Context, t *dto.RefreshToken) error
+	FetchByID(ctx context.Context, id string) (*dto.RefreshToken, error)
+	Rotate(ctx context.Context, t *dto.RefreshToken) error
+	RevokeFamily(ctx context.Context, familyID string) error
+	RevokeAllByUser(ctx context.Context, userID string) error
+}
+
+// SessionRepository records a session per refresh token family, keyed by the family ID.
+type SessionRepository interface {
+	Store(ctx context.Context, s *dto.Session) error
+	FetchByID(ctx context.Context, id string) (*dto.Session, error)
+	FetchActiveByUserID(ctx context.Context, userID string, now time.Time) ([]*dto.Session, error)
+	Touch(ctx context.Context, id string, ip string, lastSeenAt time.Time, expiresAt time.Time) error
+	Revoke(ctx context.Context, id string) error
+	RevokeAllByUser(ctx context.Context, userID string) error
+}
+
+// AccountRepository tells the roles of users and whether they are disabled.
+type AccountRepository interface {
+	FetchByUserID(ctx context.Context, userID string) (*dto.Account, error)
+}
+
+type TokenGenerationRepository interface {
+	FetchByUserID(ctx context.Context, userID string) (int64, error)
+	Increment(ctx context.Context, userID string) error
+}
+
+// PersonalAccessTokenRepository stores personal access tokens, only their hash is kept.
+type PersonalAccessTokenRepository interface {
+	Store(ctx context.Context, t *dto.PersonalAccessToken) error
+	FetchByHash(ctx context.Context, tokenHash string) (*dto.PersonalAccessToken, error)
+	FetchAllByUserID(ctx context.Context, userID string) ([]*dto.PersonalAccessToken, error)
+	UpdateLastUsed(ctx context.Context, id string, lastUsedAt time.Time) error
+	Delete(ctx context.Context, userID string, id string) error
 }
@@ -2,18 +2,45 @@ package auth
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/org39/webapp-tutorial-backend/entity"
+	"github.com/org39/webapp-tutorial-backend/entity/dto"
+	"github.com/org39/webapp-tutorial-backend/pkg/clientinfo"
+	"github.com/org39/webapp-tutorial-backend/pkg/crypt"
+	"github.com/org39/webapp-tutorial-backend/pkg/jwk"
+	"github.com/org39/webapp-tutorial-backend/pkg/log"
+	"github.com/org39/webapp-tutorial-backend/pkg/uuid"
 
 	"github.com/dgrijalva/jwt-go"
 )
 
+const (
+	// typ claim of tokens which are not access or refresh tokens
+	tokenTypeMFA = "mfa"
+
+	// scope and roles claims are space separated lists, like the OAuth scope parameter
+	scopeSeparator = " "
+
+	// expires_at is a TIMESTAMP which ends in 2038
+	maxPersonalAccessTokenDuration = 5 * 365 * 24 * time.Hour
+)
+
 type Service struct {
-	Secret               string        `inject:"usecase.auth.secret"`
-	AccessTokenDuration  time.Duration `inject:"usecase.auth.access_token_duration"`
-	RefreshTokenDuration time.Duration `inject:"usecase.auth.refresh_token_duration"`
+	RefreshTokenRepository        RefreshTokenRepository                 `inject:""`
+	SessionRepository             SessionRepository                      `inject:""`
+	AccountRepository             AccountRepository                      `inject:""`
+	TokenGenerationRepository     TokenGenerationRepository              `inject:""`
+	PersonalAccessTokenRepository PersonalAccessTokenRepository          `inject:""`
+	Keys                          *jwk.KeySet                            `inject:""`
+	IntrospectionClients          map[string]*entity.IntrospectionClient `inject:"usecase.auth.introspection_clients"`
+	Secret                        string                                 `inject:"usecase.auth.secret"`
+	AccessTokenDuration           time.Duration                          `inject:"usecase.auth.access_token_duration"`
+	RefreshTokenDuration          time.Duration                          `inject:"usecase.auth.refresh_token_duration"`
+	MFATokenDuration              time.Duration                          `inject:"usecase.auth.mfa_token_duration"`
 }
 
 func NewService(options ...func(*Service) error) (Usecase, error) {
@@ -41,35 +68,567 @@ func WithSecret(s string) func(*Service) error {
 	}
 }
 
+// WithKeySet enable asymmetric signing, tokens are signed by the signing key of the set
+func WithKeySet(ks *jwk.KeySet) func(*Service) error {
+	return func(u *Service) error {
+		u.Keys = ks
+		return nil
+	}
+}
+
+func WithRefreshTokenRepository(r RefreshTokenRepository) func(*Service) error {
+	return func(u *Service) error {
+		u.RefreshTokenRepository = r
+		return nil
+	}
+}
+
+func WithSessionRepository(r SessionRepository) func(*Service) error {
+	return func(u *Service) error {
+		u.SessionRepository = r
+		return nil
+	}
+}
+
+func WithAccountRepository(r AccountRepository) func(*Service) error {
+	return func(u *Service) error {
+		u.AccountRepository = r
+		return nil
+	}
+}
+
+func WithTokenGenerationRepository(r TokenGenerationRepository) func(*Service) error {
+	return func(u *Service) error {
+		u.TokenGenerationRepository = r
+		return nil
+	}
+}
+
+func WithPersonalAccessTokenRepository(r PersonalAccessTokenRepository) func(*Service) error {
+	return func(u *Service) error {
+		u.PersonalAccessTokenRepository = r
+		return nil
+	}
+}
+
+// WithIntrospectionClients sets the services allowed to introspect tokens.
+func WithIntrospectionClients(clients ...*entity.IntrospectionClient) func(*Service) error {
+	return func(u *Service) error {
+		u.IntrospectionClients = map[string]*entity.IntrospectionClient{}
+		for _, c := range clients {
+			if err := c.Valid(); err != nil {
+				return err
+			}
+			u.IntrospectionClients[c.ID] = c
+		}
+		return nil
+	}
+}
+
+func WithMFATokenDuration(d time.Duration) func(*Service) error {
+	return func(u *Service) error {
+		u.MFATokenDuration = d
+		return nil
+	}
+}
+
+// GenereateToken starts a session, the client of the request is read from the context with clientinfo.
 func (u *Service) GenereateToken(ctx context.Context, id string) (*entity.AuthTokenPair, error) {
 	if err := entity.NewValidator().ValidateID(id); err != nil {
 		return nil, fmt.Errorf("%s: invalid token request: %w", err, ErrInvalidRequest)
 	}
 
-	// Create token
-	token := jwt.New(jwt.SigningMethodHS256)
+	// every login starts a new refresh token family
+	familyID, err := uuid.New()
+	if err != nil {
+		return nil, fmt.Errorf("%s: generate token family error: %w", err, ErrSystemError)
+	}
+
+	tokens, err := u.issueTokenPair(ctx, id, familyID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := u.startSession(ctx, id, familyID); err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+func (u *Service) RefreshToken(ctx context.Context, refreshToken string) (*entity.AuthTokenPair, error) {
+	if err := entity.NewValidator().ValidateToken(refreshToken); err != nil {
+		return nil, fmt.Errorf("%s: invalid refresh request: %w", err, ErrInvalidRequest)
+	}
+
+	claims, err := u.parseToken(refreshToken)
+	if err != nil {
+		return nil, err
+	}
+
+	id, ok := claims["id"].(string)
+	if !ok {
+		return nil, fmt.Errorf("invalid claims: %w", ErrUnauthorized)
+	}
+
+	jti, ok := claims["jti"].(string)
+	if !ok {
+		return nil, fmt.Errorf("invalid claims: %w", ErrUnauthorized)
+	}
+
+	if tokenType(claims) != "" {
+		return nil, fmt.Errorf("not a refresh token: %w", ErrUnauthorized)
+	}
+
+	if err := u.verifyGeneration(ctx, id, claims); err != nil {
+		return nil, err
+	}
+
+	// refresh token must be known to the store
+	stored, err := u.RefreshTokenRepository.FetchByID(ctx, jti)
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return nil, fmt.Errorf("unknown refresh token: %w", ErrUnauthorized)
+	case err != nil:
+		return nil, fmt.Errorf("%s: %w", err, ErrSystemError)
+	}
+
+	current, err := entity.NewFactory().FromRefreshTokenDTO(stored)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", err, ErrSystemError)
+	}
+
+	if current.UserID != id {
+		return nil, fmt.Errorf("refresh token owner mismatch: %w", ErrUnauthorized)
+	}
+
+	// a rotated token presented again means it was stolen or replayed,
+	// revoke the whole family so neither party can keep using it
+	if current.Rotated {
+		if err := u.revokeFamily(ctx, current.FamilyID); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("refresh token reused: %w", ErrUnauthorized)
+	}
+
+	if !current.Usable(time.Now()) {
+		return nil, fmt.Errorf("refresh token revoked or expired: %w", ErrUnauthorized)
+	}
+
+	// rotate, concurrent refresh with the same token is treated as reuse
+	err = u.RefreshTokenRepository.Rotate(ctx, stored)
+	switch {
+	case errors.Is(err, ErrNotFound):
+		if err := u.revokeFamily(ctx, current.FamilyID); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("refresh token reused: %w", ErrUnauthorized)
+	case err != nil:
+		return nil, fmt.Errorf("%s: %w", err, ErrSystemError)
+	}
+
+	newTokenPair, err := u.issueTokenPair(ctx, id, current.FamilyID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", err, ErrUnauthorized)
+	}
+
+	// last seen is informational, the refresh succeeded anyway
+	now := time.Now()
+	if err := u.SessionRepository.Touch(ctx, current.FamilyID, clientinfo.FromContext(ctx).IP, now, now.Add(u.RefreshTokenDuration)); err != nil {
+		log.LoggerWithSpan(ctx).WithError(err).Warn("fail to touch session")
+	}
+
+	return newTokenPair, nil
+}
+
+func (u *Service) VerifyToken(ctx context.Context, accessToken string) (*entity.AuthClaims, error) {
+	if err := entity.NewValidator().ValidateToken(accessToken); err != nil {
+		return nil, fmt.Errorf("%s: invalid verify request: %w", err, ErrInvalidRequest)
+	}
+
+	// personal access tokens are opaque, they are looked up instead of parsed
+	if strings.HasPrefix(accessToken, entity.PersonalAccessTokenPrefix) {
+		return u.verifyPersonalAccessToken(ctx, accessToken)
+	}
+
+	claims, err := u.parseToken(accessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	id, ok := claims["id"].(string)
+	if !ok {
+		return nil, fmt.Errorf("invalid claims: %w", ErrUnauthorized)
+	}
+
+	// a mfa pending token must not grant access
+	if tokenType(claims) != "" {
+		return nil, fmt.Errorf("not an access token: %w", ErrUnauthorized)
+	}
+
+	if err := u.verifyGeneration(ctx, id, claims); err != nil {
+		return nil, err
+	}
+
+	// tokens without a scope claim, e.g. refresh tokens, grant no scope at all
+	scope, _ := claims["scope"].(string)
+	roles, _ := claims["roles"].(string)
+	sessionID, _ := claims["sid"].(string)
+
+	// parseToken rejects expired tokens, so exp is always set
+	var expiresAt *time.Time
+	if exp, ok := claims["exp"].(float64); ok {
+		t := time.Unix(int64(exp), 0)
+		expiresAt = &t
+	}
+
+	return entity.NewFactory().NewAuthClaims(id, sessionID, strings.Fields(roles), strings.Fields(scope), expiresAt), nil
+}
+
+// Introspect tells an introspection client whether the token is active, in the manner of RFC 7662.
+// Unknown, expired and revoked tokens are all reported inactive, without telling why.
+func (u *Service) Introspect(ctx context.Context, clientID string, clientSecret string, token string) (*entity.TokenIntrospection, error) {
+	client, ok := u.IntrospectionClients[clientID]
+	if !ok || !client.Authenticate(clientSecret) {
+		return nil, fmt.Errorf("invalid introspection client: %w", ErrUnauthorized)
+	}
+
+	if err := entity.NewValidator().ValidateToken(token); err != nil {
+		return nil, fmt.Errorf("%s: invalid introspection request: %w", err, ErrInvalidRequest)
+	}
+
+	claims, err := u.VerifyToken(ctx, token)
+	switch {
+	case errors.Is(err, ErrUnauthorized), errors.Is(err, ErrInvalidRequest):
+		return entity.NewFactory().NewInactiveTokenIntrospection(), nil
+	case err != nil:
+		return nil, err
+	}
+
+	// refresh tokens are only for this backend, they grant no scope
+	if len(claims.Scopes) == 0 {
+		return entity.NewFactory().NewInactiveTokenIntrospection(), nil
+	}
+
+	// stricter than VerifyToken, access tokens of a revoked session or a disabled user are inactive at once
+	if _, err := u.fetchAccount(ctx, claims.UserID); err != nil {
+		if errors.Is(err, ErrUnauthorized) {
+			return entity.NewFactory().NewInactiveTokenIntrospection(), nil
+		}
+		return nil, err
+	}
+
+	if claims.SessionID != "" {
+		active, err := u.sessionActive(ctx, claims.SessionID)
+		if err != nil {
+			return nil, err
+		}
+		if !active {
+			return entity.NewFactory().NewInactiveTokenIntrospection(), nil
+		}
+	}
+
+	return entity.NewFactory().NewTokenIntrospection(claims), nil
+}
+
+// GenerateMFAToken issues a short-lived token proving the password was verified,
+// to be exchanged for a token pair once the second factor is verified too.
+func (u *Service) GenerateMFAToken(ctx context.Context, id string) (string, error) {
+	if err := entity.NewValidator().ValidateID(id); err != nil {
+		return "", fmt.Errorf("%s: invalid token request: %w", err, ErrInvalidRequest)
+	}
+
+	generation, err := u.fetchGeneration(ctx, id)
+	if err != nil {
+		return "", err
+	}
+
+	claims := jwt.MapClaims{}
+	claims["id"] = id
+	claims["typ"] = tokenTypeMFA
+	claims["gen"] = generation
+	claims["exp"] = time.Now().Add(u.MFATokenDuration).Unix()
+
+	t, err := u.signToken(claims)
+	if err != nil {
+		return "", fmt.Errorf("%s: generate mfa token error: %w", err, ErrSystemError)
+	}
+
+	return t, nil
+}
+
+func (u *Service) VerifyMFAToken(ctx context.Context, mfaToken string) (string, error) {
+	if err := entity.NewValidator().ValidateToken(mfaToken); err != nil {
+		return "", fmt.Errorf("%s: invalid verify request: %w", err, ErrInvalidRequest)
+	}
+
+	claims, err := u.parseToken(mfaToken)
+	if err != nil {
+		return "", err
+	}
+
+	id, ok := claims["id"].(string)
+	if !ok {
+		return "", fmt.Errorf("invalid claims: %w", ErrUnauthorized)
+	}
+
+	if tokenType(claims) != tokenTypeMFA {
+		return "", fmt.Errorf("not a mfa token: %w", ErrUnauthorized)
+	}
+
+	if err := u.verifyGeneration(ctx, id, claims); err != nil {
+		return "", err
+	}
+
+	return id, nil
+}
+
+// CreatePersonalAccessToken issues a long-lived token, a zero duration means it never expires.
+// The plain token is returned only here, the store keeps its hash.
+func (u *Service) CreatePersonalAccessToken(ctx context.Context, id string, name string, scopes []string, duration time.Duration) (*entity.IssuedPersonalAccessToken, error) {
+	if err := entity.NewValidator().ValidateID(id); err != nil {
+		return nil, fmt.Errorf("%s: invalid token request: %w", err, ErrInvalidRequest)
+	}
+
+	if duration < 0 || duration > maxPersonalAccessTokenDuration {
+		return nil, fmt.Errorf("token duration out of range(%s): %w", duration, ErrInvalidRequest)
+	}
+
+	secret, err := crypt.NewToken()
+	if err != nil {
+		return nil, fmt.Errorf("%s: generate personal access token error: %w", err, ErrSystemError)
+	}
+	token := entity.PersonalAccessTokenPrefix + secret
+
+	t, err := entity.NewFactory().NewPersonalAccessToken(id, name, scopes, token, duration)
+	if err != nil {
+		return nil, fmt.Errorf("%s: generate personal access token error: %w", err, ErrSystemError)
+	}
+
+	if err := t.Valid(); err != nil {
+		return nil, fmt.Errorf("%s: invalid token request: %w", err, ErrInvalidRequest)
+	}
+
+	tDTO := dto.NewFactory().NewPersonalAccessToken(t.ID, t.UserID, t.Name, t.Scopes, t.TokenHash, t.LastUsedAt, t.ExpiresAt, t.CreatedAt)
+	if err := u.PersonalAccessTokenRepository.Store(ctx, tDTO); err != nil {
+		return nil, fmt.Errorf("%s: %w", err, ErrSystemError)
+	}
+
+	return entity.NewFactory().NewIssuedPersonalAccessToken(t, token), nil
+}
+
+func (u *Service) ListPersonalAccessTokens(ctx context.Context, id string) ([]*entity.PersonalAccessToken, error) {
+	if err := entity.NewValidator().ValidateID(id); err != nil {
+		return nil, fmt.Errorf("%s: invalid token request: %w", err, ErrInvalidRequest)
+	}
+
+	stored, err := u.PersonalAccessTokenRepository.FetchAllByUserID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", err, ErrSystemError)
+	}
+
+	tokens := make([]*entity.PersonalAccessToken, len(stored))
+	for i, d := range stored {
+		t, err := entity.NewFactory().FromPersonalAccessTokenDTO(d)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", err, ErrSystemError)
+		}
+		tokens[i] = t
+	}
+
+	return tokens, nil
+}
+
+func (u *Service) RevokePersonalAccessToken(ctx context.Context, id string, tokenID string) error {
+	if err := entity.NewValidator().ValidateID(id); err != nil {
+		return fmt.Errorf("%s: invalid revoke request: %w", err, ErrInvalidRequest)
+	}
+
+	if err := entity.NewValidator().ValidateID(tokenID); err != nil {
+		return fmt.Errorf("%s: invalid revoke request: %w", err, ErrInvalidRequest)
+	}
+
+	// tokens of other users are reported as unknown
+	err := u.PersonalAccessTokenRepository.Delete(ctx, id, tokenID)
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return fmt.Errorf("unknown personal access token: %w", ErrNotFound)
+	case err != nil:
+		return fmt.Errorf("%s: %w", err, ErrSystemError)
+	}
+
+	return nil
+}
+
+func (u *Service) RevokeToken(ctx context.Context, refreshToken string) error {
+	if err := entity.NewValidator().ValidateToken(refreshToken); err != nil {
+		return fmt.Errorf("%s: invalid revoke request: %w", err, ErrInvalidRequest)
+	}
+
+	claims, err := u.parseToken(refreshToken)
+	if err != nil {
+		return err
+	}
+
+	jti, ok := claims["jti"].(string)
+	if !ok {
+		return fmt.Errorf("invalid claims: %w", ErrUnauthorized)
+	}
+
+	stored, err := u.RefreshTokenRepository.FetchByID(ctx, jti)
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return fmt.Errorf("unknown refresh token: %w", ErrUnauthorized)
+	case err != nil:
+		return fmt.Errorf("%s: %w", err, ErrSystemError)
+	}
+
+	// revoke the whole family, so rotated siblings of this session die too
+	if err := u.revokeFamily(ctx, stored.FamilyID); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (u *Service) RevokeAllTokens(ctx context.Context, id string) error {
+	if err := entity.NewValidator().ValidateID(id); err != nil {
+		return fmt.Errorf("%s: invalid revoke request: %w", err, ErrInvalidRequest)
+	}
+
+	// bumping the generation invalidates every access token issued so far
+	if err := u.TokenGenerationRepository.Increment(ctx, id); err != nil {
+		return fmt.Errorf("%s: %w", err, ErrSystemError)
+	}
+
+	if err := u.RefreshTokenRepository.RevokeAllByUser(ctx, id); err != nil {
+		return fmt.Errorf("%s: %w", err, ErrSystemError)
+	}
+
+	if err := u.SessionRepository.RevokeAllByUser(ctx, id); err != nil {
+		return fmt.Errorf("%s: %w", err, ErrSystemError)
+	}
+
+	return nil
+}
+
+// ListSessions returns the sessions of the user which can still be refreshed.
+func (u *Service) ListSessions(ctx context.Context, id string) ([]*entity.Session, error) {
+	if err := entity.NewValidator().ValidateID(id); err != nil {
+		return nil, fmt.Errorf("%s: invalid session request: %w", err, ErrInvalidRequest)
+	}
+
+	stored, err := u.SessionRepository.FetchActiveByUserID(ctx, id, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", err, ErrSystemError)
+	}
+
+	sessions := make([]*entity.Session, len(stored))
+	for i, d := range stored {
+		s, err := entity.NewFactory().FromSessionDTO(d)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", err, ErrSystemError)
+		}
+		sessions[i] = s
+	}
+
+	return sessions, nil
+}
+
+// RevokeSession logs the session out, its refresh tokens stop working.
+// Access tokens already issued to it stay valid until they expire.
+func (u *Service) RevokeSession(ctx context.Context, id string, sessionID string) error {
+	if err := entity.NewValidator().ValidateID(id); err != nil {
+		return fmt.Errorf("%s: invalid revoke request: %w", err, ErrInvalidRequest)
+	}
+
+	if err := entity.NewValidator().ValidateID(sessionID); err != nil {
+		return fmt.Errorf("%s: invalid revoke request: %w", err, ErrInvalidRequest)
+	}
+
+	stored, err := u.SessionRepository.FetchByID(ctx, sessionID)
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return fmt.Errorf("unknown session: %w", ErrNotFound)
+	case err != nil:
+		return fmt.Errorf("%s: %w", err, ErrSystemError)
+	}
+
+	session, err := entity.NewFactory().FromSessionDTO(stored)
+	if err != nil {
+		return fmt.Errorf("%s: %w", err, ErrSystemError)
+	}
+
+	// sessions of other users, and ended ones, are reported as unknown
+	if session.UserID != id || !session.Active(time.Now()) {
+		return fmt.Errorf("unknown session: %w", ErrNotFound)
+	}
+
+	return u.revokeFamily(ctx, session.ID)
+}
+
+func (u *Service) PublicKeys(ctx context.Context) ([]*jwk.Key, error) {
+	// HMAC mode has no public key to share
+	if u.Keys == nil {
+		return []*jwk.Key{}, nil
+	}
+
+	return u.Keys.Public(), nil
+}
+
+func (u *Service) issueTokenPair(ctx context.Context, id string, familyID string) (*entity.AuthTokenPair, error) {
+	account, err := u.fetchAccount(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	generation, err := u.fetchGeneration(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
 	now := time.Now()
 
 	// Set claims
 	// This is the information which frontend can use
 	// The backend can also decode the token and get admin etc.
-	claims := token.Claims.(jwt.MapClaims)
+	claims := jwt.MapClaims{}
 	claims["id"] = id
+	claims["gen"] = generation
+	claims["scope"] = strings.Join(entity.AllScopes(), scopeSeparator)
+	claims["roles"] = strings.Join(account.Roles, scopeSeparator)
+	claims["sid"] = familyID
 	claims["exp"] = now.Add(u.AccessTokenDuration).Unix()
 
 	// Generate encoded token and send it as response.
-	// The signing string should be secret.
-	t, err := token.SignedString([]byte(u.Secret))
+	t, err := u.signToken(claims)
 	if err != nil {
 		return nil, fmt.Errorf("%s: generate token error: %w", err, ErrSystemError)
 	}
 
-	refreshToken := jwt.New(jwt.SigningMethodHS256)
-	rtClaims := refreshToken.Claims.(jwt.MapClaims)
+	// refresh token is stored, so it can be rotated and revoked
+	stored, err := entity.NewFactory().NewRefreshToken(id, familyID, u.RefreshTokenDuration)
+	if err != nil {
+		return nil, fmt.Errorf("%s: generate refresh token error: %w", err, ErrSystemError)
+	}
+
+	if err := stored.Valid(); err != nil {
+		return nil, fmt.Errorf("%s: generate refresh token error: %w", err, ErrInvalidRequest)
+	}
+
+	storedDTO := dto.NewFactory().NewRefreshToken(stored.ID, stored.FamilyID, stored.UserID, stored.Rotated, stored.Revoked, stored.ExpiresAt, stored.CreatedAt)
+	if err := u.RefreshTokenRepository.Store(ctx, storedDTO); err != nil {
+		return nil, fmt.Errorf("%s: %w", err, ErrSystemError)
+	}
+
+	rtClaims := jwt.MapClaims{}
 	rtClaims["id"] = id
-	rtClaims["exp"] = now.Add(u.RefreshTokenDuration).Unix()
+	rtClaims["jti"] = stored.ID
+	rtClaims["fid"] = stored.FamilyID
+	rtClaims["gen"] = generation
+	rtClaims["exp"] = stored.ExpiresAt.Unix()
 
-	rt, err := refreshToken.SignedString([]byte(u.Secret))
+	rt, err := u.signToken(rtClaims)
 	if err != nil {
 		return nil, fmt.Errorf("%s: generate refresh token error: %w", err, ErrSystemError)
 	}
@@ -82,25 +641,47 @@ func (u *Service) GenereateToken(ctx context.Context, id string) (*entity.AuthTo
 	return tokens, nil
 }
 
-func (u *Service) RefreshToken(ctx context.Context, refreshToken string) (*entity.AuthTokenPair, error) {
-	if err := entity.NewValidator().ValidateToken(refreshToken); err != nil {
-		return nil, fmt.Errorf("%s: invalid refresh request: %w", err, ErrInvalidRequest)
+// startSession records the client which logged in, the session is the refresh token family.
+func (u *Service) startSession(ctx context.Context, id string, familyID string) error {
+	client := clientinfo.FromContext(ctx)
+
+	session, err := entity.NewFactory().NewSession(id, familyID, clientinfo.Label(client.UserAgent), client.UserAgent, client.IP, time.Now().Add(u.RefreshTokenDuration))
+	if err != nil {
+		return fmt.Errorf("%s: generate session error: %w", err, ErrSystemError)
+	}
+
+	if err := session.Valid(); err != nil {
+		return fmt.Errorf("%s: generate session error: %w", err, ErrSystemError)
+	}
+
+	sessionDTO := dto.NewFactory().NewSession(session.ID, session.UserID, session.Label, session.UserAgent, session.IP, session.Revoked, session.LastSeenAt, session.ExpiresAt, session.CreatedAt)
+	if err := u.SessionRepository.Store(ctx, sessionDTO); err != nil {
+		return fmt.Errorf("%s: %w", err, ErrSystemError)
+	}
+
+	return nil
+}
+
+// revokeFamily ends the session, with every refresh token issued to it.
+func (u *Service) revokeFamily(ctx context.Context, familyID string) error {
+	if err := u.RefreshTokenRepository.RevokeFamily(ctx, familyID); err != nil {
+		return fmt.Errorf("%s: %w", err, ErrSystemError)
+	}
+
+	if err := u.SessionRepository.Revoke(ctx, familyID); err != nil {
+		return fmt.Errorf("%s: %w", err, ErrSystemError)
 	}
 
+	return nil
+}
+
+func (u *Service) parseToken(tokenString string) (jwt.MapClaims, error) {
 	// Parse takes the token string and a function for looking up the key.
 	// The latter is especially useful if you use multiple keys for your application.
 	// The standard is to use 'kid' in the head of the token to identify
 	// which key to use, but the parsed token (head and claims) is provided
 	// to the callback, providing flexibility.
-	token, err := jwt.Parse(refreshToken, func(token *jwt.Token) (interface{}, error) {
-		// Don't forget to validate the alg is what you expect:
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("Unexpected signing method(%v): %w", token.Header["alg"], ErrInvalidRequest)
-		}
-
-		// hmacSampleSecret is a []byte containing your secret, e.g. []byte("secret")
-		return []byte(u.Secret), nil
-	})
+	token, err := jwt.Parse(tokenString, u.verificationKey)
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", err, ErrUnauthorized)
 	}
@@ -114,49 +695,156 @@ func (u *Service) RefreshToken(ctx context.Context, refreshToken string) (*entit
 		return nil, fmt.Errorf("invalid claims: %w", ErrUnauthorized)
 	}
 
-	id, ok := claims["id"].(string)
-	if !ok {
-		return nil, fmt.Errorf("invalid claims: %w", ErrUnauthorized)
+	return claims, nil
+}
+
+func (u *Service) verifyPersonalAccessToken(ctx context.Context, token string) (*entity.AuthClaims, error) {
+	stored, err := u.PersonalAccessTokenRepository.FetchByHash(ctx, crypt.HashToken(token))
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return nil, fmt.Errorf("unknown personal access token: %w", ErrUnauthorized)
+	case err != nil:
+		return nil, fmt.Errorf("%s: %w", err, ErrSystemError)
 	}
 
-	newTokenPair, err := u.GenereateToken(ctx, id)
+	t, err := entity.NewFactory().FromPersonalAccessTokenDTO(stored)
 	if err != nil {
-		return nil, fmt.Errorf("%s: %w", err, ErrUnauthorized)
+		return nil, fmt.Errorf("%s: %w", err, ErrSystemError)
 	}
 
-	return newTokenPair, nil
+	now := time.Now()
+	if !t.Usable(now) {
+		return nil, fmt.Errorf("personal access token expired: %w", ErrUnauthorized)
+	}
+
+	// unlike access tokens, personal access tokens survive the logout of disabled users
+	if _, err := u.fetchAccount(ctx, t.UserID); err != nil {
+		return nil, err
+	}
+
+	// usage tracking is informational, failing to record it must not reject the request
+	if err := u.PersonalAccessTokenRepository.UpdateLastUsed(ctx, t.ID, now); err != nil {
+		log.LoggerWithSpan(ctx).WithError(err).Warn("fail to record personal access token usage")
+	}
+
+	// roles are for interactive sessions, personal access tokens carry none
+	return entity.NewFactory().NewAuthClaims(t.UserID, "", nil, t.Scopes, t.ExpiresAt), nil
 }
 
-func (u *Service) VerifyToken(ctx context.Context, accessToken string) (string, error) {
-	if err := entity.NewValidator().ValidateToken(accessToken); err != nil {
-		return "", fmt.Errorf("%s: invalid verify request: %w", err, ErrInvalidRequest)
+func (u *Service) sessionActive(ctx context.Context, sessionID string) (bool, error) {
+	stored, err := u.SessionRepository.FetchByID(ctx, sessionID)
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return false, nil
+	case err != nil:
+		return false, fmt.Errorf("%s: %w", err, ErrSystemError)
 	}
 
-	token, err := jwt.Parse(accessToken, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("Unexpected signing method(%v): %w", token.Header["alg"], ErrInvalidRequest)
-		}
+	session, err := entity.NewFactory().FromSessionDTO(stored)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", err, ErrSystemError)
+	}
 
-		return []byte(u.Secret), nil
-	})
+	return session.Active(time.Now()), nil
+}
+
+// tokenType returns the typ claim, access and refresh tokens carry none.
+func tokenType(claims jwt.MapClaims) string {
+	typ, _ := claims["typ"].(string)
+	return typ
+}
 
+// fetchAccount returns the account tokens are issued to, ErrUnauthorized when it is unknown or disabled.
+func (u *Service) fetchAccount(ctx context.Context, id string) (*entity.Account, error) {
+	stored, err := u.AccountRepository.FetchByUserID(ctx, id)
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return nil, fmt.Errorf("unknown account: %w", ErrUnauthorized)
+	case err != nil:
+		return nil, fmt.Errorf("%s: %w", err, ErrSystemError)
+	}
+
+	account, err := entity.NewFactory().FromAccountDTO(stored)
 	if err != nil {
-		return "", fmt.Errorf("%s: %w", err, ErrUnauthorized)
+		return nil, fmt.Errorf("%s: %w", err, ErrSystemError)
 	}
 
-	if !token.Valid {
-		return "", fmt.Errorf("invalid token: %w", ErrUnauthorized)
+	if account.Disabled() {
+		return nil, fmt.Errorf("account disabled: %w", ErrUnauthorized)
 	}
 
-	claims, ok := token.Claims.(jwt.MapClaims)
+	return account, nil
+}
+
+func (u *Service) fetchGeneration(ctx context.Context, id string) (int64, error) {
+	generation, err := u.TokenGenerationRepository.FetchByUserID(ctx, id)
+	switch {
+	case errors.Is(err, ErrNotFound):
+		// user never logged out everywhere
+		return 0, nil
+	case err != nil:
+		return 0, fmt.Errorf("%s: %w", err, ErrSystemError)
+	}
+
+	return generation, nil
+}
+
+func (u *Service) verifyGeneration(ctx context.Context, id string, claims jwt.MapClaims) error {
+	// tokens issued before generations existed carry no claim, they belong to generation 0
+	var tokenGeneration int64
+	if gen, ok := claims["gen"].(float64); ok {
+		tokenGeneration = int64(gen)
+	}
+
+	generation, err := u.fetchGeneration(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if tokenGeneration != generation {
+		return fmt.Errorf("token generation mismatch: %w", ErrUnauthorized)
+	}
+
+	return nil
+}
+
+func (u *Service) signToken(claims jwt.MapClaims) (string, error) {
+	// HMAC mode, the signing string should be secret.
+	if u.Keys == nil || u.Keys.Signing == nil {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(u.Secret))
+	}
+
+	// asymmetric mode, kid tells verifiers which public key to use
+	token := jwt.NewWithClaims(u.Keys.Signing.SigningMethod(), claims)
+	token.Header["kid"] = u.Keys.Signing.ID
+	return token.SignedString(u.Keys.Signing.PrivateKey)
+}
+
+func (u *Service) verificationKey(token *jwt.Token) (interface{}, error) {
+	// tokens without kid are HMAC tokens, accepted as long as a secret is configured
+	kid, ok := token.Header["kid"].(string)
 	if !ok {
-		return "", fmt.Errorf("invalid claims: %w", ErrUnauthorized)
+		// Don't forget to validate the alg is what you expect:
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok || u.Secret == "" {
+			return nil, fmt.Errorf("Unexpected signing method(%v): %w", token.Header["alg"], ErrInvalidRequest)
+		}
+
+		return []byte(u.Secret), nil
 	}
 
-	id, ok := claims["id"].(string)
+	if u.Keys == nil {
+		return nil, fmt.Errorf("unknown key(%s): %w", kid, ErrInvalidRequest)
+	}
+
+	key, ok := u.Keys.Lookup(kid)
 	if !ok {
-		return "", fmt.Errorf("invalid claims: %w", ErrUnauthorized)
+		return nil, fmt.Errorf("unknown key(%s): %w", kid, ErrInvalidRequest)
 	}
 
-	return id, nil
+	// the key decides the algorithm, never the token
+	if token.Method.Alg() != key.Algorithm {
+		return nil, fmt.Errorf("Unexpected signing method(%v) for key(%s): %w", token.Header["alg"], kid, ErrInvalidRequest)
+	}
+
+	return key.PublicKey, nil
 }
@@ -2,20 +2,68 @@ package auth
 
 import (
 	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
 	"fmt"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/org39/webapp-tutorial-backend/entity"
+	"github.com/org39/webapp-tutorial-backend/entity/dto"
+	"github.com/org39/webapp-tutorial-backend/pkg/clientinfo"
+	"github.com/org39/webapp-tutorial-backend/pkg/crypt"
+	"github.com/org39/webapp-tutorial-backend/pkg/jwk"
+	"github.com/org39/webapp-tutorial-backend/usecase/auth/mocks"
+
+	"github.com/dgrijalva/jwt-go"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/suite"
 )
 
+const (
+	testIntrospectionClientID     = "todo-service"
+	testIntrospectionClientSecret = "client-secret"
+)
+
 type AuthServiceTestSuite struct {
 	suite.Suite
-	Usecase Usecase
+	Usecase                       Usecase
+	RefreshTokenRepository        *mocks.RefreshTokenRepository
+	TokenGenerationRepository     *mocks.TokenGenerationRepository
+	PersonalAccessTokenRepository *mocks.PersonalAccessTokenRepository
+	SessionRepository             *mocks.SessionRepository
+	AccountRepository             *mocks.AccountRepository
 }
 
 func (s *AuthServiceTestSuite) SetupTest() {
-	usecase, err := NewService(WithSecret("top-secret"))
+	s.RefreshTokenRepository = new(mocks.RefreshTokenRepository)
+	s.TokenGenerationRepository = new(mocks.TokenGenerationRepository)
+	s.PersonalAccessTokenRepository = new(mocks.PersonalAccessTokenRepository)
+	s.SessionRepository = new(mocks.SessionRepository)
+	s.AccountRepository = new(mocks.AccountRepository)
+
+	// nobody logged out everywhere by default
+	s.TokenGenerationRepository.On("FetchByUserID", mock.Anything, mock.AnythingOfType("string")).Return(int64(0), ErrNotFound)
+
+	// nor has a role or was disabled
+	s.AccountRepository.On("FetchByUserID", mock.Anything, mock.AnythingOfType("string")).
+		Return(func(ctx context.Context, userID string) *dto.Account {
+			return dto.NewFactory().NewAccount(userID, []string{}, nil)
+		}, nil)
+
+	usecase, err := NewService(
+		WithSecret("top-secret"),
+		WithMFATokenDuration(5*time.Minute),
+		WithRefreshTokenRepository(s.RefreshTokenRepository),
+		WithTokenGenerationRepository(s.TokenGenerationRepository),
+		WithSessionRepository(s.SessionRepository),
+		WithAccountRepository(s.AccountRepository),
+		WithPersonalAccessTokenRepository(s.PersonalAccessTokenRepository),
+		WithIntrospectionClients(entity.NewFactory().NewIntrospectionClient(testIntrospectionClientID, crypt.HashToken(testIntrospectionClientSecret))),
+	)
 	if err != nil {
 		assert.Fail(s.T(), fmt.Sprintf("fail to create usecase: %s", err))
 	}
@@ -23,15 +71,30 @@ func (s *AuthServiceTestSuite) SetupTest() {
 	s.Usecase = usecase
 }
 
+// captureStore records refresh tokens stored by the usecase, the sessions they start are accepted
+func (s *AuthServiceTestSuite) captureStore(ctx context.Context, stored *[]*dto.RefreshToken) {
+	s.RefreshTokenRepository.On("Store", ctx, mock.AnythingOfType("*dto.RefreshToken")).
+		Run(func(args mock.Arguments) {
+			*stored = append(*stored, args.Get(1).(*dto.RefreshToken))
+		}).
+		Return(nil)
+	s.SessionRepository.On("Store", ctx, mock.AnythingOfType("*dto.Session")).Return(nil)
+}
+
 func (s *AuthServiceTestSuite) TestSuccessGenereateToken() {
 	ctx := context.Background()
 	id := "7d8b78d7-6ede-4b8f-8492-49f227ba63ba"
 
+	stored := []*dto.RefreshToken{}
+	s.captureStore(ctx, &stored)
+
 	// assert
 	tokenPair, err := s.Usecase.GenereateToken(ctx, id)
 	assert.NoError(s.T(), err)
 	assert.NotEmpty(s.T(), tokenPair.AccessToken)
 	assert.NotEmpty(s.T(), tokenPair.RefreshToken)
+	assert.Len(s.T(), stored, 1)
+	assert.Equal(s.T(), id, stored[0].UserID)
 }
 
 func (s *AuthServiceTestSuite) TestFailGenereateTokenWithInvalidID() {
@@ -48,40 +111,883 @@ func (s *AuthServiceTestSuite) TestSuccessRefreshWithValidToken() {
 	ctx := context.Background()
 	id := "7d8b78d7-6ede-4b8f-8492-49f227ba63ba"
 
-	// assert
+	stored := []*dto.RefreshToken{}
+	s.captureStore(ctx, &stored)
+
 	tokenPair, err := s.Usecase.GenereateToken(ctx, id)
 	assert.NoError(s.T(), err)
-	assert.NotEmpty(s.T(), tokenPair.AccessToken)
-	assert.NotEmpty(s.T(), tokenPair.RefreshToken)
+	assert.Len(s.T(), stored, 1)
+
+	s.RefreshTokenRepository.On("FetchByID", ctx, stored[0].ID).Return(stored[0], nil)
+	s.RefreshTokenRepository.On("Rotate", ctx, stored[0]).Return(nil)
+	s.SessionRepository.On("Touch", ctx, stored[0].FamilyID, "", mock.AnythingOfType("time.Time"), mock.AnythingOfType("time.Time")).Return(nil)
 
+	// assert
 	newTokenPair, err := s.Usecase.RefreshToken(ctx, tokenPair.RefreshToken)
 	assert.NoError(s.T(), err)
 	assert.NotEmpty(s.T(), newTokenPair.AccessToken)
 	assert.NotEmpty(s.T(), newTokenPair.RefreshToken)
+	assert.NotEqual(s.T(), tokenPair.RefreshToken, newTokenPair.RefreshToken)
+
+	// new token belongs to the same family
+	assert.Len(s.T(), stored, 2)
+	assert.Equal(s.T(), stored[0].FamilyID, stored[1].FamilyID)
+	s.RefreshTokenRepository.AssertExpectations(s.T())
+}
+
+func (s *AuthServiceTestSuite) TestFailRefreshWithReusedToken() {
+	ctx := context.Background()
+	id := "7d8b78d7-6ede-4b8f-8492-49f227ba63ba"
+
+	stored := []*dto.RefreshToken{}
+	s.captureStore(ctx, &stored)
+
+	tokenPair, err := s.Usecase.GenereateToken(ctx, id)
+	assert.NoError(s.T(), err)
+	assert.Len(s.T(), stored, 1)
+
+	rotated := *stored[0]
+	rotated.Rotated = true
+	s.RefreshTokenRepository.On("FetchByID", ctx, stored[0].ID).Return(&rotated, nil)
+	s.RefreshTokenRepository.On("RevokeFamily", ctx, stored[0].FamilyID).Return(nil)
+	s.SessionRepository.On("Revoke", ctx, stored[0].FamilyID).Return(nil)
+
+	// assert
+	newTokenPair, err := s.Usecase.RefreshToken(ctx, tokenPair.RefreshToken)
+	assert.ErrorIs(s.T(), err, ErrUnauthorized)
+	assert.Nil(s.T(), newTokenPair)
+	s.RefreshTokenRepository.AssertExpectations(s.T())
+}
+
+func (s *AuthServiceTestSuite) TestFailRefreshWithRevokedToken() {
+	ctx := context.Background()
+	id := "7d8b78d7-6ede-4b8f-8492-49f227ba63ba"
+
+	stored := []*dto.RefreshToken{}
+	s.captureStore(ctx, &stored)
+
+	tokenPair, err := s.Usecase.GenereateToken(ctx, id)
+	assert.NoError(s.T(), err)
+	assert.Len(s.T(), stored, 1)
+
+	revoked := *stored[0]
+	revoked.Revoked = true
+	s.RefreshTokenRepository.On("FetchByID", ctx, stored[0].ID).Return(&revoked, nil)
+
+	// assert
+	newTokenPair, err := s.Usecase.RefreshToken(ctx, tokenPair.RefreshToken)
+	assert.ErrorIs(s.T(), err, ErrUnauthorized)
+	assert.Nil(s.T(), newTokenPair)
+	s.RefreshTokenRepository.AssertNotCalled(s.T(), "Rotate", ctx, mock.Anything)
+}
+
+func (s *AuthServiceTestSuite) TestFailRefreshWithConcurrentRotation() {
+	ctx := context.Background()
+	id := "7d8b78d7-6ede-4b8f-8492-49f227ba63ba"
+
+	stored := []*dto.RefreshToken{}
+	s.captureStore(ctx, &stored)
+
+	tokenPair, err := s.Usecase.GenereateToken(ctx, id)
+	assert.NoError(s.T(), err)
+	assert.Len(s.T(), stored, 1)
+
+	s.RefreshTokenRepository.On("FetchByID", ctx, stored[0].ID).Return(stored[0], nil)
+	s.RefreshTokenRepository.On("Rotate", ctx, stored[0]).Return(ErrNotFound)
+	s.RefreshTokenRepository.On("RevokeFamily", ctx, stored[0].FamilyID).Return(nil)
+	s.SessionRepository.On("Revoke", ctx, stored[0].FamilyID).Return(nil)
+
+	// assert
+	newTokenPair, err := s.Usecase.RefreshToken(ctx, tokenPair.RefreshToken)
+	assert.ErrorIs(s.T(), err, ErrUnauthorized)
+	assert.Nil(s.T(), newTokenPair)
+	s.RefreshTokenRepository.AssertExpectations(s.T())
+}
+
+func (s *AuthServiceTestSuite) TestFailRefreshWithUnknownToken() {
+	ctx := context.Background()
+	id := "7d8b78d7-6ede-4b8f-8492-49f227ba63ba"
+
+	stored := []*dto.RefreshToken{}
+	s.captureStore(ctx, &stored)
+
+	tokenPair, err := s.Usecase.GenereateToken(ctx, id)
+	assert.NoError(s.T(), err)
+	assert.Len(s.T(), stored, 1)
+
+	s.RefreshTokenRepository.On("FetchByID", ctx, stored[0].ID).Return(nil, ErrNotFound)
+
+	// assert
+	newTokenPair, err := s.Usecase.RefreshToken(ctx, tokenPair.RefreshToken)
+	assert.ErrorIs(s.T(), err, ErrUnauthorized)
+	assert.Nil(s.T(), newTokenPair)
 }
 
 func (s *AuthServiceTestSuite) TestSuccessVerifyWithValidToken() {
 	ctx := context.Background()
 	id := "7d8b78d7-6ede-4b8f-8492-49f227ba63ba"
 
+	stored := []*dto.RefreshToken{}
+	s.captureStore(ctx, &stored)
+
 	// assert
 	tokenPair, err := s.Usecase.GenereateToken(ctx, id)
 	assert.NoError(s.T(), err)
 	assert.NotEmpty(s.T(), tokenPair.AccessToken)
 	assert.NotEmpty(s.T(), tokenPair.RefreshToken)
 
-	verifiedID, err := s.Usecase.VerifyToken(ctx, tokenPair.AccessToken)
+	claims, err := s.Usecase.VerifyToken(ctx, tokenPair.AccessToken)
 	assert.NoError(s.T(), err)
-	assert.Equal(s.T(), id, verifiedID)
+	assert.Equal(s.T(), id, claims.UserID)
+	assert.ElementsMatch(s.T(), entity.AllScopes(), claims.Scopes)
+}
+
+func (s *AuthServiceTestSuite) TestVerifyGrantsNoScopeWithoutScopeClaim() {
+	ctx := context.Background()
+	id := "7d8b78d7-6ede-4b8f-8492-49f227ba63ba"
+
+	stored := []*dto.RefreshToken{}
+	s.captureStore(ctx, &stored)
+
+	tokenPair, err := s.Usecase.GenereateToken(ctx, id)
+	assert.NoError(s.T(), err)
+
+	// token issued before scopes existed
+	legacy, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"id":  id,
+		"exp": time.Now().Add(time.Minute).Unix(),
+	}).SignedString([]byte("top-secret"))
+	assert.NoError(s.T(), err)
+
+	// assert
+	for _, token := range []string{legacy, tokenPair.RefreshToken} {
+		claims, err := s.Usecase.VerifyToken(ctx, token)
+		assert.NoError(s.T(), err)
+		assert.Equal(s.T(), id, claims.UserID)
+		assert.Empty(s.T(), claims.Scopes)
+		assert.False(s.T(), claims.HasScopes(entity.ScopeUserRead))
+	}
 }
 
 func (s *AuthServiceTestSuite) TestFailVerifyWithInvalidToken() {
 	ctx := context.Background()
 	token := "invalid-token"
 
-	id, err := s.Usecase.VerifyToken(ctx, token)
+	claims, err := s.Usecase.VerifyToken(ctx, token)
+	assert.ErrorIs(s.T(), err, ErrUnauthorized)
+	assert.Nil(s.T(), claims)
+}
+
+func (s *AuthServiceTestSuite) TestFailVerifyAfterGenerationBumped() {
+	ctx := context.Background()
+	id := "7d8b78d7-6ede-4b8f-8492-49f227ba63ba"
+
+	stored := []*dto.RefreshToken{}
+	s.captureStore(ctx, &stored)
+
+	tokenPair, err := s.Usecase.GenereateToken(ctx, id)
+	assert.NoError(s.T(), err)
+
+	// user logged out everywhere
+	s.TokenGenerationRepository.ExpectedCalls = nil
+	s.TokenGenerationRepository.On("FetchByUserID", ctx, id).Return(int64(1), nil)
+
+	// assert
+	claims, err := s.Usecase.VerifyToken(ctx, tokenPair.AccessToken)
+	assert.ErrorIs(s.T(), err, ErrUnauthorized)
+	assert.Nil(s.T(), claims)
+
+	newTokenPair, err := s.Usecase.RefreshToken(ctx, tokenPair.RefreshToken)
+	assert.ErrorIs(s.T(), err, ErrUnauthorized)
+	assert.Nil(s.T(), newTokenPair)
+}
+
+func (s *AuthServiceTestSuite) TestSuccessRevokeToken() {
+	ctx := context.Background()
+	id := "7d8b78d7-6ede-4b8f-8492-49f227ba63ba"
+
+	stored := []*dto.RefreshToken{}
+	s.captureStore(ctx, &stored)
+
+	tokenPair, err := s.Usecase.GenereateToken(ctx, id)
+	assert.NoError(s.T(), err)
+	assert.Len(s.T(), stored, 1)
+
+	s.RefreshTokenRepository.On("FetchByID", ctx, stored[0].ID).Return(stored[0], nil)
+	s.RefreshTokenRepository.On("RevokeFamily", ctx, stored[0].FamilyID).Return(nil)
+	s.SessionRepository.On("Revoke", ctx, stored[0].FamilyID).Return(nil)
+
+	// assert
+	err = s.Usecase.RevokeToken(ctx, tokenPair.RefreshToken)
+	assert.NoError(s.T(), err)
+	s.RefreshTokenRepository.AssertExpectations(s.T())
+}
+
+func (s *AuthServiceTestSuite) TestSuccessRevokeAllTokens() {
+	ctx := context.Background()
+	id := "7d8b78d7-6ede-4b8f-8492-49f227ba63ba"
+
+	s.TokenGenerationRepository.On("Increment", ctx, id).Return(nil)
+	s.RefreshTokenRepository.On("RevokeAllByUser", ctx, id).Return(nil)
+	s.SessionRepository.On("RevokeAllByUser", ctx, id).Return(nil)
+
+	// assert
+	err := s.Usecase.RevokeAllTokens(ctx, id)
+	assert.NoError(s.T(), err)
+	s.TokenGenerationRepository.AssertCalled(s.T(), "Increment", ctx, id)
+	s.RefreshTokenRepository.AssertExpectations(s.T())
+	s.SessionRepository.AssertExpectations(s.T())
+}
+
+func (s *AuthServiceTestSuite) TestSuccessGenereateTokenStartsSession() {
+	ctx := clientinfo.NewContext(context.Background(), &clientinfo.Info{
+		IP:        "192.0.2.1",
+		UserAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:92.0) Gecko/20100101 Firefox/92.0",
+	})
+	id := "7d8b78d7-6ede-4b8f-8492-49f227ba63ba"
+
+	stored := []*dto.RefreshToken{}
+	s.RefreshTokenRepository.On("Store", ctx, mock.AnythingOfType("*dto.RefreshToken")).
+		Run(func(args mock.Arguments) {
+			stored = append(stored, args.Get(1).(*dto.RefreshToken))
+		}).
+		Return(nil)
+
+	sessions := []*dto.Session{}
+	s.SessionRepository.On("Store", ctx, mock.AnythingOfType("*dto.Session")).
+		Run(func(args mock.Arguments) {
+			sessions = append(sessions, args.Get(1).(*dto.Session))
+		}).
+		Return(nil)
+
+	// assert
+	tokenPair, err := s.Usecase.GenereateToken(ctx, id)
+	assert.NoError(s.T(), err)
+	assert.Len(s.T(), sessions, 1)
+	assert.Equal(s.T(), stored[0].FamilyID, sessions[0].ID)
+	assert.Equal(s.T(), id, sessions[0].UserID)
+	assert.Equal(s.T(), "Firefox on Windows", sessions[0].Label)
+	assert.Equal(s.T(), "192.0.2.1", sessions[0].IP)
+
+	// access tokens tell which session they belong to
+	claims, err := s.Usecase.VerifyToken(ctx, tokenPair.AccessToken)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), sessions[0].ID, claims.SessionID)
+}
+
+// newUsecaseWithAccount returns a usecase which knows only the given account
+func (s *AuthServiceTestSuite) newUsecaseWithAccount(account *dto.Account) Usecase {
+	s.AccountRepository = new(mocks.AccountRepository)
+	s.AccountRepository.On("FetchByUserID", mock.Anything, account.UserID).Return(account, nil)
+
+	usecase, err := NewService(
+		WithSecret("top-secret"),
+		WithRefreshTokenRepository(s.RefreshTokenRepository),
+		WithTokenGenerationRepository(s.TokenGenerationRepository),
+		WithPersonalAccessTokenRepository(s.PersonalAccessTokenRepository),
+		WithSessionRepository(s.SessionRepository),
+		WithAccountRepository(s.AccountRepository),
+	)
+	if err != nil {
+		assert.Fail(s.T(), fmt.Sprintf("fail to create usecase: %s", err))
+	}
+	return usecase
+}
+
+func (s *AuthServiceTestSuite) TestSuccessVerifyWithRoles() {
+	ctx := context.Background()
+	id := "7d8b78d7-6ede-4b8f-8492-49f227ba63ba"
+
+	usecase := s.newUsecaseWithAccount(dto.NewFactory().NewAccount(id, []string{entity.RoleAdmin}, nil))
+
+	stored := []*dto.RefreshToken{}
+	s.captureStore(ctx, &stored)
+
+	tokenPair, err := usecase.GenereateToken(ctx, id)
+	assert.NoError(s.T(), err)
+
+	// assert
+	claims, err := usecase.VerifyToken(ctx, tokenPair.AccessToken)
+	assert.NoError(s.T(), err)
+	assert.True(s.T(), claims.HasRole(entity.RoleAdmin))
+}
+
+func (s *AuthServiceTestSuite) TestFailGenereateTokenForDisabledAccount() {
+	ctx := context.Background()
+	id := "7d8b78d7-6ede-4b8f-8492-49f227ba63ba"
+	disabledAt := time.Now()
+
+	usecase := s.newUsecaseWithAccount(dto.NewFactory().NewAccount(id, []string{}, &disabledAt))
+
+	// assert
+	tokenPair, err := usecase.GenereateToken(ctx, id)
 	assert.ErrorIs(s.T(), err, ErrUnauthorized)
-	assert.Empty(s.T(), id)
+	assert.Nil(s.T(), tokenPair)
+	s.RefreshTokenRepository.AssertNotCalled(s.T(), "Store", ctx, mock.Anything)
+	s.SessionRepository.AssertNotCalled(s.T(), "Store", ctx, mock.Anything)
+}
+
+func (s *AuthServiceTestSuite) newSessionDTO(id string, userID string, expiresAt time.Time) *dto.Session {
+	now := time.Now()
+	return dto.NewFactory().NewSession(id, userID, "Firefox on Windows", "Mozilla/5.0", "192.0.2.1", false, now, expiresAt, now)
+}
+
+func (s *AuthServiceTestSuite) TestSuccessListSessions() {
+	ctx := context.Background()
+	id := "7d8b78d7-6ede-4b8f-8492-49f227ba63ba"
+	sessionID := "4daaaea8-4721-4644-aaac-7958805b4530"
+
+	s.SessionRepository.On("FetchActiveByUserID", ctx, id, mock.AnythingOfType("time.Time")).
+		Return([]*dto.Session{s.newSessionDTO(sessionID, id, time.Now().Add(time.Hour))}, nil)
+
+	// assert
+	sessions, err := s.Usecase.ListSessions(ctx, id)
+	assert.NoError(s.T(), err)
+	assert.Len(s.T(), sessions, 1)
+	assert.Equal(s.T(), sessionID, sessions[0].ID)
+	assert.Equal(s.T(), "Firefox on Windows", sessions[0].Label)
+}
+
+func (s *AuthServiceTestSuite) TestSuccessRevokeSession() {
+	ctx := context.Background()
+	id := "7d8b78d7-6ede-4b8f-8492-49f227ba63ba"
+	sessionID := "4daaaea8-4721-4644-aaac-7958805b4530"
+
+	s.SessionRepository.On("FetchByID", ctx, sessionID).Return(s.newSessionDTO(sessionID, id, time.Now().Add(time.Hour)), nil)
+	s.RefreshTokenRepository.On("RevokeFamily", ctx, sessionID).Return(nil)
+	s.SessionRepository.On("Revoke", ctx, sessionID).Return(nil)
+
+	// assert
+	err := s.Usecase.RevokeSession(ctx, id, sessionID)
+	assert.NoError(s.T(), err)
+	s.RefreshTokenRepository.AssertExpectations(s.T())
+	s.SessionRepository.AssertExpectations(s.T())
+}
+
+func (s *AuthServiceTestSuite) TestFailRevokeSessionOfOtherUser() {
+	ctx := context.Background()
+	id := "7d8b78d7-6ede-4b8f-8492-49f227ba63ba"
+	otherID := "5c2dd83a-6250-40f3-a47e-21d957c07d06"
+	sessionID := "4daaaea8-4721-4644-aaac-7958805b4530"
+
+	s.SessionRepository.On("FetchByID", ctx, sessionID).Return(s.newSessionDTO(sessionID, otherID, time.Now().Add(time.Hour)), nil)
+
+	// assert
+	err := s.Usecase.RevokeSession(ctx, id, sessionID)
+	assert.ErrorIs(s.T(), err, ErrNotFound)
+	s.RefreshTokenRepository.AssertNotCalled(s.T(), "RevokeFamily", ctx, sessionID)
+}
+
+func (s *AuthServiceTestSuite) TestFailRevokeExpiredSession() {
+	ctx := context.Background()
+	id := "7d8b78d7-6ede-4b8f-8492-49f227ba63ba"
+	sessionID := "4daaaea8-4721-4644-aaac-7958805b4530"
+
+	s.SessionRepository.On("FetchByID", ctx, sessionID).Return(s.newSessionDTO(sessionID, id, time.Now().Add(-time.Hour)), nil)
+
+	// assert
+	err := s.Usecase.RevokeSession(ctx, id, sessionID)
+	assert.ErrorIs(s.T(), err, ErrNotFound)
+	assert.ErrorIs(s.T(), s.Usecase.RevokeSession(ctx, id, "not-an-id"), ErrInvalidRequest)
+}
+
+func (s *AuthServiceTestSuite) newUsecaseWithKeys(ks *jwk.KeySet, secret string) Usecase {
+	usecase, err := NewService(
+		WithSecret(secret),
+		WithKeySet(ks),
+		WithRefreshTokenRepository(s.RefreshTokenRepository),
+		WithTokenGenerationRepository(s.TokenGenerationRepository),
+		WithSessionRepository(s.SessionRepository),
+		WithAccountRepository(s.AccountRepository),
+	)
+	if err != nil {
+		assert.Fail(s.T(), fmt.Sprintf("fail to create usecase: %s", err))
+	}
+	return usecase
+}
+
+func (s *AuthServiceTestSuite) newRSAKey(id string) *jwk.Key {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(s.T(), err)
+	k, err := jwk.NewPrivateKey(id, privateKey)
+	assert.NoError(s.T(), err)
+	return k
+}
+
+func (s *AuthServiceTestSuite) newEd25519Key(id string) *jwk.Key {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(s.T(), err)
+	k, err := jwk.NewPrivateKey(id, privateKey)
+	assert.NoError(s.T(), err)
+	return k
+}
+
+func (s *AuthServiceTestSuite) TestSuccessVerifyWithAsymmetricKeys() {
+	ctx := context.Background()
+	id := "7d8b78d7-6ede-4b8f-8492-49f227ba63ba"
+
+	stored := []*dto.RefreshToken{}
+	s.captureStore(ctx, &stored)
+
+	cases := []*jwk.Key{
+		s.newRSAKey("rsa-1"),
+		s.newEd25519Key("ed-1"),
+	}
+
+	for _, key := range cases {
+		usecase := s.newUsecaseWithKeys(jwk.NewKeySet(key), "")
+
+		tokenPair, err := usecase.GenereateToken(ctx, id)
+		assert.NoError(s.T(), err)
+
+		claims, err := usecase.VerifyToken(ctx, tokenPair.AccessToken)
+		assert.NoError(s.T(), err)
+		assert.Equal(s.T(), id, claims.UserID)
+
+		keys, err := usecase.PublicKeys(ctx)
+		assert.NoError(s.T(), err)
+		assert.Len(s.T(), keys, 1)
+		assert.Equal(s.T(), key.ID, keys[0].ID)
+		assert.Nil(s.T(), keys[0].PrivateKey)
+	}
+}
+
+func (s *AuthServiceTestSuite) TestSuccessVerifyAfterKeyRotation() {
+	ctx := context.Background()
+	id := "7d8b78d7-6ede-4b8f-8492-49f227ba63ba"
+
+	stored := []*dto.RefreshToken{}
+	s.captureStore(ctx, &stored)
+
+	oldKey := s.newRSAKey("old")
+	newKey := s.newEd25519Key("new")
+
+	// token issued before rotation
+	tokenPair, err := s.newUsecaseWithKeys(jwk.NewKeySet(oldKey), "").GenereateToken(ctx, id)
+	assert.NoError(s.T(), err)
+
+	// assert, old key is still accepted for verification
+	rotated := s.newUsecaseWithKeys(jwk.NewKeySet(newKey, oldKey.Public()), "")
+	claims, err := rotated.VerifyToken(ctx, tokenPair.AccessToken)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), id, claims.UserID)
+
+	// assert, old key dropped
+	dropped := s.newUsecaseWithKeys(jwk.NewKeySet(newKey), "")
+	claims, err = dropped.VerifyToken(ctx, tokenPair.AccessToken)
+	assert.ErrorIs(s.T(), err, ErrUnauthorized)
+	assert.Nil(s.T(), claims)
+}
+
+func (s *AuthServiceTestSuite) TestHMACTokenAcceptedOnlyWithSecret() {
+	ctx := context.Background()
+	id := "7d8b78d7-6ede-4b8f-8492-49f227ba63ba"
+
+	stored := []*dto.RefreshToken{}
+	s.captureStore(ctx, &stored)
+
+	// token issued in HMAC mode
+	tokenPair, err := s.Usecase.GenereateToken(ctx, id)
+	assert.NoError(s.T(), err)
+
+	// assert, migrated to asymmetric keys but secret kept for backward compatibility
+	key := s.newRSAKey("rsa-1")
+	claims, err := s.newUsecaseWithKeys(jwk.NewKeySet(key), "top-secret").VerifyToken(ctx, tokenPair.AccessToken)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), id, claims.UserID)
+
+	// assert, secret removed
+	claims, err = s.newUsecaseWithKeys(jwk.NewKeySet(key), "").VerifyToken(ctx, tokenPair.AccessToken)
+	assert.ErrorIs(s.T(), err, ErrUnauthorized)
+	assert.Nil(s.T(), claims)
+}
+
+func (s *AuthServiceTestSuite) TestFailVerifyWithForgedKeyID() {
+	ctx := context.Background()
+	id := "7d8b78d7-6ede-4b8f-8492-49f227ba63ba"
+
+	stored := []*dto.RefreshToken{}
+	s.captureStore(ctx, &stored)
+
+	// attacker signs with own key but claims our kid
+	ours := s.newRSAKey("shared-kid")
+	theirs := s.newRSAKey("shared-kid")
+
+	tokenPair, err := s.newUsecaseWithKeys(jwk.NewKeySet(theirs), "").GenereateToken(ctx, id)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), 3, len(strings.Split(tokenPair.AccessToken, ".")))
+
+	// assert
+	claims, err := s.newUsecaseWithKeys(jwk.NewKeySet(ours), "").VerifyToken(ctx, tokenPair.AccessToken)
+	assert.ErrorIs(s.T(), err, ErrUnauthorized)
+	assert.Nil(s.T(), claims)
+}
+
+func (s *AuthServiceTestSuite) TestSuccessVerifyMFAToken() {
+	ctx := context.Background()
+	id := "7d8b78d7-6ede-4b8f-8492-49f227ba63ba"
+
+	mfaToken, err := s.Usecase.GenerateMFAToken(ctx, id)
+	assert.NoError(s.T(), err)
+
+	// assert
+	verifiedID, err := s.Usecase.VerifyMFAToken(ctx, mfaToken)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), id, verifiedID)
+}
+
+func (s *AuthServiceTestSuite) TestFailMFATokenAsAccessOrRefreshToken() {
+	ctx := context.Background()
+	id := "7d8b78d7-6ede-4b8f-8492-49f227ba63ba"
+
+	mfaToken, err := s.Usecase.GenerateMFAToken(ctx, id)
+	assert.NoError(s.T(), err)
+
+	// assert, password alone must not grant access
+	claims, err := s.Usecase.VerifyToken(ctx, mfaToken)
+	assert.ErrorIs(s.T(), err, ErrUnauthorized)
+	assert.Nil(s.T(), claims)
+
+	tokens, err := s.Usecase.RefreshToken(ctx, mfaToken)
+	assert.ErrorIs(s.T(), err, ErrUnauthorized)
+	assert.Nil(s.T(), tokens)
+}
+
+func (s *AuthServiceTestSuite) TestFailAccessTokenAsMFAToken() {
+	ctx := context.Background()
+	id := "7d8b78d7-6ede-4b8f-8492-49f227ba63ba"
+
+	stored := []*dto.RefreshToken{}
+	s.captureStore(ctx, &stored)
+
+	tokenPair, err := s.Usecase.GenereateToken(ctx, id)
+	assert.NoError(s.T(), err)
+
+	// assert
+	verifiedID, err := s.Usecase.VerifyMFAToken(ctx, tokenPair.AccessToken)
+	assert.ErrorIs(s.T(), err, ErrUnauthorized)
+	assert.Empty(s.T(), verifiedID)
+}
+
+func (s *AuthServiceTestSuite) TestFailExpiredMFAToken() {
+	ctx := context.Background()
+	id := "7d8b78d7-6ede-4b8f-8492-49f227ba63ba"
+
+	usecase, err := NewService(
+		WithSecret("top-secret"),
+		WithMFATokenDuration(-time.Minute),
+		WithRefreshTokenRepository(s.RefreshTokenRepository),
+		WithTokenGenerationRepository(s.TokenGenerationRepository),
+		WithSessionRepository(s.SessionRepository),
+		WithAccountRepository(s.AccountRepository),
+	)
+	assert.NoError(s.T(), err)
+
+	mfaToken, err := usecase.GenerateMFAToken(ctx, id)
+	assert.NoError(s.T(), err)
+
+	// assert
+	verifiedID, err := usecase.VerifyMFAToken(ctx, mfaToken)
+	assert.ErrorIs(s.T(), err, ErrUnauthorized)
+	assert.Empty(s.T(), verifiedID)
+}
+
+// createPersonalAccessToken issues a token and returns it with its stored record
+func (s *AuthServiceTestSuite) createPersonalAccessToken(ctx context.Context, id string, duration time.Duration) (string, *dto.PersonalAccessToken) {
+	var stored *dto.PersonalAccessToken
+	s.PersonalAccessTokenRepository.On("Store", ctx, mock.AnythingOfType("*dto.PersonalAccessToken")).
+		Run(func(args mock.Arguments) {
+			stored = args.Get(1).(*dto.PersonalAccessToken)
+		}).
+		Return(nil).
+		Once()
+
+	issued, err := s.Usecase.CreatePersonalAccessToken(ctx, id, "ci", []string{entity.ScopeTodosRead}, duration)
+	assert.NoError(s.T(), err)
+
+	return issued.Token, stored
+}
+
+func (s *AuthServiceTestSuite) TestSuccessCreatePersonalAccessToken() {
+	ctx := context.Background()
+	id := "7d8b78d7-6ede-4b8f-8492-49f227ba63ba"
+
+	token, stored := s.createPersonalAccessToken(ctx, id, 0)
+
+	// assert
+	assert.True(s.T(), strings.HasPrefix(token, entity.PersonalAccessTokenPrefix))
+	assert.Equal(s.T(), id, stored.UserID)
+	assert.Equal(s.T(), crypt.HashToken(token), stored.TokenHash)
+	assert.NotContains(s.T(), stored.TokenHash, token)
+	assert.Nil(s.T(), stored.ExpiresAt)
+	s.PersonalAccessTokenRepository.AssertExpectations(s.T())
+}
+
+func (s *AuthServiceTestSuite) TestFailCreatePersonalAccessTokenWithInvalidRequest() {
+	ctx := context.Background()
+	id := "7d8b78d7-6ede-4b8f-8492-49f227ba63ba"
+
+	cases := []struct {
+		name     string
+		scopes   []string
+		duration time.Duration
+	}{
+		{"", []string{entity.ScopeTodosRead}, 0},
+		{"ci", []string{}, 0},
+		{"ci", []string{"admin"}, 0},
+		{"ci", []string{entity.ScopeTodosRead}, -time.Hour},
+		{"ci", []string{entity.ScopeTodosRead}, 100 * 365 * 24 * time.Hour},
+	}
+	for _, c := range cases {
+		issued, err := s.Usecase.CreatePersonalAccessToken(ctx, id, c.name, c.scopes, c.duration)
+		assert.ErrorIs(s.T(), err, ErrInvalidRequest)
+		assert.Nil(s.T(), issued)
+	}
+
+	s.PersonalAccessTokenRepository.AssertNotCalled(s.T(), "Store", ctx, mock.Anything)
+}
+
+func (s *AuthServiceTestSuite) TestSuccessVerifyWithPersonalAccessToken() {
+	ctx := context.Background()
+	id := "7d8b78d7-6ede-4b8f-8492-49f227ba63ba"
+
+	token, stored := s.createPersonalAccessToken(ctx, id, time.Hour)
+	s.PersonalAccessTokenRepository.On("FetchByHash", ctx, crypt.HashToken(token)).Return(stored, nil)
+	s.PersonalAccessTokenRepository.On("UpdateLastUsed", ctx, stored.ID, mock.AnythingOfType("time.Time")).Return(nil)
+
+	// assert
+	claims, err := s.Usecase.VerifyToken(ctx, token)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), id, claims.UserID)
+	assert.Equal(s.T(), []string{entity.ScopeTodosRead}, claims.Scopes)
+	s.PersonalAccessTokenRepository.AssertExpectations(s.T())
+}
+
+func (s *AuthServiceTestSuite) TestFailVerifyPersonalAccessTokenOfDisabledAccount() {
+	ctx := context.Background()
+	id := "7d8b78d7-6ede-4b8f-8492-49f227ba63ba"
+	disabledAt := time.Now()
+
+	token, stored := s.createPersonalAccessToken(ctx, id, time.Hour)
+	s.PersonalAccessTokenRepository.On("FetchByHash", ctx, crypt.HashToken(token)).Return(stored, nil)
+	usecase := s.newUsecaseWithAccount(dto.NewFactory().NewAccount(id, []string{}, &disabledAt))
+
+	// assert
+	claims, err := usecase.VerifyToken(ctx, token)
+	assert.ErrorIs(s.T(), err, ErrUnauthorized)
+	assert.Nil(s.T(), claims)
+	s.PersonalAccessTokenRepository.AssertNotCalled(s.T(), "UpdateLastUsed", ctx, mock.Anything, mock.Anything)
+}
+
+func (s *AuthServiceTestSuite) TestSuccessVerifyWhenLastUsedUpdateFails() {
+	ctx := context.Background()
+	id := "7d8b78d7-6ede-4b8f-8492-49f227ba63ba"
+
+	token, stored := s.createPersonalAccessToken(ctx, id, 0)
+	s.PersonalAccessTokenRepository.On("FetchByHash", ctx, crypt.HashToken(token)).Return(stored, nil)
+	s.PersonalAccessTokenRepository.On("UpdateLastUsed", ctx, stored.ID, mock.AnythingOfType("time.Time")).Return(ErrDatabaseError)
+
+	// assert
+	claims, err := s.Usecase.VerifyToken(ctx, token)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), id, claims.UserID)
+}
+
+func (s *AuthServiceTestSuite) TestFailVerifyWithUnknownPersonalAccessToken() {
+	ctx := context.Background()
+	token := entity.PersonalAccessTokenPrefix + "unknown"
+
+	s.PersonalAccessTokenRepository.On("FetchByHash", ctx, crypt.HashToken(token)).Return(nil, ErrNotFound)
+
+	// assert
+	claims, err := s.Usecase.VerifyToken(ctx, token)
+	assert.ErrorIs(s.T(), err, ErrUnauthorized)
+	assert.Nil(s.T(), claims)
+}
+
+func (s *AuthServiceTestSuite) TestFailVerifyWithExpiredPersonalAccessToken() {
+	ctx := context.Background()
+	id := "7d8b78d7-6ede-4b8f-8492-49f227ba63ba"
+
+	token, stored := s.createPersonalAccessToken(ctx, id, time.Hour)
+	expired := *stored
+	expiresAt := time.Now().Add(-time.Minute)
+	expired.ExpiresAt = &expiresAt
+	s.PersonalAccessTokenRepository.On("FetchByHash", ctx, crypt.HashToken(token)).Return(&expired, nil)
+
+	// assert
+	claims, err := s.Usecase.VerifyToken(ctx, token)
+	assert.ErrorIs(s.T(), err, ErrUnauthorized)
+	assert.Nil(s.T(), claims)
+	s.PersonalAccessTokenRepository.AssertNotCalled(s.T(), "UpdateLastUsed", ctx, mock.Anything, mock.Anything)
+}
+
+func (s *AuthServiceTestSuite) TestSuccessListPersonalAccessTokens() {
+	ctx := context.Background()
+	id := "7d8b78d7-6ede-4b8f-8492-49f227ba63ba"
+
+	_, stored := s.createPersonalAccessToken(ctx, id, 0)
+	s.PersonalAccessTokenRepository.On("FetchAllByUserID", ctx, id).Return([]*dto.PersonalAccessToken{stored}, nil)
+
+	// assert
+	tokens, err := s.Usecase.ListPersonalAccessTokens(ctx, id)
+	assert.NoError(s.T(), err)
+	assert.Len(s.T(), tokens, 1)
+	assert.Equal(s.T(), stored.ID, tokens[0].ID)
+}
+
+func (s *AuthServiceTestSuite) TestRevokePersonalAccessToken() {
+	ctx := context.Background()
+	id := "7d8b78d7-6ede-4b8f-8492-49f227ba63ba"
+	tokenID := "4daaaea8-4721-4644-aaac-7958805b4530"
+	unknownID := "5c2dd83a-6250-40f3-a47e-21d957c07d06"
+
+	s.PersonalAccessTokenRepository.On("Delete", ctx, id, tokenID).Return(nil)
+	s.PersonalAccessTokenRepository.On("Delete", ctx, id, unknownID).Return(ErrNotFound)
+
+	// assert
+	assert.NoError(s.T(), s.Usecase.RevokePersonalAccessToken(ctx, id, tokenID))
+	assert.ErrorIs(s.T(), s.Usecase.RevokePersonalAccessToken(ctx, id, unknownID), ErrNotFound)
+	assert.ErrorIs(s.T(), s.Usecase.RevokePersonalAccessToken(ctx, id, "not-an-id"), ErrInvalidRequest)
+}
+
+func (s *AuthServiceTestSuite) TestSuccessIntrospectAccessToken() {
+	ctx := context.Background()
+	id := "7d8b78d7-6ede-4b8f-8492-49f227ba63ba"
+
+	stored := []*dto.RefreshToken{}
+	s.captureStore(ctx, &stored)
+
+	tokenPair, err := s.Usecase.GenereateToken(ctx, id)
+	assert.NoError(s.T(), err)
+	sessionID := stored[0].FamilyID
+	s.SessionRepository.On("FetchByID", ctx, sessionID).Return(s.newSessionDTO(sessionID, id, time.Now().Add(time.Hour)), nil)
+
+	// assert
+	introspection, err := s.Usecase.Introspect(ctx, testIntrospectionClientID, testIntrospectionClientSecret, tokenPair.AccessToken)
+	assert.NoError(s.T(), err)
+	assert.True(s.T(), introspection.Active)
+	assert.Equal(s.T(), id, introspection.Claims.UserID)
+	assert.Equal(s.T(), sessionID, introspection.Claims.SessionID)
+	assert.ElementsMatch(s.T(), entity.AllScopes(), introspection.Claims.Scopes)
+	assert.NotNil(s.T(), introspection.Claims.ExpiresAt)
+	assert.True(s.T(), introspection.Claims.ExpiresAt.After(time.Now()))
+}
+
+func (s *AuthServiceTestSuite) TestIntrospectRevokedSession() {
+	ctx := context.Background()
+	id := "7d8b78d7-6ede-4b8f-8492-49f227ba63ba"
+
+	stored := []*dto.RefreshToken{}
+	s.captureStore(ctx, &stored)
+
+	tokenPair, err := s.Usecase.GenereateToken(ctx, id)
+	assert.NoError(s.T(), err)
+	sessionID := stored[0].FamilyID
+	revoked := s.newSessionDTO(sessionID, id, time.Now().Add(time.Hour))
+	revoked.Revoked = true
+	s.SessionRepository.On("FetchByID", ctx, sessionID).Return(revoked, nil)
+
+	// assert, the access token is still accepted locally, but reported inactive
+	_, err = s.Usecase.VerifyToken(ctx, tokenPair.AccessToken)
+	assert.NoError(s.T(), err)
+
+	introspection, err := s.Usecase.Introspect(ctx, testIntrospectionClientID, testIntrospectionClientSecret, tokenPair.AccessToken)
+	assert.NoError(s.T(), err)
+	assert.False(s.T(), introspection.Active)
+	assert.Nil(s.T(), introspection.Claims)
+}
+
+func (s *AuthServiceTestSuite) TestIntrospectInactiveTokens() {
+	ctx := context.Background()
+	id := "7d8b78d7-6ede-4b8f-8492-49f227ba63ba"
+
+	stored := []*dto.RefreshToken{}
+	s.captureStore(ctx, &stored)
+
+	tokenPair, err := s.Usecase.GenereateToken(ctx, id)
+	assert.NoError(s.T(), err)
+
+	expired, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"id":    id,
+		"scope": entity.ScopeTodosRead,
+		"exp":   time.Now().Add(-time.Minute).Unix(),
+	}).SignedString([]byte("top-secret"))
+	assert.NoError(s.T(), err)
+
+	mfaToken, err := s.Usecase.GenerateMFAToken(ctx, id)
+	assert.NoError(s.T(), err)
+
+	// assert, refresh tokens are only for this backend
+	for _, token := range []string{"invalid-token", expired, mfaToken, tokenPair.RefreshToken} {
+		introspection, err := s.Usecase.Introspect(ctx, testIntrospectionClientID, testIntrospectionClientSecret, token)
+		assert.NoError(s.T(), err)
+		assert.False(s.T(), introspection.Active)
+	}
+}
+
+func (s *AuthServiceTestSuite) TestIntrospectAfterGenerationBumped() {
+	ctx := context.Background()
+	id := "7d8b78d7-6ede-4b8f-8492-49f227ba63ba"
+
+	stored := []*dto.RefreshToken{}
+	s.captureStore(ctx, &stored)
+
+	tokenPair, err := s.Usecase.GenereateToken(ctx, id)
+	assert.NoError(s.T(), err)
+
+	// user logged out everywhere
+	s.TokenGenerationRepository.ExpectedCalls = nil
+	s.TokenGenerationRepository.On("FetchByUserID", ctx, id).Return(int64(1), nil)
+
+	// assert
+	introspection, err := s.Usecase.Introspect(ctx, testIntrospectionClientID, testIntrospectionClientSecret, tokenPair.AccessToken)
+	assert.NoError(s.T(), err)
+	assert.False(s.T(), introspection.Active)
+}
+
+func (s *AuthServiceTestSuite) TestSuccessIntrospectPersonalAccessToken() {
+	ctx := context.Background()
+	id := "7d8b78d7-6ede-4b8f-8492-49f227ba63ba"
+
+	token, stored := s.createPersonalAccessToken(ctx, id, 0)
+	s.PersonalAccessTokenRepository.On("FetchByHash", ctx, crypt.HashToken(token)).Return(stored, nil)
+	s.PersonalAccessTokenRepository.On("UpdateLastUsed", ctx, stored.ID, mock.AnythingOfType("time.Time")).Return(nil)
+
+	// assert, the token never expires and belongs to no session
+	introspection, err := s.Usecase.Introspect(ctx, testIntrospectionClientID, testIntrospectionClientSecret, token)
+	assert.NoError(s.T(), err)
+	assert.True(s.T(), introspection.Active)
+	assert.Equal(s.T(), []string{entity.ScopeTodosRead}, introspection.Claims.Scopes)
+	assert.Nil(s.T(), introspection.Claims.ExpiresAt)
+	s.SessionRepository.AssertNotCalled(s.T(), "FetchByID", mock.Anything, mock.Anything)
+}
+
+func (s *AuthServiceTestSuite) TestFailIntrospectWithInvalidClient() {
+	ctx := context.Background()
+
+	cases := []struct {
+		clientID     string
+		clientSecret string
+	}{
+		{testIntrospectionClientID, "wrong-secret"},
+		{"unknown-service", testIntrospectionClientSecret},
+		{"", ""},
+	}
+	for _, c := range cases {
+		introspection, err := s.Usecase.Introspect(ctx, c.clientID, c.clientSecret, "some-token")
+		assert.ErrorIs(s.T(), err, ErrUnauthorized)
+		assert.Nil(s.T(), introspection)
+	}
+}
+
+func (s *AuthServiceTestSuite) TestFailIntrospectWithoutToken() {
+	ctx := context.Background()
+
+	// assert
+	introspection, err := s.Usecase.Introspect(ctx, testIntrospectionClientID, testIntrospectionClientSecret, "")
+	assert.ErrorIs(s.T(), err, ErrInvalidRequest)
+	assert.Nil(s.T(), introspection)
 }
 
 func TestAuthService(t *testing.T) {
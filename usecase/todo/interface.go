@@ -5,6 +5,7 @@ package todo
 import (
 	"context"
 	"errors"
+	"time"
 
 	"github.com/org39/webapp-tutorial-backend/entity"
 	"github.com/org39/webapp-tutorial-backend/entity/dto"
@@ -19,17 +20,49 @@ var (
 )
 
 type Usecase interface {
-	Create(ctx context.Context, user *entity.User, content string) (*entity.Todo, error)
-	FetchAllByUser(ctx context.Context, user *entity.User, showCompleted bool, showDeleted bool) ([]*entity.Todo, error)
+	Create(ctx context.Context, user *entity.User, content string, dueAt *time.Time, priority int, position int) (*entity.Todo, error)
+	FetchAllByUser(ctx context.Context, user *entity.User, filter *entity.TodoFilter) ([]*entity.Todo, error)
+	FetchPageByUser(ctx context.Context, user *entity.User, filter *entity.TodoFilter, sort *entity.TodoSort, after *entity.TodoCursor, limit uint64) (*entity.TodoPage, error)
 	FetchByID(ctx context.Context, user *entity.User, id string) (*entity.Todo, error)
-	Update(ctx context.Context, user *entity.User, id string, content string, completed bool, deleted bool) (*entity.Todo, error)
+	Update(ctx context.Context, user *entity.User, id string, content string, completed bool, deleted bool, dueAt *time.Time, priority int, position int) (*entity.Todo, error)
 	Delete(ctx context.Context, user *entity.User, id string) error
+	Search(ctx context.Context, user *entity.User, query *entity.TodoSearch) ([]*entity.TodoSearchResult, error)
+	PurgeUser(ctx context.Context, user *entity.User) error
+
+	CreateTag(ctx context.Context, user *entity.User, name string, color string) (*entity.Tag, error)
+	FetchTagsByUser(ctx context.Context, user *entity.User) ([]*entity.Tag, error)
+	FetchTagByID(ctx context.Context, user *entity.User, id string) (*entity.Tag, error)
+	UpdateTag(ctx context.Context, user *entity.User, id string, update *entity.TagUpdate) (*entity.Tag, error)
+	DeleteTag(ctx context.Context, user *entity.User, id string) error
+	AttachTag(ctx context.Context, user *entity.User, todoID string, tagID string) (*entity.Todo, error)
+	DetachTag(ctx context.Context, user *entity.User, todoID string, tagID string) (*entity.Todo, error)
 }
 
 type Repository interface {
 	Store(ctx context.Context, t *dto.Todo) error
 	Update(ctx context.Context, t *dto.Todo) error
 	Delete(ctx context.Context, t *dto.Todo) error
-	FetchAllByUser(ctx context.Context, u *dto.User, showCompleted bool, showDeleted bool) ([]*dto.Todo, error)
+	FetchAllByUser(ctx context.Context, u *dto.User, f *dto.TodoFilter) ([]*dto.Todo, error)
+	FetchPageByUser(ctx context.Context, u *dto.User, f *dto.TodoFilter, sort *dto.TodoSort, after *dto.TodoCursor, limit uint64) ([]*dto.Todo, error)
 	FetchByID(ctx context.Context, id string) (*dto.Todo, error)
 }
+
+type TagRepository interface {
+	Store(ctx context.Context, t *dto.Tag) error
+	Update(ctx context.Context, t *dto.Tag) error
+	Delete(ctx context.Context, t *dto.Tag) error
+	FetchByID(ctx context.Context, id string) (*dto.Tag, error)
+	FetchAllByUser(ctx context.Context, u *dto.User) ([]*dto.Tag, error)
+	FetchByTodos(ctx context.Context, todoIDs []string) (map[string][]*dto.Tag, error)
+	Attach(ctx context.Context, todo *dto.Todo, tag *dto.Tag) error
+	Detach(ctx context.Context, todo *dto.Todo, tag *dto.Tag) error
+}
+
+// SearchIndex finds todos by the words of their content.
+// Index is called whenever a todo is stored or updated, and RemoveUser once the user is deleted,
+// an index kept up to date by the database may ignore both.
+type SearchIndex interface {
+	Index(ctx context.Context, t *dto.Todo) error
+	RemoveUser(ctx context.Context, u *dto.User) error
+	Search(ctx context.Context, u *dto.User, s *dto.TodoSearch) ([]*dto.TodoSearchHit, error)
+}
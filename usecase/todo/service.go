@@ -3,13 +3,17 @@ package todo
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/org39/webapp-tutorial-backend/entity"
 	"github.com/org39/webapp-tutorial-backend/entity/dto"
+	"github.com/org39/webapp-tutorial-backend/pkg/log"
 )
 
 type Service struct {
-	Repository Repository `inject:""`
+	Repository    Repository    `inject:""`
+	TagRepository TagRepository `inject:""`
+	SearchIndex   SearchIndex   `inject:""`
 }
 
 func NewService(options ...func(*Service) error) (Usecase, error) {
@@ -31,13 +35,27 @@ func WithRepository(r Repository) func(*Service) error {
 	}
 }
 
-func (s *Service) Create(ctx context.Context, user *entity.User, content string) (*entity.Todo, error) {
+func WithTagRepository(r TagRepository) func(*Service) error {
+	return func(s *Service) error {
+		s.TagRepository = r
+		return nil
+	}
+}
+
+func WithSearchIndex(i SearchIndex) func(*Service) error {
+	return func(s *Service) error {
+		s.SearchIndex = i
+		return nil
+	}
+}
+
+func (s *Service) Create(ctx context.Context, user *entity.User, content string, dueAt *time.Time, priority int, position int) (*entity.Todo, error) {
 	// test some validation on req
 	if err := user.Valid(); err != nil {
 		return nil, fmt.Errorf("%s: invalid request: %w", err, ErrInvalidRequest)
 	}
 
-	todo, err := entity.NewFactory().NewTodo(user, content)
+	todo, err := entity.NewFactory().NewTodo(user, content, dueAt, priority, position)
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", err, ErrSystemError)
 	}
@@ -47,39 +65,108 @@ func (s *Service) Create(ctx context.Context, user *entity.User, content string)
 		return nil, fmt.Errorf("%s: %w", err.Error(), ErrInvalidRequest)
 	}
 
-	todoDTO := dto.NewFactory().NewTodo(todo.ID, todo.UserID, todo.Content, todo.Completed, todo.CreatedAt, todo.UpdatedAt, todo.Deleted)
+	todoDTO := newTodoDTO(todo)
 	if err := s.Repository.Store(ctx, todoDTO); err != nil {
 		return nil, err
 	}
 
+	s.index(ctx, todoDTO)
+
 	return todo, nil
 }
 
-func (s *Service) FetchAllByUser(ctx context.Context, user *entity.User, showCompleted bool, showDeleted bool) ([]*entity.Todo, error) {
+// FetchAllByUser returns every todo of the user selected by the filter, e.g. for an export.
+func (s *Service) FetchAllByUser(ctx context.Context, user *entity.User, filter *entity.TodoFilter) ([]*entity.Todo, error) {
 	// test some validation on req
 	if err := user.Valid(); err != nil {
 		return nil, fmt.Errorf("%s: invalid request: %w", err, ErrInvalidRequest)
 	}
 
-	userDTO := dto.NewFactory().NewUser(user.ID, user.Email, user.Password, user.CreatedAt)
-	todoDTOs, err := s.Repository.FetchAllByUser(ctx, userDTO, showCompleted, showDeleted)
+	if err := filter.Valid(); err != nil {
+		return nil, fmt.Errorf("%s: invalid filter: %w", err, ErrInvalidRequest)
+	}
+
+	userDTO := dto.NewFactory().NewUser(user.ID, user.Email, user.Password, user.Roles, user.VerifiedAt, user.DisabledAt, user.CreatedAt)
+	todoDTOs, err := s.Repository.FetchAllByUser(ctx, userDTO, newTodoFilterDTO(filter))
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", err, ErrDatabaseError)
 	}
 
-	todos := make([]*entity.Todo, len(todoDTOs))
-	for i, todoDTO := range todoDTOs {
-		todo, err := entity.NewFactory().FromTodoDTO(todoDTO)
-		if err != nil {
-			return nil, fmt.Errorf("%s: %w", err, ErrSystemError)
-		}
+	todos, err := fromTodoDTOs(todoDTOs)
+	if err != nil {
+		return nil, err
+	}
 
-		todos[i] = todo
+	if err := s.loadTags(ctx, todos...); err != nil {
+		return nil, err
 	}
 
 	return todos, nil
 }
 
+// FetchPageByUser returns at most limit todos of the user selected by the filter, in the order, starting after the cursor.
+// The next page starts after the returned cursor, which is nil on the last page.
+func (s *Service) FetchPageByUser(ctx context.Context, user *entity.User, filter *entity.TodoFilter, sort *entity.TodoSort, after *entity.TodoCursor, limit uint64) (*entity.TodoPage, error) {
+	// test some validation on req
+	if err := user.Valid(); err != nil {
+		return nil, fmt.Errorf("%s: invalid request: %w", err, ErrInvalidRequest)
+	}
+
+	if err := filter.Valid(); err != nil {
+		return nil, fmt.Errorf("%s: invalid filter: %w", err, ErrInvalidRequest)
+	}
+
+	if err := sort.Valid(); err != nil {
+		return nil, fmt.Errorf("%s: invalid sort: %w", err, ErrInvalidRequest)
+	}
+
+	if limit == 0 || limit > entity.MaxTodoPageLimit {
+		return nil, fmt.Errorf("limit must be between 1 and %d: %w", entity.MaxTodoPageLimit, ErrInvalidRequest)
+	}
+
+	var afterDTO *dto.TodoCursor
+	if after != nil {
+		if err := after.Valid(); err != nil {
+			return nil, fmt.Errorf("%s: invalid cursor: %w", err, ErrInvalidRequest)
+		}
+		// positions in one order mean nothing in another
+		if after.Sort != *sort {
+			return nil, fmt.Errorf("%s: %w", entity.ErrTodoCursorMismatch, ErrInvalidRequest)
+		}
+		afterDTO = dto.NewFactory().NewTodoCursor(after.Value, after.ID)
+	}
+
+	// one more todo tells whether there is a next page
+	userDTO := dto.NewFactory().NewUser(user.ID, user.Email, user.Password, user.Roles, user.VerifiedAt, user.DisabledAt, user.CreatedAt)
+	sortDTO := dto.NewFactory().NewTodoSort(sort.Key, sort.Order == entity.TodoOrderDesc)
+	todoDTOs, err := s.Repository.FetchPageByUser(ctx, userDTO, newTodoFilterDTO(filter), sortDTO, afterDTO, limit+1)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", err, ErrDatabaseError)
+	}
+
+	more := uint64(len(todoDTOs)) > limit
+	if more {
+		todoDTOs = todoDTOs[:limit]
+	}
+
+	todos, err := fromTodoDTOs(todoDTOs)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.loadTags(ctx, todos...); err != nil {
+		return nil, err
+	}
+
+	var next *entity.TodoCursor
+	if more {
+		last := todos[len(todos)-1]
+		next = entity.NewFactory().NewTodoCursor(sort, sort.Value(last), last.ID)
+	}
+
+	return entity.NewFactory().NewTodoPage(todos, next), nil
+}
+
 func (s *Service) FetchByID(ctx context.Context, u *entity.User, id string) (*entity.Todo, error) {
 	todoDTO, err := s.Repository.FetchByID(ctx, id)
 	if err != nil {
@@ -95,10 +182,14 @@ func (s *Service) FetchByID(ctx context.Context, u *entity.User, id string) (*en
 		return nil, ErrUnauthorized
 	}
 
+	if err := s.loadTags(ctx, todo); err != nil {
+		return nil, err
+	}
+
 	return todo, nil
 }
 
-func (s *Service) Update(ctx context.Context, user *entity.User, id string, content string, completed bool, deleted bool) (*entity.Todo, error) {
+func (s *Service) Update(ctx context.Context, user *entity.User, id string, content string, completed bool, deleted bool, dueAt *time.Time, priority int, position int) (*entity.Todo, error) {
 	// fetch todo
 	ori, err := s.Repository.FetchByID(ctx, id)
 	if err != nil {
@@ -118,6 +209,9 @@ func (s *Service) Update(ctx context.Context, user *entity.User, id string, cont
 	newTodo.Content = content
 	newTodo.Completed = completed
 	newTodo.Deleted = deleted
+	newTodo.DueAt = dueAt
+	newTodo.Priority = priority
+	newTodo.Position = position
 
 	// test some validation on new Todo
 	if err := newTodo.Valid(); err != nil {
@@ -125,11 +219,17 @@ func (s *Service) Update(ctx context.Context, user *entity.User, id string, cont
 	}
 
 	// Update
-	newTodoDTO := dto.NewFactory().NewTodo(newTodo.ID, newTodo.UserID, newTodo.Content, newTodo.Completed, newTodo.CreatedAt, newTodo.UpdatedAt, newTodo.Deleted)
+	newTodoDTO := newTodoDTO(newTodo)
 	if err := s.Repository.Update(ctx, newTodoDTO); err != nil {
 		return nil, err
 	}
 
+	s.index(ctx, newTodoDTO)
+
+	if err := s.loadTags(ctx, newTodo); err != nil {
+		return nil, err
+	}
+
 	return newTodo, nil
 }
 
@@ -145,5 +245,300 @@ func (s *Service) Delete(ctx context.Context, user *entity.User, id string) erro
 
 	// mark deleted
 	t.Deleted = true
-	return s.Repository.Update(ctx, t)
+	if err := s.Repository.Update(ctx, t); err != nil {
+		return err
+	}
+
+	s.index(ctx, t)
+
+	return nil
+}
+
+// index updates the search index after the todo was written.
+func (s *Service) index(ctx context.Context, t *dto.Todo) {
+	// the todo is already saved, a stale index must not fail the request
+	if err := s.SearchIndex.Index(ctx, t); err != nil {
+		log.LoggerWithSpan(ctx).WithError(err).Warn("fail to index todo")
+	}
+}
+
+// Search returns the todos of the user which are not deleted and contain words of the query, the most relevant first.
+func (s *Service) Search(ctx context.Context, user *entity.User, query *entity.TodoSearch) ([]*entity.TodoSearchResult, error) {
+	// test some validation on req
+	if err := user.Valid(); err != nil {
+		return nil, fmt.Errorf("%s: invalid request: %w", err, ErrInvalidRequest)
+	}
+
+	if err := query.Valid(); err != nil {
+		return nil, fmt.Errorf("%s: invalid search: %w", err, ErrInvalidRequest)
+	}
+
+	terms := query.Terms()
+	userDTO := dto.NewFactory().NewUser(user.ID, user.Email, user.Password, user.Roles, user.VerifiedAt, user.DisabledAt, user.CreatedAt)
+	hits, err := s.SearchIndex.Search(ctx, userDTO, dto.NewFactory().NewTodoSearch(terms, query.Limit))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", err, ErrDatabaseError)
+	}
+
+	results := make([]*entity.TodoSearchResult, len(hits))
+	todos := make([]*entity.Todo, len(hits))
+	for i, hit := range hits {
+		todo, err := entity.NewFactory().FromTodoDTO(hit.Todo)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", err, ErrSystemError)
+		}
+
+		results[i] = entity.NewFactory().NewTodoSearchResult(todo, hit.Score, terms)
+		todos[i] = todo
+	}
+
+	if err := s.loadTags(ctx, todos...); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// PurgeUser forgets the todos of a deleted user kept outside the database, the rows are deleted with the user.
+func (s *Service) PurgeUser(ctx context.Context, user *entity.User) error {
+	userDTO := dto.NewFactory().NewUser(user.ID, user.Email, user.Password, user.Roles, user.VerifiedAt, user.DisabledAt, user.CreatedAt)
+	if err := s.SearchIndex.RemoveUser(ctx, userDTO); err != nil {
+		return fmt.Errorf("%s: %w", err, ErrDatabaseError)
+	}
+	return nil
+}
+
+// CreateTag creates a tag of the user, DefaultTagColor when the color is empty.
+func (s *Service) CreateTag(ctx context.Context, user *entity.User, name string, color string) (*entity.Tag, error) {
+	// test some validation on req
+	if err := user.Valid(); err != nil {
+		return nil, fmt.Errorf("%s: invalid request: %w", err, ErrInvalidRequest)
+	}
+
+	tag, err := entity.NewFactory().NewTag(user, name, color)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", err, ErrSystemError)
+	}
+
+	if err := tag.Valid(); err != nil {
+		return nil, fmt.Errorf("%s: invalid tag: %w", err, ErrInvalidRequest)
+	}
+
+	tags, err := s.FetchTagsByUser(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(tags) >= entity.MaxTagsPerUser {
+		return nil, fmt.Errorf("at most %d tags: %w", entity.MaxTagsPerUser, ErrInvalidRequest)
+	}
+
+	if err := checkTagName(tags, tag); err != nil {
+		return nil, err
+	}
+
+	if err := s.TagRepository.Store(ctx, newTagDTO(tag)); err != nil {
+		return nil, err
+	}
+
+	return tag, nil
+}
+
+// FetchTagsByUser returns the tags of the user by name.
+func (s *Service) FetchTagsByUser(ctx context.Context, user *entity.User) ([]*entity.Tag, error) {
+	userDTO := dto.NewFactory().NewUser(user.ID, user.Email, user.Password, user.Roles, user.VerifiedAt, user.DisabledAt, user.CreatedAt)
+	tagDTOs, err := s.TagRepository.FetchAllByUser(ctx, userDTO)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", err, ErrDatabaseError)
+	}
+
+	return fromTagDTOs(tagDTOs)
+}
+
+func (s *Service) FetchTagByID(ctx context.Context, user *entity.User, id string) (*entity.Tag, error) {
+	tagDTO, err := s.TagRepository.FetchByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	tag, err := entity.NewFactory().FromTagDTO(tagDTO)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", err, ErrSystemError)
+	}
+
+	if user.ID != tag.UserID {
+		return nil, ErrUnauthorized
+	}
+
+	return tag, nil
+}
+
+// UpdateTag renames or recolors the tag, the todos keep it.
+func (s *Service) UpdateTag(ctx context.Context, user *entity.User, id string, update *entity.TagUpdate) (*entity.Tag, error) {
+	tag, err := s.FetchTagByID(ctx, user, id)
+	if err != nil {
+		return nil, err
+	}
+
+	tag.Apply(update, time.Now())
+	if err := tag.Valid(); err != nil {
+		return nil, fmt.Errorf("%s: invalid tag: %w", err, ErrInvalidRequest)
+	}
+
+	if update.Name != nil {
+		tags, err := s.FetchTagsByUser(ctx, user)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := checkTagName(tags, tag); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.TagRepository.Update(ctx, newTagDTO(tag)); err != nil {
+		return nil, err
+	}
+
+	return tag, nil
+}
+
+// DeleteTag removes the tag from every todo, then deletes it for good.
+func (s *Service) DeleteTag(ctx context.Context, user *entity.User, id string) error {
+	tag, err := s.FetchTagByID(ctx, user, id)
+	if err != nil {
+		return err
+	}
+
+	return s.TagRepository.Delete(ctx, newTagDTO(tag))
+}
+
+// AttachTag tags the todo, tagging a todo twice is not an error.
+func (s *Service) AttachTag(ctx context.Context, user *entity.User, todoID string, tagID string) (*entity.Todo, error) {
+	todo, tag, err := s.fetchTodoAndTag(ctx, user, todoID, tagID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.TagRepository.Attach(ctx, todo, tag); err != nil {
+		return nil, err
+	}
+
+	return s.FetchByID(ctx, user, todoID)
+}
+
+// DetachTag untags the todo, untagging a todo without the tag is not an error.
+func (s *Service) DetachTag(ctx context.Context, user *entity.User, todoID string, tagID string) (*entity.Todo, error) {
+	todo, tag, err := s.fetchTodoAndTag(ctx, user, todoID, tagID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.TagRepository.Detach(ctx, todo, tag); err != nil {
+		return nil, err
+	}
+
+	return s.FetchByID(ctx, user, todoID)
+}
+
+// fetchTodoAndTag returns the todo and the tag when both belong to the user.
+func (s *Service) fetchTodoAndTag(ctx context.Context, user *entity.User, todoID string, tagID string) (*dto.Todo, *dto.Tag, error) {
+	todo, err := s.Repository.FetchByID(ctx, todoID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if user.ID != todo.UserID {
+		return nil, nil, ErrUnauthorized
+	}
+
+	tag, err := s.TagRepository.FetchByID(ctx, tagID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if user.ID != tag.UserID {
+		return nil, nil, ErrUnauthorized
+	}
+
+	return todo, tag, nil
+}
+
+// loadTags sets the tags of the todos with one query.
+func (s *Service) loadTags(ctx context.Context, todos ...*entity.Todo) error {
+	if len(todos) == 0 {
+		return nil
+	}
+
+	ids := make([]string, len(todos))
+	for i, t := range todos {
+		ids[i] = t.ID
+	}
+
+	tagDTOs, err := s.TagRepository.FetchByTodos(ctx, ids)
+	if err != nil {
+		return fmt.Errorf("%s: %w", err, ErrDatabaseError)
+	}
+
+	for _, t := range todos {
+		tags, err := fromTagDTOs(tagDTOs[t.ID])
+		if err != nil {
+			return err
+		}
+		t.Tags = tags
+	}
+
+	return nil
+}
+
+// checkTagName refuses a name another tag of the user has, regardless of case.
+func checkTagName(tags []*entity.Tag, tag *entity.Tag) error {
+	for _, t := range tags {
+		if t.ID != tag.ID && t.SameName(tag.Name) {
+			return fmt.Errorf("tag name already exist: %w", ErrInvalidRequest)
+		}
+	}
+
+	return nil
+}
+
+func newTagDTO(tag *entity.Tag) *dto.Tag {
+	return dto.NewFactory().NewTag(tag.ID, tag.UserID, tag.Name, tag.Color, tag.CreatedAt, tag.UpdatedAt)
+}
+
+func fromTagDTOs(tagDTOs []*dto.Tag) ([]*entity.Tag, error) {
+	tags := make([]*entity.Tag, len(tagDTOs))
+	for i, tagDTO := range tagDTOs {
+		tag, err := entity.NewFactory().FromTagDTO(tagDTO)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", err, ErrSystemError)
+		}
+
+		tags[i] = tag
+	}
+
+	return tags, nil
+}
+
+func newTodoDTO(todo *entity.Todo) *dto.Todo {
+	return dto.NewFactory().NewTodo(todo.ID, todo.UserID, todo.Content, todo.Completed, todo.CreatedAt, todo.UpdatedAt, todo.Deleted, todo.DueAt, todo.Priority, todo.Position)
+}
+
+func newTodoFilterDTO(filter *entity.TodoFilter) *dto.TodoFilter {
+	return dto.NewFactory().NewTodoFilter(filter.Completed(), filter.IsDeleted(),
+		filter.CreatedAfter, filter.CreatedBefore, filter.UpdatedAfter, filter.UpdatedBefore, filter.Content, filter.Tags, filter.AllTags())
+}
+
+func fromTodoDTOs(todoDTOs []*dto.Todo) ([]*entity.Todo, error) {
+	todos := make([]*entity.Todo, len(todoDTOs))
+	for i, todoDTO := range todoDTOs {
+		todo, err := entity.NewFactory().FromTodoDTO(todoDTO)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", err, ErrSystemError)
+		}
+
+		todos[i] = todo
+	}
+
+	return todos, nil
 }
@@ -2,6 +2,7 @@ package todo
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"testing"
 	"time"
@@ -17,15 +18,21 @@ import (
 
 type TodoServiceTestSuite struct {
 	suite.Suite
-	Usecase    Usecase
-	Repository *mocks.Repository
+	Usecase       Usecase
+	Repository    *mocks.Repository
+	TagRepository *mocks.TagRepository
+	SearchIndex   *mocks.SearchIndex
 }
 
 func (s *TodoServiceTestSuite) SetupTest() {
 	s.Repository = new(mocks.Repository)
+	s.TagRepository = new(mocks.TagRepository)
+	s.SearchIndex = new(mocks.SearchIndex)
 
 	usecase, err := NewService(
 		WithRepository(s.Repository),
+		WithTagRepository(s.TagRepository),
+		WithSearchIndex(s.SearchIndex),
 	)
 	if err != nil {
 		assert.Fail(s.T(), fmt.Sprintf("fail to create usecase: %s", err))
@@ -39,19 +46,21 @@ func (s *TodoServiceTestSuite) TestCreateSuccess() {
 
 	// mock repo
 	userID := "2192fc7b-bd9b-446d-a50e-5ce0ba02cee6"
-	userDTO := dto.NewFactory().NewUser(userID, "account@emai.com", "strong-password", time.Now())
+	userDTO := dto.NewFactory().NewUser(userID, "account@emai.com", "strong-password", nil, nil, nil, time.Now())
 	user, userErr := entity.NewFactory().FromUserDTO(userDTO)
 
 	id := "4daaaea8-4721-4644-aaac-7958805b4530"
-	todoDTO := dto.NewFactory().NewTodo(id, userID, "things todo", false, time.Now(), time.Now(), false)
+	todoDTO := dto.NewFactory().NewTodo(id, userID, "things todo", false, time.Now(), time.Now(), false, nil, 0, 0)
 
 	s.Repository.On("Store", ctx, mock.AnythingOfType("*dto.Todo")).Return(nil)
+	s.SearchIndex.On("Index", ctx, mock.AnythingOfType("*dto.Todo")).Return(nil)
 
 	// assert
-	res, err := s.Usecase.Create(ctx, user, todoDTO.Content)
+	res, err := s.Usecase.Create(ctx, user, todoDTO.Content, nil, 0, 0)
 	assert.NoError(s.T(), userErr)
 	assert.NoError(s.T(), err)
 	assert.Equal(s.T(), todoDTO.UserID, res.UserID)
+	s.SearchIndex.AssertCalled(s.T(), "Index", ctx, mock.AnythingOfType("*dto.Todo"))
 }
 
 func (s *TodoServiceTestSuite) TestFetctByIDSuccess() {
@@ -59,19 +68,24 @@ func (s *TodoServiceTestSuite) TestFetctByIDSuccess() {
 
 	// mock repo
 	userID := "2192fc7b-bd9b-446d-a50e-5ce0ba02cee6"
-	userDTO := dto.NewFactory().NewUser(userID, "account@emai.com", "strong-password", time.Now())
+	userDTO := dto.NewFactory().NewUser(userID, "account@emai.com", "strong-password", nil, nil, nil, time.Now())
 	user, userErr := entity.NewFactory().FromUserDTO(userDTO)
 
 	id := "4daaaea8-4721-4644-aaac-7958805b4530"
-	todoDTO := dto.NewFactory().NewTodo(id, userID, "things todo", false, time.Now(), time.Now(), false)
+	todoDTO := dto.NewFactory().NewTodo(id, userID, "things todo", false, time.Now(), time.Now(), false, nil, 0, 0)
+
+	tagDTO := dto.NewFactory().NewTag("7d3c1a52-96b4-4f0e-8d2b-3a1f6e9c0b47", userID, "home", "#4caf50", time.Now(), time.Now())
 
 	s.Repository.On("FetchByID", ctx, id).Return(todoDTO, nil)
+	s.TagRepository.On("FetchByTodos", ctx, []string{id}).Return(map[string][]*dto.Tag{id: {tagDTO}}, nil)
 
 	// assert
 	res, err := s.Usecase.FetchByID(ctx, user, id)
 	assert.NoError(s.T(), userErr)
 	assert.NoError(s.T(), err)
 	assert.Equal(s.T(), todoDTO.UserID, res.UserID)
+	assert.Len(s.T(), res.Tags, 1)
+	assert.Equal(s.T(), tagDTO.Name, res.Tags[0].Name)
 }
 
 func (s *TodoServiceTestSuite) TestFetctAllByUserSuccess() {
@@ -79,19 +93,23 @@ func (s *TodoServiceTestSuite) TestFetctAllByUserSuccess() {
 
 	// mock repo
 	userID := "2192fc7b-bd9b-446d-a50e-5ce0ba02cee6"
-	userDTO := dto.NewFactory().NewUser(userID, "account@emai.com", "strong-password", time.Now())
+	userDTO := dto.NewFactory().NewUser(userID, "account@emai.com", "strong-password", nil, nil, nil, time.Now())
 	user, userErr := entity.NewFactory().FromUserDTO(userDTO)
 
 	id0 := "4daaaea8-4721-4644-aaac-7958805b4530"
-	todoDTO0 := dto.NewFactory().NewTodo(id0, userID, "things todo", false, time.Now(), time.Now(), false)
+	todoDTO0 := dto.NewFactory().NewTodo(id0, userID, "things todo", false, time.Now(), time.Now(), false, nil, 0, 0)
 
 	id1 := "fb2211c9-5d53-4a44-895b-79c42174d521"
-	todoDTO1 := dto.NewFactory().NewTodo(id1, userID, "things todo", false, time.Now(), time.Now(), false)
+	todoDTO1 := dto.NewFactory().NewTodo(id1, userID, "things todo", false, time.Now(), time.Now(), false, nil, 0, 0)
 
-	s.Repository.On("FetchAllByUser", ctx, userDTO, false, false).Return([]*dto.Todo{todoDTO0, todoDTO1}, nil)
+	filter := entity.NewFactory().NewTodoFilter(entity.TodoStatusOpen, entity.TodoDeletedExclude, nil, nil, nil, nil, "", nil, entity.TodoTagMatchAny)
+	completed, deleted := false, false
+	filterDTO := dto.NewFactory().NewTodoFilter(&completed, &deleted, nil, nil, nil, nil, "", nil, false)
+	s.Repository.On("FetchAllByUser", ctx, userDTO, filterDTO).Return([]*dto.Todo{todoDTO0, todoDTO1}, nil)
+	s.TagRepository.On("FetchByTodos", ctx, []string{id0, id1}).Return(map[string][]*dto.Tag{}, nil)
 
 	// assert
-	res, err := s.Usecase.FetchAllByUser(ctx, user, false, false)
+	res, err := s.Usecase.FetchAllByUser(ctx, user, filter)
 	assert.NoError(s.T(), userErr)
 	assert.NoError(s.T(), err)
 	assert.Len(s.T(), res, 2)
@@ -99,28 +117,180 @@ func (s *TodoServiceTestSuite) TestFetctAllByUserSuccess() {
 	assert.Equal(s.T(), todoDTO0.UserID, res[1].UserID)
 }
 
+func (s *TodoServiceTestSuite) TestFetctAllByUserWithFilter() {
+	ctx := context.Background()
+
+	// mock repo
+	userID := "2192fc7b-bd9b-446d-a50e-5ce0ba02cee6"
+	userDTO := dto.NewFactory().NewUser(userID, "account@emai.com", "strong-password", nil, nil, nil, time.Now())
+	user, userErr := entity.NewFactory().FromUserDTO(userDTO)
+
+	createdAfter := time.Date(2021, 5, 1, 0, 0, 0, 0, time.UTC)
+	updatedBefore := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	filter := entity.NewFactory().NewTodoFilter(entity.TodoStatusAll, entity.TodoDeletedOnly, &createdAfter, nil, nil, &updatedBefore, "milk", nil, entity.TodoTagMatchAny)
+
+	// all statuses do not filter on completion
+	deleted := true
+	filterDTO := dto.NewFactory().NewTodoFilter(nil, &deleted, &createdAfter, nil, nil, &updatedBefore, "milk", nil, false)
+	s.Repository.On("FetchAllByUser", ctx, userDTO, filterDTO).Return([]*dto.Todo{}, nil)
+
+	// assert
+	res, err := s.Usecase.FetchAllByUser(ctx, user, filter)
+	assert.NoError(s.T(), userErr)
+	assert.NoError(s.T(), err)
+	assert.Empty(s.T(), res)
+	s.Repository.AssertExpectations(s.T())
+}
+
+func (s *TodoServiceTestSuite) TestFetctAllByUserFailWithInvalidFilter() {
+	ctx := context.Background()
+
+	userID := "2192fc7b-bd9b-446d-a50e-5ce0ba02cee6"
+	userDTO := dto.NewFactory().NewUser(userID, "account@emai.com", "strong-password", nil, nil, nil, time.Now())
+	user, userErr := entity.NewFactory().FromUserDTO(userDTO)
+
+	after := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	before := time.Date(2021, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	cases := []*entity.TodoFilter{
+		entity.NewFactory().NewTodoFilter("done", entity.TodoDeletedExclude, nil, nil, nil, nil, "", nil, entity.TodoTagMatchAny),
+		entity.NewFactory().NewTodoFilter(entity.TodoStatusOpen, "never", nil, nil, nil, nil, "", nil, entity.TodoTagMatchAny),
+		entity.NewFactory().NewTodoFilter(entity.TodoStatusOpen, entity.TodoDeletedExclude, &after, &before, nil, nil, "", nil, entity.TodoTagMatchAny),
+	}
+
+	// assert
+	assert.NoError(s.T(), userErr)
+	for _, filter := range cases {
+		_, err := s.Usecase.FetchAllByUser(ctx, user, filter)
+		assert.ErrorIs(s.T(), err, ErrInvalidRequest)
+	}
+	s.Repository.AssertNotCalled(s.T(), "FetchAllByUser", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func (s *TodoServiceTestSuite) TestFetchPageByUserSuccess() {
+	ctx := context.Background()
+
+	// mock repo
+	userID := "2192fc7b-bd9b-446d-a50e-5ce0ba02cee6"
+	userDTO := dto.NewFactory().NewUser(userID, "account@emai.com", "strong-password", nil, nil, nil, time.Now())
+	user, userErr := entity.NewFactory().FromUserDTO(userDTO)
+
+	now := time.Now()
+	todoDTO0 := dto.NewFactory().NewTodo("4daaaea8-4721-4644-aaac-7958805b4530", userID, "things todo", false, now, now, false, nil, 0, 0)
+	todoDTO1 := dto.NewFactory().NewTodo("fb2211c9-5d53-4a44-895b-79c42174d521", userID, "things todo", false, now, now, false, nil, 0, 0)
+	todoDTO2 := dto.NewFactory().NewTodo("1c6f5e0e-8f43-4d1e-9a3b-2b7d7c1e4f10", userID, "things todo", false, now.Add(time.Second), now, false, nil, 0, 0)
+
+	filter := entity.NewFactory().NewTodoFilter(entity.TodoStatusOpen, entity.TodoDeletedExclude, nil, nil, nil, nil, "", nil, entity.TodoTagMatchAny)
+	sort := entity.NewFactory().NewTodoSort(entity.TodoSortCreatedAt, entity.TodoOrderAsc)
+	after := entity.NewFactory().NewTodoCursor(sort, now.Add(-time.Hour), "0b8c5f3e-7d41-4c2a-9e6f-58a1d2c4b7e9")
+	afterDTO := dto.NewFactory().NewTodoCursor(after.Value, after.ID)
+
+	// one more todo than the limit is asked for
+	s.Repository.On("FetchPageByUser", ctx, userDTO, mock.AnythingOfType("*dto.TodoFilter"), dto.NewFactory().NewTodoSort("created_at", false), afterDTO, uint64(3)).
+		Return([]*dto.Todo{todoDTO0, todoDTO1, todoDTO2}, nil)
+	// only the todos of the page get their tags
+	s.TagRepository.On("FetchByTodos", ctx, []string{todoDTO0.ID, todoDTO1.ID}).Return(map[string][]*dto.Tag{}, nil)
+
+	// assert, the next page starts after the last todo of this one
+	page, err := s.Usecase.FetchPageByUser(ctx, user, filter, sort, after, 2)
+	assert.NoError(s.T(), userErr)
+	assert.NoError(s.T(), err)
+	assert.Len(s.T(), page.Todos, 2)
+	assert.Equal(s.T(), todoDTO1.ID, page.Todos[1].ID)
+	assert.Equal(s.T(), entity.NewFactory().NewTodoCursor(sort, todoDTO1.CreatedAt, todoDTO1.ID), page.Next)
+}
+
+func (s *TodoServiceTestSuite) TestFetchPageByUserLastPage() {
+	ctx := context.Background()
+
+	// mock repo
+	userID := "2192fc7b-bd9b-446d-a50e-5ce0ba02cee6"
+	userDTO := dto.NewFactory().NewUser(userID, "account@emai.com", "strong-password", nil, nil, nil, time.Now())
+	user, userErr := entity.NewFactory().FromUserDTO(userDTO)
+
+	todoDTO := dto.NewFactory().NewTodo("4daaaea8-4721-4644-aaac-7958805b4530", userID, "things todo", false, time.Now(), time.Now(), false, nil, 0, 0)
+	filter := entity.NewFactory().NewTodoFilter(entity.TodoStatusOpen, entity.TodoDeletedExclude, nil, nil, nil, nil, "", nil, entity.TodoTagMatchAny)
+	sort := entity.NewFactory().NewTodoSort(entity.TodoSortUpdatedAt, entity.TodoOrderDesc)
+	s.Repository.On("FetchPageByUser", ctx, userDTO, mock.AnythingOfType("*dto.TodoFilter"), dto.NewFactory().NewTodoSort("updated_at", true), (*dto.TodoCursor)(nil), uint64(3)).
+		Return([]*dto.Todo{todoDTO}, nil)
+	s.TagRepository.On("FetchByTodos", ctx, []string{todoDTO.ID}).Return(map[string][]*dto.Tag{}, nil)
+
+	// assert
+	page, err := s.Usecase.FetchPageByUser(ctx, user, filter, sort, nil, 2)
+	assert.NoError(s.T(), userErr)
+	assert.NoError(s.T(), err)
+	assert.Len(s.T(), page.Todos, 1)
+	assert.Nil(s.T(), page.Next)
+}
+
+func (s *TodoServiceTestSuite) TestFetchPageByUserFailWithInvalidLimit() {
+	ctx := context.Background()
+
+	userID := "2192fc7b-bd9b-446d-a50e-5ce0ba02cee6"
+	userDTO := dto.NewFactory().NewUser(userID, "account@emai.com", "strong-password", nil, nil, nil, time.Now())
+	user, userErr := entity.NewFactory().FromUserDTO(userDTO)
+	filter := entity.NewFactory().NewTodoFilter(entity.TodoStatusOpen, entity.TodoDeletedExclude, nil, nil, nil, nil, "", nil, entity.TodoTagMatchAny)
+	sort := entity.NewFactory().NewTodoSort(entity.TodoSortCreatedAt, entity.TodoOrderAsc)
+
+	// assert
+	assert.NoError(s.T(), userErr)
+	for _, limit := range []uint64{0, entity.MaxTodoPageLimit + 1} {
+		_, err := s.Usecase.FetchPageByUser(ctx, user, filter, sort, nil, limit)
+		assert.ErrorIs(s.T(), err, ErrInvalidRequest)
+	}
+	s.Repository.AssertNotCalled(s.T(), "FetchPageByUser", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func (s *TodoServiceTestSuite) TestFetchPageByUserFailWithInvalidSort() {
+	ctx := context.Background()
+
+	userID := "2192fc7b-bd9b-446d-a50e-5ce0ba02cee6"
+	userDTO := dto.NewFactory().NewUser(userID, "account@emai.com", "strong-password", nil, nil, nil, time.Now())
+	user, userErr := entity.NewFactory().FromUserDTO(userDTO)
+	filter := entity.NewFactory().NewTodoFilter(entity.TodoStatusOpen, entity.TodoDeletedExclude, nil, nil, nil, nil, "", nil, entity.TodoTagMatchAny)
+	byCreation := entity.NewFactory().NewTodoSort(entity.TodoSortCreatedAt, entity.TodoOrderAsc)
+	byUpdate := entity.NewFactory().NewTodoSort(entity.TodoSortUpdatedAt, entity.TodoOrderAsc)
+
+	// assert, unknown key
+	assert.NoError(s.T(), userErr)
+	_, err := s.Usecase.FetchPageByUser(ctx, user, filter, entity.NewFactory().NewTodoSort("content", entity.TodoOrderAsc), nil, 2)
+	assert.ErrorIs(s.T(), err, ErrInvalidRequest)
+
+	// assert, a cursor only continues the order it was made in
+	after := entity.NewFactory().NewTodoCursor(byCreation, time.Now(), "0b8c5f3e-7d41-4c2a-9e6f-58a1d2c4b7e9")
+	_, err = s.Usecase.FetchPageByUser(ctx, user, filter, byUpdate, after, 2)
+	assert.ErrorIs(s.T(), err, ErrInvalidRequest)
+	s.Repository.AssertNotCalled(s.T(), "FetchPageByUser", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
 func (s *TodoServiceTestSuite) TestUpdateSuccess() {
 	ctx := context.Background()
 
 	// mock repo
 	userID := "2192fc7b-bd9b-446d-a50e-5ce0ba02cee6"
-	userDTO := dto.NewFactory().NewUser(userID, "account@emai.com", "strong-password", time.Now())
+	userDTO := dto.NewFactory().NewUser(userID, "account@emai.com", "strong-password", nil, nil, nil, time.Now())
 	user, userErr := entity.NewFactory().FromUserDTO(userDTO)
 
 	id := "4daaaea8-4721-4644-aaac-7958805b4530"
-	todoDTO := dto.NewFactory().NewTodo(id, userID, "things todo", false, time.Now(), time.Now(), false)
+	todoDTO := dto.NewFactory().NewTodo(id, userID, "things todo", false, time.Now(), time.Now(), false, nil, 0, 0)
 
 	newContent := "new things todo"
 	newCompleted := true
 	newDeleted := false
-	newTodoDTO := dto.NewFactory().NewTodo(todoDTO.ID, todoDTO.UserID, newContent, newCompleted, todoDTO.CreatedAt, todoDTO.UpdatedAt, newDeleted)
+	newDueAt := time.Date(2021, 5, 1, 0, 0, 0, 0, time.UTC)
+	newPriority := 2
+	newPosition := 3
+	newTodoDTO := dto.NewFactory().NewTodo(todoDTO.ID, todoDTO.UserID, newContent, newCompleted, todoDTO.CreatedAt, todoDTO.UpdatedAt, newDeleted, &newDueAt, newPriority, newPosition)
 	newTodo, newTodoErr := entity.NewFactory().FromTodoDTO(newTodoDTO)
+	newTodo.Tags = []*entity.Tag{}
 
 	s.Repository.On("FetchByID", ctx, id).Return(todoDTO, nil)
 	s.Repository.On("Update", ctx, newTodoDTO).Return(nil)
+	s.SearchIndex.On("Index", ctx, newTodoDTO).Return(nil)
+	s.TagRepository.On("FetchByTodos", ctx, []string{id}).Return(map[string][]*dto.Tag{}, nil)
 
 	// assert
-	res, err := s.Usecase.Update(ctx, user, id, newContent, newCompleted, newDeleted)
+	res, err := s.Usecase.Update(ctx, user, id, newContent, newCompleted, newDeleted, &newDueAt, newPriority, newPosition)
 	assert.NoError(s.T(), userErr)
 	assert.NoError(s.T(), newTodoErr)
 	assert.NoError(s.T(), err)
@@ -132,19 +302,379 @@ func (s *TodoServiceTestSuite) TestDeleteSuccess() {
 
 	// mock repo
 	userID := "2192fc7b-bd9b-446d-a50e-5ce0ba02cee6"
-	userDTO := dto.NewFactory().NewUser(userID, "account@emai.com", "strong-password", time.Now())
+	userDTO := dto.NewFactory().NewUser(userID, "account@emai.com", "strong-password", nil, nil, nil, time.Now())
 	user, userErr := entity.NewFactory().FromUserDTO(userDTO)
 
 	id := "4daaaea8-4721-4644-aaac-7958805b4530"
-	todoDTO := dto.NewFactory().NewTodo(id, userID, "things todo", false, time.Now(), time.Now(), false)
+	todoDTO := dto.NewFactory().NewTodo(id, userID, "things todo", false, time.Now(), time.Now(), false, nil, 0, 0)
 
 	s.Repository.On("FetchByID", ctx, id).Return(todoDTO, nil)
 	s.Repository.On("Update", ctx, todoDTO).Return(nil)
+	s.SearchIndex.On("Index", ctx, todoDTO).Return(nil)
 
-	// assert
+	// assert, the index is told the todo is deleted
 	err := s.Usecase.Delete(ctx, user, id)
 	assert.NoError(s.T(), userErr)
 	assert.NoError(s.T(), err)
+	assert.True(s.T(), todoDTO.Deleted)
+	s.SearchIndex.AssertCalled(s.T(), "Index", ctx, todoDTO)
+}
+
+func (s *TodoServiceTestSuite) TestWriteSuccessWithIndexError() {
+	ctx := context.Background()
+
+	// mock repo
+	userID := "2192fc7b-bd9b-446d-a50e-5ce0ba02cee6"
+	userDTO := dto.NewFactory().NewUser(userID, "account@emai.com", "strong-password", nil, nil, nil, time.Now())
+	user, userErr := entity.NewFactory().FromUserDTO(userDTO)
+
+	id := "4daaaea8-4721-4644-aaac-7958805b4530"
+	todoDTO := dto.NewFactory().NewTodo(id, userID, "things todo", false, time.Now(), time.Now(), false, nil, 0, 0)
+
+	s.Repository.On("Store", ctx, mock.AnythingOfType("*dto.Todo")).Return(nil)
+	s.Repository.On("FetchByID", ctx, id).Return(todoDTO, nil)
+	s.Repository.On("Update", ctx, todoDTO).Return(nil)
+	s.SearchIndex.On("Index", ctx, mock.AnythingOfType("*dto.Todo")).Return(errors.New("connection refused"))
+
+	// assert, the todo is saved so the request succeeds
+	assert.NoError(s.T(), userErr)
+	_, err := s.Usecase.Create(ctx, user, "things todo", nil, 0, 0)
+	assert.NoError(s.T(), err)
+
+	err = s.Usecase.Delete(ctx, user, id)
+	assert.NoError(s.T(), err)
+	s.Repository.AssertCalled(s.T(), "Update", ctx, todoDTO)
+}
+
+func (s *TodoServiceTestSuite) TestPurgeUserSuccess() {
+	ctx := context.Background()
+
+	userID := "2192fc7b-bd9b-446d-a50e-5ce0ba02cee6"
+	userDTO := dto.NewFactory().NewUser(userID, "account@emai.com", "strong-password", nil, nil, nil, time.Now())
+	user, userErr := entity.NewFactory().FromUserDTO(userDTO)
+
+	s.SearchIndex.On("RemoveUser", ctx, mock.AnythingOfType("*dto.User")).Return(nil)
+
+	// assert
+	err := s.Usecase.PurgeUser(ctx, user)
+	assert.NoError(s.T(), userErr)
+	assert.NoError(s.T(), err)
+	s.SearchIndex.AssertCalled(s.T(), "RemoveUser", ctx, mock.MatchedBy(func(u *dto.User) bool { return u.ID == userID }))
+}
+
+func (s *TodoServiceTestSuite) TestSearchSuccess() {
+	ctx := context.Background()
+
+	// mock search index
+	userID := "2192fc7b-bd9b-446d-a50e-5ce0ba02cee6"
+	userDTO := dto.NewFactory().NewUser(userID, "account@emai.com", "strong-password", nil, nil, nil, time.Now())
+	user, userErr := entity.NewFactory().FromUserDTO(userDTO)
+
+	todoDTO := dto.NewFactory().NewTodo("4daaaea8-4721-4644-aaac-7958805b4530", userID, "buy Milk & eggs", false, time.Now(), time.Now(), false, nil, 0, 0)
+	s.SearchIndex.On("Search", ctx, userDTO, dto.NewFactory().NewTodoSearch([]string{"milk", "bread"}, 20)).
+		Return([]*dto.TodoSearchHit{dto.NewFactory().NewTodoSearchHit(todoDTO, 0.5)}, nil)
+	s.TagRepository.On("FetchByTodos", ctx, []string{todoDTO.ID}).Return(map[string][]*dto.Tag{}, nil)
+
+	// assert, the query is searched by its words
+	res, err := s.Usecase.Search(ctx, user, entity.NewFactory().NewTodoSearch("Milk or bread?", 20))
+	assert.NoError(s.T(), userErr)
+	assert.NoError(s.T(), err)
+	assert.Len(s.T(), res, 1)
+	assert.Equal(s.T(), todoDTO.ID, res[0].Todo.ID)
+	assert.Equal(s.T(), 0.5, res[0].Score)
+	assert.Equal(s.T(), "buy <mark>Milk</mark> &amp; eggs", res[0].Snippet)
+}
+
+func (s *TodoServiceTestSuite) TestSearchFailWithInvalidQuery() {
+	ctx := context.Background()
+
+	userID := "2192fc7b-bd9b-446d-a50e-5ce0ba02cee6"
+	userDTO := dto.NewFactory().NewUser(userID, "account@emai.com", "strong-password", nil, nil, nil, time.Now())
+	user, userErr := entity.NewFactory().FromUserDTO(userDTO)
+
+	// assert
+	assert.NoError(s.T(), userErr)
+	queries := []*entity.TodoSearch{
+		entity.NewFactory().NewTodoSearch("", 20),
+		entity.NewFactory().NewTodoSearch("to be or is it", 20),
+		entity.NewFactory().NewTodoSearch("milk", 0),
+		entity.NewFactory().NewTodoSearch("milk", entity.MaxTodoPageLimit+1),
+	}
+	for _, q := range queries {
+		_, err := s.Usecase.Search(ctx, user, q)
+		assert.ErrorIs(s.T(), err, ErrInvalidRequest, q.Query)
+	}
+	s.SearchIndex.AssertNotCalled(s.T(), "Search", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func (s *TodoServiceTestSuite) TestSearchFailWithDatabaseError() {
+	ctx := context.Background()
+
+	userID := "2192fc7b-bd9b-446d-a50e-5ce0ba02cee6"
+	userDTO := dto.NewFactory().NewUser(userID, "account@emai.com", "strong-password", nil, nil, nil, time.Now())
+	user, userErr := entity.NewFactory().FromUserDTO(userDTO)
+
+	s.SearchIndex.On("Search", ctx, userDTO, mock.AnythingOfType("*dto.TodoSearch")).
+		Return(nil, errors.New("connection refused"))
+
+	// assert
+	_, err := s.Usecase.Search(ctx, user, entity.NewFactory().NewTodoSearch("milk", 20))
+	assert.NoError(s.T(), userErr)
+	assert.ErrorIs(s.T(), err, ErrDatabaseError)
+}
+
+func (s *TodoServiceTestSuite) TestFetctAllByUserWithTags() {
+	ctx := context.Background()
+
+	// mock repo
+	userID := "2192fc7b-bd9b-446d-a50e-5ce0ba02cee6"
+	userDTO := dto.NewFactory().NewUser(userID, "account@emai.com", "strong-password", nil, nil, nil, time.Now())
+	user, userErr := entity.NewFactory().FromUserDTO(userDTO)
+
+	tagIDs := []string{"7d3c1a52-96b4-4f0e-8d2b-3a1f6e9c0b47", "e5b9f2d4-1c8a-4b6e-9f3d-7a2c5e8b1d60"}
+	filter := entity.NewFactory().NewTodoFilter(entity.TodoStatusOpen, entity.TodoDeletedExclude, nil, nil, nil, nil, "", tagIDs, entity.TodoTagMatchAll)
+	completed, deleted := false, false
+	filterDTO := dto.NewFactory().NewTodoFilter(&completed, &deleted, nil, nil, nil, nil, "", tagIDs, true)
+	s.Repository.On("FetchAllByUser", ctx, userDTO, filterDTO).Return([]*dto.Todo{}, nil)
+
+	// assert
+	res, err := s.Usecase.FetchAllByUser(ctx, user, filter)
+	assert.NoError(s.T(), userErr)
+	assert.NoError(s.T(), err)
+	assert.Empty(s.T(), res)
+	s.Repository.AssertExpectations(s.T())
+
+	// assert, tags are ids and matched in a known way
+	cases := []*entity.TodoFilter{
+		entity.NewFactory().NewTodoFilter(entity.TodoStatusOpen, entity.TodoDeletedExclude, nil, nil, nil, nil, "", []string{"home"}, entity.TodoTagMatchAny),
+		entity.NewFactory().NewTodoFilter(entity.TodoStatusOpen, entity.TodoDeletedExclude, nil, nil, nil, nil, "", tagIDs, "most"),
+	}
+	for _, filter := range cases {
+		_, err := s.Usecase.FetchAllByUser(ctx, user, filter)
+		assert.ErrorIs(s.T(), err, ErrInvalidRequest)
+	}
+}
+
+func (s *TodoServiceTestSuite) TestCreateTagSuccess() {
+	ctx := context.Background()
+
+	// mock repo
+	userID := "2192fc7b-bd9b-446d-a50e-5ce0ba02cee6"
+	userDTO := dto.NewFactory().NewUser(userID, "account@emai.com", "strong-password", nil, nil, nil, time.Now())
+	user, userErr := entity.NewFactory().FromUserDTO(userDTO)
+
+	s.TagRepository.On("FetchAllByUser", ctx, userDTO).Return([]*dto.Tag{}, nil)
+	s.TagRepository.On("Store", ctx, mock.AnythingOfType("*dto.Tag")).Return(nil)
+
+	// assert, the name is trimmed and the color defaults
+	res, err := s.Usecase.CreateTag(ctx, user, "  home ", "")
+	assert.NoError(s.T(), userErr)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), userID, res.UserID)
+	assert.Equal(s.T(), "home", res.Name)
+	assert.Equal(s.T(), entity.DefaultTagColor, res.Color)
+	s.TagRepository.AssertCalled(s.T(), "Store", ctx, mock.AnythingOfType("*dto.Tag"))
+}
+
+func (s *TodoServiceTestSuite) TestCreateTagFailWithInvalidTag() {
+	ctx := context.Background()
+
+	userID := "2192fc7b-bd9b-446d-a50e-5ce0ba02cee6"
+	userDTO := dto.NewFactory().NewUser(userID, "account@emai.com", "strong-password", nil, nil, nil, time.Now())
+	user, userErr := entity.NewFactory().FromUserDTO(userDTO)
+
+	cases := []struct{ name, color string }{
+		{"", "#4caf50"},
+		{"home", "green"},
+		{"home", "#4caf5"},
+	}
+
+	// assert
+	assert.NoError(s.T(), userErr)
+	for _, c := range cases {
+		_, err := s.Usecase.CreateTag(ctx, user, c.name, c.color)
+		assert.ErrorIs(s.T(), err, ErrInvalidRequest)
+	}
+	s.TagRepository.AssertNotCalled(s.T(), "Store", mock.Anything, mock.Anything)
+}
+
+func (s *TodoServiceTestSuite) TestCreateTagFailWithDuplicateName() {
+	ctx := context.Background()
+
+	// mock repo
+	userID := "2192fc7b-bd9b-446d-a50e-5ce0ba02cee6"
+	userDTO := dto.NewFactory().NewUser(userID, "account@emai.com", "strong-password", nil, nil, nil, time.Now())
+	user, userErr := entity.NewFactory().FromUserDTO(userDTO)
+
+	tagDTO := dto.NewFactory().NewTag("7d3c1a52-96b4-4f0e-8d2b-3a1f6e9c0b47", userID, "Home", "#4caf50", time.Now(), time.Now())
+	s.TagRepository.On("FetchAllByUser", ctx, userDTO).Return([]*dto.Tag{tagDTO}, nil)
+
+	// assert, names differing in case are the same
+	_, err := s.Usecase.CreateTag(ctx, user, "home", "")
+	assert.NoError(s.T(), userErr)
+	assert.ErrorIs(s.T(), err, ErrInvalidRequest)
+	s.TagRepository.AssertNotCalled(s.T(), "Store", mock.Anything, mock.Anything)
+}
+
+func (s *TodoServiceTestSuite) TestCreateTagFailWithTooManyTags() {
+	ctx := context.Background()
+
+	// mock repo
+	userID := "2192fc7b-bd9b-446d-a50e-5ce0ba02cee6"
+	userDTO := dto.NewFactory().NewUser(userID, "account@emai.com", "strong-password", nil, nil, nil, time.Now())
+	user, userErr := entity.NewFactory().FromUserDTO(userDTO)
+
+	tagDTOs := make([]*dto.Tag, entity.MaxTagsPerUser)
+	for i := range tagDTOs {
+		tagDTOs[i] = dto.NewFactory().NewTag(fmt.Sprintf("%08d-96b4-4f0e-8d2b-3a1f6e9c0b47", i), userID, fmt.Sprintf("tag %d", i), "#4caf50", time.Now(), time.Now())
+	}
+	s.TagRepository.On("FetchAllByUser", ctx, userDTO).Return(tagDTOs, nil)
+
+	// assert
+	_, err := s.Usecase.CreateTag(ctx, user, "home", "")
+	assert.NoError(s.T(), userErr)
+	assert.ErrorIs(s.T(), err, ErrInvalidRequest)
+	s.TagRepository.AssertNotCalled(s.T(), "Store", mock.Anything, mock.Anything)
+}
+
+func (s *TodoServiceTestSuite) TestUpdateTagSuccess() {
+	ctx := context.Background()
+
+	// mock repo
+	userID := "2192fc7b-bd9b-446d-a50e-5ce0ba02cee6"
+	userDTO := dto.NewFactory().NewUser(userID, "account@emai.com", "strong-password", nil, nil, nil, time.Now())
+	user, userErr := entity.NewFactory().FromUserDTO(userDTO)
+
+	id := "7d3c1a52-96b4-4f0e-8d2b-3a1f6e9c0b47"
+	tagDTO := dto.NewFactory().NewTag(id, userID, "home", "#4caf50", time.Now(), time.Now())
+	s.TagRepository.On("FetchByID", ctx, id).Return(tagDTO, nil)
+	s.TagRepository.On("FetchAllByUser", ctx, userDTO).Return([]*dto.Tag{tagDTO}, nil)
+	s.TagRepository.On("Update", ctx, mock.AnythingOfType("*dto.Tag")).Return(nil)
+
+	// assert, renaming a tag to its own name in another case is allowed, the color is kept
+	name := "Home"
+	res, err := s.Usecase.UpdateTag(ctx, user, id, entity.NewFactory().NewTagUpdate(&name, nil))
+	assert.NoError(s.T(), userErr)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), "Home", res.Name)
+	assert.Equal(s.T(), "#4caf50", res.Color)
+	s.TagRepository.AssertCalled(s.T(), "Update", ctx, mock.AnythingOfType("*dto.Tag"))
+}
+
+func (s *TodoServiceTestSuite) TestUpdateTagFailWithUnauthorized() {
+	ctx := context.Background()
+
+	// mock repo
+	userID := "2192fc7b-bd9b-446d-a50e-5ce0ba02cee6"
+	userDTO := dto.NewFactory().NewUser(userID, "account@emai.com", "strong-password", nil, nil, nil, time.Now())
+	user, userErr := entity.NewFactory().FromUserDTO(userDTO)
+
+	id := "7d3c1a52-96b4-4f0e-8d2b-3a1f6e9c0b47"
+	tagDTO := dto.NewFactory().NewTag(id, "5c2dd83a-6250-40f3-a47e-21d957c07d06", "home", "#4caf50", time.Now(), time.Now())
+	s.TagRepository.On("FetchByID", ctx, id).Return(tagDTO, nil)
+
+	// assert
+	color := "#ff0000"
+	_, err := s.Usecase.UpdateTag(ctx, user, id, entity.NewFactory().NewTagUpdate(nil, &color))
+	assert.NoError(s.T(), userErr)
+	assert.ErrorIs(s.T(), err, ErrUnauthorized)
+	s.TagRepository.AssertNotCalled(s.T(), "Update", mock.Anything, mock.Anything)
+}
+
+func (s *TodoServiceTestSuite) TestDeleteTagSuccess() {
+	ctx := context.Background()
+
+	// mock repo
+	userID := "2192fc7b-bd9b-446d-a50e-5ce0ba02cee6"
+	userDTO := dto.NewFactory().NewUser(userID, "account@emai.com", "strong-password", nil, nil, nil, time.Now())
+	user, userErr := entity.NewFactory().FromUserDTO(userDTO)
+
+	id := "7d3c1a52-96b4-4f0e-8d2b-3a1f6e9c0b47"
+	tagDTO := dto.NewFactory().NewTag(id, userID, "home", "#4caf50", time.Now(), time.Now())
+	s.TagRepository.On("FetchByID", ctx, id).Return(tagDTO, nil)
+	s.TagRepository.On("Delete", ctx, tagDTO).Return(nil)
+
+	// assert
+	err := s.Usecase.DeleteTag(ctx, user, id)
+	assert.NoError(s.T(), userErr)
+	assert.NoError(s.T(), err)
+	s.TagRepository.AssertCalled(s.T(), "Delete", ctx, tagDTO)
+}
+
+func (s *TodoServiceTestSuite) TestAttachTagSuccess() {
+	ctx := context.Background()
+
+	// mock repo
+	userID := "2192fc7b-bd9b-446d-a50e-5ce0ba02cee6"
+	userDTO := dto.NewFactory().NewUser(userID, "account@emai.com", "strong-password", nil, nil, nil, time.Now())
+	user, userErr := entity.NewFactory().FromUserDTO(userDTO)
+
+	todoID := "4daaaea8-4721-4644-aaac-7958805b4530"
+	todoDTO := dto.NewFactory().NewTodo(todoID, userID, "things todo", false, time.Now(), time.Now(), false, nil, 0, 0)
+	tagID := "7d3c1a52-96b4-4f0e-8d2b-3a1f6e9c0b47"
+	tagDTO := dto.NewFactory().NewTag(tagID, userID, "home", "#4caf50", time.Now(), time.Now())
+
+	s.Repository.On("FetchByID", ctx, todoID).Return(todoDTO, nil)
+	s.TagRepository.On("FetchByID", ctx, tagID).Return(tagDTO, nil)
+	s.TagRepository.On("Attach", ctx, todoDTO, tagDTO).Return(nil)
+	s.TagRepository.On("FetchByTodos", ctx, []string{todoID}).Return(map[string][]*dto.Tag{todoID: {tagDTO}}, nil)
+
+	// assert, the todo is returned with its tags
+	res, err := s.Usecase.AttachTag(ctx, user, todoID, tagID)
+	assert.NoError(s.T(), userErr)
+	assert.NoError(s.T(), err)
+	assert.Len(s.T(), res.Tags, 1)
+	assert.Equal(s.T(), tagID, res.Tags[0].ID)
+	s.TagRepository.AssertCalled(s.T(), "Attach", ctx, todoDTO, tagDTO)
+}
+
+func (s *TodoServiceTestSuite) TestAttachTagFailWithUnauthorized() {
+	ctx := context.Background()
+
+	// mock repo
+	userID := "2192fc7b-bd9b-446d-a50e-5ce0ba02cee6"
+	userDTO := dto.NewFactory().NewUser(userID, "account@emai.com", "strong-password", nil, nil, nil, time.Now())
+	user, userErr := entity.NewFactory().FromUserDTO(userDTO)
+
+	todoID := "4daaaea8-4721-4644-aaac-7958805b4530"
+	todoDTO := dto.NewFactory().NewTodo(todoID, userID, "things todo", false, time.Now(), time.Now(), false, nil, 0, 0)
+	tagID := "7d3c1a52-96b4-4f0e-8d2b-3a1f6e9c0b47"
+	tagDTO := dto.NewFactory().NewTag(tagID, "5c2dd83a-6250-40f3-a47e-21d957c07d06", "home", "#4caf50", time.Now(), time.Now())
+
+	s.Repository.On("FetchByID", ctx, todoID).Return(todoDTO, nil)
+	s.TagRepository.On("FetchByID", ctx, tagID).Return(tagDTO, nil)
+
+	// assert, a todo is not tagged with the tag of another user
+	_, err := s.Usecase.AttachTag(ctx, user, todoID, tagID)
+	assert.NoError(s.T(), userErr)
+	assert.ErrorIs(s.T(), err, ErrUnauthorized)
+	s.TagRepository.AssertNotCalled(s.T(), "Attach", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func (s *TodoServiceTestSuite) TestDetachTagSuccess() {
+	ctx := context.Background()
+
+	// mock repo
+	userID := "2192fc7b-bd9b-446d-a50e-5ce0ba02cee6"
+	userDTO := dto.NewFactory().NewUser(userID, "account@emai.com", "strong-password", nil, nil, nil, time.Now())
+	user, userErr := entity.NewFactory().FromUserDTO(userDTO)
+
+	todoID := "4daaaea8-4721-4644-aaac-7958805b4530"
+	todoDTO := dto.NewFactory().NewTodo(todoID, userID, "things todo", false, time.Now(), time.Now(), false, nil, 0, 0)
+	tagID := "7d3c1a52-96b4-4f0e-8d2b-3a1f6e9c0b47"
+	tagDTO := dto.NewFactory().NewTag(tagID, userID, "home", "#4caf50", time.Now(), time.Now())
+
+	s.Repository.On("FetchByID", ctx, todoID).Return(todoDTO, nil)
+	s.TagRepository.On("FetchByID", ctx, tagID).Return(tagDTO, nil)
+	s.TagRepository.On("Detach", ctx, todoDTO, tagDTO).Return(nil)
+	s.TagRepository.On("FetchByTodos", ctx, []string{todoID}).Return(map[string][]*dto.Tag{}, nil)
+
+	// assert
+	res, err := s.Usecase.DetachTag(ctx, user, todoID, tagID)
+	assert.NoError(s.T(), userErr)
+	assert.NoError(s.T(), err)
+	assert.Empty(s.T(), res.Tags)
+	s.TagRepository.AssertCalled(s.T(), "Detach", ctx, todoDTO, tagDTO)
 }
 
 func TestTodoService(t *testing.T) {
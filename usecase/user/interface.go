@@ -5,24 +5,89 @@ package user
 import (
 	"context"
 	"errors"
+	"fmt"
+	"strings"
+	"time"
 
 	"github.com/org39/webapp-tutorial-backend/entity"
 	"github.com/org39/webapp-tutorial-backend/entity/dto"
+	"github.com/org39/webapp-tutorial-backend/pkg/oidc"
 )
 
 var (
-	ErrInvalidRequest = errors.New("invalid request")
-	ErrNotFound       = errors.New("not found")
-	ErrSystemError    = errors.New("system error")
-	ErrUnauthorized   = errors.New("unauthorized")
-	ErrDatabaseError  = errors.New("database error")
+	ErrInvalidRequest  = errors.New("invalid request")
+	ErrNotFound        = errors.New("not found")
+	ErrSystemError     = errors.New("system error")
+	ErrUnauthorized    = errors.New("unauthorized")
+	ErrDatabaseError   = errors.New("database error")
+	ErrTooManyAttempts = errors.New("too many attempts")
 )
 
+// RetryAfterError is returned when the caller must wait before trying again.
+type RetryAfterError struct {
+	RetryAfter time.Duration
+}
+
+func (e *RetryAfterError) Error() string {
+	return fmt.Sprintf("retry after %s: %s", e.RetryAfter, ErrTooManyAttempts)
+}
+
+func (e *RetryAfterError) Unwrap() error {
+	return ErrTooManyAttempts
+}
+
+// PasswordRejectedError is returned when a new password does not meet the password policy.
+// Reasons are the entity.PasswordReason constants.
+type PasswordRejectedError struct {
+	Reasons []string
+}
+
+func (e *PasswordRejectedError) Error() string {
+	return fmt.Sprintf("password rejected (%s): %s", strings.Join(e.Reasons, ", "), ErrInvalidRequest)
+}
+
+func (e *PasswordRejectedError) Unwrap() error {
+	return ErrInvalidRequest
+}
+
 type Usecase interface {
 	FetchByID(ctx context.Context, id string) (*entity.User, error)
 	SignUp(ctx context.Context, email string, plainPassword string) (*entity.User, *entity.AuthTokenPair, error)
-	Login(ctx context.Context, email string, password string) (*entity.AuthTokenPair, error)
+	Login(ctx context.Context, email string, password string, clientIP string) (*entity.AuthTokenPair, *entity.MFAChallenge, error)
+	LoginMFA(ctx context.Context, mfaToken string, code string) (*entity.AuthTokenPair, error)
 	Refresh(ctx context.Context, refreshToken string) (*entity.AuthTokenPair, error)
+	Logout(ctx context.Context, refreshToken string) error
+	LogoutAll(ctx context.Context, id string) error
+	RequestMagicLink(ctx context.Context, email string) error
+	MagicLinkLogin(ctx context.Context, token string) (*entity.AuthTokenPair, *entity.MFAChallenge, error)
+	RequestPasswordReset(ctx context.Context, email string) error
+	ResetPassword(ctx context.Context, token string, plainPassword string) error
+	ChangePassword(ctx context.Context, id string, currentPassword string, plainPassword string) (*entity.AuthTokenPair, error)
+	ChangeEmail(ctx context.Context, id string, sessionID string, currentPassword string, email string) (*entity.User, error)
+	VerifyEmail(ctx context.Context, token string) error
+	ResendVerification(ctx context.Context, id string) error
+	EnrollMFA(ctx context.Context, id string) (*entity.MFAEnrollment, error)
+	ConfirmMFA(ctx context.Context, id string, code string) ([]string, error)
+	RegenerateRecoveryCodes(ctx context.Context, id string, code string) ([]string, error)
+	DisableMFA(ctx context.Context, id string, code string) error
+	CreatePersonalAccessToken(ctx context.Context, id string, name string, scopes []string, duration time.Duration) (*entity.IssuedPersonalAccessToken, error)
+	ListPersonalAccessTokens(ctx context.Context, id string) ([]*entity.PersonalAccessToken, error)
+	RevokePersonalAccessToken(ctx context.Context, id string, tokenID string) error
+	ListSessions(ctx context.Context, id string) ([]*entity.Session, error)
+	RevokeSession(ctx context.Context, id string, sessionID string) error
+	StartOAuthLogin(ctx context.Context, provider string) (*entity.OAuthFlow, string, error)
+	OAuthLogin(ctx context.Context, flow *entity.OAuthFlow, provider string, state string, code string) (*entity.AuthTokenPair, *entity.MFAChallenge, error)
+	ListUsers(ctx context.Context, email string, limit uint64, offset uint64) ([]*entity.User, error)
+	DisableUser(ctx context.Context, id string) error
+	EnableUser(ctx context.Context, id string) error
+	ForceLogout(ctx context.Context, id string) error
+	Export(ctx context.Context, id string) (*entity.UserExport, error)
+	Delete(ctx context.Context, id string, sessionID string, currentPassword string) error
+	FetchProfile(ctx context.Context, id string) (*entity.UserProfile, error)
+	UpdateProfile(ctx context.Context, id string, update *entity.UserProfileUpdate) (*entity.UserProfile, error)
+	SetAvatar(ctx context.Context, id string, image []byte) (*entity.UserProfile, error)
+	DeleteAvatar(ctx context.Context, id string) (*entity.UserProfile, error)
+	FetchAvatar(ctx context.Context, avatarID string) ([]byte, string, error)
 }
 
 type Repository interface {
@@ -30,4 +95,48 @@ type Repository interface {
 	FetchByEmail(ctx context.Context, email string) (*dto.User, error)
 	Store(ctx context.Context, u *dto.User) error
 	Update(ctx context.Context, u *dto.User) error
+	Search(ctx context.Context, email string, limit uint64, offset uint64) ([]*dto.User, error)
+	Delete(ctx context.Context, id string) error
+}
+
+// TokenRepository stores single-use tokens mailed to users, e.g. password reset tokens.
+type TokenRepository interface {
+	Store(ctx context.Context, t *dto.UserToken) error
+	FetchByHash(ctx context.Context, purpose string, tokenHash string) (*dto.UserToken, error)
+	Consume(ctx context.Context, id string) error
+	InvalidateByUser(ctx context.Context, userID string, purpose string) error
+}
+
+// MFARepository stores the TOTP second factor of users.
+type MFARepository interface {
+	FetchByUserID(ctx context.Context, userID string) (*dto.UserMFA, error)
+	Store(ctx context.Context, m *dto.UserMFA) error
+	Enable(ctx context.Context, userID string, step int64) error
+	UseStep(ctx context.Context, userID string, step int64) error
+	Delete(ctx context.Context, userID string) error
+}
+
+// ProfileRepository stores the profiles of users.
+type ProfileRepository interface {
+	FetchByUserID(ctx context.Context, userID string) (*dto.UserProfile, error)
+	Store(ctx context.Context, p *dto.UserProfile) error
+}
+
+// LoginAttemptRepository counts failed logins per key, e.g. an account or a client address.
+type LoginAttemptRepository interface {
+	Fetch(ctx context.Context, key string) (*dto.LoginAttempts, error)
+	RecordFailure(ctx context.Context, key string, at time.Time, ttl time.Duration) (*dto.LoginAttempts, error)
+	Reset(ctx context.Context, key string) error
+}
+
+// IdentityRepository stores the accounts of external providers linked to users.
+type IdentityRepository interface {
+	Store(ctx context.Context, i *dto.Identity) error
+	FetchBySubject(ctx context.Context, provider string, subject string) (*dto.Identity, error)
+}
+
+// OAuthProvider authenticates users with an external OpenID Connect provider.
+type OAuthProvider interface {
+	AuthCodeURL(ctx context.Context, state string, nonce string, codeVerifier string) (string, error)
+	Identify(ctx context.Context, code string, codeVerifier string, nonce string) (*oidc.Identity, error)
 }
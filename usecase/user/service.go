@@ -4,17 +4,57 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/url"
+	"strings"
+	"time"
 
 	"github.com/org39/webapp-tutorial-backend/entity"
 	"github.com/org39/webapp-tutorial-backend/entity/dto"
+	"github.com/org39/webapp-tutorial-backend/pkg/blob"
+	"github.com/org39/webapp-tutorial-backend/pkg/breach"
+	"github.com/org39/webapp-tutorial-backend/pkg/crypt"
+	"github.com/org39/webapp-tutorial-backend/pkg/log"
+	"github.com/org39/webapp-tutorial-backend/pkg/mail"
+	"github.com/org39/webapp-tutorial-backend/pkg/oidc"
+	"github.com/org39/webapp-tutorial-backend/pkg/totp"
+	"github.com/org39/webapp-tutorial-backend/pkg/uuid"
 
 	"github.com/org39/webapp-tutorial-backend/usecase/auth"
+	"github.com/org39/webapp-tutorial-backend/usecase/todo"
+)
+
+const (
+	recoveryCodeCount = 10
+	// recovery codes are meant to last, but expires_at is a TIMESTAMP which ends in 2038
+	recoveryCodeDuration = 5 * 365 * 24 * time.Hour
+	// the most users listed at once
+	maxListUsersLimit = 100
 )
 
 type Service struct {
-	Repository   Repository   `inject:""`
-	AuthUsecase  auth.Usecase `inject:""`
-	PasswordSalt string       `inject:"usecase.user.password_salt"`
+	Repository                 Repository               `inject:""`
+	TokenRepository            TokenRepository          `inject:""`
+	MFARepository              MFARepository            `inject:""`
+	ProfileRepository          ProfileRepository        `inject:""`
+	BlobStore                  blob.Store               `inject:""`
+	AuthUsecase                auth.Usecase             `inject:""`
+	TodoUsecase                todo.Usecase             `inject:""`
+	Mailer                     mail.Mailer              `inject:""`
+	PasswordHasher             *crypt.PasswordHasher    `inject:""`
+	PasswordResetURL           string                   `inject:"usecase.user.password_reset_url"`
+	PasswordResetTokenDuration time.Duration            `inject:"usecase.user.password_reset_token_duration"`
+	VerificationURL            string                   `inject:"usecase.user.verification_url"`
+	VerificationTokenDuration  time.Duration            `inject:"usecase.user.verification_token_duration"`
+	MagicLinkURL               string                   `inject:"usecase.user.magic_link_url"`
+	MagicLinkTokenDuration     time.Duration            `inject:"usecase.user.magic_link_token_duration"`
+	MFAIssuer                  string                   `inject:"usecase.user.mfa_issuer"`
+	LoginAttemptRepository     LoginAttemptRepository   `inject:""`
+	AccountLoginThrottle       *entity.LoginThrottle    `inject:"usecase.user.account_login_throttle"`
+	IPLoginThrottle            *entity.LoginThrottle    `inject:"usecase.user.ip_login_throttle"`
+	IdentityRepository         IdentityRepository       `inject:""`
+	OAuthProviders             map[string]OAuthProvider `inject:"usecase.user.oauth_providers"`
+	PasswordPolicy             *entity.PasswordPolicy   `inject:"usecase.user.password_policy"`
+	BreachedPasswords          breach.Checker           `inject:""`
 }
 
 func NewService(options ...func(*Service) error) (Usecase, error) {
@@ -43,30 +83,161 @@ func WithAuthUsecase(a auth.Usecase) func(*Service) error {
 	}
 }
 
+func WithTodoUsecase(t todo.Usecase) func(*Service) error {
+	return func(u *Service) error {
+		u.TodoUsecase = t
+		return nil
+	}
+}
+
+func WithTokenRepository(r TokenRepository) func(*Service) error {
+	return func(u *Service) error {
+		u.TokenRepository = r
+		return nil
+	}
+}
+
+func WithMFARepository(r MFARepository) func(*Service) error {
+	return func(u *Service) error {
+		u.MFARepository = r
+		return nil
+	}
+}
+
+func WithProfileRepository(r ProfileRepository) func(*Service) error {
+	return func(u *Service) error {
+		u.ProfileRepository = r
+		return nil
+	}
+}
+
+func WithBlobStore(b blob.Store) func(*Service) error {
+	return func(u *Service) error {
+		u.BlobStore = b
+		return nil
+	}
+}
+
+// WithLoginThrottle enables brute-force protection of Login, a nil throttle disables its key.
+func WithLoginThrottle(r LoginAttemptRepository, account *entity.LoginThrottle, ip *entity.LoginThrottle) func(*Service) error {
+	return func(u *Service) error {
+		u.LoginAttemptRepository = r
+		u.AccountLoginThrottle = account
+		u.IPLoginThrottle = ip
+		return nil
+	}
+}
+
+// WithPasswordPolicy sets which new passwords are accepted, a nil breached checker skips the breach check.
+func WithPasswordPolicy(policy *entity.PasswordPolicy, breached breach.Checker) func(*Service) error {
+	return func(u *Service) error {
+		u.PasswordPolicy = policy
+		u.BreachedPasswords = breached
+		return nil
+	}
+}
+
+func WithPasswordHasher(h *crypt.PasswordHasher) func(*Service) error {
+	return func(u *Service) error {
+		u.PasswordHasher = h
+		return nil
+	}
+}
+
+// WithOAuthProviders enables login with external providers, keyed by the name used in routes.
+func WithOAuthProviders(r IdentityRepository, providers map[string]OAuthProvider) func(*Service) error {
+	return func(u *Service) error {
+		u.IdentityRepository = r
+		u.OAuthProviders = providers
+		return nil
+	}
+}
+
+func WithMFAIssuer(issuer string) func(*Service) error {
+	return func(u *Service) error {
+		u.MFAIssuer = issuer
+		return nil
+	}
+}
+
+func WithMailer(m mail.Mailer) func(*Service) error {
+	return func(u *Service) error {
+		u.Mailer = m
+		return nil
+	}
+}
+
+func WithPasswordResetURL(resetURL string) func(*Service) error {
+	return func(u *Service) error {
+		u.PasswordResetURL = resetURL
+		return nil
+	}
+}
+
+func WithPasswordResetTokenDuration(d time.Duration) func(*Service) error {
+	return func(u *Service) error {
+		u.PasswordResetTokenDuration = d
+		return nil
+	}
+}
+
+func WithVerificationURL(verificationURL string) func(*Service) error {
+	return func(u *Service) error {
+		u.VerificationURL = verificationURL
+		return nil
+	}
+}
+
+func WithVerificationTokenDuration(d time.Duration) func(*Service) error {
+	return func(u *Service) error {
+		u.VerificationTokenDuration = d
+		return nil
+	}
+}
+
+func WithMagicLinkURL(magicLinkURL string) func(*Service) error {
+	return func(u *Service) error {
+		u.MagicLinkURL = magicLinkURL
+		return nil
+	}
+}
+
+func WithMagicLinkTokenDuration(d time.Duration) func(*Service) error {
+	return func(u *Service) error {
+		u.MagicLinkTokenDuration = d
+		return nil
+	}
+}
+
 func (u *Service) SignUp(ctx context.Context, email string, plainPassword string) (*entity.User, *entity.AuthTokenPair, error) {
 	// validation on parameters
 	if err := entity.NewValidator().ValidateEmail(email); err != nil {
 		return nil, nil, fmt.Errorf("%s: invalid signup request: %w", err, ErrInvalidRequest)
 	}
 
-	if err := entity.NewValidator().ValidatePlainPassword(plainPassword); err != nil {
-		return nil, nil, fmt.Errorf("%s: invalid signup request: %w", err, ErrInvalidRequest)
+	if err := u.checkNewPassword(ctx, plainPassword, email); err != nil {
+		return nil, nil, err
 	}
 
 	// test email alread exist
-	_, err := u.Repository.FetchByEmail(ctx, email)
+	existing, err := u.Repository.FetchByEmail(ctx, email)
 	switch {
 	case errors.Is(err, ErrNotFound):
 		// do nothing
-	case err == nil:
-		return nil, nil, fmt.Errorf("email already exist: %w", ErrInvalidRequest)
 	case err != nil:
 		return nil, nil, err
+	default:
+		// users without a password may not know they have one, the owner of the address logs in with the link
+		if existing.Password == "" {
+			if err := u.mailMagicLink(ctx, existing.ID, existing.Email); err != nil {
+				log.LoggerWithSpan(ctx).WithError(err).Warn("fail to send magic link")
+			}
+		}
+		return nil, nil, fmt.Errorf("email already exist: %w", ErrInvalidRequest)
 	}
 
 	// create user object
-	saltedPassword := fmt.Sprintf("%s%s", plainPassword, u.PasswordSalt)
-	user, err := entity.NewFactory().NewUser(email, saltedPassword)
+	user, err := entity.NewFactory().NewUser(email, plainPassword, u.PasswordHasher)
 	if err != nil {
 		return nil, nil, fmt.Errorf("%s: %w", err.Error(), ErrSystemError)
 	}
@@ -77,11 +248,16 @@ func (u *Service) SignUp(ctx context.Context, email string, plainPassword string
 	}
 
 	// store user
-	userDTO := dto.NewFactory().NewUser(user.ID, user.Email, user.Password, user.CreatedAt)
+	userDTO := dto.NewFactory().NewUser(user.ID, user.Email, user.Password, user.Roles, user.VerifiedAt, user.DisabledAt, user.CreatedAt)
 	if err := u.Repository.Store(ctx, userDTO); err != nil {
 		return nil, nil, err
 	}
 
+	// verification mail is best effort, the user can ask for another one
+	if err := u.sendVerification(ctx, user.ID, user.Email); err != nil {
+		log.LoggerWithSpan(ctx).WithError(err).Warn("fail to send verification mail")
+	}
+
 	token, err := u.AuthUsecase.GenereateToken(ctx, user.ID)
 	if err != nil {
 		return nil, nil, toUserServiceError(err)
@@ -90,27 +266,78 @@ func (u *Service) SignUp(ctx context.Context, email string, plainPassword string
 	return user, token, nil
 }
 
-func (u *Service) Login(ctx context.Context, email string, plainPassword string) (*entity.AuthTokenPair, error) {
+// Login verifies the password, failures are throttled per account and per client address.
+// When the user enabled a second factor, no token is issued yet,
+// the returned challenge must be completed with LoginMFA.
+func (u *Service) Login(ctx context.Context, email string, plainPassword string, clientIP string) (*entity.AuthTokenPair, *entity.MFAChallenge, error) {
+	throttles := u.loginThrottles(email, clientIP)
+	if err := u.checkLoginThrottles(ctx, throttles); err != nil {
+		return nil, nil, err
+	}
+
 	// test email alread exist
 	userDTO, err := u.Repository.FetchByEmail(ctx, email)
 	switch {
 	case errors.Is(err, ErrNotFound):
-		return nil, fmt.Errorf("email not found: %w", ErrNotFound)
+		// guessing accounts costs attempts too
+		if err := u.recordLoginFailure(ctx, throttles); err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, fmt.Errorf("email not found: %w", ErrNotFound)
 	case err != nil:
-		return nil, err
+		return nil, nil, err
 	}
 
 	user, err := entity.NewFactory().FromUserDTO(userDTO)
 	if err != nil {
-		return nil, fmt.Errorf("%s: %w", err, ErrSystemError)
+		return nil, nil, fmt.Errorf("%s: %w", err, ErrSystemError)
+	}
+
+	if err := user.ValidPassword(u.PasswordHasher, plainPassword); err != nil {
+		if !errors.Is(err, crypt.ErrPasswordMismatch) {
+			return nil, nil, fmt.Errorf("%s: %w", err, ErrSystemError)
+		}
+		if err := u.recordLoginFailure(ctx, throttles); err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, fmt.Errorf("%w", ErrUnauthorized)
+	}
+
+	// rehash is best effort, the stored hash still verifies
+	if user.PasswordNeedsRehash(u.PasswordHasher) {
+		if err := u.rehashPassword(ctx, user, plainPassword); err != nil {
+			log.LoggerWithSpan(ctx).WithError(err).Warn("fail to rehash password")
+		}
 	}
 
-	saltedPassword := fmt.Sprintf("%s%s", plainPassword, u.PasswordSalt)
-	if err := user.ValidPassword(saltedPassword); err != nil {
-		return nil, fmt.Errorf("%w", ErrUnauthorized)
+	// the address is not reset, a valid account must not clear failures against others
+	if err := u.resetLoginThrottle(ctx, throttles, accountLoginThrottleKey(email)); err != nil {
+		return nil, nil, err
 	}
 
-	token, err := u.AuthUsecase.GenereateToken(ctx, user.ID)
+	return u.issueLoginTokens(ctx, user.ID)
+}
+
+// LoginMFA completes a login challenge with a TOTP code or a recovery code.
+func (u *Service) LoginMFA(ctx context.Context, mfaToken string, code string) (*entity.AuthTokenPair, error) {
+	id, err := u.AuthUsecase.VerifyMFAToken(ctx, mfaToken)
+	if err != nil {
+		return nil, toUserServiceError(err)
+	}
+
+	mfa, err := u.fetchEnabledMFA(ctx, id)
+	switch {
+	case err != nil:
+		return nil, err
+	case mfa == nil:
+		return nil, fmt.Errorf("mfa is not enabled: %w", ErrUnauthorized)
+	}
+
+	if err := u.verifySecondFactor(ctx, mfa, code); err != nil {
+		return nil, err
+	}
+
+	token, err := u.AuthUsecase.GenereateToken(ctx, id)
 	if err != nil {
 		return nil, toUserServiceError(err)
 	}
@@ -127,18 +354,1338 @@ func (u *Service) Refresh(ctx context.Context, refreshToken string) (*entity.Aut
 	return token, nil
 }
 
-func (u *Service) FetchByID(ctx context.Context, id string) (*entity.User, error) {
-	userDTO, err := u.Repository.FetchByID(ctx, id)
+func (u *Service) Logout(ctx context.Context, refreshToken string) error {
+	if err := u.AuthUsecase.RevokeToken(ctx, refreshToken); err != nil {
+		return toUserServiceError(err)
+	}
+
+	return nil
+}
+
+func (u *Service) LogoutAll(ctx context.Context, id string) error {
+	if err := u.AuthUsecase.RevokeAllTokens(ctx, id); err != nil {
+		return toUserServiceError(err)
+	}
+
+	return nil
+}
+
+func (u *Service) CreatePersonalAccessToken(ctx context.Context, id string, name string, scopes []string, duration time.Duration) (*entity.IssuedPersonalAccessToken, error) {
+	t, err := u.AuthUsecase.CreatePersonalAccessToken(ctx, id, name, scopes, duration)
 	if err != nil {
 		return nil, toUserServiceError(err)
 	}
 
-	user, err := entity.NewFactory().FromUserDTO(userDTO)
+	return t, nil
+}
+
+func (u *Service) ListPersonalAccessTokens(ctx context.Context, id string) ([]*entity.PersonalAccessToken, error) {
+	tokens, err := u.AuthUsecase.ListPersonalAccessTokens(ctx, id)
 	if err != nil {
 		return nil, toUserServiceError(err)
 	}
 
-	return user, nil
+	return tokens, nil
+}
+
+func (u *Service) RevokePersonalAccessToken(ctx context.Context, id string, tokenID string) error {
+	if err := u.AuthUsecase.RevokePersonalAccessToken(ctx, id, tokenID); err != nil {
+		return toUserServiceError(err)
+	}
+
+	return nil
+}
+
+func (u *Service) ListSessions(ctx context.Context, id string) ([]*entity.Session, error) {
+	sessions, err := u.AuthUsecase.ListSessions(ctx, id)
+	if err != nil {
+		return nil, toUserServiceError(err)
+	}
+
+	return sessions, nil
+}
+
+func (u *Service) RevokeSession(ctx context.Context, id string, sessionID string) error {
+	if err := u.AuthUsecase.RevokeSession(ctx, id, sessionID); err != nil {
+		return toUserServiceError(err)
+	}
+
+	return nil
+}
+
+// StartOAuthLogin begins a login with an external provider. It returns the flow,
+// to be kept by the user agent until the callback, and the URL of the provider to send it to.
+func (u *Service) StartOAuthLogin(ctx context.Context, provider string) (*entity.OAuthFlow, string, error) {
+	p, ok := u.OAuthProviders[provider]
+	if !ok {
+		return nil, "", fmt.Errorf("oauth provider %s: %w", provider, ErrNotFound)
+	}
+
+	flow, err := entity.NewFactory().NewOAuthFlow(provider)
+	if err != nil {
+		return nil, "", fmt.Errorf("%s: %w", err, ErrSystemError)
+	}
+
+	authURL, err := p.AuthCodeURL(ctx, flow.State, flow.Nonce, flow.CodeVerifier)
+	if err != nil {
+		return nil, "", toOAuthError(err)
+	}
+
+	return flow, authURL, nil
+}
+
+// OAuthLogin completes a login with an external provider. On first login, the account of the provider
+// is linked to the user with the same email address, or to a new user. A second factor is still required.
+func (u *Service) OAuthLogin(ctx context.Context, flow *entity.OAuthFlow, provider string, state string, code string) (*entity.AuthTokenPair, *entity.MFAChallenge, error) {
+	if flow == nil || flow.Valid() != nil || !flow.Matches(provider, state) {
+		return nil, nil, fmt.Errorf("oauth state mismatch: %w", ErrUnauthorized)
+	}
+
+	p, ok := u.OAuthProviders[provider]
+	if !ok {
+		return nil, nil, fmt.Errorf("oauth provider %s: %w", provider, ErrNotFound)
+	}
+
+	identity, err := p.Identify(ctx, code, flow.CodeVerifier, flow.Nonce)
+	if err != nil {
+		return nil, nil, toOAuthError(err)
+	}
+
+	user, err := u.userOfIdentity(ctx, provider, identity)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return u.issueLoginTokens(ctx, user.ID)
+}
+
+// RequestMagicLink mails a login link to the user, signing up a user without a password for unknown emails.
+// The response is the same either way, so the endpoint can not be used to probe for accounts.
+func (u *Service) RequestMagicLink(ctx context.Context, email string) error {
+	if err := entity.NewValidator().ValidateEmail(email); err != nil {
+		return fmt.Errorf("%s: invalid magic link request: %w", err, ErrInvalidRequest)
+	}
+
+	var id string
+	userDTO, err := u.Repository.FetchByEmail(ctx, email)
+	switch {
+	case errors.Is(err, ErrNotFound):
+		user, err := u.signUpWithoutPassword(ctx, email)
+		if err != nil {
+			return err
+		}
+		id = user.ID
+	case err != nil:
+		return err
+	default:
+		id = userDTO.ID
+	}
+
+	return u.mailMagicLink(ctx, id, email)
+}
+
+// mailMagicLink mails a login link to the user, invalidating the earlier one.
+func (u *Service) mailMagicLink(ctx context.Context, id string, email string) error {
+	token, err := u.issueToken(ctx, id, entity.UserTokenPurposeMagicLink, u.MagicLinkTokenDuration)
+	if err != nil {
+		return err
+	}
+
+	return u.mailTokenLink(ctx, email, u.MagicLinkURL, token,
+		"Log in",
+		fmt.Sprintf("Open the link below to log in. The link expires in %s and works once.", u.MagicLinkTokenDuration),
+	)
+}
+
+// MagicLinkLogin logs in with a token from RequestMagicLink.
+// The link was delivered to the address, so it also verifies the email of the user.
+func (u *Service) MagicLinkLogin(ctx context.Context, token string) (*entity.AuthTokenPair, *entity.MFAChallenge, error) {
+	if err := entity.NewValidator().ValidateToken(token); err != nil {
+		return nil, nil, fmt.Errorf("%s: invalid magic link login request: %w", err, ErrInvalidRequest)
+	}
+
+	userToken, err := u.consumeToken(ctx, entity.UserTokenPurposeMagicLink, token)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	userDTO, err := u.Repository.FetchByID(ctx, userToken.UserID)
+	if err != nil {
+		return nil, nil, toUserServiceError(err)
+	}
+
+	if userDTO.VerifiedAt == nil {
+		now := time.Now()
+		userDTO.VerifiedAt = &now
+		if err := u.Repository.Update(ctx, userDTO); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return u.issueLoginTokens(ctx, userDTO.ID)
+}
+
+// RequestPasswordReset mails a reset link to the user.
+// Unknown emails are not reported, so the endpoint can not be used to probe for accounts.
+func (u *Service) RequestPasswordReset(ctx context.Context, email string) error {
+	if err := entity.NewValidator().ValidateEmail(email); err != nil {
+		return fmt.Errorf("%s: invalid password reset request: %w", err, ErrInvalidRequest)
+	}
+
+	userDTO, err := u.Repository.FetchByEmail(ctx, email)
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return nil
+	case err != nil:
+		return err
+	}
+
+	token, err := u.issueToken(ctx, userDTO.ID, entity.UserTokenPurposePasswordReset, u.PasswordResetTokenDuration)
+	if err != nil {
+		return err
+	}
+
+	return u.mailTokenLink(ctx, userDTO.Email, u.PasswordResetURL, token,
+		"Reset your password",
+		fmt.Sprintf("Open the link below to choose a new password. The link expires in %s.", u.PasswordResetTokenDuration),
+	)
+}
+
+// ResetPassword sets a new password with a token from RequestPasswordReset, and ends every session of the user.
+func (u *Service) ResetPassword(ctx context.Context, token string, plainPassword string) error {
+	if err := entity.NewValidator().ValidateToken(token); err != nil {
+		return fmt.Errorf("%s: invalid password reset request: %w", err, ErrInvalidRequest)
+	}
+
+	// too short for any policy, no need to look the token up
+	if err := entity.NewValidator().ValidatePlainPassword(plainPassword); err != nil {
+		return &PasswordRejectedError{Reasons: []string{entity.PasswordReasonTooShort}}
+	}
+
+	userToken, err := u.fetchUsableToken(ctx, entity.UserTokenPurposePasswordReset, token)
+	if err != nil {
+		return err
+	}
+
+	userDTO, err := u.Repository.FetchByID(ctx, userToken.UserID)
+	if err != nil {
+		return toUserServiceError(err)
+	}
+
+	// a rejected password must not burn the token, the user tries another one with the same link
+	if err := u.checkNewPassword(ctx, plainPassword, userDTO.Email); err != nil {
+		return err
+	}
+
+	if err := u.consumeUserToken(ctx, userToken); err != nil {
+		return err
+	}
+
+	hashedPassword, err := u.PasswordHasher.Hash([]byte(plainPassword))
+	if err != nil {
+		return fmt.Errorf("%s: %w", err, ErrSystemError)
+	}
+
+	userDTO.Password = hashedPassword
+	if err := u.Repository.Update(ctx, userDTO); err != nil {
+		return err
+	}
+
+	if err := u.TokenRepository.InvalidateByUser(ctx, userDTO.ID, entity.UserTokenPurposePasswordReset); err != nil {
+		return err
+	}
+
+	if err := u.AuthUsecase.RevokeAllTokens(ctx, userDTO.ID); err != nil {
+		return toUserServiceError(err)
+	}
+
+	return nil
+}
+
+// ChangePassword replaces the password of a logged-in user and revokes every session.
+// It returns a new token pair, so the session which changed the password stays logged in.
+func (u *Service) ChangePassword(ctx context.Context, id string, currentPassword string, plainPassword string) (*entity.AuthTokenPair, error) {
+	// too short for any policy, no need to look the user up
+	if err := entity.NewValidator().ValidatePlainPassword(plainPassword); err != nil {
+		return nil, &PasswordRejectedError{Reasons: []string{entity.PasswordReasonTooShort}}
+	}
+
+	user, err := u.FetchByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := u.verifyCurrentPassword(ctx, user, currentPassword); err != nil {
+		return nil, err
+	}
+
+	if err := u.checkNewPassword(ctx, plainPassword, user.Email); err != nil {
+		return nil, err
+	}
+
+	if err := user.SetPassword(u.PasswordHasher, plainPassword); err != nil {
+		return nil, fmt.Errorf("%s: %w", err, ErrSystemError)
+	}
+
+	userDTO := dto.NewFactory().NewUser(user.ID, user.Email, user.Password, user.Roles, user.VerifiedAt, user.DisabledAt, user.CreatedAt)
+	if err := u.Repository.Update(ctx, userDTO); err != nil {
+		return nil, err
+	}
+
+	// a reset link mailed earlier must not undo the change
+	if err := u.TokenRepository.InvalidateByUser(ctx, user.ID, entity.UserTokenPurposePasswordReset); err != nil {
+		return nil, err
+	}
+
+	if err := u.AuthUsecase.RevokeAllTokens(ctx, user.ID); err != nil {
+		return nil, toUserServiceError(err)
+	}
+
+	token, err := u.AuthUsecase.GenereateToken(ctx, user.ID)
+	if err != nil {
+		return nil, toUserServiceError(err)
+	}
+
+	return token, nil
+}
+
+// ChangeEmail moves a logged-in user to a new email address, which must be verified again.
+func (u *Service) ChangeEmail(ctx context.Context, id string, sessionID string, currentPassword string, email string) (*entity.User, error) {
+	if err := entity.NewValidator().ValidateEmail(email); err != nil {
+		return nil, fmt.Errorf("%s: invalid email change request: %w", err, ErrInvalidRequest)
+	}
+
+	user, err := u.FetchByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := u.reauthenticate(ctx, user, sessionID, currentPassword); err != nil {
+		return nil, err
+	}
+
+	// emails are compared case-insensitively by the database
+	if strings.EqualFold(user.Email, email) {
+		return nil, fmt.Errorf("email unchanged: %w", ErrInvalidRequest)
+	}
+
+	// test email alread exist
+	_, err = u.Repository.FetchByEmail(ctx, email)
+	switch {
+	case errors.Is(err, ErrNotFound):
+		// do nothing
+	case err == nil:
+		return nil, fmt.Errorf("email already exist: %w", ErrInvalidRequest)
+	case err != nil:
+		return nil, err
+	}
+
+	previousEmail := user.Email
+	user.Email = email
+	user.VerifiedAt = nil
+	if err := user.Valid(); err != nil {
+		return nil, fmt.Errorf("%s: %w", err.Error(), ErrInvalidRequest)
+	}
+
+	userDTO := dto.NewFactory().NewUser(user.ID, user.Email, user.Password, user.Roles, user.VerifiedAt, user.DisabledAt, user.CreatedAt)
+	if err := u.Repository.Update(ctx, userDTO); err != nil {
+		return nil, err
+	}
+
+	// links mailed to the previous address must not work anymore
+	for _, purpose := range []string{entity.UserTokenPurposeEmailVerification, entity.UserTokenPurposePasswordReset, entity.UserTokenPurposeMagicLink} {
+		if err := u.TokenRepository.InvalidateByUser(ctx, user.ID, purpose); err != nil {
+			return nil, err
+		}
+	}
+
+	// mails are best effort, the user can ask for another verification mail
+	if err := u.sendVerification(ctx, user.ID, user.Email); err != nil {
+		log.LoggerWithSpan(ctx).WithError(err).Warn("fail to send verification mail")
+	}
+
+	notice := mail.NewMessage(previousEmail, "Your email address was changed",
+		fmt.Sprintf("The email address of your account was changed to %s.\nIf you did not change it, reset your password.\n", user.Email))
+	if err := u.Mailer.Send(ctx, notice); err != nil {
+		log.LoggerWithSpan(ctx).WithError(err).Warn("fail to send email change notice")
+	}
+
+	return user, nil
+}
+
+// VerifyEmail marks the email address of the user as verified, with a token mailed on sign up.
+func (u *Service) VerifyEmail(ctx context.Context, token string) error {
+	if err := entity.NewValidator().ValidateToken(token); err != nil {
+		return fmt.Errorf("%s: invalid verification request: %w", err, ErrInvalidRequest)
+	}
+
+	userToken, err := u.consumeToken(ctx, entity.UserTokenPurposeEmailVerification, token)
+	if err != nil {
+		return err
+	}
+
+	userDTO, err := u.Repository.FetchByID(ctx, userToken.UserID)
+	if err != nil {
+		return toUserServiceError(err)
+	}
+
+	if userDTO.VerifiedAt != nil {
+		return nil
+	}
+
+	now := time.Now()
+	userDTO.VerifiedAt = &now
+	if err := u.Repository.Update(ctx, userDTO); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ResendVerification mails a new verification link, earlier links stop working.
+func (u *Service) ResendVerification(ctx context.Context, id string) error {
+	userDTO, err := u.Repository.FetchByID(ctx, id)
+	if err != nil {
+		return toUserServiceError(err)
+	}
+
+	if userDTO.VerifiedAt != nil {
+		return fmt.Errorf("email already verified: %w", ErrInvalidRequest)
+	}
+
+	return u.sendVerification(ctx, userDTO.ID, userDTO.Email)
+}
+
+// EnrollMFA starts the enrollment of a TOTP second factor, it is enabled once confirmed with ConfirmMFA.
+// Enrolling again before confirmation replaces the secret.
+func (u *Service) EnrollMFA(ctx context.Context, id string) (*entity.MFAEnrollment, error) {
+	userDTO, err := u.Repository.FetchByID(ctx, id)
+	if err != nil {
+		return nil, toUserServiceError(err)
+	}
+
+	existing, err := u.fetchEnabledMFA(ctx, id)
+	switch {
+	case err != nil:
+		return nil, err
+	case existing != nil:
+		return nil, fmt.Errorf("mfa already enabled: %w", ErrInvalidRequest)
+	}
+
+	mfa, err := entity.NewFactory().NewUserMFA(id)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", err, ErrSystemError)
+	}
+
+	if err := mfa.Valid(); err != nil {
+		return nil, fmt.Errorf("%s: %w", err, ErrSystemError)
+	}
+
+	mfaDTO := dto.NewFactory().NewUserMFA(mfa.UserID, mfa.Secret, mfa.Enabled, mfa.LastUsedStep, mfa.CreatedAt)
+	if err := u.MFARepository.Store(ctx, mfaDTO); err != nil {
+		return nil, err
+	}
+
+	return entity.NewFactory().NewMFAEnrollment(mfa.Secret, totp.URI(u.MFAIssuer, userDTO.Email, mfa.Secret)), nil
+}
+
+// ConfirmMFA enables the enrolled second factor with a first code, and returns the recovery codes.
+func (u *Service) ConfirmMFA(ctx context.Context, id string, code string) ([]string, error) {
+	mfaDTO, err := u.MFARepository.FetchByUserID(ctx, id)
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return nil, fmt.Errorf("mfa not enrolled: %w", ErrInvalidRequest)
+	case err != nil:
+		return nil, err
+	}
+
+	mfa, err := entity.NewFactory().FromUserMFADTO(mfaDTO)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", err, ErrSystemError)
+	}
+
+	if mfa.Enabled {
+		return nil, fmt.Errorf("mfa already enabled: %w", ErrInvalidRequest)
+	}
+
+	step, ok := mfa.VerifyCode(code, time.Now())
+	if !ok {
+		return nil, fmt.Errorf("invalid mfa code: %w", ErrUnauthorized)
+	}
+
+	err = u.MFARepository.Enable(ctx, id, step)
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return nil, fmt.Errorf("mfa already enabled: %w", ErrInvalidRequest)
+	case err != nil:
+		return nil, err
+	}
+
+	return u.issueRecoveryCodes(ctx, id)
+}
+
+// RegenerateRecoveryCodes replaces every recovery code of the user.
+func (u *Service) RegenerateRecoveryCodes(ctx context.Context, id string, code string) ([]string, error) {
+	mfa, err := u.fetchEnabledMFA(ctx, id)
+	switch {
+	case err != nil:
+		return nil, err
+	case mfa == nil:
+		return nil, fmt.Errorf("mfa is not enabled: %w", ErrInvalidRequest)
+	}
+
+	if err := u.verifySecondFactor(ctx, mfa, code); err != nil {
+		return nil, err
+	}
+
+	return u.issueRecoveryCodes(ctx, id)
+}
+
+func (u *Service) DisableMFA(ctx context.Context, id string, code string) error {
+	mfa, err := u.fetchEnabledMFA(ctx, id)
+	switch {
+	case err != nil:
+		return err
+	case mfa == nil:
+		return fmt.Errorf("mfa is not enabled: %w", ErrInvalidRequest)
+	}
+
+	if err := u.verifySecondFactor(ctx, mfa, code); err != nil {
+		return err
+	}
+
+	if err := u.MFARepository.Delete(ctx, id); err != nil {
+		return err
+	}
+
+	if err := u.TokenRepository.InvalidateByUser(ctx, id, entity.UserTokenPurposeMFARecovery); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (u *Service) FetchByID(ctx context.Context, id string) (*entity.User, error) {
+	userDTO, err := u.Repository.FetchByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := entity.NewFactory().FromUserDTO(userDTO)
+	if err != nil {
+		return nil, toUserServiceError(err)
+	}
+
+	return user, nil
+}
+
+// ListUsers returns users whose email contains the query, oldest first, an empty query lists every user.
+func (u *Service) ListUsers(ctx context.Context, email string, limit uint64, offset uint64) ([]*entity.User, error) {
+	if limit == 0 || limit > maxListUsersLimit {
+		return nil, fmt.Errorf("limit must be between 1 and %d: %w", maxListUsersLimit, ErrInvalidRequest)
+	}
+
+	userDTOs, err := u.Repository.Search(ctx, email, limit, offset)
+	if err != nil {
+		return nil, toUserServiceError(err)
+	}
+
+	users := make([]*entity.User, 0, len(userDTOs))
+	for _, userDTO := range userDTOs {
+		user, err := entity.NewFactory().FromUserDTO(userDTO)
+		if err != nil {
+			return nil, toUserServiceError(err)
+		}
+		users = append(users, user)
+	}
+
+	return users, nil
+}
+
+// DisableUser keeps the user from logging in and logs out every device of the user.
+func (u *Service) DisableUser(ctx context.Context, id string) error {
+	user, err := u.FetchByID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	user.Disable(time.Now())
+	userDTO := dto.NewFactory().NewUser(user.ID, user.Email, user.Password, user.Roles, user.VerifiedAt, user.DisabledAt, user.CreatedAt)
+	if err := u.Repository.Update(ctx, userDTO); err != nil {
+		return err
+	}
+
+	// tokens issued before are not checked against the account
+	return u.LogoutAll(ctx, user.ID)
+}
+
+// EnableUser lets a disabled user log in again.
+func (u *Service) EnableUser(ctx context.Context, id string) error {
+	user, err := u.FetchByID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	user.Enable()
+	userDTO := dto.NewFactory().NewUser(user.ID, user.Email, user.Password, user.Roles, user.VerifiedAt, user.DisabledAt, user.CreatedAt)
+	return u.Repository.Update(ctx, userDTO)
+}
+
+// ForceLogout revokes every token of the user, like LogoutAll but on behalf of an admin.
+func (u *Service) ForceLogout(ctx context.Context, id string) error {
+	if _, err := u.FetchByID(ctx, id); err != nil {
+		return err
+	}
+
+	return u.LogoutAll(ctx, id)
+}
+
+// Export returns the profile of the user and every todo, including deleted ones.
+func (u *Service) Export(ctx context.Context, id string) (*entity.UserExport, error) {
+	user, err := u.FetchByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	profile, err := u.FetchProfile(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	todos, err := u.TodoUsecase.FetchAllByUser(ctx, user, entity.NewFactory().NewTodoFilter(entity.TodoStatusAll, entity.TodoDeletedInclude, nil, nil, nil, nil, "", nil, entity.TodoTagMatchAny))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", err, ErrSystemError)
+	}
+
+	tags, err := u.TodoUsecase.FetchTagsByUser(ctx, user)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", err, ErrSystemError)
+	}
+
+	return entity.NewFactory().NewUserExport(user, profile, todos, tags, time.Now()), nil
+}
+
+// Delete removes the user and everything the user owns, for good.
+func (u *Service) Delete(ctx context.Context, id string, sessionID string, currentPassword string) error {
+	user, err := u.FetchByID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if err := u.reauthenticate(ctx, user, sessionID, currentPassword); err != nil {
+		return err
+	}
+
+	profile, err := u.FetchProfile(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+
+	if err := u.Repository.Delete(ctx, user.ID); err != nil {
+		return err
+	}
+
+	if profile.HasAvatar() {
+		u.deleteAvatarImage(ctx, profile.AvatarID)
+	}
+
+	// the account is gone, todos left in the search index are only wasted space
+	if err := u.TodoUsecase.PurgeUser(ctx, user); err != nil {
+		log.LoggerWithSpan(ctx).WithError(err).Warn("fail to purge todos of deleted user")
+	}
+
+	notice := mail.NewMessage(user.Email, "Your account was deleted",
+		"Your account and every todo of it were deleted.\n")
+	if err := u.Mailer.Send(ctx, notice); err != nil {
+		log.LoggerWithSpan(ctx).WithError(err).Warn("fail to send account deletion notice")
+	}
+
+	return nil
+}
+
+// FetchProfile returns the profile of the user, an empty one when the user never saved one.
+func (u *Service) FetchProfile(ctx context.Context, id string) (*entity.UserProfile, error) {
+	profileDTO, err := u.ProfileRepository.FetchByUserID(ctx, id)
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return entity.NewFactory().NewUserProfile(id), nil
+	case err != nil:
+		return nil, err
+	}
+
+	profile, err := entity.NewFactory().FromUserProfileDTO(profileDTO)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", err, ErrSystemError)
+	}
+
+	return profile, nil
+}
+
+func (u *Service) UpdateProfile(ctx context.Context, id string, update *entity.UserProfileUpdate) (*entity.UserProfile, error) {
+	profile, err := u.FetchProfile(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	profile.Apply(update, time.Now())
+	if err := profile.Valid(); err != nil {
+		return nil, fmt.Errorf("%s: %w", err, ErrInvalidRequest)
+	}
+
+	if err := u.storeProfile(ctx, profile); err != nil {
+		return nil, err
+	}
+
+	return profile, nil
+}
+
+// SetAvatar replaces the avatar of the user. Every image gets a new id, so clients caching the previous one notice.
+func (u *Service) SetAvatar(ctx context.Context, id string, image []byte) (*entity.UserProfile, error) {
+	if _, err := entity.NewValidator().ValidateAvatar(image); err != nil {
+		return nil, fmt.Errorf("%s: %w", err, ErrInvalidRequest)
+	}
+
+	profile, err := u.FetchProfile(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	avatarID, err := uuid.New()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", err, ErrSystemError)
+	}
+
+	if err := u.BlobStore.Put(ctx, entity.AvatarKey(avatarID), image); err != nil {
+		return nil, fmt.Errorf("%s: %w", err, ErrSystemError)
+	}
+
+	previousID := profile.AvatarID
+	profile.AvatarID = avatarID
+	profile.UpdatedAt = time.Now()
+	if err := u.storeProfile(ctx, profile); err != nil {
+		u.deleteAvatarImage(ctx, avatarID)
+		return nil, err
+	}
+
+	if previousID != "" {
+		u.deleteAvatarImage(ctx, previousID)
+	}
+
+	return profile, nil
+}
+
+func (u *Service) DeleteAvatar(ctx context.Context, id string) (*entity.UserProfile, error) {
+	profile, err := u.FetchProfile(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if !profile.HasAvatar() {
+		return profile, nil
+	}
+
+	previousID := profile.AvatarID
+	profile.AvatarID = ""
+	profile.UpdatedAt = time.Now()
+	if err := u.storeProfile(ctx, profile); err != nil {
+		return nil, err
+	}
+
+	u.deleteAvatarImage(ctx, previousID)
+	return profile, nil
+}
+
+// FetchAvatar returns the avatar image and its content type.
+func (u *Service) FetchAvatar(ctx context.Context, avatarID string) ([]byte, string, error) {
+	if err := entity.NewValidator().ValidateID(avatarID); err != nil {
+		return nil, "", fmt.Errorf("%s: %w", err, ErrNotFound)
+	}
+
+	image, err := u.BlobStore.Get(ctx, entity.AvatarKey(avatarID))
+	switch {
+	case errors.Is(err, blob.ErrNotFound):
+		return nil, "", fmt.Errorf("%s: %w", err, ErrNotFound)
+	case err != nil:
+		return nil, "", fmt.Errorf("%s: %w", err, ErrSystemError)
+	}
+
+	contentType, err := entity.NewValidator().ValidateAvatar(image)
+	if err != nil {
+		return nil, "", fmt.Errorf("%s: %w", err, ErrSystemError)
+	}
+
+	return image, contentType, nil
+}
+
+func (u *Service) storeProfile(ctx context.Context, profile *entity.UserProfile) error {
+	profileDTO := dto.NewFactory().NewUserProfile(profile.UserID, profile.DisplayName, profile.TimeZone, profile.Locale, profile.AvatarID, profile.Preferences, profile.UpdatedAt)
+	return u.ProfileRepository.Store(ctx, profileDTO)
+}
+
+// deleteAvatarImage is best effort, an orphaned image is only wasted space.
+func (u *Service) deleteAvatarImage(ctx context.Context, avatarID string) {
+	if err := u.BlobStore.Delete(ctx, entity.AvatarKey(avatarID)); err != nil {
+		log.LoggerWithSpan(ctx).WithError(err).Warn("fail to delete avatar image")
+	}
+}
+
+func (u *Service) sendVerification(ctx context.Context, id string, email string) error {
+	token, err := u.issueToken(ctx, id, entity.UserTokenPurposeEmailVerification, u.VerificationTokenDuration)
+	if err != nil {
+		return err
+	}
+
+	return u.mailTokenLink(ctx, email, u.VerificationURL, token,
+		"Verify your email address",
+		fmt.Sprintf("Open the link below to verify your email address. The link expires in %s.", u.VerificationTokenDuration),
+	)
+}
+
+// issueLoginTokens completes a login, or returns a challenge when the user enabled a second factor.
+func (u *Service) issueLoginTokens(ctx context.Context, id string) (*entity.AuthTokenPair, *entity.MFAChallenge, error) {
+	mfa, err := u.fetchEnabledMFA(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if mfa != nil {
+		mfaToken, err := u.AuthUsecase.GenerateMFAToken(ctx, id)
+		if err != nil {
+			return nil, nil, toUserServiceError(err)
+		}
+
+		return nil, entity.NewFactory().NewMFAChallenge(mfaToken), nil
+	}
+
+	token, err := u.AuthUsecase.GenereateToken(ctx, id)
+	if err != nil {
+		return nil, nil, toUserServiceError(err)
+	}
+
+	return token, nil, nil
+}
+
+// userOfIdentity returns the user linked to the account of the provider, linking it on first login.
+func (u *Service) userOfIdentity(ctx context.Context, provider string, identity *oidc.Identity) (*entity.User, error) {
+	identityDTO, err := u.IdentityRepository.FetchBySubject(ctx, provider, identity.Subject)
+	switch {
+	case err == nil:
+		return u.FetchByID(ctx, identityDTO.UserID)
+	case !errors.Is(err, ErrNotFound):
+		return nil, err
+	}
+
+	// accounts are matched by email, only when the provider vouches for it
+	if identity.Email == "" || !identity.EmailVerified {
+		return nil, fmt.Errorf("no verified email from %s: %w", provider, ErrUnauthorized)
+	}
+
+	var user *entity.User
+	userDTO, err := u.Repository.FetchByEmail(ctx, identity.Email)
+	switch {
+	case errors.Is(err, ErrNotFound):
+		user, err = u.signUpWithIdentity(ctx, identity.Email)
+		if err != nil {
+			return nil, err
+		}
+	case err != nil:
+		return nil, err
+	default:
+		user, err = entity.NewFactory().FromUserDTO(userDTO)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", err, ErrSystemError)
+		}
+	}
+
+	if !user.Verified() {
+		// whoever registered the address never proved to own it, linking would let them in
+		if user.HasPassword() {
+			return nil, fmt.Errorf("email registered but not verified: %w", ErrUnauthorized)
+		}
+
+		// the owner of the address, who is logging in now, could log in to a user without password with a magic link anyway
+		verifiedAt := time.Now()
+		user.VerifiedAt = &verifiedAt
+		userDTO := dto.NewFactory().NewUser(user.ID, user.Email, user.Password, user.Roles, user.VerifiedAt, user.DisabledAt, user.CreatedAt)
+		if err := u.Repository.Update(ctx, userDTO); err != nil {
+			return nil, err
+		}
+	}
+
+	linked, err := entity.NewFactory().NewIdentity(user.ID, provider, identity.Subject, identity.Email)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", err, ErrSystemError)
+	}
+
+	if err := linked.Valid(); err != nil {
+		return nil, fmt.Errorf("%s: %w", err, ErrSystemError)
+	}
+
+	linkedDTO := dto.NewFactory().NewIdentity(linked.ID, linked.UserID, linked.Provider, linked.Subject, linked.Email, linked.CreatedAt)
+	if err := u.IdentityRepository.Store(ctx, linkedDTO); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// signUpWithIdentity creates a verified user for an email address vouched for by a provider.
+// The password is random, the user can set one with a password reset.
+func (u *Service) signUpWithIdentity(ctx context.Context, email string) (*entity.User, error) {
+	password, err := crypt.NewToken()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", err, ErrSystemError)
+	}
+
+	user, err := entity.NewFactory().NewUser(email, password, u.PasswordHasher)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", err, ErrSystemError)
+	}
+
+	verifiedAt := user.CreatedAt
+	user.VerifiedAt = &verifiedAt
+	if err := user.Valid(); err != nil {
+		return nil, fmt.Errorf("%s: %w", err.Error(), ErrInvalidRequest)
+	}
+
+	userDTO := dto.NewFactory().NewUser(user.ID, user.Email, user.Password, user.Roles, user.VerifiedAt, user.DisabledAt, user.CreatedAt)
+	if err := u.Repository.Store(ctx, userDTO); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// signUpWithoutPassword creates an unverified user who logs in with magic links,
+// following the first one verifies the email address.
+func (u *Service) signUpWithoutPassword(ctx context.Context, email string) (*entity.User, error) {
+	user, err := entity.NewFactory().NewPasswordlessUser(email)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", err, ErrSystemError)
+	}
+
+	if err := user.Valid(); err != nil {
+		return nil, fmt.Errorf("%s: %w", err.Error(), ErrInvalidRequest)
+	}
+
+	userDTO := dto.NewFactory().NewUser(user.ID, user.Email, user.Password, user.Roles, user.VerifiedAt, user.DisabledAt, user.CreatedAt)
+	if err := u.Repository.Store(ctx, userDTO); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// fetchEnabledMFA returns the second factor of the user, or nil when none is enabled.
+func (u *Service) fetchEnabledMFA(ctx context.Context, id string) (*entity.UserMFA, error) {
+	mfaDTO, err := u.MFARepository.FetchByUserID(ctx, id)
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return nil, nil
+	case err != nil:
+		return nil, err
+	}
+
+	mfa, err := entity.NewFactory().FromUserMFADTO(mfaDTO)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", err, ErrSystemError)
+	}
+
+	if !mfa.Enabled {
+		return nil, nil
+	}
+
+	return mfa, nil
+}
+
+// verifySecondFactor accepts either a TOTP code, refusing codes already used, or a recovery code.
+// Failures are throttled per user like failed logins, a correct password does not clear them.
+func (u *Service) verifySecondFactor(ctx context.Context, mfa *entity.UserMFA, code string) error {
+	throttles := u.mfaThrottles(mfa.UserID)
+	if err := u.checkLoginThrottles(ctx, throttles); err != nil {
+		return err
+	}
+
+	if err := u.matchSecondFactor(ctx, mfa, code); err != nil {
+		if errors.Is(err, ErrUnauthorized) {
+			if err := u.recordLoginFailure(ctx, throttles); err != nil {
+				return err
+			}
+		}
+		return err
+	}
+
+	return u.resetLoginThrottle(ctx, throttles, mfaLoginThrottleKey(mfa.UserID))
+}
+
+// matchSecondFactor checks the code, failures wrap ErrUnauthorized.
+func (u *Service) matchSecondFactor(ctx context.Context, mfa *entity.UserMFA, code string) error {
+	if totp.IsCode(code) {
+		step, ok := mfa.VerifyCode(code, time.Now())
+		if !ok {
+			return fmt.Errorf("invalid mfa code: %w", ErrUnauthorized)
+		}
+
+		// a concurrent login may have used the same code
+		err := u.MFARepository.UseStep(ctx, mfa.UserID, step)
+		switch {
+		case errors.Is(err, ErrNotFound):
+			return fmt.Errorf("mfa code already used: %w", ErrUnauthorized)
+		case err != nil:
+			return err
+		}
+
+		return nil
+	}
+
+	if err := entity.NewValidator().ValidateToken(code); err != nil {
+		return fmt.Errorf("%s: invalid mfa code: %w", err, ErrUnauthorized)
+	}
+
+	recoveryCode, err := u.consumeToken(ctx, entity.UserTokenPurposeMFARecovery, totp.NormalizeRecoveryCode(code))
+	if err != nil {
+		return err
+	}
+
+	if recoveryCode.UserID != mfa.UserID {
+		return fmt.Errorf("recovery code owner mismatch: %w", ErrUnauthorized)
+	}
+
+	return nil
+}
+
+// issueRecoveryCodes replaces the recovery codes of the user, they are only shown once.
+func (u *Service) issueRecoveryCodes(ctx context.Context, id string) ([]string, error) {
+	if err := u.TokenRepository.InvalidateByUser(ctx, id, entity.UserTokenPurposeMFARecovery); err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		code, err := totp.NewRecoveryCode()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", err, ErrSystemError)
+		}
+
+		if err := u.storeToken(ctx, id, entity.UserTokenPurposeMFARecovery, totp.NormalizeRecoveryCode(code), recoveryCodeDuration); err != nil {
+			return nil, err
+		}
+
+		codes = append(codes, code)
+	}
+
+	return codes, nil
+}
+
+// consumeToken looks up a mailed token and marks it as used.
+// Unknown, used and expired tokens are unauthorized.
+func (u *Service) consumeToken(ctx context.Context, purpose string, token string) (*entity.UserToken, error) {
+	userToken, err := u.fetchUsableToken(ctx, purpose, token)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := u.consumeUserToken(ctx, userToken); err != nil {
+		return nil, err
+	}
+
+	return userToken, nil
+}
+
+// fetchUsableToken looks up a mailed token without using it.
+func (u *Service) fetchUsableToken(ctx context.Context, purpose string, token string) (*entity.UserToken, error) {
+	tokenDTO, err := u.TokenRepository.FetchByHash(ctx, purpose, crypt.HashToken(token))
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return nil, fmt.Errorf("unknown token: %w", ErrUnauthorized)
+	case err != nil:
+		return nil, err
+	}
+
+	userToken, err := entity.NewFactory().FromUserTokenDTO(tokenDTO)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", err, ErrSystemError)
+	}
+
+	if !userToken.Usable(time.Now()) {
+		return nil, fmt.Errorf("token is used or expired: %w", ErrUnauthorized)
+	}
+
+	return userToken, nil
+}
+
+// consumeUserToken marks a token as used, it fails when a concurrent request used it first.
+func (u *Service) consumeUserToken(ctx context.Context, userToken *entity.UserToken) error {
+	err := u.TokenRepository.Consume(ctx, userToken.ID)
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return fmt.Errorf("token is used: %w", ErrUnauthorized)
+	case err != nil:
+		return err
+	}
+
+	return nil
+}
+
+// checkNewPassword applies the password policy to a password the user chooses.
+// The breach check fails open, an unreadable breach list must not stop users from setting passwords.
+func (u *Service) checkNewPassword(ctx context.Context, plainPassword string, email string) error {
+	policy := u.PasswordPolicy
+	if policy == nil {
+		policy = entity.NewFactory().NewPasswordPolicy(entity.MinPasswordLength, 0)
+	}
+
+	reasons := policy.Check(plainPassword, email)
+
+	if u.BreachedPasswords != nil {
+		breached, err := u.BreachedPasswords.Breached(ctx, plainPassword)
+		switch {
+		case err != nil:
+			log.LoggerWithSpan(ctx).WithError(err).Warn("fail to check breached passwords")
+		case breached:
+			reasons = append(reasons, entity.PasswordReasonBreached)
+		}
+	}
+
+	if len(reasons) > 0 {
+		return &PasswordRejectedError{Reasons: reasons}
+	}
+
+	return nil
+}
+
+// issueToken stores a new single-use token for the user, invalidating earlier ones of the same purpose.
+// It returns the plain token, which is never stored.
+func (u *Service) issueToken(ctx context.Context, userID string, purpose string, duration time.Duration) (string, error) {
+	if err := u.TokenRepository.InvalidateByUser(ctx, userID, purpose); err != nil {
+		return "", err
+	}
+
+	token, err := crypt.NewToken()
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", err, ErrSystemError)
+	}
+
+	if err := u.storeToken(ctx, userID, purpose, token, duration); err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+func (u *Service) storeToken(ctx context.Context, userID string, purpose string, token string, duration time.Duration) error {
+	userToken, err := entity.NewFactory().NewUserToken(userID, purpose, token, duration)
+	if err != nil {
+		return fmt.Errorf("%s: %w", err, ErrSystemError)
+	}
+
+	if err := userToken.Valid(); err != nil {
+		return fmt.Errorf("%s: %w", err, ErrSystemError)
+	}
+
+	tokenDTO := dto.NewFactory().NewUserToken(userToken.ID, userToken.UserID, userToken.Purpose, userToken.TokenHash, userToken.Used, userToken.ExpiresAt, userToken.CreatedAt)
+	return u.TokenRepository.Store(ctx, tokenDTO)
+}
+
+func (u *Service) mailTokenLink(ctx context.Context, to string, base string, token string, subject string, text string) error {
+	link, err := u.tokenLink(base, token)
+	if err != nil {
+		return fmt.Errorf("%s: %w", err, ErrSystemError)
+	}
+
+	msg := mail.NewMessage(to, subject, fmt.Sprintf("%s\n\n%s\n", text, link))
+	if err := u.Mailer.Send(ctx, msg); err != nil {
+		return fmt.Errorf("%s: %w", err, ErrSystemError)
+	}
+
+	return nil
+}
+
+func (u *Service) tokenLink(base string, token string) (string, error) {
+	link, err := url.Parse(base)
+	if err != nil {
+		return "", err
+	}
+
+	q := link.Query()
+	q.Set("token", token)
+	link.RawQuery = q.Encode()
+
+	return link.String(), nil
+}
+
+// rehashPassword replaces an outdated password hash with one made with the current settings.
+func (u *Service) rehashPassword(ctx context.Context, user *entity.User, plainPassword string) error {
+	if err := user.SetPassword(u.PasswordHasher, plainPassword); err != nil {
+		return err
+	}
+
+	userDTO := dto.NewFactory().NewUser(user.ID, user.Email, user.Password, user.Roles, user.VerifiedAt, user.DisabledAt, user.CreatedAt)
+	return u.Repository.Update(ctx, userDTO)
+}
+
+// reauthenticate confirms a change by a logged-in user with the current password.
+// Users without a password log in again instead, with a magic link or a provider, and confirm from the new session.
+func (u *Service) reauthenticate(ctx context.Context, user *entity.User, sessionID string, plainPassword string) error {
+	if user.HasPassword() {
+		return u.verifyCurrentPassword(ctx, user, plainPassword)
+	}
+	return u.verifyFreshSession(ctx, user, sessionID)
+}
+
+// verifyFreshSession checks the session of the request was logged in moments ago,
+// personal access tokens have no session and never confirm.
+func (u *Service) verifyFreshSession(ctx context.Context, user *entity.User, sessionID string) error {
+	if sessionID == "" {
+		return fmt.Errorf("no session to confirm with: %w", ErrUnauthorized)
+	}
+
+	sessions, err := u.AuthUsecase.ListSessions(ctx, user.ID)
+	if err != nil {
+		return toUserServiceError(err)
+	}
+
+	now := time.Now()
+	for _, session := range sessions {
+		if session.ID == sessionID && session.Fresh(now) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("session not logged in recently: %w", ErrUnauthorized)
+}
+
+// verifyCurrentPassword checks the password of a logged-in user,
+// failures count against the account like failed logins.
+func (u *Service) verifyCurrentPassword(ctx context.Context, user *entity.User, plainPassword string) error {
+	throttles := u.loginThrottles(user.Email, "")
+	if err := u.checkLoginThrottles(ctx, throttles); err != nil {
+		return err
+	}
+
+	if err := user.ValidPassword(u.PasswordHasher, plainPassword); err != nil {
+		if !errors.Is(err, crypt.ErrPasswordMismatch) {
+			return fmt.Errorf("%s: %w", err, ErrSystemError)
+		}
+		if err := u.recordLoginFailure(ctx, throttles); err != nil {
+			return err
+		}
+		return fmt.Errorf("current password mismatch: %w", ErrUnauthorized)
+	}
+
+	return nil
+}
+
+// loginThrottle is a throttled key with its policy
+type loginThrottle struct {
+	key    string
+	policy *entity.LoginThrottle
+}
+
+func accountLoginThrottleKey(email string) string {
+	return "account:" + strings.ToLower(email)
+}
+
+func ipLoginThrottleKey(clientIP string) string {
+	return "ip:" + clientIP
+}
+
+func mfaLoginThrottleKey(id string) string {
+	return "mfa:" + id
+}
+
+func (u *Service) loginThrottles(email string, clientIP string) []loginThrottle {
+	throttles := []loginThrottle{}
+	if u.LoginAttemptRepository == nil {
+		return throttles
+	}
+
+	if u.AccountLoginThrottle != nil {
+		throttles = append(throttles, loginThrottle{accountLoginThrottleKey(email), u.AccountLoginThrottle})
+	}
+
+	if u.IPLoginThrottle != nil && clientIP != "" {
+		throttles = append(throttles, loginThrottle{ipLoginThrottleKey(clientIP), u.IPLoginThrottle})
+	}
+
+	return throttles
+}
+
+// mfaThrottles throttles second factors of the user with the policy of accounts, under a key of their own.
+func (u *Service) mfaThrottles(id string) []loginThrottle {
+	throttles := []loginThrottle{}
+	if u.LoginAttemptRepository == nil || u.AccountLoginThrottle == nil {
+		return throttles
+	}
+
+	return append(throttles, loginThrottle{mfaLoginThrottleKey(id), u.AccountLoginThrottle})
+}
+
+// checkLoginThrottles returns a RetryAfterError with the longest wait among the keys.
+func (u *Service) checkLoginThrottles(ctx context.Context, throttles []loginThrottle) error {
+	now := time.Now()
+
+	var wait time.Duration
+	for _, t := range throttles {
+		attemptsDTO, err := u.LoginAttemptRepository.Fetch(ctx, t.key)
+		switch {
+		case errors.Is(err, ErrNotFound):
+			continue
+		case err != nil:
+			return fmt.Errorf("%s: %w", err, ErrSystemError)
+		}
+
+		attempts, err := entity.NewFactory().FromLoginAttemptsDTO(attemptsDTO)
+		if err != nil {
+			return fmt.Errorf("%s: %w", err, ErrSystemError)
+		}
+
+		if w := t.policy.RetryAfter(attempts, now); w > wait {
+			wait = w
+		}
+	}
+
+	if wait > 0 {
+		return &RetryAfterError{RetryAfter: wait}
+	}
+
+	return nil
+}
+
+func (u *Service) recordLoginFailure(ctx context.Context, throttles []loginThrottle) error {
+	now := time.Now()
+
+	for _, t := range throttles {
+		if _, err := u.LoginAttemptRepository.RecordFailure(ctx, t.key, now, t.policy.LockoutDuration); err != nil {
+			return fmt.Errorf("%s: %w", err, ErrSystemError)
+		}
+	}
+
+	return nil
+}
+
+func (u *Service) resetLoginThrottle(ctx context.Context, throttles []loginThrottle, key string) error {
+	for _, t := range throttles {
+		if t.key != key {
+			continue
+		}
+
+		if err := u.LoginAttemptRepository.Reset(ctx, t.key); err != nil {
+			return fmt.Errorf("%s: %w", err, ErrSystemError)
+		}
+	}
+
+	return nil
+}
+
+// toOAuthError tells failures of the provider apart from rejected logins.
+func toOAuthError(err error) error {
+	switch {
+	case errors.Is(err, oidc.ErrInvalidGrant), errors.Is(err, oidc.ErrInvalidIDToken):
+		return fmt.Errorf("%s: %w", err, ErrUnauthorized)
+	default:
+		return fmt.Errorf("%s: %w", err, ErrSystemError)
+	}
 }
 
 func toUserServiceError(err error) error {
@@ -147,6 +1694,8 @@ func toUserServiceError(err error) error {
 		return fmt.Errorf("%s: %w", err, ErrUnauthorized)
 	case errors.Is(err, auth.ErrInvalidRequest):
 		return fmt.Errorf("%s: invalid request: %w", err, ErrInvalidRequest)
+	case errors.Is(err, auth.ErrNotFound):
+		return fmt.Errorf("%s: %w", err, ErrNotFound)
 	case errors.Is(err, auth.ErrSystemError):
 		return fmt.Errorf("%s: %w", err, ErrSystemError)
 	}
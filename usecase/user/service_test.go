@@ -2,35 +2,95 @@ package user
 
 import (
 	"context"
+	"crypto/sha1"
+	"encoding/hex"
 	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/org39/webapp-tutorial-backend/entity"
 	"github.com/org39/webapp-tutorial-backend/entity/dto"
+	"github.com/org39/webapp-tutorial-backend/pkg/blob"
+	"github.com/org39/webapp-tutorial-backend/pkg/breach"
 	"github.com/org39/webapp-tutorial-backend/pkg/crypt"
+	"github.com/org39/webapp-tutorial-backend/pkg/mail"
+	"github.com/org39/webapp-tutorial-backend/pkg/oidc"
+	"github.com/org39/webapp-tutorial-backend/pkg/totp"
+	"github.com/org39/webapp-tutorial-backend/usecase/auth"
 	auth_mocks "github.com/org39/webapp-tutorial-backend/usecase/auth/mocks"
+	todo_mocks "github.com/org39/webapp-tutorial-backend/usecase/todo/mocks"
 	"github.com/org39/webapp-tutorial-backend/usecase/user/mocks"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/suite"
+	"golang.org/x/crypto/bcrypt"
 )
 
+// smallest header http.DetectContentType recognizes as PNG
+var testAvatar = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
 type UserServiceTestSuite struct {
 	suite.Suite
-	Usecase     Usecase
-	AuthUsecase *auth_mocks.Usecase
-	Repository  *mocks.Repository
+	Usecase         Usecase
+	AuthUsecase     *auth_mocks.Usecase
+	TodoUsecase     *todo_mocks.Usecase
+	Repository      *mocks.Repository
+	TokenRepository *mocks.TokenRepository
+	MFARepository   *mocks.MFARepository
+	ProfileRepo     *mocks.ProfileRepository
+	IdentityRepo    *mocks.IdentityRepository
+	OAuthProvider   *mocks.OAuthProvider
+	Mailer          *mail.MemoryMailer
+	BlobStore       *blob.MemoryStore
+	PasswordHasher  *crypt.PasswordHasher
 }
 
 func (s *UserServiceTestSuite) SetupTest() {
 	s.Repository = new(mocks.Repository)
+	s.TokenRepository = new(mocks.TokenRepository)
+	s.MFARepository = new(mocks.MFARepository)
+	s.ProfileRepo = new(mocks.ProfileRepository)
+	s.IdentityRepo = new(mocks.IdentityRepository)
+	s.OAuthProvider = new(mocks.OAuthProvider)
 	s.AuthUsecase = new(auth_mocks.Usecase)
+	s.TodoUsecase = new(todo_mocks.Usecase)
+	s.Mailer = mail.NewMemoryMailer()
+	s.BlobStore = blob.NewMemoryStore()
+
+	// cheap parameters, hashing is not under test
+	hasher, err := crypt.NewPasswordHasher([]byte("PEPPER"),
+		crypt.WithArgon2Params(crypt.Argon2Params{Time: 1, Memory: 1024, Threads: 1}),
+	)
+	if err != nil {
+		assert.Fail(s.T(), fmt.Sprintf("fail to create password hasher: %s", err))
+	}
+	s.PasswordHasher = hasher
 
 	usecase, err := NewService(
 		WithRepository(s.Repository),
+		WithTokenRepository(s.TokenRepository),
+		WithMFARepository(s.MFARepository),
+		WithMFAIssuer("webapp-tutorial"),
+		WithProfileRepository(s.ProfileRepo),
+		WithBlobStore(s.BlobStore),
 		WithAuthUsecase(s.AuthUsecase),
+		WithTodoUsecase(s.TodoUsecase),
+		WithPasswordHasher(s.PasswordHasher),
+		WithMailer(s.Mailer),
+		WithOAuthProviders(s.IdentityRepo, map[string]OAuthProvider{"google": s.OAuthProvider}),
+		WithPasswordResetURL("http://localhost:3000/reset-password"),
+		WithPasswordResetTokenDuration(time.Hour),
+		WithVerificationURL("http://localhost:3000/verify"),
+		WithVerificationTokenDuration(24*time.Hour),
+		WithMagicLinkURL("http://localhost:3000/magic-link"),
+		WithMagicLinkTokenDuration(15*time.Minute),
 	)
 	if err != nil {
 		assert.Fail(s.T(), fmt.Sprintf("fail to create usecase: %s", err))
@@ -45,7 +105,7 @@ func (s *UserServiceTestSuite) TestSignUpFailWhenEmailAlreadyExist() {
 	password := "PASSWORD"
 
 	// mock repo
-	s.Repository.On("FetchByEmail", ctx, email).Return(nil, nil)
+	s.Repository.On("FetchByEmail", ctx, email).Return(dto.NewFactory().NewUser("62db52ec-5c8a-4a3c-a3c4-0b69db9a1f30", email, "hashed-password", nil, nil, nil, time.Now()), nil)
 
 	// assert
 	_, _, err := s.Usecase.SignUp(ctx, email, password)
@@ -53,6 +113,41 @@ func (s *UserServiceTestSuite) TestSignUpFailWhenEmailAlreadyExist() {
 	assert.ErrorIs(s.T(), err, ErrInvalidRequest)
 }
 
+func (s *UserServiceTestSuite) TestSignUpFailWhenPasswordlessEmailExist() {
+	ctx := context.Background()
+	uuid := "62db52ec-5c8a-4a3c-a3c4-0b69db9a1f30"
+	email := "existing@mail.com"
+	password := "STRONG-PASSWORD"
+	verifiedAt := time.Now()
+
+	cases := []struct {
+		name string
+		user *dto.User
+	}{
+		// somebody asked for a magic link to the address but never followed it
+		{"unfollowed magic link", dto.NewFactory().NewUser(uuid, email, "", nil, nil, nil, time.Now())},
+		// the owner of the address followed a magic link
+		{"logged in", dto.NewFactory().NewUser(uuid, email, "", nil, &verifiedAt, nil, time.Now())},
+		// the user logged in, then changed the address to this one
+		{"email changed", dto.NewFactory().NewUser(uuid, email, "", []string{entity.RoleAdmin}, nil, nil, time.Now().Add(-time.Hour))},
+	}
+
+	for _, c := range cases {
+		s.SetupTest()
+		s.Repository.On("FetchByEmail", ctx, email).Return(c.user, nil)
+		s.TokenRepository.On("InvalidateByUser", ctx, uuid, entity.UserTokenPurposeMagicLink).Return(nil)
+		s.TokenRepository.On("Store", ctx, mock.AnythingOfType("*dto.UserToken")).Return(nil)
+
+		// assert, the user is not taken over, the owner of the address gets a link to log in
+		_, _, err := s.Usecase.SignUp(ctx, email, password)
+		assert.ErrorIs(s.T(), err, ErrInvalidRequest, c.name)
+		s.Repository.AssertNotCalled(s.T(), "Store", mock.Anything, mock.Anything)
+		s.Repository.AssertNotCalled(s.T(), "Update", mock.Anything, mock.Anything)
+		s.AuthUsecase.AssertNotCalled(s.T(), "GenereateToken", mock.Anything, mock.Anything)
+		assert.NotEmpty(s.T(), s.tokenFromMail(email), c.name)
+	}
+}
+
 func (s *UserServiceTestSuite) TestSignUpFailWhenDatabaseError() {
 	ctx := context.Background()
 	email := "valid@mail.com"
@@ -98,6 +193,8 @@ func (s *UserServiceTestSuite) TestSignUpSuccessWhenValidRequest() {
 	dummyToken := entity.NewFactory().NewAuthTokenPair("access", "refresh")
 	s.Repository.On("FetchByEmail", ctx, email).Return(nil, ErrNotFound)
 	s.Repository.On("Store", ctx, mock.AnythingOfType("*dto.User")).Return(nil)
+	s.TokenRepository.On("InvalidateByUser", ctx, mock.AnythingOfType("string"), entity.UserTokenPurposeEmailVerification).Return(nil)
+	s.TokenRepository.On("Store", ctx, mock.AnythingOfType("*dto.UserToken")).Return(nil)
 	s.AuthUsecase.On("GenereateToken", ctx, mock.AnythingOfType("string")).Return(dummyToken, nil)
 
 	// assert
@@ -105,8 +202,32 @@ func (s *UserServiceTestSuite) TestSignUpSuccessWhenValidRequest() {
 	s.Repository.AssertExpectations(s.T())
 	assert.NoError(s.T(), err)
 	assert.Equal(s.T(), email, resp.Email)
+	assert.False(s.T(), resp.Verified())
 	assert.NotEmpty(s.T(), tokens.AccessToken)
 	assert.NotEmpty(s.T(), tokens.RefreshToken)
+
+	// assert, verification mail is sent
+	assert.NotEmpty(s.T(), s.tokenFromMail(email))
+}
+
+func (s *UserServiceTestSuite) TestSignUpSuccessWhenVerificationMailFails() {
+	ctx := context.Background()
+	email := "good-guy@mail.com"
+	password := "STRONG-PASSWORD"
+
+	// mock repo
+	dummyToken := entity.NewFactory().NewAuthTokenPair("access", "refresh")
+	s.Repository.On("FetchByEmail", ctx, email).Return(nil, ErrNotFound)
+	s.Repository.On("Store", ctx, mock.AnythingOfType("*dto.User")).Return(nil)
+	s.TokenRepository.On("InvalidateByUser", ctx, mock.AnythingOfType("string"), entity.UserTokenPurposeEmailVerification).Return(ErrDatabaseError)
+	s.AuthUsecase.On("GenereateToken", ctx, mock.AnythingOfType("string")).Return(dummyToken, nil)
+
+	// assert, user can ask for another verification mail later
+	resp, tokens, err := s.Usecase.SignUp(ctx, email, password)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), email, resp.Email)
+	assert.NotNil(s.T(), tokens)
+	assert.Empty(s.T(), s.Mailer.Messages())
 }
 
 func (s *UserServiceTestSuite) TestLoginSuccessWhenCorrectPassword() {
@@ -115,22 +236,78 @@ func (s *UserServiceTestSuite) TestLoginSuccessWhenCorrectPassword() {
 	uuid := "62db52ec-5c8a-4a3c-a3c4-0b69db9a1f30"
 	email := "good-guy@mail.com"
 	plainPassword := "STRONG-PASSWORD"
-	password, err := crypt.Hash([]byte(plainPassword))
+	password, err := s.PasswordHasher.Hash([]byte(plainPassword))
 	if err != nil {
 		assert.Fail(s.T(), fmt.Sprintf("fail to hash plainPassword: %s", err))
 	}
 
-	userDTO := dto.NewFactory().NewUser(uuid, email, password, time.Now())
+	userDTO := dto.NewFactory().NewUser(uuid, email, password, nil, nil, nil, time.Now())
 
 	dummyToken := entity.NewFactory().NewAuthTokenPair("access", "refresh")
 	s.Repository.On("FetchByEmail", ctx, email).Return(userDTO, nil)
+	s.MFARepository.On("FetchByUserID", ctx, uuid).Return(nil, ErrNotFound)
 	s.AuthUsecase.On("GenereateToken", ctx, uuid).Return(dummyToken, nil)
 
 	// assert
-	tokens, err := s.Usecase.Login(ctx, email, plainPassword)
+	tokens, challenge, err := s.Usecase.Login(ctx, email, plainPassword, "192.0.2.1")
 	assert.NoError(s.T(), err)
+	assert.Nil(s.T(), challenge)
 	assert.NotEmpty(s.T(), tokens.AccessToken)
 	assert.NotEmpty(s.T(), tokens.RefreshToken)
+
+	// assert, a current hash is kept
+	s.Repository.AssertNotCalled(s.T(), "Update", mock.Anything, mock.Anything)
+}
+
+func (s *UserServiceTestSuite) TestLoginRehashesOutdatedPassword() {
+	ctx := context.Background()
+
+	uuid := "62db52ec-5c8a-4a3c-a3c4-0b69db9a1f30"
+	email := "good-guy@mail.com"
+	plainPassword := "STRONG-PASSWORD"
+
+	// hashed before peppering, bcrypt of the password and the salt
+	legacy, err := bcrypt.GenerateFromPassword([]byte(plainPassword+"SALT"), bcrypt.MinCost)
+	if err != nil {
+		assert.Fail(s.T(), fmt.Sprintf("fail to hash plainPassword: %s", err))
+	}
+
+	hasher, err := crypt.NewPasswordHasher([]byte("PEPPER"),
+		crypt.WithArgon2Params(crypt.Argon2Params{Time: 1, Memory: 1024, Threads: 1}),
+		crypt.WithLegacySalt("SALT"),
+	)
+	if err != nil {
+		assert.Fail(s.T(), fmt.Sprintf("fail to create password hasher: %s", err))
+	}
+
+	usecase, err := NewService(
+		WithRepository(s.Repository),
+		WithMFARepository(s.MFARepository),
+		WithAuthUsecase(s.AuthUsecase),
+		WithPasswordHasher(hasher),
+	)
+	if err != nil {
+		assert.Fail(s.T(), fmt.Sprintf("fail to create usecase: %s", err))
+	}
+
+	s.Repository.On("FetchByEmail", ctx, email).Return(dto.NewFactory().NewUser(uuid, email, string(legacy), nil, nil, nil, time.Now()), nil)
+	s.MFARepository.On("FetchByUserID", ctx, uuid).Return(nil, ErrNotFound)
+	s.AuthUsecase.On("GenereateToken", ctx, uuid).Return(entity.NewFactory().NewAuthTokenPair("access", "refresh"), nil)
+
+	var updated *dto.User
+	s.Repository.On("Update", ctx, mock.AnythingOfType("*dto.User")).
+		Run(func(args mock.Arguments) { updated = args.Get(1).(*dto.User) }).
+		Return(nil)
+
+	// assert
+	tokens, _, err := usecase.Login(ctx, email, plainPassword, "192.0.2.1")
+	assert.NoError(s.T(), err)
+	assert.NotNil(s.T(), tokens)
+
+	// assert, the legacy hash is replaced by a current one
+	s.Repository.AssertExpectations(s.T())
+	assert.NoError(s.T(), hasher.Compare(updated.Password, []byte(plainPassword)))
+	assert.False(s.T(), hasher.NeedsRehash(updated.Password))
 }
 
 func (s *UserServiceTestSuite) TestLoginFailWhenWrongPassword() {
@@ -139,21 +316,22 @@ func (s *UserServiceTestSuite) TestLoginFailWhenWrongPassword() {
 	uuid := "62db52ec-5c8a-4a3c-a3c4-0b69db9a1f30"
 	email := "good-guy@mail.com"
 	plainPassword := "STRONG-PASSWORD"
-	password, err := crypt.Hash([]byte(plainPassword))
+	password, err := s.PasswordHasher.Hash([]byte(plainPassword))
 	if err != nil {
 		assert.Fail(s.T(), fmt.Sprintf("fail to hash plainPassword: %s", err))
 	}
 
-	userDTO := dto.NewFactory().NewUser(uuid, email, password, time.Now())
+	userDTO := dto.NewFactory().NewUser(uuid, email, password, nil, nil, nil, time.Now())
 
 	dummyToken := entity.NewFactory().NewAuthTokenPair("access", "refresh")
 	s.Repository.On("FetchByEmail", ctx, email).Return(userDTO, nil)
 	s.AuthUsecase.On("GenereateToken", ctx, uuid).Return(dummyToken, nil)
 
 	// assert
-	tokens, err := s.Usecase.Login(ctx, email, "WRONG-PASSWORD")
+	tokens, challenge, err := s.Usecase.Login(ctx, email, "WRONG-PASSWORD", "192.0.2.1")
 	assert.ErrorIs(s.T(), err, ErrUnauthorized)
 	assert.Nil(s.T(), tokens)
+	assert.Nil(s.T(), challenge)
 }
 
 func (s *UserServiceTestSuite) TestRefreshSuccessWithValidToken() {
@@ -170,6 +348,1752 @@ func (s *UserServiceTestSuite) TestRefreshSuccessWithValidToken() {
 	assert.NotEmpty(s.T(), tokens.RefreshToken)
 }
 
+// newThrottledUsecase returns a usecase delaying after 3 failures and locking out after 10
+func (s *UserServiceTestSuite) newThrottledUsecase(r LoginAttemptRepository) Usecase {
+	throttle := entity.NewFactory().NewLoginThrottle(3, time.Second, time.Minute, 10, 15*time.Minute)
+	usecase, err := NewService(
+		WithRepository(s.Repository),
+		WithMFARepository(s.MFARepository),
+		WithAuthUsecase(s.AuthUsecase),
+		WithPasswordHasher(s.PasswordHasher),
+		WithLoginThrottle(r, throttle, throttle),
+	)
+	if err != nil {
+		assert.Fail(s.T(), fmt.Sprintf("fail to create usecase: %s", err))
+	}
+
+	return usecase
+}
+
+func (s *UserServiceTestSuite) TestLoginFailWhenAccountLockedOut() {
+	ctx := context.Background()
+	email := "Good-Guy@mail.com"
+
+	attempts := new(mocks.LoginAttemptRepository)
+	attempts.On("Fetch", ctx, "account:good-guy@mail.com").
+		Return(dto.NewFactory().NewLoginAttempts("account:good-guy@mail.com", 10, time.Now()), nil)
+	attempts.On("Fetch", ctx, "ip:192.0.2.1").Return(nil, ErrNotFound)
+
+	// assert, the password is not even checked
+	tokens, challenge, err := s.newThrottledUsecase(attempts).Login(ctx, email, "STRONG-PASSWORD", "192.0.2.1")
+	assert.ErrorIs(s.T(), err, ErrTooManyAttempts)
+	assert.Nil(s.T(), tokens)
+	assert.Nil(s.T(), challenge)
+
+	var retry *RetryAfterError
+	assert.ErrorAs(s.T(), err, &retry)
+	assert.InDelta(s.T(), float64(15*time.Minute), float64(retry.RetryAfter), float64(time.Second))
+	s.Repository.AssertNotCalled(s.T(), "FetchByEmail", ctx, mock.Anything)
+}
+
+func (s *UserServiceTestSuite) TestLoginFailWhenAddressDelayed() {
+	ctx := context.Background()
+	email := "good-guy@mail.com"
+
+	attempts := new(mocks.LoginAttemptRepository)
+	attempts.On("Fetch", ctx, "account:good-guy@mail.com").Return(nil, ErrNotFound)
+	attempts.On("Fetch", ctx, "ip:192.0.2.1").
+		Return(dto.NewFactory().NewLoginAttempts("ip:192.0.2.1", 5, time.Now()), nil)
+
+	// assert
+	_, _, err := s.newThrottledUsecase(attempts).Login(ctx, email, "STRONG-PASSWORD", "192.0.2.1")
+	assert.ErrorIs(s.T(), err, ErrTooManyAttempts)
+
+	var retry *RetryAfterError
+	assert.ErrorAs(s.T(), err, &retry)
+	assert.InDelta(s.T(), float64(2*time.Second), float64(retry.RetryAfter), float64(time.Second))
+}
+
+func (s *UserServiceTestSuite) TestLoginRecordsFailure() {
+	ctx := context.Background()
+
+	uuid := "62db52ec-5c8a-4a3c-a3c4-0b69db9a1f30"
+	email := "good-guy@mail.com"
+	unknown := "nobody@mail.com"
+	password, err := s.PasswordHasher.Hash([]byte("STRONG-PASSWORD"))
+	if err != nil {
+		assert.Fail(s.T(), fmt.Sprintf("fail to hash plainPassword: %s", err))
+	}
+
+	s.Repository.On("FetchByEmail", ctx, email).Return(dto.NewFactory().NewUser(uuid, email, password, nil, nil, nil, time.Now()), nil)
+	s.Repository.On("FetchByEmail", ctx, unknown).Return(nil, ErrNotFound)
+
+	attempts := new(mocks.LoginAttemptRepository)
+	attempts.On("Fetch", ctx, mock.AnythingOfType("string")).Return(nil, ErrNotFound)
+	for _, key := range []string{"account:good-guy@mail.com", "account:nobody@mail.com"} {
+		attempts.On("RecordFailure", ctx, key, mock.AnythingOfType("time.Time"), 15*time.Minute).
+			Return(dto.NewFactory().NewLoginAttempts(key, 1, time.Now()), nil).
+			Once()
+	}
+	attempts.On("RecordFailure", ctx, "ip:192.0.2.1", mock.AnythingOfType("time.Time"), 15*time.Minute).
+		Return(dto.NewFactory().NewLoginAttempts("ip:192.0.2.1", 1, time.Now()), nil).
+		Twice()
+	usecase := s.newThrottledUsecase(attempts)
+
+	// assert
+	_, _, err = usecase.Login(ctx, email, "WRONG-PASSWORD", "192.0.2.1")
+	assert.ErrorIs(s.T(), err, ErrUnauthorized)
+
+	_, _, err = usecase.Login(ctx, unknown, "WRONG-PASSWORD", "192.0.2.1")
+	assert.ErrorIs(s.T(), err, ErrNotFound)
+
+	attempts.AssertExpectations(s.T())
+	attempts.AssertNotCalled(s.T(), "Reset", ctx, mock.Anything)
+}
+
+func (s *UserServiceTestSuite) TestLoginSuccessResetsAccountOnly() {
+	ctx := context.Background()
+
+	uuid := "62db52ec-5c8a-4a3c-a3c4-0b69db9a1f30"
+	email := "good-guy@mail.com"
+	password, err := s.PasswordHasher.Hash([]byte("STRONG-PASSWORD"))
+	if err != nil {
+		assert.Fail(s.T(), fmt.Sprintf("fail to hash plainPassword: %s", err))
+	}
+
+	s.Repository.On("FetchByEmail", ctx, email).Return(dto.NewFactory().NewUser(uuid, email, password, nil, nil, nil, time.Now()), nil)
+	s.MFARepository.On("FetchByUserID", ctx, uuid).Return(nil, ErrNotFound)
+	s.AuthUsecase.On("GenereateToken", ctx, uuid).Return(entity.NewFactory().NewAuthTokenPair("access", "refresh"), nil)
+
+	// a few failures, still below the delay
+	attempts := new(mocks.LoginAttemptRepository)
+	attempts.On("Fetch", ctx, "account:good-guy@mail.com").
+		Return(dto.NewFactory().NewLoginAttempts("account:good-guy@mail.com", 3, time.Now()), nil)
+	attempts.On("Fetch", ctx, "ip:192.0.2.1").
+		Return(dto.NewFactory().NewLoginAttempts("ip:192.0.2.1", 3, time.Now()), nil)
+	attempts.On("Reset", ctx, "account:good-guy@mail.com").Return(nil)
+
+	// assert
+	tokens, _, err := s.newThrottledUsecase(attempts).Login(ctx, email, "STRONG-PASSWORD", "192.0.2.1")
+	assert.NoError(s.T(), err)
+	assert.NotNil(s.T(), tokens)
+	attempts.AssertExpectations(s.T())
+	attempts.AssertNotCalled(s.T(), "Reset", ctx, "ip:192.0.2.1")
+}
+
+func (s *UserServiceTestSuite) TestLogoutSuccess() {
+	ctx := context.Background()
+	refreshToken := "VALID-TOKEN"
+
+	s.AuthUsecase.On("RevokeToken", ctx, refreshToken).Return(nil)
+
+	// assert
+	err := s.Usecase.Logout(ctx, refreshToken)
+	assert.NoError(s.T(), err)
+	s.AuthUsecase.AssertExpectations(s.T())
+}
+
+func (s *UserServiceTestSuite) TestLogoutFailWithInvalidToken() {
+	ctx := context.Background()
+	refreshToken := "INVALID-TOKEN"
+
+	s.AuthUsecase.On("RevokeToken", ctx, refreshToken).Return(auth.ErrUnauthorized)
+
+	// assert
+	err := s.Usecase.Logout(ctx, refreshToken)
+	assert.ErrorIs(s.T(), err, ErrUnauthorized)
+}
+
+func (s *UserServiceTestSuite) TestLogoutAllSuccess() {
+	ctx := context.Background()
+	id := "62db52ec-5c8a-4a3c-a3c4-0b69db9a1f30"
+
+	s.AuthUsecase.On("RevokeAllTokens", ctx, id).Return(nil)
+
+	// assert
+	err := s.Usecase.LogoutAll(ctx, id)
+	assert.NoError(s.T(), err)
+	s.AuthUsecase.AssertExpectations(s.T())
+}
+
+func (s *UserServiceTestSuite) TestRevokePersonalAccessTokenFailWhenUnknown() {
+	ctx := context.Background()
+	id := "62db52ec-5c8a-4a3c-a3c4-0b69db9a1f30"
+	tokenID := "4daaaea8-4721-4644-aaac-7958805b4530"
+
+	s.AuthUsecase.On("RevokePersonalAccessToken", ctx, id, tokenID).Return(auth.ErrNotFound)
+
+	// assert
+	err := s.Usecase.RevokePersonalAccessToken(ctx, id, tokenID)
+	assert.ErrorIs(s.T(), err, ErrNotFound)
+}
+
+func (s *UserServiceTestSuite) TestRevokeSessionFailWhenUnknown() {
+	ctx := context.Background()
+	id := "62db52ec-5c8a-4a3c-a3c4-0b69db9a1f30"
+	sessionID := "4daaaea8-4721-4644-aaac-7958805b4530"
+
+	s.AuthUsecase.On("RevokeSession", ctx, id, sessionID).Return(auth.ErrNotFound)
+
+	// assert
+	err := s.Usecase.RevokeSession(ctx, id, sessionID)
+	assert.ErrorIs(s.T(), err, ErrNotFound)
+}
+
+// tokenFromMail extracts the token of the link in the latest mail sent to the address.
+func (s *UserServiceTestSuite) tokenFromMail(to string) string {
+	msg := s.Mailer.Last(to)
+	if msg == nil {
+		assert.Fail(s.T(), fmt.Sprintf("no mail sent to %s", to))
+		return ""
+	}
+
+	link, err := url.Parse(regexp.MustCompile(`https?://\S+`).FindString(msg.Body))
+	if err != nil {
+		assert.Fail(s.T(), fmt.Sprintf("fail to parse link: %s", err))
+		return ""
+	}
+
+	return link.Query().Get("token")
+}
+
+func (s *UserServiceTestSuite) newUserToken(userID string, purpose string, token string, duration time.Duration) *dto.UserToken {
+	t, err := entity.NewFactory().NewUserToken(userID, purpose, token, duration)
+	if err != nil {
+		assert.Fail(s.T(), fmt.Sprintf("fail to create token: %s", err))
+	}
+	return dto.NewFactory().NewUserToken(t.ID, t.UserID, t.Purpose, t.TokenHash, t.Used, t.ExpiresAt, t.CreatedAt)
+}
+
+func (s *UserServiceTestSuite) TestRequestMagicLinkSuccess() {
+	ctx := context.Background()
+	uuid := "62db52ec-5c8a-4a3c-a3c4-0b69db9a1f30"
+	email := "good-guy@mail.com"
+
+	userDTO := dto.NewFactory().NewUser(uuid, email, "HASHED", nil, nil, nil, time.Now())
+	s.Repository.On("FetchByEmail", ctx, email).Return(userDTO, nil)
+	s.TokenRepository.On("InvalidateByUser", ctx, uuid, entity.UserTokenPurposeMagicLink).Return(nil)
+
+	var stored *dto.UserToken
+	s.TokenRepository.On("Store", ctx, mock.AnythingOfType("*dto.UserToken")).
+		Run(func(args mock.Arguments) { stored = args.Get(1).(*dto.UserToken) }).
+		Return(nil)
+
+	// assert
+	err := s.Usecase.RequestMagicLink(ctx, email)
+	assert.NoError(s.T(), err)
+	s.Repository.AssertNotCalled(s.T(), "Store", mock.Anything, mock.Anything)
+
+	token := s.tokenFromMail(email)
+	assert.Equal(s.T(), crypt.HashToken(token), stored.TokenHash)
+	assert.Equal(s.T(), uuid, stored.UserID)
+	assert.Equal(s.T(), entity.UserTokenPurposeMagicLink, stored.Purpose)
+	assert.True(s.T(), stored.ExpiresAt.Before(time.Now().Add(time.Hour)))
+}
+
+func (s *UserServiceTestSuite) TestRequestMagicLinkSignsUpUnknownEmail() {
+	ctx := context.Background()
+	email := "new-guy@mail.com"
+
+	s.Repository.On("FetchByEmail", ctx, email).Return(nil, ErrNotFound)
+
+	var created *dto.User
+	s.Repository.On("Store", ctx, mock.AnythingOfType("*dto.User")).
+		Run(func(args mock.Arguments) { created = args.Get(1).(*dto.User) }).
+		Return(nil)
+	s.TokenRepository.On("InvalidateByUser", ctx, mock.AnythingOfType("string"), entity.UserTokenPurposeMagicLink).Return(nil)
+
+	var stored *dto.UserToken
+	s.TokenRepository.On("Store", ctx, mock.AnythingOfType("*dto.UserToken")).
+		Run(func(args mock.Arguments) { stored = args.Get(1).(*dto.UserToken) }).
+		Return(nil)
+
+	// assert, the user has no password and is verified by following the link
+	err := s.Usecase.RequestMagicLink(ctx, email)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), email, created.Email)
+	assert.Empty(s.T(), created.Password)
+	assert.Nil(s.T(), created.VerifiedAt)
+	assert.Equal(s.T(), created.ID, stored.UserID)
+	assert.NotEmpty(s.T(), s.tokenFromMail(email))
+}
+
+func (s *UserServiceTestSuite) TestRequestMagicLinkInvalidEmail() {
+	ctx := context.Background()
+
+	// assert
+	err := s.Usecase.RequestMagicLink(ctx, "invalid-email")
+	assert.ErrorIs(s.T(), err, ErrInvalidRequest)
+	s.Repository.AssertNotCalled(s.T(), "Store", mock.Anything, mock.Anything)
+}
+
+func (s *UserServiceTestSuite) TestMagicLinkLoginSuccess() {
+	ctx := context.Background()
+	uuid := "62db52ec-5c8a-4a3c-a3c4-0b69db9a1f30"
+	email := "good-guy@mail.com"
+	token := "MAGIC-LINK-TOKEN"
+
+	tokenDTO := s.newUserToken(uuid, entity.UserTokenPurposeMagicLink, token, 15*time.Minute)
+	userDTO := dto.NewFactory().NewUser(uuid, email, "", nil, nil, nil, time.Now())
+	tokens := entity.NewFactory().NewAuthTokenPair("ACCESS-TOKEN", "REFRESH-TOKEN")
+
+	s.TokenRepository.On("FetchByHash", ctx, entity.UserTokenPurposeMagicLink, crypt.HashToken(token)).Return(tokenDTO, nil)
+	s.TokenRepository.On("Consume", ctx, tokenDTO.ID).Return(nil)
+	s.Repository.On("FetchByID", ctx, uuid).Return(userDTO, nil)
+	s.MFARepository.On("FetchByUserID", ctx, uuid).Return(nil, ErrNotFound)
+	s.AuthUsecase.On("GenereateToken", ctx, uuid).Return(tokens, nil)
+
+	var updated *dto.User
+	s.Repository.On("Update", ctx, mock.AnythingOfType("*dto.User")).
+		Run(func(args mock.Arguments) { updated = args.Get(1).(*dto.User) }).
+		Return(nil)
+
+	// assert, following the link verifies the address
+	result, challenge, err := s.Usecase.MagicLinkLogin(ctx, token)
+	assert.NoError(s.T(), err)
+	assert.Nil(s.T(), challenge)
+	assert.Equal(s.T(), tokens, result)
+	assert.NotNil(s.T(), updated.VerifiedAt)
+}
+
+func (s *UserServiceTestSuite) TestMagicLinkLoginReturnsChallengeWhenMFAEnabled() {
+	ctx := context.Background()
+	uuid := "62db52ec-5c8a-4a3c-a3c4-0b69db9a1f30"
+	email := "good-guy@mail.com"
+	token := "MAGIC-LINK-TOKEN"
+	verifiedAt := time.Now()
+
+	tokenDTO := s.newUserToken(uuid, entity.UserTokenPurposeMagicLink, token, 15*time.Minute)
+	userDTO := dto.NewFactory().NewUser(uuid, email, "HASHED", nil, &verifiedAt, nil, time.Now())
+
+	s.TokenRepository.On("FetchByHash", ctx, entity.UserTokenPurposeMagicLink, crypt.HashToken(token)).Return(tokenDTO, nil)
+	s.TokenRepository.On("Consume", ctx, tokenDTO.ID).Return(nil)
+	s.Repository.On("FetchByID", ctx, uuid).Return(userDTO, nil)
+	s.MFARepository.On("FetchByUserID", ctx, uuid).Return(s.newUserMFA(uuid, true), nil)
+	s.AuthUsecase.On("GenerateMFAToken", ctx, uuid).Return("MFA-TOKEN", nil)
+
+	// assert, the link replaces the password only
+	tokens, challenge, err := s.Usecase.MagicLinkLogin(ctx, token)
+	assert.NoError(s.T(), err)
+	assert.Nil(s.T(), tokens)
+	assert.Equal(s.T(), "MFA-TOKEN", challenge.Token)
+	s.Repository.AssertNotCalled(s.T(), "Update", mock.Anything, mock.Anything)
+}
+
+func (s *UserServiceTestSuite) TestMagicLinkLoginFailWithUsedToken() {
+	ctx := context.Background()
+	uuid := "62db52ec-5c8a-4a3c-a3c4-0b69db9a1f30"
+	token := "MAGIC-LINK-TOKEN"
+
+	tokenDTO := s.newUserToken(uuid, entity.UserTokenPurposeMagicLink, token, 15*time.Minute)
+	tokenDTO.Used = true
+	s.TokenRepository.On("FetchByHash", ctx, entity.UserTokenPurposeMagicLink, crypt.HashToken(token)).Return(tokenDTO, nil)
+
+	// assert
+	_, _, err := s.Usecase.MagicLinkLogin(ctx, token)
+	assert.ErrorIs(s.T(), err, ErrUnauthorized)
+	s.AuthUsecase.AssertNotCalled(s.T(), "GenereateToken", mock.Anything, mock.Anything)
+}
+
+func (s *UserServiceTestSuite) TestLoginFailWhenUserHasNoPassword() {
+	ctx := context.Background()
+	uuid := "62db52ec-5c8a-4a3c-a3c4-0b69db9a1f30"
+	email := "good-guy@mail.com"
+
+	userDTO := dto.NewFactory().NewUser(uuid, email, "", nil, nil, nil, time.Now())
+	s.Repository.On("FetchByEmail", ctx, email).Return(userDTO, nil)
+
+	// assert
+	_, _, err := s.Usecase.Login(ctx, email, "", "192.0.2.1")
+	assert.ErrorIs(s.T(), err, ErrUnauthorized)
+	s.AuthUsecase.AssertNotCalled(s.T(), "GenereateToken", mock.Anything, mock.Anything)
+}
+
+func (s *UserServiceTestSuite) TestRequestPasswordResetSuccess() {
+	ctx := context.Background()
+	uuid := "62db52ec-5c8a-4a3c-a3c4-0b69db9a1f30"
+	email := "good-guy@mail.com"
+
+	userDTO := dto.NewFactory().NewUser(uuid, email, "HASHED", nil, nil, nil, time.Now())
+	s.Repository.On("FetchByEmail", ctx, email).Return(userDTO, nil)
+	s.TokenRepository.On("InvalidateByUser", ctx, uuid, entity.UserTokenPurposePasswordReset).Return(nil)
+
+	var stored *dto.UserToken
+	s.TokenRepository.On("Store", ctx, mock.AnythingOfType("*dto.UserToken")).
+		Run(func(args mock.Arguments) { stored = args.Get(1).(*dto.UserToken) }).
+		Return(nil)
+
+	// assert
+	err := s.Usecase.RequestPasswordReset(ctx, email)
+	assert.NoError(s.T(), err)
+	s.TokenRepository.AssertExpectations(s.T())
+
+	token := s.tokenFromMail(email)
+	assert.NotEmpty(s.T(), token)
+	assert.Equal(s.T(), uuid, stored.UserID)
+	assert.Equal(s.T(), entity.UserTokenPurposePasswordReset, stored.Purpose)
+
+	// assert, only the hash is stored
+	assert.Equal(s.T(), crypt.HashToken(token), stored.TokenHash)
+	assert.True(s.T(), stored.ExpiresAt.After(time.Now()))
+}
+
+func (s *UserServiceTestSuite) TestRequestPasswordResetUnknownEmail() {
+	ctx := context.Background()
+	email := "nobody@mail.com"
+
+	s.Repository.On("FetchByEmail", ctx, email).Return(nil, ErrNotFound)
+
+	// assert, not reported to the caller
+	err := s.Usecase.RequestPasswordReset(ctx, email)
+	assert.NoError(s.T(), err)
+	assert.Empty(s.T(), s.Mailer.Messages())
+	s.TokenRepository.AssertNotCalled(s.T(), "Store", mock.Anything, mock.Anything)
+}
+
+func (s *UserServiceTestSuite) TestRequestPasswordResetInvalidEmail() {
+	ctx := context.Background()
+
+	// assert
+	err := s.Usecase.RequestPasswordReset(ctx, "invalid-email")
+	assert.ErrorIs(s.T(), err, ErrInvalidRequest)
+}
+
+func (s *UserServiceTestSuite) TestResetPasswordSuccess() {
+	ctx := context.Background()
+	uuid := "62db52ec-5c8a-4a3c-a3c4-0b69db9a1f30"
+	email := "good-guy@mail.com"
+	token := "RESET-TOKEN"
+	newPassword := "NEW-STRONG-PASSWORD"
+
+	tokenDTO := s.newUserToken(uuid, entity.UserTokenPurposePasswordReset, token, time.Hour)
+	userDTO := dto.NewFactory().NewUser(uuid, email, "OLD-HASH", nil, nil, nil, time.Now())
+
+	s.TokenRepository.On("FetchByHash", ctx, entity.UserTokenPurposePasswordReset, crypt.HashToken(token)).Return(tokenDTO, nil)
+	s.TokenRepository.On("Consume", ctx, tokenDTO.ID).Return(nil)
+	s.TokenRepository.On("InvalidateByUser", ctx, uuid, entity.UserTokenPurposePasswordReset).Return(nil)
+	s.Repository.On("FetchByID", ctx, uuid).Return(userDTO, nil)
+	s.AuthUsecase.On("RevokeAllTokens", ctx, uuid).Return(nil)
+
+	var updated *dto.User
+	s.Repository.On("Update", ctx, mock.AnythingOfType("*dto.User")).
+		Run(func(args mock.Arguments) { updated = args.Get(1).(*dto.User) }).
+		Return(nil)
+
+	// assert
+	err := s.Usecase.ResetPassword(ctx, token, newPassword)
+	assert.NoError(s.T(), err)
+	s.TokenRepository.AssertExpectations(s.T())
+	s.Repository.AssertExpectations(s.T())
+	s.AuthUsecase.AssertExpectations(s.T())
+
+	// assert, new password is stored
+	assert.NoError(s.T(), s.PasswordHasher.Compare(updated.Password, []byte(newPassword)))
+}
+
+func (s *UserServiceTestSuite) TestResetPasswordFailWithUnknownToken() {
+	ctx := context.Background()
+	token := "UNKNOWN-TOKEN"
+
+	s.TokenRepository.On("FetchByHash", ctx, entity.UserTokenPurposePasswordReset, crypt.HashToken(token)).Return(nil, ErrNotFound)
+
+	// assert
+	err := s.Usecase.ResetPassword(ctx, token, "NEW-STRONG-PASSWORD")
+	assert.ErrorIs(s.T(), err, ErrUnauthorized)
+	s.Repository.AssertNotCalled(s.T(), "Update", mock.Anything, mock.Anything)
+}
+
+func (s *UserServiceTestSuite) TestResetPasswordFailWithExpiredToken() {
+	ctx := context.Background()
+	uuid := "62db52ec-5c8a-4a3c-a3c4-0b69db9a1f30"
+	token := "EXPIRED-TOKEN"
+
+	tokenDTO := s.newUserToken(uuid, entity.UserTokenPurposePasswordReset, token, -time.Minute)
+	s.TokenRepository.On("FetchByHash", ctx, entity.UserTokenPurposePasswordReset, crypt.HashToken(token)).Return(tokenDTO, nil)
+
+	// assert
+	err := s.Usecase.ResetPassword(ctx, token, "NEW-STRONG-PASSWORD")
+	assert.ErrorIs(s.T(), err, ErrUnauthorized)
+	s.TokenRepository.AssertNotCalled(s.T(), "Consume", mock.Anything, mock.Anything)
+	s.Repository.AssertNotCalled(s.T(), "Update", mock.Anything, mock.Anything)
+}
+
+func (s *UserServiceTestSuite) TestResetPasswordFailWhenTokenUsedConcurrently() {
+	ctx := context.Background()
+	uuid := "62db52ec-5c8a-4a3c-a3c4-0b69db9a1f30"
+	token := "RESET-TOKEN"
+
+	tokenDTO := s.newUserToken(uuid, entity.UserTokenPurposePasswordReset, token, time.Hour)
+	s.TokenRepository.On("FetchByHash", ctx, entity.UserTokenPurposePasswordReset, crypt.HashToken(token)).Return(tokenDTO, nil)
+	s.TokenRepository.On("Consume", ctx, tokenDTO.ID).Return(ErrNotFound)
+	s.Repository.On("FetchByID", ctx, uuid).Return(dto.NewFactory().NewUser(uuid, "good-guy@mail.com", "OLD-HASH", nil, nil, nil, time.Now()), nil)
+
+	// assert
+	err := s.Usecase.ResetPassword(ctx, token, "NEW-STRONG-PASSWORD")
+	assert.ErrorIs(s.T(), err, ErrUnauthorized)
+	s.Repository.AssertNotCalled(s.T(), "Update", mock.Anything, mock.Anything)
+}
+
+func (s *UserServiceTestSuite) TestResetPasswordFailWhenTooShortPassword() {
+	ctx := context.Background()
+
+	// assert
+	err := s.Usecase.ResetPassword(ctx, "RESET-TOKEN", "PASS")
+	assert.ErrorIs(s.T(), err, ErrInvalidRequest)
+	s.TokenRepository.AssertNotCalled(s.T(), "FetchByHash", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func (s *UserServiceTestSuite) TestChangePasswordSuccess() {
+	ctx := context.Background()
+	uuid := "62db52ec-5c8a-4a3c-a3c4-0b69db9a1f30"
+	email := "good-guy@mail.com"
+	newPassword := "NEW-STRONG-PASSWORD"
+	password, err := s.PasswordHasher.Hash([]byte("STRONG-PASSWORD"))
+	if err != nil {
+		assert.Fail(s.T(), fmt.Sprintf("fail to hash plainPassword: %s", err))
+	}
+
+	s.Repository.On("FetchByID", ctx, uuid).Return(dto.NewFactory().NewUser(uuid, email, password, nil, nil, nil, time.Now()), nil)
+	s.TokenRepository.On("InvalidateByUser", ctx, uuid, entity.UserTokenPurposePasswordReset).Return(nil)
+	s.AuthUsecase.On("RevokeAllTokens", ctx, uuid).Return(nil)
+	s.AuthUsecase.On("GenereateToken", ctx, uuid).Return(entity.NewFactory().NewAuthTokenPair("access", "refresh"), nil)
+
+	var updated *dto.User
+	s.Repository.On("Update", ctx, mock.AnythingOfType("*dto.User")).
+		Run(func(args mock.Arguments) { updated = args.Get(1).(*dto.User) }).
+		Return(nil)
+
+	// assert
+	tokens, err := s.Usecase.ChangePassword(ctx, uuid, "STRONG-PASSWORD", newPassword)
+	assert.NoError(s.T(), err)
+	assert.NotEmpty(s.T(), tokens.AccessToken)
+	s.TokenRepository.AssertExpectations(s.T())
+	s.AuthUsecase.AssertExpectations(s.T())
+
+	// assert, new password is stored
+	assert.NoError(s.T(), s.PasswordHasher.Compare(updated.Password, []byte(newPassword)))
+}
+
+func (s *UserServiceTestSuite) TestChangePasswordFailWithWrongPassword() {
+	ctx := context.Background()
+	uuid := "62db52ec-5c8a-4a3c-a3c4-0b69db9a1f30"
+	email := "good-guy@mail.com"
+	password, err := s.PasswordHasher.Hash([]byte("STRONG-PASSWORD"))
+	if err != nil {
+		assert.Fail(s.T(), fmt.Sprintf("fail to hash plainPassword: %s", err))
+	}
+
+	s.Repository.On("FetchByID", ctx, uuid).Return(dto.NewFactory().NewUser(uuid, email, password, nil, nil, nil, time.Now()), nil)
+
+	attempts := new(mocks.LoginAttemptRepository)
+	attempts.On("Fetch", ctx, "account:good-guy@mail.com").Return(nil, ErrNotFound)
+	attempts.On("RecordFailure", ctx, "account:good-guy@mail.com", mock.AnythingOfType("time.Time"), 15*time.Minute).
+		Return(dto.NewFactory().NewLoginAttempts("account:good-guy@mail.com", 1, time.Now()), nil)
+
+	// assert, the failure counts against the account
+	_, err = s.newThrottledUsecase(attempts).ChangePassword(ctx, uuid, "WRONG-PASSWORD", "NEW-STRONG-PASSWORD")
+	assert.ErrorIs(s.T(), err, ErrUnauthorized)
+	attempts.AssertExpectations(s.T())
+	s.Repository.AssertNotCalled(s.T(), "Update", mock.Anything, mock.Anything)
+	s.AuthUsecase.AssertNotCalled(s.T(), "RevokeAllTokens", mock.Anything, mock.Anything)
+}
+
+func (s *UserServiceTestSuite) TestChangePasswordFailWhenTooShortPassword() {
+	ctx := context.Background()
+
+	// assert
+	_, err := s.Usecase.ChangePassword(ctx, "62db52ec-5c8a-4a3c-a3c4-0b69db9a1f30", "STRONG-PASSWORD", "PASS")
+	assert.ErrorIs(s.T(), err, ErrInvalidRequest)
+	s.Repository.AssertNotCalled(s.T(), "FetchByID", mock.Anything, mock.Anything)
+}
+
+// newPolicyUsecase returns a usecase asking for 8 characters and a score of 2, like the default configuration
+func (s *UserServiceTestSuite) newPolicyUsecase(breached breach.Checker) Usecase {
+	usecase, err := NewService(
+		WithRepository(s.Repository),
+		WithTokenRepository(s.TokenRepository),
+		WithAuthUsecase(s.AuthUsecase),
+		WithPasswordHasher(s.PasswordHasher),
+		WithPasswordPolicy(entity.NewFactory().NewPasswordPolicy(8, 2), breached),
+	)
+	if err != nil {
+		assert.Fail(s.T(), fmt.Sprintf("fail to create usecase: %s", err))
+	}
+
+	return usecase
+}
+
+// newBreachedPasswords returns a range directory listing the passwords as breached
+func (s *UserServiceTestSuite) newBreachedPasswords(passwords ...string) breach.Checker {
+	dir, err := ioutil.TempDir("", "breached")
+	if err != nil {
+		assert.Fail(s.T(), fmt.Sprintf("fail to create breached passwords: %s", err))
+	}
+	s.T().Cleanup(func() { os.RemoveAll(dir) })
+
+	for _, password := range passwords {
+		sum := sha1.Sum([]byte(password))
+		hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+		line := fmt.Sprintf("%s:42\n", hash[5:])
+		if err := ioutil.WriteFile(filepath.Join(dir, hash[:5]+".txt"), []byte(line), 0600); err != nil {
+			assert.Fail(s.T(), fmt.Sprintf("fail to write breached passwords: %s", err))
+		}
+	}
+
+	checker, err := breach.New(dir)
+	if err != nil {
+		assert.Fail(s.T(), fmt.Sprintf("fail to open breached passwords: %s", err))
+	}
+
+	return checker
+}
+
+func (s *UserServiceTestSuite) TestSignUpFailWhenPasswordRejected() {
+	ctx := context.Background()
+	email := "good-guy@mail.com"
+
+	cases := []struct {
+		password string
+		reasons  []string
+	}{
+		{password: "qwerty", reasons: []string{entity.PasswordReasonTooShort, entity.PasswordReasonTooWeak}},
+		{password: "password1", reasons: []string{entity.PasswordReasonTooWeak}},
+		{password: "good-guy-rocks", reasons: []string{entity.PasswordReasonContainsEmail}},
+		{password: "correct horse battery staple", reasons: []string{entity.PasswordReasonBreached}},
+	}
+
+	usecase := s.newPolicyUsecase(s.newBreachedPasswords("correct horse battery staple"))
+	for _, c := range cases {
+		_, _, err := usecase.SignUp(ctx, email, c.password)
+		assert.ErrorIs(s.T(), err, ErrInvalidRequest, c.password)
+
+		var rejected *PasswordRejectedError
+		if assert.ErrorAs(s.T(), err, &rejected, c.password) {
+			assert.Equal(s.T(), c.reasons, rejected.Reasons, c.password)
+		}
+	}
+
+	// assert, nothing is stored
+	s.Repository.AssertNotCalled(s.T(), "FetchByEmail", mock.Anything, mock.Anything)
+	s.Repository.AssertNotCalled(s.T(), "Store", mock.Anything, mock.Anything)
+}
+
+func (s *UserServiceTestSuite) TestResetPasswordFailWhenPasswordRejectedKeepsToken() {
+	ctx := context.Background()
+	uuid := "62db52ec-5c8a-4a3c-a3c4-0b69db9a1f30"
+	token := "RESET-TOKEN"
+
+	tokenDTO := s.newUserToken(uuid, entity.UserTokenPurposePasswordReset, token, time.Hour)
+	s.TokenRepository.On("FetchByHash", ctx, entity.UserTokenPurposePasswordReset, crypt.HashToken(token)).Return(tokenDTO, nil)
+	s.Repository.On("FetchByID", ctx, uuid).Return(dto.NewFactory().NewUser(uuid, "good-guy@mail.com", "OLD-HASH", nil, nil, nil, time.Now()), nil)
+
+	// assert, the user can try another password with the same link
+	err := s.newPolicyUsecase(nil).ResetPassword(ctx, token, "good-guy-rocks")
+	var rejected *PasswordRejectedError
+	if assert.ErrorAs(s.T(), err, &rejected) {
+		assert.Equal(s.T(), []string{entity.PasswordReasonContainsEmail}, rejected.Reasons)
+	}
+	s.TokenRepository.AssertNotCalled(s.T(), "Consume", mock.Anything, mock.Anything)
+	s.Repository.AssertNotCalled(s.T(), "Update", mock.Anything, mock.Anything)
+}
+
+func (s *UserServiceTestSuite) TestChangePasswordFailWhenPasswordBreached() {
+	ctx := context.Background()
+	uuid := "62db52ec-5c8a-4a3c-a3c4-0b69db9a1f30"
+	email := "good-guy@mail.com"
+	newPassword := "correct horse battery staple"
+	password, err := s.PasswordHasher.Hash([]byte("STRONG-PASSWORD"))
+	if err != nil {
+		assert.Fail(s.T(), fmt.Sprintf("fail to hash plainPassword: %s", err))
+	}
+
+	s.Repository.On("FetchByID", ctx, uuid).Return(dto.NewFactory().NewUser(uuid, email, password, nil, nil, nil, time.Now()), nil)
+
+	// assert
+	_, err = s.newPolicyUsecase(s.newBreachedPasswords(newPassword)).ChangePassword(ctx, uuid, "STRONG-PASSWORD", newPassword)
+	var rejected *PasswordRejectedError
+	if assert.ErrorAs(s.T(), err, &rejected) {
+		assert.Equal(s.T(), []string{entity.PasswordReasonBreached}, rejected.Reasons)
+	}
+	s.Repository.AssertNotCalled(s.T(), "Update", mock.Anything, mock.Anything)
+	s.AuthUsecase.AssertNotCalled(s.T(), "RevokeAllTokens", mock.Anything, mock.Anything)
+}
+
+func (s *UserServiceTestSuite) TestChangeEmailSuccess() {
+	ctx := context.Background()
+	uuid := "62db52ec-5c8a-4a3c-a3c4-0b69db9a1f30"
+	email := "good-guy@mail.com"
+	newEmail := "new-guy@mail.com"
+	verifiedAt := time.Now()
+	password, err := s.PasswordHasher.Hash([]byte("STRONG-PASSWORD"))
+	if err != nil {
+		assert.Fail(s.T(), fmt.Sprintf("fail to hash plainPassword: %s", err))
+	}
+
+	s.Repository.On("FetchByID", ctx, uuid).Return(dto.NewFactory().NewUser(uuid, email, password, nil, &verifiedAt, nil, time.Now()), nil)
+	s.Repository.On("FetchByEmail", ctx, newEmail).Return(nil, ErrNotFound)
+	s.TokenRepository.On("InvalidateByUser", ctx, uuid, entity.UserTokenPurposeEmailVerification).Return(nil)
+	s.TokenRepository.On("InvalidateByUser", ctx, uuid, entity.UserTokenPurposePasswordReset).Return(nil)
+	s.TokenRepository.On("InvalidateByUser", ctx, uuid, entity.UserTokenPurposeMagicLink).Return(nil)
+	s.TokenRepository.On("Store", ctx, mock.AnythingOfType("*dto.UserToken")).Return(nil)
+
+	var updated *dto.User
+	s.Repository.On("Update", ctx, mock.AnythingOfType("*dto.User")).
+		Run(func(args mock.Arguments) { updated = args.Get(1).(*dto.User) }).
+		Return(nil)
+
+	// assert
+	user, err := s.Usecase.ChangeEmail(ctx, uuid, "", "STRONG-PASSWORD", newEmail)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), newEmail, user.Email)
+	assert.False(s.T(), user.Verified())
+	s.TokenRepository.AssertExpectations(s.T())
+
+	// assert, the new address must be verified again
+	assert.Equal(s.T(), newEmail, updated.Email)
+	assert.Nil(s.T(), updated.VerifiedAt)
+	assert.NotEmpty(s.T(), s.tokenFromMail(newEmail))
+
+	// assert, the previous address is notified
+	assert.NotNil(s.T(), s.Mailer.Last(email))
+}
+
+func (s *UserServiceTestSuite) TestChangeEmailFailWhenEmailAlreadyExist() {
+	ctx := context.Background()
+	uuid := "62db52ec-5c8a-4a3c-a3c4-0b69db9a1f30"
+	email := "good-guy@mail.com"
+	newEmail := "taken@mail.com"
+	password, err := s.PasswordHasher.Hash([]byte("STRONG-PASSWORD"))
+	if err != nil {
+		assert.Fail(s.T(), fmt.Sprintf("fail to hash plainPassword: %s", err))
+	}
+
+	s.Repository.On("FetchByID", ctx, uuid).Return(dto.NewFactory().NewUser(uuid, email, password, nil, nil, nil, time.Now()), nil)
+	s.Repository.On("FetchByEmail", ctx, newEmail).
+		Return(dto.NewFactory().NewUser("5d9e6b0a-2f6e-4c1b-9a55-3e4c6f0d7a21", newEmail, "HASHED", nil, nil, nil, time.Now()), nil)
+
+	// assert
+	_, err = s.Usecase.ChangeEmail(ctx, uuid, "", "STRONG-PASSWORD", newEmail)
+	assert.ErrorIs(s.T(), err, ErrInvalidRequest)
+	s.Repository.AssertNotCalled(s.T(), "Update", mock.Anything, mock.Anything)
+	assert.Empty(s.T(), s.Mailer.Messages())
+}
+
+func (s *UserServiceTestSuite) TestChangeEmailFailWithWrongPassword() {
+	ctx := context.Background()
+	uuid := "62db52ec-5c8a-4a3c-a3c4-0b69db9a1f30"
+	password, err := s.PasswordHasher.Hash([]byte("STRONG-PASSWORD"))
+	if err != nil {
+		assert.Fail(s.T(), fmt.Sprintf("fail to hash plainPassword: %s", err))
+	}
+
+	s.Repository.On("FetchByID", ctx, uuid).Return(dto.NewFactory().NewUser(uuid, "good-guy@mail.com", password, nil, nil, nil, time.Now()), nil)
+
+	// assert, the address is not looked up
+	_, err = s.Usecase.ChangeEmail(ctx, uuid, "", "WRONG-PASSWORD", "new-guy@mail.com")
+	assert.ErrorIs(s.T(), err, ErrUnauthorized)
+	s.Repository.AssertNotCalled(s.T(), "FetchByEmail", mock.Anything, mock.Anything)
+}
+
+func (s *UserServiceTestSuite) TestChangeEmailWithoutPasswordSuccessAfterFreshLogin() {
+	ctx := context.Background()
+	uuid := "62db52ec-5c8a-4a3c-a3c4-0b69db9a1f30"
+	email := "good-guy@mail.com"
+	newEmail := "new-guy@mail.com"
+	sessionID := "4daaaea8-4721-4644-aaac-7958805b4530"
+	verifiedAt := time.Now()
+
+	session, err := entity.NewFactory().NewSession(uuid, sessionID, "Unknown device", "", "", time.Now().Add(time.Hour))
+	if err != nil {
+		assert.Fail(s.T(), fmt.Sprintf("fail to create session: %s", err))
+	}
+
+	s.Repository.On("FetchByID", ctx, uuid).Return(dto.NewFactory().NewUser(uuid, email, "", nil, &verifiedAt, nil, time.Now()), nil)
+	s.AuthUsecase.On("ListSessions", ctx, uuid).Return([]*entity.Session{session}, nil)
+	s.Repository.On("FetchByEmail", ctx, newEmail).Return(nil, ErrNotFound)
+	s.Repository.On("Update", ctx, mock.AnythingOfType("*dto.User")).Return(nil)
+	s.TokenRepository.On("InvalidateByUser", ctx, uuid, mock.AnythingOfType("string")).Return(nil)
+	s.TokenRepository.On("Store", ctx, mock.AnythingOfType("*dto.UserToken")).Return(nil)
+
+	// assert, the user just logged in with a magic link and has no password to give
+	user, err := s.Usecase.ChangeEmail(ctx, uuid, sessionID, "", newEmail)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), newEmail, user.Email)
+}
+
+func (s *UserServiceTestSuite) TestChangeEmailWithoutPasswordFailWhenLoginNotRecent() {
+	ctx := context.Background()
+	uuid := "62db52ec-5c8a-4a3c-a3c4-0b69db9a1f30"
+	sessionID := "4daaaea8-4721-4644-aaac-7958805b4530"
+	verifiedAt := time.Now()
+
+	session, err := entity.NewFactory().NewSession(uuid, sessionID, "Unknown device", "", "", time.Now().Add(time.Hour))
+	if err != nil {
+		assert.Fail(s.T(), fmt.Sprintf("fail to create session: %s", err))
+	}
+	session.CreatedAt = time.Now().Add(-time.Hour)
+
+	s.Repository.On("FetchByID", ctx, uuid).Return(dto.NewFactory().NewUser(uuid, "good-guy@mail.com", "", nil, &verifiedAt, nil, time.Now()), nil)
+	s.AuthUsecase.On("ListSessions", ctx, uuid).Return([]*entity.Session{session}, nil)
+
+	// assert, the address is not looked up
+	_, err = s.Usecase.ChangeEmail(ctx, uuid, sessionID, "", "new-guy@mail.com")
+	assert.ErrorIs(s.T(), err, ErrUnauthorized)
+	s.Repository.AssertNotCalled(s.T(), "FetchByEmail", mock.Anything, mock.Anything)
+}
+
+func (s *UserServiceTestSuite) TestChangeEmailFailWhenInvalidEmail() {
+	ctx := context.Background()
+
+	// assert
+	_, err := s.Usecase.ChangeEmail(ctx, "62db52ec-5c8a-4a3c-a3c4-0b69db9a1f30", "", "STRONG-PASSWORD", "not-an-email")
+	assert.ErrorIs(s.T(), err, ErrInvalidRequest)
+	s.Repository.AssertNotCalled(s.T(), "FetchByID", mock.Anything, mock.Anything)
+}
+
+func (s *UserServiceTestSuite) TestVerifyEmailSuccess() {
+	ctx := context.Background()
+	uuid := "62db52ec-5c8a-4a3c-a3c4-0b69db9a1f30"
+	email := "good-guy@mail.com"
+	token := "VERIFICATION-TOKEN"
+
+	tokenDTO := s.newUserToken(uuid, entity.UserTokenPurposeEmailVerification, token, time.Hour)
+	userDTO := dto.NewFactory().NewUser(uuid, email, "HASHED", nil, nil, nil, time.Now())
+
+	s.TokenRepository.On("FetchByHash", ctx, entity.UserTokenPurposeEmailVerification, crypt.HashToken(token)).Return(tokenDTO, nil)
+	s.TokenRepository.On("Consume", ctx, tokenDTO.ID).Return(nil)
+	s.Repository.On("FetchByID", ctx, uuid).Return(userDTO, nil)
+
+	var updated *dto.User
+	s.Repository.On("Update", ctx, mock.AnythingOfType("*dto.User")).
+		Run(func(args mock.Arguments) { updated = args.Get(1).(*dto.User) }).
+		Return(nil)
+
+	// assert
+	err := s.Usecase.VerifyEmail(ctx, token)
+	assert.NoError(s.T(), err)
+	s.Repository.AssertExpectations(s.T())
+	assert.NotNil(s.T(), updated.VerifiedAt)
+}
+
+func (s *UserServiceTestSuite) TestVerifyEmailFailWithPasswordResetToken() {
+	ctx := context.Background()
+	token := "RESET-TOKEN"
+
+	// tokens are looked up with their purpose, a reset token is unknown here
+	s.TokenRepository.On("FetchByHash", ctx, entity.UserTokenPurposeEmailVerification, crypt.HashToken(token)).Return(nil, ErrNotFound)
+
+	// assert
+	err := s.Usecase.VerifyEmail(ctx, token)
+	assert.ErrorIs(s.T(), err, ErrUnauthorized)
+	s.Repository.AssertNotCalled(s.T(), "Update", mock.Anything, mock.Anything)
+}
+
+func (s *UserServiceTestSuite) TestResendVerificationSuccess() {
+	ctx := context.Background()
+	uuid := "62db52ec-5c8a-4a3c-a3c4-0b69db9a1f30"
+	email := "good-guy@mail.com"
+
+	userDTO := dto.NewFactory().NewUser(uuid, email, "HASHED", nil, nil, nil, time.Now())
+	s.Repository.On("FetchByID", ctx, uuid).Return(userDTO, nil)
+	s.TokenRepository.On("InvalidateByUser", ctx, uuid, entity.UserTokenPurposeEmailVerification).Return(nil)
+	s.TokenRepository.On("Store", ctx, mock.AnythingOfType("*dto.UserToken")).Return(nil)
+
+	// assert
+	err := s.Usecase.ResendVerification(ctx, uuid)
+	assert.NoError(s.T(), err)
+	s.TokenRepository.AssertExpectations(s.T())
+	assert.NotEmpty(s.T(), s.tokenFromMail(email))
+}
+
+func (s *UserServiceTestSuite) TestResendVerificationFailWhenAlreadyVerified() {
+	ctx := context.Background()
+	uuid := "62db52ec-5c8a-4a3c-a3c4-0b69db9a1f30"
+	verifiedAt := time.Now()
+
+	userDTO := dto.NewFactory().NewUser(uuid, "good-guy@mail.com", "HASHED", nil, &verifiedAt, nil, time.Now())
+	s.Repository.On("FetchByID", ctx, uuid).Return(userDTO, nil)
+
+	// assert
+	err := s.Usecase.ResendVerification(ctx, uuid)
+	assert.ErrorIs(s.T(), err, ErrInvalidRequest)
+	assert.Empty(s.T(), s.Mailer.Messages())
+}
+
+func (s *UserServiceTestSuite) newUserMFA(userID string, enabled bool) *dto.UserMFA {
+	m, err := entity.NewFactory().NewUserMFA(userID)
+	if err != nil {
+		assert.Fail(s.T(), fmt.Sprintf("fail to create mfa: %s", err))
+	}
+	return dto.NewFactory().NewUserMFA(m.UserID, m.Secret, enabled, m.LastUsedStep, m.CreatedAt)
+}
+
+func (s *UserServiceTestSuite) TestLoginReturnsChallengeWhenMFAEnabled() {
+	ctx := context.Background()
+
+	uuid := "62db52ec-5c8a-4a3c-a3c4-0b69db9a1f30"
+	email := "good-guy@mail.com"
+	plainPassword := "STRONG-PASSWORD"
+	password, err := s.PasswordHasher.Hash([]byte(plainPassword))
+	if err != nil {
+		assert.Fail(s.T(), fmt.Sprintf("fail to hash plainPassword: %s", err))
+	}
+
+	userDTO := dto.NewFactory().NewUser(uuid, email, password, nil, nil, nil, time.Now())
+	s.Repository.On("FetchByEmail", ctx, email).Return(userDTO, nil)
+	s.MFARepository.On("FetchByUserID", ctx, uuid).Return(s.newUserMFA(uuid, true), nil)
+	s.AuthUsecase.On("GenerateMFAToken", ctx, uuid).Return("MFA-TOKEN", nil)
+
+	// assert, no token before the second factor
+	tokens, challenge, err := s.Usecase.Login(ctx, email, plainPassword, "192.0.2.1")
+	assert.NoError(s.T(), err)
+	assert.Nil(s.T(), tokens)
+	assert.Equal(s.T(), "MFA-TOKEN", challenge.Token)
+	s.AuthUsecase.AssertNotCalled(s.T(), "GenereateToken", mock.Anything, mock.Anything)
+}
+
+func (s *UserServiceTestSuite) TestLoginMFASuccessWithCode() {
+	ctx := context.Background()
+	uuid := "62db52ec-5c8a-4a3c-a3c4-0b69db9a1f30"
+
+	mfaDTO := s.newUserMFA(uuid, true)
+	code, err := totp.Code(mfaDTO.Secret, time.Now())
+	assert.NoError(s.T(), err)
+
+	dummyToken := entity.NewFactory().NewAuthTokenPair("access", "refresh")
+	s.AuthUsecase.On("VerifyMFAToken", ctx, "MFA-TOKEN").Return(uuid, nil)
+	s.MFARepository.On("FetchByUserID", ctx, uuid).Return(mfaDTO, nil)
+	s.MFARepository.On("UseStep", ctx, uuid, mock.AnythingOfType("int64")).Return(nil)
+	s.AuthUsecase.On("GenereateToken", ctx, uuid).Return(dummyToken, nil)
+
+	// assert
+	tokens, err := s.Usecase.LoginMFA(ctx, "MFA-TOKEN", code)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), dummyToken, tokens)
+	s.MFARepository.AssertExpectations(s.T())
+}
+
+func (s *UserServiceTestSuite) TestLoginMFAFailWithReplayedCode() {
+	ctx := context.Background()
+	uuid := "62db52ec-5c8a-4a3c-a3c4-0b69db9a1f30"
+
+	mfaDTO := s.newUserMFA(uuid, true)
+	code, err := totp.Code(mfaDTO.Secret, time.Now())
+	assert.NoError(s.T(), err)
+
+	// a concurrent login used the code first
+	s.AuthUsecase.On("VerifyMFAToken", ctx, "MFA-TOKEN").Return(uuid, nil)
+	s.MFARepository.On("FetchByUserID", ctx, uuid).Return(mfaDTO, nil)
+	s.MFARepository.On("UseStep", ctx, uuid, mock.AnythingOfType("int64")).Return(ErrNotFound)
+
+	// assert
+	tokens, err := s.Usecase.LoginMFA(ctx, "MFA-TOKEN", code)
+	assert.ErrorIs(s.T(), err, ErrUnauthorized)
+	assert.Nil(s.T(), tokens)
+	s.AuthUsecase.AssertNotCalled(s.T(), "GenereateToken", mock.Anything, mock.Anything)
+}
+
+func (s *UserServiceTestSuite) TestLoginMFAFailWithWrongCode() {
+	ctx := context.Background()
+	uuid := "62db52ec-5c8a-4a3c-a3c4-0b69db9a1f30"
+
+	mfaDTO := s.newUserMFA(uuid, true)
+	code, err := totp.Code(mfaDTO.Secret, time.Now().Add(-time.Hour))
+	assert.NoError(s.T(), err)
+
+	s.AuthUsecase.On("VerifyMFAToken", ctx, "MFA-TOKEN").Return(uuid, nil)
+	s.MFARepository.On("FetchByUserID", ctx, uuid).Return(mfaDTO, nil)
+
+	// assert
+	tokens, err := s.Usecase.LoginMFA(ctx, "MFA-TOKEN", code)
+	assert.ErrorIs(s.T(), err, ErrUnauthorized)
+	assert.Nil(s.T(), tokens)
+	s.MFARepository.AssertNotCalled(s.T(), "UseStep", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func (s *UserServiceTestSuite) TestLoginMFAFailWhenLockedOut() {
+	ctx := context.Background()
+	uuid := "62db52ec-5c8a-4a3c-a3c4-0b69db9a1f30"
+	email := "good-guy@mail.com"
+	password, err := s.PasswordHasher.Hash([]byte("STRONG-PASSWORD"))
+	if err != nil {
+		assert.Fail(s.T(), fmt.Sprintf("fail to hash plainPassword: %s", err))
+	}
+
+	mfaDTO := s.newUserMFA(uuid, true)
+	code, err := totp.Code(mfaDTO.Secret, time.Now())
+	assert.NoError(s.T(), err)
+
+	s.Repository.On("FetchByEmail", ctx, email).Return(dto.NewFactory().NewUser(uuid, email, password, nil, nil, nil, time.Now()), nil)
+	s.MFARepository.On("FetchByUserID", ctx, uuid).Return(mfaDTO, nil)
+	s.AuthUsecase.On("GenerateMFAToken", ctx, uuid).Return("MFA-TOKEN", nil)
+	s.AuthUsecase.On("VerifyMFAToken", ctx, "MFA-TOKEN").Return(uuid, nil)
+
+	// wrong codes guessed after earlier correct passwords
+	attempts := new(mocks.LoginAttemptRepository)
+	attempts.On("Fetch", ctx, "account:good-guy@mail.com").Return(nil, ErrNotFound)
+	attempts.On("Fetch", ctx, "ip:192.0.2.1").Return(nil, ErrNotFound)
+	attempts.On("Fetch", ctx, "mfa:"+uuid).
+		Return(dto.NewFactory().NewLoginAttempts("mfa:"+uuid, 10, time.Now()), nil)
+	attempts.On("Reset", ctx, "account:good-guy@mail.com").Return(nil)
+	usecase := s.newThrottledUsecase(attempts)
+
+	// assert, a correct password does not clear the failures of the second factor
+	_, challenge, err := usecase.Login(ctx, email, "STRONG-PASSWORD", "192.0.2.1")
+	assert.NoError(s.T(), err)
+	attempts.AssertNotCalled(s.T(), "Reset", ctx, "mfa:"+uuid)
+
+	// assert, even the right code is refused
+	tokens, err := usecase.LoginMFA(ctx, challenge.Token, code)
+	assert.ErrorIs(s.T(), err, ErrTooManyAttempts)
+	assert.Nil(s.T(), tokens)
+
+	var retry *RetryAfterError
+	assert.ErrorAs(s.T(), err, &retry)
+	s.MFARepository.AssertNotCalled(s.T(), "UseStep", mock.Anything, mock.Anything, mock.Anything)
+	s.AuthUsecase.AssertNotCalled(s.T(), "GenereateToken", mock.Anything, mock.Anything)
+}
+
+func (s *UserServiceTestSuite) TestLoginMFARecordsFailure() {
+	ctx := context.Background()
+	uuid := "62db52ec-5c8a-4a3c-a3c4-0b69db9a1f30"
+
+	mfaDTO := s.newUserMFA(uuid, true)
+	wrong, err := totp.Code(mfaDTO.Secret, time.Now().Add(-time.Hour))
+	assert.NoError(s.T(), err)
+	right, err := totp.Code(mfaDTO.Secret, time.Now())
+	assert.NoError(s.T(), err)
+
+	s.AuthUsecase.On("VerifyMFAToken", ctx, "MFA-TOKEN").Return(uuid, nil)
+	s.MFARepository.On("FetchByUserID", ctx, uuid).Return(mfaDTO, nil)
+	s.MFARepository.On("UseStep", ctx, uuid, mock.AnythingOfType("int64")).Return(nil)
+	s.AuthUsecase.On("GenereateToken", ctx, uuid).Return(entity.NewFactory().NewAuthTokenPair("access", "refresh"), nil)
+
+	attempts := new(mocks.LoginAttemptRepository)
+	attempts.On("Fetch", ctx, "mfa:"+uuid).Return(nil, ErrNotFound)
+	attempts.On("RecordFailure", ctx, "mfa:"+uuid, mock.AnythingOfType("time.Time"), 15*time.Minute).
+		Return(dto.NewFactory().NewLoginAttempts("mfa:"+uuid, 1, time.Now()), nil).
+		Once()
+	attempts.On("Reset", ctx, "mfa:"+uuid).Return(nil).Once()
+	usecase := s.newThrottledUsecase(attempts)
+
+	// assert, a wrong code counts
+	_, err = usecase.LoginMFA(ctx, "MFA-TOKEN", wrong)
+	assert.ErrorIs(s.T(), err, ErrUnauthorized)
+
+	// assert, the right code clears the failures
+	tokens, err := usecase.LoginMFA(ctx, "MFA-TOKEN", right)
+	assert.NoError(s.T(), err)
+	assert.NotNil(s.T(), tokens)
+	attempts.AssertExpectations(s.T())
+}
+
+func (s *UserServiceTestSuite) TestLoginMFAFailWithInvalidMFAToken() {
+	ctx := context.Background()
+
+	s.AuthUsecase.On("VerifyMFAToken", ctx, "ACCESS-TOKEN").Return("", auth.ErrUnauthorized)
+
+	// assert
+	tokens, err := s.Usecase.LoginMFA(ctx, "ACCESS-TOKEN", "123456")
+	assert.ErrorIs(s.T(), err, ErrUnauthorized)
+	assert.Nil(s.T(), tokens)
+}
+
+func (s *UserServiceTestSuite) TestLoginMFASuccessWithRecoveryCode() {
+	ctx := context.Background()
+	uuid := "62db52ec-5c8a-4a3c-a3c4-0b69db9a1f30"
+	recoveryCode := "ABCDE-FGHIJ"
+
+	mfaDTO := s.newUserMFA(uuid, true)
+	tokenDTO := s.newUserToken(uuid, entity.UserTokenPurposeMFARecovery, "abcdefghij", time.Hour)
+
+	dummyToken := entity.NewFactory().NewAuthTokenPair("access", "refresh")
+	s.AuthUsecase.On("VerifyMFAToken", ctx, "MFA-TOKEN").Return(uuid, nil)
+	s.MFARepository.On("FetchByUserID", ctx, uuid).Return(mfaDTO, nil)
+	s.TokenRepository.On("FetchByHash", ctx, entity.UserTokenPurposeMFARecovery, crypt.HashToken("abcdefghij")).Return(tokenDTO, nil)
+	s.TokenRepository.On("Consume", ctx, tokenDTO.ID).Return(nil)
+	s.AuthUsecase.On("GenereateToken", ctx, uuid).Return(dummyToken, nil)
+
+	// assert, typed code is normalized
+	tokens, err := s.Usecase.LoginMFA(ctx, "MFA-TOKEN", recoveryCode)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), dummyToken, tokens)
+	s.TokenRepository.AssertExpectations(s.T())
+}
+
+func (s *UserServiceTestSuite) TestLoginMFAFailWithRecoveryCodeOfAnotherUser() {
+	ctx := context.Background()
+	uuid := "62db52ec-5c8a-4a3c-a3c4-0b69db9a1f30"
+	another := "2192fc7b-bd9b-446d-a50e-5ce0ba02cee6"
+
+	mfaDTO := s.newUserMFA(uuid, true)
+	tokenDTO := s.newUserToken(another, entity.UserTokenPurposeMFARecovery, "abcdefghij", time.Hour)
+
+	s.AuthUsecase.On("VerifyMFAToken", ctx, "MFA-TOKEN").Return(uuid, nil)
+	s.MFARepository.On("FetchByUserID", ctx, uuid).Return(mfaDTO, nil)
+	s.TokenRepository.On("FetchByHash", ctx, entity.UserTokenPurposeMFARecovery, crypt.HashToken("abcdefghij")).Return(tokenDTO, nil)
+	s.TokenRepository.On("Consume", ctx, tokenDTO.ID).Return(nil)
+
+	// assert
+	tokens, err := s.Usecase.LoginMFA(ctx, "MFA-TOKEN", "abcde-fghij")
+	assert.ErrorIs(s.T(), err, ErrUnauthorized)
+	assert.Nil(s.T(), tokens)
+}
+
+func (s *UserServiceTestSuite) TestEnrollMFASuccess() {
+	ctx := context.Background()
+	uuid := "62db52ec-5c8a-4a3c-a3c4-0b69db9a1f30"
+	email := "good-guy@mail.com"
+
+	userDTO := dto.NewFactory().NewUser(uuid, email, "HASHED", nil, nil, nil, time.Now())
+	s.Repository.On("FetchByID", ctx, uuid).Return(userDTO, nil)
+	s.MFARepository.On("FetchByUserID", ctx, uuid).Return(nil, ErrNotFound)
+
+	var stored *dto.UserMFA
+	s.MFARepository.On("Store", ctx, mock.AnythingOfType("*dto.UserMFA")).
+		Run(func(args mock.Arguments) { stored = args.Get(1).(*dto.UserMFA) }).
+		Return(nil)
+
+	// assert
+	enrollment, err := s.Usecase.EnrollMFA(ctx, uuid)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), stored.Secret, enrollment.Secret)
+	assert.False(s.T(), stored.Enabled)
+	assert.Contains(s.T(), enrollment.URI, "otpauth://totp/webapp-tutorial:good-guy@mail.com")
+	assert.Contains(s.T(), enrollment.URI, stored.Secret)
+}
+
+func (s *UserServiceTestSuite) TestEnrollMFAFailWhenAlreadyEnabled() {
+	ctx := context.Background()
+	uuid := "62db52ec-5c8a-4a3c-a3c4-0b69db9a1f30"
+
+	userDTO := dto.NewFactory().NewUser(uuid, "good-guy@mail.com", "HASHED", nil, nil, nil, time.Now())
+	s.Repository.On("FetchByID", ctx, uuid).Return(userDTO, nil)
+	s.MFARepository.On("FetchByUserID", ctx, uuid).Return(s.newUserMFA(uuid, true), nil)
+
+	// assert, an enabled secret is never replaced
+	enrollment, err := s.Usecase.EnrollMFA(ctx, uuid)
+	assert.ErrorIs(s.T(), err, ErrInvalidRequest)
+	assert.Nil(s.T(), enrollment)
+	s.MFARepository.AssertNotCalled(s.T(), "Store", mock.Anything, mock.Anything)
+}
+
+func (s *UserServiceTestSuite) TestConfirmMFASuccess() {
+	ctx := context.Background()
+	uuid := "62db52ec-5c8a-4a3c-a3c4-0b69db9a1f30"
+
+	mfaDTO := s.newUserMFA(uuid, false)
+	code, err := totp.Code(mfaDTO.Secret, time.Now())
+	assert.NoError(s.T(), err)
+
+	s.MFARepository.On("FetchByUserID", ctx, uuid).Return(mfaDTO, nil)
+	s.MFARepository.On("Enable", ctx, uuid, mock.AnythingOfType("int64")).Return(nil)
+	s.TokenRepository.On("InvalidateByUser", ctx, uuid, entity.UserTokenPurposeMFARecovery).Return(nil)
+
+	stored := []*dto.UserToken{}
+	s.TokenRepository.On("Store", ctx, mock.AnythingOfType("*dto.UserToken")).
+		Run(func(args mock.Arguments) { stored = append(stored, args.Get(1).(*dto.UserToken)) }).
+		Return(nil)
+
+	// assert
+	codes, err := s.Usecase.ConfirmMFA(ctx, uuid, code)
+	assert.NoError(s.T(), err)
+	assert.Len(s.T(), codes, recoveryCodeCount)
+	assert.Len(s.T(), stored, recoveryCodeCount)
+	for i, c := range codes {
+		assert.Equal(s.T(), crypt.HashToken(totp.NormalizeRecoveryCode(c)), stored[i].TokenHash)
+		assert.Equal(s.T(), entity.UserTokenPurposeMFARecovery, stored[i].Purpose)
+	}
+}
+
+func (s *UserServiceTestSuite) TestConfirmMFAFailWithWrongCode() {
+	ctx := context.Background()
+	uuid := "62db52ec-5c8a-4a3c-a3c4-0b69db9a1f30"
+
+	s.MFARepository.On("FetchByUserID", ctx, uuid).Return(s.newUserMFA(uuid, false), nil)
+
+	// assert
+	codes, err := s.Usecase.ConfirmMFA(ctx, uuid, "000000")
+	assert.Error(s.T(), err)
+	assert.Nil(s.T(), codes)
+	s.MFARepository.AssertNotCalled(s.T(), "Enable", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func (s *UserServiceTestSuite) TestConfirmMFAFailWhenNotEnrolled() {
+	ctx := context.Background()
+	uuid := "62db52ec-5c8a-4a3c-a3c4-0b69db9a1f30"
+
+	s.MFARepository.On("FetchByUserID", ctx, uuid).Return(nil, ErrNotFound)
+
+	// assert
+	codes, err := s.Usecase.ConfirmMFA(ctx, uuid, "123456")
+	assert.ErrorIs(s.T(), err, ErrInvalidRequest)
+	assert.Nil(s.T(), codes)
+}
+
+func (s *UserServiceTestSuite) TestDisableMFASuccess() {
+	ctx := context.Background()
+	uuid := "62db52ec-5c8a-4a3c-a3c4-0b69db9a1f30"
+
+	mfaDTO := s.newUserMFA(uuid, true)
+	code, err := totp.Code(mfaDTO.Secret, time.Now())
+	assert.NoError(s.T(), err)
+
+	s.MFARepository.On("FetchByUserID", ctx, uuid).Return(mfaDTO, nil)
+	s.MFARepository.On("UseStep", ctx, uuid, mock.AnythingOfType("int64")).Return(nil)
+	s.MFARepository.On("Delete", ctx, uuid).Return(nil)
+	s.TokenRepository.On("InvalidateByUser", ctx, uuid, entity.UserTokenPurposeMFARecovery).Return(nil)
+
+	// assert
+	err = s.Usecase.DisableMFA(ctx, uuid, code)
+	assert.NoError(s.T(), err)
+	s.MFARepository.AssertExpectations(s.T())
+	s.TokenRepository.AssertExpectations(s.T())
+}
+
+func (s *UserServiceTestSuite) TestStartOAuthLoginSuccess() {
+	ctx := context.Background()
+
+	s.OAuthProvider.On("AuthCodeURL", ctx, mock.AnythingOfType("string"), mock.AnythingOfType("string"), mock.AnythingOfType("string")).
+		Return("https://accounts.google.com/o/oauth2/v2/auth?state=STATE", nil)
+
+	// assert
+	flow, authURL, err := s.Usecase.StartOAuthLogin(ctx, "google")
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), "google", flow.Provider)
+	assert.NoError(s.T(), flow.Valid())
+	assert.Equal(s.T(), "https://accounts.google.com/o/oauth2/v2/auth?state=STATE", authURL)
+	s.OAuthProvider.AssertCalled(s.T(), "AuthCodeURL", ctx, flow.State, flow.Nonce, flow.CodeVerifier)
+}
+
+func (s *UserServiceTestSuite) TestStartOAuthLoginFailWithUnknownProvider() {
+	ctx := context.Background()
+
+	// assert
+	_, _, err := s.Usecase.StartOAuthLogin(ctx, "myspace")
+	assert.ErrorIs(s.T(), err, ErrNotFound)
+}
+
+func (s *UserServiceTestSuite) newOAuthFlow() *entity.OAuthFlow {
+	flow, err := entity.NewFactory().NewOAuthFlow("google")
+	if err != nil {
+		assert.Fail(s.T(), fmt.Sprintf("fail to create flow: %s", err))
+	}
+	return flow
+}
+
+func (s *UserServiceTestSuite) TestOAuthLoginSuccessWithLinkedIdentity() {
+	ctx := context.Background()
+	uuid := "62db52ec-5c8a-4a3c-a3c4-0b69db9a1f30"
+	flow := s.newOAuthFlow()
+	identity := &oidc.Identity{Subject: "110169484474386276334", Email: "other@mail.com", EmailVerified: true}
+
+	s.OAuthProvider.On("Identify", ctx, "CODE", flow.CodeVerifier, flow.Nonce).Return(identity, nil)
+	s.IdentityRepo.On("FetchBySubject", ctx, "google", identity.Subject).
+		Return(dto.NewFactory().NewIdentity("4daaaea8-4721-4644-aaac-7958805b4530", uuid, "google", identity.Subject, "good-guy@mail.com", time.Now()), nil)
+	s.Repository.On("FetchByID", ctx, uuid).Return(dto.NewFactory().NewUser(uuid, "good-guy@mail.com", "HASHED", nil, nil, nil, time.Now()), nil)
+	s.MFARepository.On("FetchByUserID", ctx, uuid).Return(nil, ErrNotFound)
+	s.AuthUsecase.On("GenereateToken", ctx, uuid).Return(entity.NewFactory().NewAuthTokenPair("access", "refresh"), nil)
+
+	// assert, the email of the provider does not matter once linked
+	tokens, challenge, err := s.Usecase.OAuthLogin(ctx, flow, "google", flow.State, "CODE")
+	assert.NoError(s.T(), err)
+	assert.Nil(s.T(), challenge)
+	assert.NotNil(s.T(), tokens)
+	s.Repository.AssertNotCalled(s.T(), "FetchByEmail", mock.Anything, mock.Anything)
+	s.IdentityRepo.AssertNotCalled(s.T(), "Store", mock.Anything, mock.Anything)
+}
+
+func (s *UserServiceTestSuite) TestOAuthLoginLinksVerifiedUser() {
+	ctx := context.Background()
+	uuid := "62db52ec-5c8a-4a3c-a3c4-0b69db9a1f30"
+	email := "good-guy@mail.com"
+	verifiedAt := time.Now()
+	flow := s.newOAuthFlow()
+	identity := &oidc.Identity{Subject: "110169484474386276334", Email: email, EmailVerified: true}
+
+	s.OAuthProvider.On("Identify", ctx, "CODE", flow.CodeVerifier, flow.Nonce).Return(identity, nil)
+	s.IdentityRepo.On("FetchBySubject", ctx, "google", identity.Subject).Return(nil, ErrNotFound)
+	s.Repository.On("FetchByEmail", ctx, email).Return(dto.NewFactory().NewUser(uuid, email, "HASHED", nil, &verifiedAt, nil, time.Now()), nil)
+	s.MFARepository.On("FetchByUserID", ctx, uuid).Return(s.newUserMFA(uuid, true), nil)
+	s.AuthUsecase.On("GenerateMFAToken", ctx, uuid).Return("MFA-TOKEN", nil)
+
+	var linked *dto.Identity
+	s.IdentityRepo.On("Store", ctx, mock.AnythingOfType("*dto.Identity")).
+		Run(func(args mock.Arguments) { linked = args.Get(1).(*dto.Identity) }).
+		Return(nil)
+
+	// assert, the second factor is still required
+	tokens, challenge, err := s.Usecase.OAuthLogin(ctx, flow, "google", flow.State, "CODE")
+	assert.NoError(s.T(), err)
+	assert.Nil(s.T(), tokens)
+	assert.Equal(s.T(), "MFA-TOKEN", challenge.Token)
+
+	// assert, the account of the provider is linked to the user
+	assert.Equal(s.T(), uuid, linked.UserID)
+	assert.Equal(s.T(), "google", linked.Provider)
+	assert.Equal(s.T(), identity.Subject, linked.Subject)
+	s.Repository.AssertNotCalled(s.T(), "Store", mock.Anything, mock.Anything)
+}
+
+func (s *UserServiceTestSuite) TestOAuthLoginSignsUpNewUser() {
+	ctx := context.Background()
+	email := "new-guy@mail.com"
+	flow := s.newOAuthFlow()
+	identity := &oidc.Identity{Subject: "110169484474386276334", Email: email, EmailVerified: true}
+
+	s.OAuthProvider.On("Identify", ctx, "CODE", flow.CodeVerifier, flow.Nonce).Return(identity, nil)
+	s.IdentityRepo.On("FetchBySubject", ctx, "google", identity.Subject).Return(nil, ErrNotFound)
+	s.Repository.On("FetchByEmail", ctx, email).Return(nil, ErrNotFound)
+	s.IdentityRepo.On("Store", ctx, mock.AnythingOfType("*dto.Identity")).Return(nil)
+	s.MFARepository.On("FetchByUserID", ctx, mock.AnythingOfType("string")).Return(nil, ErrNotFound)
+	s.AuthUsecase.On("GenereateToken", ctx, mock.AnythingOfType("string")).Return(entity.NewFactory().NewAuthTokenPair("access", "refresh"), nil)
+
+	var stored *dto.User
+	s.Repository.On("Store", ctx, mock.AnythingOfType("*dto.User")).
+		Run(func(args mock.Arguments) { stored = args.Get(1).(*dto.User) }).
+		Return(nil)
+
+	// assert
+	tokens, _, err := s.Usecase.OAuthLogin(ctx, flow, "google", flow.State, "CODE")
+	assert.NoError(s.T(), err)
+	assert.NotNil(s.T(), tokens)
+
+	// assert, the provider verified the address
+	assert.Equal(s.T(), email, stored.Email)
+	assert.NotNil(s.T(), stored.VerifiedAt)
+	s.IdentityRepo.AssertExpectations(s.T())
+}
+
+func (s *UserServiceTestSuite) TestOAuthLoginFailWhenUserNotVerified() {
+	ctx := context.Background()
+	uuid := "62db52ec-5c8a-4a3c-a3c4-0b69db9a1f30"
+	email := "good-guy@mail.com"
+	flow := s.newOAuthFlow()
+	identity := &oidc.Identity{Subject: "110169484474386276334", Email: email, EmailVerified: true}
+
+	s.OAuthProvider.On("Identify", ctx, "CODE", flow.CodeVerifier, flow.Nonce).Return(identity, nil)
+	s.IdentityRepo.On("FetchBySubject", ctx, "google", identity.Subject).Return(nil, ErrNotFound)
+	s.Repository.On("FetchByEmail", ctx, email).Return(dto.NewFactory().NewUser(uuid, email, "HASHED", nil, nil, nil, time.Now()), nil)
+
+	// assert, whoever registered the address may not own it
+	_, _, err := s.Usecase.OAuthLogin(ctx, flow, "google", flow.State, "CODE")
+	assert.ErrorIs(s.T(), err, ErrUnauthorized)
+	s.IdentityRepo.AssertNotCalled(s.T(), "Store", mock.Anything, mock.Anything)
+	s.AuthUsecase.AssertNotCalled(s.T(), "GenereateToken", mock.Anything, mock.Anything)
+}
+
+func (s *UserServiceTestSuite) TestOAuthLoginLinksUserWithoutPassword() {
+	ctx := context.Background()
+	uuid := "62db52ec-5c8a-4a3c-a3c4-0b69db9a1f30"
+	email := "good-guy@mail.com"
+	flow := s.newOAuthFlow()
+	identity := &oidc.Identity{Subject: "110169484474386276334", Email: email, EmailVerified: true}
+	tokens := entity.NewFactory().NewAuthTokenPair("ACCESS-TOKEN", "REFRESH-TOKEN")
+
+	s.OAuthProvider.On("Identify", ctx, "CODE", flow.CodeVerifier, flow.Nonce).Return(identity, nil)
+	s.IdentityRepo.On("FetchBySubject", ctx, "google", identity.Subject).Return(nil, ErrNotFound)
+	s.Repository.On("FetchByEmail", ctx, email).Return(dto.NewFactory().NewUser(uuid, email, "", nil, nil, nil, time.Now()), nil)
+	s.IdentityRepo.On("Store", ctx, mock.AnythingOfType("*dto.Identity")).Return(nil)
+	s.MFARepository.On("FetchByUserID", ctx, uuid).Return(nil, ErrNotFound)
+	s.AuthUsecase.On("GenereateToken", ctx, uuid).Return(tokens, nil)
+
+	var updated *dto.User
+	s.Repository.On("Update", ctx, mock.AnythingOfType("*dto.User")).
+		Run(func(args mock.Arguments) { updated = args.Get(1).(*dto.User) }).
+		Return(nil)
+
+	// assert, a magic link request for the address does not lock the owner out
+	result, _, err := s.Usecase.OAuthLogin(ctx, flow, "google", flow.State, "CODE")
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), tokens, result)
+	assert.NotNil(s.T(), updated.VerifiedAt)
+}
+
+func (s *UserServiceTestSuite) TestOAuthLoginFailWhenEmailNotVerified() {
+	ctx := context.Background()
+	flow := s.newOAuthFlow()
+	identity := &oidc.Identity{Subject: "110169484474386276334", Email: "good-guy@mail.com", EmailVerified: false}
+
+	s.OAuthProvider.On("Identify", ctx, "CODE", flow.CodeVerifier, flow.Nonce).Return(identity, nil)
+	s.IdentityRepo.On("FetchBySubject", ctx, "google", identity.Subject).Return(nil, ErrNotFound)
+
+	// assert
+	_, _, err := s.Usecase.OAuthLogin(ctx, flow, "google", flow.State, "CODE")
+	assert.ErrorIs(s.T(), err, ErrUnauthorized)
+	s.Repository.AssertNotCalled(s.T(), "FetchByEmail", mock.Anything, mock.Anything)
+}
+
+func (s *UserServiceTestSuite) TestOAuthLoginFailWithStateMismatch() {
+	ctx := context.Background()
+	flow := s.newOAuthFlow()
+
+	// assert
+	_, _, err := s.Usecase.OAuthLogin(ctx, flow, "google", "FORGED-STATE", "CODE")
+	assert.ErrorIs(s.T(), err, ErrUnauthorized)
+
+	_, _, err = s.Usecase.OAuthLogin(ctx, nil, "google", flow.State, "CODE")
+	assert.ErrorIs(s.T(), err, ErrUnauthorized)
+	s.OAuthProvider.AssertNotCalled(s.T(), "Identify", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func (s *UserServiceTestSuite) TestOAuthLoginFailWithRejectedCode() {
+	ctx := context.Background()
+	flow := s.newOAuthFlow()
+
+	s.OAuthProvider.On("Identify", ctx, "CODE", flow.CodeVerifier, flow.Nonce).Return(nil, oidc.ErrInvalidGrant)
+
+	// assert
+	_, _, err := s.Usecase.OAuthLogin(ctx, flow, "google", flow.State, "CODE")
+	assert.ErrorIs(s.T(), err, ErrUnauthorized)
+}
+
+func (s *UserServiceTestSuite) TestListUsersSuccess() {
+	ctx := context.Background()
+	userDTO := dto.NewFactory().NewUser("62db52ec-5c8a-4a3c-a3c4-0b69db9a1f30", "hatsune@miku.com", "", []string{entity.RoleAdmin}, nil, nil, time.Now())
+
+	s.Repository.On("Search", ctx, "miku", uint64(50), uint64(0)).Return([]*dto.User{userDTO}, nil)
+
+	// assert
+	users, err := s.Usecase.ListUsers(ctx, "miku", 50, 0)
+	assert.NoError(s.T(), err)
+	assert.Len(s.T(), users, 1)
+	assert.Equal(s.T(), userDTO.Email, users[0].Email)
+	assert.True(s.T(), users[0].HasRole(entity.RoleAdmin))
+}
+
+func (s *UserServiceTestSuite) TestListUsersFailWithInvalidLimit() {
+	ctx := context.Background()
+
+	// assert
+	for _, limit := range []uint64{0, maxListUsersLimit + 1} {
+		_, err := s.Usecase.ListUsers(ctx, "", limit, 0)
+		assert.ErrorIs(s.T(), err, ErrInvalidRequest)
+	}
+	s.Repository.AssertNotCalled(s.T(), "Search", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func (s *UserServiceTestSuite) TestDisableUserSuccess() {
+	ctx := context.Background()
+	id := "62db52ec-5c8a-4a3c-a3c4-0b69db9a1f30"
+	userDTO := dto.NewFactory().NewUser(id, "hatsune@miku.com", "", nil, nil, nil, time.Now())
+
+	var updated *dto.User
+	s.Repository.On("FetchByID", ctx, id).Return(userDTO, nil)
+	s.Repository.On("Update", ctx, mock.AnythingOfType("*dto.User")).
+		Run(func(args mock.Arguments) { updated = args.Get(1).(*dto.User) }).
+		Return(nil)
+	s.AuthUsecase.On("RevokeAllTokens", ctx, id).Return(nil)
+
+	// assert
+	err := s.Usecase.DisableUser(ctx, id)
+	assert.NoError(s.T(), err)
+	assert.NotNil(s.T(), updated.DisabledAt)
+	s.AuthUsecase.AssertExpectations(s.T())
+}
+
+func (s *UserServiceTestSuite) TestDisableUserFailWhenUnknown() {
+	ctx := context.Background()
+	id := "62db52ec-5c8a-4a3c-a3c4-0b69db9a1f30"
+
+	s.Repository.On("FetchByID", ctx, id).Return(nil, ErrNotFound)
+
+	// assert
+	err := s.Usecase.DisableUser(ctx, id)
+	assert.ErrorIs(s.T(), err, ErrNotFound)
+	s.Repository.AssertNotCalled(s.T(), "Update", mock.Anything, mock.Anything)
+	s.AuthUsecase.AssertNotCalled(s.T(), "RevokeAllTokens", mock.Anything, mock.Anything)
+}
+
+func (s *UserServiceTestSuite) TestEnableUserSuccess() {
+	ctx := context.Background()
+	id := "62db52ec-5c8a-4a3c-a3c4-0b69db9a1f30"
+	disabledAt := time.Now()
+	userDTO := dto.NewFactory().NewUser(id, "hatsune@miku.com", "", nil, nil, &disabledAt, time.Now())
+
+	var updated *dto.User
+	s.Repository.On("FetchByID", ctx, id).Return(userDTO, nil)
+	s.Repository.On("Update", ctx, mock.AnythingOfType("*dto.User")).
+		Run(func(args mock.Arguments) { updated = args.Get(1).(*dto.User) }).
+		Return(nil)
+
+	// assert
+	err := s.Usecase.EnableUser(ctx, id)
+	assert.NoError(s.T(), err)
+	assert.Nil(s.T(), updated.DisabledAt)
+}
+
+func (s *UserServiceTestSuite) TestForceLogoutSuccess() {
+	ctx := context.Background()
+	id := "62db52ec-5c8a-4a3c-a3c4-0b69db9a1f30"
+	userDTO := dto.NewFactory().NewUser(id, "hatsune@miku.com", "", nil, nil, nil, time.Now())
+
+	s.Repository.On("FetchByID", ctx, id).Return(userDTO, nil)
+	s.AuthUsecase.On("RevokeAllTokens", ctx, id).Return(nil)
+
+	// assert
+	err := s.Usecase.ForceLogout(ctx, id)
+	assert.NoError(s.T(), err)
+	s.AuthUsecase.AssertExpectations(s.T())
+}
+
+func (s *UserServiceTestSuite) TestExportSuccess() {
+	ctx := context.Background()
+	uuid := "62db52ec-5c8a-4a3c-a3c4-0b69db9a1f30"
+	now := time.Now()
+	todos := []*entity.Todo{
+		{ID: "4daaaea8-4721-4644-aaac-7958805b4530", UserID: uuid, Content: "things todo", CreatedAt: now, UpdatedAt: now},
+		{ID: "5d9e6b0a-2f6e-4c1b-9a55-3e4c6f0d7a21", UserID: uuid, Content: "things done", CreatedAt: now, UpdatedAt: now, Deleted: true},
+	}
+	tags := []*entity.Tag{
+		{ID: "7d3c1a52-96b4-4f0e-8d2b-3a1f6e9c0b47", UserID: uuid, Name: "home", Color: "#4caf50", CreatedAt: now, UpdatedAt: now},
+	}
+
+	s.Repository.On("FetchByID", ctx, uuid).Return(dto.NewFactory().NewUser(uuid, "good-guy@mail.com", "HASHED", nil, nil, nil, now), nil)
+	s.ProfileRepo.On("FetchByUserID", ctx, uuid).Return(nil, ErrNotFound)
+	s.TodoUsecase.On("FetchAllByUser", ctx, mock.AnythingOfType("*entity.User"),
+		entity.NewFactory().NewTodoFilter(entity.TodoStatusAll, entity.TodoDeletedInclude, nil, nil, nil, nil, "", nil, entity.TodoTagMatchAny)).Return(todos, nil)
+	s.TodoUsecase.On("FetchTagsByUser", ctx, mock.AnythingOfType("*entity.User")).Return(tags, nil)
+
+	// assert, deleted todos are exported too
+	export, err := s.Usecase.Export(ctx, uuid)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), "good-guy@mail.com", export.User.Email)
+	assert.Equal(s.T(), uuid, export.Profile.UserID)
+	assert.Equal(s.T(), todos, export.Todos)
+	assert.Equal(s.T(), tags, export.Tags)
+	assert.False(s.T(), export.ExportedAt.IsZero())
+}
+
+func (s *UserServiceTestSuite) TestExportFailWhenUnknown() {
+	ctx := context.Background()
+	uuid := "62db52ec-5c8a-4a3c-a3c4-0b69db9a1f30"
+
+	s.Repository.On("FetchByID", ctx, uuid).Return(nil, ErrNotFound)
+
+	// assert
+	_, err := s.Usecase.Export(ctx, uuid)
+	assert.ErrorIs(s.T(), err, ErrNotFound)
+	s.TodoUsecase.AssertNotCalled(s.T(), "FetchAllByUser", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func (s *UserServiceTestSuite) TestDeleteSuccess() {
+	ctx := context.Background()
+	uuid := "62db52ec-5c8a-4a3c-a3c4-0b69db9a1f30"
+	email := "good-guy@mail.com"
+	password, err := s.PasswordHasher.Hash([]byte("STRONG-PASSWORD"))
+	if err != nil {
+		assert.Fail(s.T(), fmt.Sprintf("fail to hash plainPassword: %s", err))
+	}
+
+	avatarID := "5c6a9a1e-8f3b-4d0c-9d4e-2f7b1c3a6e10"
+	if err := s.BlobStore.Put(ctx, entity.AvatarKey(avatarID), testAvatar); err != nil {
+		assert.Fail(s.T(), fmt.Sprintf("fail to put avatar: %s", err))
+	}
+
+	s.Repository.On("FetchByID", ctx, uuid).Return(dto.NewFactory().NewUser(uuid, email, password, nil, nil, nil, time.Now()), nil)
+	s.ProfileRepo.On("FetchByUserID", ctx, uuid).Return(dto.NewFactory().NewUserProfile(uuid, "", "", "", avatarID, map[string]interface{}{}, time.Now()), nil)
+	s.Repository.On("Delete", ctx, uuid).Return(nil)
+	s.TodoUsecase.On("PurgeUser", ctx, mock.AnythingOfType("*entity.User")).Return(nil)
+
+	// assert, the avatar and the indexed todos are deleted with the user
+	err = s.Usecase.Delete(ctx, uuid, "", "STRONG-PASSWORD")
+	assert.NoError(s.T(), err)
+	s.Repository.AssertExpectations(s.T())
+	s.TodoUsecase.AssertExpectations(s.T())
+	assert.NotNil(s.T(), s.Mailer.Last(email))
+	_, err = s.BlobStore.Get(ctx, entity.AvatarKey(avatarID))
+	assert.ErrorIs(s.T(), err, blob.ErrNotFound)
+}
+
+func (s *UserServiceTestSuite) TestDeleteFailWithWrongPassword() {
+	ctx := context.Background()
+	uuid := "62db52ec-5c8a-4a3c-a3c4-0b69db9a1f30"
+	password, err := s.PasswordHasher.Hash([]byte("STRONG-PASSWORD"))
+	if err != nil {
+		assert.Fail(s.T(), fmt.Sprintf("fail to hash plainPassword: %s", err))
+	}
+
+	s.Repository.On("FetchByID", ctx, uuid).Return(dto.NewFactory().NewUser(uuid, "good-guy@mail.com", password, nil, nil, nil, time.Now()), nil)
+
+	// assert
+	err = s.Usecase.Delete(ctx, uuid, "", "WRONG-PASSWORD")
+	assert.ErrorIs(s.T(), err, ErrUnauthorized)
+	s.Repository.AssertNotCalled(s.T(), "Delete", mock.Anything, mock.Anything)
+	assert.Empty(s.T(), s.Mailer.Messages())
+}
+
+func (s *UserServiceTestSuite) TestDeleteWithoutPasswordSuccessAfterFreshLogin() {
+	ctx := context.Background()
+	uuid := "62db52ec-5c8a-4a3c-a3c4-0b69db9a1f30"
+	email := "good-guy@mail.com"
+	sessionID := "4daaaea8-4721-4644-aaac-7958805b4530"
+
+	session, err := entity.NewFactory().NewSession(uuid, sessionID, "Unknown device", "", "", time.Now().Add(time.Hour))
+	if err != nil {
+		assert.Fail(s.T(), fmt.Sprintf("fail to create session: %s", err))
+	}
+
+	verifiedAt := time.Now()
+	s.Repository.On("FetchByID", ctx, uuid).Return(dto.NewFactory().NewUser(uuid, email, "", nil, &verifiedAt, nil, time.Now()), nil)
+	s.AuthUsecase.On("ListSessions", ctx, uuid).Return([]*entity.Session{session}, nil)
+	s.ProfileRepo.On("FetchByUserID", ctx, uuid).Return(nil, ErrNotFound)
+	s.Repository.On("Delete", ctx, uuid).Return(nil)
+	s.TodoUsecase.On("PurgeUser", ctx, mock.AnythingOfType("*entity.User")).Return(nil)
+
+	// assert, the user just logged in with a magic link and has no password to give
+	err = s.Usecase.Delete(ctx, uuid, sessionID, "")
+	assert.NoError(s.T(), err)
+	s.Repository.AssertExpectations(s.T())
+}
+
+func (s *UserServiceTestSuite) TestDeleteWithoutPasswordFailWhenLoginNotRecent() {
+	ctx := context.Background()
+	uuid := "62db52ec-5c8a-4a3c-a3c4-0b69db9a1f30"
+	sessionID := "4daaaea8-4721-4644-aaac-7958805b4530"
+
+	session, err := entity.NewFactory().NewSession(uuid, sessionID, "Unknown device", "", "", time.Now().Add(time.Hour))
+	if err != nil {
+		assert.Fail(s.T(), fmt.Sprintf("fail to create session: %s", err))
+	}
+	session.CreatedAt = time.Now().Add(-time.Hour)
+
+	verifiedAt := time.Now()
+	s.Repository.On("FetchByID", ctx, uuid).Return(dto.NewFactory().NewUser(uuid, "good-guy@mail.com", "", nil, &verifiedAt, nil, time.Now()), nil)
+	s.AuthUsecase.On("ListSessions", ctx, uuid).Return([]*entity.Session{session}, nil)
+
+	// assert, an old session
+	err = s.Usecase.Delete(ctx, uuid, sessionID, "")
+	assert.ErrorIs(s.T(), err, ErrUnauthorized)
+
+	// assert, a personal access token has no session
+	err = s.Usecase.Delete(ctx, uuid, "", "")
+	assert.ErrorIs(s.T(), err, ErrUnauthorized)
+	s.Repository.AssertNotCalled(s.T(), "Delete", mock.Anything, mock.Anything)
+}
+
+func (s *UserServiceTestSuite) TestFetchProfileDefault() {
+	ctx := context.Background()
+	uuid := "62db52ec-5c8a-4a3c-a3c4-0b69db9a1f30"
+
+	s.ProfileRepo.On("FetchByUserID", ctx, uuid).Return(nil, ErrNotFound)
+
+	// assert, users without a saved profile get an empty one
+	profile, err := s.Usecase.FetchProfile(ctx, uuid)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), uuid, profile.UserID)
+	assert.Empty(s.T(), profile.DisplayName)
+	assert.False(s.T(), profile.HasAvatar())
+}
+
+func (s *UserServiceTestSuite) TestUpdateProfileSuccess() {
+	ctx := context.Background()
+	uuid := "62db52ec-5c8a-4a3c-a3c4-0b69db9a1f30"
+	saved := dto.NewFactory().NewUserProfile(uuid, "Miku", "", "ja-JP", "", map[string]interface{}{"show_completed": true}, time.Now())
+
+	s.ProfileRepo.On("FetchByUserID", ctx, uuid).Return(saved, nil)
+	s.ProfileRepo.On("Store", ctx, mock.MatchedBy(func(p *dto.UserProfile) bool {
+		return p.UserID == uuid && p.DisplayName == "Miku" && p.TimeZone == "Asia/Tokyo" && p.Locale == "ja-JP"
+	})).Return(nil)
+
+	// assert, fields missing from the update are kept
+	tz := "Asia/Tokyo"
+	update := entity.NewFactory().NewUserProfileUpdate(nil, &tz, nil, nil)
+	profile, err := s.Usecase.UpdateProfile(ctx, uuid, update)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), "Asia/Tokyo", profile.TimeZone)
+	assert.Equal(s.T(), true, profile.Preferences["show_completed"])
+	s.ProfileRepo.AssertExpectations(s.T())
+}
+
+func (s *UserServiceTestSuite) TestUpdateProfileFailWithInvalidTimeZone() {
+	ctx := context.Background()
+	uuid := "62db52ec-5c8a-4a3c-a3c4-0b69db9a1f30"
+
+	s.ProfileRepo.On("FetchByUserID", ctx, uuid).Return(nil, ErrNotFound)
+
+	// assert
+	tz := "Mars/Olympus_Mons"
+	update := entity.NewFactory().NewUserProfileUpdate(nil, &tz, nil, nil)
+	_, err := s.Usecase.UpdateProfile(ctx, uuid, update)
+	assert.ErrorIs(s.T(), err, ErrInvalidRequest)
+	s.ProfileRepo.AssertNotCalled(s.T(), "Store", mock.Anything, mock.Anything)
+}
+
+func (s *UserServiceTestSuite) TestSetAvatarSuccess() {
+	ctx := context.Background()
+	uuid := "62db52ec-5c8a-4a3c-a3c4-0b69db9a1f30"
+	previousID := "5c6a9a1e-8f3b-4d0c-9d4e-2f7b1c3a6e10"
+	if err := s.BlobStore.Put(ctx, entity.AvatarKey(previousID), testAvatar); err != nil {
+		assert.Fail(s.T(), fmt.Sprintf("fail to put avatar: %s", err))
+	}
+
+	s.ProfileRepo.On("FetchByUserID", ctx, uuid).Return(dto.NewFactory().NewUserProfile(uuid, "", "", "", previousID, map[string]interface{}{}, time.Now()), nil)
+	s.ProfileRepo.On("Store", ctx, mock.AnythingOfType("*dto.UserProfile")).Return(nil)
+
+	// assert, the new image gets a new id
+	profile, err := s.Usecase.SetAvatar(ctx, uuid, testAvatar)
+	assert.NoError(s.T(), err)
+	assert.True(s.T(), profile.HasAvatar())
+	assert.NotEqual(s.T(), previousID, profile.AvatarID)
+
+	image, contentType, err := s.Usecase.FetchAvatar(ctx, profile.AvatarID)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), testAvatar, image)
+	assert.Equal(s.T(), "image/png", contentType)
+
+	// assert, the previous image is deleted
+	_, _, err = s.Usecase.FetchAvatar(ctx, previousID)
+	assert.ErrorIs(s.T(), err, ErrNotFound)
+}
+
+func (s *UserServiceTestSuite) TestSetAvatarFailWithUnsupportedImage() {
+	ctx := context.Background()
+	uuid := "62db52ec-5c8a-4a3c-a3c4-0b69db9a1f30"
+
+	// assert
+	_, err := s.Usecase.SetAvatar(ctx, uuid, []byte("<svg></svg>"))
+	assert.ErrorIs(s.T(), err, ErrInvalidRequest)
+	s.ProfileRepo.AssertNotCalled(s.T(), "Store", mock.Anything, mock.Anything)
+}
+
+func (s *UserServiceTestSuite) TestSetAvatarDeletesImageWhenStoreFails() {
+	ctx := context.Background()
+	uuid := "62db52ec-5c8a-4a3c-a3c4-0b69db9a1f30"
+	var stored string
+
+	s.ProfileRepo.On("FetchByUserID", ctx, uuid).Return(nil, ErrNotFound)
+	s.ProfileRepo.On("Store", ctx, mock.MatchedBy(func(p *dto.UserProfile) bool {
+		stored = p.AvatarID
+		return true
+	})).Return(ErrDatabaseError)
+
+	// assert, no orphaned image is left
+	_, err := s.Usecase.SetAvatar(ctx, uuid, testAvatar)
+	assert.ErrorIs(s.T(), err, ErrDatabaseError)
+	_, err = s.BlobStore.Get(ctx, entity.AvatarKey(stored))
+	assert.ErrorIs(s.T(), err, blob.ErrNotFound)
+}
+
+func (s *UserServiceTestSuite) TestDeleteAvatarSuccess() {
+	ctx := context.Background()
+	uuid := "62db52ec-5c8a-4a3c-a3c4-0b69db9a1f30"
+	avatarID := "5c6a9a1e-8f3b-4d0c-9d4e-2f7b1c3a6e10"
+	if err := s.BlobStore.Put(ctx, entity.AvatarKey(avatarID), testAvatar); err != nil {
+		assert.Fail(s.T(), fmt.Sprintf("fail to put avatar: %s", err))
+	}
+
+	s.ProfileRepo.On("FetchByUserID", ctx, uuid).Return(dto.NewFactory().NewUserProfile(uuid, "", "", "", avatarID, map[string]interface{}{}, time.Now()), nil)
+	s.ProfileRepo.On("Store", ctx, mock.MatchedBy(func(p *dto.UserProfile) bool {
+		return p.AvatarID == ""
+	})).Return(nil)
+
+	// assert
+	profile, err := s.Usecase.DeleteAvatar(ctx, uuid)
+	assert.NoError(s.T(), err)
+	assert.False(s.T(), profile.HasAvatar())
+	_, err = s.BlobStore.Get(ctx, entity.AvatarKey(avatarID))
+	assert.ErrorIs(s.T(), err, blob.ErrNotFound)
+}
+
+func (s *UserServiceTestSuite) TestFetchAvatarFailWithInvalidID() {
+	ctx := context.Background()
+
+	// assert, ids can not reach other keys of the store
+	_, _, err := s.Usecase.FetchAvatar(ctx, "../secrets")
+	assert.ErrorIs(s.T(), err, ErrNotFound)
+}
+
 func TestUserService(t *testing.T) {
 	suite.Run(t, new(UserServiceTestSuite))
 }